@@ -1,14 +1,20 @@
 package dca
 
 import (
+	"cmp"
 	"context"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
+	"maps"
+	"net/http"
 	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
 )
 
 var (
@@ -23,119 +29,1356 @@ var (
 // AppConfig represents the configuration for App.
 type AppConfig struct {
 	// Kraken credentials
-	KrakenAPIKey     string `json:"krakenApiKey"`
-	KrakenPrivateKey string `json:"krakenPrivateKey"`
+	KrakenAPIKey     string `json:"krakenApiKey" desc:"Kraken API key, may reference a secret" schema:"required"`
+	KrakenPrivateKey string `json:"krakenPrivateKey" desc:"Kraken private key, optionally base64 encoded, may reference a secret" schema:"required"`
+	// Overrides the Kraken REST API base URL
+	KrakenBaseURL string `json:"krakenBaseUrl" desc:"Overrides the Kraken REST API base URL"`
+	// Headers added to every outbound HTTP request, e.g. the auth token of an egress proxy, values may reference a secret
+	ExtraHeaders map[string]string `json:"extraHeaders,omitempty" desc:"Headers added to every outbound HTTP request such as the auth token of an egress proxy, values may reference a secret"`
+	// Limits the size of Kraken API responses, defaults to DefaultMaxResponseBytes
+	KrakenMaxResponseBytes int64 `json:"krakenMaxResponseBytes" desc:"Limits the size of Kraken API responses in bytes"`
+	// Tags orders placed by the application, defaults to KrakenDefaultUserRef
+	KrakenUserRef int `json:"krakenUserRef" desc:"Tags orders placed by the application, defaults to 3530"`
+	// The account tier used to estimate the private API counter, defaults to KrakenTierStarter
+	KrakenTier KrakenTier `json:"krakenTier" desc:"The account tier used to estimate the private API counter" enum:"starter,intermediate,pro"`
+	// Delays private API calls that would exceed the estimated rate limit
+	KrakenRateLimitWait bool `json:"krakenRateLimitWait" desc:"Delays private API calls that would exceed the estimated rate limit"`
 	// The amount of volume to try to buy in cents
-	OrderAmountInCents int `json:"orderAmountInCents"`
+	OrderAmountInCents int `json:"orderAmountInCents" desc:"The amount to buy every run in cents" schema:"required"`
+	// A parameter read at the start of every run overriding orderAmountInCents, its value is the amount in cents
+	OrderAmountParameter string `json:"orderAmountParameter" desc:"A parameter such as awsssm://dca/amount read at the start of every run overriding orderAmountInCents, its value is the amount in cents"`
+	// The pair to buy, defaults to KrakenDefaultPair
+	Pair string `json:"pair" desc:"The pair to buy, defaults to XBTUSD"`
+	// The type of order to place, one of market (the default), limit, stop-loss-limit or trailing-stop
+	OrderType string `json:"orderType" desc:"The type of order to place, defaults to market" enum:"market,limit,stop-loss-limit,trailing-stop"`
+	// The limit price of limit orders and the trigger price of stop-loss-limit orders
+	Price float64 `json:"price" desc:"The limit price of limit orders and the trigger price of stop-loss-limit orders"`
+	// The limit price of stop-loss-limit orders
+	Price2 float64 `json:"price2" desc:"The limit price of stop-loss-limit orders"`
+	// The trailing offset of trailing-stop orders, an amount or a percentage, e.g. "2.5%"
+	Offset string `json:"offset" desc:"The trailing offset of trailing-stop orders, an amount or a percentage such as 2.5%"`
+	// Attributes orders to a goal, e.g. retirement, so several schedules sharing an account can be told apart
+	Label string `json:"label" desc:"Attributes orders to a goal so several schedules sharing an account can be told apart"`
+	// Key/value metadata attached to every order, e.g. {"household":"A"}, merged key by key with the profile's and the event's
+	Tags map[string]string `json:"tags,omitempty" desc:"Key/value metadata attached to every order and run summary, e.g. cost centers, merged key by key with the tags of the profile and then of the triggering event or --tag flags"`
+	// Named overlays of the config, the selected one is merged onto the rest of the config when it's loaded
+	Profiles map[string]map[string]any `json:"profiles,omitempty" desc:"Named overlays of the config, the selected profile is merged onto the rest of the config"`
+	// The profile applied when none is selected at invocation, set to the applied profile once loaded
+	Profile string `json:"profile,omitempty" desc:"The profile applied when none is selected with --profile or the triggering event"`
+	// Wait for fills on Kraken's WebSocket API instead of polling, falling back to polling when the connection fails
+	KrakenWebSocket bool `json:"krakenWebSocket" desc:"Wait for fills on Kraken's WebSocket API instead of polling, falling back to polling when the connection fails"`
+	// How long an order waits for its fill on the WebSocket API, e.g. 2m, defaults to 1m
+	KrakenFillTimeout string `json:"krakenFillTimeout" desc:"How long an order waits for its fill on the WebSocket API, defaults to 1m"`
+	// How long a run may take, e.g. 5m, defaults to 2m. Each step is given part of the time left and a run out of time is interrupted
+	RunTimeout string `json:"runTimeout" desc:"How long the steps of a run may take before it's interrupted, each step is given part of the time left, defaults to 2m"`
+	// How far the executed volume may fall short of the order's volume for it to count as filled, e.g. 0.1% or 0.00000010
+	FillTolerance string `json:"fillTolerance" desc:"How far the executed volume of a closed order may fall short of its volume for it to count as filled instead of partial, a volume of the base asset or a percentage such as 0.1%, defaults to 0.1%"`
+	// Rounds order volumes down to a multiple of this increment of the base asset, e.g. "0.00001"
+	VolumeRounding string `json:"volumeRounding" desc:"Rounds order volumes down to a multiple of this increment of the base asset, e.g. 0.00001"`
+	// Place a post-only limit order at the bid when the market is in post_only mode instead of failing
+	PostOnlyFallback bool `json:"postOnlyFallback" desc:"Place a post-only limit order when the market is in post_only mode instead of failing"`
+	// Skip the order instead of failing when funds are insufficient but a pending deposit covers the shortfall
+	SkipOnPendingDeposit bool `json:"skipOnPendingDeposit" desc:"Skip the order when funds are insufficient but a pending deposit covers the shortfall"`
+	// Skip the order when the price is more than this percentage away from the previous purchase price
+	MaxPriceDeviationPercent float64 `json:"maxPriceDeviationPercent" desc:"Skip the order when the price is more than this percentage away from the previous recorded purchase price"`
+	// Warn when a market order fills more than this percentage worse than the quoted price
+	SlippageAlertPercent float64 `json:"slippageAlertPercent" desc:"Warn when a market order fills more than this percentage worse than the quoted price"`
+	// Compare the fill price of every order to the day's volume-weighted average price
+	CompareVWAP bool `json:"compareVWAP" desc:"Compare the fill price of every order to the day's volume-weighted average price"`
+	// Report the unrealized profit or loss of the recorded orders at the current price, requires an order store
+	ReportUnrealizedPnL bool `json:"reportUnrealizedPnL" desc:"Report the unrealized profit or loss of the recorded orders at the current price, requires orderStorePath"`
+	// Trim the trailing zeros of crypto volumes in receipts, logs and CLI output
+	TrimTrailingZeros bool `json:"trimTrailingZeros" desc:"Trim the trailing zeros of crypto volumes in receipts, logs and CLI output"`
+	// Spend the available balance instead of failing when it's within this percentage below the order amount
+	SweepThresholdPercent float64 `json:"sweepThresholdPercent" desc:"Spend the available balance instead of failing when it's within this percentage below the order amount"`
+	// Fail the run when any of the cost, fee, price or volume of a placed order can't be parsed instead of warning
+	StrictOrderInfo bool `json:"strictOrderInfo" desc:"Fail the run when the execution details of a placed order can't all be parsed instead of warning"`
+	// Ask for confirmation on the terminal before placing orders above this amount in cents
+	ConfirmAboveCents int `json:"confirmAboveCents" desc:"Ask for confirmation on the terminal before placing orders above this amount in cents, orders above it fail when there is no terminal"`
+	// Retry the run up to this many attempts in total when it fails transiently, defaults to a single attempt
+	RetryMaxAttempts int `json:"retryMaxAttempts" desc:"Retry the run up to this many attempts in total when it fails transiently, requires orderStorePath, defaults to 1"`
+	// The wait before the first retry, doubled for every further retry, e.g. 30s, defaults to 10s
+	RetryBackoff string `json:"retryBackoff" desc:"The wait before the first retry, doubled for every further retry, defaults to 10s"`
+	// Remind to fund the account in notifications when the balance left after a run covers fewer runs than this
+	LowBalanceThresholdRuns int `json:"lowBalanceThresholdRuns" desc:"Remind to fund the account in notifications when the balance left after a run covers fewer runs than this"`
+	// Included in funding reminders, e.g. the bank details and Kraken funding reference to deposit with
+	FundingInstructions string `json:"fundingInstructions" desc:"Included in funding reminders, e.g. the bank details and Kraken funding reference to deposit with"`
+	// Include the deposit methods of the quote currency in funding reminders
+	FundingDepositMethods bool `json:"fundingDepositMethods" desc:"Include the deposit methods of the quote currency in funding reminders"`
+	// Fail the run before ordering when the store, a notifier or the failure archive fails its check instead of warning
+	StrictIntegrations bool `json:"strictIntegrations" desc:"Fail the run before ordering when the order store, a notifier or the failure archive fails its startup check instead of warning"`
+	// Skip every run until unpaused, the run still notifies so the pause isn't forgotten
+	Paused bool `json:"paused" desc:"Skip every run until unpaused, skipped runs still notify"`
+	// Resume automatically at this date, e.g. 2024-05-01 in the reporting time zone, or RFC 3339 time, requires paused
+	PausedUntil string `json:"pausedUntil" desc:"Resume a pause automatically at this date in the reporting time zone, e.g. 2024-05-01, or RFC 3339 time"`
+	// A parameter read at the start of every run overriding paused, true, false or the date runs are paused until
+	PauseParameter string `json:"pauseParameter" desc:"A parameter such as awsssm://dca/pause read at the start of every run overriding paused, its value is true, false or the date runs are paused until"`
+	// Where post-mortems of failed runs are written, an S3 URL such as s3://bucket/prefix or a local directory
+	FailureArchive string `json:"failureArchive" desc:"Where post-mortems of failed runs are written, an S3 URL such as s3://bucket/prefix or a local directory"`
+	// Log the ticker every run saw to a JSON Lines file
+	PriceLog *PriceLogConfig `json:"priceLog" desc:"Log the ticker seen by every run to a JSON Lines file"`
+	// Path of the JSON Lines file orders are recorded to
+	OrderStorePath string `json:"orderStorePath" desc:"Path of the JSON Lines file orders are recorded to"`
+	// Prune the details of old order records at the end of every run, optionally archiving them first
+	Retention *RetentionConfig `json:"retention" desc:"Prune the details of order records older than a number of days at the end of every run, archiving them first when an archive is set"`
+	// Adopt orders placed since the last recorded order that were never recorded, requires orderStorePath
+	ReconcileOrders bool `json:"reconcileOrders" desc:"Adopt orders placed since the last recorded order that were never recorded"`
+	// What to do after adopting an order, either DedupePolicyProceed (the default) or DedupePolicySkip
+	DedupePolicy string `json:"dedupePolicy" desc:"What to do after adopting an order, defaults to proceed" enum:"proceed,skip"`
+	// Directory the idempotency key of every scheduled run is reserved in so a run is never ordered twice
+	IdempotencyStorePath string `json:"idempotencyStorePath" desc:"Directory the idempotency key of every scheduled run is reserved in so a run is never ordered twice"`
+	// Allocate purchased volume to the Kraken Earn strategy identified by earnStrategyId
+	EarnAllocate   bool   `json:"earnAllocate" desc:"Allocate purchased volume to the Kraken Earn strategy identified by earnStrategyId"`
+	EarnStrategyID string `json:"earnStrategyId" desc:"The Kraken Earn strategy purchased volume is allocated to"`
+	// The IANA time zone, e.g. America/New_York, human-facing timestamps are rendered in, defaults to UTC
+	ReportingTimeZone string `json:"reportingTimeZone" desc:"The IANA time zone human-facing timestamps are rendered in, defaults to UTC"`
+	// How late a scheduled run may start before a warning is added, e.g. 10m, defaults to 5m
+	ScheduleDriftWarning string `json:"scheduleDriftWarning" desc:"How late a scheduled run may start before a warning is added, defaults to 5m"`
+	// How far the local clock may be from Kraken's before runs fail, e.g. 1m, defaults to 30s
+	MaxClockSkew string `json:"maxClockSkew" desc:"How far the local clock may be from Kraken's before runs fail with a clock skew error, defaults to 30s"`
+	// Skip measuring the clock skew against Kraken's time at the start of every run
+	SkipClockSkewCheck bool `json:"skipClockSkewCheck" desc:"Skip measuring the clock skew against Kraken's time at the start of every run"`
+	// A template file overriding the line, text or html receipt templates used by notifiers
+	ReceiptTemplate string `json:"receiptTemplate" desc:"A template file overriding the line, text or html receipt templates used by notifiers"`
+	// Publish run summaries to an MQTT broker
+	MQTT *MQTTConfig `json:"mqtt" desc:"Publish run summaries to an MQTT broker"`
+	// Post an embed summarizing every run to a Discord webhook
+	Discord *DiscordConfig `json:"discord" desc:"Post an embed summarizing every run to a Discord webhook"`
+	// Push run metrics to a Prometheus pushgateway
+	Pushgateway *PushgatewayConfig `json:"pushgateway" desc:"Push run metrics to a Prometheus pushgateway"`
+	// Append a record of every call to the exchange, without bodies or credentials, to a file or an S3 URL such as s3://bucket/prefix
+	AuditLog string `json:"auditLog" desc:"Append a JSON line for every call to the exchange, without bodies or credentials, to a local file or under an S3 URL such as s3://bucket/prefix"`
+	// Write logs to a file rotated by size instead of stdout, warnings and errors are still written to stderr
+	LogFile *LogFileConfig `json:"logFile" desc:"Write logs to a file rotated by size instead of stdout, warnings and errors are still written to stderr"`
+	// Where orders are placed, one of kraken (the default), paper or paper-realistic
+	Provider string `json:"provider" desc:"Where orders are placed, paper providers simulate orders using public market data, defaults to kraken" enum:"kraken,paper,paper-realistic"`
+	// The fee rate of simulated orders, defaults to DefaultPaperFeeRate
+	PaperFeeRate float64 `json:"paperFeeRate" desc:"The fraction of the cost of simulated orders charged as a fee, defaults to 0.004"`
+	// The number of order book levels walked by the paper-realistic provider, defaults to DefaultPaperDepthLevels
+	PaperDepthLevels int `json:"paperDepthLevels" desc:"The number of order book levels walked by the paper-realistic provider, defaults to 100"`
+	// Fetch the trading rules of the pair, such as the minimum order volume, instead of using built-in minimums
+	PairMetadata *PairMetadataConfig `json:"pairMetadata" desc:"Fetch the trading rules of the pair, such as the minimum order volume, from Kraken instead of using built-in minimums"`
+	// Stop placing orders with a failing provider, only useful when the app runs repeatedly in one process
+	CircuitBreaker *CircuitBreakerConfig `json:"circuitBreaker" desc:"Stop placing orders with a failing provider, only useful when the app runs repeatedly in one process"`
+	// Sign a receipt of every purchase with an Ed25519 key so it can be shared as a tamper-evident proof
+	SignedReceipts *SignedReceiptConfig `json:"signedReceipts" desc:"Sign a receipt of every purchase with an Ed25519 key, added to the run summary and optionally written to a directory or S3"`
+	// Pace a monthly budget across the runs left in the month instead of ordering orderAmountInCents, requires orderStorePath
+	Budget *BudgetConfig `json:"budget" desc:"Spend a monthly budget evenly across the runs left in the month instead of ordering orderAmountInCents every run"`
+	// Select the amount of every run by the current price, e.g. spend more when the price is lower
+	PriceLadder PriceLadder `json:"priceLadder" desc:"Tiers ordered by maxPrice selecting the amount of every run by the current ask instead of orderAmountInCents"`
+	// What a run does when a custom guard fails to decide, closed fails the run and open ignores the guard with a warning
+	GuardFailurePolicy GuardFailurePolicy `json:"guardFailurePolicy" desc:"What a run does when a custom guard fails to decide, closed fails the run and open ignores the guard with a warning, defaults to closed" enum:"closed,open"`
+	// Sell small leftover balances of other assets after the purchase and buy the pair's base asset with the proceeds
+	DustSweep *DustSweepConfig `json:"dustSweep" desc:"Sell balances of other assets worth less than a threshold after the purchase and buy the pair's base asset with the proceeds"`
+	// Sell an alternate asset, e.g. USDT, for the quote currency before a purchase the quote balance can't cover
+	ConvertFunding *FundingConversionConfig `json:"convertFunding" desc:"Sell an alternate asset, e.g. USDT, for the quote currency before a purchase the quote balance can't cover"`
 }
 
+const (
+	// DedupePolicyProceed places the scheduled order even if a previous order was adopted.
+	DedupePolicyProceed = "proceed"
+	// DedupePolicySkip skips the scheduled order when a previous order was adopted.
+	DedupePolicySkip = "skip"
+)
+
+// OrderRequest returns the order placed by every scheduled run.
+func (c AppConfig) OrderRequest() ExecuteOrderRequest {
+	return ExecuteOrderRequest{
+		AmountInCents: c.OrderAmountInCents,
+		Pair:          c.Pair,
+		OrderType:     c.OrderType,
+		Price:         c.Price,
+		Price2:        c.Price2,
+		Offset:        c.Offset,
+		Label:         c.Label,
+		Tags:          c.Tags,
+	}
+}
+
+// defaultReconcileWindow is how far back reconciliation looks for orders when nothing has been recorded.
+const defaultReconcileWindow = 24 * time.Hour
+
+// SchemaVersion is the version of the run summary, order record and config schemas. It's incremented whenever one of
+// them changes in a way that isn't backwards compatible. Version 2 removed labels, which were merged into the tags,
+// records of version 1 are still read with their labels added to the tags.
+const SchemaVersion = 2
+
+// RunSummary describes the outcome of a run.
+type RunSummary struct {
+	SchemaVersion int `json:"schemaVersion" desc:"The version of the run summary schema" schema:"required"`
+	// RunID identifies the run in logs and failure records.
+	RunID string `json:"runId,omitempty" desc:"A random identifier of the run, also found in its logs"`
+	// CorrelationID traces the run across systems, it's the run ID unless the run was started with one.
+	CorrelationID string    `json:"correlationId,omitempty" desc:"Traces the run across systems, the run ID unless the triggering event carried one"`
+	StartedAt     time.Time `json:"startedAt" desc:"When the run started, in the reporting time zone" schema:"required"`
+	// LocalDate is the calendar date of StartedAt in the reporting time zone.
+	LocalDate string `json:"localDate" desc:"The calendar date of startedAt in the reporting time zone" schema:"required"`
+	// Label is the configured label of the run, set even when no order was placed.
+	Label string `json:"label,omitempty" desc:"The goal the run's orders are attributed to"`
+	// Profile is the config profile the run was loaded with.
+	Profile string `json:"profile,omitempty" desc:"The config profile the run was loaded with"`
+	// Tags are the tags of the run, set even when no order was placed.
+	Tags map[string]string `json:"tags,omitempty" desc:"The tags of the run, attached to its orders"`
+	// Pause holds whether runs are paused and until when, whenever a pause is configured.
+	Pause *PauseState `json:"pause,omitempty" desc:"Whether runs are paused and until when, set whenever a pause is configured"`
+	// SignedReceipt is the signed receipt of the run's purchase when signedReceipts is configured.
+	SignedReceipt *SignedReceipt `json:"signedReceipt,omitempty" desc:"The signed receipt of the run's purchase"`
+	// Budget holds how the run's amount was paced from the monthly budget when one is configured.
+	Budget *BudgetPacing `json:"budget,omitempty" desc:"How the run's amount was paced from the monthly budget"`
+	// Schedule holds how late the run started when it was started by a schedule.
+	Schedule *ScheduleDrift `json:"schedule,omitempty" desc:"How late the run started compared to its schedule"`
+	// Clock holds how far the local clock was from Kraken's unless the check is skipped.
+	Clock      *ClockSkew            `json:"clock,omitempty" desc:"How far the local clock was from Kraken's when the run started"`
+	Status     RunStatus             `json:"status" desc:"The final status of the run" enum:"success,skipped,failed,interrupted" schema:"required"`
+	SkipReason SkipReason            `json:"skipReason,omitempty" desc:"Why a skipped run didn't place an order"`
+	Order      *ExecuteOrderResponse `json:"order,omitempty" desc:"The order placed by the run"`
+	// Asset is the common code of the base asset the run buys, see PairAssets. It's set even when no order was placed
+	// unless the pair is left to the executor.
+	Asset string `json:"asset,omitempty" desc:"The common code of the base asset the run buys, e.g. BTC"`
+	// Conversion holds the sell of the alternate funding asset before the order when convertFunding is configured.
+	Conversion *FundingConversion `json:"conversion,omitempty" desc:"The sell of the alternate funding asset that funded the order"`
+	// Decisions narrate the guards and rules the run evaluated, in the order they were last evaluated.
+	Decisions []Decision `json:"decisions,omitempty" desc:"The decision of every guard and rule the run evaluated, in the order they were last evaluated"`
+	// Adopted holds orders placed by previous runs that were discovered by reconciliation.
+	Adopted []ExecuteOrderResponse `json:"adopted,omitempty" desc:"Orders placed by previous runs that were discovered by reconciliation"`
+	// Interrupted holds what's known about the run's order when the run was interrupted before it finished.
+	Interrupted *Interruption `json:"interrupted,omitempty" desc:"What's known about the run's order when the run was interrupted before it finished"`
+	// Earn holds the allocation of the purchased volume to an earn strategy.
+	Earn *EarnAllocation `json:"earn,omitempty" desc:"The allocation of the purchased volume to an earn strategy"`
+	// DustSweep holds what the dust sweep after the purchase sold and bought when one is configured.
+	DustSweep *DustSweep `json:"dustSweep,omitempty" desc:"What the dust sweep after the purchase sold and bought"`
+	// Kraken holds the estimated private API usage of the run.
+	Kraken *KrakenStats `json:"kraken,omitempty" desc:"The estimated private API usage of the run"`
+	// Timings holds how long each step of placing the run's orders took.
+	Timings []StepTiming `json:"timings,omitempty" desc:"How long each step of placing the run's orders took, in the order they finished"`
+	// Circuit holds the state of the provider's circuit breaker when one is enabled.
+	Circuit *CircuitStatus `json:"circuit,omitempty" desc:"The state of the provider's circuit breaker when one is enabled"`
+	// Funding reminds to fund the account when the balance is running low.
+	Funding *FundingReminder `json:"funding,omitempty" desc:"A reminder to fund the account when the balance covers fewer runs than lowBalanceThresholdRuns"`
+	// Audit counts the calls of the run recorded to the audit log, and the records dropped.
+	Audit *AuditStats `json:"audit,omitempty" desc:"The calls of the run recorded to the audit log and the records dropped because it fell behind"`
+	// Slippage holds the rolling average slippage of recorded orders when an order store is configured.
+	Slippage *SlippageStats `json:"slippage,omitempty" desc:"The rolling average slippage of recently recorded orders"`
+	// VWAP compares the fill price to the day's volume-weighted average price when compareVWAP is set.
+	VWAP *VWAPComparison `json:"vwap,omitempty" desc:"The fill price compared to the day's volume-weighted average price"`
+	// UnrealizedPnL values the holding of the recorded orders at the current price when reportUnrealizedPnL is set.
+	UnrealizedPnL *UnrealizedPnL `json:"unrealizedPnl,omitempty" desc:"The unrealized profit or loss of the recorded orders at the current price"`
+	// Attempts holds every attempt of the run when retries are enabled, the last one ended the run.
+	Attempts []RunAttempt `json:"attempts,omitempty" desc:"Every attempt of the run when retries are enabled, the last one ended the run"`
+	Warnings []string     `json:"warnings,omitempty" desc:"Problems that didn't fail the run"`
+	Error    string       `json:"error,omitempty" desc:"Why a failed run failed"`
+}
+
+// RunStatus is the final status of a run.
+type RunStatus string
+
+const (
+	RunStatusSuccess RunStatus = "success"
+	RunStatusSkipped RunStatus = "skipped"
+	RunStatusFailed  RunStatus = "failed"
+	// RunStatusInterrupted is the status of a run whose context was cancelled before it finished.
+	RunStatusInterrupted RunStatus = "interrupted"
+)
+
 // App represents the core functionality of the application.
 type App struct {
 	Config AppConfig
 	Logger *slog.Logger
+	// Notifiers are sent the summary of every run.
+	Notifiers []Notifier
+	// SecretResolver resolves secret references in the config, defaults to GetAWSParamStoreValue
+	SecretResolver SecretResolver
+	// ScheduledAt is when the run was scheduled to start, e.g. the time of an EventBridge event. The drift from it is
+	// recorded in the run summary unless it's zero.
+	ScheduledAt time.Time
+	// Profile selects a profile of the config when it's loaded, overriding the profile set by the config.
+	Profile string
+	// Tags override the tags of the config and its profile key by key when it's loaded, e.g. the tags of the triggering
+	// event or of --tag flags.
+	Tags map[string]string
+	// CorrelationID traces runs across systems, e.g. from the event that triggered them. Runs without one use their
+	// run ID.
+	CorrelationID string
+	// Prompt asks for confirmation of orders above confirmAboveCents, and of every order when ConfirmOrders is set.
+	// It's only set for interactive terminals, without it orders above the threshold fail.
+	Prompt        *ConfirmPrompt
+	ConfirmOrders bool
+	// IntegrationCheckTimeout bounds the checks of the configured integrations before a run orders, defaults to
+	// DefaultIntegrationCheckTimeout.
+	IntegrationCheckTimeout time.Duration
+	// PrintConfig is set by --print-config, the caller prints EffectiveConfig instead of running.
+	PrintConfig bool
+	// Explain is set by --explain, the caller prints the decisions of the run's summary.
+	Explain bool
+	// PairMetadata keeps the metadata fetched when pairMetadata is configured, share one between apps to reuse it.
+	PairMetadata *PairMetadataCache
+	// ShutdownGrace is how long the calls in flight when the context of Run is cancelled are given to finish, defaults
+	// to DefaultShutdownGrace.
+	ShutdownGrace time.Duration
+	// Executor places the orders of runs instead of the configured provider when set, e.g. a fake in tests. The
+	// checks around the order still call Kraken.
+	Executor OrderExecutor
+	// IdempotencyStore reserves the idempotency keys of runs instead of the store at idempotencyStorePath when set.
+	IdempotencyStore IdempotencyStore
+	// Guards are custom guards evaluated in order by every run after the price ladder, with the ticker and the
+	// history of the order store. See Guard.
+	Guards []Guard
+
+	breakersMu sync.Mutex
+	breakers   map[string]*CircuitBreaker
+
+	// clockSkew is the local clock's offset from Kraken's, measured by the first run of the process
+	clockMu   sync.Mutex
+	clockSkew *time.Duration
+
+	// level is the minimum level of the logs of the logger created by NewApp and of the log file, see SetLogLevel.
+	level       slog.LevelVar
+	logFile     *RotatingFile
+	stopLogFile func()
+	audit       *AuditLog
+
+	// http is shared by the components making HTTP requests, see httpClient.
+	httpMu      sync.Mutex
+	http        *http.Client
+	httpHeaders map[string]string
+	httpAudit   *AuditLog
+
+	// configSources records where every value of Config came from, see EffectiveConfig.
+	configSources ConfigSources
 }
 
-// NewApp creates a new App with an empty config and a JSON logger.
+// NewApp creates a new App with an empty config and a JSON logger logging at info level, see SetLogLevel.
 func NewApp() *App {
-	return &App{
-		Logger: slog.New(slog.NewJSONHandler(os.Stdout, nil)),
+	m := &App{}
+	m.Logger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: &m.level}))
+	return m
+}
+
+// SetLogLevel sets the minimum level of the logs of the logger created by NewApp and of the log file, info by
+// default. A logger set by the caller keeps its own level. Runs log the stack of their error at debug level, which
+// requires stack capture, see SetErrStackCapture.
+func (m *App) SetLogLevel(level slog.Level) {
+	m.level.Set(level)
+}
+
+// LogLevel returns the level set by SetLogLevel.
+func (m *App) LogLevel() slog.Level {
+	return m.level.Level()
+}
+
+// ParseLogLevel parses a level such as debug, info, warn or error, case insensitively. Empty is info.
+func ParseLogLevel(s string) (level slog.Level, err error) {
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err = level.UnmarshalText([]byte(s)); err != nil {
+		return level, fmt.Errorf("invalid log level %q: %w", s, err)
 	}
+	return level, nil
 }
 
 // Run tries to execute a market order using a Kraken provider.
 func (m *App) Run(ctx context.Context) (err error) {
 	m.Logger.InfoContext(ctx, "starting process", "version", Version, "commit", Commit, "date", Date)
 
-	provider := NewKrakenProvider(&KrakenProviderConfig{
-		APIKey:    m.Config.KrakenAPIKey,
-		APISecret: m.Config.KrakenPrivateKey,
-		Logger:    m.Logger,
+	startedAt := time.Now().In(m.Config.Location())
+	summary := RunSummary{SchemaVersion: SchemaVersion, RunID: newRunID(), StartedAt: startedAt, LocalDate: startedAt.Format(time.DateOnly), Label: m.Config.Label, Profile: m.Config.Profile, Tags: m.Config.Tags}
+	summary.CorrelationID = cmp.Or(m.CorrelationID, summary.RunID)
+	summary.Asset, _ = PairAssets(cmp.Or(m.Config.Pair, KrakenDefaultPair))
+
+	// every log of the run carries its IDs
+	logger := m.Logger
+	m.Logger = logger.With("runId", summary.RunID, "correlationId", summary.CorrelationID)
+	if summary.Profile != "" {
+		m.Logger = m.Logger.With("profile", summary.Profile)
+	}
+	defer func() { m.Logger = logger }()
+	m.Logger.InfoContext(ctx, "starting run")
+	m.scheduleDrift(ctx, startedAt, &summary)
+	var audited AuditStats
+	if m.audit != nil {
+		audited = m.audit.Stats()
+	}
+	// The steps of the run share its timeout, it's interrupted once the timeout passes. Its shutdown and reporting
+	// have a context of their own.
+	timeout, _ := time.ParseDuration(m.Config.RunTimeout)
+	budgetCtx, stopBudget := context.WithTimeoutCause(ctx, cmp.Or(timeout, DefaultRunTimeout), ErrRunTimeout)
+	defer stopBudget()
+	// Cancelling ctx interrupts the run: no new step is started and the calls in flight are given the grace period.
+	runCtx, stopGrace := withGrace(budgetCtx, cmp.Or(m.ShutdownGrace, DefaultShutdownGrace))
+	defer stopGrace()
+	decisions := &decisionRecorder{}
+	runCtx = withDecisions(runCtx, decisions)
+	// a panic fails the run like any other error, so it's still archived and notified
+	err = m.recoverPanic(runCtx, "App.Run", func() (err error) {
+		err = interrupted(runCtx)
+		if err == nil {
+			// the paced amount only applies to this run
+			defer func(amount int) { m.Config.OrderAmountInCents = amount }(m.Config.OrderAmountInCents)
+			err = m.runGuards(runCtx, startedAt, &summary)
+		}
+		// paper orders make no private call so they don't depend on the clock
+		if err == nil && !m.Config.SkipClockSkewCheck && m.Config.Provider != ProviderPaper && m.Config.Provider != ProviderPaperRealistic {
+			err = m.checkClock(runCtx, &summary)
+		}
+		if err == nil {
+			err = m.checkIntegrations(runCtx, &summary)
+		}
+		if err == nil {
+			err = interrupted(runCtx)
+		}
+		if err == nil {
+			err = m.runAttempts(runCtx, &summary)
+		}
+		return err
 	})
+	summary.Decisions = decisions.Decisions()
+
+	var st interface{ StackTrace() string }
+	if errors.As(err, &st) {
+		m.Logger.DebugContext(ctx, "run error stack", "error", err, "stack", st.StackTrace())
+	}
+
+	// An interrupted run is shut down with a context of its own, its order may have been placed without being
+	// recorded.
+	var skip *SkipError
+	stopped := err != nil && budgetCtx.Err() != nil && !errors.As(err, &skip)
+	if stopped {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), DefaultShutdownTimeout)
+		defer cancel()
+		// the calls in flight when the timeout passed fail with the deadline rather than the timeout
+		if errors.Is(context.Cause(budgetCtx), ErrRunTimeout) && !errors.Is(err, ErrRunTimeout) {
+			err = fmt.Errorf("%w: %w", ErrRunTimeout, err)
+		}
+		if !errors.Is(err, ErrInterrupted) {
+			err = fmt.Errorf("%w: %w", ErrInterrupted, err)
+		}
+		_ = m.recoverPanic(ctx, "App.recordInterruption", func() error { m.recordInterruption(ctx, startedAt, &summary); return nil })
+	}
+
+	switch err = settleRun(ctx, m.Logger, &summary, err, stopped); summary.Status {
+	case RunStatusFailed, RunStatusInterrupted:
+		_ = m.recoverPanic(ctx, "App.archiveFailure", func() error { m.archiveFailure(ctx, summary, err); return nil })
+	case RunStatusSuccess:
+		_ = m.recoverPanic(ctx, "App.signReceipt", func() error { m.signReceipt(ctx, &summary); return nil })
+	}
+
+	if m.audit != nil {
+		stats := m.audit.Stats()
+		summary.Audit = &AuditStats{Records: stats.Records - audited.Records, Dropped: stats.Dropped - audited.Dropped}
+	}
+	m.notify(ctx, summary)
+	return err
+}
+
+// configurePriceCheck enables the provider's price deviation check against the last purchase recorded in store.
+func (m *App) configurePriceCheck(ctx context.Context, provider *KrakenProvider, store OrderStore) {
+	if m.Config.MaxPriceDeviationPercent <= 0 || store == nil {
+		return
+	}
+
+	provider.MaxPriceDeviationPercent = m.Config.MaxPriceDeviationPercent
+	provider.ReferencePair = cmp.Or(m.Config.Pair, provider.Pair)
+	if records, err := store.List(ctx); err != nil {
+		m.Logger.WarnContext(ctx, "failed to list orders for the price check", "error", err)
+	} else if provider.ReferencePrice = lastPurchasePrice(records, provider.ReferencePair); provider.ReferencePrice == 0 {
+		m.Logger.InfoContext(ctx, "skipping the price check without a previous purchase")
+	}
+}
+
+// newKrakenProvider creates the provider runs order with from the config.
+func (m *App) newKrakenProvider() *KrakenProvider {
+	// validated by LoadConfig, an empty timeout or tolerance leaves the provider default
+	fillTimeout, _ := time.ParseDuration(m.Config.KrakenFillTimeout)
+	var fillTolerance *FillTolerance
+	if t, err := ParseFillTolerance(m.Config.FillTolerance); err == nil {
+		fillTolerance = &t
+	}
+
+	return NewKrakenProvider(&KrakenProviderConfig{
+		APIKey:                m.Config.KrakenAPIKey,
+		APISecret:             m.Config.KrakenPrivateKey,
+		Logger:                m.Logger,
+		BaseURL:               m.Config.KrakenBaseURL,
+		PostOnlyFallback:      m.Config.PostOnlyFallback,
+		SkipOnPendingDeposit:  m.Config.SkipOnPendingDeposit,
+		SweepThresholdPercent: m.Config.SweepThresholdPercent,
+		UserRef:               m.Config.KrakenUserRef,
+		MaxResponseBytes:      m.Config.KrakenMaxResponseBytes,
+		Tier:                  m.Config.KrakenTier,
+		RateLimitWait:         m.Config.KrakenRateLimitWait,
+		VolumeRounding:        m.Config.VolumeRounding,
+		WebSocket:             m.Config.KrakenWebSocket,
+		FillTimeout:           fillTimeout,
+		FillTolerance:         fillTolerance,
+		StrictOrderInfo:       m.Config.StrictOrderInfo,
+		HTTPClient:            m.httpClient(),
+	})
+}
+
+// run places the order of a single attempt of a run, retry is set for attempts after a transient failure.
+func (m *App) run(ctx context.Context, summary *RunSummary, retry bool) error {
+	provider := m.newKrakenProvider()
+	defer func() {
+		stats := provider.Stats()
+		summary.Kraken = &stats
+		summary.Timings = append(summary.Timings, provider.Timings()...)
+		summary.Warnings = append(summary.Warnings, provider.Warnings()...)
+	}()
+
+	// Paper orders aren't real so they're neither recorded nor reconciled against the account.
+	paper := m.Config.Provider == ProviderPaper || m.Config.Provider == ProviderPaperRealistic
+
+	var store OrderStore
+	if m.Config.OrderStorePath != "" && !paper {
+		store = m.fileOrderStore()
+	}
+
+	idempotency, idempotencyKey := m.IdempotencyStore, m.idempotencyKey()
+	if idempotency == nil && m.Config.IdempotencyStorePath != "" {
+		idempotency = NewFileIdempotencyStore(m.Config.IdempotencyStorePath)
+	}
+
+	// A failed attempt may have placed its order, so retries only order once reconciliation found nothing to adopt.
+	var reconciled bool
+	if retry && store != nil {
+		adopted, err := m.reconcile(ctx, provider, store)
+		if err != nil {
+			recordDecision(ctx, Decision{Name: DecisionReconcile, Inputs: map[string]string{"error": err.Error()}, Outcome: DecisionFail,
+				Narration: "orders of the failed attempt can't be checked → fail"})
+			return err
+		} else if summary.Adopted = adopted; len(adopted) > 0 {
+			recordDecision(ctx, Decision{Name: DecisionReconcile, Inputs: map[string]string{"adopted": strconv.Itoa(len(adopted))}, Outcome: DecisionSkip,
+				Narration: fmt.Sprintf("the failed attempt placed order %s → adopt it instead of ordering again", adopted[0].TransactionID)})
+			m.Logger.WarnContext(ctx, "a failed attempt placed its order, not ordering again", "adopted", len(adopted))
+			if idempotency != nil && idempotencyKey != "" {
+				m.commitIdempotencyKey(ctx, idempotency, idempotencyKey, adopted[0], summary)
+			}
+			return nil
+		}
+		recordDecision(ctx, Decision{Name: DecisionReconcile, Inputs: map[string]string{"adopted": "0"}, Outcome: DecisionProceed,
+			Narration: "the failed attempt placed no order → proceed"})
+		reconciled = true
+	} else if m.Config.ReconcileOrders && store != nil {
+		d := Decision{Name: DecisionReconcile, Inputs: map[string]string{"dedupePolicy": cmp.Or(m.Config.DedupePolicy, DedupePolicyProceed)}, Outcome: DecisionProceed}
+		if adopted, err := m.reconcile(ctx, provider, store); err != nil {
+			m.Logger.WarnContext(ctx, "failed to reconcile orders", "error", err)
+			d.Inputs["error"], d.Narration = err.Error(), "reconciliation failed → proceed"
+		} else {
+			summary.Adopted, reconciled = adopted, true
+			d.Inputs["adopted"] = strconv.Itoa(len(adopted))
+			d.Narration = fmt.Sprintf("adopted %d unrecorded orders → proceed", len(adopted))
+		}
+
+		if len(summary.Adopted) > 0 && m.Config.DedupePolicy == DedupePolicySkip {
+			d.Outcome, d.Narration = DecisionSkip, fmt.Sprintf("adopted %d unrecorded orders with dedupePolicy skip → skip", len(summary.Adopted))
+			recordDecision(ctx, d)
+			return &SkipError{Reason: SkipReasonOrderAdopted}
+		}
+		recordDecision(ctx, d)
+	}
+
+	m.configurePriceCheck(ctx, provider, store)
+
+	// priced is the provider the run's ticker is fetched with
+	var executor OrderExecutor = provider
+	priced := provider
+	if paper {
+		paperProvider := NewPaperProvider(&PaperProviderConfig{
+			Logger:           m.Logger,
+			BaseURL:          m.Config.KrakenBaseURL,
+			MaxResponseBytes: m.Config.KrakenMaxResponseBytes,
+			FeeRate:          m.Config.PaperFeeRate,
+			Realistic:        m.Config.Provider == ProviderPaperRealistic,
+			DepthLevels:      m.Config.PaperDepthLevels,
+			HTTPClient:       m.httpClient(),
+		})
+		executor, priced = paperProvider, paperProvider.market
+	}
+	if m.Executor != nil {
+		executor = m.Executor
+	}
+	// the breaker wraps whichever executor places the order, so paper orders never reach Kraken
+	if breaker := m.circuitBreaker("kraken"); breaker != nil {
+		executor = breaker.Wrap(executor)
+		defer func() {
+			status := breaker.Status()
+			summary.Circuit = &status
+		}()
+	}
+
+	if !paper {
+		m.loadPairMetadata(ctx, provider, cmp.Or(m.Config.Pair, KrakenDefaultPair))
+	}
+
+	params := BuyParams{Executor: executor, Logger: m.Logger, config: m.Config, Guards: BuyGuards{
+		SlippageAlertPercent: m.Config.SlippageAlertPercent,
+		Custom:               m.Guards,
+		History:              store,
+		FailurePolicy:        m.Config.GuardFailurePolicy,
+	}}
+	order := m.Config.OrderRequest()
+	params.order = &order
+	if len(m.Config.PriceLadder) > 0 || len(m.Guards) > 0 {
+		// the amount the guards settle on only applies to this attempt
+		defer func(amount int) { m.Config.OrderAmountInCents = amount }(m.Config.OrderAmountInCents)
+		params.Guards.Price = priced.FetchPrice
+	}
+	if len(m.Config.PriceLadder) > 0 {
+		params.Guards.PriceLadder = m.Config.PriceLadder
+		// a budget's paced amount caps the tier's amount
+		if summary.Budget != nil && !summary.Budget.Fallback {
+			params.Guards.MaxAmountInCents = m.Config.OrderAmountInCents
+		}
+	}
+
+	// the steps of the run between the guards and the order, ordered is set once nothing is left but to order
+	var ordered bool
+	params.beforeOrder = func(ctx context.Context, order ExecuteOrderRequest) error {
+		// the config's order is what the steps confirm and fund
+		m.Config.OrderAmountInCents = order.AmountInCents
+
+		// Paper orders spend nothing so they're never confirmed.
+		if !paper {
+			if err := m.confirmOrder(ctx, provider, order); err != nil {
+				return err
+			}
+		}
+
+		// an interrupted run doesn't start ordering, e.g. after waiting at the confirmation prompt
+		if err := interrupted(ctx); err != nil {
+			return err
+		}
+
+		// the key is reserved before anything is sold or bought so a duplicate run places no order at all
+		if idempotency != nil && idempotencyKey == "" {
+			m.Logger.InfoContext(ctx, "skipping the idempotency check of a run without a correlation ID or schedule")
+		} else if idempotency != nil {
+			if err := m.reserveIdempotencyKey(ctx, idempotency, idempotencyKey, provider, store, reconciled, summary); err != nil {
+				return err
+			}
+		}
 
-	order := ExecuteOrderRequest{AmountInCents: m.Config.OrderAmountInCents}
-	if res, err := provider.ExecuteOrder(ctx, order); err != nil {
+		// Paper orders spend nothing so there's nothing to fund.
+		if m.Config.ConvertFunding != nil && paper {
+			m.Logger.InfoContext(ctx, "skipping the funding conversion of a paper order")
+		} else if m.Config.ConvertFunding != nil {
+			if err := m.convertFunding(ctx, provider, executor, summary); err != nil {
+				return err
+			}
+			if err := interrupted(ctx); err != nil {
+				return err
+			}
+		}
+		ordered = true
+		return nil
+	}
+
+	res, err := buy(ctx, params, summary)
+	// the order was sized with the last ticker fetched, the steps after the order may fetch it again
+	if sample, ok := priced.LastPrice(); ok && ordered && m.Config.PriceLog != nil {
+		defer m.logRunPrice(ctx, sample, summary)
+	}
+	if err != nil {
+		// running out of funds is when a reminder is most useful
+		if errors.Is(err, ErrInsufficientFunds) && ordered && !paper {
+			m.checkFunding(ctx, provider, summary)
+		}
+		// the minimum may have changed since the metadata was fetched
+		if errors.Is(err, ErrOrderToSmall) && ordered && !paper {
+			m.invalidatePairMetadata(ctx, cmp.Or(m.Config.Pair, KrakenDefaultPair))
+		}
 		return err
-	} else {
-		m.Logger.Info("order successfully executed", "result", res)
+	}
+
+	// committed before the order is recorded, an uncommitted key is resolved by adopting the unrecorded order
+	if idempotency != nil && idempotencyKey != "" {
+		m.commitIdempotencyKey(ctx, idempotency, idempotencyKey, res, summary)
+	}
+
+	filledAt := time.Now()
+	if m.Config.CompareVWAP {
+		m.compareVWAP(ctx, provider, res, filledAt, summary)
+	}
+
+	if store != nil {
+		// the order was placed, so a store that panics is only logged
+		rec := OrderRecord{Time: filledAt, RunID: summary.RunID, CorrelationID: summary.CorrelationID, Profile: summary.Profile, Order: res}.In(m.Config.Location())
+		if err = m.recoverPanic(ctx, "OrderStore.Put", func() error { return store.Put(ctx, rec) }); err != nil {
+			m.Logger.ErrorContext(ctx, "failed to record order", "error", err, "result", res)
+		}
+
+		var records []OrderRecord
+		if err := m.recoverPanic(ctx, "OrderStore.List", func() (err error) { records, err = store.List(ctx); return err }); err != nil {
+			m.Logger.WarnContext(ctx, "failed to list orders for slippage stats", "error", err)
+		} else {
+			summary.Slippage = NewSlippageStats(FilterOrderRecords(records, m.Config.Label), SlippageAverageWindow)
+			if m.Config.ReportUnrealizedPnL {
+				m.reportUnrealizedPnL(ctx, provider, res.Pair, FilterOrderRecords(records, m.Config.Label), summary)
+			}
+		}
+	}
+
+	if !paper {
+		m.checkFunding(ctx, provider, summary)
+	}
+
+	// the order is recorded, later steps aren't started once the run is interrupted
+	if err := interrupted(ctx); err != nil {
+		m.Logger.WarnContext(ctx, "skipping the steps after the order of an interrupted run", "error", err)
+		return nil
+	}
+
+	if m.Config.EarnAllocate && paper {
+		m.Logger.InfoContext(ctx, "skipping earn allocation of a paper order")
+	} else if m.Config.EarnAllocate && res.Status == OrderStatusOpen {
+		m.Logger.InfoContext(ctx, "skipping earn allocation until the order fills", "transactionId", res.TransactionID)
+	} else if m.Config.EarnAllocate {
+		m.allocateEarn(ctx, provider, res, summary)
+	}
+
+	if m.Config.DustSweep != nil && paper {
+		m.Logger.InfoContext(ctx, "skipping the dust sweep of a paper order")
+	} else if m.Config.DustSweep != nil {
+		m.sweepDust(ctx, summary)
+	}
+
+	if m.Config.Retention != nil && store != nil {
+		m.pruneAfterRun(ctx, store, summary)
 	}
 
 	return nil
 }
 
-// ParseFlagsAndLoadConfig parses the application config file from the --config flag and loads it.
+// allocateEarn allocates the purchased volume to the configured earn strategy. The purchase already happened so
+// failures are only recorded as warnings.
+func (m *App) allocateEarn(ctx context.Context, provider *KrakenProvider, res ExecuteOrderResponse, summary *RunSummary) {
+	alloc, err := provider.AllocateEarn(ctx, m.Config.EarnStrategyID, res.VolumePurchased)
+	if errors.Is(err, ErrEarnBelowMinimum) {
+		m.Logger.WarnContext(ctx, "skipping earn allocation", "error", err)
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("earn allocation skipped: %v", err))
+		return
+	} else if err != nil {
+		m.Logger.WarnContext(ctx, "failed to allocate to earn strategy", "error", err)
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("earn allocation failed: %v", err))
+		return
+	}
+
+	m.Logger.InfoContext(ctx, "allocated to earn strategy", "allocation", alloc)
+	summary.Earn = &alloc
+}
+
+// lastPurchasePrice returns the average price of the most recent filled purchase of pair, zero when there is none.
+func lastPurchasePrice(records []OrderRecord, pair string) (price float64) {
+	var last time.Time
+	for _, rec := range records {
+		o := rec.Order
+		if o.Pair != pair || o.Side == SideSell || o.VolumePurchased <= 0 || o.Price <= 0 || rec.Time.Before(last) {
+			continue
+		}
+		last, price = rec.Time, o.Price
+	}
+	return price
+}
+
+// reconcile adopts orders placed since the last recorded order which were never recorded, e.g. because a previous
+// run crashed after placing its order.
+func (m *App) reconcile(ctx context.Context, provider *KrakenProvider, store OrderStore) (adopted []ExecuteOrderResponse, err error) {
+	defer WrapErr(&err, "App.reconcile")
+
+	records, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	since := time.Now().Add(-defaultReconcileWindow)
+	recorded := make(map[string]bool, len(records))
+	for _, rec := range records {
+		recorded[rec.Order.TransactionID] = true
+		if rec.Time.After(since) {
+			since = rec.Time
+		}
+	}
+
+	orders, err := provider.FindOrders(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rec := range orders {
+		if recorded[rec.Order.TransactionID] {
+			continue
+		}
+
+		m.Logger.WarnContext(ctx, "adopting unrecorded order", "transactionId", rec.Order.TransactionID, "time", rec.Time, "order", rec.Order)
+
+		rec.Adopted = true
+		if err = store.Put(ctx, rec.In(m.Config.Location())); err != nil {
+			return adopted, err
+		}
+		adopted = append(adopted, rec.Order)
+	}
+
+	return adopted, nil
+}
+
+// circuitBreaker returns the circuit breaker of the named provider, nil is returned when circuit breakers aren't
+// enabled. Breakers are kept for the lifetime of the app so their state carries over between runs.
+func (m *App) circuitBreaker(name string) *CircuitBreaker {
+	if m.Config.CircuitBreaker == nil || !m.Config.CircuitBreaker.Enabled {
+		return nil
+	}
+
+	m.breakersMu.Lock()
+	defer m.breakersMu.Unlock()
+
+	if m.breakers == nil {
+		m.breakers = map[string]*CircuitBreaker{}
+	}
+	if _, ok := m.breakers[name]; !ok {
+		m.breakers[name] = NewCircuitBreaker(name, *m.Config.CircuitBreaker, m.Logger)
+	}
+	return m.breakers[name]
+}
+
+// notifiers returns the notifiers set on the app followed by the notifiers configured in the config.
+func (m *App) notifiers(ctx context.Context) []Notifier {
+	notifiers := append([]Notifier(nil), m.Notifiers...)
+
+	// The template is checked by LoadConfig so this only fails if the file changed since.
+	receipts, err := NewReceiptRenderer(m.Config.ReceiptTemplate)
+	if err != nil {
+		m.Logger.WarnContext(ctx, "failed to load receipt template, using the default templates", "error", err)
+		// the embedded templates always parse, see defaultReceiptRenderer
+		receipts, _ = NewReceiptRenderer("")
+	}
+	receipts.Money = m.Config.MoneyFormat()
+
+	if m.Config.MQTT != nil {
+		cfg := *m.Config.MQTT
+		cfg.Pair = m.Config.OrderRequest().Pair
+		if cfg.Pair == "" {
+			cfg.Pair = KrakenDefaultPair
+		}
+		n := NewMQTTNotifier(cfg)
+		n.Receipts = receipts
+		notifiers = append(notifiers, n)
+	}
+	if m.Config.Discord != nil {
+		cfg := *m.Config.Discord
+		cfg.HTTPClient = m.httpClient()
+		n := NewDiscordNotifier(cfg)
+		n.Receipts, n.Money = receipts, m.Config.MoneyFormat()
+		notifiers = append(notifiers, n)
+	}
+	if m.Config.Pushgateway != nil {
+		cfg := *m.Config.Pushgateway
+		cfg.HTTPClient = m.httpClient()
+		notifiers = append(notifiers, NewPushgatewayNotifier(cfg))
+	}
+	return notifiers
+}
+
+// notify sends the summary to every notifier, failures are logged but otherwise ignored.
+func (m *App) notify(ctx context.Context, summary RunSummary) {
+	for _, n := range m.notifiers(ctx) {
+		if err := m.recoverPanic(ctx, "Notifier.Notify", func() error { return n.Notify(ctx, summary) }); err != nil {
+			m.Logger.WarnContext(ctx, "failed to send notification", "error", err)
+		}
+	}
+}
+
+// recoverPanic calls f and returns a *PanicError when it panics. The panic is logged with its stack at Error, in
+// names the call that panicked.
+func (m *App) recoverPanic(ctx context.Context, in string, f func() error) error {
+	return recoverPanic(ctx, m.Logger, in, f)
+}
+
+// recoverPanic calls f and returns a *PanicError when it panics, logging it to logger as App.recoverPanic does.
+func recoverPanic(ctx context.Context, logger *slog.Logger, in string, f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			pe := NewPanicError(r)
+			logger.ErrorContext(ctx, "recovered from a panic", "in", in, "error", pe, "stack", pe.Stack)
+			err = pe
+		}
+	}()
+	return f()
+}
+
+// ParseFlagsAndLoadConfig parses the application config files from the --config flag and loads them. The flag may be
+// repeated, when it isn't given CONFIG_FILE is used as a comma separated list.
 func (m *App) ParseFlagsAndLoadConfig(ctx context.Context, args []string) error {
-	var configFile string
+	var (
+		configFiles ConfigFiles
+		amount      int
+		level       slog.Level
+	)
 
 	fs := flag.NewFlagSet("dca", flag.ContinueOnError)
-	fs.StringVar(&configFile, "config", os.Getenv("CONFIG_FILE"), "path to the config file")
+	fs.Var(&configFiles, "config", "path to a config file, repeat to merge several in order")
+	fs.IntVar(&amount, "amount", 0, "the amount to buy in cents, overrides orderAmountInCents")
+	fs.BoolVar(&m.ConfirmOrders, "confirm", false, "ask for confirmation on the terminal before placing the order")
+	fs.StringVar(&m.Profile, "profile", "", "the config profile to apply, overrides the profile set by the config")
+	fs.Var((*Tags)(&m.Tags), "tag", "a key=value tag of the run, repeat for several, overrides the same tag of the config")
+	fs.BoolVar(&m.PrintConfig, "print-config", false, "print the effective config with secrets masked and the source of every value, then exit")
+	fs.BoolVar(&m.Explain, "explain", false, "print the decision of every guard and rule of the run")
+	fs.TextVar(&level, "log-level", slog.LevelInfo, "the minimum level of the logs: debug, info, warn or error")
 
 	if err := fs.Parse(args); err != nil {
 		return err
-	} else if err = m.LoadConfig(ctx, configFile); err != nil {
+	}
+	if len(configFiles) == 0 {
+		configFiles = SplitConfigFiles(os.Getenv("CONFIG_FILE"))
+	}
+	m.SetLogLevel(level)
+
+	// Only an interactive terminal is prompted, elsewhere orders above confirmAboveCents fail.
+	m.Prompt = NewTerminalPrompt()
+	if m.ConfirmOrders && m.Prompt == nil {
+		return errors.New("--confirm requires stdin to be a terminal")
+	}
+
+	if err := m.LoadConfig(ctx, configFiles...); err != nil {
+		return err
+	}
+	if m.Profile != "" {
+		m.configSources[configKeyProfile] = ConfigSource{Kind: ConfigSourceFlag, Name: "--profile"}
+	}
+	for key := range m.Tags {
+		m.configSources[configKeyTags+"."+key] = ConfigSource{Kind: ConfigSourceFlag, Name: "--tag"}
+	}
+	if amount < 0 {
+		return errors.New("--amount must be positive")
+	} else if amount > 0 {
+		m.Config.OrderAmountInCents = amount
+		m.configSources["orderAmountInCents"] = ConfigSource{Kind: ConfigSourceFlag, Name: "--amount"}
+	}
+	return nil
+}
+
+// LoadConfig loads the config from the specified filenames. If a filename has an AWS param store prefix the
+// config is loaded from AWS. Several configs are deep merged in order with later ones overriding earlier ones, only
+// the merged config is validated. The selected profile is applied after merging so its values override every file's
+// base values.
+func (m *App) LoadConfig(ctx context.Context, filenames ...string) error {
+	config, sources, issues, err := m.readConfig(ctx, filenames...)
+	if err != nil {
+		return err
+	} else if err = issueErrors(issues); err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		m.Logger.WarnContext(ctx, "config issue", "field", issue.Field, "code", issue.Code, "message", issue.Message)
+	}
+
+	fields := config.secretFields()
+	for _, field := range fields {
+		if HasAWSParamStorePrefix(*field.Value) {
+			sources[field.Name] = ConfigSource{Kind: ConfigSourceSSM, Name: *field.Value}
+		}
+	}
+	if err = resolveSecrets(ctx, m.secretResolver(), fields); err != nil {
 		return err
 	}
 
+	// The default value for the private key is to be base64 encoded but it shouldn't be considered an error if the
+	// value is not encoded.
+	if data, err := base64.StdEncoding.DecodeString(config.KrakenPrivateKey); err == nil {
+		config.KrakenPrivateKey = string(data)
+	}
+
+	if config.LogFile != nil {
+		if err = m.useLogFile(*config.LogFile); err != nil {
+			return err
+		}
+	}
+	if config.AuditLog != "" {
+		if err = m.useAuditLog(config.AuditLog, config.ExtraHeaders); err != nil {
+			return err
+		}
+	}
+
+	m.Config = config
+	m.configSources = sources
 	return nil
 }
 
-// LoadConfig loads a config file from the specified filename. If the filename has an AWS param store prefix
-// then the value is loaded from AWS Systems Manager.
-func (m *App) LoadConfig(ctx context.Context, filename string) error {
-	if filename == "" {
-		return errors.New("must specify a config file path using either CONFIG_FILE environment variable or the --config flag")
+// readConfig reads, merges and decodes config files, the issues of the config are returned with it.
+func (m *App) readConfig(ctx context.Context, filenames ...string) (config AppConfig, sources ConfigSources, issues []ValidationIssue, err error) {
+	if len(filenames) == 0 {
+		return config, nil, nil, errors.New("must specify a config file path using either CONFIG_FILE environment variable or the --config flag")
 	}
 
-	var b []byte
-	var err error
+	docs := make([][]byte, len(filenames))
+	for i, filename := range filenames {
+		if docs[i], err = m.readConfigFile(ctx, filename); err != nil {
+			return config, nil, nil, err
+		}
+	}
+
+	sources = ConfigSources{}
+	b := docs[0]
+	if len(docs) > 1 {
+		if b, err = mergeConfigs(filenames, docs, sources); err != nil {
+			return config, nil, nil, fmt.Errorf("failed to merge configs: %w", err)
+		}
+	} else {
+		sources.setDocument(b, configFileSource(filenames[0]))
+	}
+
+	// Only the applied profile is kept, the others may hold values for other runs, including secrets.
+	if config, issues, err = checkConfig(b, m.Profile, sources); err != nil {
+		return config, nil, nil, fmt.Errorf("failed to apply profile: %w", err)
+	}
+	if m.Profile != "" {
+		sources[configKeyProfile] = ConfigSource{Kind: ConfigSourceEvent}
+	}
+	sources.remove("profiles")
+	if len(m.Tags) > 0 {
+		config.Tags = MergeTags(config.Tags, m.Tags)
+		if err = ValidateTags(config.Tags); err != nil {
+			return config, nil, nil, fmt.Errorf("invalid tags: %w", err)
+		}
+		for key := range m.Tags {
+			sources[configKeyTags+"."+key] = ConfigSource{Kind: ConfigSourceEvent}
+		}
+	}
+	return config, sources, issues, nil
+}
+
+// readConfigFile reads a single config source.
+func (m *App) readConfigFile(ctx context.Context, filename string) (b []byte, err error) {
+	if filename == "" {
+		return nil, errors.New("must specify a config file path using either CONFIG_FILE environment variable or the --config flag")
+	}
 
 	// If we're loading the config file from AWS we rely on AWS credential loading
 	if HasAWSParamStorePrefix(filename) {
-		if b, err = GetAWSParamStoreValue(ctx, filename); err != nil {
-			return fmt.Errorf("failed to get AWS param store value for kraken api key: %v", err)
+		if b, err = m.secretResolver()(ctx, filename); err != nil {
+			return nil, fmt.Errorf("failed to get AWS param store value for config %s: %v", filename, err)
 		}
-	} else if b, err = os.ReadFile(filename); err != nil {
-		return err
+		return b, nil
 	}
 
-	var config AppConfig
-	if err = json.Unmarshal(b, &config); err != nil {
-		return err
+	return os.ReadFile(filename)
+}
+
+// secretResolver returns the resolver used for secret references in the config.
+func (m *App) secretResolver() SecretResolver {
+	if m.SecretResolver != nil {
+		return m.SecretResolver
 	}
+	return GetAWSParamStoreValue
+}
+
+// Validate checks the config for problems that don't require any network calls, every problem found is returned.
+// Each problem carries the path of the setting it's about, which ValidateConfigBytes reports as the issue's Field.
+func (c AppConfig) Validate() error {
+	var errs []error
 
-	if config.OrderAmountInCents <= 0 {
-		return errors.New("orderAmountInCents cannot be less than or equal to zero")
+	if c.OrderAmountInCents <= 0 {
+		errs = append(errs, fieldErr("orderAmountInCents", errors.New("orderAmountInCents cannot be less than or equal to zero")))
 	}
 
-	if config.KrakenAPIKey == "" {
-		return errors.New("krakenApiKey is required")
+	if err := validateOrderParams(c.OrderRequest()); err != nil {
+		errs = append(errs, fieldErr("orderType", err))
 	}
 
-	if HasAWSParamStorePrefix(config.KrakenAPIKey) {
-		if data, err := GetAWSParamStoreValue(ctx, config.KrakenAPIKey); err != nil {
-			return fmt.Errorf("failed to get AWS param store value for kraken api key: %v", err)
-		} else {
-			config.KrakenAPIKey = string(data)
+	if c.VolumeRounding != "" {
+		if err := validateVolumeRounding(c.VolumeRounding); err != nil {
+			errs = append(errs, fieldErr("volumeRounding", err))
 		}
 	}
 
-	if config.KrakenPrivateKey == "" {
-		return errors.New("krakenPrivateKey is required")
+	if c.MaxPriceDeviationPercent < 0 {
+		errs = append(errs, fieldErr("maxPriceDeviationPercent", errors.New("maxPriceDeviationPercent cannot be negative")))
 	}
 
-	if HasAWSParamStorePrefix(config.KrakenPrivateKey) {
-		if data, err := GetAWSParamStoreValue(ctx, config.KrakenPrivateKey); err != nil {
-			return fmt.Errorf("failed to get AWS param store value: %v", err)
-		} else {
-			config.KrakenPrivateKey = string(data)
+	if c.FailureArchive != "" {
+		if _, err := NewFailureArchive(c.FailureArchive); err != nil {
+			errs = append(errs, fieldErr("failureArchive", err))
 		}
 	}
 
-	// The default value for the private key is to be base64 encoded but it shouldn't be considered an error if the
-	// value is not encoded.
-	if data, err := base64.StdEncoding.DecodeString(config.KrakenPrivateKey); err == nil {
-		config.KrakenPrivateKey = string(data)
+	if c.ConfirmAboveCents < 0 {
+		errs = append(errs, fieldErr("confirmAboveCents", errors.New("confirmAboveCents cannot be negative")))
 	}
 
-	m.Config = config
-	return nil
+	if c.SlippageAlertPercent < 0 {
+		errs = append(errs, fieldErr("slippageAlertPercent", errors.New("slippageAlertPercent cannot be negative")))
+	}
+
+	if c.SweepThresholdPercent < 0 || c.SweepThresholdPercent >= 100 {
+		errs = append(errs, fieldErr("sweepThresholdPercent", errors.New("sweepThresholdPercent must be at least 0 and less than 100")))
+	}
+
+	if err := c.validatePause(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.validateOrderAmountParameter(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := validateExtraHeaders(c.ExtraHeaders); err != nil {
+		errs = append(errs, fieldErr("extraHeaders", err))
+	}
+
+	if err := c.validateFunding(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.ReconcileOrders && c.OrderStorePath == "" {
+		errs = append(errs, fieldErr("orderStorePath", errors.New("orderStorePath is required when reconcileOrders is enabled")))
+	}
+
+	if c.IdempotencyStorePath != "" && c.OrderStorePath == "" && c.Provider != ProviderPaper && c.Provider != ProviderPaperRealistic {
+		errs = append(errs, fieldErr("orderStorePath", errors.New("orderStorePath is required when idempotencyStorePath is set to reconcile runs that stopped before committing their key")))
+	}
+
+	if c.ReportUnrealizedPnL && c.OrderStorePath == "" {
+		errs = append(errs, fieldErr("orderStorePath", errors.New("orderStorePath is required when reportUnrealizedPnL is enabled")))
+	}
+
+	if c.EarnAllocate && c.EarnStrategyID == "" {
+		errs = append(errs, fieldErr("earnStrategyId", errors.New("earnStrategyId is required when earnAllocate is enabled")))
+	}
+
+	if _, ok := krakenTierLimits[c.KrakenTier]; c.KrakenTier != "" && !ok {
+		errs = append(errs, fieldErr("krakenTier", fmt.Errorf("krakenTier must be one of %q, %q or %q", KrakenTierStarter, KrakenTierIntermediate, KrakenTierPro)))
+	}
+
+	switch c.DedupePolicy {
+	case "", DedupePolicyProceed, DedupePolicySkip:
+	default:
+		errs = append(errs, fieldErr("dedupePolicy", fmt.Errorf("dedupePolicy must be one of %q or %q", DedupePolicyProceed, DedupePolicySkip)))
+	}
+
+	if c.ReportingTimeZone != "" {
+		if _, err := time.LoadLocation(c.ReportingTimeZone); err != nil {
+			errs = append(errs, fieldErr("reportingTimeZone", fmt.Errorf("reportingTimeZone: %w", err)))
+		}
+	}
+
+	if c.KrakenFillTimeout != "" {
+		if d, err := time.ParseDuration(c.KrakenFillTimeout); err != nil {
+			errs = append(errs, fieldErr("krakenFillTimeout", fmt.Errorf("invalid krakenFillTimeout: %w", err)))
+		} else if d <= 0 {
+			errs = append(errs, fieldErr("krakenFillTimeout", errors.New("krakenFillTimeout must be positive")))
+		}
+	}
+
+	if err := ValidateTags(c.Tags); err != nil {
+		errs = append(errs, fieldErr("tags", fmt.Errorf("invalid tags: %w", err)))
+	}
+
+	if c.RunTimeout != "" {
+		if d, err := time.ParseDuration(c.RunTimeout); err != nil {
+			errs = append(errs, fieldErr("runTimeout", fmt.Errorf("invalid runTimeout: %w", err)))
+		} else if d <= 0 {
+			errs = append(errs, fieldErr("runTimeout", errors.New("runTimeout must be positive")))
+		}
+	}
+
+	if c.FillTolerance != "" {
+		if _, err := ParseFillTolerance(c.FillTolerance); err != nil {
+			errs = append(errs, fieldErr("fillTolerance", fmt.Errorf("fillTolerance: %w", err)))
+		}
+	}
+
+	if c.ScheduleDriftWarning != "" {
+		if d, err := time.ParseDuration(c.ScheduleDriftWarning); err != nil {
+			errs = append(errs, fieldErr("scheduleDriftWarning", fmt.Errorf("invalid scheduleDriftWarning: %w", err)))
+		} else if d <= 0 {
+			errs = append(errs, fieldErr("scheduleDriftWarning", errors.New("scheduleDriftWarning must be positive")))
+		}
+	}
+
+	if c.MaxClockSkew != "" {
+		if d, err := time.ParseDuration(c.MaxClockSkew); err != nil {
+			errs = append(errs, fieldErr("maxClockSkew", fmt.Errorf("invalid maxClockSkew: %w", err)))
+		} else if d <= 0 {
+			errs = append(errs, fieldErr("maxClockSkew", errors.New("maxClockSkew must be positive")))
+		}
+	}
+
+	if c.ReceiptTemplate != "" {
+		if _, err := NewReceiptRenderer(c.ReceiptTemplate); err != nil {
+			errs = append(errs, fieldErr("receiptTemplate", fmt.Errorf("receiptTemplate: %w", err)))
+		}
+	}
+
+	if c.MQTT != nil {
+		if err := c.MQTT.Validate(); err != nil {
+			errs = append(errs, fieldErr("mqtt", err))
+		}
+	}
+
+	if c.Discord != nil {
+		if err := c.Discord.Validate(); err != nil {
+			errs = append(errs, fieldErr("discord", err))
+		}
+	}
+
+	if c.Pushgateway != nil {
+		if err := c.Pushgateway.Validate(); err != nil {
+			errs = append(errs, fieldErr("pushgateway", err))
+		}
+	}
+
+	if err := c.validateAuditLog(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.PairMetadata != nil {
+		if err := c.PairMetadata.Validate(); err != nil {
+			errs = append(errs, fieldErr("pairMetadata", err))
+		}
+	}
+
+	if c.LogFile != nil {
+		if err := c.LogFile.Validate(); err != nil {
+			errs = append(errs, fieldErr("logFile", err))
+		}
+	}
+
+	if c.CircuitBreaker != nil {
+		if err := c.CircuitBreaker.Validate(); err != nil {
+			errs = append(errs, fieldErr("circuitBreaker", err))
+		}
+	}
+
+	if c.SignedReceipts != nil {
+		if err := c.SignedReceipts.Validate(); err != nil {
+			errs = append(errs, fieldErr("signedReceipts", err))
+		}
+	}
+
+	if err := c.PriceLadder.Validate(); err != nil {
+		errs = append(errs, fieldErr("priceLadder", err))
+	}
+	if err := c.GuardFailurePolicy.Validate(); err != nil {
+		errs = append(errs, fieldErr("guardFailurePolicy", err))
+	}
+
+	if c.Budget != nil {
+		if err := c.Budget.Validate(); err != nil {
+			errs = append(errs, fieldErr("budget", err))
+		}
+		if c.OrderStorePath == "" {
+			errs = append(errs, fieldErr("orderStorePath", errors.New("orderStorePath is required when a budget is configured")))
+		}
+	}
+
+	if c.DustSweep != nil {
+		if err := c.DustSweep.Validate(); err != nil {
+			errs = append(errs, fieldErr("dustSweep", err))
+		}
+	}
+
+	if c.PriceLog != nil {
+		if err := c.PriceLog.Validate(); err != nil {
+			errs = append(errs, fieldErr("priceLog", err))
+		}
+	}
+
+	if c.Retention != nil {
+		if err := c.Retention.Validate(); err != nil {
+			errs = append(errs, fieldErr("retention", err))
+		}
+		if c.OrderStorePath == "" {
+			errs = append(errs, fieldErr("orderStorePath", errors.New("orderStorePath is required when retention is configured")))
+		}
+	}
+
+	if c.ConvertFunding != nil {
+		if err := c.ConvertFunding.Validate(); err != nil {
+			errs = append(errs, fieldErr("convertFunding", err))
+		} else if pair := krakenPairs[cmp.Or(c.Pair, KrakenDefaultPair)]; pair.QuoteAsset != krakenPairs[c.ConvertFunding.Pair].QuoteAsset {
+			errs = append(errs, fieldErr("convertFunding.pair", fmt.Errorf("convertFunding pair %s doesn't sell for the quote currency of %s", c.ConvertFunding.Pair, cmp.Or(c.Pair, KrakenDefaultPair))))
+		}
+	}
+
+	paper := false
+	switch c.Provider {
+	case "", ProviderKraken:
+	case ProviderPaper, ProviderPaperRealistic:
+		paper = true
+	default:
+		errs = append(errs, fieldErr("provider", fmt.Errorf("provider must be one of %q, %q or %q", ProviderKraken, ProviderPaper, ProviderPaperRealistic)))
+	}
+
+	// Paper orders aren't recorded so there's nothing to adopt when they're retried.
+	if c.RetryMaxAttempts < 0 {
+		errs = append(errs, fieldErr("retryMaxAttempts", errors.New("retryMaxAttempts cannot be negative")))
+	} else if c.RetryMaxAttempts > 1 && c.OrderStorePath == "" && !paper {
+		errs = append(errs, fieldErr("retryMaxAttempts", errors.New("retryMaxAttempts requires orderStorePath to adopt orders placed by failed attempts")))
+	}
+	if c.RetryBackoff != "" {
+		if d, err := time.ParseDuration(c.RetryBackoff); err != nil {
+			errs = append(errs, fieldErr("retryBackoff", fmt.Errorf("invalid retryBackoff: %w", err)))
+		} else if d < 0 {
+			errs = append(errs, fieldErr("retryBackoff", errors.New("retryBackoff cannot be negative")))
+		}
+	}
+
+	if c.PaperFeeRate < 0 || c.PaperFeeRate >= 1 {
+		errs = append(errs, fieldErr("paperFeeRate", errors.New("paperFeeRate must be between 0 and 1")))
+	}
+
+	if c.PaperDepthLevels < 0 || c.PaperDepthLevels > MaxPaperDepthLevels {
+		errs = append(errs, fieldErr("paperDepthLevels", fmt.Errorf("paperDepthLevels must be between 0 (default) and %d", MaxPaperDepthLevels)))
+	}
+
+	// Paper providers only use public endpoints.
+	if c.KrakenAPIKey == "" && !paper {
+		errs = append(errs, fieldErr("krakenApiKey", errors.New("krakenApiKey is required")))
+	}
+
+	if c.KrakenPrivateKey == "" && !paper {
+		errs = append(errs, fieldErr("krakenPrivateKey", errors.New("krakenPrivateKey is required")))
+	}
+
+	return errors.Join(errs...)
+}
+
+// MoneyFormat returns the format of the amounts in receipts, notifications, logs and CLI output.
+func (c AppConfig) MoneyFormat() MoneyFormat {
+	return MoneyFormat{TrimTrailingZeros: c.TrimTrailingZeros}
+}
+
+// Location returns the reporting time zone, UTC is returned when the zone isn't set or can't be loaded.
+func (c AppConfig) Location() *time.Location {
+	if c.ReportingTimeZone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(c.ReportingTimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// secretFields returns the config values that may hold secret references.
+func (c *AppConfig) secretFields() []secretField {
+	fields := []secretField{
+		{Name: "krakenApiKey", Value: &c.KrakenAPIKey},
+		{Name: "krakenPrivateKey", Value: &c.KrakenPrivateKey},
+	}
+	if c.MQTT != nil {
+		fields = append(fields, secretField{Name: "mqtt.password", Value: &c.MQTT.Password})
+	}
+	if c.Discord != nil {
+		fields = append(fields, secretField{Name: "discord.webhookUrl", Value: &c.Discord.WebhookURL})
+	}
+	if c.SignedReceipts != nil {
+		fields = append(fields, secretField{Name: "signedReceipts.privateKey", Value: &c.SignedReceipts.PrivateKey})
+	}
+	// map values aren't addressable so the fields write them back with Set
+	for _, name := range slices.Sorted(maps.Keys(c.ExtraHeaders)) {
+		value := c.ExtraHeaders[name]
+		fields = append(fields, secretField{Name: "extraHeaders." + name, Value: &value, Set: func(v string) { c.ExtraHeaders[name] = v }})
+	}
+	return fields
 }
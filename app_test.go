@@ -0,0 +1,912 @@
+package dca_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+// recordingNotifier records every summary it's sent.
+type recordingNotifier struct {
+	summaries []dca.RunSummary
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, summary dca.RunSummary) error {
+	n.summaries = append(n.summaries, summary)
+	return nil
+}
+
+func newTestApp(s *krakenTestServer, cfg dca.AppConfig) (*dca.App, *recordingNotifier) {
+	cfg.KrakenAPIKey = "key"
+	cfg.KrakenPrivateKey = "secret"
+	cfg.KrakenBaseURL = s.URL
+	if cfg.OrderAmountInCents == 0 {
+		cfg.OrderAmountInCents = 500
+	}
+
+	n := &recordingNotifier{}
+	app := dca.NewApp()
+	app.Config = cfg
+	app.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	app.Notifiers = []dca.Notifier{n}
+	return app, n
+}
+
+func TestApp_Run_ReconcileOrders(t *testing.T) {
+	opened := float64(time.Now().Add(-time.Hour).Unix())
+	orphan := `{"error":[],"result":{"closed":{"ORPHAN-1":{"userref":3530,"status":"closed","opentm":` +
+		formatFloat(opened) + `,"descr":{"ordertype":"market","order":"buy 0.0001 XBTUSD @ market"},"vol":"0.0001","vol_exec":"0.0001","cost":"5.00","fee":"0.02","price":"50000.0"}},"count":1}}`
+
+	tt := []struct {
+		policy         string
+		expectedStatus dca.RunStatus
+		expectedOrders int
+	}{
+		{dca.DedupePolicyProceed, dca.RunStatusSuccess, 2},
+		{dca.DedupePolicySkip, dca.RunStatusSkipped, 1},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus":  {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":        {tickerResponse},
+			"/0/private/OpenOrders":   {`{"error":[],"result":{"open":{}}}`},
+			"/0/private/ClosedOrders": {orphan},
+			"/0/private/AddOrder":     {addOrderResponse},
+			"/0/private/QueryOrders":  {queryOrdersResponse},
+		})
+		storePath := filepath.Join(t.TempDir(), "orders.jsonl")
+		app, n := newTestApp(s, dca.AppConfig{OrderStorePath: storePath, ReconcileOrders: true, DedupePolicy: tc.policy})
+
+		if err := app.Run(context.Background()); err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+
+		records, err := dca.NewFileOrderStore(storePath).List(context.Background())
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		if want, got := tc.expectedOrders, len(records); got != want {
+			t.Fatalf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := "ORPHAN-1", records[0].Order.TransactionID; got != want || !records[0].Adopted {
+			t.Errorf("%d: want adopted %v got %v (adopted %v)", i, want, got, records[0].Adopted)
+		}
+
+		if want, got := 1, len(n.summaries); got != want {
+			t.Fatalf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.expectedStatus, n.summaries[0].Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := 1, len(n.summaries[0].Adopted); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+
+		if want, got := "3530", s.Requests("/0/private/ClosedOrders")[0].Get("userref"); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestApp_Run_ReconcileOrders_AlreadyRecorded(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus":  {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":        {tickerResponse},
+		"/0/private/OpenOrders":   {`{"error":[],"result":{"open":{}}}`},
+		"/0/private/ClosedOrders": {`{"error":[],"result":{"closed":{"TXID-0":{"userref":3530,"status":"closed","opentm":` + formatFloat(float64(time.Now().Unix())) + `,"vol":"0.0001","cost":"5.00","fee":"0.02","price":"50000.0"}},"count":1}}`},
+		"/0/private/AddOrder":     {addOrderResponse},
+		"/0/private/QueryOrders":  {queryOrdersResponse},
+	})
+	storePath := filepath.Join(t.TempDir(), "orders.jsonl")
+	store := dca.NewFileOrderStore(storePath)
+	if err := store.Put(context.Background(), dca.OrderRecord{Time: time.Now().Add(-time.Minute), Order: dca.ExecuteOrderResponse{TransactionID: "TXID-0"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	app, n := newTestApp(s, dca.AppConfig{OrderStorePath: storePath, ReconcileOrders: true})
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want, got := dca.SchemaVersion, n.summaries[0].SchemaVersion; got != want {
+		t.Errorf("want schema version %v got %v", want, got)
+	}
+	if want, got := 0, len(n.summaries[0].Adopted); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestApp_Run_EarnAllocate(t *testing.T) {
+	strategies := `{"error":[],"result":{"items":[{"id":"ESRFUO3-Q62XD-WIOIL7","asset":"XBT","can_allocate":true,"user_min_allocation":"0.00005"}]}}`
+
+	tt := []struct {
+		strategies string
+		allocate   string
+		allocated  bool
+		warnings   int
+	}{
+		{strategies, `{"error":[],"result":true}`, true, 0},
+		// below the minimum allocation
+		{`{"error":[],"result":{"items":[{"id":"ESRFUO3-Q62XD-WIOIL7","asset":"XBT","can_allocate":true,"user_min_allocation":"0.001"}]}}`, `{"error":[],"result":true}`, false, 1},
+		{strategies, `{"error":["EEarnings:Busy:Another (de)allocation for the same strategy is in progress"]}`, false, 1},
+		{`{"error":[],"result":{"items":[]}}`, `{"error":[],"result":true}`, false, 1},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus":     {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":           {tickerResponse},
+			"/0/private/AddOrder":        {addOrderResponse},
+			"/0/private/QueryOrders":     {queryOrdersResponse},
+			"/0/private/Earn/Strategies": {tc.strategies},
+			"/0/private/Earn/Allocate":   {tc.allocate},
+		})
+		app, n := newTestApp(s, dca.AppConfig{EarnAllocate: true, EarnStrategyID: "ESRFUO3-Q62XD-WIOIL7"})
+
+		if err := app.Run(context.Background()); err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+
+		summary := n.summaries[0]
+		if want, got := dca.RunStatusSuccess, summary.Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.allocated, summary.Earn != nil; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		} else if got && summary.Earn.StrategyID != "ESRFUO3-Q62XD-WIOIL7" {
+			t.Errorf("%d: unexpected strategy %v", i, summary.Earn.StrategyID)
+		}
+		if want, got := tc.warnings, len(summary.Warnings); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestApp_LoadConfig_Secrets(t *testing.T) {
+	const delay = 200 * time.Millisecond
+
+	config := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(config, []byte(`{
+		"krakenApiKey": "awsssme://kraken/api-key",
+		"krakenPrivateKey": "awsssme://kraken/private-key",
+		"orderAmountInCents": 500,
+		"mqtt": {"brokerUrl": "tcp://localhost:1883", "password": "awsssm://mqtt/password"}
+	}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		failing string
+		valid   bool
+	}{
+		{"", true},
+		{"awsssme://kraken/private-key", false},
+	}
+	for i, tc := range tt {
+		var mu sync.Mutex
+		var resolved []string
+
+		app := dca.NewApp()
+		app.SecretResolver = func(ctx context.Context, ref string) ([]byte, error) {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+
+			mu.Lock()
+			resolved = append(resolved, ref)
+			mu.Unlock()
+
+			if ref == tc.failing {
+				return nil, errors.New("parameter not found")
+			}
+			return []byte("resolved:" + ref), nil
+		}
+
+		start := time.Now()
+		err := app.LoadConfig(context.Background(), config)
+		elapsed := time.Since(start)
+
+		if want, got := 3, len(resolved); got != want {
+			t.Errorf("%d: want %v secrets resolved got %v", i, want, got)
+		}
+		// secrets are resolved concurrently so the total is close to a single delay rather than the sum
+		if elapsed >= 2*delay {
+			t.Errorf("%d: want less than %v got %v", i, 2*delay, elapsed)
+		}
+
+		if !tc.valid {
+			if err == nil || !strings.Contains(err.Error(), "krakenPrivateKey: parameter not found") {
+				t.Errorf("%d: unexpected error %v", i, err)
+			}
+			continue
+		} else if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+
+		if want, got := "resolved:awsssme://kraken/api-key", app.Config.KrakenAPIKey; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := "resolved:awsssme://kraken/private-key", app.Config.KrakenPrivateKey; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := "resolved:awsssm://mqtt/password", app.Config.MQTT.Password; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestApp_LoadConfig_Merge(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	shared := write("shared.json", `{
+		"pair": "ETHUSD",
+		"orderAmountInCents": 100,
+		"mqtt": {"brokerUrl": "tcp://localhost:1883", "topicPrefix": "dca", "qos": 1}
+	}`)
+	env := write("env.json", `{
+		"krakenApiKey": "key",
+		"krakenPrivateKey": "secret",
+		"orderAmountInCents": 500,
+		"mqtt": {"topicPrefix": "dca/prod"}
+	}`)
+	invalid := write("invalid.json", `{"orderAmountInCents": 0}`)
+	conflict := write("conflict.json", `{"mqtt": "tcp://localhost:1883"}`)
+
+	tt := []struct {
+		files []string
+		err   string
+	}{
+		{[]string{shared, env}, ""},
+		// only the merged config is validated so the shared file may be incomplete
+		{[]string{env, invalid}, "orderAmountInCents cannot be less than or equal to zero"},
+		{[]string{shared, filepath.Join(dir, "missing.json")}, "missing.json"},
+		{[]string{shared, env, conflict}, "conflict.json: mqtt is a string but an earlier config set it to an object"},
+		{nil, "must specify a config file path"},
+	}
+	for i, tc := range tt {
+		app := dca.NewApp()
+		err := app.LoadConfig(context.Background(), tc.files...)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%d: want error containing %q got %v", i, tc.err, err)
+			}
+			continue
+		} else if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+
+		if want, got := "ETHUSD", app.Config.Pair; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := 500, app.Config.OrderAmountInCents; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		// nested objects are merged key by key
+		if want, got := "tcp://localhost:1883", app.Config.MQTT.BrokerURL; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := "dca/prod", app.Config.MQTT.TopicPrefix; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestApp_ParseFlagsAndLoadConfig_Multiple(t *testing.T) {
+	dir := t.TempDir()
+	shared := filepath.Join(dir, "shared.json")
+	env := filepath.Join(dir, "env.json")
+	if err := os.WriteFile(shared, []byte(`{"pair": "ETHUSD", "orderAmountInCents": 100}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(env, []byte(`{"krakenApiKey": "key", "krakenPrivateKey": "secret", "orderAmountInCents": 500}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		env  string
+		args []string
+	}{
+		{"", []string{"--config", shared, "--config", env}},
+		{"", []string{"--config", shared + "," + env}},
+		{shared + ", " + env, nil},
+	}
+	for i, tc := range tt {
+		t.Setenv("CONFIG_FILE", tc.env)
+
+		app := dca.NewApp()
+		if err := app.ParseFlagsAndLoadConfig(context.Background(), tc.args); err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		if want, got := "ETHUSD", app.Config.Pair; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := 500, app.Config.OrderAmountInCents; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestApp_Validate(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/AssetPairs": {`{"error":[],"result":{"XXBTZUSD":{"altname":"XBTUSD","status":"online"}}}`},
+	})
+
+	dir := t.TempDir()
+	write := func(name, config string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	valid := write("valid.json", `{
+		"krakenApiKey": "plain-key",
+		"krakenPrivateKey": "awsssme://kraken/private-key",
+		"krakenBaseUrl": "`+s.URL+`",
+		"orderAmountInCents": 500
+	}`)
+	invalid := write("invalid.json", `{
+		"krakenApiKey": "plain-key",
+		"orderAmountInCents": 0,
+		"pair": "DOGEUSD",
+		"reconcileOrders": true
+	}`)
+
+	tt := []struct {
+		filename string
+		offline  bool
+		problems []string
+	}{
+		{valid, false, nil},
+		{valid, true, nil},
+		{invalid, true, []string{
+			"orderAmountInCents cannot be less than or equal to zero",
+			"orderStorePath is required when reconcileOrders is enabled",
+			"krakenPrivateKey is required",
+			"pair DOGEUSD: unsupported pair",
+		}},
+		{filepath.Join(dir, "missing.json"), true, []string{"failed to read config"}},
+	}
+	for i, tc := range tt {
+		app := dca.NewApp()
+		app.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+		app.SecretResolver = func(_ context.Context, ref string) ([]byte, error) {
+			return []byte("resolved"), nil
+		}
+
+		report := app.Validate(context.Background(), []string{tc.filename}, dca.ValidateOptions{Offline: tc.offline})
+		if want, got := len(tc.problems), len(report.Problems); got != want {
+			t.Fatalf("%d: want %v problems got %v: %v", i, want, got, report.Problems)
+		}
+		for j, problem := range tc.problems {
+			if !strings.HasPrefix(report.Problems[j], problem) {
+				t.Errorf("%d: want %v got %v", i, problem, report.Problems[j])
+			}
+		}
+		if want, got := len(tc.problems) == 0, report.OK(); got != want {
+			t.Errorf("%d: want ok %v got %v", i, want, got)
+		}
+
+		if tc.filename != valid {
+			continue
+		}
+		// secrets are masked, references are kept and defaults are applied
+		if want, got := "******", report.Config.KrakenAPIKey; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := "awsssme://kraken/private-key", report.Config.KrakenPrivateKey; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := dca.KrakenDefaultPair, report.Config.Pair; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+
+	// only the public AssetPairs endpoint is called
+	if want, got := 1, len(s.Requests("/0/public/AssetPairs")); got != want {
+		t.Errorf("want %v AssetPairs requests got %v", want, got)
+	}
+}
+
+func TestAppConfig_ReportingTimeZone(t *testing.T) {
+	tt := []struct {
+		zone     string
+		valid    bool
+		expected string
+	}{
+		{"", true, "UTC"},
+		{"America/New_York", true, "America/New_York"},
+		{"America/Nowhere", false, "UTC"},
+	}
+	for i, tc := range tt {
+		cfg := dca.AppConfig{KrakenAPIKey: "key", KrakenPrivateKey: "secret", OrderAmountInCents: 500, ReportingTimeZone: tc.zone}
+		if want, got := tc.valid, cfg.Validate() == nil; got != want {
+			t.Errorf("%d: want valid %v got %v", i, want, got)
+		}
+		if want, got := tc.expected, cfg.Location().String(); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestApp_Run_PriceDeviation(t *testing.T) {
+	tt := []struct {
+		threshold float64
+		history   bool
+		expected  dca.RunStatus
+	}{
+		// the ask of 50000 is 25% away from the previous purchase at 40000
+		{25, true, dca.RunStatusSuccess},
+		{24.9, true, dca.RunStatusSkipped},
+		{30, true, dca.RunStatusSuccess},
+		{0, true, dca.RunStatusSuccess},
+		// the first run has nothing to compare against
+		{10, false, dca.RunStatusSuccess},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		storePath := filepath.Join(t.TempDir(), "orders.jsonl")
+		if tc.history {
+			store := dca.NewFileOrderStore(storePath)
+			for _, rec := range []dca.OrderRecord{
+				{Time: time.Now().Add(-48 * time.Hour), Order: dca.ExecuteOrderResponse{Pair: "XBTUSD", Side: dca.SideBuy, VolumePurchased: 0.0001, Price: 10000}},
+				{Time: time.Now().Add(-24 * time.Hour), Order: dca.ExecuteOrderResponse{Pair: "XBTUSD", Side: dca.SideBuy, VolumePurchased: 0.0001, Price: 40000}},
+				// other pairs and unfilled orders aren't compared against
+				{Time: time.Now().Add(-time.Hour), Order: dca.ExecuteOrderResponse{Pair: "ETHUSD", Side: dca.SideBuy, VolumePurchased: 0.01, Price: 3000}},
+				{Time: time.Now().Add(-time.Hour), Order: dca.ExecuteOrderResponse{Pair: "XBTUSD", Side: dca.SideBuy, Status: dca.OrderStatusOpen}},
+			} {
+				if err := store.Put(context.Background(), rec); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		app, n := newTestApp(s, dca.AppConfig{OrderStorePath: storePath, MaxPriceDeviationPercent: tc.threshold})
+
+		if err := app.Run(context.Background()); err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+
+		summary := n.summaries[0]
+		if want, got := tc.expected, summary.Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if tc.expected == dca.RunStatusSkipped {
+			if want, got := dca.SkipReasonPriceDeviation, summary.SkipReason; got != want {
+				t.Errorf("%d: want %v got %v", i, want, got)
+			}
+			if want, got := 0, len(s.Requests("/0/private/AddOrder")); got != want {
+				t.Errorf("%d: want %v AddOrder requests got %v", i, want, got)
+			}
+		}
+	}
+}
+
+func TestApp_Run_Label(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":       {tickerResponse},
+		"/0/private/AddOrder":    {addOrderResponse},
+		"/0/private/QueryOrders": {queryOrdersResponse},
+	})
+	storePath := filepath.Join(t.TempDir(), "orders.jsonl")
+	store := dca.NewFileOrderStore(storePath)
+	for _, rec := range []dca.OrderRecord{
+		{Time: time.Now().Add(-72 * time.Hour), Order: dca.ExecuteOrderResponse{Pair: "XBTUSD", Slippage: &dca.Slippage{Percent: 4}}},
+		{Time: time.Now().Add(-48 * time.Hour), Order: dca.ExecuteOrderResponse{Pair: "XBTUSD", Label: "retirement", Slippage: &dca.Slippage{Percent: 2}}},
+		{Time: time.Now().Add(-24 * time.Hour), Order: dca.ExecuteOrderResponse{Pair: "XBTUSD", Label: "travel", Slippage: &dca.Slippage{Percent: 1}}},
+	} {
+		if err := store.Put(context.Background(), rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app, n := newTestApp(s, dca.AppConfig{OrderStorePath: storePath, Label: "travel"})
+
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	summary := n.summaries[0]
+	if want, got := "travel", summary.Label; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := "travel", summary.Order.Label; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	// the stats only cover the travel orders, the new order filled at the quoted price
+	if summary.Slippage == nil {
+		t.Fatal("expected slippage stats")
+	} else if want, got := 2, summary.Slippage.Orders; got != want {
+		t.Errorf("want %v orders got %v", want, got)
+	} else if want, got := 0.5, summary.Slippage.AveragePercent; !approx(want, got) {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	records, err := store.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "travel", records[len(records)-1].Order.Label; got != want {
+		t.Errorf("want recorded label %v got %v", want, got)
+	}
+	if want, got := 2, len(dca.FilterOrderRecords(records, "travel")); got != want {
+		t.Errorf("want %v travel records got %v", want, got)
+	}
+	if want, got := 4, len(dca.FilterOrderRecords(records, "")); got != want {
+		t.Errorf("want %v records got %v", want, got)
+	}
+}
+
+func TestApp_Run_OrderInfoWarnings(t *testing.T) {
+	tt := []struct {
+		strict bool
+		status dca.RunStatus
+	}{
+		{false, dca.RunStatusSuccess},
+		{true, dca.RunStatusFailed},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {`{"error":[],"result":{"TXID-1":{"status":"closed","vol":"0.00010000","cost":"5.00","fee":"","price":"50000.0"}}}`},
+		})
+		app, n := newTestApp(s, dca.AppConfig{StrictOrderInfo: tc.strict})
+
+		err := app.Run(context.Background())
+		if want, got := tc.strict, err != nil; got != want {
+			t.Errorf("%d: want failure %v got %v", i, want, err)
+		}
+
+		summary := n.summaries[0]
+		if want, got := tc.status, summary.Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if tc.strict {
+			continue
+		}
+		if want, got := []string{`order TXID-1: failed to parse fee "": strconv.ParseFloat: parsing "": invalid syntax`}, summary.Warnings; len(got) != 1 || got[0] != want[0] {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := 5.0, summary.Order.Cost; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestApp_LoadConfig_Profiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	base := write("base.json", `{
+		"krakenApiKey": "key",
+		"krakenPrivateKey": "secret",
+		"orderAmountInCents": 500,
+		"label": "base",
+		"mqtt": {"brokerUrl": "tcp://localhost:1883", "topicPrefix": "dca"},
+		"profiles": {
+			"weekly-small": {"orderAmountInCents": 1000, "label": "weekly"},
+			"monthly-big": {"orderAmountInCents": 20000, "pair": "ETHUSD", "mqtt": {"topicPrefix": "dca/monthly"}},
+			"broken": {"orderAmountInCents": 0}
+		}
+	}`)
+	scalar := write("scalar.json", `{"profiles": {"scalar": 5}}`)
+	defaulted := write("defaulted.json", `{"profile": "monthly-big"}`)
+	// a later file's base value doesn't override the profile
+	later := write("later.json", `{"orderAmountInCents": 700, "profiles": {"weekly-small": {"pair": "XBTEUR"}}}`)
+	none := write("none.json", `{"krakenApiKey": "key", "krakenPrivateKey": "secret", "orderAmountInCents": 500}`)
+
+	tt := []struct {
+		files   []string
+		profile string
+		args    []string
+		err     string
+		amount  int
+		pair    string
+		label   string
+		applied string
+	}{
+		{[]string{base}, "", nil, "", 500, "", "base", ""},
+		{[]string{base}, "weekly-small", nil, "", 1000, "", "weekly", "weekly-small"},
+		{[]string{base}, "monthly-big", nil, "", 20000, "ETHUSD", "base", "monthly-big"},
+		// the config selects a profile unless one is selected at invocation
+		{[]string{base, defaulted}, "", nil, "", 20000, "ETHUSD", "base", "monthly-big"},
+		{[]string{base, defaulted}, "weekly-small", nil, "", 1000, "", "weekly", "weekly-small"},
+		{[]string{base, later}, "weekly-small", nil, "", 1000, "XBTEUR", "weekly", "weekly-small"},
+		{[]string{base, later}, "", nil, "", 700, "", "base", ""},
+		// flags override the profile
+		{[]string{base}, "", []string{"--profile", "weekly-small", "--amount", "300"}, "", 300, "", "weekly", "weekly-small"},
+		{[]string{base}, "daily", nil, `unknown profile "daily", available profiles: broken, monthly-big, weekly-small`, 0, "", "", ""},
+		{[]string{none}, "daily", nil, `unknown profile "daily", the config defines no profiles`, 0, "", "", ""},
+		// the merged result of the profile is validated
+		{[]string{base}, "broken", nil, "orderAmountInCents cannot be less than or equal to zero", 0, "", "", ""},
+		// profiles are checked even when they aren't selected
+		{[]string{base, scalar}, "", nil, `profile "scalar" is a number, profiles must be objects`, 0, "", "", ""},
+	}
+	for i, tc := range tt {
+		app := dca.NewApp()
+		app.Profile = tc.profile
+
+		var err error
+		if tc.args != nil {
+			args := append([]string{"--config", strings.Join(tc.files, ",")}, tc.args...)
+			err = app.ParseFlagsAndLoadConfig(context.Background(), args)
+		} else {
+			err = app.LoadConfig(context.Background(), tc.files...)
+		}
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%d: want error containing %q got %v", i, tc.err, err)
+			}
+			continue
+		} else if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+
+		if want, got := tc.amount, app.Config.OrderAmountInCents; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.pair, app.Config.Pair; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.label, app.Config.Label; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.applied, app.Config.Profile; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		// nested objects of a profile are merged key by key
+		if want, got := "tcp://localhost:1883", app.Config.MQTT.BrokerURL; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if app.Config.Profiles != nil {
+			t.Errorf("%d: want the profiles dropped once applied", i)
+		}
+	}
+}
+
+func TestApp_Run_KrakenWarnings(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":       {tickerResponse},
+		"/0/private/AddOrder":    {strings.Replace(addOrderResponse, `"error":[]`, `"error":["WOrder:Partial fill expected"]`, 1)},
+		"/0/private/QueryOrders": {queryOrdersResponse},
+	})
+	app, n := newTestApp(s, dca.AppConfig{})
+
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	summary := n.summaries[0]
+	if want, got := dca.RunStatusSuccess, summary.Status; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := []string{"/0/private/AddOrder: WOrder:Partial fill expected"}, summary.Warnings; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestApp_Run_Profile(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":       {tickerResponse},
+		"/0/private/AddOrder":    {addOrderResponse},
+		"/0/private/QueryOrders": {queryOrdersResponse},
+	})
+	storePath := filepath.Join(t.TempDir(), "orders.jsonl")
+	app, n := newTestApp(s, dca.AppConfig{OrderStorePath: storePath, Profile: "weekly-small"})
+
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "weekly-small", n.summaries[0].Profile; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	records, err := dca.NewFileOrderStore(storePath).List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "weekly-small", records[0].Profile; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestApp_EffectiveConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// secrets set as plain values must be masked as well as resolved ones
+	base := write("base.json", `{
+		"krakenApiKey": "plain-api-key",
+		"krakenPrivateKey": "`+base64.StdEncoding.EncodeToString([]byte("plain-private-key"))+`",
+		"orderAmountInCents": 500,
+		"mqtt": {"brokerUrl": "tcp://localhost:1883", "password": "plain-mqtt-password"},
+		"profiles": {
+			"weekly": {"label": "weekly", "mqtt": {"topicPrefix": "dca/weekly"}},
+			"other": {"krakenApiKey": "other-api-key"}
+		}
+	}`)
+	override := write("override.json", `{
+		"pair": "ETHUSD",
+		"mqtt": {"password": "awsssm://mqtt/password"},
+		"profiles": {"weekly": {"pair": "XBTEUR"}}
+	}`)
+
+	tt := []struct {
+		files   []string
+		args    []string
+		secrets []string
+		sources map[string]dca.ConfigSource
+	}{
+		{
+			[]string{base}, nil,
+			[]string{"plain-api-key", "plain-private-key", "plain-mqtt-password", "other-api-key"},
+			map[string]dca.ConfigSource{
+				"krakenApiKey":       {Kind: dca.ConfigSourceFile, Name: base},
+				"mqtt.password":      {Kind: dca.ConfigSourceFile, Name: base},
+				"mqtt.topicPrefix":   {Kind: dca.ConfigSourceDefault},
+				"orderAmountInCents": {Kind: dca.ConfigSourceFile, Name: base},
+				"pair":               {Kind: dca.ConfigSourceDefault},
+				"krakenBaseUrl":      {Kind: dca.ConfigSourceDefault},
+			},
+		},
+		{
+			[]string{base, override}, []string{"--profile", "weekly", "--amount", "700"},
+			[]string{"plain-api-key", "plain-private-key", "resolved-mqtt-password", "other-api-key"},
+			map[string]dca.ConfigSource{
+				"krakenApiKey":       {Kind: dca.ConfigSourceFile, Name: base},
+				"mqtt.brokerUrl":     {Kind: dca.ConfigSourceFile, Name: base},
+				"mqtt.password":      {Kind: dca.ConfigSourceSSM, Name: "awsssm://mqtt/password"},
+				"mqtt.topicPrefix":   {Kind: dca.ConfigSourceFile, Name: base, Profile: "weekly"},
+				"label":              {Kind: dca.ConfigSourceFile, Name: base, Profile: "weekly"},
+				"pair":               {Kind: dca.ConfigSourceFile, Name: override, Profile: "weekly"},
+				"orderAmountInCents": {Kind: dca.ConfigSourceFlag, Name: "--amount"},
+				"profile":            {Kind: dca.ConfigSourceFlag, Name: "--profile"},
+			},
+		},
+	}
+	for i, tc := range tt {
+		app := dca.NewApp()
+		app.SecretResolver = func(ctx context.Context, ref string) ([]byte, error) {
+			return []byte("resolved-mqtt-password"), nil
+		}
+		args := append([]string{"--config", strings.Join(tc.files, ",")}, tc.args...)
+		if err := app.ParseFlagsAndLoadConfig(context.Background(), args); err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+
+		eff, err := app.EffectiveConfig()
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		b, err := json.Marshal(eff)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range tc.secrets {
+			if strings.Contains(string(b), secret) {
+				t.Errorf("%d: want %q masked got %s", i, secret, b)
+			}
+		}
+		if want, got := "******", eff.Config.KrakenPrivateKey; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+
+		for path, want := range tc.sources {
+			if got := eff.Sources[path]; got != want {
+				t.Errorf("%d: %s: want %+v got %+v", i, path, want, got)
+			}
+		}
+		for path := range eff.Sources {
+			if strings.HasPrefix(path, "profiles") {
+				t.Errorf("%d: want the sources of profiles dropped got %s", i, path)
+			}
+		}
+	}
+}
+
+// panickingExecutor panics on every order.
+type panickingExecutor struct{}
+
+func (panickingExecutor) ExecuteOrder(context.Context, dca.ExecuteOrderRequest) (dca.ExecuteOrderResponse, error) {
+	panic("boom")
+}
+
+// panickingNotifier panics on every summary.
+type panickingNotifier struct{}
+
+func (panickingNotifier) Notify(context.Context, dca.RunSummary) error {
+	panic("notifier boom")
+}
+
+func TestApp_Run_Panic(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+	})
+	app, n := newTestApp(s, dca.AppConfig{FailureArchive: t.TempDir()})
+	app.Executor = panickingExecutor{}
+	// a panicking notifier doesn't keep the others from being notified
+	app.Notifiers = append([]dca.Notifier{panickingNotifier{}}, app.Notifiers...)
+
+	err := app.Run(context.Background())
+	if !errors.Is(err, dca.ErrPanic) {
+		t.Fatalf("want %v got %v", dca.ErrPanic, err)
+	}
+	var pe *dca.PanicError
+	if !errors.As(err, &pe) {
+		t.Fatalf("want a *PanicError got %T", err)
+	}
+	if want, got := "boom", pe.Value; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if !strings.Contains(pe.StackTrace(), "panickingExecutor.ExecuteOrder") {
+		t.Errorf("want the stack of the panic got %s", pe.StackTrace())
+	}
+
+	if want, got := 1, len(n.summaries); got != want {
+		t.Fatalf("want %v got %v", want, got)
+	}
+	summary := n.summaries[0]
+	if want, got := dca.RunStatusFailed, summary.Status; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := "panic: boom", summary.Error; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	// the failure is archived with the stack of the panic
+	files, _ := filepath.Glob(filepath.Join(app.Config.FailureArchive, "*.json"))
+	if want, got := 1, len(files); got != want {
+		t.Fatalf("want %v got %v", want, got)
+	}
+	b, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec dca.FailureRecord
+	if err = json.Unmarshal(b, &rec); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rec.Stack, "panickingExecutor.ExecuteOrder") {
+		t.Errorf("want the stack of the panic got %s", rec.Stack)
+	}
+}
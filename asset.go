@@ -0,0 +1,155 @@
+package dca
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// pairQuotes are the quote assets recognized at the end of pair names that aren't supported by the provider, longest
+// first so USDT isn't taken for USD.
+var pairQuotes = []string{"ZUSD", "ZEUR", "ZGBP", "ZCAD", "ZJPY", "ZAUD", "ZCHF", "USDT", "USDC", "USD", "EUR", "GBP", "CAD", "JPY", "AUD", "CHF", "XBT", "BTC", "ETH"}
+
+// PairAssets returns the common codes of the base and quote assets of a pair, e.g. BTC and USD for XBTUSD, its result
+// key XXBTZUSD or XBT/USD. Pairs the provider doesn't support are split on a slash or a known quote asset at their end,
+// the quote is empty when neither is found. Every surface naming the asset of a pair goes through it, so BTC bought
+// with XBTUSD and with XXBTZEUR is the same asset.
+func PairAssets(pair string) (base, quote string) {
+	pair = strings.ToUpper(strings.TrimSpace(pair))
+	if p, ok := krakenPairs[pair]; ok {
+		return NormalizeKrakenAsset(p.BaseAsset), NormalizeKrakenAsset(p.QuoteAsset)
+	}
+	for _, p := range krakenPairs {
+		if p.ResultKey == pair {
+			return NormalizeKrakenAsset(p.BaseAsset), NormalizeKrakenAsset(p.QuoteAsset)
+		}
+	}
+
+	if b, q, ok := strings.Cut(pair, "/"); ok {
+		return NormalizeKrakenAsset(b), NormalizeKrakenAsset(q)
+	}
+	for _, q := range pairQuotes {
+		if b, ok := strings.CutSuffix(pair, q); ok && b != "" {
+			return NormalizeKrakenAsset(b), NormalizeKrakenAsset(q)
+		}
+	}
+	return NormalizeKrakenAsset(pair), ""
+}
+
+// BaseAsset returns the common code of the base asset of the record's order, e.g. BTC. Records written before the
+// asset was recorded have it derived from their pair.
+func (r OrderRecord) BaseAsset() string {
+	if r.Asset != "" {
+		return r.Asset
+	}
+	base, _ := PairAssets(r.Order.Pair)
+	return base
+}
+
+// FilterOrderRecordsByAsset returns the records of orders buying or selling asset, a common or Kraken code such as
+// BTC, XBT or XXBT. Every record is returned when asset is empty.
+func FilterOrderRecordsByAsset(records []OrderRecord, asset string) []OrderRecord {
+	if asset == "" {
+		return records
+	}
+	asset = NormalizeKrakenAsset(strings.ToUpper(asset))
+
+	var filtered []OrderRecord
+	for _, rec := range records {
+		if rec.BaseAsset() == asset {
+			filtered = append(filtered, rec)
+		}
+	}
+	return filtered
+}
+
+// FilterLedgerEntriesByAsset returns the entries changing the balance of asset, a common or Kraken code, including
+// its staked balances, e.g. BTC.M for BTC. Every entry is returned when asset is empty. The fiat leg of a trade is
+// a separate entry, it's left out unless asset is the fiat currency.
+func FilterLedgerEntriesByAsset(entries []KrakenLedgerEntry, asset string) []KrakenLedgerEntry {
+	if asset == "" {
+		return entries
+	}
+	asset = NormalizeKrakenAsset(strings.ToUpper(asset))
+
+	var filtered []KrakenLedgerEntry
+	for _, e := range entries {
+		if code, _, _ := strings.Cut(e.Asset, "."); code == asset {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+// AssetStats are the figures of the recorded orders of a base asset bought with a quote currency.
+type AssetStats struct {
+	Asset    string `json:"asset" desc:"The common code of the base asset, e.g. BTC" schema:"required"`
+	Currency string `json:"currency" desc:"The common code of the quote currency the asset was traded with, e.g. USD"`
+	Orders   int    `json:"orders" desc:"The number of recorded orders" schema:"required"`
+	// Volume is the base asset bought less what was sold, see NewUnrealizedPnL.
+	Volume float64 `json:"volume" desc:"The base asset held from the recorded orders" schema:"required"`
+	// Cost is what the buys cost before fees.
+	Cost float64 `json:"cost" desc:"What the recorded buys cost in the quote currency, fees excluded" schema:"required"`
+	Fees float64 `json:"fees" desc:"The fees of the recorded orders in the quote currency" schema:"required"`
+	// CostBasis is what the held volume cost, fees included, at the average cost of the buys.
+	CostBasis float64 `json:"costBasis" desc:"What the held volume cost in the quote currency, fees included" schema:"required"`
+	// AveragePrice is CostBasis divided by Volume, zero when nothing is held.
+	AveragePrice float64 `json:"averagePrice" desc:"The average cost of the held volume in the quote currency, fees included" schema:"required"`
+}
+
+// FiatTotal is what the recorded orders of every asset cost in a quote currency.
+type FiatTotal struct {
+	Currency string  `json:"currency" desc:"The common code of the quote currency" schema:"required"`
+	Cost     float64 `json:"cost" desc:"What the recorded buys cost, fees excluded" schema:"required"`
+	Fees     float64 `json:"fees" desc:"The fees of the recorded orders" schema:"required"`
+}
+
+// OrderStats are the figures of recorded orders grouped by base asset, with the fiat totals across assets.
+type OrderStats struct {
+	Assets []AssetStats `json:"assets" desc:"The figures of each base asset and quote currency, ordered by asset then currency" schema:"required"`
+	Totals []FiatTotal  `json:"totals" desc:"What the orders of every asset cost, one total per quote currency" schema:"required"`
+}
+
+// NewOrderStats groups records by their base asset and quote currency, BTC bought with USD and with EUR are two
+// groups since their costs can't be added. The totals add the groups of each quote currency up.
+func NewOrderStats(records []OrderRecord) OrderStats {
+	type key struct{ asset, currency string }
+	groups := map[key][]OrderRecord{}
+	for _, rec := range records {
+		_, quote := PairAssets(rec.Order.Pair)
+		k := key{rec.BaseAsset(), quote}
+		groups[k] = append(groups[k], rec)
+	}
+
+	stats := OrderStats{Assets: []AssetStats{}, Totals: []FiatTotal{}}
+	totals := map[string]*FiatTotal{}
+	for k, recs := range groups {
+		s := AssetStats{Asset: k.asset, Currency: k.currency, Orders: len(recs)}
+		for _, rec := range recs {
+			s.Fees += rec.Order.Fee
+			if rec.Order.Side != SideSell {
+				s.Cost += rec.Order.Cost
+			}
+		}
+		s.Volume, s.CostBasis = holding(recs)
+		if s.Volume > 0 {
+			s.AveragePrice = s.CostBasis / s.Volume
+		}
+		stats.Assets = append(stats.Assets, s)
+
+		if totals[k.currency] == nil {
+			totals[k.currency] = &FiatTotal{Currency: k.currency}
+		}
+		totals[k.currency].Cost += s.Cost
+		totals[k.currency].Fees += s.Fees
+	}
+
+	slices.SortFunc(stats.Assets, func(a, b AssetStats) int {
+		return cmp.Or(cmp.Compare(a.Asset, b.Asset), cmp.Compare(a.Currency, b.Currency))
+	})
+	for _, t := range totals {
+		stats.Totals = append(stats.Totals, *t)
+	}
+	slices.SortFunc(stats.Totals, func(a, b FiatTotal) int { return cmp.Compare(a.Currency, b.Currency) })
+	return stats
+}
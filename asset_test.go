@@ -0,0 +1,141 @@
+package dca_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+func TestPairAssets(t *testing.T) {
+	tt := []struct {
+		pair  string
+		base  string
+		quote string
+	}{
+		{"XBTUSD", "BTC", "USD"},
+		{"XXBTZUSD", "BTC", "USD"},
+		{"XBTEUR", "BTC", "EUR"},
+		{"xbtusd", "BTC", "USD"},
+		{"XBT/USD", "BTC", "USD"},
+		{"BTC/EUR", "BTC", "EUR"},
+		{"ETHUSD", "ETH", "USD"},
+		{"XETHZEUR", "ETH", "EUR"},
+		{"ETH/USD", "ETH", "USD"},
+		{"USDTEUR", "USDT", "EUR"},
+		// pairs the provider doesn't support are split on their quote
+		{"XXBTZGBP", "BTC", "GBP"},
+		{"SOLUSD", "SOL", "USD"},
+		{"SOLUSDT", "SOL", "USDT"},
+		{"XDGXBT", "DOGE", "BTC"},
+		{"SOL", "SOL", ""},
+		{"", "", ""},
+	}
+	for i, tc := range tt {
+		base, quote := dca.PairAssets(tc.pair)
+		if want, got := tc.base, base; got != want {
+			t.Errorf("%d: want base %q got %q", i, want, got)
+		}
+		if want, got := tc.quote, quote; got != want {
+			t.Errorf("%d: want quote %q got %q", i, want, got)
+		}
+	}
+}
+
+func TestFilterOrderRecordsByAsset(t *testing.T) {
+	records := []dca.OrderRecord{
+		{Asset: "BTC", Order: dca.ExecuteOrderResponse{TransactionID: "A", Pair: "XBTUSD"}},
+		{Asset: "ETH", Order: dca.ExecuteOrderResponse{TransactionID: "B", Pair: "ETHUSD"}},
+		// recorded before the asset was
+		{Order: dca.ExecuteOrderResponse{TransactionID: "C", Pair: "XXBTZEUR"}},
+	}
+	tt := []struct {
+		asset    string
+		expected string
+	}{
+		{"", "ABC"},
+		{"BTC", "AC"},
+		{"XBT", "AC"},
+		{"xxbt", "AC"},
+		{"ETH", "B"},
+		{"SOL", ""},
+	}
+	for i, tc := range tt {
+		var got string
+		for _, rec := range dca.FilterOrderRecordsByAsset(records, tc.asset) {
+			got += rec.Order.TransactionID
+		}
+		if want := tc.expected; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestFilterLedgerEntriesByAsset(t *testing.T) {
+	entries := []dca.KrakenLedgerEntry{{ID: "A", Asset: "BTC"}, {ID: "B", Asset: "USD"}, {ID: "C", Asset: "BTC.M"}, {ID: "D", Asset: "ETH"}}
+	tt := []struct {
+		asset    string
+		expected string
+	}{
+		{"", "ABCD"},
+		{"XBT", "AC"},
+		{"ZUSD", "B"},
+		{"ETH", "D"},
+	}
+	for i, tc := range tt {
+		var got string
+		for _, e := range dca.FilterLedgerEntriesByAsset(entries, tc.asset) {
+			got += e.ID
+		}
+		if want := tc.expected; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestNewOrderStats(t *testing.T) {
+	at := time.Date(2024, 4, 28, 10, 0, 0, 0, time.UTC)
+	order := func(hours int, pair, side string, volume, cost, fee float64) dca.OrderRecord {
+		return dca.OrderRecord{Time: at.Add(time.Duration(hours) * time.Hour), Order: dca.ExecuteOrderResponse{Pair: pair, Side: side, VolumePurchased: volume, Cost: cost, Fee: fee}}
+	}
+	records := []dca.OrderRecord{
+		order(0, "XBTUSD", dca.SideBuy, 0.0001, 5, 0.02),
+		order(1, "ETHUSD", dca.SideBuy, 0.004, 10, 0.04),
+		order(2, "XXBTZUSD", dca.SideBuy, 0.0001, 6, 0.02),
+		// half the BTC is sold at its average cost
+		order(3, "XBTUSD", dca.SideSell, 0.0001, 7, 0.03),
+		order(4, "XBTEUR", dca.SideBuy, 0.0002, 9, 0.04),
+	}
+
+	var got []string
+	stats := dca.NewOrderStats(records)
+	for _, a := range stats.Assets {
+		got = append(got, fmt.Sprintf("%s/%s %d %s %s %s %s %s", a.Asset, a.Currency, a.Orders, dca.FormatCrypto(a.Volume, ""), dca.FormatFiat(a.Cost, ""),
+			dca.FormatFiat(a.Fees, ""), dca.FormatFiat(a.CostBasis, ""), dca.FormatFiat(a.AveragePrice, "")))
+	}
+	for _, total := range stats.Totals {
+		got = append(got, fmt.Sprintf("%s %s %s", total.Currency, dca.FormatFiat(total.Cost, ""), dca.FormatFiat(total.Fees, "")))
+	}
+	expected := []string{
+		"BTC/EUR 1 0.00020000 9.00 0.04 9.04 45200.00",
+		"BTC/USD 3 0.00010000 11.00 0.07 5.52 55200.00",
+		"ETH/USD 1 0.00400000 10.00 0.04 10.04 2510.00",
+		"EUR 9.00 0.04",
+		"USD 21.00 0.11",
+	}
+	if want := expected; !slices.Equal(got, want) {
+		t.Errorf("want %q got %q", want, got)
+	}
+
+	// no records encode as empty lists rather than null
+	b, err := json.Marshal(dca.NewOrderStats(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := `{"assets":[],"totals":[]}`, string(b); got != want {
+		t.Errorf("want %s got %s", want, got)
+	}
+}
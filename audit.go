@@ -0,0 +1,386 @@
+package dca
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultAuditBuffer is the number of audit records queued for writing before new records are dropped.
+const DefaultAuditBuffer = 1024
+
+// Error classes of audit records besides the errors reported by the exchange.
+const (
+	AuditErrorTransport = "transport"
+	AuditErrorTimeout   = "timeout"
+	AuditErrorHTTP      = "http"
+)
+
+// auditPeekBytes is how much of a response body is kept to find the error reported by the exchange, Kraken reports
+// it first.
+const auditPeekBytes = 512
+
+// AuditRecord describes a single outbound API call. Bodies are never recorded, and neither are headers, which carry
+// the API key and signature of private calls.
+type AuditRecord struct {
+	Time     time.Time `json:"time"`
+	Provider string    `json:"provider"`
+	Method   string    `json:"method"`
+	Endpoint string    `json:"endpoint"`
+	// Params are the query and form parameters of the call with credentials removed, see sanitizeAuditParams.
+	Params    map[string]string `json:"params,omitempty"`
+	Status    int               `json:"status,omitempty"`
+	LatencyMS int64             `json:"latencyMs"`
+	// ErrorClass is the error the exchange reported, e.g. EOrder:Insufficient funds, or one of the AuditError
+	// classes.
+	ErrorClass string `json:"errorClass,omitempty"`
+}
+
+// AuditStats counts the audit records of a run.
+type AuditStats struct {
+	Records int64 `json:"records" desc:"The number of outbound calls recorded" schema:"required"`
+	Dropped int64 `json:"dropped" desc:"The number of records dropped because the audit log fell behind" schema:"required"`
+}
+
+// AuditSink appends batches of encoded audit records, one JSON document per line.
+type AuditSink interface {
+	Append(ctx context.Context, lines []byte) error
+	Close(ctx context.Context) error
+}
+
+// AuditLog writes audit records in the background so recording a call never blocks it: when the queue is full the
+// record is dropped and counted instead. It's safe for concurrent use.
+type AuditLog struct {
+	// Now returns the current time, defaults to time.Now.
+	Now func() time.Time
+
+	sink     AuditSink
+	logger   *slog.Logger
+	queue    chan AuditRecord
+	finished chan struct{}
+	records  atomic.Int64
+	dropped  atomic.Int64
+
+	// mu guards closed so no record is queued once the queue is closed
+	mu       sync.RWMutex
+	closed   bool
+	closeErr error
+}
+
+// NewAuditLog starts writing records queued on the log to sink, buffer bounds the queue and defaults to
+// DefaultAuditBuffer.
+func NewAuditLog(sink AuditSink, buffer int, logger *slog.Logger) *AuditLog {
+	if buffer <= 0 {
+		buffer = DefaultAuditBuffer
+	}
+	l := &AuditLog{Now: time.Now, sink: sink, logger: logger, queue: make(chan AuditRecord, buffer), finished: make(chan struct{})}
+	go l.write()
+	return l
+}
+
+// OpenAuditLog opens the audit log at location, an S3 URL such as s3://bucket/prefix or a local file.
+func OpenAuditLog(location string, headers map[string]string, logger *slog.Logger) (*AuditLog, error) {
+	var sink AuditSink
+	if strings.HasPrefix(location, S3Prefix) {
+		u, err := url.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auditLog: %w", err)
+		} else if u.Host == "" {
+			return nil, errors.New("auditLog is missing an S3 bucket")
+		}
+		sink = &S3AuditSink{S3Location: S3Location{Bucket: u.Host, ExtraHeaders: headers}, Prefix: strings.Trim(u.Path, "/")}
+	} else {
+		f, err := openAppend(location)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		sink = &FileAuditSink{f: f}
+	}
+	return NewAuditLog(sink, 0, logger), nil
+}
+
+// Record queues rec for writing, dropping it when the queue is full.
+func (l *AuditLog) Record(rec AuditRecord) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		l.dropped.Add(1)
+		return
+	}
+	select {
+	case l.queue <- rec:
+		l.records.Add(1)
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// Stats returns the number of records queued and dropped so far.
+func (l *AuditLog) Stats() AuditStats {
+	return AuditStats{Records: l.records.Load(), Dropped: l.dropped.Load()}
+}
+
+func (l *AuditLog) write() {
+	defer close(l.finished)
+	for rec := range l.queue {
+		var buf bytes.Buffer
+		l.encode(&buf, rec)
+		// batch whatever else is queued into a single append
+		for len(l.queue) > 0 {
+			l.encode(&buf, <-l.queue)
+		}
+		if err := l.sink.Append(context.Background(), buf.Bytes()); err != nil {
+			l.logger.Warn("failed to write audit records", "error", err)
+		}
+	}
+}
+
+func (l *AuditLog) encode(buf *bytes.Buffer, rec AuditRecord) {
+	// an AuditRecord always encodes
+	b, _ := json.Marshal(rec)
+	buf.Write(append(b, '\n'))
+}
+
+// Close writes the queued records and closes the sink, records made after closing are dropped.
+func (l *AuditLog) Close(ctx context.Context) error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return l.closeErr
+	}
+	l.closed = true
+	close(l.queue)
+	l.mu.Unlock()
+
+	<-l.finished
+	err := l.sink.Close(ctx)
+	l.mu.Lock()
+	l.closeErr = err
+	l.mu.Unlock()
+	return err
+}
+
+// FileAuditSink appends to a local file, each batch is a single write to a file opened for appending so concurrent
+// writers never interleave records.
+type FileAuditSink struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func (s *FileAuditSink) Append(_ context.Context, lines []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.f.Write(lines)
+	return err
+}
+
+func (s *FileAuditSink) Close(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+// S3AuditSink buffers the records of a run and writes them to a new object under Prefix when closed, S3 objects
+// can't be appended to. Requests are signed with the default AWS credentials.
+type S3AuditSink struct {
+	S3Location
+	Prefix string
+
+	mu    sync.Mutex
+	lines bytes.Buffer
+}
+
+func (s *S3AuditSink) Append(_ context.Context, lines []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines.Write(lines)
+	return nil
+}
+
+func (s *S3AuditSink) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lines.Len() == 0 {
+		return nil
+	}
+	key := path.Join(s.Prefix, time.Now().UTC().Format("20060102T150405.000000000Z")+".jsonl")
+	if _, err := s3Request(ctx, s.object(key), "PUT", s.lines.Bytes()); err != nil {
+		return fmt.Errorf("failed to put audit log: %w", err)
+	}
+	s.lines.Reset()
+	return nil
+}
+
+// auditSensitiveParams are substrings of parameter names which are never recorded.
+var auditSensitiveParams = []string{"key", "sign", "secret", "token", "password", "otp"}
+
+// sanitizeAuditParams flattens params, dropping credentials. Repeated parameters are joined with commas.
+func sanitizeAuditParams(params url.Values) map[string]string {
+	var out map[string]string
+	for name, values := range params {
+		lower := strings.ToLower(name)
+		sensitive := false
+		for _, s := range auditSensitiveParams {
+			sensitive = sensitive || strings.Contains(lower, s)
+		}
+		if sensitive {
+			continue
+		}
+		if out == nil {
+			out = map[string]string{}
+		}
+		out[name] = strings.Join(values, ",")
+	}
+	return out
+}
+
+// krakenErrorPattern finds the first error of a Kraken response, skipping warnings which are prefixed with W.
+var krakenErrorPattern = regexp.MustCompile(`"error"\s*:\s*\[\s*(?:"W[^"]*"\s*,\s*)*"([^W"][^"]*)"`)
+
+// auditedComponents are the HTTP components whose requests are calls to an exchange, the audit log only records
+// those.
+var auditedComponents = map[string]bool{HTTPComponentKraken: true}
+
+// auditTransport records every request of an exchange component sent through next to log.
+type auditTransport struct {
+	log  *AuditLog
+	next http.RoundTripper
+}
+
+// withAudit returns next wrapped to record the calls to exchanges to log, next is returned as is without a log. A nil
+// next uses http.DefaultTransport.
+func withAudit(next http.RoundTripper, log *AuditLog) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if log == nil {
+		return next
+	}
+	return &auditTransport{log: log, next: next}
+}
+
+func (t *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	provider := httpComponent(req.Context())
+	if !auditedComponents[provider] {
+		return t.next.RoundTrip(req)
+	}
+
+	rec := AuditRecord{Time: t.log.Now().UTC(), Provider: provider, Method: req.Method, Endpoint: req.URL.Path}
+	params := req.URL.Query()
+	if mt, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mt == "application/x-www-form-urlencoded" && req.GetBody != nil {
+		// a copy of the body so the request's isn't consumed
+		if body, err := req.GetBody(); err == nil {
+			b, _ := io.ReadAll(io.LimitReader(body, maxDrainBytes))
+			_ = body.Close()
+			if form, err := url.ParseQuery(string(b)); err == nil {
+				for name, values := range form {
+					params[name] = append(params[name], values...)
+				}
+			}
+		}
+	}
+	rec.Params = sanitizeAuditParams(params)
+
+	res, err := t.next.RoundTrip(req)
+	rec.LatencyMS = t.log.Now().Sub(rec.Time).Milliseconds()
+	if err != nil {
+		rec.ErrorClass = AuditErrorTransport
+		var nerr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &nerr) && nerr.Timeout() {
+			rec.ErrorClass = AuditErrorTimeout
+		}
+		t.log.Record(rec)
+		return res, err
+	}
+
+	rec.Status = res.StatusCode
+	if res.StatusCode >= 400 {
+		rec.ErrorClass = AuditErrorHTTP
+	}
+	// the record is made once the body is closed, after the exchange's error could be read from it
+	res.Body = &auditBody{ReadCloser: res.Body, rec: rec, log: t.log, gzip: strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip")}
+	return res, nil
+}
+
+// auditBody keeps the start of a response body to find the error reported by the exchange and records the call when
+// closed.
+type auditBody struct {
+	io.ReadCloser
+	rec  AuditRecord
+	log  *AuditLog
+	gzip bool
+	peek []byte
+	once sync.Once
+}
+
+func (b *auditBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := auditPeekBytes - len(b.peek); room > 0 {
+		b.peek = append(b.peek, p[:min(n, room)]...)
+	}
+	return n, err
+}
+
+func (b *auditBody) Close() error {
+	b.once.Do(func() {
+		peek := b.peek
+		if b.gzip {
+			// a truncated stream still decompresses up to where it was cut
+			if gz, err := gzip.NewReader(bytes.NewReader(peek)); err == nil {
+				peek, _ = io.ReadAll(gz)
+			}
+		}
+		if m := krakenErrorPattern.FindSubmatch(peek); m != nil {
+			b.rec.ErrorClass = string(m[1])
+		}
+		b.log.Record(b.rec)
+	})
+	return b.ReadCloser.Close()
+}
+
+// useAuditLog records every call to the exchange to the audit log at location, replacing the app's audit log if any.
+func (m *App) useAuditLog(location string, headers map[string]string) error {
+	audit, err := OpenAuditLog(location, headers, m.Logger)
+	if err != nil {
+		return err
+	}
+	if m.audit != nil {
+		_ = m.audit.Close(context.Background())
+	}
+	m.audit = audit
+	return nil
+}
+
+// AuditLog returns the audit log opened by LoadConfig for providers made outside of the app, nil without one.
+func (m *App) AuditLog() *AuditLog {
+	return m.audit
+}
+
+// validateAuditLog checks an S3 audit log names its bucket.
+func (c AppConfig) validateAuditLog() error {
+	if !strings.HasPrefix(c.AuditLog, S3Prefix) {
+		return nil
+	}
+	if u, err := url.Parse(c.AuditLog); err != nil {
+		return fieldErr("auditLog", fmt.Errorf("invalid auditLog: %w", err))
+	} else if u.Host == "" {
+		return fieldErr("auditLog", errors.New("auditLog is missing an S3 bucket"))
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package dca_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+// tickingClock advances a millisecond every time it's read.
+type tickingClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *tickingClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(time.Millisecond)
+	return c.now
+}
+
+// nonces vary between runs so they're blanked before comparing to the golden files.
+var auditNonce = regexp.MustCompile(`"nonce":"\d+"`)
+
+func TestAuditLog_Golden(t *testing.T) {
+	tt := []struct {
+		name     string
+		addOrder string
+		records  int64
+	}{
+		{"success", addOrderResponse, 4},
+		{"insufficient_funds", `{"error":["EOrder:Insufficient funds"]}`, 3},
+	}
+	for _, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {tc.addOrder},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+
+		dir := t.TempDir()
+		auditPath := filepath.Join(dir, "audit.jsonl")
+		configPath := filepath.Join(dir, "config.json")
+		if err := os.WriteFile(configPath, []byte(`{
+			"krakenApiKey": "key",
+			"krakenPrivateKey": "c2VjcmV0",
+			"krakenBaseUrl": "`+s.URL+`",
+			"orderAmountInCents": 500,
+			"skipClockSkewCheck": true,
+			"auditLog": "`+auditPath+`"
+		}`), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		app := dca.NewApp()
+		app.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+		n := &recordingNotifier{}
+		app.Notifiers = []dca.Notifier{n}
+		if err := app.LoadConfig(context.Background(), configPath); err != nil {
+			t.Fatal(err)
+		}
+		clock := &tickingClock{now: time.Date(2024, 3, 1, 2, 0, 0, 0, time.UTC)}
+		app.AuditLog().Now = clock.Now
+
+		_ = app.Run(context.Background())
+		if err := app.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := (dca.AuditStats{Records: tc.records}), n.summaries[0].Audit; got == nil || *got != want {
+			t.Errorf("%s: want %+v got %+v", tc.name, want, got)
+		}
+
+		b, err := os.ReadFile(auditPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := auditNonce.ReplaceAll(b, []byte(`"nonce":"0"`))
+		// credentials are never recorded
+		for _, secret := range [][]byte{[]byte("API-Key"), []byte("API-Sign"), []byte(`"key"`)} {
+			if bytes.Contains(got, secret) {
+				t.Errorf("%s: want no %s got %s", tc.name, secret, got)
+			}
+		}
+
+		golden := filepath.Join("testdata", "audit", tc.name+".jsonl")
+		if *update {
+			if err = os.WriteFile(golden, got, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(want) != string(got) {
+			t.Errorf("%s: want %q got %q", golden, want, got)
+		}
+	}
+}
+
+func TestAuditLog_GzipError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		// the warning isn't taken as the error class
+		_, _ = io.WriteString(gz, `{"error":["WGeneral:Notice","EQuery:Unknown asset pair"]}`)
+		_ = gz.Close()
+	}))
+	t.Cleanup(s.Close)
+
+	sink := &memoryAuditSink{}
+	audit := dca.NewAuditLog(sink, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	provider := dca.NewKrakenProvider(&dca.KrakenProviderConfig{
+		Logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		BaseURL:  s.URL,
+		ReadOnly: true,
+		Audit:    audit,
+	})
+	if err := provider.CheckPair(context.Background(), "XBTUSD"); !errors.Is(err, dca.ErrUnsupportedPair) {
+		t.Errorf("want %v got %v", dca.ErrUnsupportedPair, err)
+	}
+	if err := audit.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `"errorClass":"EQuery:Unknown asset pair"`; !bytes.Contains(sink.Bytes(), []byte(want)) {
+		t.Errorf("want %s got %s", want, sink.Bytes())
+	}
+}
+
+func TestAuditLog_Drops(t *testing.T) {
+	// the sink blocks until released so the queue fills up
+	release := make(chan struct{})
+	sink := &memoryAuditSink{block: release}
+	audit := dca.NewAuditLog(sink, 2, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 10 {
+			audit.Record(dca.AuditRecord{Provider: "kraken", Endpoint: "/0/public/Time"})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("recording blocked on a stalled sink")
+	}
+
+	stats := audit.Stats()
+	if want, got := int64(10), stats.Records+stats.Dropped; got != want {
+		t.Errorf("want %v records and drops got %+v", want, stats)
+	}
+	// the writer holds at most one record and the queue two
+	if stats.Dropped < 7 {
+		t.Errorf("want at least 7 dropped got %+v", stats)
+	}
+
+	close(release)
+	if err := audit.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := stats.Records, int64(bytes.Count(sink.Bytes(), []byte("\n"))); got != want {
+		t.Errorf("want %v written got %v", want, got)
+	}
+	// closed logs drop records
+	audit.Record(dca.AuditRecord{})
+	if want, got := stats.Dropped+1, audit.Stats().Dropped; got != want {
+		t.Errorf("want %v dropped got %v", want, got)
+	}
+}
+
+// memoryAuditSink keeps appended records in memory, waiting for block to be closed before the first append.
+type memoryAuditSink struct {
+	block <-chan struct{}
+	mu    sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (s *memoryAuditSink) Append(_ context.Context, lines []byte) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf.Write(lines)
+	return nil
+}
+
+func (s *memoryAuditSink) Close(context.Context) error { return nil }
+
+func (s *memoryAuditSink) Bytes() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return bytes.Clone(s.buf.Bytes())
+}
@@ -1,13 +1,19 @@
 package dca
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
-
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/ssm"
 )
 
 const (
@@ -35,7 +41,7 @@ func HasAWSParamStoreEncryptedPrefix(key string) bool {
 }
 
 // StripAWSParamStorePrefix removes the AWS Parameter Store prefix from the key if it exists
-// Returns the key without the prefix
+// Returns the key without the prefix, including any region it names, see ParseAWSParamStoreKey for the parameter name
 func StripAWSParamStorePrefix(key string) string {
 	if strings.HasPrefix(key, ParamStoreEncryptedPrefix) {
 		return strings.TrimPrefix(key, ParamStoreEncryptedPrefix)
@@ -46,10 +52,78 @@ func StripAWSParamStorePrefix(key string) string {
 	return key
 }
 
+// awsRegionPattern matches AWS region names such as us-east-1, eu-central-2 or us-gov-west-1.
+var awsRegionPattern = regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]?)?-[a-z]+-\d+$`)
+
+// ParseAWSParamStoreKey splits an AWS Parameter Store key into the region it names and the parameter name. The
+// region is either the first segment of the key, awsssm://us-east-1/path/to/param naming /path/to/param in
+// us-east-1, or a query suffix, awsssm:///path/to/param?region=us-east-1. The suffix wins and leaves the rest of the
+// key as the name, so it also reaches names whose first segment looks like a region. A key with a leading slash,
+// awsssm:///us-east-1/param, or a single segment never names a region. The region is empty when the key doesn't name
+// one, the default AWS configuration's region is used then.
+func ParseAWSParamStoreKey(key string) (region, name string, err error) {
+	name = StripAWSParamStorePrefix(key)
+
+	if i := strings.IndexByte(name, '?'); i >= 0 {
+		query, err := url.ParseQuery(name[i+1:])
+		if err != nil {
+			return "", "", fmt.Errorf("invalid query of AWS Param Store key %s: %w", key, err)
+		}
+		region = query.Get("region")
+		if len(query) != 1 || !awsRegionPattern.MatchString(region) {
+			return "", "", fmt.Errorf("AWS Param Store key %s must only have a valid region in its query", key)
+		}
+		return region, name[:i], nil
+	}
+
+	if first, rest, ok := strings.Cut(name, "/"); ok && rest != "" && awsRegionPattern.MatchString(first) {
+		return first, "/" + rest, nil
+	}
+	return "", name, nil
+}
+
+// AWSBackend is what the AWS integrations need of the AWS SDK, so the dca package doesn't link it. It's registered by
+// importing github.com/1gm/dca/aws, every AWS integration fails with ErrNoAWSSupport in builds without it.
+type AWSBackend interface {
+	// GetParameter reads the parameter name in region, the default AWS configuration's region when empty. Missing
+	// and throttled parameters fail with ErrParameterNotFound and ErrParameterThrottled, and a parameter without a
+	// value returns an empty value.
+	GetParameter(ctx context.Context, region, name string, decrypt bool) ([]byte, error)
+	// PutParameter writes the parameter name in region, as a SecureString when encrypt is set.
+	PutParameter(ctx context.Context, region, name string, value []byte, encrypt bool) error
+	// S3Region returns the region of the default AWS configuration, S3 objects are addressed in it.
+	S3Region(ctx context.Context) (string, error)
+	// SignS3 signs req, whose payload hashes to payloadHash, for S3 in region with the default AWS credentials.
+	SignS3(ctx context.Context, req *http.Request, payloadHash, region string) error
+}
+
+var awsBackend struct {
+	mu      sync.Mutex
+	backend AWSBackend
+}
+
+// RegisterAWSBackend sets the backend of the AWS integrations, a nil backend leaves the build without AWS support.
+func RegisterAWSBackend(backend AWSBackend) {
+	awsBackend.mu.Lock()
+	defer awsBackend.mu.Unlock()
+	awsBackend.backend = backend
+}
+
+// registeredAWSBackend returns the registered backend, or ErrNoAWSSupport naming use, the reference which needed it.
+func registeredAWSBackend(use string) (AWSBackend, error) {
+	awsBackend.mu.Lock()
+	defer awsBackend.mu.Unlock()
+	if awsBackend.backend == nil {
+		return nil, fmt.Errorf("%w: %s needs a build importing github.com/1gm/dca/aws, e.g. without the noaws tag", ErrNoAWSSupport, use)
+	}
+	return awsBackend.backend, nil
+}
+
 // GetAWSParamStoreValue retrieves a value, plaintext or encrypted, from AWS Parameter Store based
-// on the prefix.
+// on the prefix. Missing and throttled parameters fail with ErrParameterNotFound and ErrParameterThrottled, and a
+// parameter without a value returns an empty value.
 func GetAWSParamStoreValue(ctx context.Context, key string) (_ []byte, err error) {
-	defer AddErr(&err, "dca.GetAWSParamStoreValue")
+	defer WrapErr(&err, "dca.GetAWSParamStoreValue")
 	if HasAWSParamStorePlaintextPrefix(key) {
 		return getAWSParamStoreParameter(ctx, key, false)
 	} else if HasAWSParamStoreEncryptedPrefix(key) {
@@ -64,21 +138,100 @@ func getAWSParamStoreParameter(bgCtx context.Context, key string, encrypted bool
 	ctx, cancel := context.WithTimeout(bgCtx, time.Second*5)
 	defer cancel()
 
-	cfg, err := config.LoadDefaultConfig(ctx)
+	region, name, err := ParseAWSParamStoreKey(key)
 	if err != nil {
-		return nil, fmt.Errorf("error loading AWS configuration: %w", err)
+		return nil, err
 	}
+	backend, err := registeredAWSBackend(key)
+	if err != nil {
+		return nil, err
+	}
+	return backend.GetParameter(ctx, region, name, encrypted)
+}
 
-	ssmClient := ssm.NewFromConfig(cfg)
+// errS3NotFound is returned by s3Request when the object or bucket doesn't exist.
+var errS3NotFound = errors.New("not found")
 
-	strippedKey := StripAWSParamStorePrefix(key)
+// S3Location is an S3 bucket and how requests to it are sent, the S3 stores and archives embed it.
+type S3Location struct {
+	Bucket string
+	// Endpoint overrides the virtual-hosted S3 endpoint of the bucket's region, objects are then addressed by path.
+	Endpoint string
+	// ExtraHeaders are added to every request after it's signed.
+	ExtraHeaders map[string]string
+	// HTTPClient sends the requests instead of a client with ExtraHeaders, e.g. the app's shared client.
+	HTTPClient *http.Client
+}
 
-	out, err := ssmClient.GetParameter(ctx, &ssm.GetParameterInput{
-		Name:           &strippedKey,
-		WithDecryption: &encrypted,
-	})
+// object addresses the object key of the bucket, the bucket itself when key is empty.
+func (l S3Location) object(key string) s3Object {
+	return s3Object{S3Location: l, Key: key}
+}
+
+// s3Object addresses an object of an S3 bucket.
+type s3Object struct {
+	S3Location
+	// Key of the object, the bucket itself when empty.
+	Key string
+}
+
+// s3Request sends a request for obj signed with the default AWS credentials and returns the response body.
+func s3Request(ctx context.Context, obj s3Object, method string, b []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(withHTTPComponent(ctx, HTTPComponentS3), 10*time.Second)
+	defer cancel()
+
+	backend, err := registeredAWSBackend(S3Prefix + obj.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	region, err := backend.S3Region(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	u := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", obj.Bucket, region, obj.Key)
+	if obj.Endpoint != "" {
+		u = strings.TrimSuffix(obj.Endpoint, "/") + "/" + obj.Bucket + "/" + obj.Key
+	}
+
+	var body io.Reader
+	if b != nil {
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	if b != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	sum := sha256.Sum256(b)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if err = backend.SignS3(ctx, req, payloadHash, region); err != nil {
+		return nil, err
+	}
+
+	client := obj.HTTPClient
+	if client == nil {
+		client = NewHTTPClient(HTTPClientConfig{ExtraHeaders: obj.ExtraHeaders})
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := readResponseBody(res, maxDrainBytes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve parameter from ssm: %v", err)
+		return nil, err
+	} else if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("s3 returned %s: %w", res.Status, errS3NotFound)
+	} else if res.StatusCode/100 != 2 {
+		// HEAD responses have no body to explain the status
+		if msg := strings.TrimSpace(string(resBody)); msg != "" {
+			return nil, fmt.Errorf("s3 returned %s: %s", res.Status, msg)
+		}
+		return nil, fmt.Errorf("s3 returned %s", res.Status)
 	}
-	return []byte(*out.Parameter.Value), nil
+	return resBody, nil
 }
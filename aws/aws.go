@@ -0,0 +1,164 @@
+// Package aws provides the AWS integrations of the dca package, the AWS param store and S3. Importing it registers
+// them:
+//
+//	import _ "github.com/1gm/dca/aws"
+//
+// Builds which don't import it leave the AWS SDK out, awsssm:// and s3:// references then fail with
+// dca.ErrNoAWSSupport.
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1gm/dca"
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+func init() {
+	dca.RegisterAWSBackend(Backend{})
+}
+
+// Backend is the dca.AWSBackend of the AWS SDK, registered when the package is imported.
+type Backend struct{}
+
+func (Backend) GetParameter(ctx context.Context, region, name string, decrypt bool) ([]byte, error) {
+	client, err := newSSMClient(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           &name,
+		WithDecryption: &decrypt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve parameter from ssm: %w", ssmError(err))
+	}
+	if out.Parameter == nil || out.Parameter.Value == nil {
+		return []byte{}, nil
+	}
+	return []byte(*out.Parameter.Value), nil
+}
+
+func (Backend) PutParameter(ctx context.Context, region, name string, value []byte, encrypt bool) error {
+	// writes aren't part of SSMAPI
+	cfg, err := loadAWSConfig(ctx, region)
+	if err != nil {
+		return err
+	}
+	client := ssm.NewFromConfig(cfg)
+	v, overwrite, kind := string(value), true, ssmtypes.ParameterTypeString
+	if encrypt {
+		kind = ssmtypes.ParameterTypeSecureString
+	}
+	if _, err = client.PutParameter(ctx, &ssm.PutParameterInput{Name: &name, Value: &v, Overwrite: &overwrite, Type: kind}); err != nil {
+		return fmt.Errorf("failed to put parameter to ssm: %w", err)
+	}
+	return nil
+}
+
+func (Backend) S3Region(ctx context.Context) (string, error) {
+	cfg, err := loadAWSConfig(ctx, "")
+	if err != nil {
+		return "", err
+	}
+	return cfg.Region, nil
+}
+
+func (Backend) SignS3(ctx context.Context, req *http.Request, payloadHash, region string) error {
+	cfg, err := loadAWSConfig(ctx, "")
+	if err != nil {
+		return err
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+	if err = v4.NewSigner().SignHTTP(ctx, creds, req, payloadHash, "s3", region, time.Now()); err != nil {
+		return fmt.Errorf("failed to sign request: %w", err)
+	}
+	return nil
+}
+
+// SSMAPI is the part of the AWS SSM client parameters are read with.
+type SSMAPI interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+	GetParameters(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error)
+	GetParametersByPath(ctx context.Context, params *ssm.GetParametersByPathInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error)
+}
+
+var ssmClient struct {
+	mu  sync.Mutex
+	api SSMAPI
+	// regions are the clients made from the default AWS configuration by region, the configuration's own region
+	// under the empty key.
+	regions map[string]SSMAPI
+}
+
+// SetSSMClient replaces the client parameters are read with, in every region, e.g. with a fake in tests. A nil
+// client restores the default, a client per region made from the default AWS configuration.
+func SetSSMClient(client SSMAPI) {
+	ssmClient.mu.Lock()
+	defer ssmClient.mu.Unlock()
+	ssmClient.api = client
+}
+
+// newSSMClient returns the client set by SetSSMClient, or the client of region made from the default AWS
+// configuration, its own region when region is empty. Clients are made once per region.
+func newSSMClient(ctx context.Context, region string) (SSMAPI, error) {
+	ssmClient.mu.Lock()
+	defer ssmClient.mu.Unlock()
+	if ssmClient.api != nil {
+		return ssmClient.api, nil
+	}
+	if client, ok := ssmClient.regions[region]; ok {
+		return client, nil
+	}
+
+	cfg, err := loadAWSConfig(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	client := ssm.NewFromConfig(cfg)
+	if ssmClient.regions == nil {
+		ssmClient.regions = map[string]SSMAPI{}
+	}
+	ssmClient.regions[region] = client
+	return client, nil
+}
+
+// loadAWSConfig loads the default AWS configuration, with its region replaced by region when it isn't empty.
+func loadAWSConfig(ctx context.Context, region string) (awssdk.Config, error) {
+	var opts []func(*config.LoadOptions) error
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return awssdk.Config{}, fmt.Errorf("error loading AWS configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// ssmError maps the errors of SSM calls to dca.ErrParameterNotFound and dca.ErrParameterThrottled.
+func ssmError(err error) error {
+	var notFound *ssmtypes.ParameterNotFound
+	var coded interface{ ErrorCode() string }
+	switch {
+	case errors.As(err, &notFound):
+		return fmt.Errorf("%w: %v", dca.ErrParameterNotFound, err)
+	case errors.As(err, &coded) && strings.Contains(coded.ErrorCode(), "Throttl"):
+		return fmt.Errorf("%w: %v", dca.ErrParameterThrottled, err)
+	}
+	return err
+}
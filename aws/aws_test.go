@@ -0,0 +1,90 @@
+package aws_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/1gm/dca"
+	dcaaws "github.com/1gm/dca/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// fakeSSM serves GetParameter from parameters, recording whether each read asked for decryption.
+type fakeSSM struct {
+	dcaaws.SSMAPI
+	parameters map[string]*string
+	err        error
+	decrypted  []bool
+}
+
+func (f *fakeSSM) GetParameter(_ context.Context, in *ssm.GetParameterInput, _ ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	f.decrypted = append(f.decrypted, *in.WithDecryption)
+	if f.err != nil {
+		return nil, f.err
+	}
+	value, ok := f.parameters[*in.Name]
+	if !ok {
+		return nil, &ssmtypes.ParameterNotFound{Message: in.Name}
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssmtypes.Parameter{Name: in.Name, Value: value}}, nil
+}
+
+// throttlingError is an AWS API error as returned when the param store is throttled.
+type throttlingError struct{}
+
+func (throttlingError) Error() string     { return "api error ThrottlingException: Rate exceeded" }
+func (throttlingError) ErrorCode() string { return "ThrottlingException" }
+
+func TestGetAWSParamStoreValue(t *testing.T) {
+	value, empty := "value", ""
+	tt := []struct {
+		key       string
+		err       error
+		expected  string
+		decrypted bool
+		target    error
+	}{
+		{"awsssm://dca/plain", nil, "value", false, nil},
+		{"awsssme://dca/plain", nil, "value", true, nil},
+		{"awsssm://dca/empty", nil, "", false, nil},
+		{"awsssm://dca/nil", nil, "", false, nil},
+		{"awsssm://dca/missing", nil, "", false, dca.ErrParameterNotFound},
+		{"awsssm://dca/plain", throttlingError{}, "", false, dca.ErrParameterThrottled},
+		{"awsssm://dca/plain", errors.New("access denied"), "", false, nil},
+		{"awsssme://us-east-1/dca/regional", nil, "value", true, nil},
+		{"awsssm://us-east-1/dca/regional?region=eu-west-1", nil, "", false, dca.ErrParameterNotFound},
+	}
+	for i, tc := range tt {
+		client := &fakeSSM{parameters: map[string]*string{"dca/plain": &value, "dca/empty": &empty, "dca/nil": nil, "/dca/regional": &value}, err: tc.err}
+		dcaaws.SetSSMClient(client)
+		t.Cleanup(func() { dcaaws.SetSSMClient(nil) })
+
+		got, err := dca.GetAWSParamStoreValue(context.Background(), tc.key)
+		switch {
+		case tc.target != nil && !errors.Is(err, tc.target):
+			t.Errorf("%d: want %v got %v", i, tc.target, err)
+		case tc.target == nil && tc.err != nil && err == nil:
+			t.Errorf("%d: want an error", i)
+		case tc.err == nil && tc.target == nil && err != nil:
+			t.Errorf("%d: unexpected error: %v", i, err)
+		}
+		if want := tc.expected; string(got) != want {
+			t.Errorf("%d: want %q got %q", i, want, got)
+		}
+		if want, got := []bool{tc.decrypted}, client.decrypted; len(got) != 1 || got[0] != want[0] {
+			t.Errorf("%d: want decrypted %v got %v", i, want, got)
+		}
+	}
+
+	// keys without a prefix never reach the param store
+	client := &fakeSSM{}
+	dcaaws.SetSSMClient(client)
+	if _, err := dca.GetAWSParamStoreValue(context.Background(), "dca/plain"); err == nil {
+		t.Error("want an error for a key without a prefix")
+	}
+	if len(client.decrypted) != 0 {
+		t.Errorf("want no reads got %v", len(client.decrypted))
+	}
+}
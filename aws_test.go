@@ -1,8 +1,17 @@
 package dca_test
 
 import (
-	"github.com/1gm/dca"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/1gm/dca"
+	// registers the AWS backend the S3 integrations are tested with
+	dcaaws "github.com/1gm/dca/aws"
 )
 
 func TestHasAWSParamStorePrefix(t *testing.T) {
@@ -68,3 +77,96 @@ func TestStripAWSParamStorePrefix(t *testing.T) {
 		}
 	}
 }
+
+func TestParseAWSParamStoreKey(t *testing.T) {
+	tt := []struct {
+		key    string
+		region string
+		name   string
+		err    bool
+	}{
+		{"awsssm:///dca/config", "", "/dca/config", false},
+		{"awsssm://dca/config", "", "dca/config", false},
+		{"awsssme://us-east-1/dca/config", "us-east-1", "/dca/config", false},
+		{"awsssm://us-gov-west-1/dca/config", "us-gov-west-1", "/dca/config", false},
+		{"awsssm://eu-central-2/config", "eu-central-2", "/config", false},
+		// a leading slash or a single segment never names a region
+		{"awsssm:///us-east-1/config", "", "/us-east-1/config", false},
+		{"awsssm://us-east-1", "", "us-east-1", false},
+		{"awsssm://us-east-1/", "", "us-east-1/", false},
+		// segments that only look like regions
+		{"awsssm://us-east/config", "", "us-east/config", false},
+		{"awsssm://US-EAST-1/config", "", "US-EAST-1/config", false},
+		{"awsssm://us-east-1a/config", "", "us-east-1a/config", false},
+		{"awsssm:///dca/config?region=ap-southeast-2", "ap-southeast-2", "/dca/config", false},
+		// the query wins and keeps a region-like first segment in the name
+		{"awsssm://us-east-1/config?region=eu-west-1", "eu-west-1", "us-east-1/config", false},
+		{"awsssm://flat?region=eu-west-1", "eu-west-1", "flat", false},
+		{"awsssm:///dca/config?region=", "", "", true},
+		{"awsssm:///dca/config?region=nowhere", "", "", true},
+		{"awsssm:///dca/config?region=eu-west-1&version=2", "", "", true},
+		{"awsssm:///dca/config?%zz", "", "", true},
+	}
+	for i, tc := range tt {
+		region, name, err := dca.ParseAWSParamStoreKey(tc.key)
+		if want, got := tc.err, err != nil; got != want {
+			t.Errorf("%d: want error %v got %v", i, want, err)
+			continue
+		}
+		if want, got := tc.region, region; got != want {
+			t.Errorf("%d: want %q got %q", i, want, got)
+		}
+		if want, got := tc.name, name; got != want {
+			t.Errorf("%d: want %q got %q", i, want, got)
+		}
+	}
+}
+
+func TestAWSBackend_NotRegistered(t *testing.T) {
+	dca.RegisterAWSBackend(nil)
+	t.Cleanup(func() { dca.RegisterAWSBackend(dcaaws.Backend{}) })
+
+	if _, err := dca.GetAWSParamStoreValue(context.Background(), "awsssm://dca/config"); !errors.Is(err, dca.ErrNoAWSSupport) {
+		t.Errorf("want %v got %v", dca.ErrNoAWSSupport, err)
+	}
+
+	archive := &dca.S3FailureArchive{S3Location: dca.S3Location{Bucket: "bucket"}}
+	if err := archive.Check(context.Background()); !errors.Is(err, dca.ErrNoAWSSupport) {
+		t.Errorf("want %v got %v", dca.ErrNoAWSSupport, err)
+	}
+
+	// a config referencing the param store says why it can't be read
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"krakenApiKey": "awsssm://dca/key", "krakenPrivateKey": "secret", "orderAmountInCents": 500}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	app := dca.NewApp()
+	if err := app.LoadConfig(context.Background(), path); err == nil || !strings.Contains(err.Error(), "built without AWS support") {
+		t.Errorf("want an error built without AWS support got %v", err)
+	}
+}
+
+// TestImportBoundary makes sure the AWS SDK is only linked by builds which import the aws package.
+func TestImportBoundary(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("the go command isn't available")
+	}
+
+	tt := []struct {
+		args []string
+	}{
+		{[]string{"github.com/1gm/dca"}},
+		{[]string{"-tags", "noaws", "github.com/1gm/dca/cmd/cli"}},
+	}
+	for i, tc := range tt {
+		out, err := exec.Command("go", append([]string{"list", "-deps"}, tc.args...)...).Output()
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		for _, pkg := range strings.Fields(string(out)) {
+			if strings.HasPrefix(pkg, "github.com/aws/") {
+				t.Errorf("%d: want no AWS packages got %s", i, pkg)
+			}
+		}
+	}
+}
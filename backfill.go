@@ -0,0 +1,199 @@
+package dca
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// KrakenTrade is a trade returned by the TradesHistory endpoint.
+type KrakenTrade struct {
+	ID        string
+	OrderTxID string
+	Pair      string
+	Time      time.Time
+	Type      string
+	OrderType string
+	Price     float64
+	Cost      float64
+	Fee       float64
+	Volume    float64
+}
+
+// krakenTrade is a trade as returned by the TradesHistory endpoint.
+type krakenTrade struct {
+	OrderTxID string  `json:"ordertxid"`
+	Pair      string  `json:"pair"`
+	Time      float64 `json:"time"`
+	Type      string  `json:"type"`
+	OrderType string  `json:"ordertype"`
+	Price     string  `json:"price"`
+	Cost      string  `json:"cost"`
+	Fee       string  `json:"fee"`
+	Vol       string  `json:"vol"`
+}
+
+// FetchTrades returns a page of the trades made since the given time, newest first, starting at offset. count is the
+// total number of trades matching the query across every page.
+func (p *KrakenProvider) FetchTrades(ctx context.Context, since time.Time, offset int) (trades []KrakenTrade, count int, err error) {
+	defer WrapErr(&err, "KrakenProvider.FetchTrades")
+
+	var result struct {
+		Trades map[string]krakenTrade `json:"trades"`
+		Count  int                    `json:"count"`
+	}
+	if err = p.privateRequest(ctx, "/0/private/TradesHistory", url.Values{
+		"type":  {"all"},
+		"start": {strconv.FormatInt(since.Unix(), 10)},
+		"ofs":   {strconv.Itoa(offset)},
+	}, &result); err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch trades history: %w", err)
+	}
+
+	for id, t := range result.Trades {
+		trade := KrakenTrade{
+			ID:        id,
+			OrderTxID: t.OrderTxID,
+			Pair:      t.Pair,
+			Time:      time.Unix(0, int64(t.Time*float64(time.Second))).UTC(),
+			Type:      t.Type,
+			OrderType: t.OrderType,
+		}
+		for _, f := range []struct {
+			name  string
+			value string
+			dst   *float64
+		}{
+			{"price", t.Price, &trade.Price},
+			{"cost", t.Cost, &trade.Cost},
+			{"fee", t.Fee, &trade.Fee},
+			{"volume", t.Vol, &trade.Volume},
+		} {
+			if *f.dst, err = strconv.ParseFloat(f.value, 64); err != nil {
+				return nil, 0, fmt.Errorf("failed to parse %s of trade %s: %w", f.name, id, err)
+			}
+		}
+		trades = append(trades, trade)
+	}
+
+	sort.Slice(trades, func(i, j int) bool { return trades[i].Time.After(trades[j].Time) })
+	return trades, result.Count, nil
+}
+
+// BackfillResult describes the trades imported by App.Backfill.
+type BackfillResult struct {
+	Pages    int `json:"pages"`
+	Trades   int `json:"trades"`
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+}
+
+// Backfill imports the buys of the configured pair made since the given time into the order store, one record per
+// trade marked as imported. Trades already imported and trades of orders recorded by a run are skipped so an
+// interrupted backfill can be run again. Records are written as every page is fetched.
+func (m *App) Backfill(ctx context.Context, since time.Time) (res BackfillResult, err error) {
+	defer WrapErr(&err, "App.Backfill")
+
+	if m.Config.OrderStorePath == "" {
+		return res, errors.New("orderStorePath is required to backfill orders")
+	}
+	store := m.fileOrderStore()
+
+	pair := m.Config.Pair
+	if pair == "" {
+		pair = KrakenDefaultPair
+	}
+	info, ok := krakenPairs[pair]
+	if !ok {
+		return res, fmt.Errorf("%w: %s", ErrUnsupportedPair, pair)
+	}
+
+	// TradesHistory is one of the most expensive private calls so the backfill always waits out the call counter.
+	// Nothing is ordered so the provider is read-only.
+	provider := NewKrakenProvider(&KrakenProviderConfig{
+		APIKey:           m.Config.KrakenAPIKey,
+		APISecret:        m.Config.KrakenPrivateKey,
+		Logger:           m.Logger,
+		BaseURL:          m.Config.KrakenBaseURL,
+		MaxResponseBytes: m.Config.KrakenMaxResponseBytes,
+		Tier:             m.Config.KrakenTier,
+		RateLimitWait:    true,
+		ReadOnly:         true,
+		HTTPClient:       m.httpClient(),
+	})
+
+	records, err := store.List(ctx)
+	if err != nil {
+		return res, err
+	}
+	imported := map[string]bool{}
+	recorded := map[string]bool{}
+	for _, rec := range records {
+		if rec.Imported {
+			imported[rec.TradeID] = true
+		} else {
+			recorded[rec.Order.TransactionID] = true
+		}
+	}
+
+	for offset, count := 0, 1; offset < count; {
+		var trades []KrakenTrade
+		if trades, count, err = provider.FetchTrades(ctx, since, offset); err != nil {
+			return res, err
+		} else if len(trades) == 0 {
+			break
+		}
+		offset += len(trades)
+		res.Pages++
+		res.Trades += len(trades)
+
+		var pageImported int
+		for _, t := range trades {
+			if t.Type != SideBuy || t.Pair != info.ResultKey {
+				continue
+			} else if imported[t.ID] || recorded[t.OrderTxID] {
+				res.Skipped++
+				continue
+			}
+
+			if err = store.Put(ctx, t.record(pair).In(m.Config.Location())); err != nil {
+				return res, err
+			}
+			imported[t.ID] = true
+			pageImported++
+		}
+		res.Imported += pageImported
+
+		m.Logger.InfoContext(ctx, "backfilled page", "page", res.Pages, "offset", offset, "count", count, "imported", pageImported, "skipped", res.Skipped)
+	}
+
+	return res, nil
+}
+
+// record converts a trade into an imported order record of pair.
+func (t KrakenTrade) record(pair string) OrderRecord {
+	return OrderRecord{
+		Time:     t.Time,
+		Imported: true,
+		TradeID:  t.ID,
+		Order: ExecuteOrderResponse{
+			AmountInCents:   int(math.Round(t.Cost * 100)),
+			Pair:            pair,
+			Side:            t.Type,
+			TransactionID:   t.OrderTxID,
+			AdditionalInfo:  fmt.Sprintf("imported trade %s", t.ID),
+			OrderType:       t.OrderType,
+			Status:          "closed",
+			RequestedVolume: t.Volume,
+			VolumePurchased: t.Volume,
+			Cost:            t.Cost,
+			Fee:             t.Fee,
+			Price:           t.Price,
+		},
+	}
+}
@@ -0,0 +1,120 @@
+package dca_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+const (
+	tradesPage1 = `{"error":[],"result":{"count":4,"trades":{
+		"T-4":{"ordertxid":"O-4","pair":"XXBTZUSD","time":1714600000.5,"type":"buy","ordertype":"market","price":"60000.0","cost":"25.00","fee":"0.10","vol":"0.00041667"},
+		"T-3":{"ordertxid":"O-3","pair":"XXBTZUSD","time":1714500000,"type":"sell","ordertype":"market","price":"59000.0","cost":"59.00","fee":"0.24","vol":"0.001"}}}}`
+	tradesPage2 = `{"error":[],"result":{"count":4,"trades":{
+		"T-2":{"ordertxid":"O-2","pair":"XETHZUSD","time":1714400000,"type":"buy","ordertype":"market","price":"3000.0","cost":"25.00","fee":"0.10","vol":"0.00833333"},
+		"T-1":{"ordertxid":"O-1","pair":"XXBTZUSD","time":1714300000,"type":"buy","ordertype":"limit","price":"58000.0","cost":"25.00","fee":"0.04","vol":"0.00043103"}}}}`
+)
+
+func TestApp_Backfill(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/private/TradesHistory": {tradesPage1, tradesPage2, tradesPage1, tradesPage2},
+	})
+	storePath := filepath.Join(t.TempDir(), "orders.jsonl")
+	app, _ := newTestApp(s, dca.AppConfig{OrderStorePath: storePath})
+
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	res, err := app.Backfill(context.Background(), since)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the sell and the ETH buy are filtered out
+	if want, got := (dca.BackfillResult{Pages: 2, Trades: 4, Imported: 2}), res; got != want {
+		t.Errorf("want %+v got %+v", want, got)
+	}
+
+	requests := s.Requests("/0/private/TradesHistory")
+	for i, ofs := range []string{"0", "2"} {
+		if want, got := ofs, requests[i].Get("ofs"); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := "1704067200", requests[i].Get("start"); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+
+	records, err := dca.NewFileOrderStore(storePath).List(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, got := 2, len(records); got != want {
+		t.Fatalf("want %v got %v", want, got)
+	}
+	rec := records[0]
+	if !rec.Imported {
+		t.Errorf("want imported record")
+	}
+	if want, got := "T-4", rec.TradeID; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := "O-4", rec.Order.TransactionID; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := 2500, rec.Order.AmountInCents; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := time.Unix(1714600000, 5e8), rec.Time; !got.Equal(want) {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	// running again imports nothing
+	if res, err = app.Backfill(context.Background(), since); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, got := (dca.BackfillResult{Pages: 2, Trades: 4, Skipped: 2}), res; got != want {
+		t.Errorf("want %+v got %+v", want, got)
+	}
+}
+
+func TestApp_Backfill_Resume(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/private/TradesHistory": {tradesPage1, `{"error":["EAPI:Rate limit exceeded"]}`, tradesPage1, tradesPage2},
+	})
+	storePath := filepath.Join(t.TempDir(), "orders.jsonl")
+	store := dca.NewFileOrderStore(storePath)
+
+	// O-1 was placed and recorded by a run so its trade isn't imported
+	if err := store.Put(context.Background(), dca.OrderRecord{Time: time.Unix(1714300000, 0), Order: dca.ExecuteOrderResponse{TransactionID: "O-1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	app, _ := newTestApp(s, dca.AppConfig{OrderStorePath: storePath})
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	res, err := app.Backfill(context.Background(), since)
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	// the first page is kept
+	if want, got := 1, res.Imported; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	if res, err = app.Backfill(context.Background(), since); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, got := (dca.BackfillResult{Pages: 2, Trades: 4, Skipped: 2}), res; got != want {
+		t.Errorf("want %+v got %+v", want, got)
+	}
+
+	records, err := store.List(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, got := 2, len(records); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
@@ -0,0 +1,225 @@
+package dca
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultBacktestFeeRate is the Kraken spot taker fee of the lowest volume tier.
+const DefaultBacktestFeeRate = 0.004
+
+// PricePoint is the price of an asset at a point in time.
+type PricePoint struct {
+	Time  time.Time `json:"time"`
+	Price float64   `json:"price"`
+}
+
+// BacktestConfig describes a DCA schedule to simulate.
+type BacktestConfig struct {
+	// Order is the order placed by every scheduled run
+	Order ExecuteOrderRequest
+	// Start is the time of the first scheduled run
+	Start time.Time
+	// End is the time after which no runs are scheduled, defaults to the last price
+	End time.Time
+	// Interval between scheduled runs
+	Interval time.Duration
+	// FeeRate is the fraction of the order amount charged as a fee
+	FeeRate float64
+}
+
+// BacktestResult is the outcome of a simulated DCA schedule.
+type BacktestResult struct {
+	Purchases     int     `json:"purchases"`
+	TotalInvested float64 `json:"totalInvested"`
+	TotalFees     float64 `json:"totalFees"`
+	Volume        float64 `json:"volume"`
+	AverageCost   float64 `json:"averageCost"`
+	FinalPrice    float64 `json:"finalPrice"`
+	FinalValue    float64 `json:"finalValue"`
+}
+
+// Backtest simulates buying cfg.Order at every scheduled run between cfg.Start and cfg.End using the most recent
+// price at or before each run. prices doesn't need to be sorted.
+func Backtest(prices []PricePoint, cfg BacktestConfig) (res BacktestResult, err error) {
+	defer WrapErr(&err, "dca.Backtest")
+
+	if len(prices) == 0 {
+		return res, errors.New("no prices to backtest against")
+	} else if cfg.Interval <= 0 {
+		return res, errors.New("interval must be greater than zero")
+	} else if cfg.Order.AmountInCents <= 0 {
+		return res, errors.New("amount must be greater than zero")
+	}
+
+	prices = append([]PricePoint(nil), prices...)
+	sort.Slice(prices, func(i, j int) bool { return prices[i].Time.Before(prices[j].Time) })
+
+	end := cfg.End
+	if end.IsZero() || end.After(prices[len(prices)-1].Time) {
+		end = prices[len(prices)-1].Time
+	}
+	if cfg.Start.Before(prices[0].Time) {
+		return res, fmt.Errorf("start %s is before the first price at %s", cfg.Start.Format(time.RFC3339), prices[0].Time.Format(time.RFC3339))
+	}
+
+	i := 0
+	for t := cfg.Start; !t.After(end); t = t.Add(cfg.Interval) {
+		for i+1 < len(prices) && !prices[i+1].Time.After(t) {
+			i++
+		}
+
+		price := prices[i].Price
+		if price <= 0 {
+			return res, fmt.Errorf("invalid price %v at %s", price, prices[i].Time.Format(time.RFC3339))
+		}
+
+		amount := float64(cfg.Order.AmountInCents) / 100
+		fee := amount * cfg.FeeRate
+
+		res.Purchases++
+		res.Volume += volumeForAmount(cfg.Order.AmountInCents, price)
+		res.TotalFees += fee
+		res.TotalInvested += amount + fee
+	}
+
+	res.FinalPrice = prices[len(prices)-1].Price
+	res.FinalValue = res.Volume * res.FinalPrice
+	if res.Volume > 0 {
+		res.AverageCost = res.TotalInvested / res.Volume
+	}
+
+	return res, nil
+}
+
+// ReadPriceCSV reads prices from CSV records of a time and a price. Times may be RFC 3339 timestamps, dates
+// (2006-01-02) or unix seconds, a header row is skipped.
+func ReadPriceCSV(r io.Reader) (prices []PricePoint, err error) {
+	defer WrapErr(&err, "dca.ReadPriceCSV")
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		} else if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected a time and a price", line)
+		}
+
+		t, terr := parsePriceTime(record[0])
+		price, perr := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if line == 1 && (terr != nil || perr != nil) {
+			continue
+		} else if terr != nil {
+			return nil, fmt.Errorf("line %d: %w", line, terr)
+		} else if perr != nil {
+			return nil, fmt.Errorf("line %d: failed to parse price: %w", line, perr)
+		}
+
+		prices = append(prices, PricePoint{Time: t, Price: price})
+	}
+
+	return prices, nil
+}
+
+func parsePriceTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	} else if t, err = time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	} else if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("failed to parse time %q", s)
+}
+
+// krakenOHLCLimit is the number of candles the OHLC endpoint returns at most, older candles are unavailable.
+const krakenOHLCLimit = 720
+
+// FetchOHLC fetches the opening price of every candle of pair since the given time from the public OHLC
+// endpoint, interval must be a candle interval supported by Kraken. Kraken only serves the most recent 720
+// candles so ErrHistoryUnavailable is returned when since is older than the oldest candle.
+func (p *KrakenProvider) FetchOHLC(ctx context.Context, pair string, interval time.Duration, since time.Time) (prices []PricePoint, err error) {
+	defer WrapErr(&err, "KrakenProvider.FetchOHLC")
+
+	info, ok := krakenPairs[pair]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedPair, pair)
+	}
+
+	// Page through the candles using the last cursor until no new candles are returned.
+	cursor := since.Unix()
+	for {
+		var result map[string]any
+		if err = p.publicRequest(ctx, "/0/public/OHLC", url.Values{
+			"pair":     {pair},
+			"interval": {strconv.Itoa(int(interval.Minutes()))},
+			"since":    {strconv.FormatInt(cursor, 10)},
+		}, &result); err != nil {
+			return nil, err
+		}
+
+		candles, _ := result[info.ResultKey].([]any)
+		if len(prices) == 0 && len(candles) > 0 {
+			if first, err := parseOHLCCandle(candles[0]); err == nil && first.Time.After(since.Add(interval)) {
+				return nil, fmt.Errorf("%w: Kraken only provides the most recent %d candles, the oldest is from %s", ErrHistoryUnavailable, krakenOHLCLimit, first.Time.Format(time.DateOnly))
+			}
+		}
+
+		added := 0
+		for _, c := range candles {
+			var point PricePoint
+			if point, err = parseOHLCCandle(c); err != nil {
+				return nil, err
+			} else if len(prices) > 0 && !point.Time.After(prices[len(prices)-1].Time) {
+				continue
+			}
+			prices = append(prices, point)
+			added++
+		}
+
+		last, _ := result["last"].(float64)
+		if added == 0 || int64(last) <= cursor {
+			break
+		}
+		cursor = int64(last)
+	}
+
+	return prices, nil
+}
+
+func parseOHLCCandle(v any) (PricePoint, error) {
+	candle, ok := v.([]any)
+	if !ok || len(candle) < 2 {
+		return PricePoint{}, fmt.Errorf("invalid candle %v", v)
+	}
+
+	sec, ok := candle[0].(float64)
+	if !ok {
+		return PricePoint{}, fmt.Errorf("invalid candle time %v", candle[0])
+	}
+	open, ok := candle[1].(string)
+	if !ok {
+		return PricePoint{}, fmt.Errorf("invalid candle open %v", candle[1])
+	}
+
+	price, err := strconv.ParseFloat(open, 64)
+	if err != nil {
+		return PricePoint{}, fmt.Errorf("failed to parse candle open: %w", err)
+	}
+	return PricePoint{Time: time.Unix(int64(sec), 0).UTC(), Price: price}, nil
+}
@@ -0,0 +1,147 @@
+package dca_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestBacktest(t *testing.T) {
+	prices := []dca.PricePoint{
+		{Time: date("2024-01-03"), Price: 40000},
+		{Time: date("2024-01-01"), Price: 50000},
+		{Time: date("2024-01-02"), Price: 25000},
+	}
+
+	res, err := dca.Backtest(prices, dca.BacktestConfig{
+		Order:    dca.ExecuteOrderRequest{AmountInCents: 10000},
+		Start:    date("2024-01-01"),
+		Interval: 24 * time.Hour,
+		FeeRate:  0.01,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want, got := 3, res.Purchases; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := 303.0, res.TotalInvested; math.Abs(got-want) > 1e-9 {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := 3.0, res.TotalFees; math.Abs(got-want) > 1e-9 {
+		t.Errorf("want %v got %v", want, got)
+	}
+	// 100/50000 + 100/25000 + 100/40000
+	if want, got := 0.0085, res.Volume; math.Abs(got-want) > 1e-12 {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := 340.0, res.FinalValue; math.Abs(got-want) > 1e-9 {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := 303/0.0085, res.AverageCost; math.Abs(got-want) > 1e-6 {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestBacktest_UsesLatestPriceBeforeRun(t *testing.T) {
+	prices := []dca.PricePoint{
+		{Time: date("2024-01-01"), Price: 10000},
+		{Time: date("2024-01-08"), Price: 20000},
+		{Time: date("2024-01-15"), Price: 20000},
+	}
+
+	// runs on the 1st and the 5th buy at 10000, the 9th and 13th at 20000
+	res, err := dca.Backtest(prices, dca.BacktestConfig{
+		Order:    dca.ExecuteOrderRequest{AmountInCents: 10000},
+		Start:    date("2024-01-01"),
+		End:      date("2024-01-14"),
+		Interval: 96 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, got := 4, res.Purchases; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := 0.03, res.Volume; math.Abs(got-want) > 1e-12 {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestBacktest_StartBeforePrices(t *testing.T) {
+	_, err := dca.Backtest([]dca.PricePoint{{Time: date("2024-01-02"), Price: 1}}, dca.BacktestConfig{
+		Order:    dca.ExecuteOrderRequest{AmountInCents: 100},
+		Start:    date("2024-01-01"),
+		Interval: time.Hour,
+	})
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestReadPriceCSV(t *testing.T) {
+	prices, err := dca.ReadPriceCSV(strings.NewReader("time,price\n2024-01-01,42000.5\n2024-01-02T12:00:00Z,43000\n1704326400,44000\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tt := []dca.PricePoint{
+		{Time: date("2024-01-01"), Price: 42000.5},
+		{Time: date("2024-01-02").Add(12 * time.Hour), Price: 43000},
+		{Time: date("2024-01-04"), Price: 44000},
+	}
+	if want, got := len(tt), len(prices); got != want {
+		t.Fatalf("want %v got %v", want, got)
+	}
+	for i, tc := range tt {
+		if !prices[i].Time.Equal(tc.Time) || prices[i].Price != tc.Price {
+			t.Errorf("%d: want %v got %v", i, tc, prices[i])
+		}
+	}
+
+	if _, err = dca.ReadPriceCSV(strings.NewReader("2024-01-01,1\nnot-a-date,2\n")); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestKrakenProvider_FetchOHLC(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/OHLC": {
+			`{"error":[],"result":{"XXBTZUSD":[[1704067200,"42000.0","0","0","0","0","0",0],[1704153600,"43000.0","0","0","0","0","0",0]],"last":1704153600}}`,
+			`{"error":[],"result":{"XXBTZUSD":[[1704153600,"43000.0","0","0","0","0","0",0]],"last":1704153600}}`,
+		},
+	})
+	p := newTestKrakenProvider(s, dca.KrakenProviderConfig{})
+
+	prices, err := p.FetchOHLC(context.Background(), "XBTUSD", 24*time.Hour, date("2024-01-01"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, got := 2, len(prices); got != want {
+		t.Fatalf("want %v got %v", want, got)
+	}
+	if want, got := 43000.0, prices[1].Price; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := "1440", s.Requests("/0/public/OHLC")[0].Get("interval"); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	if _, err = p.FetchOHLC(context.Background(), "XBTUSD", 24*time.Hour, date("2020-01-01")); !errors.Is(err, dca.ErrHistoryUnavailable) {
+		t.Errorf("want %v got %v", dca.ErrHistoryUnavailable, err)
+	}
+}
@@ -0,0 +1,157 @@
+package dca
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// BudgetConfig paces a monthly budget across the runs left in the month, each run spends what's left of the budget
+// divided by the runs left, so the money of a skipped run is spread over the later runs instead of lost.
+type BudgetConfig struct {
+	// MonthlyAmountInCents is the amount to spend every calendar month of the reporting time zone.
+	MonthlyAmountInCents int `json:"monthlyAmountInCents" desc:"The amount to spend every calendar month in the reporting time zone in cents" schema:"required"`
+	// RunsPerMonth is how many runs are scheduled a month, they're assumed to be spread evenly across the month.
+	RunsPerMonth int `json:"runsPerMonth" desc:"How many runs are scheduled a month, assumed to be spread evenly, either this or interval is required"`
+	// Interval is the time between scheduled runs, e.g. 24h or 168h, an alternative to RunsPerMonth.
+	Interval string `json:"interval" desc:"The time between scheduled runs, e.g. 24h for daily runs, either this or runsPerMonth is required"`
+}
+
+// Validate checks the configuration is usable.
+func (c BudgetConfig) Validate() error {
+	if c.MonthlyAmountInCents <= 0 {
+		return fieldErr("monthlyAmountInCents", errors.New("budget monthlyAmountInCents must be positive"))
+	} else if c.RunsPerMonth < 0 {
+		return fieldErr("runsPerMonth", errors.New("budget runsPerMonth cannot be negative"))
+	} else if (c.RunsPerMonth > 0) == (c.Interval != "") {
+		return errors.New("budget requires exactly one of runsPerMonth and interval")
+	}
+	if c.Interval != "" {
+		if d, err := time.ParseDuration(c.Interval); err != nil {
+			return fieldErr("interval", fmt.Errorf("invalid budget interval: %w", err))
+		} else if d <= 0 {
+			return fieldErr("interval", errors.New("budget interval must be positive"))
+		}
+	}
+	return nil
+}
+
+// RunsRemaining returns how many runs are left in the month of now, including the run at now.
+func (c BudgetConfig) RunsRemaining(now time.Time) int {
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	end := start.AddDate(0, 1, 0)
+	left := end.Sub(now)
+
+	runs := 1
+	if c.RunsPerMonth > 0 {
+		runs = int(math.Ceil(float64(c.RunsPerMonth) * left.Seconds() / end.Sub(start).Seconds()))
+	} else if interval, err := time.ParseDuration(c.Interval); err == nil && interval > 0 {
+		// the run at now and every later run before the month ends
+		runs = 1 + int((left-1)/interval)
+	}
+	return max(runs, 1)
+}
+
+// BudgetPacing is how a run's amount was paced from the monthly budget.
+type BudgetPacing struct {
+	MonthlyAmountInCents int `json:"monthlyAmountInCents" desc:"The monthly budget in cents" schema:"required"`
+	// SpentInCents is what orders recorded earlier in the month spent.
+	SpentInCents  int `json:"spentInCents" desc:"What orders recorded earlier in the month spent in cents" schema:"required"`
+	RunsRemaining int `json:"runsRemaining" desc:"The runs left in the month including this one" schema:"required"`
+	// AmountInCents is the amount the run orders, the base orderAmountInCents when the spend couldn't be read.
+	AmountInCents int `json:"amountInCents" desc:"The amount the run orders in cents" schema:"required"`
+	// Fallback is set when the spend couldn't be read and the run orders orderAmountInCents.
+	Fallback bool `json:"fallback,omitempty" desc:"Set when the month's spend couldn't be read from the order store and the run orders orderAmountInCents"`
+}
+
+// PaceBudget returns the amount in cents a run at now orders to spend the rest of the monthly budget evenly over the
+// runs left in the month, given what was spent earlier in the month. It's zero once the budget is spent.
+func PaceBudget(cfg BudgetConfig, spentInCents int, now time.Time) int {
+	left := cfg.MonthlyAmountInCents - spentInCents
+	if left <= 0 {
+		return 0
+	}
+	return left / cfg.RunsRemaining(now)
+}
+
+// monthSpend sums what the purchases of pair recorded in the month of now spent in cents. Records store the
+// amount ordered, imported trades only have their cost.
+func monthSpend(records []OrderRecord, pair string, now time.Time) int {
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	end := start.AddDate(0, 1, 0)
+
+	var spent int
+	for _, r := range records {
+		if r.Time.Before(start) || !r.Time.Before(end) || r.Order.Side != SideBuy || cmp.Or(r.Order.Pair, pair) != pair {
+			continue
+		}
+		if r.Order.AmountInCents > 0 {
+			spent += r.Order.AmountInCents
+		} else {
+			spent += int(math.Round(r.Order.Cost * 100))
+		}
+	}
+	return spent
+}
+
+// budgetGuard is the Guard of the monthly budget, evaluated after the pause. It adjusts the amount of the run to the
+// budget paced from the spend recorded in the order store, and skips the run with SkipReasonBudgetSpent once the
+// month's budget is spent. An order store that can't be read is only a warning, the run orders orderAmountInCents
+// instead. The pacing and the warning are added to summary.
+type budgetGuard struct {
+	m       *App
+	summary *RunSummary
+}
+
+func (g budgetGuard) Name() string {
+	return DecisionBudget
+}
+
+func (g budgetGuard) Evaluate(ctx context.Context, in GuardInput) (GuardDecision, error) {
+	m, now, summary := g.m, in.Now, g.summary
+	cfg := *m.Config.Budget
+	pacing := &BudgetPacing{MonthlyAmountInCents: cfg.MonthlyAmountInCents, RunsRemaining: cfg.RunsRemaining(now)}
+	summary.Budget = pacing
+
+	records, err := m.fileOrderStore().List(ctx)
+	if err != nil {
+		m.Logger.WarnContext(ctx, "failed to read the month's spend, ordering the base amount", "error", err,
+			"amountInCents", in.AmountInCents)
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("budget pacing skipped, ordering the base amount: %v", err))
+		pacing.AmountInCents, pacing.Fallback = in.AmountInCents, true
+		return GuardDecision{
+			Action: GuardAllow,
+			Inputs: map[string]string{"monthlyAmount": FormatCents(cfg.MonthlyAmountInCents, ""), "error": err.Error()},
+			Reason: fmt.Sprintf("month's spend unreadable → base amount %s", FormatCents(pacing.AmountInCents, "")),
+		}, nil
+	}
+
+	pacing.SpentInCents = monthSpend(records, cmp.Or(m.Config.Pair, KrakenDefaultPair), now)
+	pacing.AmountInCents = PaceBudget(cfg, pacing.SpentInCents, now)
+	m.Logger.InfoContext(ctx, "paced the monthly budget", "monthlyAmountInCents", pacing.MonthlyAmountInCents,
+		"spentInCents", pacing.SpentInCents, "runsRemaining", pacing.RunsRemaining, "amountInCents", pacing.AmountInCents,
+		"month", now.Format("2006-01"))
+
+	d := GuardDecision{Inputs: map[string]string{
+		"monthlyAmount": FormatCents(pacing.MonthlyAmountInCents, ""),
+		"spent":         FormatCents(pacing.SpentInCents, ""),
+		"runsRemaining": strconv.Itoa(pacing.RunsRemaining),
+	}}
+	if pacing.AmountInCents <= 0 {
+		d.Action, d.SkipReason = GuardSkip, SkipReasonBudgetSpent
+		d.Reason = fmt.Sprintf("spent %s of the monthly budget of %s → skip", d.Inputs["spent"], d.Inputs["monthlyAmount"])
+		return d, nil
+	}
+	runs := "runs"
+	if pacing.RunsRemaining == 1 {
+		runs = "run"
+	}
+	d.Action, d.AmountInCents = GuardAdjust, pacing.AmountInCents
+	d.Reason = fmt.Sprintf("budget remaining %s over %d %s → amount %s",
+		FormatCents(pacing.MonthlyAmountInCents-pacing.SpentInCents, ""), pacing.RunsRemaining, runs, FormatCents(pacing.AmountInCents, ""))
+	return d, nil
+}
@@ -0,0 +1,169 @@
+package dca_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+func TestBudgetConfig_RunsRemaining(t *testing.T) {
+	date := func(day, hour int) time.Time { return time.Date(2024, time.May, day, hour, 0, 0, 0, time.UTC) }
+
+	tt := []struct {
+		cfg  dca.BudgetConfig
+		now  time.Time
+		want int
+	}{
+		{dca.BudgetConfig{RunsPerMonth: 4}, date(1, 0), 4},
+		{dca.BudgetConfig{RunsPerMonth: 4}, date(16, 0), 3},
+		{dca.BudgetConfig{RunsPerMonth: 4}, date(31, 12), 1},
+		{dca.BudgetConfig{Interval: "24h"}, date(1, 0), 31},
+		{dca.BudgetConfig{Interval: "24h"}, date(30, 0), 2},
+		{dca.BudgetConfig{Interval: "24h"}, date(31, 23), 1},
+		// May 1, 8, 15, 22 and 29
+		{dca.BudgetConfig{Interval: "168h"}, date(1, 0), 5},
+		{dca.BudgetConfig{Interval: "168h"}, date(29, 0), 1},
+		// February of a leap year
+		{dca.BudgetConfig{Interval: "24h"}, time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC), 29},
+	}
+	for i, tc := range tt {
+		if want, got := tc.want, tc.cfg.RunsRemaining(tc.now); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestPaceBudget(t *testing.T) {
+	cfg := dca.BudgetConfig{MonthlyAmountInCents: 40000, RunsPerMonth: 4}
+	date := func(day int) time.Time { return time.Date(2024, time.May, day, 12, 0, 0, 0, time.UTC) }
+
+	tt := []struct {
+		spent int
+		now   time.Time
+		want  int
+	}{
+		// the first run of the month
+		{0, date(1), 10000},
+		{10000, date(9), 10000},
+		// a skipped run's money is spread over the runs left
+		{10000, date(16), 15000},
+		// a boost earlier in the month lowers the later runs
+		{25000, date(16), 7500},
+		{30000, date(31), 10000},
+		{40000, date(31), 0},
+		{45000, date(16), 0},
+		// amounts are rounded down to stay within the budget
+		{30001, date(16), 4999},
+	}
+	for i, tc := range tt {
+		if want, got := tc.want, dca.PaceBudget(cfg, tc.spent, tc.now); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestBudgetConfig_Validate(t *testing.T) {
+	tt := []struct {
+		cfg dca.BudgetConfig
+		err string
+	}{
+		{dca.BudgetConfig{MonthlyAmountInCents: 40000, RunsPerMonth: 4}, ""},
+		{dca.BudgetConfig{MonthlyAmountInCents: 40000, Interval: "24h"}, ""},
+		{dca.BudgetConfig{RunsPerMonth: 4}, "budget monthlyAmountInCents must be positive"},
+		{dca.BudgetConfig{MonthlyAmountInCents: 40000}, "budget requires exactly one of runsPerMonth and interval"},
+		{dca.BudgetConfig{MonthlyAmountInCents: 40000, RunsPerMonth: 4, Interval: "24h"}, "budget requires exactly one of runsPerMonth and interval"},
+		{dca.BudgetConfig{MonthlyAmountInCents: 40000, Interval: "-1h"}, "budget interval must be positive"},
+	}
+	for i, tc := range tt {
+		err := tc.cfg.Validate()
+		if tc.err == "" && err != nil {
+			t.Errorf("%d: want no error got %v", i, err)
+		} else if tc.err != "" && (err == nil || err.Error() != tc.err) {
+			t.Errorf("%d: want %q got %v", i, tc.err, err)
+		}
+	}
+}
+
+func TestApp_Run_Budget(t *testing.T) {
+	budget := &dca.BudgetConfig{MonthlyAmountInCents: 40000, Interval: "24h"}
+	now := time.Now().UTC()
+	lastMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).Add(-time.Hour)
+	purchase := func(at time.Time, cents int) dca.OrderRecord {
+		return dca.OrderRecord{Time: at, Order: dca.ExecuteOrderResponse{Pair: "XBTUSD", Side: dca.SideBuy, TransactionID: "OLD", AmountInCents: cents}}
+	}
+
+	tt := []struct {
+		records    []dca.OrderRecord
+		unreadable bool
+		status     dca.RunStatus
+		spent      int
+		amount     int
+		fallback   bool
+		warning    bool
+	}{
+		// last month's orders don't count
+		{[]dca.OrderRecord{purchase(lastMonth, 40000)}, false, dca.RunStatusSuccess, 0, dca.PaceBudget(*budget, 0, now), false, false},
+		{[]dca.OrderRecord{purchase(now.Add(-time.Minute), 1000)}, false, dca.RunStatusSuccess, 1000, dca.PaceBudget(*budget, 1000, now), false, false},
+		{[]dca.OrderRecord{purchase(now.Add(-time.Minute), 40000)}, false, dca.RunStatusSkipped, 40000, 0, false, false},
+		// the base amount is ordered when the spend can't be read
+		{nil, true, dca.RunStatusSuccess, 0, 500, true, true},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		storePath := filepath.Join(t.TempDir(), "orders.jsonl")
+		if tc.unreadable {
+			// a directory can't be read as the store
+			storePath = t.TempDir()
+		}
+		for _, r := range tc.records {
+			if err := dca.NewFileOrderStore(storePath).Put(context.Background(), r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		app, n := newTestApp(s, dca.AppConfig{OrderStorePath: storePath, Budget: budget})
+
+		_ = app.Run(context.Background())
+
+		summary := n.summaries[0]
+		if want, got := tc.status, summary.Status; got != want {
+			t.Errorf("%d: want %v got %v (%s)", i, want, got, summary.Error)
+		}
+		if summary.Budget == nil {
+			t.Fatalf("%d: want budget pacing", i)
+		}
+		if want, got := tc.spent, summary.Budget.SpentInCents; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.amount, summary.Budget.AmountInCents; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.fallback, summary.Budget.Fallback; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.warning, strings.Contains(strings.Join(summary.Warnings, "\n"), "budget pacing skipped"); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if tc.status == dca.RunStatusSkipped {
+			if want, got := dca.SkipReasonBudgetSpent, summary.SkipReason; got != want {
+				t.Errorf("%d: want %v got %v", i, want, got)
+			}
+			continue
+		}
+		if want, got := tc.amount, summary.Order.AmountInCents; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		// the paced amount only applies to the run
+		if want, got := 500, app.Config.OrderAmountInCents; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package dca
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// BuyParams are the parameters of a purchase made with Buy.
+type BuyParams struct {
+	// Executor places the order, e.g. a KrakenProvider, a PaperProvider or a CircuitBreaker wrapping either.
+	Executor OrderExecutor
+	// AmountInCents is the amount to buy, unless the price ladder of Guards selects another.
+	AmountInCents int
+	// Pair is the pair to buy, the executor's pair when empty.
+	Pair string
+	// Label attributes the order to a goal, it's echoed into the response.
+	Label string
+	// Tags are attached to the order and the summary, see ValidateTags.
+	Tags   map[string]string
+	Guards BuyGuards
+	// Logger defaults to discarding logs, slog's default logger is never used.
+	Logger *slog.Logger
+
+	// order is the order of an App run, with the order type and prices of its config, used instead of the fields
+	// above.
+	order *ExecuteOrderRequest
+	// config is the config of an App run, the guards are given it.
+	config AppConfig
+	// beforeOrder runs the steps of an App run between the guards and the order, such as the confirmation and the
+	// idempotency reservation, with the order the guards settled on.
+	beforeOrder func(ctx context.Context, order ExecuteOrderRequest) error
+}
+
+// BuyGuards configures the guards Buy evaluates around the order. The price ladder is evaluated first, then the
+// custom guards in order. The guards of the exchange, such as the trading mode or the price deviation check, are
+// configured on the executor.
+type BuyGuards struct {
+	// PriceLadder selects the amount by the current ask, fetched with Price, instead of AmountInCents.
+	PriceLadder PriceLadder
+	// Price fetches the ticker of a pair for the price ladder and the custom guards, e.g. KrakenProvider.FetchPrice.
+	// It's required by the price ladder, without it the custom guards are given a zero ticker.
+	Price func(ctx context.Context, pair string) (PriceSample, error)
+	// MaxAmountInCents caps the amount selected by the price ladder when positive, e.g. at a budget's paced amount.
+	MaxAmountInCents int
+	// Custom are guards of your own, see Guard.
+	Custom []Guard
+	// History is listed for the history of the custom guards when set, a store that can't be read is a warning.
+	History OrderStore
+	// FailurePolicy is what the purchase does when a guard fails to decide, GuardFailClosed when empty.
+	FailurePolicy GuardFailurePolicy
+	// SlippageAlertPercent adds a warning when the slippage of a market fill exceeds it.
+	SlippageAlertPercent float64
+}
+
+// Buy makes one purchase with the same pipeline App.Run uses to order: the guards, the execution and the warnings of
+// the fill. It's the stable API for embedding the package, nothing is loaded from a config, recorded or notified and
+// no global state such as slog's default logger is touched.
+//
+// The summary has the status of the purchase. As for App.Run, a skipped purchase returns no error, a failed or
+// interrupted one returns the error it failed with. Invalid params return an error before anything is ordered.
+func Buy(ctx context.Context, params BuyParams) (summary RunSummary, err error) {
+	if err = params.validate(); err != nil {
+		return summary, fmt.Errorf("invalid buy params: %w", err)
+	}
+
+	logger := params.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	startedAt := time.Now().UTC()
+	summary = RunSummary{SchemaVersion: SchemaVersion, RunID: newRunID(), StartedAt: startedAt, LocalDate: startedAt.Format(time.DateOnly), Label: params.Label, Tags: params.Tags}
+	summary.CorrelationID = summary.RunID
+	summary.Asset, _ = PairAssets(params.Pair)
+	logger = logger.With("runId", summary.RunID)
+	params.Logger = logger
+
+	decisions := &decisionRecorder{}
+	ctx = withDecisions(ctx, decisions)
+	err = recoverPanic(ctx, logger, "Buy", func() error {
+		_, err := buy(ctx, params, &summary)
+		return err
+	})
+	summary.Decisions = decisions.Decisions()
+
+	var skip *SkipError
+	stopped := err != nil && ctx.Err() != nil && !errors.As(err, &skip)
+	if stopped && !errors.Is(err, ErrInterrupted) {
+		err = fmt.Errorf("%w: %w", ErrInterrupted, err)
+	}
+	return summary, settleRun(ctx, logger, &summary, err, stopped)
+}
+
+// validate checks the params of a purchase made with Buy.
+func (p BuyParams) validate() error {
+	if p.Executor == nil {
+		return errors.New("an executor is required")
+	} else if p.AmountInCents <= 0 && len(p.Guards.PriceLadder) == 0 {
+		return errors.New("amountInCents must be positive")
+	} else if err := p.Guards.PriceLadder.Validate(); err != nil {
+		return err
+	} else if len(p.Guards.PriceLadder) > 0 && p.Guards.Price == nil {
+		return errors.New("a price is required by the price ladder")
+	} else if err := ValidateTags(p.Tags); err != nil {
+		return err
+	} else if err := p.Guards.FailurePolicy.Validate(); err != nil {
+		return err
+	} else if slices.Contains(p.Guards.Custom, nil) {
+		return errors.New("a custom guard is nil")
+	}
+	return nil
+}
+
+// buy runs the guards of params, places the order and adds the order and the warnings of its fill to summary.
+// params.Logger must be set.
+func buy(ctx context.Context, params BuyParams, summary *RunSummary) (res ExecuteOrderResponse, err error) {
+	order := ExecuteOrderRequest{AmountInCents: params.AmountInCents, Pair: params.Pair, Label: params.Label, Tags: params.Tags}
+	if params.order != nil {
+		order = *params.order
+	}
+
+	if err = interrupted(ctx); err != nil {
+		return res, err
+	}
+
+	// the guards are evaluated first so the later steps, such as the confirmation, see the amount they settled on
+	if order.AmountInCents, err = evaluateBuyGuards(ctx, params, order, summary); err != nil {
+		return res, err
+	}
+
+	if params.beforeOrder != nil {
+		if err = params.beforeOrder(ctx, order); err != nil {
+			return res, err
+		}
+	}
+
+	if res, err = params.Executor.ExecuteOrder(ctx, order); err != nil {
+		return res, err
+	}
+
+	params.Logger.Info("order successfully executed", "result", res, "volume", params.config.MoneyFormat().Crypto(res.VolumePurchased, ""),
+		"cost", FormatFiat(res.Cost, ""), "fee", FormatFiat(res.Fee, ""), "price", FormatFiat(res.Price, ""))
+	summary.Order = &res
+	if res.Pair != "" {
+		summary.Asset, _ = PairAssets(res.Pair)
+	}
+	summary.Warnings = append(summary.Warnings, res.Warnings...)
+	if res.SweptFromCents > 0 {
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("order reduced from %s to %s to spend the available balance", FormatCents(res.SweptFromCents, ""), FormatCents(res.AmountInCents, "")))
+	}
+
+	if s, alert := res.Slippage, params.Guards.SlippageAlertPercent; s != nil && alert > 0 && s.Percent > alert {
+		params.Logger.WarnContext(ctx, "slippage exceeded the alert threshold", "slippagePercent", s.Percent, "threshold", alert)
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("slippage of %.3f%% exceeded the %g%% alert threshold", s.Percent, alert))
+	}
+	return res, nil
+}
+
+// evaluateBuyGuards evaluates the price ladder then the custom guards of params on order and returns the amount they
+// settled on. The ticker and the history are fetched once for all of them.
+func evaluateBuyGuards(ctx context.Context, params BuyParams, order ExecuteOrderRequest, summary *RunSummary) (int, error) {
+	guards := params.Guards
+	var list []Guard
+	if len(guards.PriceLadder) > 0 {
+		list = append(list, priceLadderGuard{ladder: guards.PriceLadder, maxInCents: guards.MaxAmountInCents, logger: params.Logger})
+	}
+	if list = append(list, guards.Custom...); len(list) == 0 {
+		return order.AmountInCents, nil
+	}
+
+	in := GuardInput{Now: summary.StartedAt, Pair: cmp.Or(order.Pair, KrakenDefaultPair), AmountInCents: order.AmountInCents, Config: params.config}
+	if guards.Price != nil {
+		sample, err := guards.Price(ctx, in.Pair)
+		if err != nil {
+			if len(guards.PriceLadder) > 0 {
+				recordDecision(ctx, Decision{Name: DecisionPriceLadder, Inputs: map[string]string{"error": err.Error()}, Outcome: DecisionFail,
+					Narration: "the price can't be fetched to select a tier → fail"})
+			}
+			return order.AmountInCents, fmt.Errorf("failed to fetch the price for the guards: %w", err)
+		}
+		in.Ticker = sample
+	}
+	if guards.History != nil && len(guards.Custom) > 0 {
+		records, err := guards.History.List(ctx)
+		if err != nil {
+			params.Logger.WarnContext(ctx, "failed to list orders for the guards", "error", err)
+			summary.Warnings = append(summary.Warnings, fmt.Sprintf("guards evaluated without the order history: %v", err))
+		}
+		in.History = records
+	}
+	return evaluateGuards(ctx, params.Logger, list, in, guards.FailurePolicy, summary)
+}
+
+// settleRun sets the status of summary from err, the error the run ended with, stopped is set when the run was
+// interrupted. It returns the error of the run, nil for a skipped run.
+func settleRun(ctx context.Context, logger *slog.Logger, summary *RunSummary, err error, stopped bool) error {
+	var skip *SkipError
+	switch {
+	case errors.As(err, &skip):
+		logger.WarnContext(ctx, "order skipped", "reason", skip.Reason, "error", err)
+		summary.Status, summary.SkipReason = RunStatusSkipped, skip.Reason
+		return nil
+	case err != nil:
+		summary.Status, summary.Error = RunStatusFailed, err.Error()
+		if stopped {
+			summary.Status = RunStatusInterrupted
+		}
+		return err
+	}
+	summary.Status = RunStatusSuccess
+	return nil
+}
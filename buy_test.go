@@ -0,0 +1,182 @@
+package dca_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/1gm/dca"
+	"github.com/1gm/dca/internal/fakekraken"
+)
+
+// newFakeKrakenProvider returns a provider of the fake Kraken server playing scenario.
+func newFakeKrakenProvider(t *testing.T, scenario string) *dca.KrakenProvider {
+	s := httptest.NewServer(fakekraken.New(fakekraken.Config{APIKey: "key", Secret: []byte("secret")}))
+	t.Cleanup(s.Close)
+	return dca.NewKrakenProvider(&dca.KrakenProviderConfig{
+		APIKey:       "key",
+		APISecret:    "secret",
+		BaseURL:      s.URL,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		ExtraHeaders: map[string]string{fakekraken.ScenarioHeader: scenario},
+	})
+}
+
+func TestBuy(t *testing.T) {
+	tt := []struct {
+		scenario string
+		status   dca.RunStatus
+		err      error
+	}{
+		{fakekraken.ScenarioHappy, dca.RunStatusSuccess, nil},
+		{fakekraken.ScenarioRateLimit, dca.RunStatusFailed, dca.ErrRateLimited},
+	}
+	for i, tc := range tt {
+		p := newFakeKrakenProvider(t, tc.scenario)
+		// Buy logs nowhere without a logger
+		summary, err := dca.Buy(context.Background(), dca.BuyParams{Executor: p, AmountInCents: 500, Pair: "XBTUSD", Label: "retirement", Tags: map[string]string{"household": "A"}})
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("%d: want %v got %v", i, tc.err, err)
+		}
+		if want, got := tc.status, summary.Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if summary.RunID == "" || summary.StartedAt.IsZero() {
+			t.Errorf("%d: want a run ID and start got %+v", i, summary)
+		}
+		if tc.err != nil {
+			if want, got := err.Error(), summary.Error; got != want {
+				t.Errorf("%d: want %v got %v", i, want, got)
+			}
+			continue
+		}
+
+		if summary.Order == nil {
+			t.Fatalf("%d: want an order", i)
+		}
+		if want, got := 0.0001, summary.Order.VolumePurchased; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := "retirement", summary.Order.Label; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := "A", summary.Order.Tags["household"]; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestBuy_Guards(t *testing.T) {
+	tt := []struct {
+		ladder  dca.PriceLadder
+		max     int
+		status  dca.RunStatus
+		amount  int
+		ordered bool
+	}{
+		// the ask of the fake server is 50000
+		{dca.PriceLadder{{MaxPrice: 40000, AmountInCents: 1000}, {AmountInCents: 600}}, 0, dca.RunStatusSuccess, 600, true},
+		{dca.PriceLadder{{MaxPrice: 60000, AmountInCents: 1000}}, 800, dca.RunStatusSuccess, 800, true},
+		// a price above the ladder skips the purchase without ordering
+		{dca.PriceLadder{{MaxPrice: 40000, AmountInCents: 1000}}, 0, dca.RunStatusSkipped, 0, false},
+	}
+	for i, tc := range tt {
+		p := newFakeKrakenProvider(t, fakekraken.ScenarioHappy)
+		executor := &scriptedExecutor{errs: []error{nil}}
+		summary, err := dca.Buy(context.Background(), dca.BuyParams{
+			Executor:      executor,
+			AmountInCents: 500,
+			Guards:        dca.BuyGuards{PriceLadder: tc.ladder, Price: p.FetchPrice, MaxAmountInCents: tc.max},
+		})
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if want, got := tc.status, summary.Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.ordered, executor.calls == 1; got != want {
+			t.Fatalf("%d: want ordered %v got %v", i, want, got)
+		}
+		if tc.ordered {
+			if want, got := tc.amount, summary.Order.AmountInCents; got != want {
+				t.Errorf("%d: want %v got %v", i, want, got)
+			}
+		} else if want, got := dca.SkipReasonPriceAboveLadder, summary.SkipReason; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		// the guard's decision is returned as a run records it
+		if want, got := 1, len(summary.Decisions); got != want || summary.Decisions[0].Name != dca.DecisionPriceLadder {
+			t.Errorf("%d: want the price ladder decision got %+v", i, summary.Decisions)
+		}
+	}
+}
+
+// slippedExecutor fills every order with a slippage of percent.
+type slippedExecutor float64
+
+func (e slippedExecutor) ExecuteOrder(_ context.Context, order dca.ExecuteOrderRequest) (dca.ExecuteOrderResponse, error) {
+	return dca.ExecuteOrderResponse{AmountInCents: order.AmountInCents, Pair: order.Pair, Slippage: &dca.Slippage{Percent: float64(e)}}, nil
+}
+
+func TestBuy_SlippageAlert(t *testing.T) {
+	for i, tc := range []struct {
+		slippage float64
+		warnings int
+	}{{0.5, 0}, {1.5, 1}} {
+		summary, err := dca.Buy(context.Background(), dca.BuyParams{Executor: slippedExecutor(tc.slippage), AmountInCents: 500, Guards: dca.BuyGuards{SlippageAlertPercent: 1}})
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if want, got := tc.warnings, len(summary.Warnings); got != want {
+			t.Errorf("%d: want %v got %v", i, want, summary.Warnings)
+		}
+	}
+}
+
+func TestBuy_Panic(t *testing.T) {
+	summary, err := dca.Buy(context.Background(), dca.BuyParams{Executor: panickingExecutor{}, AmountInCents: 500})
+	if !errors.Is(err, dca.ErrPanic) {
+		t.Errorf("want %v got %v", dca.ErrPanic, err)
+	}
+	if want, got := dca.RunStatusFailed, summary.Status; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestBuy_Interrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	executor := &scriptedExecutor{errs: []error{nil}}
+	summary, err := dca.Buy(ctx, dca.BuyParams{Executor: executor, AmountInCents: 500})
+	if !errors.Is(err, dca.ErrInterrupted) {
+		t.Errorf("want %v got %v", dca.ErrInterrupted, err)
+	}
+	if want, got := dca.RunStatusInterrupted, summary.Status; got != want || executor.calls != 0 {
+		t.Errorf("want %v without ordering got %v after %d orders", want, got, executor.calls)
+	}
+}
+
+func TestBuy_InvalidParams(t *testing.T) {
+	executor := &scriptedExecutor{}
+	tt := []dca.BuyParams{
+		{AmountInCents: 500},
+		{Executor: executor},
+		{Executor: executor, AmountInCents: 500, Guards: dca.BuyGuards{PriceLadder: dca.PriceLadder{{MaxPrice: 40000, AmountInCents: 1000}}}},
+		{Executor: executor, AmountInCents: 500, Guards: dca.BuyGuards{PriceLadder: dca.PriceLadder{{AmountInCents: 1000}, {MaxPrice: 40000, AmountInCents: 1000}}}},
+	}
+	for i, params := range tt {
+		summary, err := dca.Buy(context.Background(), params)
+		if err == nil {
+			t.Errorf("%d: want an error", i)
+		}
+		if want, got := dca.RunStatus(""), summary.Status; got != want {
+			t.Errorf("%d: want no run got %v", i, got)
+		}
+	}
+	if want, got := 0, executor.calls; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
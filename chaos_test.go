@@ -0,0 +1,269 @@
+package dca_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+	"github.com/1gm/dca/internal/fakekraken"
+)
+
+// The tests of this file run App.Run against scripted faults and pin how runs handle them: which failures are
+// retried, what the summary reports and when an order placed by a failed attempt is adopted.
+
+const addOrderPath = "/0/private/AddOrder"
+
+// newChaosApp returns an app ordering on a fake Kraken server failing with faults, with an order store and up to
+// three attempts.
+func newChaosApp(t *testing.T, cfg dca.AppConfig, faults ...fakekraken.Fault) (*dca.App, *recordingNotifier, *fakekraken.Server) {
+	fk := fakekraken.New(fakekraken.Config{APIKey: "key", Secret: []byte("secret"), Faults: faults})
+	s := httptest.NewServer(fk)
+	t.Cleanup(s.Close)
+
+	cfg.KrakenAPIKey, cfg.KrakenPrivateKey, cfg.KrakenBaseURL = "key", "secret", s.URL
+	cfg.OrderAmountInCents = 500
+	if cfg.OrderStorePath == "" {
+		cfg.OrderStorePath = filepath.Join(t.TempDir(), "orders.jsonl")
+	}
+	if cfg.RetryMaxAttempts == 0 {
+		cfg.RetryMaxAttempts, cfg.RetryBackoff = 3, "1ms"
+	}
+
+	n := &recordingNotifier{}
+	app := dca.NewApp()
+	app.Config = cfg
+	app.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	app.Notifiers = []dca.Notifier{n}
+	return app, n, fk
+}
+
+func TestApp_Run_Chaos(t *testing.T) {
+	tt := []struct {
+		faults      []fakekraken.Fault
+		status      dca.RunStatus
+		err         error
+		attempts    int
+		addOrders   int
+		adopted     int
+		recorded    int
+		orderStatus string
+	}{
+		{nil, dca.RunStatusSuccess, nil, 1, 1, 0, 1, "closed"},
+		// transient failures before the order are retried
+		{[]fakekraken.Fault{{Path: addOrderPath, Call: 1, Class: fakekraken.FaultRateLimit}}, dca.RunStatusSuccess, nil, 2, 2, 0, 1, "closed"},
+		{[]fakekraken.Fault{{Path: addOrderPath, Call: 1, Class: fakekraken.FaultServerError}}, dca.RunStatusSuccess, nil, 2, 2, 0, 1, "closed"},
+		{[]fakekraken.Fault{{Path: "/0/public/Ticker", Call: 1, Class: fakekraken.FaultServerError}}, dca.RunStatusSuccess, nil, 2, 1, 0, 1, "closed"},
+		// until the attempts run out
+		{[]fakekraken.Fault{{Path: addOrderPath, Class: fakekraken.FaultUnavailable}}, dca.RunStatusFailed, dca.ErrExchangeUnavailable, 3, 3, 0, 0, ""},
+		// business errors aren't retried
+		{[]fakekraken.Fault{{Path: addOrderPath, Class: fakekraken.FaultInsufficientFunds}}, dca.RunStatusFailed, dca.ErrInsufficientFunds, 1, 1, 0, 0, ""},
+		// the order is placed but its response is lost, the retry adopts it instead of ordering again
+		{[]fakekraken.Fault{{Path: addOrderPath, Call: 1, Class: fakekraken.FaultDisconnect}}, dca.RunStatusSuccess, nil, 2, 1, 1, 1, ""},
+		// the order is placed but its fill can't be queried, the retry adopts it
+		{[]fakekraken.Fault{{Path: "/0/private/QueryOrders", Call: 1, Class: fakekraken.FaultUnavailable}}, dca.RunStatusSuccess, nil, 2, 1, 1, 1, ""},
+		// a slow response is waited for
+		{[]fakekraken.Fault{{Path: addOrderPath, Delay: 50 * time.Millisecond}}, dca.RunStatusSuccess, nil, 1, 1, 0, 1, "closed"},
+		{[]fakekraken.Fault{{Path: addOrderPath, PartialFill: true}}, dca.RunStatusSuccess, nil, 1, 1, 0, 1, "open"},
+	}
+	for i, tc := range tt {
+		app, n, fk := newChaosApp(t, dca.AppConfig{}, tc.faults...)
+		err := app.Run(context.Background())
+		if tc.err == nil && err != nil {
+			t.Errorf("%d: unexpected error: %v", i, err)
+		} else if !errors.Is(err, tc.err) {
+			t.Errorf("%d: want %v got %v", i, tc.err, err)
+		}
+
+		summary := n.summaries[0]
+		if want, got := tc.status, summary.Status; got != want {
+			t.Errorf("%d: want %v got %v (%s)", i, want, got, summary.Error)
+		}
+		if want, got := tc.attempts, len(summary.Attempts); got != want {
+			t.Errorf("%d: want %v attempts got %v", i, want, got)
+		}
+		if want, got := tc.addOrders, fk.Calls(addOrderPath); got != want {
+			t.Errorf("%d: want %v AddOrder calls got %v", i, want, got)
+		}
+		if want, got := tc.adopted, len(summary.Adopted); got != want {
+			t.Errorf("%d: want %v adopted got %v", i, want, got)
+		}
+		var orderStatus string
+		if summary.Order != nil {
+			orderStatus = summary.Order.Status
+		}
+		if want, got := tc.orderStatus, orderStatus; got != want {
+			t.Errorf("%d: want order status %q got %q", i, want, got)
+		}
+
+		records, err := dca.NewFileOrderStore(app.Config.OrderStorePath).List(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := tc.recorded, len(records); got != want {
+			t.Errorf("%d: want %v recorded got %v", i, want, got)
+		}
+	}
+}
+
+func TestApp_Run_Chaos_Unqueryable(t *testing.T) {
+	// The dangerous window: the order is placed, its response is lost and it isn't reported by the order endpoints
+	// yet. The retry reconciles, finds nothing and orders again. Reconciliation only looks for orders placed since
+	// the last recorded one, so the lost order, placed before the retry's, is never adopted: the run bought twice and
+	// the store holds one of the orders.
+	faults := []fakekraken.Fault{{Path: addOrderPath, Call: 1, Class: fakekraken.FaultDisconnect, Unqueryable: 2}}
+	app, n, fk := newChaosApp(t, dca.AppConfig{ReconcileOrders: true}, faults...)
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 2, fk.Calls(addOrderPath); got != want {
+		t.Errorf("want %v AddOrder calls got %v", want, got)
+	}
+	if want, got := 0, len(n.summaries[0].Adopted); got != want {
+		t.Errorf("want %v adopted got %v", want, got)
+	}
+
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 0, len(n.summaries[1].Adopted); got != want {
+		t.Errorf("want %v adopted got %v", want, got)
+	}
+	records, err := dca.NewFileOrderStore(app.Config.OrderStorePath).List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the retry's order and the second run's
+	if want, got := 2, len(records); got != want {
+		t.Errorf("want %v recorded got %v", want, got)
+	}
+
+	// an order placed and answered but not queryable yet fails the run without a retry, the order can't be told
+	// apart from one that was never placed
+	app, n, fk = newChaosApp(t, dca.AppConfig{ReconcileOrders: true}, fakekraken.Fault{Path: addOrderPath, Call: 1, Unqueryable: 1})
+	if err := app.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "EOrder:Unknown order") {
+		t.Errorf("want an unknown order got %v", err)
+	}
+	if want, got := 1, len(n.summaries[0].Attempts); got != want {
+		t.Errorf("want %v attempts got %v", want, got)
+	}
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, len(n.summaries[1].Adopted); got != want {
+		t.Errorf("want %v adopted got %v", want, got)
+	}
+	if want, got := 2, fk.Calls(addOrderPath); got != want {
+		t.Errorf("want %v AddOrder calls got %v", want, got)
+	}
+}
+
+func TestApp_Run_Chaos_CircuitBreaker(t *testing.T) {
+	cfg := dca.AppConfig{RetryMaxAttempts: 1, CircuitBreaker: &dca.CircuitBreakerConfig{Enabled: true, FailureThreshold: 2}}
+	app, n, fk := newChaosApp(t, cfg, fakekraken.Fault{Path: addOrderPath, Class: fakekraken.FaultUnavailable})
+
+	// two failed runs open the circuit, the third is skipped without calling AddOrder
+	for range 3 {
+		_ = app.Run(context.Background())
+	}
+	var got []string
+	for _, summary := range n.summaries {
+		got = append(got, string(summary.Status)+":"+string(summary.SkipReason))
+	}
+	if want := []string{"failed:", "failed:", "skipped:circuit_open"}; !slices.Equal(got, want) {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := 2, fk.Calls(addOrderPath); got != want {
+		t.Errorf("want %v AddOrder calls got %v", want, got)
+	}
+}
+
+func TestApp_Run_PaperFaults(t *testing.T) {
+	tt := []struct {
+		faults   []dca.PaperFault
+		circuit  bool
+		status   dca.RunStatus
+		reason   dca.SkipReason
+		attempts int
+		order    string
+		volume   float64
+	}{
+		{nil, false, dca.RunStatusSuccess, "", 1, "closed", 0.0001},
+		{[]dca.PaperFault{{Call: 1, Err: dca.ErrRateLimited}}, false, dca.RunStatusSuccess, "", 2, "closed", 0.0001},
+		{[]dca.PaperFault{{Err: dca.ErrExchangeUnavailable}}, false, dca.RunStatusFailed, "", 3, "", 0},
+		{[]dca.PaperFault{{Err: dca.ErrInsufficientFunds}}, false, dca.RunStatusFailed, "", 1, "", 0},
+		// a failure opening the circuit skips the retry, the circuit wraps the paper provider rather than Kraken
+		{[]dca.PaperFault{{Err: dca.ErrExchangeUnavailable}}, true, dca.RunStatusSkipped, dca.SkipReasonCircuitOpen, 2, "", 0},
+		{[]dca.PaperFault{{Delay: 50 * time.Millisecond}}, false, dca.RunStatusSuccess, "", 1, "closed", 0.0001},
+		{[]dca.PaperFault{{FillRatio: 0.5}}, false, dca.RunStatusSuccess, "", 1, dca.OrderStatusPartial, 0.00005},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+		})
+		cfg := dca.AppConfig{Provider: dca.ProviderPaper, RetryMaxAttempts: 3, RetryBackoff: "1ms"}
+		if tc.circuit {
+			cfg.CircuitBreaker = &dca.CircuitBreakerConfig{Enabled: true, FailureThreshold: 1}
+		}
+		app, n := newTestApp(s, cfg)
+		app.Executor = newTestPaperProvider(s, dca.PaperProviderConfig{Faults: tc.faults})
+
+		_ = app.Run(context.Background())
+		summary := n.summaries[0]
+		if want, got := tc.status, summary.Status; got != want {
+			t.Errorf("%d: want %v got %v (%s)", i, want, got, summary.Error)
+		}
+		if want, got := tc.reason, summary.SkipReason; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.attempts, len(summary.Attempts); got != want {
+			t.Errorf("%d: want %v attempts got %v", i, want, got)
+		}
+
+		var order string
+		var volume float64
+		if summary.Order != nil {
+			order, volume = summary.Order.Status, summary.Order.VolumePurchased
+		}
+		if want, got := tc.order, order; got != want {
+			t.Errorf("%d: want order status %q got %q", i, want, got)
+		}
+		if !approx(tc.volume, volume) {
+			t.Errorf("%d: want volume %v got %v", i, tc.volume, volume)
+		}
+		// nothing reaches the private endpoints of paper runs
+		if want, got := 0, len(s.Requests(addOrderPath)); got != want {
+			t.Errorf("%d: want %v AddOrder calls got %v", i, want, got)
+		}
+	}
+}
+
+func TestPaperProvider_ExecuteOrder_Faults(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{"/0/public/Ticker": {tickerResponse}})
+	p := newTestPaperProvider(s, dca.PaperProviderConfig{Faults: []dca.PaperFault{
+		{Call: 2, Err: dca.ErrRateLimited},
+		{Call: 3, Delay: time.Second},
+	}})
+
+	if _, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500}); !errors.Is(err, dca.ErrRateLimited) {
+		t.Errorf("want %v got %v", dca.ErrRateLimited, err)
+	}
+
+	// the delay honors the context
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.ExecuteOrder(ctx, dca.ExecuteOrderRequest{AmountInCents: 500}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want %v got %v", context.DeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,212 @@
+package dca
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// OrderExecutor places orders, KrakenProvider is an OrderExecutor.
+type OrderExecutor interface {
+	ExecuteOrder(ctx context.Context, order ExecuteOrderRequest) (ExecuteOrderResponse, error)
+}
+
+// Circuit breaker defaults.
+const (
+	DefaultCircuitFailureThreshold = 3
+	DefaultCircuitOpenDuration     = 15 * time.Minute
+)
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState string
+
+const (
+	// CircuitClosed lets every order through.
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen rejects every order until the open duration has passed.
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a single probe order through, its outcome closes or re-opens the circuit.
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// CircuitBreakerConfig configures the circuit breaker placed around each provider.
+type CircuitBreakerConfig struct {
+	Enabled bool `json:"enabled" desc:"Enable the circuit breaker"`
+	// FailureThreshold is the number of consecutive failures that opens the circuit, defaults to
+	// DefaultCircuitFailureThreshold
+	FailureThreshold int `json:"failureThreshold" desc:"The number of consecutive failures that opens the circuit, defaults to 3"`
+	// OpenDuration is how long the circuit stays open before a probe is let through, e.g. 15m, defaults to
+	// DefaultCircuitOpenDuration
+	OpenDuration string `json:"openDuration" desc:"How long the circuit stays open before a probe order is let through, defaults to 15m"`
+}
+
+// Validate checks the configuration is usable.
+func (c CircuitBreakerConfig) Validate() error {
+	if c.FailureThreshold < 0 {
+		return fieldErr("failureThreshold", errors.New("circuitBreaker.failureThreshold cannot be negative"))
+	}
+	if c.OpenDuration != "" {
+		if d, err := time.ParseDuration(c.OpenDuration); err != nil {
+			return fieldErr("openDuration", fmt.Errorf("invalid circuitBreaker.openDuration: %w", err))
+		} else if d <= 0 {
+			return fieldErr("openDuration", errors.New("circuitBreaker.openDuration must be positive"))
+		}
+	}
+	return nil
+}
+
+// CircuitStatus describes a CircuitBreaker.
+type CircuitStatus struct {
+	State CircuitState `json:"state" desc:"The state of the circuit" enum:"closed,open,half_open" schema:"required"`
+	// Failures is the number of consecutive failures.
+	Failures int `json:"failures" desc:"The number of consecutive failed orders" schema:"required"`
+	// OpenedAt is when the circuit last opened.
+	OpenedAt *time.Time `json:"openedAt,omitempty" desc:"When the circuit last opened"`
+}
+
+// CircuitBreaker stops orders from reaching a failing provider. After FailureThreshold consecutive failures the
+// circuit opens and orders are skipped with ErrCircuitOpen for OpenDuration, after which a single probe order is let
+// through to decide whether to close the circuit again. Skipped orders don't count as failures.
+//
+// A CircuitBreaker only has an effect when it outlives a single run, e.g. when an App runs repeatedly in one process.
+type CircuitBreaker struct {
+	Name             string
+	FailureThreshold int
+	OpenDuration     time.Duration
+	Logger           *slog.Logger
+	// Now returns the current time, defaults to time.Now.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker creates a closed circuit breaker from cfg, name identifies the provider in logs.
+func NewCircuitBreaker(name string, cfg CircuitBreakerConfig, logger *slog.Logger) *CircuitBreaker {
+	threshold := cfg.FailureThreshold
+	if threshold == 0 {
+		threshold = DefaultCircuitFailureThreshold
+	}
+
+	openDuration := DefaultCircuitOpenDuration
+	if d, err := time.ParseDuration(cfg.OpenDuration); err == nil && d > 0 {
+		openDuration = d
+	}
+
+	return &CircuitBreaker{
+		Name:             name,
+		FailureThreshold: threshold,
+		OpenDuration:     openDuration,
+		Logger:           logger.With("name", "circuit.breaker", "provider", name),
+		Now:              time.Now,
+		state:            CircuitClosed,
+	}
+}
+
+// Wrap returns an OrderExecutor which places orders with executor while the circuit allows it.
+func (b *CircuitBreaker) Wrap(executor OrderExecutor) OrderExecutor {
+	return &circuitExecutor{breaker: b, executor: executor}
+}
+
+// Status returns the current state of the circuit.
+func (b *CircuitBreaker) Status() CircuitStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := CircuitStatus{State: b.state, Failures: b.failures}
+	if !b.openedAt.IsZero() {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
+
+// allow reports whether an order may be placed, moving an open circuit to half-open once OpenDuration has passed.
+func (b *CircuitBreaker) allow(ctx context.Context) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if b.Now().Sub(b.openedAt) < b.OpenDuration {
+			return false
+		}
+		b.transition(ctx, CircuitHalfOpen)
+		b.probing = true
+		return true
+	case CircuitHalfOpen:
+		// only the first order after opening probes the provider
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record updates the circuit with the outcome of an order.
+func (b *CircuitBreaker) record(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	var skip *SkipError
+	if err == nil || errors.As(err, &skip) {
+		b.failures = 0
+		if b.state != CircuitClosed {
+			b.transition(ctx, CircuitClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.FailureThreshold {
+		b.openedAt = b.Now()
+		b.transition(ctx, CircuitOpen)
+	}
+}
+
+// transition changes the state of the circuit, the caller must hold mu.
+func (b *CircuitBreaker) transition(ctx context.Context, state CircuitState) {
+	b.Logger.WarnContext(ctx, "circuit state changed", "from", b.state, "to", state, "failures", b.failures)
+	b.state = state
+}
+
+// circuitExecutor is an OrderExecutor guarded by a CircuitBreaker.
+type circuitExecutor struct {
+	breaker  *CircuitBreaker
+	executor OrderExecutor
+}
+
+func (e *circuitExecutor) ExecuteOrder(ctx context.Context, order ExecuteOrderRequest) (ExecuteOrderResponse, error) {
+	allowed := e.breaker.allow(ctx)
+	status := e.breaker.Status()
+	d := Decision{Name: DecisionCircuit, Inputs: map[string]string{"state": string(status.State), "failures": strconv.Itoa(status.Failures)}, Outcome: DecisionProceed}
+	switch {
+	case !allowed:
+		d.Outcome, d.Narration = DecisionSkip, fmt.Sprintf("circuit %s after %d failures → skip", status.State, status.Failures)
+	case status.State == CircuitHalfOpen:
+		d.Narration = "circuit half-open → probe with this order"
+	default:
+		d.Narration = fmt.Sprintf("circuit %s → proceed", status.State)
+	}
+	recordDecision(ctx, d)
+
+	if !allowed {
+		return ExecuteOrderResponse{}, ErrCircuitOpen
+	}
+
+	res, err := e.executor.ExecuteOrder(ctx, order)
+	e.breaker.record(ctx, err)
+	return res, err
+}
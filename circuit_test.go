@@ -0,0 +1,125 @@
+package dca_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+// scriptedExecutor returns its errors in order and counts the orders it receives.
+type scriptedExecutor struct {
+	errs  []error
+	calls int
+}
+
+func (e *scriptedExecutor) ExecuteOrder(_ context.Context, order dca.ExecuteOrderRequest) (dca.ExecuteOrderResponse, error) {
+	err := e.errs[e.calls]
+	e.calls++
+	return dca.ExecuteOrderResponse{AmountInCents: order.AmountInCents}, err
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	errFailed := errors.New("exchange unavailable")
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	b := dca.NewCircuitBreaker("kraken", dca.CircuitBreakerConfig{Enabled: true, FailureThreshold: 2, OpenDuration: "10m"}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	b.Now = clock.Now
+
+	executor := &scriptedExecutor{errs: []error{
+		errFailed,
+		dca.ErrDepositPending,
+		errFailed,
+		errFailed,
+		errFailed,
+		nil,
+	}}
+	e := b.Wrap(executor)
+
+	tt := []struct {
+		advance  time.Duration
+		err      error
+		state    dca.CircuitState
+		calls    int
+		failures int
+	}{
+		{0, errFailed, dca.CircuitClosed, 1, 1},
+		// skipped orders aren't failures and reset the count
+		{0, dca.ErrDepositPending, dca.CircuitClosed, 2, 0},
+		{0, errFailed, dca.CircuitClosed, 3, 1},
+		{0, errFailed, dca.CircuitOpen, 4, 2},
+		// while open orders are skipped without reaching the provider
+		{5 * time.Minute, dca.ErrCircuitOpen, dca.CircuitOpen, 4, 2},
+		// a failed probe re-opens the circuit
+		{5 * time.Minute, errFailed, dca.CircuitOpen, 5, 3},
+		{9 * time.Minute, dca.ErrCircuitOpen, dca.CircuitOpen, 5, 3},
+		// a successful probe closes it
+		{time.Minute, nil, dca.CircuitClosed, 6, 0},
+	}
+	for i, tc := range tt {
+		clock.Advance(tc.advance)
+
+		_, err := e.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500})
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%d: want %v got %v", i, tc.err, err)
+		}
+
+		status := b.Status()
+		if want, got := tc.state, status.State; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.failures, status.Failures; got != want {
+			t.Errorf("%d: want %v failures got %v", i, want, got)
+		}
+		if want, got := tc.calls, executor.calls; got != want {
+			t.Errorf("%d: want %v calls got %v", i, want, got)
+		}
+	}
+}
+
+func TestApp_Run_CircuitBreaker(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":       {tickerResponse},
+		"/0/private/AddOrder":    {`{"error":["EService:Unavailable"]}`},
+	})
+
+	app, n := newTestApp(s, dca.AppConfig{CircuitBreaker: &dca.CircuitBreakerConfig{Enabled: true, FailureThreshold: 1}})
+
+	if err := app.Run(context.Background()); err == nil {
+		t.Fatal("expected the first run to fail")
+	}
+	// the breaker is kept by the app so the next run is skipped without placing an order
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want, got := 1, len(s.Requests("/0/private/AddOrder")); got != want {
+		t.Errorf("want %v AddOrder requests got %v", want, got)
+	}
+
+	tt := []struct {
+		status dca.RunStatus
+		reason dca.SkipReason
+		state  dca.CircuitState
+	}{
+		{dca.RunStatusFailed, "", dca.CircuitOpen},
+		{dca.RunStatusSkipped, dca.SkipReasonCircuitOpen, dca.CircuitOpen},
+	}
+	for i, tc := range tt {
+		summary := n.summaries[i]
+		if want, got := tc.status, summary.Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.reason, summary.SkipReason; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if summary.Circuit == nil || summary.Circuit.State != tc.state {
+			t.Errorf("%d: want circuit %v got %+v", i, tc.state, summary.Circuit)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package dca
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultMaxClockSkew is how far the local clock may be from Kraken's before a run fails with ErrClockSkew.
+const DefaultMaxClockSkew = 30 * time.Second
+
+// ClockSkew is how far the local clock was from Kraken's when a run started.
+type ClockSkew struct {
+	LocalTime  time.Time `json:"localTime" desc:"The local time the skew was measured at, in the reporting time zone" schema:"required"`
+	ServerTime time.Time `json:"serverTime" desc:"Kraken's time at localTime, in the reporting time zone" schema:"required"`
+	// Seconds is positive when the local clock is ahead of Kraken's.
+	Seconds float64 `json:"seconds" desc:"How many seconds the local clock is ahead of Kraken's, negative when it's behind" schema:"required"`
+	// Cached is set when the skew was measured by an earlier run of the process.
+	Cached bool `json:"cached,omitempty" desc:"Whether the skew was measured by an earlier run of the process"`
+}
+
+// ClockSkewError occurs when the local clock is further from Kraken's than maxClockSkew. Nonces and schedules assume
+// the clock is roughly right, a skewed clock otherwise shows as confusing nonce and auth failures.
+type ClockSkewError struct {
+	Local, Server time.Time
+	Skew, Max     time.Duration
+}
+
+func (e *ClockSkewError) Error() string {
+	direction := "ahead of"
+	if e.Skew < 0 {
+		direction = "behind"
+	}
+	return fmt.Sprintf("%v: the local clock is %s %s Kraken's, more than maxClockSkew of %s: local time %s, Kraken time %s",
+		ErrClockSkew, e.Skew.Abs().Round(time.Second), direction, e.Max, e.Local.Format(time.RFC3339), e.Server.Format(time.RFC3339))
+}
+
+func (e *ClockSkewError) Unwrap() error {
+	return ErrClockSkew
+}
+
+// checkClock measures how far the local clock is from Kraken's and adds it to summary. It returns a *ClockSkewError
+// when the skew exceeds maxClockSkew. The skew is measured once per process, later runs reuse it. A time that can't be
+// fetched is only a warning in the logs, the private calls fail on their own if the clock is off.
+func (m *App) checkClock(ctx context.Context, summary *RunSummary) error {
+	skew, cached := m.clockOffset(ctx)
+	if !cached && skew == nil {
+		return nil
+	}
+
+	local := time.Now().In(m.Config.Location())
+	server := local.Add(-*skew)
+	summary.Clock = &ClockSkew{LocalTime: local, ServerTime: server, Seconds: skew.Seconds(), Cached: cached}
+	m.Logger.InfoContext(ctx, "measured the clock skew", "skew", skew.String(), "cached", cached)
+
+	// validated by LoadConfig
+	limit := DefaultMaxClockSkew
+	if m.Config.MaxClockSkew != "" {
+		limit, _ = time.ParseDuration(m.Config.MaxClockSkew)
+	}
+	d := Decision{Name: DecisionClockSkew, Inputs: map[string]string{"skew": skew.Round(time.Millisecond).String(), "max": limit.String()}, Outcome: DecisionProceed}
+	if skew.Abs() <= limit {
+		d.Narration = fmt.Sprintf("clock skew %s ≤ max %s → proceed", d.Inputs["skew"], d.Inputs["max"])
+		recordDecision(ctx, d)
+		return nil
+	}
+	d.Outcome, d.Narration = DecisionFail, fmt.Sprintf("clock skew %s > max %s → fail", d.Inputs["skew"], d.Inputs["max"])
+	recordDecision(ctx, d)
+	return &ClockSkewError{Local: local, Server: server, Skew: *skew, Max: limit}
+}
+
+// clockOffset returns how far the local clock is ahead of Kraken's, measured once per process. nil is returned when
+// Kraken's time can't be fetched, cached is set when an earlier run measured it.
+func (m *App) clockOffset(ctx context.Context) (skew *time.Duration, cached bool) {
+	m.clockMu.Lock()
+	defer m.clockMu.Unlock()
+	if m.clockSkew != nil {
+		return m.clockSkew, true
+	}
+
+	provider := m.newKrakenProvider()
+	start := time.Now()
+	server, err := provider.ServerTime(ctx)
+	if err != nil {
+		m.Logger.WarnContext(ctx, "failed to fetch Kraken's time, skipping the clock skew check", "error", err)
+		return nil, false
+	}
+	// the server's time is taken to be halfway through the request
+	elapsed := time.Since(start)
+	offset := start.Add(elapsed / 2).Sub(server)
+	m.clockSkew = &offset
+	return m.clockSkew, false
+}
@@ -0,0 +1,123 @@
+package dca_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+// timeResponse is a response of Kraken's Time endpoint with a clock off from the local one by skew.
+func timeResponse(skew time.Duration) string {
+	return fmt.Sprintf(`{"error":[],"result":{"unixtime":%d,"rfc1123":"unused"}}`, time.Now().Add(skew).Unix())
+}
+
+func TestApp_Run_ClockSkew(t *testing.T) {
+	tt := []struct {
+		server  time.Duration
+		down    bool
+		max     string
+		skip    bool
+		status  dca.RunStatus
+		checked bool
+	}{
+		// Kraken's clock is 5s ahead, so the local clock is behind
+		{5 * time.Second, false, "", false, dca.RunStatusSuccess, true},
+		{-45 * time.Second, false, "", false, dca.RunStatusFailed, true},
+		{-45 * time.Second, false, "1m", false, dca.RunStatusSuccess, true},
+		// the check is skipped, or the time isn't available
+		{-45 * time.Second, false, "", true, dca.RunStatusSuccess, false},
+		{0, true, "", false, dca.RunStatusSuccess, false},
+	}
+	for i, tc := range tt {
+		responses := map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		}
+		if !tc.down {
+			responses["/0/public/Time"] = []string{timeResponse(tc.server)}
+		}
+		s := newKrakenTestServer(t, responses)
+
+		app, n := newTestApp(s, dca.AppConfig{MaxClockSkew: tc.max, SkipClockSkewCheck: tc.skip})
+		err := app.Run(context.Background())
+		summary := n.summaries[0]
+		if want, got := tc.status, summary.Status; got != want {
+			t.Fatalf("%d: want %v got %v: %v", i, want, got, err)
+		}
+		if want, got := tc.skip, len(s.Requests("/0/public/Time")) == 0; got != want {
+			t.Errorf("%d: want skipped %v got %v", i, want, got)
+		}
+		if want, got := tc.checked, summary.Clock != nil; got != want {
+			t.Fatalf("%d: want checked %v got %v", i, want, got)
+		}
+		if !tc.checked {
+			continue
+		}
+		// the server's time has a resolution of a second
+		if want, got := -tc.server.Seconds(), summary.Clock.Seconds; math.Abs(got-want) > 1.5 {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+
+		if tc.status == dca.RunStatusSuccess {
+			continue
+		}
+		var skew *dca.ClockSkewError
+		if !errors.Is(err, dca.ErrClockSkew) || !errors.As(err, &skew) {
+			t.Fatalf("%d: want %v got %v", i, dca.ErrClockSkew, err)
+		}
+		if msg := err.Error(); !strings.Contains(msg, "ahead of Kraken's") || !strings.Contains(msg, "local time") || !strings.Contains(msg, "Kraken time") {
+			t.Errorf("%d: want the times explained got %v", i, msg)
+		}
+		// the run fails before any private call
+		if want, got := 0, len(s.Requests("/0/private/AddOrder")); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestApp_Run_ClockSkew_Cached(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Time":         {timeResponse(2 * time.Second)},
+		"/0/public/Ticker":       {tickerResponse},
+		"/0/private/AddOrder":    {addOrderResponse},
+		"/0/private/QueryOrders": {queryOrdersResponse},
+	})
+
+	// the skew is measured by the first run of the process only
+	app, n := newTestApp(s, dca.AppConfig{})
+	for i := range 2 {
+		if err := app.Run(context.Background()); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if want, got := i == 1, n.summaries[i].Clock.Cached; got != want {
+			t.Errorf("%d: want cached %v got %v", i, want, got)
+		}
+	}
+	if want, got := 1, len(s.Requests("/0/public/Time")); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestAppConfig_Validate_MaxClockSkew(t *testing.T) {
+	for i, tc := range []struct {
+		max string
+		err string
+	}{{"", ""}, {"1m", ""}, {"soon", "invalid maxClockSkew"}, {"-1s", "maxClockSkew must be positive"}} {
+		cfg := dca.AppConfig{KrakenAPIKey: "key", KrakenPrivateKey: "secret", OrderAmountInCents: 500, MaxClockSkew: tc.max}
+		err := cfg.Validate()
+		if tc.err == "" && err != nil {
+			t.Errorf("%d: want no error got %v", i, err)
+		} else if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%d: want %q got %v", i, tc.err, err)
+		}
+	}
+}
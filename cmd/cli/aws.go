@@ -0,0 +1,6 @@
+//go:build !noaws
+
+package main
+
+// The AWS integrations are linked unless the CLI is built with the noaws tag, which leaves the AWS SDK out.
+import _ "github.com/1gm/dca/aws"
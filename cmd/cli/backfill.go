@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+// runBackfill imports historical buys of the configured pair from Kraken's trade history into the order store.
+func runBackfill(ctx context.Context, args []string) int {
+	var (
+		configFiles dca.ConfigFiles
+		since       string
+		asJSON      bool
+	)
+
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	fs.Var(&configFiles, "config", "path to a config file, repeat to merge several in order")
+	fs.StringVar(&since, "since", "", "date of the earliest trade to import, e.g. 2023-01-01 (required)")
+	fs.BoolVar(&asJSON, "json", false, "print the result as JSON")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if len(configFiles) == 0 {
+		configFiles = dca.SplitConfigFiles(os.Getenv("CONFIG_FILE"))
+	}
+
+	if since == "" {
+		return fail("--since is required")
+	}
+	start, err := time.Parse(time.DateOnly, since)
+	if err != nil {
+		return fail("invalid --since: %v", err)
+	}
+
+	app := dca.NewApp()
+	defer app.Close()
+	if err = app.LoadConfig(ctx, configFiles...); err != nil {
+		return fail("failed to load config: %v", err)
+	}
+
+	res, err := app.Backfill(ctx, start)
+	if err != nil {
+		// records are written page by page so whatever was imported is kept and the backfill can be run again
+		return fail("failed to backfill after importing %d trade(s), run it again to resume: %v", res.Imported, err)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(res); err != nil {
+			return fail("failed to encode result: %v", err)
+		}
+		return 0
+	}
+
+	_, _ = fmt.Printf("imported %d trade(s), skipped %d already recorded, from %d trade(s) on %d page(s)\n", res.Imported, res.Skipped, res.Trades, res.Pages)
+	return 0
+}
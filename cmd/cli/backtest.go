@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+// runBacktest simulates the configured DCA schedule against historical prices, only public endpoints are used.
+func runBacktest(ctx context.Context, args []string) int {
+	var (
+		configFile string
+		start      string
+		end        string
+		interval   time.Duration
+		amount     int
+		pair       string
+		feeRate    float64
+		csvFile    string
+		asJSON     bool
+	)
+
+	fs := flag.NewFlagSet("backtest", flag.ContinueOnError)
+	fs.StringVar(&configFile, "config", "", "optional config file to take the order from")
+	fs.StringVar(&start, "start", "", "date of the first scheduled run, e.g. 2024-01-01 (required)")
+	fs.StringVar(&end, "end", "", "date after which no runs are scheduled, defaults to the last price")
+	fs.DurationVar(&interval, "interval", 24*time.Hour, "time between scheduled runs, e.g. 24h or 168h")
+	fs.IntVar(&amount, "amount", 0, "amount in cents bought every run, overrides the config")
+	fs.StringVar(&pair, "pair", "", "pair to buy, overrides the config")
+	fs.Float64Var(&feeRate, "fee-rate", dca.DefaultBacktestFeeRate, "fraction of every purchase charged as a fee")
+	fs.StringVar(&csvFile, "csv", "", "CSV file of time,price records to use instead of Kraken OHLC data")
+	fs.BoolVar(&asJSON, "json", false, "print the result as JSON")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var cfg dca.AppConfig
+	if configFile != "" {
+		app := dca.NewApp()
+		defer app.Close()
+		if err := app.LoadConfig(ctx, configFile); err != nil {
+			return fail("failed to load config: %v", err)
+		}
+		cfg = app.Config
+	}
+	if amount > 0 {
+		cfg.OrderAmountInCents = amount
+	}
+	if pair != "" {
+		cfg.Pair = pair
+	}
+	if cfg.Pair == "" {
+		cfg.Pair = dca.KrakenDefaultPair
+	}
+
+	bt := dca.BacktestConfig{Order: cfg.OrderRequest(), Interval: interval, FeeRate: feeRate}
+
+	var err error
+	if start == "" {
+		return fail("--start is required")
+	} else if bt.Start, err = time.Parse(time.DateOnly, start); err != nil {
+		return fail("invalid --start: %v", err)
+	}
+	if end != "" {
+		if bt.End, err = time.Parse(time.DateOnly, end); err != nil {
+			return fail("invalid --end: %v", err)
+		}
+	}
+
+	var prices []dca.PricePoint
+	if csvFile != "" {
+		f, err := os.Open(csvFile)
+		if err != nil {
+			return fail("failed to open prices: %v", err)
+		}
+		prices, err = dca.ReadPriceCSV(f)
+		_ = f.Close()
+		if err != nil {
+			return fail("failed to read prices: %v", err)
+		}
+	} else {
+		// The provider is only used for public endpoints so no credentials are given to it.
+		provider := dca.NewKrakenProvider(&dca.KrakenProviderConfig{
+			Logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+			ReadOnly: true,
+		})
+		if prices, err = provider.FetchOHLC(ctx, cfg.Pair, candleInterval(interval), bt.Start); err != nil {
+			return fail("failed to fetch prices, use --csv for older periods: %v", err)
+		}
+	}
+
+	res, err := dca.Backtest(prices, bt)
+	if err != nil {
+		return fail("failed to backtest: %v", err)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(res); err != nil {
+			return fail("failed to encode result: %v", err)
+		}
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "purchases\t%d\n", res.Purchases)
+	_, _ = fmt.Fprintf(w, "total invested\t%s\n", dca.FormatFiat(res.TotalInvested, ""))
+	_, _ = fmt.Fprintf(w, "total fees\t%s\n", dca.FormatFiat(res.TotalFees, ""))
+	_, _ = fmt.Fprintf(w, "volume accumulated\t%s\n", cfg.MoneyFormat().Crypto(res.Volume, ""))
+	_, _ = fmt.Fprintf(w, "average cost basis\t%s\n", dca.FormatFiat(res.AverageCost, ""))
+	_, _ = fmt.Fprintf(w, "final price\t%s\n", dca.FormatFiat(res.FinalPrice, ""))
+	_, _ = fmt.Fprintf(w, "final value\t%s\n", dca.FormatFiat(res.FinalValue, ""))
+	_ = w.Flush()
+
+	return 0
+}
+
+// candleInterval picks the largest Kraken candle interval that resolves the schedule interval.
+func candleInterval(interval time.Duration) time.Duration {
+	for _, d := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, 4 * time.Hour, time.Hour, 15 * time.Minute} {
+		if interval >= d && interval%d == 0 {
+			return d
+		}
+	}
+	return time.Minute
+}
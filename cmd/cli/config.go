@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/1gm/dca"
+)
+
+// runConfig prints the effective config, it takes the flags of a run.
+func runConfig(ctx context.Context, args []string) int {
+	app := dca.NewApp()
+	defer app.Close()
+	if err := app.ParseFlagsAndLoadConfig(ctx, args); err != nil {
+		return fail("failed to load config: %v", err)
+	}
+	return printConfig(app)
+}
+
+// printConfig prints the effective config of app as JSON with secrets masked.
+func printConfig(app *dca.App) int {
+	eff, err := app.EffectiveConfig()
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(eff); err != nil {
+		return fail("failed to encode config: %v", err)
+	}
+	return 0
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+// runExport writes account history as CSV, either the ledger from Kraken or the orders recorded to the order store.
+func runExport(ctx context.Context, args []string) int {
+	var (
+		configFiles dca.ConfigFiles
+		ledger      bool
+		orders      bool
+		label       string
+		tags        dca.Tags
+		asset       string
+		since       string
+		until       string
+		types       string
+		output      string
+	)
+
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.Var(&configFiles, "config", "path to a config file, repeat to merge several in order")
+	fs.BoolVar(&ledger, "ledger", false, "export the ledger entries of the account")
+	fs.BoolVar(&orders, "orders", false, "export the orders recorded to the order store, with a column per tag")
+	fs.StringVar(&label, "label", "", "only export orders with this label, overrides the label set by the config")
+	fs.Var(&tags, "tag", "only export orders with this key=value tag, repeat to require several")
+	fs.StringVar(&asset, "asset", "", "only export the orders of this base asset or the ledger entries of this asset, e.g. BTC or ETH")
+	fs.StringVar(&since, "since", "", "date of the earliest entry to export, e.g. 2024-01-01 (required for the ledger)")
+	fs.StringVar(&until, "until", "", "date to export up to, excluded, e.g. 2025-01-01, defaults to now")
+	fs.StringVar(&types, "types", "", "comma separated ledger entry types to export, e.g. trade,deposit,withdrawal,transfer, defaults to all")
+	fs.StringVar(&output, "output", "", "path of the CSV file to write, defaults to stdout")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if len(configFiles) == 0 {
+		configFiles = dca.SplitConfigFiles(os.Getenv("CONFIG_FILE"))
+	}
+
+	if ledger == orders {
+		return fail("one of --ledger or --orders is required")
+	} else if ledger && since == "" {
+		return fail("--since is required")
+	} else if ledger && len(tags) > 0 {
+		return fail("--tag only applies to --orders")
+	} else if ledger && label != "" {
+		return fail("--label only applies to --orders")
+	}
+
+	app := dca.NewApp()
+	defer app.Close()
+	if err := app.LoadConfig(ctx, configFiles...); err != nil {
+		return fail("failed to load config: %v", err)
+	} else if label != "" {
+		app.Config.Label = label
+	}
+	loc := app.Config.Location()
+
+	var (
+		start time.Time
+		err   error
+	)
+	if since != "" {
+		if start, err = time.ParseInLocation(time.DateOnly, since, loc); err != nil {
+			return fail("invalid --since: %v", err)
+		}
+	}
+	end := time.Now()
+	if until != "" {
+		if end, err = time.ParseInLocation(time.DateOnly, until, loc); err != nil {
+			return fail("invalid --until: %v", err)
+		}
+	}
+
+	if orders {
+		return exportOrders(ctx, app, start, end, tags, asset, output)
+	}
+	if until != "" {
+		// Kraken's end is inclusive
+		end = end.Add(-time.Second)
+	}
+
+	var entryTypes []string
+	for _, t := range strings.Split(types, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			entryTypes = append(entryTypes, t)
+		}
+	}
+
+	// Ledger calls are among the most expensive private calls so the export always waits out the call counter.
+	// Nothing is ordered so the provider is read-only.
+	provider := dca.NewKrakenProvider(&dca.KrakenProviderConfig{
+		APIKey:           app.Config.KrakenAPIKey,
+		APISecret:        app.Config.KrakenPrivateKey,
+		Logger:           app.Logger,
+		BaseURL:          app.Config.KrakenBaseURL,
+		MaxResponseBytes: app.Config.KrakenMaxResponseBytes,
+		Tier:             app.Config.KrakenTier,
+		RateLimitWait:    true,
+		ReadOnly:         true,
+		Audit:            app.AuditLog(),
+	})
+
+	entries, err := provider.ListLedger(ctx, start, end, entryTypes)
+	if err != nil {
+		return fail("failed to list ledger: %v", err)
+	}
+	entries = dca.FilterLedgerEntriesByAsset(entries, asset)
+
+	w, closeOutput, err := createOutput(output)
+	if err != nil {
+		return fail("failed to create output: %v", err)
+	}
+	// a file that fails to close may be truncated, e.g. on a full disk
+	if err = errors.Join(dca.WriteLedgerCSV(w, entries, loc, app.Config.MoneyFormat()), closeOutput()); err != nil {
+		return fail("failed to write ledger: %v", err)
+	}
+	if output != "" {
+		_, _ = fmt.Fprintf(os.Stderr, "exported %d ledger entries to %s\n", len(entries), output)
+	}
+	return 0
+}
+
+// exportOrders writes the orders recorded from start up to end, excluded, with every tag of tags as CSV, only those of
+// the base asset asset when it's set. The orders of other labels are left out as by history.
+func exportOrders(ctx context.Context, app *dca.App, start, end time.Time, tags dca.Tags, asset, output string) int {
+	if app.Config.OrderStorePath == "" {
+		return fail("orderStorePath is required to export the orders")
+	}
+	records, err := (&dca.FileOrderStore{Path: app.Config.OrderStorePath, Logger: app.Logger}).List(ctx)
+	if err != nil {
+		return fail("failed to list orders: %v", err)
+	}
+	records = dca.FilterOrderRecordsByAsset(dca.FilterOrderRecordsByTags(dca.FilterOrderRecords(records, app.Config.Label), tags), asset)
+	records = slices.DeleteFunc(records, func(rec dca.OrderRecord) bool { return rec.Time.Before(start) || !rec.Time.Before(end) })
+
+	w, closeOutput, err := createOutput(output)
+	if err != nil {
+		return fail("failed to create output: %v", err)
+	}
+	if err = errors.Join(dca.WriteOrdersCSV(w, records, app.Config.Location(), app.Config.MoneyFormat()), closeOutput()); err != nil {
+		return fail("failed to write orders: %v", err)
+	}
+	if output != "" {
+		_, _ = fmt.Fprintf(os.Stderr, "exported %d orders to %s\n", len(records), output)
+	}
+	return 0
+}
+
+// createOutput creates the file at path, stdout when path is empty. The output is closed with the returned function,
+// which must be called whether writing succeeded or not.
+func createOutput(path string) (io.Writer, func() error, error) {
+	if path == "" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/1gm/dca"
+)
+
+// runHistory lists the orders recorded to the order store with their figures by base asset, and optionally their
+// unrealized profit or loss.
+func runHistory(ctx context.Context, args []string) int {
+	var (
+		configFiles dca.ConfigFiles
+		pnl         bool
+		asJSON      bool
+		label       string
+		tags        dca.Tags
+		asset       string
+	)
+
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	fs.Var(&configFiles, "config", "path to a config file, repeat to merge several in order")
+	fs.BoolVar(&pnl, "pnl", false, "value the held volume at the current bid, also enabled by reportUnrealizedPnL")
+	fs.BoolVar(&asJSON, "json", false, "print the orders and the unrealized P&L as JSON")
+	fs.StringVar(&label, "label", "", "only list orders with this label, overrides the label set by the config")
+	fs.Var(&tags, "tag", "only list orders with this key=value tag, repeat to require several")
+	fs.StringVar(&asset, "asset", "", "only list orders of this base asset, e.g. BTC or ETH")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if len(configFiles) == 0 {
+		configFiles = dca.SplitConfigFiles(os.Getenv("CONFIG_FILE"))
+	}
+
+	app := dca.NewApp()
+	defer app.Close()
+	if err := app.LoadConfig(ctx, configFiles...); err != nil {
+		return fail("failed to load config: %v", err)
+	} else if label != "" {
+		app.Config.Label = label
+	}
+	if app.Config.OrderStorePath == "" {
+		return fail("orderStorePath is required to list the history")
+	}
+
+	records, err := (&dca.FileOrderStore{Path: app.Config.OrderStorePath, Logger: app.Logger}).List(ctx)
+	if err != nil {
+		return fail("failed to list orders: %v", err)
+	}
+	records = dca.FilterOrderRecordsByTags(dca.FilterOrderRecords(records, app.Config.Label), tags)
+	records = dca.FilterOrderRecordsByAsset(records, asset)
+	stats := dca.NewOrderStats(records)
+
+	// the current price comes from the public ticker, no private call is made
+	var unrealized *dca.UnrealizedPnL
+	if pnl || app.Config.ReportUnrealizedPnL {
+		if unrealized, err = app.UnrealizedPnL(ctx, records); err != nil {
+			return fail("failed to value the history: %v", err)
+		}
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(struct {
+			Orders        []dca.OrderRecord  `json:"orders"`
+			Stats         dca.OrderStats     `json:"stats"`
+			UnrealizedPnL *dca.UnrealizedPnL `json:"unrealizedPnl,omitempty"`
+		}{records, stats, unrealized}); err != nil {
+			return fail("failed to encode history: %v", err)
+		}
+		return 0
+	}
+
+	money := app.Config.MoneyFormat()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "DATE\tTXID\tPAIR\tASSET\tSIDE\tVOLUME\tPRICE\tCOST\tFEE\tTAGS")
+	for _, rec := range records {
+		o := rec.Order
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", rec.Time.In(app.Config.Location()).Format("2006-01-02 15:04"), o.TransactionID, o.Pair,
+			rec.BaseAsset(), o.Side, money.Crypto(o.VolumePurchased, ""), dca.FormatFiat(o.Price, ""), dca.FormatFiat(o.Cost, ""), dca.FormatFiat(o.Fee, ""),
+			dca.FormatTags(o.Tags))
+	}
+	_ = w.Flush()
+
+	// the figures of each asset are in its quote currency, only the totals of the same currency are added up
+	if len(stats.Assets) > 0 {
+		_, _ = fmt.Fprintln(os.Stdout)
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "ASSET\tORDERS\tHELD\tCOST\tFEES\tCOST BASIS\tAVERAGE PRICE")
+		for _, a := range stats.Assets {
+			_, _ = fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n", a.Asset, a.Orders, money.Crypto(a.Volume, a.Asset), dca.FormatFiat(a.Cost, a.Currency),
+				dca.FormatFiat(a.Fees, a.Currency), dca.FormatFiat(a.CostBasis, a.Currency), dca.FormatFiat(a.AveragePrice, a.Currency))
+		}
+		for _, total := range stats.Totals {
+			_, _ = fmt.Fprintf(w, "TOTAL\t\t\t%s\t%s\t\t\n", dca.FormatFiat(total.Cost, total.Currency), dca.FormatFiat(total.Fees, total.Currency))
+		}
+		_ = w.Flush()
+	}
+
+	if unrealized != nil {
+		_, _ = fmt.Fprintf(os.Stdout, "\nUnrealized P&L: %s (%+.2f%%) on %s (%s) at %s, cost basis %s\n", dca.FormatFiat(unrealized.Amount, ""), unrealized.Percent,
+			money.Crypto(unrealized.Volume, unrealized.Asset), unrealized.Pair, dca.FormatFiat(unrealized.Price, ""), dca.FormatFiat(unrealized.CostBasis, ""))
+	} else if pnl || app.Config.ReportUnrealizedPnL {
+		_, _ = fmt.Fprintln(os.Stdout, "\nUnrealized P&L: nothing held")
+	}
+	return 0
+}
@@ -2,8 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
+	"syscall"
+	// Embeds the time zone database so reportingTimeZone works on hosts without one
+	_ "time/tzdata"
 
 	"github.com/1gm/dca"
 )
@@ -22,21 +28,95 @@ func main() {
 	os.Exit(realMain(os.Args))
 }
 
-func realMain(args []string) int {
-	// shutdown context
+// commands are the subcommands of the CLI, running without a subcommand places an order.
+var commands = map[string]func(ctx context.Context, args []string) int{
+	"backfill":       runBackfill,
+	"backtest":       runBacktest,
+	"config":         runConfig,
+	"export":         runExport,
+	"history":        runHistory,
+	"open":           runOpen,
+	"prune":          runPrune,
+	"quote":          runQuote,
+	"receipt-key":    runReceiptKey,
+	"schema":         runSchema,
+	"smoke":          runSmoke,
+	"validate":       runValidate,
+	"verify-receipt": runVerifyReceipt,
+	"withdraw-info":  runWithdrawInfo,
+}
+
+// Exit codes besides 1 for a failed run, so a scheduler can tell a crash or an interruption from a failed order.
+const (
+	exitPanic       = 3
+	exitInterrupted = 130
+)
+
+func realMain(args []string) (code int) {
+	defer func() {
+		if r := recover(); r != nil {
+			pe := dca.NewPanicError(r)
+			_, _ = fmt.Fprintf(os.Stderr, "%v\n%s", pe, pe.Stack)
+			code = exitPanic
+		}
+	}()
+
+	// The first signal interrupts the run, which finishes the calls in flight and records what it knows, a second
+	// one exits straight away.
 	ctx, cancel := context.WithCancel(context.Background())
-	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, os.Interrupt, os.Kill)
-	go func() { <-ch; cancel() }()
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ch
+		_, _ = fmt.Fprintln(os.Stderr, "interrupted, shutting down the run, interrupt again to exit immediately")
+		cancel()
+		<-ch
+		os.Exit(exitInterrupted)
+	}()
+
+	if len(args) > 1 {
+		if cmd, ok := commands[args[1]]; ok {
+			return cmd(ctx, args[2:])
+		}
+	}
 
 	app := dca.NewApp()
+	defer app.Close()
 	if err := app.ParseFlagsAndLoadConfig(ctx, args[1:]); err != nil {
 		app.Logger.Error("error parsing flags", "error", err)
 		return 1
-	} else if err = app.Run(ctx); err != nil {
+	} else if app.PrintConfig {
+		return printConfig(app)
+	}
+	// the stack of a failed run is logged at debug level
+	dca.SetErrStackCapture(app.LogLevel() <= slog.LevelDebug)
+	if app.Explain {
+		app.Notifiers = append(app.Notifiers, explainNotifier{})
+	}
+	if err := app.Run(ctx); errors.Is(err, dca.ErrPanic) {
+		app.Logger.Error("run panicked", "error", err)
+		return exitPanic
+	} else if errors.Is(err, dca.ErrInterrupted) {
+		app.Logger.Error("run interrupted", "error", err)
+		return exitInterrupted
+	} else if err != nil {
 		app.Logger.Error("error running main", "error", err)
 		return 1
 	}
 
 	return 0
 }
+
+// explainNotifier prints the decisions of the run for --explain, to stderr since the logs go to stdout.
+type explainNotifier struct{}
+
+func (explainNotifier) Notify(_ context.Context, summary dca.RunSummary) error {
+	_, err := fmt.Fprint(os.Stderr, dca.FormatDecisions(summary.Decisions))
+	return err
+}
+
+// fail prints an error to stderr and returns the exit code for a failed command.
+func fail(format string, args ...any) int {
+	_, _ = fmt.Fprintf(os.Stderr, format+"\n", args...)
+	return 1
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+// runOpen lists the account's open orders and optionally cancels the stale ones placed by the bot.
+func runOpen(ctx context.Context, args []string) int {
+	var (
+		configFiles dca.ConfigFiles
+		cancelStale time.Duration
+		confirm     bool
+		asJSON      bool
+	)
+
+	fs := flag.NewFlagSet("open", flag.ContinueOnError)
+	fs.Var(&configFiles, "config", "path to a config file, repeat to merge several in order")
+	fs.DurationVar(&cancelStale, "cancel-stale", 0, "cancel orders tagged with the bot's userref that have been open longer than this, e.g. 24h")
+	fs.BoolVar(&confirm, "confirm", false, "actually cancel the orders selected by --cancel-stale instead of listing them")
+	fs.BoolVar(&asJSON, "json", false, "print the orders as JSON")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if len(configFiles) == 0 {
+		configFiles = dca.SplitConfigFiles(os.Getenv("CONFIG_FILE"))
+	}
+	if cancelStale < 0 {
+		return fail("--cancel-stale must be positive")
+	} else if confirm && cancelStale == 0 {
+		return fail("--confirm requires --cancel-stale")
+	}
+
+	app := dca.NewApp()
+	defer app.Close()
+	if err := app.LoadConfig(ctx, configFiles...); err != nil {
+		return fail("failed to load config: %v", err)
+	}
+
+	// Only a confirmed cancellation may change the account.
+	provider := dca.NewKrakenProvider(&dca.KrakenProviderConfig{
+		APIKey:           app.Config.KrakenAPIKey,
+		APISecret:        app.Config.KrakenPrivateKey,
+		Logger:           app.Logger,
+		BaseURL:          app.Config.KrakenBaseURL,
+		UserRef:          app.Config.KrakenUserRef,
+		MaxResponseBytes: app.Config.KrakenMaxResponseBytes,
+		Tier:             app.Config.KrakenTier,
+		RateLimitWait:    app.Config.KrakenRateLimitWait,
+		ReadOnly:         !confirm,
+		Audit:            app.AuditLog(),
+	})
+
+	orders, err := provider.ListOpenOrders(ctx)
+	if err != nil {
+		return fail("failed to list open orders: %v", err)
+	}
+
+	now := time.Now()
+	if cancelStale > 0 {
+		orders = dca.StaleOrders(orders, cancelStale, now)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(orders); err != nil {
+			return fail("failed to encode orders: %v", err)
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "TXID\tORDER\tSTATUS\tAGE\tBOT")
+		for _, o := range orders {
+			bot := "no"
+			if o.Tagged {
+				bot = "yes"
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", o.TransactionID, o.Description, o.Status, now.Sub(o.OpenedAt).Round(time.Minute), bot)
+		}
+		_ = w.Flush()
+	}
+
+	if cancelStale == 0 || len(orders) == 0 {
+		return 0
+	} else if !confirm {
+		_, _ = fmt.Fprintf(os.Stderr, "%d stale order(s) would be cancelled, run again with --confirm to cancel them\n", len(orders))
+		return 0
+	}
+
+	var failed int
+	for _, o := range orders {
+		if err = provider.CancelOrder(ctx, o.TransactionID); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+			failed++
+			continue
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "cancelled %s\n", o.TransactionID)
+	}
+	if failed > 0 {
+		return fail("failed to cancel %d of %d stale order(s)", failed, len(orders))
+	}
+	return 0
+}
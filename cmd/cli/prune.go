@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/1gm/dca"
+)
+
+// runPrune prunes the details of old records from the order store according to the retention config.
+func runPrune(ctx context.Context, args []string) int {
+	var (
+		configFiles dca.ConfigFiles
+		dryRun      bool
+		asJSON      bool
+	)
+
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	fs.Var(&configFiles, "config", "path to a config file, repeat to merge several in order")
+	fs.BoolVar(&dryRun, "dry-run", false, "report the records which would be pruned without changing anything")
+	fs.BoolVar(&asJSON, "json", false, "print the result as JSON")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if len(configFiles) == 0 {
+		configFiles = dca.SplitConfigFiles(os.Getenv("CONFIG_FILE"))
+	}
+
+	app := dca.NewApp()
+	defer app.Close()
+	if err := app.LoadConfig(ctx, configFiles...); err != nil {
+		return fail("failed to load config: %v", err)
+	}
+
+	res, err := app.PruneOrders(ctx, dryRun)
+	if err != nil {
+		return fail("failed to prune orders: %v", err)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(res); err != nil {
+			return fail("failed to encode result: %v", err)
+		}
+		return 0
+	}
+
+	verb := "pruned"
+	if dryRun {
+		verb = "would prune"
+	}
+	before := res.Before.In(app.Config.Location()).Format("2006-01-02 15:04")
+	_, _ = fmt.Fprintf(os.Stdout, "%s %d records from before %s, %d kept\n", verb, len(res.TransactionIDs), before, res.Kept)
+	for _, txid := range res.TransactionIDs {
+		_, _ = fmt.Fprintf(os.Stdout, "  %s\n", txid)
+	}
+	if res.Archive != "" {
+		_, _ = fmt.Fprintf(os.Stdout, "archived to %s\n", res.Archive)
+	}
+	return 0
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/1gm/dca"
+)
+
+// runQuote previews the order a run would place now without ordering.
+func runQuote(ctx context.Context, args []string) int {
+	var (
+		configFiles dca.ConfigFiles
+		amount      int
+		private     bool
+		asJSON      bool
+		explain     bool
+	)
+
+	fs := flag.NewFlagSet("quote", flag.ContinueOnError)
+	fs.Var(&configFiles, "config", "path to a config file, repeat to merge several in order")
+	fs.IntVar(&amount, "amount", 0, "quote this amount in cents instead of orderAmountInCents")
+	fs.BoolVar(&private, "private", false, "fetch the account's fee rate and balance with read-only private calls")
+	fs.BoolVar(&asJSON, "json", false, "print the quote as JSON")
+	fs.BoolVar(&explain, "explain", false, "print the decision of every guard evaluated for the quote")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if len(configFiles) == 0 {
+		configFiles = dca.SplitConfigFiles(os.Getenv("CONFIG_FILE"))
+	}
+	if amount < 0 {
+		return fail("--amount must be positive")
+	}
+
+	app := dca.NewApp()
+	defer app.Close()
+	if err := app.LoadConfig(ctx, configFiles...); err != nil {
+		return fail("failed to load config: %v", err)
+	}
+	if amount > 0 {
+		// an explicit amount is quoted as is, not selected by the price ladder
+		app.Config.OrderAmountInCents, app.Config.PriceLadder = amount, nil
+	}
+
+	q, err := app.Quote(ctx, private)
+	if err != nil {
+		return fail("failed to quote: %v", err)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(q); err != nil {
+			return fail("failed to encode quote: %v", err)
+		}
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "pair\t%s %s\n", q.Side, q.Pair)
+	_, _ = fmt.Fprintf(w, "ask / bid\t%s / %s\n", dca.FormatFiat(q.Ask, ""), dca.FormatFiat(q.Bid, ""))
+	_, _ = fmt.Fprintf(w, "spread\t%s (%.3f%%)\n", dca.FormatFiat(q.Spread, ""), q.SpreadPercent)
+	_, _ = fmt.Fprintf(w, "amount\t%s\n", dca.FormatCents(q.AmountInCents, ""))
+	_, _ = fmt.Fprintf(w, "volume\t%s at %s\n", app.Config.MoneyFormat().Crypto(q.Volume, ""), dca.FormatFiat(q.Price, ""))
+	feeSource := "default taker fee"
+	if q.AccountFeeRate {
+		feeSource = "account taker fee"
+	}
+	_, _ = fmt.Fprintf(w, "estimated fee\t%s (%g%% %s)\n", dca.FormatFiat(q.EstimatedFee, ""), q.FeeRate*100, feeSource)
+	if q.Balance != nil {
+		_, _ = fmt.Fprintf(w, "balance\t%s\n", dca.FormatFiat(*q.Balance, ""))
+	}
+	for _, g := range q.Guards {
+		outcome := "ok"
+		if g.Blocked {
+			outcome = "BLOCKED"
+		}
+		if g.Reason != "" {
+			outcome += ": " + g.Reason
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\n", g.Name, outcome)
+	}
+	_ = w.Flush()
+
+	if explain {
+		_, _ = fmt.Fprint(os.Stdout, "\n"+dca.FormatDecisions(q.Decisions))
+	}
+	if q.Blocked {
+		_, _ = fmt.Fprintln(os.Stderr, "a run would not order now")
+	}
+	return 0
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/1gm/dca"
+)
+
+// runReceiptKey prints the public key of the signedReceipts private key, for recipients to verify receipts with.
+func runReceiptKey(ctx context.Context, args []string) int {
+	var (
+		configFiles dca.ConfigFiles
+		asPEM       bool
+	)
+
+	fs := flag.NewFlagSet("receipt-key", flag.ContinueOnError)
+	fs.Var(&configFiles, "config", "path to a config file, repeat to merge several in order")
+	fs.BoolVar(&asPEM, "pem", false, "print the key as a PKIX PEM block instead of base64")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if len(configFiles) == 0 {
+		configFiles = dca.SplitConfigFiles(os.Getenv("CONFIG_FILE"))
+	}
+
+	app := dca.NewApp()
+	defer app.Close()
+	if err := app.LoadConfig(ctx, configFiles...); err != nil {
+		return fail("failed to load config: %v", err)
+	} else if app.Config.SignedReceipts == nil {
+		return fail("signedReceipts isn't configured")
+	}
+
+	key, err := dca.ParseSigningKey(app.Config.SignedReceipts.PrivateKey)
+	if err != nil {
+		return fail("failed to parse the signing key: %v", err)
+	}
+	public := key.Public().(ed25519.PublicKey)
+
+	if !asPEM {
+		_, _ = fmt.Println(base64.StdEncoding.EncodeToString(public))
+		return 0
+	}
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return fail("failed to marshal the public key: %v", err)
+	}
+	_ = pem.Encode(os.Stdout, &pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	return 0
+}
+
+// runVerifyReceipt checks a signed receipt file against a public key and prints its payload.
+func runVerifyReceipt(_ context.Context, args []string) int {
+	var key string
+
+	fs := flag.NewFlagSet("verify-receipt", flag.ContinueOnError)
+	fs.StringVar(&key, "key", "", "the public key receipts are signed with, base64 or a file holding base64 or PEM (required)")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if key == "" || fs.NArg() != 1 {
+		return fail("usage: verify-receipt --key KEY RECEIPT_FILE")
+	}
+
+	public, err := dca.ParsePublicKey(key)
+	if err != nil {
+		b, rerr := os.ReadFile(key)
+		if rerr != nil {
+			return fail("failed to parse the public key: %v", err)
+		}
+		if public, err = dca.ParsePublicKey(string(b)); err != nil {
+			return fail("failed to parse the public key in %s: %v", key, err)
+		}
+	}
+
+	b, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fail("failed to read receipt: %v", err)
+	}
+	payload, err := dca.VerifyReceipt(b, public)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(payload); err != nil {
+		return fail("failed to encode payload: %v", err)
+	}
+	_, _ = fmt.Fprintln(os.Stderr, "the receipt is valid")
+	return 0
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/1gm/dca/schema"
+)
+
+// runSchema prints the JSON Schema of the named documents, or of every document when none are named.
+func runSchema(_ context.Context, args []string) int {
+	if len(args) == 0 {
+		args = schema.Names()
+	}
+
+	for _, name := range args {
+		doc, ok := schema.Lookup(name)
+		if !ok {
+			return fail("unknown schema %q, expected one of %s", name, strings.Join(schema.Names(), ", "))
+		}
+
+		b, err := doc.Generate()
+		if err != nil {
+			return fail("%v", err)
+		}
+		if _, err = os.Stdout.Write(b); err != nil {
+			return fail("failed to write schema: %v", err)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+
+	"github.com/1gm/dca"
+)
+
+// runSmoke checks the config's credentials, network path and signing against Kraken without ordering. The report
+// is printed to stdout as JSON and the exit code is 1 when a step failed, so it can gate a deployment.
+func runSmoke(ctx context.Context, args []string) int {
+	var configFiles dca.ConfigFiles
+
+	fs := flag.NewFlagSet("smoke", flag.ContinueOnError)
+	fs.Var(&configFiles, "config", "path to a config file, repeat to merge several in order")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if len(configFiles) == 0 {
+		configFiles = dca.SplitConfigFiles(os.Getenv("CONFIG_FILE"))
+	}
+
+	app := dca.NewApp()
+	defer app.Close()
+	// stdout is kept for the report
+	app.Logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	if err := app.LoadConfig(ctx, configFiles...); err != nil {
+		return fail("failed to load config: %v", err)
+	}
+
+	report, err := app.Smoke(ctx)
+	if err != nil {
+		return fail("failed to run smoke test: %v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(report); err != nil {
+		return fail("failed to encode report: %v", err)
+	}
+	if !report.Passed {
+		return 1
+	}
+	return 0
+}
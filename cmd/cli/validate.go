@@ -0,0 +1,132 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/1gm/dca"
+)
+
+// runValidate checks a config without placing orders or calling private endpoints, it exits 0 only when the
+// config has no problems.
+func runValidate(ctx context.Context, args []string) int {
+	var (
+		configFiles dca.ConfigFiles
+		profile     string
+		offline     bool
+		file        string
+		asJSON      bool
+	)
+
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.Var(&configFiles, "config", "path to a config file, repeat to merge several in order")
+	fs.StringVar(&profile, "profile", "", "the config profile to apply, overrides the profile set by the config")
+	fs.BoolVar(&offline, "offline", false, "skip resolving secrets and check the pair against the bundled list")
+	fs.StringVar(&file, "file", "", "run only the static checks of a single config document, requires --offline")
+	fs.BoolVar(&asJSON, "json", false, "print the report as JSON")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if file != "" {
+		if !offline {
+			_, _ = fmt.Fprintln(os.Stderr, "--file requires --offline")
+			return 2
+		}
+		return validateFile(file, asJSON)
+	}
+	if len(configFiles) == 0 {
+		configFiles = dca.SplitConfigFiles(os.Getenv("CONFIG_FILE"))
+	}
+
+	app := dca.NewApp()
+	defer app.Close()
+	app.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	app.Profile = profile
+	report := app.Validate(ctx, configFiles, dca.ValidateOptions{Offline: offline})
+
+	code := 0
+	if !report.OK() {
+		code = 1
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return fail("failed to encode report: %v", err)
+		}
+		return code
+	}
+
+	b, err := json.MarshalIndent(report.Config, "", "  ")
+	if err != nil {
+		return fail("failed to encode config: %v", err)
+	}
+	_, _ = fmt.Printf("effective config:\n%s\n\n", b)
+
+	if report.OK() {
+		_, _ = fmt.Println("no problems found")
+		return code
+	}
+
+	_, _ = fmt.Printf("%d problem(s) found:\n", len(report.Problems))
+	for _, problem := range report.Problems {
+		_, _ = fmt.Printf("  - %s\n", problem)
+	}
+	return code
+}
+
+// validateFile runs the static checks of the config document at path, without reading other configs, resolving
+// secrets or calling Kraken. It exits 0 when the document has no errors, warnings such as unknown keys are printed
+// but don't fail it.
+func validateFile(path string, asJSON bool) int {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fail("failed to read config: %v", err)
+	}
+	issues, err := dca.ValidateConfigBytes(b)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	code := 0
+	for _, issue := range issues {
+		if issue.Severity == dca.SeverityError {
+			code = 1
+		}
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			OK     bool                  `json:"ok"`
+			Issues []dca.ValidationIssue `json:"issues"`
+		}{code == 0, append([]dca.ValidationIssue{}, issues...)}); err != nil {
+			return fail("failed to encode issues: %v", err)
+		}
+		return code
+	}
+
+	if len(issues) == 0 {
+		_, _ = fmt.Println("no issues found")
+		return code
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "SEVERITY\tFIELD\tCODE\tMESSAGE")
+	for _, issue := range issues {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", issue.Severity, cmp.Or(issue.Field, "-"), issue.Code, issue.Message)
+	}
+	if err := w.Flush(); err != nil {
+		return fail("failed to write issues: %v", err)
+	}
+	return code
+}
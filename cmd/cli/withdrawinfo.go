@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/1gm/dca"
+)
+
+// runWithdrawInfo quotes withdrawing the accumulated balance of the configured pair's asset without withdrawing.
+func runWithdrawInfo(ctx context.Context, args []string) int {
+	var (
+		configFiles      dca.ConfigFiles
+		key              string
+		targetFeePercent float64
+		asJSON           bool
+	)
+
+	fs := flag.NewFlagSet("withdraw-info", flag.ContinueOnError)
+	fs.Var(&configFiles, "config", "path to a config file, repeat to merge several in order")
+	fs.StringVar(&key, "key", "", "name of the withdrawal address set up on Kraken (required)")
+	fs.Float64Var(&targetFeePercent, "target-fee-percent", 0, "estimate the purchases until the fee is at most this percentage of the balance, e.g. 1")
+	fs.BoolVar(&asJSON, "json", false, "print the estimate as JSON")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if len(configFiles) == 0 {
+		configFiles = dca.SplitConfigFiles(os.Getenv("CONFIG_FILE"))
+	}
+
+	if key == "" {
+		return fail("--key is required")
+	}
+
+	app := dca.NewApp()
+	defer app.Close()
+	if err := app.LoadConfig(ctx, configFiles...); err != nil {
+		return fail("failed to load config: %v", err)
+	}
+
+	est, err := app.EstimateWithdrawal(ctx, key, targetFeePercent)
+	if err != nil {
+		return fail("failed to estimate withdrawal: %v", err)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(est); err != nil {
+			return fail("failed to encode estimate: %v", err)
+		}
+		return 0
+	}
+
+	_, _ = fmt.Printf("withdrawing %s to %s (%s) costs %s, %.2f%% of the balance\n",
+		app.Config.MoneyFormat().Crypto(est.Balance, est.Asset), est.Key, est.Method, app.Config.MoneyFormat().Crypto(est.Fee, est.Asset), est.FeePercent)
+	if est.TargetFeePercent > 0 {
+		_, _ = fmt.Printf("%d more purchase(s) of %s until the fee is at most %g%%\n",
+			est.PurchasesUntilTarget, app.Config.MoneyFormat().Crypto(est.PurchaseVolume, est.Asset), est.TargetFeePercent)
+	}
+	return 0
+}
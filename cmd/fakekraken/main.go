@@ -0,0 +1,62 @@
+// Command fakekraken serves the fake Kraken API of internal/fakekraken so the CLI, or any other client, can be run
+// end-to-end against it by pointing krakenBaseURL at the printed address.
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"github.com/1gm/dca/internal/fakekraken"
+)
+
+func main() {
+	os.Exit(realMain(os.Args[1:]))
+}
+
+func realMain(args []string) int {
+	fs := flag.NewFlagSet("fakekraken", flag.ContinueOnError)
+	addr := fs.String("addr", "127.0.0.1:0", "address to listen on, a random port by default")
+	key := fs.String("key", "test-key", "the API key private calls must use")
+	secret := fs.String("secret", base64.StdEncoding.EncodeToString([]byte("test-secret")), "the base64 encoded private key private calls must be signed with")
+	scenario := fs.String("scenario", fakekraken.ScenarioHappy, "the scenario of requests without the "+fakekraken.ScenarioHeader+" header")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(*secret)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid secret: %v\n", err)
+		return 2
+	}
+
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to listen: %v\n", err)
+		return 1
+	}
+	// the address is the only line on stdout so scripts can read it
+	fmt.Printf("http://%s\n", l.Addr())
+
+	server := &http.Server{Handler: fakekraken.New(fakekraken.Config{APIKey: *key, Secret: decoded, Scenario: *scenario})}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+
+	if err = server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "failed to serve: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -2,30 +2,80 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
+	// Embeds the time zone database so reportingTimeZone works on hosts without one
+	_ "time/tzdata"
 
 	"github.com/1gm/dca"
-	"github.com/aws/aws-lambda-go/events"
+	// Registers the AWS integrations, configs in the param store and archives in S3 are the norm on Lambda
+	_ "github.com/1gm/dca/aws"
 	"github.com/aws/aws-lambda-go/lambda"
 )
 
 var configFileName = os.Getenv("CONFIG_FILE")
 
-func handleRequest(ctx context.Context, event events.EventBridgeEvent) (string, error) {
+// pairMetadata is shared by the invocations of a warm container so pairMetadata is only fetched once its TTL passes.
+var pairMetadata = dca.NewPairMetadataCache()
+
+// handleRequest takes the raw event so a malformed event time doesn't prevent the run. An event of
+// {"action":"smoke"} runs a smoke test instead and returns its report. A panic is returned as an error, so the
+// invocation is retried and dead-lettered like any other failure.
+func handleRequest(ctx context.Context, event json.RawMessage) (_ any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			pe := dca.NewPanicError(r)
+			slog.ErrorContext(ctx, "invocation panicked", "error", pe, "stack", pe.Stack)
+			err = pe
+		}
+	}()
+
 	// Load the default configuration
 	if configFileName == "" {
 		return "", fmt.Errorf("no configuration file provided")
 	}
 
 	app := dca.NewApp()
+	defer app.Close()
+	level, err := dca.ParseLogLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		return "", err
+	}
+	app.SetLogLevel(level)
+	// the stack of a failed run is logged at debug level
+	dca.SetErrStackCapture(level <= slog.LevelDebug)
 
 	app.Logger.InfoContext(ctx, "processing event bridge message", "event", event)
+	app.ScheduledAt = dca.ScheduledTime(event)
+	app.CorrelationID = dca.CorrelationID(event)
+	app.Profile = dca.EventProfile(event)
+	app.Tags = dca.EventTags(event)
+	app.PairMetadata = pairMetadata
 
-	if err := app.LoadConfig(ctx, configFileName); err != nil {
+	if err := app.LoadConfig(ctx, dca.SplitConfigFiles(configFileName)...); err != nil {
 		app.Logger.Error("error loading config", "error", err)
 		return "", err
-	} else if err = app.Run(ctx); err != nil {
+	}
+	// the keys would be reserved in the container's /tmp, which is lost with the container, so an event redelivered to
+	// another container would be ordered again
+	if app.Config.IdempotencyStorePath != "" {
+		return "", fmt.Errorf("idempotencyStorePath isn't supported on Lambda, whose filesystem doesn't outlive its container")
+	}
+
+	if action := dca.EventAction(event); action == "smoke" {
+		report, err := app.Smoke(ctx)
+		if err != nil {
+			app.Logger.Error("error running smoke test", "error", err)
+			return "", err
+		}
+		return report, nil
+	} else if action != "" {
+		return "", fmt.Errorf("unknown action %q", action)
+	}
+
+	if err := app.Run(ctx); err != nil {
 		app.Logger.Error("error running main", "error", err)
 		return "", err
 	}
@@ -0,0 +1,277 @@
+package dca
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ConfigFiles is a flag.Value collecting config sources. The flag may be repeated and every value may be a comma
+// separated list, sources are loaded in the order given.
+type ConfigFiles []string
+
+func (f *ConfigFiles) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *ConfigFiles) Set(value string) error {
+	*f = append(*f, SplitConfigFiles(value)...)
+	return nil
+}
+
+// SplitConfigFiles splits a comma separated list of config sources, such as the CONFIG_FILE environment variable.
+func SplitConfigFiles(s string) []string {
+	var files []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// mergeConfigs deep merges config documents in order, later documents override earlier ones. Objects are merged key
+// by key while arrays and other values replace the earlier value as a whole. A key set to different types in two
+// documents is an error, except that null may replace or be replaced by any value. The source of every merged value is
+// recorded in sources.
+func mergeConfigs(names []string, docs [][]byte, sources ConfigSources) ([]byte, error) {
+	merged := map[string]any{}
+	for i, b := range docs {
+		// numbers are kept as written so merging doesn't lose precision
+		var doc map[string]any
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", names[i], err)
+		}
+		source := configFileSource(names[i])
+		if err := mergeObject(merged, doc, "", names[i], func(keyPath string, value any) {
+			sources.set(keyPath, value, source)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(merged)
+}
+
+// mergeObject merges src into dst, path and name locate the values in error messages. record, when set, is called with
+// every value that replaces a value of dst.
+func mergeObject(dst, src map[string]any, path, name string, record func(keyPath string, value any)) error {
+	for key, value := range src {
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+
+		prev, ok := dst[key]
+		if !ok || prev == nil || value == nil {
+			dst[key] = value
+			if record != nil {
+				record(keyPath, value)
+			}
+			continue
+		}
+
+		if want, got := jsonKind(prev), jsonKind(value); want != got {
+			return fmt.Errorf("%s: %s is %s but an earlier config set it to %s, objects are merged key by key and other values replace earlier ones of the same type",
+				name, keyPath, got, want)
+		}
+
+		if obj, ok := value.(map[string]any); ok {
+			if err := mergeObject(prev.(map[string]any), obj, keyPath, name, record); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// arrays are replaced rather than appended so a later file fully controls the list
+		dst[key] = value
+		if record != nil {
+			record(keyPath, value)
+		}
+	}
+	return nil
+}
+
+// applyProfile overlays a profile of the config document b onto its base values, merged as later config files are.
+// When selected is empty the profile key of the document selects the profile, the document is returned unchanged
+// when no profile is selected. Every profile must be an object. The values of the profile keep the sources recorded for
+// them under the profiles key.
+func applyProfile(b []byte, selected string, sources ConfigSources) ([]byte, error) {
+	var doc map[string]any
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	profiles, _ := doc["profiles"].(map[string]any)
+	for n, profile := range profiles {
+		if _, ok := profile.(map[string]any); !ok {
+			return nil, fmt.Errorf("profile %q is %s, profiles must be objects", n, jsonKind(profile))
+		}
+	}
+
+	name, _ := doc["profile"].(string)
+	if name = cmp.Or(selected, name); name == "" {
+		return b, nil
+	}
+
+	profile, ok := profiles[name]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("%w %q, the config defines no profiles", ErrUnknownProfile, name)
+		}
+		return nil, fmt.Errorf("%w %q, available profiles: %s", ErrUnknownProfile, name, strings.Join(names, ", "))
+	}
+
+	if err := mergeObject(doc, profile.(map[string]any), "", "profile "+name, func(keyPath string, _ any) {
+		sources.overlay(keyPath, "profiles."+name+"."+keyPath, name)
+	}); err != nil {
+		return nil, err
+	}
+	doc["profile"] = name
+	return json.Marshal(doc)
+}
+
+// jsonKind describes the type of a decoded JSON value.
+func jsonKind(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "an object"
+	case []any:
+		return "an array"
+	case string:
+		return "a string"
+	case json.Number:
+		return "a number"
+	case bool:
+		return "a boolean"
+	default:
+		return "null"
+	}
+}
+
+// ConfigSourceKind is where a config value came from.
+type ConfigSourceKind string
+
+const (
+	// ConfigSourceDefault is a value that wasn't set, the default used by a run is shown.
+	ConfigSourceDefault ConfigSourceKind = "default"
+	// ConfigSourceFile is a value set by a config file.
+	ConfigSourceFile ConfigSourceKind = "file"
+	// ConfigSourceSSM is a value set by a config or secret stored in the AWS param store.
+	ConfigSourceSSM ConfigSourceKind = "ssm"
+	// ConfigSourceFlag is a value set by a command line flag.
+	ConfigSourceFlag ConfigSourceKind = "flag"
+	// ConfigSourceEvent is a value set when the app was started, such as the profile selected by a Lambda's event.
+	ConfigSourceEvent ConfigSourceKind = "event"
+)
+
+// configKeyProfile is the config key selecting a profile.
+const configKeyProfile = "profile"
+
+// configKeyTags is the config key of the tags of runs.
+const configKeyTags = "tags"
+
+// ConfigSource describes where a config value came from.
+type ConfigSource struct {
+	Kind ConfigSourceKind `json:"kind"`
+	// Name is the file, parameter or flag the value came from.
+	Name string `json:"name,omitempty"`
+	// Profile is the profile of the config the value came from, if any.
+	Profile string `json:"profile,omitempty"`
+}
+
+// configFileSource returns the source of the values of a config file.
+func configFileSource(filename string) ConfigSource {
+	if HasAWSParamStorePrefix(filename) {
+		return ConfigSource{Kind: ConfigSourceSSM, Name: filename}
+	}
+	return ConfigSource{Kind: ConfigSourceFile, Name: filename}
+}
+
+// ConfigSources maps the dotted JSON path of every config value, e.g. mqtt.password, to its source. Objects are
+// described key by key while arrays are described as a whole.
+type ConfigSources map[string]ConfigSource
+
+// set records source for value at path, replacing the sources recorded for any earlier value there. Null values are
+// not recorded, they leave the default.
+func (s ConfigSources) set(path string, value any, source ConfigSource) {
+	s.remove(path)
+	switch v := value.(type) {
+	case nil:
+	case map[string]any:
+		if len(v) == 0 && path != "" {
+			s[path] = source
+		}
+		for key, child := range v {
+			if path != "" {
+				key = path + "." + key
+			}
+			s.set(key, child, source)
+		}
+	default:
+		s[path] = source
+	}
+}
+
+// setDocument records source for every value of the config document b, invalid documents are left to the decoder to
+// report.
+func (s ConfigSources) setDocument(b []byte, source ConfigSource) {
+	var doc map[string]any
+	if err := json.Unmarshal(b, &doc); err == nil {
+		s.set("", doc, source)
+	}
+}
+
+// overlay replaces the sources recorded at path with the sources recorded at from, tagged with profile.
+func (s ConfigSources) overlay(path, from, profile string) {
+	s.remove(path)
+	for key, source := range s {
+		if key == from || strings.HasPrefix(key, from+".") {
+			source.Profile = profile
+			s[path+strings.TrimPrefix(key, from)] = source
+		}
+	}
+}
+
+// remove drops the sources recorded at path and below it.
+func (s ConfigSources) remove(path string) {
+	for key := range s {
+		if path == "" || key == path || strings.HasPrefix(key, path+".") {
+			delete(s, key)
+		}
+	}
+}
+
+// EffectiveConfig is the loaded config as a run uses it, with defaults applied and secrets masked, and the source of
+// every value.
+type EffectiveConfig struct {
+	Config  AppConfig     `json:"config"`
+	Sources ConfigSources `json:"sources"`
+}
+
+// EffectiveConfig returns the config loaded by LoadConfig with the defaults used by a run applied and every secret
+// masked, secrets resolved from references are masked too. Every value without a recorded source is a default.
+func (m *App) EffectiveConfig() (EffectiveConfig, error) {
+	eff := EffectiveConfig{Config: m.Config.withDefaults().masked(), Sources: ConfigSources{}}
+
+	b, err := json.Marshal(eff.Config)
+	if err != nil {
+		return eff, fmt.Errorf("failed to encode config: %w", err)
+	}
+	eff.Sources.setDocument(b, ConfigSource{Kind: ConfigSourceDefault})
+	for path, source := range m.configSources {
+		eff.Sources[path] = source
+	}
+	return eff, nil
+}
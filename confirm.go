@@ -0,0 +1,110 @@
+package dca
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultConfirmTimeout is how long a ConfirmPrompt waits for an answer before declining.
+const DefaultConfirmTimeout = 30 * time.Second
+
+// ConfirmPrompt asks for a y/N confirmation before an order is placed.
+type ConfirmPrompt struct {
+	In  io.Reader
+	Out io.Writer
+	// Timeout declines when no answer arrives in time, defaults to DefaultConfirmTimeout.
+	Timeout time.Duration
+}
+
+// NewTerminalPrompt returns a prompt on stdin and stderr, or nil when stdin isn't a terminal.
+func NewTerminalPrompt() *ConfirmPrompt {
+	fi, err := os.Stdin.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	return &ConfirmPrompt{In: os.Stdin, Out: os.Stderr}
+}
+
+// Confirm prints question and reports whether it was answered with y or yes. Any other answer, the end of the input
+// and the timeout decline.
+func (c *ConfirmPrompt) Confirm(ctx context.Context, question string) (bool, error) {
+	if _, err := fmt.Fprintf(c.Out, "%s [y/N] ", question); err != nil {
+		return false, err
+	}
+
+	// The read can't be interrupted so it's abandoned on timeout, the process exits soon after.
+	answer := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(c.In).ReadString('\n')
+		answer <- strings.ToLower(strings.TrimSpace(line))
+	}()
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultConfirmTimeout
+	}
+
+	select {
+	case a := <-answer:
+		return a == "y" || a == "yes", nil
+	case <-time.After(timeout):
+		_, _ = fmt.Fprintln(c.Out)
+		return false, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// confirmOrder asks for confirmation of order on m.Prompt when confirmation is required, showing the volume the
+// amount buys at the current ask. Without a prompt an order above confirmAboveCents fails with
+// ErrConfirmationRequired.
+func (m *App) confirmOrder(ctx context.Context, provider *KrakenProvider, order ExecuteOrderRequest) (err error) {
+	defer WrapErr(&err, "confirmOrder")
+
+	above := m.Config.ConfirmAboveCents > 0 && order.AmountInCents > m.Config.ConfirmAboveCents
+	d := Decision{Name: DecisionConfirmation, Inputs: map[string]string{"amount": FormatCents(order.AmountInCents, "")}, Outcome: DecisionProceed}
+	if m.Config.ConfirmAboveCents > 0 {
+		d.Inputs["confirmAbove"] = FormatCents(m.Config.ConfirmAboveCents, "")
+	}
+	defer func() {
+		if d.Narration != "" {
+			recordDecision(ctx, d)
+		}
+	}()
+
+	if !above && !m.ConfirmOrders {
+		if m.Config.ConfirmAboveCents > 0 {
+			d.Narration = fmt.Sprintf("amount %s within confirmAboveCents of %s → proceed", d.Inputs["amount"], d.Inputs["confirmAbove"])
+		}
+		return nil
+	} else if m.Prompt == nil {
+		d.Outcome, d.Narration = DecisionFail, fmt.Sprintf("amount %s above confirmAboveCents of %s without a terminal → fail", d.Inputs["amount"], d.Inputs["confirmAbove"])
+		return fmt.Errorf("%w: the amount of %s exceeds confirmAboveCents of %s, lower the amount or disable the threshold",
+			ErrConfirmationRequired, FormatCents(order.AmountInCents, ""), FormatCents(m.Config.ConfirmAboveCents, ""))
+	}
+
+	order.Pair = cmp.Or(order.Pair, provider.Pair)
+	t, err := provider.fetchTicker(ctx, order.Pair)
+	if err != nil {
+		return err
+	}
+
+	question := fmt.Sprintf("Buy %s %s for %s at %s with a %s order?", m.Config.MoneyFormat().Crypto(volumeForAmount(order.AmountInCents, t.Ask), ""),
+		order.Pair, FormatCents(order.AmountInCents, ""), FormatFiat(t.Ask, ""), cmp.Or(order.OrderType, OrderTypeMarket))
+	ok, err := m.Prompt.Confirm(ctx, question)
+	if err != nil {
+		return err
+	} else if !ok {
+		d.Outcome, d.Narration = DecisionSkip, fmt.Sprintf("order of %s declined at the prompt → skip", d.Inputs["amount"])
+		m.Logger.InfoContext(ctx, "order declined", "amountInCents", order.AmountInCents)
+		return ErrOrderDeclined
+	}
+	d.Narration = fmt.Sprintf("order of %s confirmed at the prompt → proceed", d.Inputs["amount"])
+	return nil
+}
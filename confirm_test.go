@@ -0,0 +1,81 @@
+package dca_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+func TestApp_Run_Confirm(t *testing.T) {
+	// blocked never answers so the prompt times out
+	blocked, w := io.Pipe()
+	t.Cleanup(func() { _ = w.Close() })
+
+	tt := []struct {
+		amount   int
+		confirm  bool
+		input    io.Reader
+		expected dca.RunStatus
+		ordered  bool
+	}{
+		// below the threshold nothing is asked
+		{500, false, nil, dca.RunStatusSuccess, true},
+		{1000, false, strings.NewReader("y\n"), dca.RunStatusSuccess, true},
+		{1000, false, strings.NewReader("YES\n"), dca.RunStatusSuccess, true},
+		{1000, false, strings.NewReader("n\n"), dca.RunStatusSkipped, false},
+		{1000, false, strings.NewReader(""), dca.RunStatusSkipped, false},
+		{1000, false, blocked, dca.RunStatusSkipped, false},
+		// --confirm asks below the threshold too
+		{500, true, strings.NewReader("n\n"), dca.RunStatusSkipped, false},
+		// without a terminal the threshold fails the run
+		{1000, false, nil, dca.RunStatusFailed, false},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		app, n := newTestApp(s, dca.AppConfig{OrderAmountInCents: tc.amount, ConfirmAboveCents: 500})
+		app.ConfirmOrders = tc.confirm
+
+		var out strings.Builder
+		if tc.input != nil {
+			app.Prompt = &dca.ConfirmPrompt{In: tc.input, Out: &out, Timeout: 50 * time.Millisecond}
+		}
+
+		err := app.Run(context.Background())
+		if want, got := tc.expected, n.summaries[0].Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.ordered, len(s.Requests("/0/private/AddOrder")) > 0; got != want {
+			t.Errorf("%d: want ordered %v got %v", i, want, got)
+		}
+
+		switch tc.expected {
+		case dca.RunStatusSkipped:
+			if want, got := dca.SkipReasonDeclined, n.summaries[0].SkipReason; got != want {
+				t.Errorf("%d: want %v got %v", i, want, got)
+			}
+		case dca.RunStatusFailed:
+			if !errors.Is(err, dca.ErrConfirmationRequired) {
+				t.Errorf("%d: want %v got %v", i, dca.ErrConfirmationRequired, err)
+			}
+		}
+
+		// the planned order is shown with the volume the amount buys at the ask of 50000
+		if tc.input != nil {
+			if want := "Buy 0.00010000 XBTUSD for 5.00 at 50000.00"; tc.amount == 500 && !strings.Contains(out.String(), want) {
+				t.Errorf("%d: want %q in %q", i, want, out.String())
+			} else if want := "Buy 0.00020000 XBTUSD for 10.00"; tc.amount == 1000 && !strings.Contains(out.String(), want) {
+				t.Errorf("%d: want %q in %q", i, want, out.String())
+			}
+		}
+	}
+}
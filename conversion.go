@@ -0,0 +1,130 @@
+package dca
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ConversionUserRef tags the orders of a funding conversion so reconciliation doesn't mistake them for the run's order.
+const ConversionUserRef = 0xC0F
+
+// DefaultConversionBufferPercent is how much more than the order amount a funding conversion makes available.
+const DefaultConversionBufferPercent = 1
+
+// FundingConversionConfig converts an alternate asset, such as USDT, into the quote currency of the pair before a
+// purchase the quote balance can't cover.
+type FundingConversionConfig struct {
+	// Pair is the pair the alternate asset is sold on for the quote currency, e.g. USDTUSD for USDT to buy XBTUSD.
+	Pair string `json:"pair" desc:"The pair the alternate funding asset is sold on for the quote currency, e.g. USDTUSD" schema:"required"`
+	// BufferPercent is converted on top of the amount to cover the fee and price moves, defaults to
+	// DefaultConversionBufferPercent.
+	BufferPercent float64 `json:"bufferPercent" desc:"The percentage of the order amount converted on top of it to cover the fee and price moves, defaults to 1"`
+}
+
+// Validate checks the configuration is usable.
+func (c FundingConversionConfig) Validate() error {
+	if c.Pair == "" {
+		return fieldErr("pair", errors.New("convertFunding pair is required"))
+	} else if _, ok := krakenPairs[c.Pair]; !ok {
+		return fieldErr("pair", fmt.Errorf("convertFunding pair: %w: %s", ErrUnsupportedPair, c.Pair))
+	}
+	if c.BufferPercent < 0 || c.BufferPercent >= 100 {
+		return fieldErr("bufferPercent", errors.New("convertFunding bufferPercent must be at least 0 and less than 100"))
+	}
+	return nil
+}
+
+// FundingConversion is the conversion of an alternate asset into the quote currency before the purchase.
+type FundingConversion struct {
+	Pair string `json:"pair" desc:"The pair the alternate asset was sold on" schema:"required"`
+	// Balance is the quote currency balance before the conversion.
+	Balance float64 `json:"balance" desc:"The balance of the quote currency before the conversion" schema:"required"`
+	// AlternateBalance is the balance of the alternate asset before the conversion.
+	AlternateBalance float64 `json:"alternateBalance" desc:"The balance of the alternate asset before the conversion" schema:"required"`
+	// AmountInCents is the shortfall of the balance plus the buffer, raised to the pair's minimum.
+	AmountInCents int                   `json:"amountInCents" desc:"The amount of the quote currency sold for in cents, the shortfall plus the buffer" schema:"required"`
+	Order         *ExecuteOrderResponse `json:"order,omitempty" desc:"The sell of the alternate asset, absent when it wasn't placed"`
+}
+
+// convertFunding sells the alternate asset of m.Config.ConvertFunding for the shortfall of the quote balance, plus
+// the buffer, when the balance can't cover the purchase. The sell goes through executor so it passes the same guards
+// as the purchase, and it must fill before the purchase is placed. Any failure aborts the purchase with
+// ErrConversionFailed. Conversions are tagged with ConversionUserRef and aren't recorded in the order store.
+func (m *App) convertFunding(ctx context.Context, provider *KrakenProvider, executor OrderExecutor, summary *RunSummary) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("%w: %w", ErrConversionFailed, err)
+		}
+	}()
+
+	cfg := *m.Config.ConvertFunding
+	order, err := provider.resolveOrder(m.Config.OrderRequest())
+	if err != nil || order.Side == SideSell {
+		// sells are paid with the base asset, an invalid order fails when it's placed
+		return nil
+	}
+	pair, alternate := krakenPairs[order.Pair], krakenPairs[cfg.Pair]
+
+	balances, err := provider.fetchBalances(ctx)
+	if err != nil {
+		return err
+	}
+
+	buffer := cmp.Or(cfg.BufferPercent, DefaultConversionBufferPercent)
+	required := int(math.Ceil(float64(order.AmountInCents) * (1 + buffer/100)))
+	balanceCents := int(math.Floor(balances[pair.QuoteAsset]*100 + 1e-9))
+	d := Decision{Name: DecisionConversion, Inputs: map[string]string{
+		"balance":  FormatFiat(balances[pair.QuoteAsset], ""),
+		"required": FormatCents(required, ""),
+		"buffer":   fmt.Sprintf("%g%%", buffer),
+	}, Outcome: DecisionProceed}
+	if balanceCents >= required {
+		d.Narration = fmt.Sprintf("balance %s covers %s → proceed", d.Inputs["balance"], d.Inputs["required"])
+		recordDecision(ctx, d)
+		return nil
+	}
+
+	conversion := &FundingConversion{Pair: cfg.Pair, Balance: balances[pair.QuoteAsset], AlternateBalance: balances[alternate.BaseAsset], AmountInCents: required - balanceCents}
+	summary.Conversion = conversion
+
+	t, err := provider.fetchTicker(ctx, cfg.Pair)
+	if err != nil {
+		return err
+	}
+	// a shortfall below the pair's minimum is converted at the minimum
+	if minimum, perr := strconv.ParseFloat(provider.orderMin(cfg.Pair), 64); perr == nil {
+		conversion.AmountInCents = max(conversion.AmountInCents, int(math.Ceil(minimum*t.Bid*100)))
+	}
+
+	volume := volumeForAmount(conversion.AmountInCents, t.Bid)
+	d.Inputs["alternateBalance"], d.Inputs["conversion"] = FormatCrypto(conversion.AlternateBalance, ""), FormatCents(conversion.AmountInCents, "")
+	if conversion.AlternateBalance < volume {
+		d.Outcome, d.Narration = DecisionFail, fmt.Sprintf("balance %s short of %s and %s %s can't cover %s → fail",
+			d.Inputs["balance"], d.Inputs["required"], d.Inputs["alternateBalance"], alternate.BaseAsset, d.Inputs["conversion"])
+		recordDecision(ctx, d)
+		return fmt.Errorf("%w: balance of %s %v is short of the %v needed to convert %s", ErrInsufficientFunds, alternate.BaseAsset,
+			conversion.AlternateBalance, volume, FormatCents(conversion.AmountInCents, ""))
+	}
+	d.Outcome, d.Narration = DecisionAdjust, fmt.Sprintf("balance %s short of %s → convert %s on %s", d.Inputs["balance"], d.Inputs["required"], d.Inputs["conversion"], cfg.Pair)
+	recordDecision(ctx, d)
+
+	m.Logger.InfoContext(ctx, "converting funding", "pair", cfg.Pair, "balance", conversion.Balance, "requiredInCents", required,
+		"amountInCents", conversion.AmountInCents, "alternateBalance", conversion.AlternateBalance)
+
+	res, err := executor.ExecuteOrder(ctx, ExecuteOrderRequest{AmountInCents: conversion.AmountInCents, Pair: cfg.Pair, Side: SideSell, OrderType: OrderTypeMarket, UserRef: ConversionUserRef})
+	if res.TransactionID != "" {
+		conversion.Order = &res
+	}
+	if err != nil {
+		return err
+	} else if res.Status != "closed" {
+		return fmt.Errorf("conversion order %s didn't fill, its status is %s", res.TransactionID, res.Status)
+	}
+
+	m.Logger.InfoContext(ctx, "converted funding", "transactionId", res.TransactionID, "volume", m.Config.MoneyFormat().Crypto(res.VolumePurchased, ""), "cost", FormatFiat(res.Cost, ""))
+	return nil
+}
@@ -0,0 +1,131 @@
+package dca_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/1gm/dca"
+)
+
+func TestApp_Run_ConvertFunding(t *testing.T) {
+	usdtTicker := `{"error":[],"result":{"USDTZUSD":{"a":["1.0001","1","1.000"],"b":["0.9999","1","1.000"]}}}`
+	balance := func(usd, usdt string) string {
+		return `{"error":[],"result":{"ZUSD":"` + usd + `","USDT":"` + usdt + `"}}`
+	}
+	convertOrder := `{"error":[],"result":{"txid":["TXID-C"],"descr":{"order":"sell 7.10071007 USDTUSD @ market"}}}`
+	convertFill := `{"error":[],"result":{"TXID-C":{"status":"closed","vol":"7.10071007","vol_exec":"7.10071007","cost":"7.10","fee":"0.01","price":"0.9999"}}}`
+
+	tt := []struct {
+		name     string
+		balance  string
+		tickers  []string
+		addOrder []string
+		// pairs are the pairs of the orders placed, in order
+		pairs      []string
+		status     dca.RunStatus
+		conversion bool
+		err        error
+	}{
+		// 10.00 and the 1% buffer are covered
+		{"covered", balance("10.10", "100"), []string{tickerResponse}, []string{addOrderResponse},
+			[]string{"XBTUSD"}, dca.RunStatusSuccess, false, nil},
+		// the shortfall of 7.10 is converted first
+		{"converted", balance("3.00", "100"), []string{usdtTicker, usdtTicker, tickerResponse}, []string{convertOrder, addOrderResponse},
+			[]string{"USDTUSD", "XBTUSD"}, dca.RunStatusSuccess, true, nil},
+		{"conversion_failed", balance("3.00", "100"), []string{usdtTicker}, []string{`{"error":["EOrder:Insufficient funds"]}`},
+			[]string{"USDTUSD"}, dca.RunStatusFailed, true, dca.ErrConversionFailed},
+		// nothing is sold when the alternate asset can't cover the shortfall
+		{"alternate_short", balance("3.00", "5"), []string{usdtTicker}, nil,
+			nil, dca.RunStatusFailed, true, dca.ErrInsufficientFunds},
+	}
+	for _, tc := range tt {
+		queryOrders := []string{queryOrdersResponse}
+		if tc.conversion {
+			queryOrders = []string{convertFill, queryOrdersResponse}
+		}
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       tc.tickers,
+			"/0/private/Balance":     {tc.balance},
+			"/0/private/AddOrder":    tc.addOrder,
+			"/0/private/QueryOrders": queryOrders,
+		})
+
+		app, n := newTestApp(s, dca.AppConfig{OrderAmountInCents: 1000, ConvertFunding: &dca.FundingConversionConfig{Pair: "USDTUSD"}})
+		err := app.Run(context.Background())
+		if tc.err == nil && err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		} else if tc.err != nil && (!errors.Is(err, tc.err) || !errors.Is(err, dca.ErrConversionFailed)) {
+			t.Errorf("%s: want %v got %v", tc.name, tc.err, err)
+		}
+
+		summary := n.summaries[0]
+		if want, got := tc.status, summary.Status; got != want {
+			t.Errorf("%s: want %v got %v (%s)", tc.name, want, got, summary.Error)
+		}
+
+		// the conversion fills before the purchase is placed
+		requests := s.Requests("/0/private/AddOrder")
+		if want, got := len(tc.pairs), len(requests); got != want {
+			t.Fatalf("%s: want %v got %v", tc.name, want, got)
+		}
+		for i, r := range requests {
+			if want, got := tc.pairs[i], r.Get("pair"); got != want {
+				t.Errorf("%s: want %v got %v", tc.name, want, got)
+			}
+			if r.Get("pair") != "USDTUSD" {
+				continue
+			}
+			if want, got := dca.SideSell, r.Get("type"); got != want {
+				t.Errorf("%s: want %v got %v", tc.name, want, got)
+			}
+			if want, got := strconv.Itoa(dca.ConversionUserRef), r.Get("userref"); got != want {
+				t.Errorf("%s: want %v got %v", tc.name, want, got)
+			}
+			// 7.10 at the bid of 0.9999
+			volume, _ := strconv.ParseFloat(r.Get("volume"), 64)
+			if want, got := 7.10/0.9999, volume; !approx(got, want) {
+				t.Errorf("%s: want %v got %v", tc.name, want, got)
+			}
+		}
+
+		if !tc.conversion {
+			if summary.Conversion != nil {
+				t.Errorf("%s: want no conversion got %+v", tc.name, *summary.Conversion)
+			}
+			continue
+		} else if summary.Conversion == nil {
+			t.Fatalf("%s: want a conversion", tc.name)
+		}
+		if want, got := 710, summary.Conversion.AmountInCents; got != want {
+			t.Errorf("%s: want %v got %v", tc.name, want, got)
+		}
+		if want, got := tc.status == dca.RunStatusSuccess, summary.Conversion.Order != nil && summary.Order != nil; got != want {
+			t.Errorf("%s: want both orders %v got %+v and %+v", tc.name, want, summary.Conversion.Order, summary.Order)
+		}
+	}
+}
+
+func TestAppConfig_Validate_ConvertFunding(t *testing.T) {
+	tt := []struct {
+		pair       string
+		conversion dca.FundingConversionConfig
+		valid      bool
+	}{
+		{"", dca.FundingConversionConfig{Pair: "USDTUSD"}, true},
+		{"XBTEUR", dca.FundingConversionConfig{Pair: "USDCEUR", BufferPercent: 2}, true},
+		{"", dca.FundingConversionConfig{}, false},
+		{"", dca.FundingConversionConfig{Pair: "USDTGBP"}, false},
+		// USD can't fund a purchase paid in EUR
+		{"XBTEUR", dca.FundingConversionConfig{Pair: "USDTUSD"}, false},
+		{"", dca.FundingConversionConfig{Pair: "USDTUSD", BufferPercent: -1}, false},
+	}
+	for i, tc := range tt {
+		cfg := dca.AppConfig{KrakenAPIKey: "key", KrakenPrivateKey: "secret", OrderAmountInCents: 500, Pair: tc.pair, ConvertFunding: &tc.conversion}
+		if want, got := tc.valid, cfg.Validate() == nil; got != want {
+			t.Errorf("%d: want valid %v got %v", i, want, cfg.Validate())
+		}
+	}
+}
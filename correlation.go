@@ -0,0 +1,45 @@
+package dca
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// CorrelationIDHeader is the header, and SQS message attribute, carrying the correlation ID of a request.
+const CorrelationIDHeader = "X-Correlation-ID"
+
+// isCorrelationIDKey reports whether key names a correlation ID, as the header or in camel case.
+func isCorrelationIDKey(key string) bool {
+	return strings.EqualFold(key, CorrelationIDHeader) || strings.EqualFold(key, "correlationId")
+}
+
+// CorrelationID returns the correlation ID carried by a Lambda event, either in the detail of an EventBridge event
+// or in the message attributes of the first SQS message carrying one. An empty string is returned when the event has
+// none.
+func CorrelationID(event []byte) string {
+	var e struct {
+		Detail  map[string]any `json:"detail"`
+		Records []struct {
+			MessageAttributes map[string]struct {
+				StringValue string `json:"stringValue"`
+			} `json:"messageAttributes"`
+		} `json:"Records"`
+	}
+	if err := json.Unmarshal(event, &e); err != nil {
+		return ""
+	}
+
+	for key, value := range e.Detail {
+		if s, ok := value.(string); ok && s != "" && isCorrelationIDKey(key) {
+			return s
+		}
+	}
+	for _, r := range e.Records {
+		for key, attr := range r.MessageAttributes {
+			if attr.StringValue != "" && isCorrelationIDKey(key) {
+				return attr.StringValue
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package dca_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/1gm/dca"
+)
+
+func TestCorrelationID(t *testing.T) {
+	tt := []struct {
+		event    string
+		expected string
+	}{
+		{`{"source":"aws.events","detail":{"correlationId":"abc-123"}}`, "abc-123"},
+		{`{"detail":{"X-Correlation-ID":"abc-123"}}`, "abc-123"},
+		{`{"Records":[{"messageAttributes":{"X-Correlation-ID":{"stringValue":"sqs-1","dataType":"String"}}}]}`, "sqs-1"},
+		// the first message carrying one is used
+		{`{"Records":[{"messageAttributes":{}},{"messageAttributes":{"x-correlation-id":{"stringValue":"sqs-2"}}}]}`, "sqs-2"},
+		{`{"detail":{"correlationId":""}}`, ""},
+		{`{"detail":{"correlationId":42}}`, ""},
+		{`{"time":"2024-03-01T02:00:00Z","detail":{}}`, ""},
+		{`not json`, ""},
+	}
+	for i, tc := range tt {
+		if want, got := tc.expected, dca.CorrelationID([]byte(tc.event)); got != want {
+			t.Errorf("%d: want %q got %q", i, want, got)
+		}
+	}
+}
+
+func TestApp_Run_CorrelationID(t *testing.T) {
+	tt := []struct {
+		correlationID string
+	}{
+		{"abc-123"},
+		// absent IDs fall back to the run ID
+		{""},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		storePath := filepath.Join(t.TempDir(), "orders.jsonl")
+		app, n := newTestApp(s, dca.AppConfig{OrderStorePath: storePath})
+		app.CorrelationID = tc.correlationID
+
+		if err := app.Run(context.Background()); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		summary := n.summaries[0]
+		expected := tc.correlationID
+		if expected == "" {
+			expected = summary.RunID
+		}
+		if want, got := expected, summary.CorrelationID; got != want || got == "" {
+			t.Errorf("%d: want %q got %q", i, want, got)
+		}
+
+		records, err := dca.NewFileOrderStore(storePath).List(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := expected, records[0].CorrelationID; got != want {
+			t.Errorf("%d: want %q got %q", i, want, got)
+		}
+		if want, got := summary.RunID, records[0].RunID; got != want {
+			t.Errorf("%d: want %q got %q", i, want, got)
+		}
+	}
+}
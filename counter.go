@@ -0,0 +1,133 @@
+package dca
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// KrakenTier is a Kraken account verification tier, it determines the private API rate limits.
+type KrakenTier string
+
+// Kraken account tiers.
+const (
+	KrakenTierStarter      KrakenTier = "starter"
+	KrakenTierIntermediate KrakenTier = "intermediate"
+	KrakenTierPro          KrakenTier = "pro"
+)
+
+// krakenTierLimit is the maximum API counter value of a tier and how quickly the counter decays.
+type krakenTierLimit struct {
+	Max            float64
+	DecayPerSecond float64
+}
+
+// krakenTierLimits are the documented private API counter limits of each tier.
+var krakenTierLimits = map[KrakenTier]krakenTierLimit{
+	KrakenTierStarter:      {Max: 15, DecayPerSecond: 0.33},
+	KrakenTierIntermediate: {Max: 20, DecayPerSecond: 0.5},
+	KrakenTierPro:          {Max: 20, DecayPerSecond: 1},
+}
+
+// krakenCallCosts are the private API counter costs of endpoints that don't cost 1. Ledger and trade history
+// calls cost 2 while orders are placed and cancelled on a separate trading limiter.
+var krakenCallCosts = map[string]float64{
+	"/0/private/Ledgers":       2,
+	"/0/private/QueryLedgers":  2,
+	"/0/private/TradesHistory": 2,
+	"/0/private/QueryTrades":   2,
+	"/0/private/AddOrder":      0,
+	"/0/private/CancelOrder":   0,
+}
+
+// krakenCallCost returns the private API counter cost of a call to path.
+func krakenCallCost(path string) float64 {
+	if cost, ok := krakenCallCosts[path]; ok {
+		return cost
+	}
+	return 1
+}
+
+// KrakenStats is an estimate of the private API usage of a provider.
+type KrakenStats struct {
+	// Calls is the number of private API calls made.
+	Calls int `json:"calls" desc:"The number of private API calls made"`
+	// Counter is the estimated value of the private API counter.
+	Counter float64 `json:"counter" desc:"The estimated value of the private API counter"`
+	// Max is the counter value at which Kraken starts rejecting calls.
+	Max float64 `json:"max" desc:"The counter value at which Kraken starts rejecting calls"`
+}
+
+// KrakenCallCounter estimates Kraken's private API counter, which increases with every call and decays over time.
+// Kraken keeps its own counter per API key so the estimate only accounts for calls made through this counter.
+type KrakenCallCounter struct {
+	Max            float64
+	DecayPerSecond float64
+	// Now returns the current time, defaults to time.Now.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	value   float64
+	updated time.Time
+	calls   int
+}
+
+// NewKrakenCallCounter returns a counter with the limits of tier, unknown tiers use the starter limits.
+func NewKrakenCallCounter(tier KrakenTier) *KrakenCallCounter {
+	limit, ok := krakenTierLimits[tier]
+	if !ok {
+		limit = krakenTierLimits[KrakenTierStarter]
+	}
+	return &KrakenCallCounter{Max: limit.Max, DecayPerSecond: limit.DecayPerSecond, Now: time.Now}
+}
+
+// decay applies the decay since the last update, the caller must hold mu.
+func (c *KrakenCallCounter) decay() {
+	now := c.Now()
+	if !c.updated.IsZero() {
+		c.value = math.Max(0, c.value-now.Sub(c.updated).Seconds()*c.DecayPerSecond)
+	}
+	c.updated = now
+}
+
+// Add records a call costing cost and returns the new counter estimate.
+func (c *KrakenCallCounter) Add(cost float64) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.decay()
+	c.value += cost
+	c.calls++
+	return c.value
+}
+
+// Value returns the current counter estimate.
+func (c *KrakenCallCounter) Value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.decay()
+	return c.value
+}
+
+// Delay returns how long to wait before a call costing cost can be made without exceeding Max.
+func (c *KrakenCallCounter) Delay(cost float64) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.decay()
+	excess := c.value + cost - c.Max
+	if excess <= 0 || c.DecayPerSecond <= 0 {
+		return 0
+	}
+	return time.Duration(excess / c.DecayPerSecond * float64(time.Second))
+}
+
+// Stats returns the number of calls made and the current counter estimate.
+func (c *KrakenCallCounter) Stats() KrakenStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.decay()
+	return KrakenStats{Calls: c.calls, Counter: c.value, Max: c.Max}
+}
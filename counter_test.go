@@ -0,0 +1,120 @@
+package dca_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+// fakeClock is a clock that only moves when advanced.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestKrakenCallCounter(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c := dca.NewKrakenCallCounter(dca.KrakenTierIntermediate)
+	c.Now = clock.Now
+
+	tt := []struct {
+		advance  time.Duration
+		cost     float64
+		expected float64
+		delay    time.Duration
+	}{
+		{0, 10, 10, 0},
+		// at the limit, another call needs 2s of decay at 0.5 per second
+		{0, 10, 20, 2 * time.Second},
+		{4 * time.Second, 1, 19, 0},
+		{time.Second, 0, 18.5, 0},
+		// the counter never decays below zero
+		{time.Minute, 0, 0, 0},
+	}
+	for i, tc := range tt {
+		clock.Advance(tc.advance)
+		if tc.cost > 0 {
+			c.Add(tc.cost)
+		}
+		if want, got := tc.expected, c.Value(); got != want {
+			t.Errorf("%d: want counter %v got %v", i, want, got)
+		}
+		if want, got := tc.delay, c.Delay(1); got != want {
+			t.Errorf("%d: want delay %v got %v", i, want, got)
+		}
+	}
+
+	if want, got := (dca.KrakenStats{Calls: 3, Counter: 0, Max: 20}), c.Stats(); got != want {
+		t.Errorf("want %+v got %+v", want, got)
+	}
+}
+
+func TestNewKrakenCallCounter(t *testing.T) {
+	tt := []struct {
+		tier  dca.KrakenTier
+		max   float64
+		decay float64
+	}{
+		{dca.KrakenTierStarter, 15, 0.33},
+		{dca.KrakenTierIntermediate, 20, 0.5},
+		{dca.KrakenTierPro, 20, 1},
+		{"", 15, 0.33},
+	}
+	for i, tc := range tt {
+		c := dca.NewKrakenCallCounter(tc.tier)
+		if c.Max != tc.max || c.DecayPerSecond != tc.decay {
+			t.Errorf("%d: want %v/%v got %v/%v", i, tc.max, tc.decay, c.Max, c.DecayPerSecond)
+		}
+	}
+}
+
+func TestKrakenProvider_Stats(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":       {tickerResponse},
+		"/0/private/AddOrder":    {addOrderResponse},
+		"/0/private/QueryOrders": {queryOrdersResponse},
+	})
+
+	p := newTestKrakenProvider(s, dca.KrakenProviderConfig{})
+	if _, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// public calls aren't counted and AddOrder uses the trading limiter, leaving QueryOrders
+	stats := p.Stats()
+	if want, got := 1, stats.Calls; got != want {
+		t.Errorf("want %v calls got %v", want, got)
+	}
+	if stats.Counter <= 0 || stats.Counter > 1 {
+		t.Errorf("want a counter in (0, 1] got %v", stats.Counter)
+	}
+}
+
+func TestKrakenProvider_RateLimitWait(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":       {tickerResponse},
+		"/0/private/AddOrder":    {addOrderResponse},
+		"/0/private/QueryOrders": {queryOrdersResponse},
+	})
+
+	p := newTestKrakenProvider(s, dca.KrakenProviderConfig{RateLimitWait: true})
+	clock := &fakeClock{now: time.Now()}
+	p.Counter.Now = clock.Now
+	p.Counter.Add(p.Counter.Max)
+
+	// the counter is full and the clock never moves, the call waits until the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := p.ExecuteOrder(ctx, dca.ExecuteOrderRequest{AmountInCents: 500}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if want, got := 0, len(s.Requests("/0/private/QueryOrders")); got != want {
+		t.Errorf("want %v QueryOrders requests got %v", want, got)
+	}
+}
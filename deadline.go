@@ -0,0 +1,73 @@
+package dca
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// DefaultRunTimeout bounds the steps of a run, from its checks to the recording of its order, when runTimeout isn't
+// configured.
+const DefaultRunTimeout = 2 * time.Minute
+
+// StepBudget derives the timeout of a step of a run from the time left until the run's deadline, so steps which each
+// use most of their own timeout can't add up past the run's timeout.
+type StepBudget struct {
+	// Share is the part of the remaining time the step may use, e.g. 0.3 for 30%, the whole of it when zero.
+	Share float64
+	// Min is the least time the step is given past its share, though never more than remains unless Floor is set.
+	Min time.Duration
+	// Floor makes Min a requirement for steps which mustn't be cut short, such as placing an order: the step isn't
+	// started when less than Min remains.
+	Floor bool
+}
+
+// Budgets of the steps of placing an order.
+var (
+	// krakenRequestBudget is the budget of a request to Kraken other than placing an order.
+	krakenRequestBudget = StepBudget{Share: 0.3, Min: 2 * time.Second}
+	// krakenAddOrderBudget gives placing an order what remains up to its own timeout. An order cut short may be
+	// placed without the run knowing, so it isn't placed with less than 5 seconds left.
+	krakenAddOrderBudget = StepBudget{Min: 5 * time.Second, Floor: true}
+	// krakenFillBudget leaves half of the remaining time to poll the order when its fill doesn't arrive.
+	krakenFillBudget = StepBudget{Share: 0.5, Min: 2 * time.Second}
+	// integrationCheckBudget is the budget of the checks of the integrations before a run orders.
+	integrationCheckBudget = StepBudget{Share: 0.3, Min: 2 * time.Second}
+)
+
+// Timeout returns the timeout of a step whose own timeout is own when remaining is left until the run's deadline: the
+// step's share of remaining, at least Min and at most own, no bound when own is zero. It returns ErrRunTimeout when
+// Floor is set and less than Min remains.
+func (b StepBudget) Timeout(own, remaining time.Duration) (time.Duration, error) {
+	if b.Floor && remaining < b.Min {
+		return 0, fmt.Errorf("%w: %v left, the step needs at least %v", ErrRunTimeout, max(remaining, 0).Round(time.Millisecond), b.Min)
+	}
+
+	timeout := remaining
+	if b.Share > 0 && b.Share < 1 {
+		timeout = time.Duration(float64(remaining) * b.Share)
+	}
+	timeout = min(max(timeout, b.Min), remaining)
+	if own > 0 {
+		timeout = min(timeout, own)
+	}
+	return max(timeout, 0), nil
+}
+
+// stepTimeout returns the timeout of step from the time left until the deadline of ctx, own when ctx has no deadline.
+func stepTimeout(ctx context.Context, logger *slog.Logger, step string, budget StepBudget, own time.Duration) (time.Duration, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return own, nil
+	}
+
+	remaining := time.Until(deadline)
+	timeout, err := budget.Timeout(own, remaining)
+	if err != nil {
+		logger.WarnContext(ctx, "not enough of the run's time left to start the step", "step", step, "remaining", remaining, "min", budget.Min)
+		return 0, err
+	}
+	logger.DebugContext(ctx, "derived the step's deadline from the run's time left", "step", step, "timeout", timeout, "remaining", remaining)
+	return timeout, nil
+}
@@ -0,0 +1,153 @@
+package dca_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+	"github.com/1gm/dca/internal/fakekraken"
+)
+
+func TestStepBudget_Timeout(t *testing.T) {
+	request := dca.StepBudget{Share: 0.3, Min: 2 * time.Second}
+	order := dca.StepBudget{Min: 5 * time.Second, Floor: true}
+	tt := []struct {
+		budget    dca.StepBudget
+		own       time.Duration
+		remaining time.Duration
+		timeout   time.Duration
+		err       error
+	}{
+		// plenty left, the step's own timeout applies
+		{request, 10 * time.Second, 2 * time.Minute, 10 * time.Second, nil},
+		{request, 10 * time.Second, 20 * time.Second, 6 * time.Second, nil},
+		// the share is below the minimum
+		{request, 10 * time.Second, 5 * time.Second, 2 * time.Second, nil},
+		// a nearly exhausted budget gives what remains
+		{request, 10 * time.Second, time.Second, time.Second, nil},
+		{request, 10 * time.Second, -time.Second, 0, nil},
+		// without a timeout of its own the step is only bounded by its share
+		{request, 0, time.Minute, 18 * time.Second, nil},
+		{dca.StepBudget{}, 0, time.Minute, time.Minute, nil},
+		// a step with a floor gets what remains up to its own timeout, and isn't squeezed below the floor
+		{order, 10 * time.Second, 2 * time.Minute, 10 * time.Second, nil},
+		{order, 10 * time.Second, 7 * time.Second, 7 * time.Second, nil},
+		{order, 10 * time.Second, 5 * time.Second, 5 * time.Second, nil},
+		{order, 10 * time.Second, 4 * time.Second, 0, dca.ErrRunTimeout},
+		{order, 10 * time.Second, -time.Second, 0, dca.ErrRunTimeout},
+	}
+	for i, tc := range tt {
+		timeout, err := tc.budget.Timeout(tc.own, tc.remaining)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%d: want %v got %v", i, tc.err, err)
+		}
+		if want, got := tc.timeout, timeout; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestApp_Run_RunTimeout(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":       {tickerResponse},
+		"/0/private/AddOrder":    {addOrderResponse},
+		"/0/private/QueryOrders": {queryOrdersResponse},
+	})
+
+	// less time is left than placing an order needs so the run fails before placing it
+	app, n := newTestApp(s, dca.AppConfig{RunTimeout: "4s"})
+	if err := app.Run(context.Background()); !errors.Is(err, dca.ErrRunTimeout) {
+		t.Fatalf("want %v got %v", dca.ErrRunTimeout, err)
+	}
+	if want, got := dca.RunStatusFailed, n.summaries[0].Status; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := 0, len(s.Requests("/0/private/AddOrder")); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestApp_Run_RunTimeout_Interrupted(t *testing.T) {
+	s := httptest.NewServer(fakekraken.New(fakekraken.Config{
+		APIKey: "key",
+		Secret: []byte("secret"),
+		Delays: map[string]time.Duration{"/0/public/Ticker": time.Second},
+	}))
+	defer s.Close()
+
+	n := &recordingNotifier{}
+	app := dca.NewApp()
+	app.Config = dca.AppConfig{KrakenAPIKey: "key", KrakenPrivateKey: "secret", KrakenBaseURL: s.URL, OrderAmountInCents: 500, RunTimeout: "200ms"}
+	app.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	app.Notifiers = []dca.Notifier{n}
+
+	// the run runs out of time fetching the price, it's interrupted and its shutdown checks for a placed order
+	start := time.Now()
+	err := app.Run(context.Background())
+	if !errors.Is(err, dca.ErrRunTimeout) || !errors.Is(err, dca.ErrInterrupted) {
+		t.Fatalf("want %v and %v got %v", dca.ErrRunTimeout, dca.ErrInterrupted, err)
+	}
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Errorf("want the run to stop at its timeout got %v", elapsed)
+	}
+	summary := n.summaries[0]
+	if want, got := dca.RunStatusInterrupted, summary.Status; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if summary.Interrupted == nil || summary.Interrupted.OrderPlaced {
+		t.Errorf("want no order placed got %+v", summary.Interrupted)
+	}
+}
+
+func TestAppConfig_Validate_RunTimeout(t *testing.T) {
+	tt := []struct {
+		timeout string
+		err     string
+	}{
+		{"", ""},
+		{"5m", ""},
+		{"five minutes", "invalid runTimeout"},
+		{"-1m", "runTimeout must be positive"},
+	}
+	for i, tc := range tt {
+		cfg := dca.AppConfig{KrakenAPIKey: "key", KrakenPrivateKey: "secret", OrderAmountInCents: 500, RunTimeout: tc.timeout}
+		err := cfg.Validate()
+		if tc.err == "" && err != nil {
+			t.Errorf("%d: want no error got %v", i, err)
+		} else if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%d: want %q got %v", i, tc.err, err)
+		}
+	}
+}
+
+func TestApp_Run_LogLevel_StepDeadline(t *testing.T) {
+	tt := []struct {
+		level  slog.Level
+		logged bool
+	}{
+		{slog.LevelInfo, false},
+		{slog.LevelDebug, true},
+	}
+	for _, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		logs, err := runWithLogFile(t, s, `, "runTimeout": "1m"`, tc.level)
+		if err != nil {
+			t.Fatalf("%v: %v", tc.level, err)
+		}
+		if want, got := tc.logged, strings.Contains(logs, `"msg":"derived the step's deadline from the run's time left"`); got != want {
+			t.Errorf("%v: want %v got %v: %s", tc.level, want, got, logs)
+		}
+	}
+}
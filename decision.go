@@ -0,0 +1,102 @@
+package dca
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Names of the decisions of a run, one for every guard or rule it evaluates.
+const (
+	DecisionPause           = "pause"
+	DecisionAmountParameter = "amount_parameter"
+	DecisionBudget          = "budget"
+	DecisionPriceLadder     = "price_ladder"
+	DecisionIntegrations    = "integrations"
+	DecisionClockSkew       = "clock_skew"
+	DecisionReconcile       = "reconcile"
+	DecisionIdempotency     = "idempotency"
+	DecisionConfirmation    = "confirmation"
+	DecisionConversion      = "conversion"
+	DecisionCircuit         = "circuit"
+	DecisionTradingMode     = "trading_mode"
+	DecisionPriceDeviation  = "price_deviation"
+	DecisionVolume          = "volume"
+	DecisionBalance         = "balance"
+)
+
+// DecisionOutcome is what a guard or rule did to the run.
+type DecisionOutcome string
+
+const (
+	// DecisionProceed lets the run continue as it was.
+	DecisionProceed DecisionOutcome = "proceed"
+	// DecisionAdjust lets the run continue with a changed order, e.g. a paced amount.
+	DecisionAdjust DecisionOutcome = "adjust"
+	// DecisionSkip skips the run without ordering.
+	DecisionSkip DecisionOutcome = "skip"
+	// DecisionFail fails the run.
+	DecisionFail DecisionOutcome = "fail"
+)
+
+// Decision is the outcome of a guard or rule of a run and the values it was made from.
+type Decision struct {
+	Name string `json:"name" desc:"The guard or rule, e.g. budget or price_deviation" schema:"required"`
+	// Inputs are the values the decision was made from, formatted for people.
+	Inputs  map[string]string `json:"inputs,omitempty" desc:"The values the decision was made from"`
+	Outcome DecisionOutcome   `json:"outcome" desc:"What the decision did to the run" enum:"proceed,adjust,skip,fail" schema:"required"`
+	// Narration explains the decision in a line, e.g. "budget remaining 120.00 over 4 runs → amount 30.00".
+	Narration string `json:"narration" desc:"The decision explained in a line" schema:"required"`
+}
+
+// String returns the narration of the decision prefixed with its name.
+func (d Decision) String() string {
+	return d.Name + ": " + d.Narration
+}
+
+// FormatDecisions narrates decisions, one line each.
+func FormatDecisions(decisions []Decision) string {
+	var b strings.Builder
+	for _, d := range decisions {
+		b.WriteString(d.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// decisionRecorder collects the decisions of a run in the order they're made. It's safe for concurrent use.
+type decisionRecorder struct {
+	mu        sync.Mutex
+	decisions []Decision
+}
+
+// decisionKey is the context key of the recorder of a run's decisions.
+type decisionKey struct{}
+
+// withDecisions returns ctx recording the decisions made with it to r.
+func withDecisions(ctx context.Context, r *decisionRecorder) context.Context {
+	return context.WithValue(ctx, decisionKey{}, r)
+}
+
+// recordDecision records d to the recorder of ctx, contexts without one drop it. A guard evaluated again, e.g. by
+// the retry of a failed attempt, replaces its earlier decision so every guard has exactly one.
+func recordDecision(ctx context.Context, d Decision) {
+	r, ok := ctx.Value(decisionKey{}).(*decisionRecorder)
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if i := slices.IndexFunc(r.decisions, func(e Decision) bool { return e.Name == d.Name }); i >= 0 {
+		r.decisions = slices.Delete(r.decisions, i, i+1)
+	}
+	r.decisions = append(r.decisions, d)
+}
+
+// Decisions returns the decisions recorded so far.
+func (r *decisionRecorder) Decisions() []Decision {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.decisions)
+}
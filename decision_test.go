@@ -0,0 +1,109 @@
+package dca_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+func TestApp_Run_Decisions_Golden(t *testing.T) {
+	tt := []struct {
+		name string
+		// referencePrice is the price of the previous purchase, the ask is 50000
+		referencePrice float64
+		status         dca.RunStatus
+	}{
+		{"success", 49000, dca.RunStatusSuccess},
+		{"price_deviation", 40000, dca.RunStatusSkipped},
+	}
+	for _, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+
+		storePath := filepath.Join(t.TempDir(), "orders.jsonl")
+		// outside of the month so it's not part of the budget's spend
+		previous := dca.OrderRecord{
+			Time:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			Order: dca.ExecuteOrderResponse{Pair: "XBTUSD", Side: dca.SideBuy, VolumePurchased: 0.0001, Price: tc.referencePrice},
+		}
+		if err := dca.NewFileOrderStore(storePath).Put(context.Background(), previous); err != nil {
+			t.Fatal(err)
+		}
+
+		app, n := newTestApp(s, dca.AppConfig{
+			OrderAmountInCents:       1000,
+			OrderStorePath:           storePath,
+			PauseParameter:           "awsssm://dca/pause",
+			Budget:                   &dca.BudgetConfig{MonthlyAmountInCents: 500, Interval: "2000h"},
+			ConfirmAboveCents:        10000,
+			CircuitBreaker:           &dca.CircuitBreakerConfig{Enabled: true},
+			MaxPriceDeviationPercent: 10,
+			VolumeRounding:           "0.00001",
+		})
+		app.SecretResolver = func(context.Context, string) ([]byte, error) { return []byte("false"), nil }
+
+		if err := app.Run(context.Background()); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		summary := n.summaries[0]
+		if want, got := tc.status, summary.Status; got != want {
+			t.Errorf("%s: want %v got %v (%s)", tc.name, want, got, summary.Error)
+		}
+
+		// every guard has exactly one decision
+		seen := map[string]bool{}
+		for _, d := range summary.Decisions {
+			if seen[d.Name] {
+				t.Errorf("%s: want a single %s decision got %v", tc.name, d.Name, summary.Decisions)
+			}
+			seen[d.Name] = true
+		}
+
+		got := dca.FormatDecisions(summary.Decisions)
+		golden := filepath.Join("testdata", "explain", tc.name+".txt")
+		if *update {
+			if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(want) != got {
+			t.Errorf("%s: want %q got %q", golden, want, got)
+		}
+	}
+}
+
+func TestApp_Quote_Decisions(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":       {tickerResponse},
+	})
+
+	app := dca.NewApp()
+	app.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	app.Config = dca.AppConfig{KrakenBaseURL: s.URL, OrderAmountInCents: 500}
+
+	q, err := app.Quote(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the quote evaluates the guards with the code of a run
+	want := "trading_mode: market online → proceed\nvolume: volume 0.00010000 ≥ min 0.00005 → proceed\n"
+	if got := dca.FormatDecisions(q.Decisions); got != want {
+		t.Errorf("want %q got %q", want, got)
+	}
+}
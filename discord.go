@@ -0,0 +1,321 @@
+package dca
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// discordDefaultTimeout bounds every request to the webhook.
+	discordDefaultTimeout = 5 * time.Second
+	// discordMaxRetryAfter is the longest a rate limited post waits to be retried, longer waits fail the post.
+	discordMaxRetryAfter = 10 * time.Second
+)
+
+// Colors of the embed of a run, green when it succeeded or was skipped and red when it failed or was interrupted.
+const (
+	discordColorSuccess = 0x2ecc71
+	discordColorFailure = 0xe74c3c
+)
+
+// Discord's limits on the parts of a message, see https://discord.com/developers/docs/resources/message#embed-object-embed-limits
+const (
+	discordMaxContent     = 2000
+	discordMaxTitle       = 256
+	discordMaxDescription = 4096
+	discordMaxFieldValue  = 1024
+	discordMaxEmbed       = 6000
+)
+
+// DiscordConfig configures a DiscordNotifier.
+type DiscordConfig struct {
+	// WebhookURL may reference a secret, e.g. awsssme:///discord/webhook, since the URL holds the webhook's token
+	WebhookURL string `json:"webhookUrl" desc:"The URL of the Discord webhook posted to, may reference a secret" schema:"required"`
+	// Timeout bounds every request to the webhook, defaults to 5 seconds
+	Timeout time.Duration `json:"-"`
+	// ExtraHeaders are added to every post, set from the app's extraHeaders
+	ExtraHeaders map[string]string `json:"-"`
+	// HTTPClient sends the posts instead of a client with ExtraHeaders, set to the app's shared client
+	HTTPClient *http.Client `json:"-"`
+}
+
+// Validate checks the configuration is usable, a webhook URL that's a secret reference is checked once resolved.
+func (c DiscordConfig) Validate() error {
+	if c.WebhookURL == "" {
+		return fieldErr("webhookUrl", errors.New("discord webhookUrl is required"))
+	} else if HasAWSParamStorePrefix(c.WebhookURL) {
+		return nil
+	}
+
+	u, err := url.Parse(c.WebhookURL)
+	if err != nil {
+		// the URL holds the webhook's token so it's left out of the error
+		return fieldErr("webhookUrl", errors.New("invalid discord webhookUrl"))
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return fieldErr("webhookUrl", errors.New("discord webhookUrl scheme must be http or https"))
+	} else if u.Host == "" {
+		return fieldErr("webhookUrl", errors.New("discord webhookUrl is missing a host"))
+	}
+	return nil
+}
+
+// DiscordNotifier posts an embed summarizing every run to a Discord webhook. The embed is colored by the outcome of the
+// run and lists the purchase, a run whose embed can't be built is posted as the one-line receipt instead.
+type DiscordNotifier struct {
+	Config DiscordConfig
+	// Receipts renders the one-line receipt posted when the embed can't be built, defaults to the embedded templates.
+	Receipts *ReceiptRenderer
+	// Money formats the amounts of the embed.
+	Money MoneyFormat
+
+	http *http.Client
+}
+
+// NewDiscordNotifier creates a notifier posting to the webhook in cfg.
+func NewDiscordNotifier(cfg DiscordConfig) *DiscordNotifier {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = discordDefaultTimeout
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = NewHTTPClient(HTTPClientConfig{ExtraHeaders: cfg.ExtraHeaders})
+	}
+	return &DiscordNotifier{Config: cfg, Receipts: defaultReceiptRenderer, http: client}
+}
+
+// discordMessage is the body of a webhook post.
+type discordMessage struct {
+	Content string         `json:"content,omitempty"`
+	Embeds  []discordEmbed `json:"embeds,omitempty"`
+}
+
+type discordEmbed struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	Color       int                 `json:"color"`
+	Timestamp   string              `json:"timestamp,omitempty"`
+	Fields      []discordEmbedField `json:"fields,omitempty"`
+	Footer      *discordEmbedFooter `json:"footer,omitempty"`
+}
+
+type discordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbedFooter struct {
+	Text string `json:"text"`
+}
+
+func (n *DiscordNotifier) Notify(ctx context.Context, summary RunSummary) (err error) {
+	defer WrapErr(&err, "DiscordNotifier.Notify")
+
+	var msg discordMessage
+	if embed, eerr := newDiscordEmbed(summary, n.Money); eerr != nil {
+		msg.Content = n.fallbackContent(summary)
+	} else {
+		msg.Embeds = []discordEmbed{embed}
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	ctx = withHTTPComponent(ctx, HTTPComponentDiscord)
+	retryAfter, err := n.post(ctx, b)
+	if retryAfter == 0 {
+		return err
+	}
+
+	// a rate limited post is retried once, after the wait Discord asked for
+	if retryAfter > discordMaxRetryAfter {
+		return fmt.Errorf("%w, retry after %v is too long to wait", err, retryAfter)
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(retryAfter):
+	}
+	_, err = n.post(ctx, b)
+	return err
+}
+
+// post posts the message body b to the webhook. When the post was rate limited, the time to wait before retrying is
+// returned with the error.
+func (n *DiscordNotifier) post(ctx context.Context, b []byte) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, n.Config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", n.Config.WebhookURL, bytes.NewReader(b))
+	if err != nil {
+		return 0, errors.New("failed to make request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := n.http.Do(req)
+	if err != nil {
+		// the error holds the URL and so the webhook's token
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return 0, fmt.Errorf("failed to post message: %w", err)
+	}
+	body, err := readResponseBody(res, maxDrainBytes)
+	if err != nil {
+		return 0, err
+	}
+	if res.StatusCode == http.StatusTooManyRequests {
+		return discordRetryAfter(res, body), fmt.Errorf("discord returned %s", res.Status)
+	} else if res.StatusCode/100 != 2 {
+		return 0, fmt.Errorf("discord returned %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	return 0, nil
+}
+
+// Check fetches the webhook, which Discord answers without posting anything, to find deleted webhooks and bad tokens.
+func (n *DiscordNotifier) Check(ctx context.Context) (err error) {
+	defer WrapErr(&err, "DiscordNotifier.Check")
+
+	ctx, cancel := context.WithTimeout(withHTTPComponent(ctx, HTTPComponentDiscord), n.Config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", n.Config.WebhookURL, nil)
+	if err != nil {
+		return errors.New("failed to make request")
+	}
+	res, err := n.http.Do(req)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return fmt.Errorf("failed to reach discord: %w", err)
+	}
+	if _, err = readResponseBody(res, maxDrainBytes); err != nil {
+		return err
+	} else if res.StatusCode/100 != 2 {
+		return fmt.Errorf("discord returned %s", res.Status)
+	}
+	return nil
+}
+
+// discordRetryAfter returns the wait asked for by a rate limited response, the retry_after of its body in seconds or
+// else its Retry-After header. A second is waited when neither can be read.
+func discordRetryAfter(res *http.Response, body []byte) time.Duration {
+	var limited struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if err := json.Unmarshal(body, &limited); err == nil && limited.RetryAfter > 0 {
+		return time.Duration(limited.RetryAfter * float64(time.Second))
+	}
+	if s, err := strconv.ParseFloat(res.Header.Get("Retry-After"), 64); err == nil && s > 0 {
+		return time.Duration(s * float64(time.Second))
+	}
+	return time.Second
+}
+
+// fallbackContent returns the one-line receipt of summary, or its status when even that can't be rendered.
+func (n *DiscordNotifier) fallbackContent(summary RunSummary) string {
+	receipt, err := n.Receipts.Render(summary)
+	if err != nil || strings.TrimSpace(receipt.Line) == "" {
+		return "dca run " + string(summary.Status)
+	}
+	return truncateRunes(strings.TrimSpace(receipt.Line), discordMaxContent)
+}
+
+// newDiscordEmbed returns the embed of summary with its amounts formatted with money. It fails when a value of the run
+// can't be shown or the embed exceeds Discord's limits, which Discord would reject the post for.
+func newDiscordEmbed(summary RunSummary, money MoneyFormat) (discordEmbed, error) {
+	embed := discordEmbed{Color: discordColorSuccess}
+	if !summary.StartedAt.IsZero() {
+		embed.Timestamp = summary.StartedAt.UTC().Format(time.RFC3339)
+	}
+	if summary.RunID != "" {
+		embed.Footer = &discordEmbedFooter{Text: "run " + summary.RunID}
+	}
+
+	o := summary.Order
+	var base, quote string
+	if o != nil {
+		base, quote = PairAssets(o.Pair)
+	}
+	switch summary.Status {
+	case RunStatusFailed, RunStatusInterrupted:
+		embed.Color = discordColorFailure
+		embed.Title = "DCA run " + string(summary.Status)
+		embed.Description = summary.Error
+	case RunStatusSkipped:
+		embed.Title = "DCA run skipped"
+		embed.Description = string(summary.SkipReason)
+	default:
+		embed.Title = "DCA run succeeded"
+		if o != nil && o.VolumePurchased > 0 {
+			embed.Title = "Bought " + money.Crypto(o.VolumePurchased, base)
+		}
+	}
+
+	var values []float64
+	field := func(name, value string) {
+		embed.Fields = append(embed.Fields, discordEmbedField{Name: name, Value: value, Inline: true})
+	}
+	if o != nil {
+		values = append(values, o.Cost, o.VolumePurchased, o.Price, o.Fee)
+		field("Pair", o.Pair)
+		field("Fiat spent", money.Amount(o.Cost, quote))
+		field("Volume", money.Crypto(o.VolumePurchased, base))
+		field("Price", money.Amount(o.Price, quote))
+		field("Fee", money.Amount(o.Fee, quote))
+		if o.TransactionID != "" {
+			field("Transaction ID", o.TransactionID)
+		}
+	}
+	if pnl := summary.UnrealizedPnL; pnl != nil {
+		values = append(values, pnl.CostBasis)
+		_, pnlQuote := PairAssets(pnl.Pair)
+		field("Cost basis", money.Amount(pnl.CostBasis, pnlQuote))
+	}
+	if len(summary.Tags) > 0 {
+		field("Tags", FormatTags(summary.Tags))
+	}
+
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return embed, fmt.Errorf("invalid amount %v", v)
+		}
+	}
+	size := utf8.RuneCountInString(embed.Title) + utf8.RuneCountInString(embed.Description)
+	if embed.Footer != nil {
+		size += utf8.RuneCountInString(embed.Footer.Text)
+	}
+	if utf8.RuneCountInString(embed.Title) > discordMaxTitle || utf8.RuneCountInString(embed.Description) > discordMaxDescription {
+		return embed, errors.New("embed title or description is too long")
+	}
+	for _, f := range embed.Fields {
+		if utf8.RuneCountInString(f.Value) > discordMaxFieldValue {
+			return embed, fmt.Errorf("embed field %s is too long", f.Name)
+		}
+		size += utf8.RuneCountInString(f.Name) + utf8.RuneCountInString(f.Value)
+	}
+	if size > discordMaxEmbed {
+		return embed, errors.New("embed is too long")
+	}
+	return embed, nil
+}
+
+// truncateRunes returns s cut to at most n runes, ending with an ellipsis when it was cut.
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
@@ -0,0 +1,214 @@
+package dca_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+// discordPost is the body of a webhook post as received by the test server.
+type discordPost struct {
+	Content string `json:"content"`
+	Embeds  []struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Color       int    `json:"color"`
+		Fields      []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"fields"`
+	} `json:"embeds"`
+}
+
+// newDiscordTestServer returns a webhook answering posts with the statuses and bodies of responses in turn, posts are
+// appended to posts. Fetching the webhook always succeeds.
+func newDiscordTestServer(t *testing.T, posts *[]discordPost, responses ...string) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			_, _ = w.Write([]byte(`{"type":1,"id":"1"}`))
+			return
+		}
+
+		var post discordPost
+		b, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &post); err != nil {
+			t.Errorf("invalid post %s: %v", b, err)
+		}
+		*posts = append(*posts, post)
+
+		res := "204"
+		if len(*posts) <= len(responses) {
+			res = responses[len(*posts)-1]
+		}
+		status, body, _ := strings.Cut(res, " ")
+		code := http.StatusNoContent
+		if status == "429" {
+			code = http.StatusTooManyRequests
+		} else if status == "400" {
+			code = http.StatusBadRequest
+		}
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestDiscordNotifier_Notify(t *testing.T) {
+	order := &dca.ExecuteOrderResponse{Pair: "XBTUSD", TransactionID: "TXID-A", VolumePurchased: 0.0001, Cost: 5, Fee: 0.02, Price: 50000}
+	tt := []struct {
+		summary dca.RunSummary
+		title   string
+		color   int
+		fields  map[string]string
+	}{
+		{
+			dca.RunSummary{Status: dca.RunStatusSuccess, Order: order, UnrealizedPnL: &dca.UnrealizedPnL{Pair: "XBTUSD", CostBasis: 120.5}, Tags: map[string]string{"household": "A", "goal": "retirement"}},
+			"Bought 0.00010000 BTC", 0x2ecc71,
+			map[string]string{"Pair": "XBTUSD", "Fiat spent": "5.00 USD", "Volume": "0.00010000 BTC", "Price": "50000.00 USD",
+				"Fee": "0.02 USD", "Transaction ID": "TXID-A", "Cost basis": "120.50 USD", "Tags": "goal=retirement,household=A"},
+		},
+		// the cost basis is only listed when the stats are reported
+		{
+			dca.RunSummary{Status: dca.RunStatusSuccess, Order: order},
+			"Bought 0.00010000 BTC", 0x2ecc71,
+			map[string]string{"Pair": "XBTUSD", "Fiat spent": "5.00 USD", "Transaction ID": "TXID-A"},
+		},
+		{
+			dca.RunSummary{Status: dca.RunStatusFailed, Error: "insufficient funds"},
+			"DCA run failed", 0xe74c3c, nil,
+		},
+	}
+	for i, tc := range tt {
+		var posts []discordPost
+		s := newDiscordTestServer(t, &posts)
+		if err := dca.NewDiscordNotifier(dca.DiscordConfig{WebhookURL: s.URL}).Notify(context.Background(), tc.summary); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if want, got := 1, len(posts); got != want || len(posts[0].Embeds) != 1 {
+			t.Fatalf("%d: want %v embed got %+v", i, want, posts)
+		}
+
+		embed := posts[0].Embeds[0]
+		if want, got := tc.title, embed.Title; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.color, embed.Color; got != want {
+			t.Errorf("%d: want %x got %x", i, want, got)
+		}
+		if want, got := tc.summary.Error, embed.Description; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		fields := map[string]string{}
+		for _, f := range embed.Fields {
+			fields[f.Name] = f.Value
+		}
+		for name, want := range tc.fields {
+			if got := fields[name]; got != want {
+				t.Errorf("%d: %s: want %v got %v", i, name, want, got)
+			}
+		}
+		if _, ok := fields["Cost basis"]; ok != (tc.summary.UnrealizedPnL != nil) {
+			t.Errorf("%d: want cost basis %v got %v", i, tc.summary.UnrealizedPnL != nil, fields)
+		}
+	}
+}
+
+func TestDiscordNotifier_Notify_Fallback(t *testing.T) {
+	var posts []discordPost
+	s := newDiscordTestServer(t, &posts)
+
+	// an amount that can't be shown makes the embed fail, the run is posted as its receipt line instead
+	summary := dca.RunSummary{Status: dca.RunStatusSuccess, Order: &dca.ExecuteOrderResponse{Pair: "XBTUSD", VolumePurchased: 0.0001, Price: math.NaN()}}
+	if err := dca.NewDiscordNotifier(dca.DiscordConfig{WebhookURL: s.URL}).Notify(context.Background(), summary); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, len(posts); got != want {
+		t.Fatalf("want %v got %v", want, got)
+	}
+	if len(posts[0].Embeds) != 0 || posts[0].Content == "" {
+		t.Errorf("want plain content got %+v", posts[0])
+	}
+}
+
+func TestDiscordNotifier_Notify_RateLimited(t *testing.T) {
+	summary := dca.RunSummary{Status: dca.RunStatusSkipped, SkipReason: dca.SkipReasonCircuitOpen}
+	tt := []struct {
+		responses []string
+		posts     int
+		valid     bool
+	}{
+		{nil, 1, true},
+		// a rate limited post is retried once after retry_after
+		{[]string{`429 {"message":"You are being rate limited.","retry_after":0.05,"global":false}`}, 2, true},
+		{[]string{`429 {"retry_after":0.01}`, `429 {"retry_after":0.01}`}, 2, false},
+		// waits longer than a run should be held up for aren't retried
+		{[]string{`429 {"retry_after":60}`}, 1, false},
+		{[]string{`400 {"message":"Cannot send an empty message"}`}, 1, false},
+	}
+	for i, tc := range tt {
+		var posts []discordPost
+		s := newDiscordTestServer(t, &posts, tc.responses...)
+
+		start := time.Now()
+		err := dca.NewDiscordNotifier(dca.DiscordConfig{WebhookURL: s.URL}).Notify(context.Background(), summary)
+		if want, got := tc.valid, err == nil; got != want {
+			t.Errorf("%d: want success %v got %v", i, want, err)
+		}
+		if want, got := tc.posts, len(posts); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if i == 1 && time.Since(start) < 50*time.Millisecond {
+			t.Errorf("%d: want the retry after retry_after got %v", i, time.Since(start))
+		}
+	}
+}
+
+func TestApp_Run_Discord(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":       {tickerResponse},
+		"/0/private/AddOrder":    {addOrderResponse},
+		"/0/private/QueryOrders": {queryOrdersResponse},
+	})
+
+	// a failing webhook never fails the run
+	var posts []discordPost
+	webhook := newDiscordTestServer(t, &posts, `400 {"message":"Unknown Webhook"}`)
+	app, n := newTestApp(s, dca.AppConfig{Discord: &dca.DiscordConfig{WebhookURL: webhook.URL}})
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := dca.RunStatusSuccess, n.summaries[0].Status; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := 1, len(posts); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestDiscordConfig_Validate(t *testing.T) {
+	tt := []struct {
+		config dca.DiscordConfig
+		valid  bool
+	}{
+		{dca.DiscordConfig{WebhookURL: "https://discord.com/api/webhooks/1/token"}, true},
+		{dca.DiscordConfig{WebhookURL: "awsssme:///discord/webhook"}, true},
+		{dca.DiscordConfig{WebhookURL: "discord.com/api/webhooks/1/token"}, false},
+		{dca.DiscordConfig{WebhookURL: "https:///api/webhooks/1/token"}, false},
+		{dca.DiscordConfig{}, false},
+	}
+	for i, tc := range tt {
+		if want, got := tc.valid, tc.config.Validate() == nil; got != want {
+			t.Errorf("%d: want valid %v got %v", i, want, tc.config.Validate())
+		}
+	}
+}
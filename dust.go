@@ -0,0 +1,267 @@
+package dca
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DustSweepUserRef tags the orders of a dust sweep so reconciliation doesn't mistake them for the run's order.
+const DustSweepUserRef = 0xD057
+
+// Actions taken on a balance by a dust sweep.
+const (
+	DustActionSold      = "sold"
+	DustActionWouldSell = "would_sell"
+	DustActionSkipped   = "skipped"
+	DustActionFailed    = "failed"
+)
+
+// DustSweepConfig sells small leftover balances of other assets after the purchase and buys the configured pair's
+// base asset with the proceeds.
+type DustSweepConfig struct {
+	// MaxValueInCents is the value in the quote currency below which a balance is swept.
+	MaxValueInCents int `json:"maxValueInCents" desc:"The value in cents of the quote currency below which a balance of another asset is swept" schema:"required"`
+	// DryRun reports what would be swept without trading, the sells are still validated by Kraken.
+	DryRun bool `json:"dryRun" desc:"Report what would be swept without trading, sells are still validated by Kraken"`
+}
+
+// Validate checks the configuration is usable.
+func (c DustSweepConfig) Validate() error {
+	if c.MaxValueInCents <= 0 {
+		return fieldErr("maxValueInCents", errors.New("dustSweep maxValueInCents must be positive"))
+	}
+	return nil
+}
+
+// DustAsset is what a dust sweep did with the balance of an asset.
+type DustAsset struct {
+	Asset   string  `json:"asset" desc:"The asset as named by the Balance endpoint" schema:"required"`
+	Pair    string  `json:"pair" desc:"The pair the asset is sold on" schema:"required"`
+	Balance float64 `json:"balance" desc:"The available balance of the asset" schema:"required"`
+	// Value is the balance at the bid in the quote currency.
+	Value  float64 `json:"value,omitempty" desc:"The balance at the bid in the quote currency"`
+	Action string  `json:"action" desc:"What was done with the balance" enum:"sold,would_sell,skipped,failed" schema:"required"`
+	Reason string  `json:"reason,omitempty" desc:"Why the balance was skipped or failed to sell"`
+	// Volume is the volume sold, the balance rounded down to the pair's lot decimals.
+	Volume float64 `json:"volume,omitempty" desc:"The volume sold, rounded down to the pair's lot decimals"`
+	// Proceeds is the cost of the sell less its fee, estimated at the bid by dry runs.
+	Proceeds      float64 `json:"proceeds,omitempty" desc:"What the sell returned in the quote currency after fees, estimated at the bid by dry runs"`
+	TransactionID string  `json:"transactionId,omitempty" desc:"The transaction id of the sell"`
+}
+
+// DustSweep is the outcome of a dust sweep.
+type DustSweep struct {
+	DryRun bool        `json:"dryRun,omitempty" desc:"Set when nothing was traded"`
+	Assets []DustAsset `json:"assets,omitempty" desc:"The balances below the threshold and what was done with them"`
+	// ProceedsInCents is the sum of the proceeds rounded down to cents, the amount of the buy.
+	ProceedsInCents int                   `json:"proceedsInCents" desc:"The sum of the proceeds in cents, the amount of the buy" schema:"required"`
+	Buy             *ExecuteOrderResponse `json:"buy,omitempty" desc:"The purchase made with the proceeds"`
+	// BuySkipped is why no purchase was made with the proceeds.
+	BuySkipped string `json:"buySkipped,omitempty" desc:"Why no purchase was made with the proceeds"`
+}
+
+// sweepDust sells the balances of other assets worth less than maxValueInCents and buys the pair's base asset with
+// the proceeds in a single order, since each balance alone would usually buy less than the pair's minimum. The
+// purchase already happened so every failure is only a warning. Sweep orders are tagged with DustSweepUserRef and
+// aren't recorded in the order store.
+func (m *App) sweepDust(ctx context.Context, summary *RunSummary) {
+	cfg := *m.Config.DustSweep
+	sweep := &DustSweep{DryRun: cfg.DryRun}
+	summary.DustSweep = sweep
+
+	provider := m.newKrakenProvider()
+	if cfg.DryRun {
+		provider.ReadOnly = true
+		provider.AllowValidateOrders = true
+	}
+	defer func() { summary.Warnings = append(summary.Warnings, provider.Warnings()...) }()
+
+	warn := func(msg string, err error) {
+		m.Logger.WarnContext(ctx, msg, "error", err)
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("%s: %v", msg, err))
+	}
+
+	order, err := provider.resolveOrder(m.Config.OrderRequest())
+	if err != nil {
+		warn("dust sweep failed", err)
+		return
+	}
+	pair := krakenPairs[order.Pair]
+
+	balances, err := provider.fetchBalances(ctx)
+	if err != nil {
+		warn("dust sweep failed", err)
+		return
+	}
+
+	assets := make([]string, 0, len(balances))
+	for asset, balance := range balances {
+		if balance > 0 && dustCandidate(asset, pair) {
+			assets = append(assets, asset)
+		}
+	}
+	slices.Sort(assets)
+
+	var proceeds float64
+	for _, asset := range assets {
+		d, ok := m.sweepDustAsset(ctx, provider, cfg, asset, balances[asset], pair.QuoteAsset)
+		if !ok {
+			continue
+		}
+		m.Logger.InfoContext(ctx, "swept dust", "asset", d.Asset, "pair", d.Pair, "action", d.Action, "reason", d.Reason,
+			"volume", m.Config.MoneyFormat().Crypto(d.Volume, ""), "proceeds", FormatFiat(d.Proceeds, ""), "transactionId", d.TransactionID)
+		if d.Action == DustActionFailed {
+			summary.Warnings = append(summary.Warnings, fmt.Sprintf("dust sweep of %s failed: %s", d.Asset, d.Reason))
+		}
+		sweep.Assets = append(sweep.Assets, d)
+		proceeds += d.Proceeds
+	}
+
+	sweep.ProceedsInCents = int(math.Floor(proceeds*100 + 1e-9))
+	if sweep.ProceedsInCents <= 0 {
+		return
+	}
+
+	m.loadPairMetadata(ctx, provider, order.Pair)
+	t, err := provider.fetchTicker(ctx, order.Pair)
+	if err != nil {
+		warn("dust sweep buy failed", err)
+		return
+	}
+	volume := float64(sweep.ProceedsInCents) / 100 / t.Ask
+	if minimum, perr := strconv.ParseFloat(provider.orderMin(order.Pair), 64); perr == nil && volume < minimum {
+		sweep.BuySkipped = fmt.Sprintf("%v: volume %v is below the %s minimum of %v", ErrOrderToSmall, volume, order.Pair, minimum)
+	} else if cfg.DryRun {
+		sweep.BuySkipped = "dry run"
+	}
+	if sweep.BuySkipped != "" {
+		m.Logger.InfoContext(ctx, "skipping the dust sweep buy", "amountInCents", sweep.ProceedsInCents, "reason", sweep.BuySkipped)
+		return
+	}
+
+	res, err := provider.ExecuteOrder(ctx, ExecuteOrderRequest{
+		AmountInCents: sweep.ProceedsInCents,
+		Pair:          order.Pair,
+		Side:          SideBuy,
+		UserRef:       DustSweepUserRef,
+		Label:         order.Label,
+		Tags:          order.Tags,
+	})
+	if err != nil {
+		warn("dust sweep buy failed", err)
+		return
+	}
+	m.Logger.InfoContext(ctx, "bought with the dust sweep proceeds", "result", res, "volume", m.Config.MoneyFormat().Crypto(res.VolumePurchased, ""),
+		"cost", FormatFiat(res.Cost, ""))
+	sweep.Buy = &res
+}
+
+// dustCandidate reports whether the balance of asset may be swept into the base asset of pair. Fiat, staked and
+// opt-in rewards balances, and Kraken's fee credits, are never swept.
+func dustCandidate(asset string, pair krakenPair) bool {
+	common := NormalizeKrakenAsset(asset)
+	return common != NormalizeKrakenAsset(pair.BaseAsset) && common != NormalizeKrakenAsset(pair.QuoteAsset) &&
+		!IsFiat(asset) && !strings.Contains(asset, ".") && asset != "KFEE"
+}
+
+// dustPair returns the pair asset is sold on for quote. Legacy assets trade under the concatenated Kraken codes,
+// e.g. XETHZUSD, newer ones under their code followed by the common code of the quote, e.g. ADAUSD.
+func dustPair(asset, quote string) string {
+	if _, legacy := krakenAssets[asset]; legacy && len(asset) == 4 {
+		return asset + quote
+	}
+	return asset + NormalizeKrakenAsset(quote)
+}
+
+// sweepDustAsset sells balance of asset for quote when it's worth less than the threshold, ok is false when it
+// isn't. Sells below the pair's minimums are skipped and every sell is validated by Kraken before it's placed.
+func (m *App) sweepDustAsset(ctx context.Context, provider *KrakenProvider, cfg DustSweepConfig, asset string, balance float64, quote string) (d DustAsset, ok bool) {
+	d = DustAsset{Asset: asset, Pair: dustPair(asset, quote), Balance: balance, Action: DustActionSkipped}
+
+	t, err := provider.fetchTicker(ctx, d.Pair)
+	if err != nil {
+		d.Reason = fmt.Sprintf("no price against %s: %v", NormalizeKrakenAsset(quote), err)
+		return d, true
+	}
+	if d.Value = balance * t.Bid; d.Value*100 >= float64(cfg.MaxValueInCents) {
+		return d, false
+	}
+
+	md, err := provider.GetPairMetadata(ctx, d.Pair)
+	if err != nil {
+		d.Reason = fmt.Sprintf("no market against %s: %v", NormalizeKrakenAsset(quote), err)
+		return d, true
+	}
+	volume, err := roundVolumeDown(balance, lotIncrement(md.LotDecimals))
+	if err != nil {
+		d.Action, d.Reason = DustActionFailed, err.Error()
+		return d, true
+	}
+	d.Volume, _ = strconv.ParseFloat(volume, 64)
+
+	if minimum, perr := strconv.ParseFloat(md.OrderMin, 64); perr == nil && d.Volume < minimum {
+		d.Reason = fmt.Sprintf("volume %s is below the %s minimum of %s", volume, d.Pair, md.OrderMin)
+		return d, true
+	}
+	if minimum, perr := strconv.ParseFloat(md.CostMin, 64); perr == nil && d.Volume*t.Bid < minimum {
+		d.Reason = fmt.Sprintf("value %s is below the %s minimum cost of %s", FormatFiat(d.Volume*t.Bid, ""), d.Pair, md.CostMin)
+		return d, true
+	}
+
+	sell := ExecuteOrderRequest{Pair: d.Pair, Side: SideSell, UserRef: DustSweepUserRef}
+	if _, err = provider.validateOrder(ctx, sell, volume); err != nil {
+		d.Action, d.Reason = DustActionFailed, err.Error()
+		return d, true
+	}
+	if cfg.DryRun {
+		d.Action, d.Proceeds = DustActionWouldSell, d.Volume*t.Bid
+		return d, true
+	}
+
+	if d.TransactionID, _, err = provider.addOrder(ctx, sell, url.Values{"volume": {volume}, "ordertype": {"market"}}); err != nil {
+		d.Action, d.Reason = DustActionFailed, err.Error()
+		return d, true
+	}
+	d.Action = DustActionSold
+
+	// the sell was placed, proceeds that can't be read are only left out of the buy
+	oi, err := provider.queryOrderInfo(ctx, d.TransactionID)
+	if err != nil {
+		d.Reason = fmt.Sprintf("failed to read the proceeds: %v", err)
+		return d, true
+	}
+	d.Proceeds = max(oi.Cost-oi.Fee, 0)
+	return d, true
+}
+
+// lotIncrement returns the smallest volume of a pair with decimals lot decimals, e.g. 0.001 for 3.
+func lotIncrement(decimals int) string {
+	if decimals <= 0 {
+		return "1"
+	}
+	return "0." + strings.Repeat("0", decimals-1) + "1"
+}
+
+// fetchBalances returns the available balance of every asset of the account, keyed by the asset's Kraken code.
+func (p *KrakenProvider) fetchBalances(ctx context.Context) (balances map[string]float64, err error) {
+	defer WrapErr(&err, "fetchBalances")
+
+	var result map[string]string
+	if err = p.privateRequest(ctx, "/0/private/Balance", url.Values{}, &result); err != nil {
+		return nil, fmt.Errorf("failed to fetch balance: %w", err)
+	}
+
+	balances = make(map[string]float64, len(result))
+	for asset, v := range result {
+		if balances[asset], err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, fmt.Errorf("failed to parse balance of %s: %w", asset, err)
+		}
+	}
+	return balances, nil
+}
@@ -0,0 +1,108 @@
+package dca_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/1gm/dca"
+)
+
+func TestApp_Run_DustSweep(t *testing.T) {
+	ticker := func(price string) string {
+		return `{"error":[],"result":{"X":{"a":["` + price + `","1","1.000"],"b":["` + price + `","1","1.000"]}}}`
+	}
+	assetPairs := func(orderMin string) string {
+		return `{"error":[],"result":{"X":{"ordermin":"` + orderMin + `","costmin":"0.5","pair_decimals":6,"lot_decimals":8}}}`
+	}
+
+	tt := []struct {
+		dryRun   bool
+		actions  []string
+		proceeds int
+		buy      bool
+		addOrder int
+	}{
+		// ADA is sold and bought with, SOL is below the minimum and XETH is worth more than the threshold
+		{false, []string{dca.DustActionSold, dca.DustActionSkipped}, 398, true, 4},
+		// the sell is only validated and proceeds are estimated at the bid
+		{true, []string{dca.DustActionWouldSell, dca.DustActionSkipped}, 400, false, 2},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			// the run's order, ADA, SOL, XETH, then the buy's minimum check and order
+			"/0/public/Ticker":     {tickerResponse, ticker("0.40"), ticker("150"), ticker("3000"), tickerResponse},
+			"/0/public/AssetPairs": {assetPairs("5"), assetPairs("0.02")},
+			"/0/private/Balance": {
+				`{"error":[],"result":{"ZUSD":"100.0000","XXBT":"0.1","ADA":"10.00000000","SOL":"0.01","XETH":"1.0","DOT.S":"3","KFEE":"500"}}`,
+			},
+			"/0/private/AddOrder": {
+				addOrderResponse,
+				`{"error":[],"result":{"descr":{"order":"sell 10.00000000 ADAUSD @ market"}}}`,
+				`{"error":[],"result":{"txid":["TXID-ADA"],"descr":{"order":"sell 10.00000000 ADAUSD @ market"}}}`,
+				addOrderResponse,
+			},
+			"/0/private/QueryOrders": {
+				queryOrdersResponse,
+				`{"error":[],"result":{"TXID-ADA":{"status":"closed","vol":"10","vol_exec":"10","cost":"4.00","fee":"0.016","price":"0.40"}}}`,
+				queryOrdersResponse,
+			},
+		})
+		app, n := newTestApp(s, dca.AppConfig{DustSweep: &dca.DustSweepConfig{MaxValueInCents: 1000, DryRun: tc.dryRun}})
+
+		if err := app.Run(context.Background()); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		sweep := n.summaries[0].DustSweep
+		if sweep == nil {
+			t.Fatalf("%d: want a dust sweep", i)
+		}
+		if want, got := len(tc.actions), len(sweep.Assets); got != want {
+			t.Fatalf("%d: want %v got %+v", i, want, sweep.Assets)
+		}
+		for j, want := range tc.actions {
+			if got := sweep.Assets[j].Action; got != want {
+				t.Errorf("%d: %s: want %v got %v (%s)", i, sweep.Assets[j].Asset, want, got, sweep.Assets[j].Reason)
+			}
+		}
+		if want, got := "ADAUSD", sweep.Assets[0].Pair; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.proceeds, sweep.ProceedsInCents; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.buy, sweep.Buy != nil; got != want {
+			t.Errorf("%d: want %v got %v (%s)", i, want, got, sweep.BuySkipped)
+		}
+		if want, got := 0, len(n.summaries[0].Warnings); got != want {
+			t.Errorf("%d: want %v got %v", i, want, n.summaries[0].Warnings)
+		}
+
+		orders := s.Requests("/0/private/AddOrder")
+		if want, got := tc.addOrder, len(orders); got != want {
+			t.Fatalf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := "true", orders[1].Get("validate"); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := "10.00000000", orders[1].Get("volume"); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if !tc.dryRun {
+			if want, got := "sell", orders[2].Get("type"); got != want {
+				t.Errorf("%d: want %v got %v", i, want, got)
+			}
+			// the buy spends the proceeds and is tagged so it isn't reconciled as the run's order
+			if want, got := "buy", orders[3].Get("type"); got != want {
+				t.Errorf("%d: want %v got %v", i, want, got)
+			}
+			if want, got := tc.proceeds, sweep.Buy.AmountInCents; got != want {
+				t.Errorf("%d: want %v got %v", i, want, got)
+			}
+			if want, got := "53335", orders[3].Get("userref"); got != want {
+				t.Errorf("%d: want %v got %v", i, want, got)
+			}
+		}
+	}
+}
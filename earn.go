@@ -0,0 +1,83 @@
+package dca
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// EarnAllocation describes purchased volume allocated to a Kraken Earn strategy. Kraken processes allocations
+// asynchronously and doesn't assign them an identifier, the strategy and amount identify the allocation.
+type EarnAllocation struct {
+	StrategyID string  `json:"strategyId" desc:"The earn strategy allocated to" schema:"required"`
+	Asset      string  `json:"asset" desc:"The allocated asset" schema:"required"`
+	Amount     float64 `json:"amount" desc:"The allocated volume" schema:"required"`
+	// Pending is set while Kraken is still processing the allocation.
+	Pending bool `json:"pending" desc:"Set while Kraken is still processing the allocation" schema:"required"`
+}
+
+// earnStrategy is the subset of a Kraken Earn strategy used to validate allocations.
+type earnStrategy struct {
+	ID                string `json:"id"`
+	Asset             string `json:"asset"`
+	CanAllocate       bool   `json:"can_allocate"`
+	UserMinAllocation string `json:"user_min_allocation"`
+}
+
+// AllocateEarn allocates amount of the strategy's asset to the Kraken Earn strategy identified by strategyID.
+// ErrEarnBelowMinimum is returned without allocating when amount is below the strategy's minimum allocation.
+func (p *KrakenProvider) AllocateEarn(ctx context.Context, strategyID string, amount float64) (alloc EarnAllocation, err error) {
+	defer WrapErr(&err, "KrakenProvider.AllocateEarn")
+
+	var strategy earnStrategy
+	if strategy, err = p.fetchEarnStrategy(ctx, strategyID); err != nil {
+		return alloc, err
+	}
+
+	if !strategy.CanAllocate {
+		return alloc, fmt.Errorf("earn strategy %s does not accept allocations", strategyID)
+	}
+
+	if strategy.UserMinAllocation != "" {
+		var minimum float64
+		if minimum, err = strconv.ParseFloat(strategy.UserMinAllocation, 64); err != nil {
+			return alloc, fmt.Errorf("failed to parse minimum allocation: %w", err)
+		} else if amount < minimum {
+			return alloc, fmt.Errorf("%w: %s is below %s", ErrEarnBelowMinimum, FormatCrypto(amount, ""), FormatCrypto(minimum, ""))
+		}
+	}
+
+	p.Logger.InfoContext(ctx, "allocating to earn strategy", "strategyId", strategyID, "asset", strategy.Asset, "amount", amount)
+
+	var accepted bool
+	if err = p.privateRequest(ctx, "/0/private/Earn/Allocate", url.Values{
+		"strategy_id": {strategyID},
+		"amount":      {strconv.FormatFloat(amount, 'f', -1, 64)},
+	}, &accepted); err != nil {
+		return alloc, fmt.Errorf("failed to allocate: %w", err)
+	} else if !accepted {
+		return alloc, fmt.Errorf("allocation to earn strategy %s was not accepted", strategyID)
+	}
+
+	return EarnAllocation{StrategyID: strategyID, Asset: strategy.Asset, Amount: amount, Pending: true}, nil
+}
+
+// fetchEarnStrategy looks up a single Kraken Earn strategy by its identifier.
+func (p *KrakenProvider) fetchEarnStrategy(ctx context.Context, strategyID string) (strategy earnStrategy, err error) {
+	defer WrapErr(&err, "fetchEarnStrategy")
+
+	var result struct {
+		Items []earnStrategy `json:"items"`
+	}
+	if err = p.privateRequest(ctx, "/0/private/Earn/Strategies", url.Values{}, &result); err != nil {
+		return strategy, fmt.Errorf("failed to list earn strategies: %w", err)
+	}
+
+	for _, item := range result.Items {
+		if item.ID == strategyID {
+			return item, nil
+		}
+	}
+	return strategy, fmt.Errorf("%w: %s", ErrUnknownEarnStrategy, strategyID)
+}
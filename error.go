@@ -3,15 +3,86 @@ package dca
 import (
 	"errors"
 	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
 )
 
+// maxStackFrames bounds the number of frames captured by WrapErr and AddErr.
+const maxStackFrames = 16
+
+var captureErrStack atomic.Bool
+
+// SetErrStackCapture enables or disables stack capture in WrapErr and AddErr and returns the previous setting, it's
+// disabled by default. Capturing doesn't change error messages, the stack is exposed through a StackTrace() string
+// method. The setting applies to the whole process so it's left to the program rather than to an App, e.g.
+//
+//	defer dca.SetErrStackCapture(dca.SetErrStackCapture(true))
+func SetErrStackCapture(enabled bool) (previous bool) {
+	return captureErrStack.Swap(enabled)
+}
+
+// stackError carries the stack of the function that first added context to an error.
+type stackError struct {
+	err   error
+	stack string
+	wrap  bool
+}
+
+func (e *stackError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error for errors created by WrapErr, errors created by AddErr stay opaque.
+func (e *stackError) Unwrap() error {
+	if !e.wrap {
+		return nil
+	}
+	return errors.Unwrap(e.err)
+}
+
+// StackTrace returns the captured stack, one "function file:line" per line with the deferring function first.
+func (e *stackError) StackTrace() string {
+	return e.stack
+}
+
+// withStack attaches the caller's stack to err when capture is enabled and no stack was captured deeper in the chain.
+func withStack(err, cause error, wrap bool) error {
+	if !captureErrStack.Load() {
+		return err
+	}
+
+	var st interface{ StackTrace() string }
+	if errors.As(cause, &st) {
+		// keep the stack closest to where the error happened
+		return &stackError{err: err, stack: st.StackTrace(), wrap: wrap}
+	}
+
+	// skip runtime.Callers, withStack and AddErr/WrapErr
+	pcs := make([]uintptr, maxStackFrames)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+
+	var b strings.Builder
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "" && !strings.HasPrefix(frame.Function, "runtime.") {
+			fmt.Fprintf(&b, "%s %s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	return &stackError{err: err, stack: b.String(), wrap: wrap}
+}
+
 // AddErr adds context and creates an opaque error.
 // Example use:
 //
 //	defer AddErr(&err, "LoginUser('%q','******')", user.Name)
 func AddErr(err *error, tmpl string, args ...any) {
 	if *err != nil {
-		*err = fmt.Errorf("%s: %v", fmt.Sprintf(tmpl, args...), *err)
+		*err = withStack(fmt.Errorf("%s: %v", fmt.Sprintf(tmpl, args...), *err), *err, false)
 	}
 }
 
@@ -21,7 +92,7 @@ func AddErr(err *error, tmpl string, args ...any) {
 //	defer WrapErr(&err, "LoginUser('%q','******')", user.Name)
 func WrapErr(err *error, tmpl string, args ...any) {
 	if *err != nil {
-		*err = fmt.Errorf("%s: %w", fmt.Sprintf(tmpl, args...), *err)
+		*err = withStack(fmt.Errorf("%s: %w", fmt.Sprintf(tmpl, args...), *err), *err, true)
 	}
 }
 
@@ -30,4 +101,165 @@ var (
 	ErrOrderToSmall = errors.New("order is too small")
 	// ErrInvalidAuth occurs when an API credential is invalid
 	ErrInvalidAuth = errors.New("invalid auth")
+	// ErrCancelOnlyMode occurs when the exchange only accepts order cancellations
+	ErrCancelOnlyMode = errors.New("market is in cancel_only mode")
+	// ErrPostOnlyMode occurs when the exchange only accepts post-only limit orders
+	ErrPostOnlyMode = errors.New("market is in post_only mode")
+	// ErrInsufficientFunds occurs when the account balance cannot cover an order
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	// ErrUnknownAsset occurs when an asset isn't recognised by the exchange
+	ErrUnknownAsset = errors.New("unknown asset")
+	// ErrUnknownDepositMethod occurs when a deposit method isn't recognised by the exchange
+	ErrUnknownDepositMethod = errors.New("unknown deposit method")
+	// ErrPermissionDenied occurs when an API credential lacks the permissions for a request
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrUnsupportedPair occurs when a provider can't trade the requested pair
+	ErrUnsupportedPair = errors.New("unsupported pair")
+	// ErrHistoryUnavailable occurs when historical data isn't available for the requested period
+	ErrHistoryUnavailable = errors.New("history unavailable")
+	// ErrResponseTooLarge occurs when a response body exceeds the configured size limit
+	ErrResponseTooLarge = errors.New("response too large")
+	// ErrEarnBelowMinimum occurs when an earn allocation is below the strategy's minimum allocation
+	ErrEarnBelowMinimum = errors.New("allocation is below the earn strategy minimum")
+	// ErrEarnBusy occurs when another allocation to the same earn strategy is still being processed
+	ErrEarnBusy = errors.New("earn strategy allocation in progress")
+	// ErrUnknownEarnStrategy occurs when an earn strategy doesn't exist
+	ErrUnknownEarnStrategy = errors.New("unknown earn strategy")
+	// ErrRateLimited occurs when the exchange rejects a call for exceeding the API rate limit
+	ErrRateLimited = errors.New("rate limit exceeded")
+	// ErrExchangeUnavailable occurs when the exchange is temporarily unable to handle requests, e.g. a 5xx response
+	ErrExchangeUnavailable = errors.New("exchange unavailable")
+	// ErrParameterNotFound occurs when a parameter referenced in the AWS param store doesn't exist
+	ErrParameterNotFound = errors.New("parameter not found")
+	// ErrParameterThrottled occurs when the AWS param store rejects a read for exceeding its rate limit
+	ErrParameterThrottled = errors.New("parameter store throttled")
+	// ErrNoAWSSupport occurs when an AWS integration is used by a build which doesn't register an AWSBackend
+	ErrNoAWSSupport = errors.New("built without AWS support")
+	// ErrIntegrationCheck occurs when an integration fails its check before a run orders and strictIntegrations is set
+	ErrIntegrationCheck = errors.New("integration check failed")
+	// ErrInvalidReceipt occurs when a signed receipt doesn't verify against the expected key
+	ErrInvalidReceipt = errors.New("invalid signed receipt")
+	// ErrReadOnlyMode occurs when a read-only provider is asked to call an endpoint that changes the account
+	ErrReadOnlyMode = errors.New("provider is in read-only mode")
+	// ErrConfirmationRequired occurs when an order needs confirmation but there is no terminal to ask on
+	ErrConfirmationRequired = errors.New("order requires confirmation")
+	// ErrUnknownProfile occurs when the selected profile isn't defined by the config
+	ErrUnknownProfile = errors.New("unknown profile")
+	// ErrDepositPending happens when an order can't be funded until a pending deposit clears
+	ErrDepositPending = &SkipError{Reason: SkipReasonDepositPending}
+	// ErrCircuitOpen happens when an order isn't attempted because the provider's circuit breaker is open
+	ErrCircuitOpen = &SkipError{Reason: SkipReasonCircuitOpen}
+	// ErrPriceDeviation happens when the price of an order is too far from the price of the previous purchase
+	ErrPriceDeviation = &SkipError{Reason: SkipReasonPriceDeviation}
+	// ErrOrderDeclined happens when an order isn't confirmed at the prompt
+	ErrOrderDeclined = &SkipError{Reason: SkipReasonDeclined}
+	// ErrPaused happens when runs are paused by the config or the pause parameter
+	ErrPaused = &SkipError{Reason: SkipReasonPaused}
+	// ErrBudgetSpent happens when the orders of the month have spent its budget
+	ErrBudgetSpent = &SkipError{Reason: SkipReasonBudgetSpent}
+	// ErrPriceAboveLadder happens when the price is above the highest tier of the price ladder
+	ErrPriceAboveLadder = &SkipError{Reason: SkipReasonPriceAboveLadder}
+	// ErrConversionFailed happens when the conversion of the alternate funding asset before a purchase fails
+	ErrConversionFailed = errors.New("funding conversion failed")
+	// ErrInterrupted happens when the context of a run is cancelled before the run finished
+	ErrInterrupted = errors.New("run interrupted")
+	// ErrRunTimeout happens when a run takes longer than its runTimeout, or a step which mustn't be cut short doesn't
+	// have enough of it left to start
+	ErrRunTimeout = errors.New("run timeout exceeded")
+	// ErrPanic matches a *PanicError, a panic recovered during a run
+	ErrPanic = errors.New("panic")
+	// ErrClockSkew matches a *ClockSkewError, the local clock is too far from Kraken's
+	ErrClockSkew = errors.New("clock skew")
+	// ErrGuard happens when a guard fails to decide on a purchase with guardFailurePolicy closed
+	ErrGuard = errors.New("guard failed")
+)
+
+// SkipReason describes why a run didn't place an order.
+type SkipReason string
+
+const (
+	// SkipReasonDepositPending indicates a pending deposit will cover an order once it clears.
+	SkipReasonDepositPending SkipReason = "deposit_pending"
+	// SkipReasonOrderAdopted indicates an order placed by a previous run was adopted in place of a new order.
+	SkipReasonOrderAdopted SkipReason = "order_adopted"
+	// SkipReasonCircuitOpen indicates the provider's circuit breaker is open after repeated failures.
+	SkipReasonCircuitOpen SkipReason = "circuit_open"
+	// SkipReasonPriceDeviation indicates the current price is implausibly far from the previous purchase price.
+	SkipReasonPriceDeviation SkipReason = "price_deviation"
+	// SkipReasonDeclined indicates the order was declined, or not confirmed in time, at the confirmation prompt.
+	SkipReasonDeclined SkipReason = "declined"
+	// SkipReasonPaused indicates runs are paused.
+	SkipReasonPaused SkipReason = "paused"
+	// SkipReasonBudgetSpent indicates the monthly budget has been spent.
+	SkipReasonBudgetSpent SkipReason = "budget_spent"
+	// SkipReasonPriceAboveLadder indicates the price is above the highest tier of the price ladder.
+	SkipReasonPriceAboveLadder SkipReason = "price_above_ladder"
+	// SkipReasonDuplicate indicates the run's idempotency key was already committed with an order.
+	SkipReasonDuplicate SkipReason = "duplicate"
+	// SkipReasonGuard indicates a custom guard skipped the run.
+	SkipReasonGuard SkipReason = "guard"
 )
+
+// SkipError is returned when an order was intentionally not placed, it isn't considered a failure.
+type SkipError struct {
+	Reason SkipReason
+}
+
+func (e *SkipError) Error() string {
+	return "order skipped: " + string(e.Reason)
+}
+
+// Is reports whether target is a *SkipError with the same reason, e.g. ErrPaused for the skip of a paused run.
+func (e *SkipError) Is(target error) bool {
+	t, ok := target.(*SkipError)
+	return ok && t.Reason == e.Reason
+}
+
+// OrderInfoError occurs when a field of an order's execution details can't be parsed.
+type OrderInfoError struct {
+	// Field is the field that failed to parse, one of fee, cost, price or volume.
+	Field string
+	// Raw is the value returned by the exchange.
+	Raw string
+	Err error
+}
+
+func (e *OrderInfoError) Error() string {
+	return fmt.Sprintf("failed to parse %s %q: %v", e.Field, e.Raw, e.Err)
+}
+
+func (e *OrderInfoError) Unwrap() error {
+	return e.Err
+}
+
+// PanicError is a recovered panic, it carries the value passed to panic and the stack of the goroutine that panicked.
+type PanicError struct {
+	Value any
+	Stack string
+}
+
+// NewPanicError converts the value returned by recover into an error, call it from the deferred function so the
+// stack still includes the frames that panicked.
+func NewPanicError(value any) *PanicError {
+	return &PanicError{Value: value, Stack: string(debug.Stack())}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Is matches ErrPanic.
+func (e *PanicError) Is(target error) bool {
+	return target == ErrPanic
+}
+
+// Unwrap returns the value passed to panic when it's an error, e.g. a runtime error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// StackTrace returns the stack of the panic.
+func (e *PanicError) StackTrace() string {
+	return e.Stack
+}
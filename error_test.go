@@ -0,0 +1,68 @@
+package dca_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/1gm/dca"
+)
+
+var errTest = errors.New("boom")
+
+func failingInner() (err error) {
+	defer dca.WrapErr(&err, "inner")
+	return errTest
+}
+
+func failingOuter(opaque bool) (err error) {
+	if opaque {
+		defer dca.AddErr(&err, "outer(%d)", 1)
+	} else {
+		defer dca.WrapErr(&err, "outer(%d)", 1)
+	}
+	return failingInner()
+}
+
+func TestWrapErr_StackCapture(t *testing.T) {
+	type stackTracer interface{ StackTrace() string }
+
+	tt := []struct {
+		capture bool
+		opaque  bool
+		message string
+		is      bool
+	}{
+		{false, false, "outer(1): inner: boom", true},
+		{false, true, "outer(1): inner: boom", false},
+		{true, false, "outer(1): inner: boom", true},
+		{true, true, "outer(1): inner: boom", false},
+	}
+	for i, tc := range tt {
+		previous := dca.SetErrStackCapture(tc.capture)
+		err := failingOuter(tc.opaque)
+		if want, got := tc.capture, dca.SetErrStackCapture(previous); got != want {
+			t.Errorf("%d: want previous setting %v got %v", i, want, got)
+		}
+
+		if want, got := tc.message, err.Error(); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.is, errors.Is(err, errTest); got != want {
+			t.Errorf("%d: want errors.Is %v got %v", i, want, got)
+		}
+
+		var st stackTracer
+		if want, got := tc.capture, errors.As(err, &st); got != want {
+			t.Fatalf("%d: want stack %v got %v", i, want, got)
+		}
+		if !tc.capture {
+			continue
+		}
+		// the stack is captured where the error was first wrapped
+		lines := strings.Split(st.StackTrace(), "\n")
+		if !strings.Contains(lines[0], "failingInner") || !strings.Contains(lines[0], "error_test.go:") {
+			t.Errorf("%d: unexpected stack %q", i, st.StackTrace())
+		}
+	}
+}
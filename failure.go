@@ -0,0 +1,223 @@
+package dca
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// S3Prefix is the prefix of failure archives stored in S3, e.g. s3://bucket/dca/failures.
+const S3Prefix = "s3://"
+
+// FailureRecord is the post-mortem of a failed run written to a FailureArchive.
+type FailureRecord struct {
+	SchemaVersion int       `json:"schemaVersion" desc:"The version of the failure record schema" schema:"required"`
+	RunID         string    `json:"runId" desc:"The identifier of the failed run, also found in its logs and summary" schema:"required"`
+	FailedAt      time.Time `json:"failedAt" desc:"When the run failed, in the reporting time zone" schema:"required"`
+	// DurationSeconds is the time from the start of the run to the failure.
+	DurationSeconds float64 `json:"durationSeconds" desc:"How long the run took to fail in seconds" schema:"required"`
+	// ConfigFingerprint is the SHA-256 of the config with its secrets masked, runs with the same config share it.
+	ConfigFingerprint string `json:"configFingerprint" desc:"The SHA-256 of the config with secrets masked" schema:"required"`
+	Error             string `json:"error" desc:"Why the run failed" schema:"required"`
+	// Causes is the chain of errors from the outermost to the root cause.
+	Causes []FailureCause `json:"causes" desc:"The chain of errors from the outermost to the root cause" schema:"required"`
+	// Stack is the stack of the error, it's only captured when stack capture is enabled, see SetErrStackCapture, or the run panicked.
+	Stack   string     `json:"stack,omitempty" desc:"The stack of the error when stack capture was enabled or the run panicked"`
+	Summary RunSummary `json:"summary" desc:"The summary of the failed run" schema:"required"`
+}
+
+// FailureCause is an error in the chain of a run failure.
+type FailureCause struct {
+	Message string `json:"message" desc:"The error message" schema:"required"`
+	Type    string `json:"type" desc:"The Go type of the error" schema:"required"`
+	// Class is transient for failures a retry may fix, business for failures it won't and unknown otherwise.
+	Class string `json:"class" desc:"Whether a retry may fix the failure" enum:"transient,business,skip,unknown" schema:"required"`
+}
+
+// businessErrors are failures a retry won't fix.
+var businessErrors = []error{
+	ErrOrderToSmall, ErrInvalidAuth, ErrInsufficientFunds, ErrPermissionDenied, ErrUnsupportedPair, ErrUnknownAsset,
+	ErrCancelOnlyMode, ErrPostOnlyMode, ErrReadOnlyMode, ErrConfirmationRequired, ErrResponseTooLarge,
+}
+
+// classifyError describes whether a retry may fix err.
+func classifyError(err error) string {
+	var skip *SkipError
+	switch {
+	case errors.As(err, &skip):
+		return "skip"
+	case IsTransient(err):
+		return "transient"
+	}
+	for _, target := range businessErrors {
+		if errors.Is(err, target) {
+			return "business"
+		}
+	}
+	return "unknown"
+}
+
+// failureCauses flattens the chain of err, joined errors are listed depth first.
+func failureCauses(err error) []FailureCause {
+	var causes []FailureCause
+	for err != nil {
+		causes = append(causes, FailureCause{Message: err.Error(), Type: fmt.Sprintf("%T", err), Class: classifyError(err)})
+		switch u := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, e := range u.Unwrap() {
+				causes = append(causes, failureCauses(e)...)
+			}
+			return causes
+		default:
+			err = errors.Unwrap(err)
+		}
+	}
+	return causes
+}
+
+// Fingerprint returns the SHA-256 of the config with its secrets masked.
+func (c AppConfig) Fingerprint() string {
+	b, _ := json.Marshal(c.masked())
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// newRunID returns a random identifier for a run.
+func newRunID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// FailureArchive keeps the post-mortems of failed runs.
+type FailureArchive interface {
+	Archive(ctx context.Context, rec FailureRecord) error
+}
+
+// NewFailureArchive returns the archive at location, an S3 URL such as s3://bucket/prefix or a local directory.
+func NewFailureArchive(location string) (FailureArchive, error) {
+	if !strings.HasPrefix(location, S3Prefix) {
+		return &DirFailureArchive{Dir: location}, nil
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid failureArchive: %w", err)
+	} else if u.Host == "" {
+		return nil, errors.New("failureArchive is missing an S3 bucket")
+	}
+	return &S3FailureArchive{S3Location: S3Location{Bucket: u.Host}, Prefix: strings.Trim(u.Path, "/")}, nil
+}
+
+// failureRecordName names the document of rec so documents sort by time.
+func failureRecordName(rec FailureRecord) string {
+	return rec.FailedAt.UTC().Format("20060102T150405Z") + "-" + rec.RunID + ".json"
+}
+
+// DirFailureArchive is a FailureArchive writing a JSON document per failure to a local directory.
+type DirFailureArchive struct {
+	Dir string
+}
+
+func (a *DirFailureArchive) Archive(_ context.Context, rec FailureRecord) (err error) {
+	defer WrapErr(&err, "DirFailureArchive.Archive")
+
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal failure record: %w", err)
+	}
+	if err = os.MkdirAll(a.Dir, 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(a.Dir, failureRecordName(rec)), append(b, '\n'))
+}
+
+// Check makes sure the directory can be written to, without archiving anything.
+func (a *DirFailureArchive) Check(_ context.Context) (err error) {
+	defer WrapErr(&err, "DirFailureArchive.Check")
+	return checkWritableDir(a.Dir)
+}
+
+// S3FailureArchive is a FailureArchive writing a JSON document per failure under a prefix of an S3 bucket. Requests
+// are signed with the default AWS credentials.
+type S3FailureArchive struct {
+	S3Location
+	Prefix string
+}
+
+func (a *S3FailureArchive) Archive(ctx context.Context, rec FailureRecord) (err error) {
+	defer WrapErr(&err, "S3FailureArchive.Archive")
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal failure record: %w", err)
+	}
+	if err = a.do(ctx, "PUT", path.Join(a.Prefix, failureRecordName(rec)), b); err != nil {
+		return fmt.Errorf("failed to put failure record: %w", err)
+	}
+	return nil
+}
+
+// Check makes a HeadBucket request so a missing bucket or credentials without access are found before a run orders.
+func (a *S3FailureArchive) Check(ctx context.Context) (err error) {
+	defer WrapErr(&err, "S3FailureArchive.Check")
+
+	if err = a.do(ctx, "HEAD", "", nil); err != nil {
+		return fmt.Errorf("failed to head bucket: %w", err)
+	}
+	return nil
+}
+
+// do sends a request for the object key of the bucket, the bucket itself when key is empty.
+func (a *S3FailureArchive) do(ctx context.Context, method, key string, b []byte) error {
+	_, err := s3Request(ctx, a.object(key), method, b)
+	return err
+}
+
+// archiveFailure writes the post-mortem of a failed run to the configured failure archive. Archiving never changes
+// the outcome of the run so failures are only logged.
+func (m *App) archiveFailure(ctx context.Context, summary RunSummary, runErr error) {
+	if m.Config.FailureArchive == "" {
+		return
+	}
+
+	failedAt := time.Now().In(m.Config.Location())
+	rec := FailureRecord{
+		SchemaVersion:     SchemaVersion,
+		RunID:             summary.RunID,
+		FailedAt:          failedAt,
+		DurationSeconds:   failedAt.Sub(summary.StartedAt).Seconds(),
+		ConfigFingerprint: m.Config.Fingerprint(),
+		Error:             runErr.Error(),
+		Causes:            failureCauses(runErr),
+		Summary:           summary,
+	}
+	var st interface{ StackTrace() string }
+	if errors.As(runErr, &st) {
+		rec.Stack = st.StackTrace()
+	}
+
+	// the location is validated by LoadConfig
+	archive, err := NewFailureArchive(m.Config.FailureArchive)
+	if s3, ok := archive.(*S3FailureArchive); ok {
+		s3.HTTPClient = m.httpClient()
+	}
+	if err == nil {
+		err = archive.Archive(ctx, rec)
+	}
+	if err != nil {
+		m.Logger.WarnContext(ctx, "failed to archive the failure", "error", err)
+		return
+	}
+	m.Logger.InfoContext(ctx, "archived the failure", "failureArchive", m.Config.FailureArchive)
+}
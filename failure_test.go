@@ -0,0 +1,149 @@
+package dca_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+func TestApp_Run_FailureArchive(t *testing.T) {
+	tt := []struct {
+		addOrder string
+		archived bool
+	}{
+		{`{"error":["EOrder:Insufficient funds"]}`, true},
+		// only failures are archived
+		{addOrderResponse, false},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {tc.addOrder},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		dir := filepath.Join(t.TempDir(), "failures")
+		app, n := newTestApp(s, dca.AppConfig{FailureArchive: dir})
+
+		runErr := app.Run(context.Background())
+
+		files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		if want, got := tc.archived, len(files) == 1; got != want {
+			t.Fatalf("%d: want archived %v got %v", i, want, files)
+		} else if !tc.archived {
+			continue
+		}
+
+		b, err := os.ReadFile(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rec dca.FailureRecord
+		if err = json.Unmarshal(b, &rec); err != nil {
+			t.Fatal(err)
+		}
+
+		summary := n.summaries[0]
+		if summary.RunID == "" || rec.RunID != summary.RunID {
+			t.Errorf("%d: want run id %q got %q", i, summary.RunID, rec.RunID)
+		}
+		if !strings.HasSuffix(files[0], "-"+summary.RunID+".json") {
+			t.Errorf("%d: want the run id in %v", i, files[0])
+		}
+		if want, got := runErr.Error(), rec.Error; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := dca.SchemaVersion, rec.SchemaVersion; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := dca.RunStatusFailed, rec.Summary.Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := app.Config.Fingerprint(), rec.ConfigFingerprint; got != want || len(got) != 64 {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		// the root cause is classified and no secret is written
+		if last := rec.Causes[len(rec.Causes)-1]; last.Message != dca.ErrInsufficientFunds.Error() || last.Class != "business" {
+			t.Errorf("%d: unexpected root cause %+v", i, last)
+		}
+		if strings.Contains(string(b), app.Config.KrakenPrivateKey) {
+			t.Errorf("%d: failure record contains the private key", i)
+		}
+	}
+}
+
+func TestApp_Run_FailureArchiveFails(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":       {tickerResponse},
+		"/0/private/AddOrder":    {`{"error":["EOrder:Insufficient funds"]}`},
+	})
+	// a file where the directory should be
+	blocked := filepath.Join(t.TempDir(), "failures")
+	if err := os.WriteFile(blocked, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	app, n := newTestApp(s, dca.AppConfig{FailureArchive: blocked})
+
+	// archiving never masks the failure of the run
+	if err := app.Run(context.Background()); !errors.Is(err, dca.ErrInsufficientFunds) {
+		t.Errorf("want %v got %v", dca.ErrInsufficientFunds, err)
+	}
+	if want, got := dca.RunStatusFailed, n.summaries[0].Status; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestS3FailureArchive_Archive(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+	var method, path, auth string
+	var body []byte
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, auth = r.Method, r.URL.Path, r.Header.Get("Authorization")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	t.Cleanup(s.Close)
+
+	archive, err := dca.NewFailureArchive("s3://bucket/dca/failures/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive.(*dca.S3FailureArchive).Endpoint = s.URL
+
+	rec := dca.FailureRecord{RunID: "0123456789abcdef", FailedAt: time.Date(2024, 3, 1, 2, 0, 0, 0, time.UTC), Error: "failed"}
+	if err = archive.Archive(context.Background(), rec); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "PUT", method; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := "/bucket/dca/failures/20240301T020000Z-0123456789abcdef.json", path; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"; !strings.HasPrefix(auth, want) || !strings.Contains(auth, "/us-east-1/s3/") {
+		t.Errorf("want a signature for s3 in us-east-1 got %v", auth)
+	}
+	if !strings.Contains(string(body), `"runId":"0123456789abcdef"`) {
+		t.Errorf("unexpected body %s", body)
+	}
+
+	if _, err = dca.NewFailureArchive("s3:///prefix"); err == nil {
+		t.Error("expected an error for a missing bucket")
+	}
+}
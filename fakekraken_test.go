@@ -0,0 +1,90 @@
+package dca_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/1gm/dca"
+	"github.com/1gm/dca/internal/fakekraken"
+)
+
+func TestKrakenProvider_FakeKraken(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := httptest.NewServer(fakekraken.New(fakekraken.Config{APIKey: "key", Secret: []byte("secret")}))
+	defer s.Close()
+
+	tt := []struct {
+		scenario string
+		secret   string
+		err      error
+		message  string
+		status   string
+		volume   float64
+	}{
+		{fakekraken.ScenarioHappy, "secret", nil, "", "closed", 0.0001},
+		{fakekraken.ScenarioPartialFill, "secret", nil, "", "open", 0.0001},
+		{fakekraken.ScenarioRateLimit, "secret", dca.ErrRateLimited, "", "", 0},
+		{fakekraken.ScenarioMaintenance, "secret", dca.ErrExchangeUnavailable, "", "", 0},
+		{fakekraken.ScenarioInvalidNonce, "secret", nil, "EAPI:Invalid nonce", "", 0},
+		// the signature is verified whatever the scenario
+		{fakekraken.ScenarioHappy, "wrong", nil, "EAPI:Invalid signature", "", 0},
+	}
+	for i, tc := range tt {
+		p := dca.NewKrakenProvider(&dca.KrakenProviderConfig{
+			APIKey:       "key",
+			APISecret:    tc.secret,
+			BaseURL:      s.URL,
+			Logger:       logger,
+			ExtraHeaders: map[string]string{fakekraken.ScenarioHeader: tc.scenario},
+		})
+
+		res, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500})
+		switch {
+		case tc.err != nil:
+			if !errors.Is(err, tc.err) {
+				t.Errorf("%d: want %v got %v", i, tc.err, err)
+			}
+			continue
+		case tc.message != "":
+			if err == nil || !strings.Contains(err.Error(), tc.message) {
+				t.Errorf("%d: want %q got %v", i, tc.message, err)
+			}
+			continue
+		case err != nil:
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		if want, got := tc.status, res.Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.volume, res.VolumePurchased; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := 50000.0, res.Price; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestKrakenProvider_FakeKraken_ReplayedNonce(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := httptest.NewServer(fakekraken.New(fakekraken.Config{APIKey: "key", Secret: []byte("secret")}))
+	defer s.Close()
+
+	p := dca.NewKrakenProvider(&dca.KrakenProviderConfig{APIKey: "key", APISecret: "secret", BaseURL: s.URL, Logger: logger})
+	if _, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a second provider with the same key starts from a nonce the server has already seen
+	replay := dca.NewKrakenProvider(&dca.KrakenProviderConfig{APIKey: "key", APISecret: "secret", BaseURL: s.URL, Logger: logger})
+	replay.GenerateNonce = func() int64 { return 1 }
+	if _, err := replay.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500}); err == nil || !strings.Contains(err.Error(), "EAPI:Invalid nonce") {
+		t.Errorf("want an invalid nonce got %v", err)
+	}
+}
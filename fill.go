@@ -0,0 +1,109 @@
+package dca
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultFillTolerance is the fill tolerance of providers configured without one.
+var DefaultFillTolerance = FillTolerance{Percent: 0.1}
+
+// FillTolerance is how far the executed volume of a closed order may fall short of its volume for the order to still
+// count as fully filled, so rounding by Kraken, e.g. 0.00025686 executed of 0.00025687, isn't reported as a partial
+// fill. It's an absolute volume of the base asset or a percentage of the order's volume.
+type FillTolerance struct {
+	Volume  float64
+	Percent float64
+}
+
+// ParseFillTolerance parses a tolerance written as a volume of the base asset, e.g. 0.00000010, or as a percentage of
+// the order's volume, e.g. 0.1%. Zero only counts orders which executed their whole volume as filled.
+func ParseFillTolerance(s string) (t FillTolerance, err error) {
+	value, percent := strings.CutSuffix(strings.TrimSpace(s), "%")
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return t, fmt.Errorf("invalid fill tolerance %q: %w", s, err)
+	} else if f < 0 {
+		return t, fmt.Errorf("invalid fill tolerance %q: cannot be negative", s)
+	} else if percent && f >= 100 {
+		return t, fmt.Errorf("invalid fill tolerance %q: must be less than 100%%", s)
+	}
+
+	if percent {
+		t.Percent = f
+	} else {
+		t.Volume = f
+	}
+	return t, nil
+}
+
+// String formats t as ParseFillTolerance parses it.
+func (t FillTolerance) String() string {
+	if t.Percent > 0 {
+		return strconv.FormatFloat(t.Percent, 'f', -1, 64) + "%"
+	}
+	return strconv.FormatFloat(t.Volume, 'f', -1, 64)
+}
+
+// allowance returns the volume an order of volume may fall short by.
+func (t FillTolerance) allowance(volume float64) float64 {
+	return t.Volume + volume*t.Percent/100
+}
+
+// errUnknownFillVolume is returned by classifyFill when an order's volume isn't known so its fill can't be judged.
+var errUnknownFillVolume = errors.New("order volume is unknown")
+
+// classifyFill returns the status of an order of volume which executed executed and closed with status. Closed orders
+// which executed less than their volume by more than tolerance are partially filled, the status of open orders is
+// kept. withinTolerance is set when the shortfall was only ignored thanks to tolerance.
+func classifyFill(status string, volume, executed float64, tolerance FillTolerance) (classified string, withinTolerance bool, err error) {
+	switch status {
+	case "closed", "canceled", "expired":
+	default:
+		return status, false, nil
+	}
+	if volume <= 0 {
+		return status, false, errUnknownFillVolume
+	}
+
+	shortfall := volume - executed
+	switch {
+	case shortfall <= 0:
+		return "closed", false, nil
+	case executed > 0 && shortfall <= tolerance.allowance(volume):
+		return "closed", true, nil
+	case executed > 0:
+		return OrderStatusPartial, false, nil
+	default:
+		// nothing filled, e.g. a canceled limit order
+		return status, false, nil
+	}
+}
+
+// withFill returns res with the execution details of oi and its status classified against p.FillTolerance. The
+// volume of the order is the one Kraken reported, or the requested volume when it's unknown. Partially filled orders
+// report the executed volume as purchased.
+func (p *KrakenProvider) withFill(ctx context.Context, res ExecuteOrderResponse, oi orderInfo) ExecuteOrderResponse {
+	res = res.withOrderInfo(oi)
+
+	volume := cmp.Or(oi.Volume, res.RequestedVolume)
+	status, within, err := classifyFill(res.Status, volume, oi.VolumeExecuted, p.FillTolerance)
+	if err != nil {
+		p.Logger.DebugContext(ctx, "not classifying the fill", "transactionId", res.TransactionID, "reason", err)
+		return res
+	}
+	if within {
+		p.Logger.InfoContext(ctx, "counting the order as filled within the fill tolerance", "transactionId", res.TransactionID,
+			"volume", volume, "executed", oi.VolumeExecuted, "fillTolerance", p.FillTolerance.String())
+	} else if status == OrderStatusPartial {
+		p.Logger.WarnContext(ctx, "order partially filled", "transactionId", res.TransactionID, "status", res.Status,
+			"volume", volume, "executed", oi.VolumeExecuted, "fillTolerance", p.FillTolerance.String())
+		res.VolumePurchased = oi.VolumeExecuted
+	}
+	res.Status = status
+	return res
+}
@@ -0,0 +1,88 @@
+package dca_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/1gm/dca"
+)
+
+func TestParseFillTolerance(t *testing.T) {
+	tt := []struct {
+		s        string
+		expected dca.FillTolerance
+		valid    bool
+	}{
+		{"0.1%", dca.FillTolerance{Percent: 0.1}, true},
+		{" 2% ", dca.FillTolerance{Percent: 2}, true},
+		{"0.00000010", dca.FillTolerance{Volume: 0.0000001}, true},
+		{"0", dca.FillTolerance{}, true},
+		{"-1%", dca.FillTolerance{}, false},
+		{"100%", dca.FillTolerance{}, false},
+		{"-0.1", dca.FillTolerance{}, false},
+		{"", dca.FillTolerance{}, false},
+		{"%", dca.FillTolerance{}, false},
+	}
+	for i, tc := range tt {
+		got, err := dca.ParseFillTolerance(tc.s)
+		if want, got := tc.valid, err == nil; got != want {
+			t.Errorf("%d: want valid %v got %v", i, want, err)
+		}
+		if want := tc.expected; got != want {
+			t.Errorf("%d: want %+v got %+v", i, want, got)
+		}
+	}
+}
+
+func TestKrakenProvider_QueryOrder_FillTolerance(t *testing.T) {
+	tt := []struct {
+		status, vol, volExec string
+		// tolerance is the provider's fill tolerance, the default when empty
+		tolerance string
+		expected  string
+		purchased float64
+	}{
+		// Kraken's rounding is within the default tolerance
+		{"closed", "0.00025687", "0.00025686", "", "closed", 0.00025687},
+		{"closed", "0.00025687", "0.00025686", "0", dca.OrderStatusPartial, 0.00025686},
+		{"closed", "0.00025687", "0.00025687", "0", "closed", 0.00025687},
+		// a shortfall of exactly the tolerance is within it
+		{"closed", "0.5", "0.25", "0.25", "closed", 0.5},
+		{"closed", "0.5", "0.24", "0.25", dca.OrderStatusPartial, 0.24},
+		{"closed", "0.5", "0.25", "50%", "closed", 0.5},
+		{"closed", "0.5", "0.24", "50%", dca.OrderStatusPartial, 0.24},
+		// canceled orders that executed part of their volume are partial, those that executed none stay canceled
+		{"canceled", "0.5", "0.24", "", dca.OrderStatusPartial, 0.24},
+		{"canceled", "0.5", "0", "", "canceled", 0.5},
+		{"expired", "0.5", "0.5", "0", "closed", 0.5},
+		// open orders aren't classified until they close
+		{"open", "0.5", "0.24", "", dca.OrderStatusOpen, 0.5},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/private/QueryOrders": {fmt.Sprintf(`{"error":[],"result":{"TXID-1":{"status":%q,"vol":%q,"vol_exec":%q,"cost":"5.00","fee":"0.02","price":"50000.0"}}}`,
+				tc.status, tc.vol, tc.volExec)},
+		})
+		var cfg dca.KrakenProviderConfig
+		if tc.tolerance != "" {
+			tolerance, err := dca.ParseFillTolerance(tc.tolerance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg.FillTolerance = &tolerance
+		}
+		p := newTestKrakenProvider(s, cfg)
+
+		res, err := p.QueryOrder(context.Background(), "TXID-1")
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if want, got := tc.expected, res.Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.purchased, res.VolumePurchased; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
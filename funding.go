@@ -0,0 +1,96 @@
+package dca
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+)
+
+// KrakenDepositMethod is a way of funding an asset as returned by the DepositMethods endpoint.
+type KrakenDepositMethod struct {
+	Method string `json:"method" desc:"The name of the deposit method" schema:"required"`
+	// Minimum is the smallest deposit accepted, empty when there is none.
+	Minimum string `json:"minimum,omitempty" desc:"The smallest deposit accepted"`
+	Fee     string `json:"fee,omitempty" desc:"The fee charged for a deposit"`
+}
+
+// GetDepositMethods returns the methods asset can be deposited with.
+func (p *KrakenProvider) GetDepositMethods(ctx context.Context, asset string) (methods []KrakenDepositMethod, err error) {
+	defer WrapErr(&err, "KrakenProvider.GetDepositMethods")
+
+	if err = p.privateRequest(ctx, "/0/private/DepositMethods", url.Values{"asset": {asset}}, &methods); err != nil {
+		return nil, fmt.Errorf("failed to fetch deposit methods: %w", err)
+	}
+	return methods, nil
+}
+
+// FundingReminder is added to the run summary when the balance left after a run covers fewer runs than
+// lowBalanceThresholdRuns.
+type FundingReminder struct {
+	Asset   string  `json:"asset" desc:"The asset orders are paid with" schema:"required"`
+	Balance float64 `json:"balance" desc:"The available balance of the asset after the run" schema:"required"`
+	// RunsRemaining is how many more orders of the configured amount the balance covers.
+	RunsRemaining int `json:"runsRemaining" desc:"How many more orders of the configured amount the balance covers" schema:"required"`
+	ThresholdRuns int `json:"thresholdRuns" desc:"The configured lowBalanceThresholdRuns" schema:"required"`
+	// Instructions is the configured fundingInstructions, e.g. the bank details and Kraken funding reference.
+	Instructions   string                `json:"instructions,omitempty" desc:"How to fund the account, from fundingInstructions"`
+	DepositMethods []KrakenDepositMethod `json:"depositMethods,omitempty" desc:"The methods the asset can be deposited with"`
+}
+
+// checkFunding adds a funding reminder to summary when the balance of the quote asset covers fewer runs than
+// lowBalanceThresholdRuns. The order already happened, or failed, so failures are only recorded as warnings.
+func (m *App) checkFunding(ctx context.Context, provider *KrakenProvider, summary *RunSummary) {
+	if m.Config.LowBalanceThresholdRuns <= 0 {
+		return
+	}
+	// sells are paid with the base asset, which isn't funded by deposits
+	order, err := provider.resolveOrder(m.Config.OrderRequest())
+	if err != nil || order.Side == SideSell {
+		return
+	}
+	pair := krakenPairs[order.Pair]
+
+	balance, err := provider.fetchBalance(ctx, pair.QuoteAsset)
+	if err != nil {
+		m.Logger.WarnContext(ctx, "failed to fetch balance for the funding reminder", "error", err)
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("funding check failed: %v", err))
+		return
+	}
+
+	// the epsilon keeps float error from dropping a run when the balance is an exact multiple
+	runs := int(math.Floor(balance/(float64(order.AmountInCents)/100) + 1e-9))
+	if runs >= m.Config.LowBalanceThresholdRuns {
+		m.Logger.InfoContext(ctx, "balance covers the funding threshold", "balance", balance, "runsRemaining", runs)
+		return
+	}
+
+	reminder := &FundingReminder{
+		Asset:         NormalizeKrakenAsset(pair.QuoteAsset),
+		Balance:       balance,
+		RunsRemaining: runs,
+		ThresholdRuns: m.Config.LowBalanceThresholdRuns,
+		Instructions:  m.Config.FundingInstructions,
+	}
+	if m.Config.FundingDepositMethods {
+		if reminder.DepositMethods, err = provider.GetDepositMethods(ctx, pair.QuoteAsset); err != nil {
+			m.Logger.WarnContext(ctx, "failed to fetch deposit methods", "error", err)
+			summary.Warnings = append(summary.Warnings, fmt.Sprintf("deposit methods unavailable: %v", err))
+		}
+	}
+
+	m.Logger.WarnContext(ctx, "balance is running low, time to fund the account", "balance", balance, "runsRemaining", runs,
+		"threshold", m.Config.LowBalanceThresholdRuns)
+	summary.Funding = reminder
+}
+
+// validateFunding checks the funding reminder settings.
+func (c AppConfig) validateFunding() error {
+	if c.LowBalanceThresholdRuns < 0 {
+		return fieldErr("lowBalanceThresholdRuns", errors.New("lowBalanceThresholdRuns cannot be negative"))
+	} else if c.LowBalanceThresholdRuns == 0 && (c.FundingInstructions != "" || c.FundingDepositMethods) {
+		return fieldErr("lowBalanceThresholdRuns", errors.New("lowBalanceThresholdRuns is required when fundingInstructions or fundingDepositMethods is set"))
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package dca_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/1gm/dca"
+)
+
+func TestApp_Run_FundingReminder(t *testing.T) {
+	const depositMethods = `{"error":[],"result":[{"method":"Bank Frick (SWIFT)","limit":false,"fee":"0.0000","gen-address":false,"minimum":"10.00"}]}`
+
+	tt := []struct {
+		threshold      int
+		methods        bool
+		addOrder       string
+		balance        string
+		depositMethods string
+		status         dca.RunStatus
+		runs           int
+		reminded       bool
+		methodCount    int
+		warning        string
+	}{
+		{4, true, addOrderResponse, "12.50", depositMethods, dca.RunStatusSuccess, 2, true, 1, ""},
+		// an exact multiple covers every run
+		{4, false, addOrderResponse, "20.00", depositMethods, dca.RunStatusSuccess, 4, false, 0, ""},
+		{4, true, addOrderResponse, "12.50", `{"error":["EGeneral:Permission denied"]}`, dca.RunStatusSuccess, 2, true, 0, "deposit methods unavailable"},
+		{0, false, addOrderResponse, "12.50", depositMethods, dca.RunStatusSuccess, 0, false, 0, ""},
+		// failing for insufficient funds still reminds
+		{4, false, `{"error":["EOrder:Insufficient funds"]}`, "1.00", depositMethods, dca.RunStatusFailed, 0, true, 0, ""},
+		{4, false, addOrderResponse, `{"error":["EAPI:Invalid nonce"]}`, depositMethods, dca.RunStatusSuccess, 0, false, 0, "funding check failed"},
+	}
+	for i, tc := range tt {
+		balance := tc.balance
+		if !strings.HasPrefix(balance, "{") {
+			balance = `{"error":[],"result":{"ZUSD":"` + balance + `"}}`
+		}
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus":    {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":          {tickerResponse},
+			"/0/private/AddOrder":       {tc.addOrder},
+			"/0/private/QueryOrders":    {queryOrdersResponse},
+			"/0/private/Balance":        {balance},
+			"/0/private/DepositMethods": {tc.depositMethods},
+		})
+		app, n := newTestApp(s, dca.AppConfig{
+			LowBalanceThresholdRuns: tc.threshold,
+			FundingInstructions:     "reference ABC123",
+			FundingDepositMethods:   tc.methods,
+		})
+		if tc.threshold == 0 {
+			app.Config.FundingInstructions = ""
+		}
+
+		_ = app.Run(context.Background())
+		summary := n.summaries[0]
+
+		if want, got := tc.status, summary.Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.threshold > 0, len(s.Requests("/0/private/Balance")) > 0; got != want {
+			t.Errorf("%d: want balance fetched %v got %v", i, want, got)
+		}
+		if want, got := tc.reminded, summary.Funding != nil; got != want {
+			t.Fatalf("%d: want reminded %v got %v", i, want, got)
+		}
+		if summary.Funding != nil {
+			if want, got := tc.runs, summary.Funding.RunsRemaining; got != want {
+				t.Errorf("%d: want %v runs got %v", i, want, got)
+			}
+			if want, got := "USD", summary.Funding.Asset; got != want {
+				t.Errorf("%d: want %v got %v", i, want, got)
+			}
+			if want, got := "reference ABC123", summary.Funding.Instructions; got != want {
+				t.Errorf("%d: want %v got %v", i, want, got)
+			}
+			if want, got := tc.methodCount, len(summary.Funding.DepositMethods); got != want {
+				t.Errorf("%d: want %v deposit methods got %v", i, want, got)
+			}
+		}
+		if want, got := tc.methods && tc.reminded, len(s.Requests("/0/private/DepositMethods")) > 0; got != want {
+			t.Errorf("%d: want deposit methods fetched %v got %v", i, want, got)
+		}
+
+		warned := false
+		for _, w := range summary.Warnings {
+			warned = warned || (tc.warning != "" && strings.Contains(w, tc.warning))
+		}
+		if want, got := tc.warning != "", warned; got != want {
+			t.Errorf("%d: want warning %q got %v", i, tc.warning, summary.Warnings)
+		}
+	}
+}
+
+func TestAppConfig_Validate_Funding(t *testing.T) {
+	tt := []struct {
+		threshold    int
+		instructions string
+		valid        bool
+	}{
+		{0, "", true},
+		{3, "reference ABC123", true},
+		{-1, "", false},
+		{0, "reference ABC123", false},
+	}
+	for i, tc := range tt {
+		cfg := dca.AppConfig{KrakenAPIKey: "key", KrakenPrivateKey: "secret", OrderAmountInCents: 500, LowBalanceThresholdRuns: tc.threshold, FundingInstructions: tc.instructions}
+		if want, got := tc.valid, cfg.Validate() == nil; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package dca
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Guard is a rule deciding whether a purchase goes ahead and with which amount, e.g. "don't buy on the last day of the
+// month". The built-in guards, the pause, the amount parameter, the budget and the price ladder, implement it. Custom
+// guards are added with App.Guards or BuyGuards.Custom and are evaluated after them, see evaluateGuards for what a
+// failing guard does.
+type Guard interface {
+	// Name names the guard's decision in the run summary and the explain output, e.g. last_day_of_month.
+	Name() string
+	// Evaluate decides on the purchase described by in. An error means the guard couldn't decide, what the run does
+	// then depends on the GuardFailurePolicy.
+	Evaluate(ctx context.Context, in GuardInput) (GuardDecision, error)
+}
+
+// GuardInput is what a guard decides on.
+type GuardInput struct {
+	// Now is when the run started, in the reporting time zone of an App run.
+	Now time.Time
+	// Pair is the pair bought.
+	Pair string
+	// AmountInCents is the amount the purchase would order, as adjusted by the guards evaluated before.
+	AmountInCents int
+	// Ticker is the pair's ticker, fetched once for the price ladder and the custom guards. It's zero for the pause,
+	// the amount parameter and the budget, which are evaluated before the price is fetched, and for Buy without
+	// BuyGuards.Price.
+	Ticker PriceSample
+	// History is the orders recorded to the order store, nil without one or when it can't be read.
+	History []OrderRecord
+	// Config is the config of an App run, it's zero for Buy.
+	Config AppConfig
+}
+
+// GuardAction is what a guard does to the purchase.
+type GuardAction string
+
+const (
+	// GuardAllow lets the purchase continue as it is.
+	GuardAllow GuardAction = "allow"
+	// GuardAdjust lets the purchase continue with the decision's amount.
+	GuardAdjust GuardAction = "adjust"
+	// GuardSkip skips the purchase without ordering.
+	GuardSkip GuardAction = "skip"
+)
+
+// GuardDecision is the decision of a guard. The zero GuardDecision allows the purchase without recording a decision,
+// for a guard with nothing to decide, e.g. the pause when runs were never paused.
+type GuardDecision struct {
+	Action GuardAction
+	// AmountInCents is the amount the purchase continues with when Action is GuardAdjust, it must be positive.
+	AmountInCents int
+	// SkipReason is the skip reason of the run when Action is GuardSkip, SkipReasonGuard when empty.
+	SkipReason SkipReason
+	// Reason explains the decision in a line, e.g. "last day of the month → skip". It's the narration of the
+	// decision, the action is narrated when it's empty.
+	Reason string
+	// Inputs are the values the decision was made from, formatted for people.
+	Inputs map[string]string
+}
+
+// GuardFailurePolicy is what the run does when a guard fails to decide.
+type GuardFailurePolicy string
+
+const (
+	// GuardFailClosed fails the run with ErrGuard, it's the default.
+	GuardFailClosed GuardFailurePolicy = "closed"
+	// GuardFailOpen ignores the guard with a warning, the run continues as if it had allowed the purchase.
+	GuardFailOpen GuardFailurePolicy = "open"
+)
+
+// Validate checks p is empty, closed or open.
+func (p GuardFailurePolicy) Validate() error {
+	switch p {
+	case "", GuardFailClosed, GuardFailOpen:
+		return nil
+	}
+	return fmt.Errorf("invalid guardFailurePolicy %q, want closed or open", p)
+}
+
+// evaluateGuards evaluates guards in order and records their decisions. Each guard sees the amount as adjusted by the
+// guards before it, the amount left by the last one is returned. The first guard to skip stops the evaluation and its
+// *SkipError is returned.
+//
+// A guard fails to decide when it returns an error, an invalid decision or panics. Under GuardFailClosed the run
+// fails with ErrGuard, under GuardFailOpen the failure is added to summary's warnings and the next guard is
+// evaluated.
+func evaluateGuards(ctx context.Context, logger *slog.Logger, guards []Guard, in GuardInput, policy GuardFailurePolicy, summary *RunSummary) (amount int, err error) {
+	for _, g := range guards {
+		var gd GuardDecision
+		err = recoverPanic(ctx, logger, "Guard.Evaluate", func() (err error) {
+			if gd, err = g.Evaluate(ctx, in); err == nil {
+				err = gd.validate()
+			}
+			return err
+		})
+
+		d := Decision{Name: g.Name(), Inputs: gd.Inputs, Narration: gd.Reason}
+		if err != nil {
+			d.Inputs = map[string]string{"error": err.Error()}
+			if policy == GuardFailOpen {
+				logger.WarnContext(ctx, "ignoring a failed guard", "guard", d.Name, "error", err)
+				summary.Warnings = append(summary.Warnings, fmt.Sprintf("guard %s ignored: %v", d.Name, err))
+				d.Outcome, d.Narration = DecisionProceed, "failed with guardFailurePolicy open → proceed"
+				recordDecision(ctx, d)
+				continue
+			}
+			d.Outcome, d.Narration = DecisionFail, "failed with guardFailurePolicy closed → fail"
+			recordDecision(ctx, d)
+			return in.AmountInCents, fmt.Errorf("%w: %s: %w", ErrGuard, d.Name, err)
+		}
+
+		switch gd.Action {
+		case "":
+			continue
+		case GuardAllow:
+			d.Outcome = DecisionProceed
+			d.Narration = cmp.Or(d.Narration, "→ proceed")
+		case GuardAdjust:
+			in.AmountInCents, d.Outcome = gd.AmountInCents, DecisionAdjust
+			d.Narration = cmp.Or(d.Narration, "→ amount "+FormatCents(gd.AmountInCents, ""))
+		case GuardSkip:
+			d.Outcome = DecisionSkip
+			d.Narration = cmp.Or(d.Narration, "→ skip")
+		}
+		recordDecision(ctx, d)
+		if gd.Action == GuardSkip {
+			return in.AmountInCents, &SkipError{Reason: cmp.Or(gd.SkipReason, SkipReasonGuard)}
+		}
+	}
+	return in.AmountInCents, nil
+}
+
+// validate checks the action of d is known and an adjusted amount is positive.
+func (d GuardDecision) validate() error {
+	switch d.Action {
+	case "", GuardAllow, GuardSkip:
+		return nil
+	case GuardAdjust:
+		if d.AmountInCents <= 0 {
+			return fmt.Errorf("adjusted amount %d must be positive", d.AmountInCents)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown guard action %q", d.Action)
+}
+
+// runGuards evaluates the guards a run evaluates before the exchange is called, the pause, the amount parameter then
+// the budget, and sets
+// the amount of the run to the one they settled on.
+func (m *App) runGuards(ctx context.Context, now time.Time, summary *RunSummary) error {
+	guards := []Guard{pauseGuard{m: m, summary: summary}}
+	if m.Config.OrderAmountParameter != "" {
+		guards = append(guards, amountParameterGuard{m: m, summary: summary})
+	}
+	if m.Config.Budget != nil {
+		guards = append(guards, budgetGuard{m: m, summary: summary})
+	}
+
+	in := GuardInput{Now: now, Pair: cmp.Or(m.Config.Pair, KrakenDefaultPair), AmountInCents: m.Config.OrderAmountInCents, Config: m.Config}
+	amount, err := evaluateGuards(ctx, m.Logger, guards, in, m.Config.GuardFailurePolicy, summary)
+	m.Config.OrderAmountInCents = amount
+	return err
+}
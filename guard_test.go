@@ -0,0 +1,209 @@
+package dca_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/1gm/dca"
+	"github.com/1gm/dca/internal/fakekraken"
+)
+
+// guardFunc is a custom guard deciding with f.
+type guardFunc struct {
+	name string
+	f    func(in dca.GuardInput) (dca.GuardDecision, error)
+}
+
+func (g guardFunc) Name() string { return g.name }
+
+func (g guardFunc) Evaluate(_ context.Context, in dca.GuardInput) (dca.GuardDecision, error) {
+	return g.f(in)
+}
+
+func TestBuy_CustomGuards(t *testing.T) {
+	p := newFakeKrakenProvider(t, fakekraken.ScenarioHappy)
+	executor := &scriptedExecutor{errs: []error{nil}}
+
+	// the custom guards are evaluated in order after the price ladder, each sees the amount left by the one before
+	var seen []dca.GuardInput
+	record := func(d dca.GuardDecision) func(in dca.GuardInput) (dca.GuardDecision, error) {
+		return func(in dca.GuardInput) (dca.GuardDecision, error) {
+			seen = append(seen, in)
+			return d, nil
+		}
+	}
+	summary, err := dca.Buy(context.Background(), dca.BuyParams{
+		Executor:      executor,
+		AmountInCents: 500,
+		Guards: dca.BuyGuards{
+			PriceLadder: dca.PriceLadder{{AmountInCents: 1000}},
+			Price:       p.FetchPrice,
+			Custom: []dca.Guard{
+				guardFunc{"halve", record(dca.GuardDecision{Action: dca.GuardAdjust, AmountInCents: 500, Reason: "halved → amount 5.00"})},
+				guardFunc{"abstain", record(dca.GuardDecision{})},
+				guardFunc{"allow", record(dca.GuardDecision{Action: dca.GuardAllow})},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 500, summary.Order.AmountInCents; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := 3, len(seen); got != want {
+		t.Fatalf("want %v got %v", want, got)
+	}
+	for i, want := range []int{1000, 500, 500} {
+		if got := seen[i].AmountInCents; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := 50000.0, seen[i].Ticker.Ask; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+
+	// a guard without a decision isn't recorded, one without a reason has its action narrated
+	if want, got := "price_ladder: price 50000.00 in tier 1 (every price) → amount 10.00\nhalve: halved → amount 5.00\nallow: → proceed\n", dca.FormatDecisions(summary.Decisions); got != want {
+		t.Errorf("want %q got %q", want, got)
+	}
+}
+
+func TestBuy_CustomGuards_Skip(t *testing.T) {
+	tt := []struct {
+		decision dca.GuardDecision
+		reason   dca.SkipReason
+	}{
+		{dca.GuardDecision{Action: dca.GuardSkip, Reason: "last day of the month → skip"}, dca.SkipReasonGuard},
+		{dca.GuardDecision{Action: dca.GuardSkip, SkipReason: "month_end"}, "month_end"},
+	}
+	for i, tc := range tt {
+		executor := &scriptedExecutor{errs: []error{nil}}
+		var after bool
+		summary, err := dca.Buy(context.Background(), dca.BuyParams{Executor: executor, AmountInCents: 500, Guards: dca.BuyGuards{Custom: []dca.Guard{
+			guardFunc{"month_end", func(dca.GuardInput) (dca.GuardDecision, error) { return tc.decision, nil }},
+			guardFunc{"after", func(dca.GuardInput) (dca.GuardDecision, error) { after = true; return dca.GuardDecision{}, nil }},
+		}}})
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if want, got := dca.RunStatusSkipped, summary.Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.reason, summary.SkipReason; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if executor.calls != 0 || after {
+			t.Errorf("%d: want nothing evaluated or ordered after the skip", i)
+		}
+		if want, got := dca.DecisionSkip, summary.Decisions[0].Outcome; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestBuy_GuardFailurePolicy(t *testing.T) {
+	failing := []dca.Guard{
+		guardFunc{"failing", func(dca.GuardInput) (dca.GuardDecision, error) {
+			return dca.GuardDecision{}, errors.New("calendar unavailable")
+		}},
+		guardFunc{"invalid", func(dca.GuardInput) (dca.GuardDecision, error) {
+			return dca.GuardDecision{Action: dca.GuardAdjust}, nil
+		}},
+		guardFunc{"panicking", func(dca.GuardInput) (dca.GuardDecision, error) { panic("boom") }},
+	}
+	for i, g := range failing {
+		// closed, the default, fails the purchase before ordering
+		executor := &scriptedExecutor{errs: []error{nil}}
+		summary, err := dca.Buy(context.Background(), dca.BuyParams{Executor: executor, AmountInCents: 500, Guards: dca.BuyGuards{Custom: []dca.Guard{g}}})
+		if !errors.Is(err, dca.ErrGuard) {
+			t.Fatalf("%d: want %v got %v", i, dca.ErrGuard, err)
+		}
+		if want, got := dca.RunStatusFailed, summary.Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if executor.calls != 0 {
+			t.Errorf("%d: want no order got %v", i, executor.calls)
+		}
+		if want, got := dca.DecisionFail, summary.Decisions[0].Outcome; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+
+		// open ignores the guard with a warning
+		executor = &scriptedExecutor{errs: []error{nil}}
+		summary, err = dca.Buy(context.Background(), dca.BuyParams{Executor: executor, AmountInCents: 500, Guards: dca.BuyGuards{Custom: []dca.Guard{g}, FailurePolicy: dca.GuardFailOpen}})
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if want, got := 500, summary.Order.AmountInCents; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if len(summary.Warnings) != 1 || !strings.Contains(summary.Warnings[0], "guard "+g.Name()+" ignored") {
+			t.Errorf("%d: want a warning got %v", i, summary.Warnings)
+		}
+		if want, got := dca.DecisionProceed, summary.Decisions[0].Outcome; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestApp_Run_Guards(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":       {tickerResponse},
+		"/0/private/AddOrder":    {addOrderResponse, addOrderResponse},
+		"/0/private/QueryOrders": {queryOrdersResponse, queryOrdersResponse},
+	})
+
+	// a guard skipping every purchase after the first one recorded
+	var seen dca.GuardInput
+	once := guardFunc{"once", func(in dca.GuardInput) (dca.GuardDecision, error) {
+		seen = in
+		if len(in.History) > 0 {
+			return dca.GuardDecision{Action: dca.GuardSkip, Reason: "already bought → skip"}, nil
+		}
+		return dca.GuardDecision{Action: dca.GuardAllow, Reason: "first purchase → proceed"}, nil
+	}}
+
+	app, n := newTestApp(s, dca.AppConfig{OrderStorePath: filepath.Join(t.TempDir(), "orders.jsonl"), Label: "retirement"})
+	app.Guards = []dca.Guard{once}
+	for i, status := range []dca.RunStatus{dca.RunStatusSuccess, dca.RunStatusSkipped} {
+		if err := app.Run(context.Background()); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if want, got := status, n.summaries[i].Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if decisions := n.summaries[i].Decisions; !slices.ContainsFunc(decisions, func(d dca.Decision) bool { return d.Name == "once" }) {
+			t.Errorf("%d: want the guard's decision got %+v", i, decisions)
+		}
+	}
+	if want, got := 1, len(s.Requests("/0/private/AddOrder")); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := "retirement", seen.Config.Label; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := 500, seen.AmountInCents; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if seen.Ticker.Ask <= 0 || seen.Now.IsZero() {
+		t.Errorf("want the ticker and the start got %+v", seen)
+	}
+}
+
+func TestAppConfig_Validate_GuardFailurePolicy(t *testing.T) {
+	for i, tc := range []struct {
+		policy dca.GuardFailurePolicy
+		err    bool
+	}{{"", false}, {dca.GuardFailClosed, false}, {dca.GuardFailOpen, false}, {"ignore", true}} {
+		cfg := dca.AppConfig{KrakenAPIKey: "key", KrakenPrivateKey: "secret", OrderAmountInCents: 500, GuardFailurePolicy: tc.policy}
+		if err := cfg.Validate(); (err != nil) != tc.err {
+			t.Errorf("%d: want error %v got %v", i, tc.err, err)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package dca
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxResponseBytes is the default limit on the size of an HTTP response body.
+const DefaultMaxResponseBytes = 4 << 20
+
+// maxDrainBytes is how much of an unread response body is discarded before closing it so the connection can be
+// reused, larger remainders are abandoned along with the connection.
+const maxDrainBytes = 64 << 10
+
+// readResponseBody reads at most limit bytes of the body of res, returning ErrResponseTooLarge if the body is
+// larger. Gzip encoded bodies are decompressed with the limit applied to the decompressed body. The body is drained
+// and closed either way.
+func readResponseBody(res *http.Response, limit int64) (body []byte, err error) {
+	defer func() {
+		_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, maxDrainBytes))
+		if cerr := res.Body.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("failed to close response body: %w", cerr)
+		}
+	}()
+
+	if limit <= 0 {
+		limit = DefaultMaxResponseBytes
+	}
+
+	// The transport only decompresses transparently when it set Accept-Encoding itself.
+	var r io.Reader = res.Body
+	if strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(res.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress response body: %w", err)
+		}
+		defer func() { _ = gz.Close() }()
+		r = gz
+	}
+
+	// Read one byte past the limit to tell a body of exactly limit bytes apart from a larger one.
+	if body, err = io.ReadAll(io.LimitReader(r, limit+1)); err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	} else if int64(len(body)) > limit {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", ErrResponseTooLarge, limit)
+	}
+	return body, nil
+}
+
+// krakenAuthHeaders sign private Kraken requests, extra headers can't replace them.
+var krakenAuthHeaders = []string{"API-Key", "API-Sign"}
+
+// validateExtraHeaders checks every extra header is a valid HTTP header that doesn't collide with the Kraken auth
+// headers.
+func validateExtraHeaders(headers map[string]string) error {
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(headers)) {
+		if !validHeaderName(name) {
+			errs = append(errs, fmt.Errorf("extraHeaders: %q is not a valid header name", name))
+			continue
+		}
+		for _, auth := range krakenAuthHeaders {
+			if strings.EqualFold(name, auth) {
+				errs = append(errs, fmt.Errorf("extraHeaders: %s is reserved for Kraken authentication", name))
+			}
+		}
+		if strings.ContainsAny(headers[name], "\r\n\x00") {
+			errs = append(errs, fmt.Errorf("extraHeaders: the value of %s contains a line break", name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validHeaderName reports whether name is an RFC 9110 token.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range []byte(name) {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// headerTransport adds headers to every request sent through next, for example the auth token of an egress proxy.
+// Headers a request already sets are kept. The values are never logged.
+type headerTransport struct {
+	headers map[string]string
+	next    http.RoundTripper
+}
+
+// withHeaders returns next wrapped to add headers to every request, next is returned as is without headers. A nil
+// next uses http.DefaultTransport.
+func withHeaders(next http.RoundTripper, headers map[string]string) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if len(headers) == 0 {
+		return next
+	}
+	return &headerTransport{headers: maps.Clone(headers), next: next}
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request it's given
+	req = req.Clone(req.Context())
+	for name, value := range t.headers {
+		if req.Header.Get(name) == "" {
+			req.Header.Set(name, value)
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// HTTP components, the callers of the shared client named by the context of their requests, see withHTTPComponent.
+const (
+	HTTPComponentDiscord     = "discord"
+	HTTPComponentKraken      = "kraken"
+	HTTPComponentPushgateway = "pushgateway"
+	HTTPComponentS3          = "s3"
+)
+
+// httpComponentKey is the context key of the component making a request.
+type httpComponentKey struct{}
+
+// withHTTPComponent returns ctx naming component as the caller of the requests made with it.
+func withHTTPComponent(ctx context.Context, component string) context.Context {
+	return context.WithValue(ctx, httpComponentKey{}, component)
+}
+
+// httpComponent returns the component named by ctx, empty when it names none.
+func httpComponent(ctx context.Context) string {
+	component, _ := ctx.Value(httpComponentKey{}).(string)
+	return component
+}
+
+// HTTPClientConfig configures a client made by NewHTTPClient.
+type HTTPClientConfig struct {
+	// ExtraHeaders are added to every request, e.g. the auth token of an egress proxy.
+	ExtraHeaders map[string]string
+	// Audit records the requests of exchange components, such as HTTPComponentKraken, when set.
+	Audit *AuditLog
+	// Middleware wraps the instrumentation, the first one being the outermost, e.g. to collect metrics of every
+	// request as it was made by its component.
+	Middleware []func(http.RoundTripper) http.RoundTripper
+	// Transport sends the requests, defaults to a transport shared by the clients of the process.
+	Transport http.RoundTripper
+}
+
+// NewHTTPClient returns a client for every component of the app. Requests go through the middleware, then are
+// audited, then get the extra headers before they're sent by the transport, so the audit log records a call as its
+// component made it and middleware sees it before it's audited. The client has no timeout of its own, components bound
+// their requests with the context instead so they can share it.
+func NewHTTPClient(cfg HTTPClientConfig) *http.Client {
+	next := cfg.Transport
+	if next == nil {
+		next = sharedHTTPTransport()
+	}
+	next = withAudit(withHeaders(next, cfg.ExtraHeaders), cfg.Audit)
+	for _, wrap := range slices.Backward(cfg.Middleware) {
+		next = wrap(next)
+	}
+	return &http.Client{Transport: next}
+}
+
+// httpClient returns the client shared by the components of the app, made again when the extra headers or the audit
+// log it was made with changed.
+func (m *App) httpClient() *http.Client {
+	m.httpMu.Lock()
+	defer m.httpMu.Unlock()
+	if m.http == nil || m.httpAudit != m.audit || !maps.Equal(m.httpHeaders, m.Config.ExtraHeaders) {
+		m.http = NewHTTPClient(HTTPClientConfig{ExtraHeaders: m.Config.ExtraHeaders, Audit: m.audit})
+		m.httpHeaders, m.httpAudit = maps.Clone(m.Config.ExtraHeaders), m.audit
+	}
+	return m.http
+}
+
+// sharedHTTPTransport is the transport of clients made without one. A run makes a burst of a few dozen calls to a
+// handful of hosts, then nothing until the next run, so a few connections per host are kept idle through the burst and
+// closed long before the next run would find them dropped by the other end.
+var sharedHTTPTransport = sync.OnceValue(func() http.RoundTripper {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   5 * time.Second,
+		MaxIdleConns:          16,
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       30 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+})
@@ -0,0 +1,331 @@
+package dca_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/1gm/dca"
+)
+
+func TestKrakenProvider_MaxResponseBytes(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// stream a valid but oversized response in chunks
+		_, _ = w.Write([]byte(`{"error":[],"result":{"status":"online","padding":"`))
+		chunk := strings.Repeat("x", 1024)
+		for i := 0; i < 64; i++ {
+			if _, err := w.Write([]byte(chunk)); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
+		_, _ = w.Write([]byte(`"}}`))
+	}))
+	defer s.Close()
+
+	tt := []struct {
+		limit    int64
+		tooLarge bool
+	}{
+		{16 << 10, true},
+		{1 << 20, false},
+	}
+	for i, tc := range tt {
+		p := newTestKrakenProvider(&krakenTestServer{Server: s}, dca.KrakenProviderConfig{MaxResponseBytes: tc.limit})
+
+		// every endpoint streams the same body so the order fails either way, only the cause differs
+		_, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500})
+		if err == nil {
+			t.Fatalf("%d: expected an error", i)
+		}
+		if want, got := tc.tooLarge, errors.Is(err, dca.ErrResponseTooLarge); got != want {
+			t.Errorf("%d: want %v got %v (%v)", i, want, got, err)
+		}
+	}
+}
+
+// gzipServer serves gzip encoded bodies per path and records whether clients asked for gzip.
+func gzipServer(t *testing.T, bodies map[string]string) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var acceptEncodings []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		acceptEncodings = append(acceptEncodings, r.Header.Get("Accept-Encoding"))
+		mu.Unlock()
+
+		body, ok := bodies[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		_, _ = gz.Write([]byte(body))
+		_ = gz.Close()
+	}))
+	t.Cleanup(s.Close)
+	return s, &acceptEncodings
+}
+
+func TestKrakenProvider_GzipResponses(t *testing.T) {
+	s, acceptEncodings := gzipServer(t, map[string]string{
+		"/0/public/SystemStatus": `{"error":[],"result":{"status":"online"}}`,
+		"/0/public/Ticker":       tickerResponse,
+		"/0/private/AddOrder":    addOrderResponse,
+		"/0/private/QueryOrders": queryOrdersResponse,
+	})
+
+	p := newTestKrakenProvider(&krakenTestServer{Server: s}, dca.KrakenProviderConfig{})
+	res, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, got := 50000.0, res.Price; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	for i, encoding := range *acceptEncodings {
+		if want, got := "gzip", encoding; got != want {
+			t.Errorf("%d: want Accept-Encoding %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestKrakenProvider_GzipResponses_MaxResponseBytes(t *testing.T) {
+	// highly compressible, the compressed body is far below the limit while the decompressed body isn't
+	padding := strings.Repeat("x", 64<<10)
+	s, _ := gzipServer(t, map[string]string{
+		"/0/public/SystemStatus": `{"error":[],"result":{"status":"online","padding":"` + padding + `"}}`,
+		"/0/public/Ticker":       `{"error":[],"result":{"padding":"` + padding + `"}}`,
+	})
+
+	p := newTestKrakenProvider(&krakenTestServer{Server: s}, dca.KrakenProviderConfig{MaxResponseBytes: 16 << 10})
+	if _, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500}); !errors.Is(err, dca.ErrResponseTooLarge) {
+		t.Errorf("want %v got %v", dca.ErrResponseTooLarge, err)
+	}
+}
+
+func TestApp_Run_ExtraHeaders(t *testing.T) {
+	responses := map[string]string{
+		"/0/public/SystemStatus": `{"error":[],"result":{"status":"online"}}`,
+		"/0/public/Ticker":       tickerResponse,
+		"/0/private/AddOrder":    addOrderResponse,
+		"/0/private/QueryOrders": queryOrdersResponse,
+	}
+	var (
+		mu      sync.Mutex
+		headers = map[string]http.Header{}
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers[r.URL.Path] = r.Header.Clone()
+		mu.Unlock()
+		if body, ok := responses[r.URL.Path]; ok {
+			_, _ = w.Write([]byte(body))
+		}
+	}))
+	defer s.Close()
+
+	config := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(config, []byte(`{
+		"krakenApiKey": "key",
+		"krakenPrivateKey": "secret",
+		"krakenBaseUrl": "`+s.URL+`",
+		"orderAmountInCents": 500,
+		"extraHeaders": {"X-Proxy-Token": "awsssm://proxy/token", "X-Team": "dca"},
+		"pushgateway": {"url": "`+s.URL+`"}
+	}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	app := dca.NewApp()
+	app.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	app.SecretResolver = func(ctx context.Context, ref string) ([]byte, error) {
+		return []byte("resolved-token"), nil
+	}
+	if err := app.LoadConfig(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, path := range []string{"/0/public/Ticker", "/0/private/AddOrder", "/metrics/job/dca"} {
+		h, ok := headers[path]
+		if !ok {
+			t.Errorf("%s: no request captured", path)
+			continue
+		}
+		if want, got := "resolved-token", h.Get("X-Proxy-Token"); got != want {
+			t.Errorf("%s: want %v got %v", path, want, got)
+		}
+		if want, got := "dca", h.Get("X-Team"); got != want {
+			t.Errorf("%s: want %v got %v", path, want, got)
+		}
+	}
+	if want, got := "key", headers["/0/private/AddOrder"].Get("API-Key"); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	// header values are treated as secrets
+	eff, err := app.EffectiveConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "******", eff.Config.ExtraHeaders["X-Proxy-Token"]; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := "resolved-token", app.Config.ExtraHeaders["X-Proxy-Token"]; got != want {
+		t.Errorf("want masking to leave the config untouched got %v", got)
+	}
+}
+
+func TestAppConfig_Validate_ExtraHeaders(t *testing.T) {
+	tt := []struct {
+		headers map[string]string
+		err     string
+	}{
+		{map[string]string{"X-Proxy-Token": "token"}, ""},
+		{map[string]string{"api-key": "token"}, "extraHeaders: api-key is reserved for Kraken authentication"},
+		{map[string]string{"API-Sign": "token"}, "extraHeaders: API-Sign is reserved for Kraken authentication"},
+		{map[string]string{"X Proxy": "token"}, `extraHeaders: "X Proxy" is not a valid header name`},
+		{map[string]string{"X-Proxy-Token": "token\r\nX-Injected: 1"}, "extraHeaders: the value of X-Proxy-Token contains a line break"},
+	}
+	for i, tc := range tt {
+		cfg := dca.AppConfig{KrakenAPIKey: "key", KrakenPrivateKey: "secret", OrderAmountInCents: 500, ExtraHeaders: tc.headers}
+		err := cfg.Validate()
+		if tc.err == "" && err != nil {
+			t.Errorf("%d: want no error got %v", i, err)
+		} else if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%d: want %q got %v", i, tc.err, err)
+		}
+	}
+}
+
+func TestNewHTTPClient_Order(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+	record := func(call string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, call)
+	}
+	middleware := func(name string) func(http.RoundTripper) http.RoundTripper {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				// the extra headers are added after the middleware
+				record(name + ":" + req.Header.Get("X-Team"))
+				return next.RoundTrip(req)
+			})
+		}
+	}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		record("transport:" + req.Header.Get("X-Team"))
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{"error":[],"result":{}}`)), Request: req}, nil
+	})
+
+	client := dca.NewHTTPClient(dca.HTTPClientConfig{
+		ExtraHeaders: map[string]string{"X-Team": "dca"},
+		Middleware:   []func(http.RoundTripper) http.RoundTripper{middleware("outer"), middleware("inner")},
+		Transport:    transport,
+	})
+	res, err := client.Get("http://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+
+	if want, got := []string{"outer:", "inner:", "transport:dca"}, calls; !slices.Equal(got, want) {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestApp_Run_SharedHTTPClient(t *testing.T) {
+	responses := map[string]string{
+		"/0/public/SystemStatus": `{"error":[],"result":{"status":"online"}}`,
+		"/0/public/Ticker":       tickerResponse,
+		"/0/private/AddOrder":    addOrderResponse,
+		"/0/private/QueryOrders": queryOrdersResponse,
+	}
+	var conns atomic.Int64
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if body, ok := responses[r.URL.Path]; ok {
+			_, _ = w.Write([]byte(body))
+		}
+	}))
+	s.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	s.Start()
+	defer s.Close()
+
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(config, []byte(`{
+		"krakenApiKey": "key",
+		"krakenPrivateKey": "secret",
+		"krakenBaseUrl": "`+s.URL+`",
+		"orderAmountInCents": 500,
+		"skipClockSkewCheck": true,
+		"auditLog": "`+filepath.Join(dir, "audit.jsonl")+`",
+		"pushgateway": {"url": "`+s.URL+`"}
+	}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	app := dca.NewApp()
+	app.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := app.LoadConfig(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the calls to Kraken and the push are made over the same connection, one after the other
+	if want, got := int64(1), conns.Load(); got != want {
+		t.Errorf("want %v connections got %v", want, got)
+	}
+
+	// only the calls to the exchange are audited
+	b, err := os.ReadFile(filepath.Join(dir, "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 4, bytes.Count(b, []byte(`"provider":"kraken"`)); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if bytes.Contains(b, []byte("/metrics/job")) {
+		t.Errorf("want the push unaudited got %s", b)
+	}
+}
+
+// roundTripperFunc is an http.RoundTripper calling itself.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
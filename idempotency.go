@@ -0,0 +1,202 @@
+package dca
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RecordRef is the state of an idempotency key, from its reservation to the order it was committed with.
+type RecordRef struct {
+	Key        string    `json:"key"`
+	ReservedAt time.Time `json:"reservedAt"`
+	// CommittedAt is zero until the key is committed, a reservation left uncommitted means the run that reserved it
+	// stopped between reserving the key and committing its order.
+	CommittedAt time.Time `json:"committedAt"`
+	// RunID and TransactionID identify the run and the order the key was committed with.
+	RunID         string `json:"runId,omitempty"`
+	TransactionID string `json:"transactionId,omitempty"`
+}
+
+// Committed reports whether the key was committed with an order.
+func (r RecordRef) Committed() bool {
+	return !r.CommittedAt.IsZero()
+}
+
+// IdempotencyStore keeps the idempotency keys of runs so a run is only ordered once whatever the provider, e.g. when
+// its event is delivered twice. Paper orders and exchanges without a userref get the same guarantee as Kraken.
+type IdempotencyStore interface {
+	// Reserve atomically reserves key, alreadyUsed is set with the existing state of the key when it was reserved
+	// before.
+	Reserve(ctx context.Context, key string) (alreadyUsed bool, existing RecordRef, err error)
+	// Commit records the order placed under a reserved key.
+	Commit(ctx context.Context, key string, result RecordRef) error
+}
+
+// FileIdempotencyStore is an IdempotencyStore keeping a file per key in a directory. A key is reserved by creating
+// its file exclusively, so only one of the runs reserving a key at the same time succeeds.
+type FileIdempotencyStore struct {
+	Dir string
+}
+
+// NewFileIdempotencyStore creates an IdempotencyStore backed by the directory at dir, it's created on the first
+// Reserve.
+func NewFileIdempotencyStore(dir string) *FileIdempotencyStore {
+	return &FileIdempotencyStore{Dir: dir}
+}
+
+// path returns the file of key, keys are hashed since they may contain any character.
+func (s *FileIdempotencyStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.Dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+func (s *FileIdempotencyStore) Reserve(_ context.Context, key string) (alreadyUsed bool, existing RecordRef, err error) {
+	defer WrapErr(&err, "FileIdempotencyStore.Reserve")
+
+	if err = os.MkdirAll(s.Dir, 0700); err != nil {
+		return false, existing, err
+	}
+
+	b, err := json.Marshal(RecordRef{Key: key, ReservedAt: time.Now()})
+	if err != nil {
+		return false, existing, fmt.Errorf("failed to marshal reservation: %w", err)
+	}
+
+	f, err := os.OpenFile(s.path(key), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if errors.Is(err, os.ErrExist) {
+		existing = RecordRef{Key: key}
+		b, err := os.ReadFile(s.path(key))
+		if err != nil {
+			return true, existing, err
+		}
+		// a file left empty or partial by a crash while reserving is an uncommitted reservation
+		_ = json.Unmarshal(b, &existing)
+		return true, existing, nil
+	} else if err != nil {
+		return false, existing, err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	if _, err = f.Write(b); err != nil {
+		return false, existing, err
+	}
+	return false, existing, f.Sync()
+}
+
+func (s *FileIdempotencyStore) Commit(_ context.Context, key string, result RecordRef) (err error) {
+	defer WrapErr(&err, "FileIdempotencyStore.Commit")
+
+	result.Key = key
+	result.CommittedAt = cmp.Or(result.CommittedAt, time.Now())
+	b, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal commit: %w", err)
+	}
+
+	// replaced atomically so a concurrent Reserve never reads a partial commit
+	return writeFileAtomic(s.path(key), b)
+}
+
+// idempotencyKey returns the key the run's order is reserved under, the correlation ID of the event that triggered
+// the run or the time it was scheduled at. Runs with neither, e.g. from the CLI, have no key.
+func (m *App) idempotencyKey() string {
+	id := m.CorrelationID
+	if id == "" && !m.ScheduledAt.IsZero() {
+		id = m.ScheduledAt.UTC().Format(time.RFC3339)
+	}
+	if id == "" {
+		return ""
+	}
+	return strings.Join([]string{cmp.Or(m.Config.Provider, ProviderKraken), m.Config.Profile, m.Config.Label, cmp.Or(m.Config.Pair, KrakenDefaultPair), id}, "/")
+}
+
+// reserveIdempotencyKey reserves key in idempotency before the run orders. A run whose key was committed is skipped
+// as a duplicate. A key reserved but never committed belongs to a run that stopped in between, so the account is
+// reconciled against store and an order it adopts is committed in place of a new one. reconciled is set when the run
+// already reconciled and adopted summary.Adopted.
+func (m *App) reserveIdempotencyKey(ctx context.Context, idempotency IdempotencyStore, key string, provider *KrakenProvider, store OrderStore, reconciled bool, summary *RunSummary) error {
+	d := Decision{Name: DecisionIdempotency, Inputs: map[string]string{"key": key}, Outcome: DecisionProceed}
+
+	used, existing, err := idempotency.Reserve(ctx, key)
+	if err != nil {
+		d.Inputs["error"], d.Outcome, d.Narration = err.Error(), DecisionFail, "the key can't be reserved → fail"
+		recordDecision(ctx, d)
+		return fmt.Errorf("failed to reserve idempotency key: %w", err)
+	} else if !used {
+		d.Narration = "key reserved → proceed"
+		recordDecision(ctx, d)
+		return nil
+	}
+
+	d.Inputs["reservedAt"] = existing.ReservedAt.Format(time.RFC3339)
+	if existing.Committed() {
+		d.Inputs["transactionId"] = existing.TransactionID
+		d.Outcome, d.Narration = DecisionSkip, fmt.Sprintf("key already ordered %s → skip", cmp.Or(existing.TransactionID, "an order"))
+		recordDecision(ctx, d)
+		m.Logger.WarnContext(ctx, "skipping a run whose idempotency key was committed", "key", key, "transactionId", existing.TransactionID, "runId", existing.RunID)
+		return &SkipError{Reason: SkipReasonDuplicate}
+	}
+
+	// the run that reserved the key stopped before committing it, it may have placed its order
+	m.Logger.WarnContext(ctx, "resolving an uncommitted idempotency key", "key", key, "reservedAt", existing.ReservedAt)
+	paper := m.Config.Provider == ProviderPaper || m.Config.Provider == ProviderPaperRealistic
+	switch {
+	case paper:
+		d.Narration = "key never committed by a paper run → proceed"
+		recordDecision(ctx, d)
+		return nil
+	case store == nil:
+		d.Outcome, d.Narration = DecisionFail, "key never committed and no order store to reconcile against → fail"
+		recordDecision(ctx, d)
+		return fmt.Errorf("idempotency key %s was reserved at %s without being committed, orderStorePath is required to reconcile it", key, existing.ReservedAt.Format(time.RFC3339))
+	case !reconciled:
+		adopted, err := m.reconcile(ctx, provider, store)
+		if err != nil {
+			d.Inputs["error"], d.Outcome, d.Narration = err.Error(), DecisionFail, "key never committed and its order can't be checked → fail"
+			recordDecision(ctx, d)
+			return err
+		}
+		summary.Adopted = append(summary.Adopted, adopted...)
+	}
+
+	d.Inputs["adopted"] = strconv.Itoa(len(summary.Adopted))
+	if len(summary.Adopted) == 0 {
+		d.Narration = "key never committed and reconciliation found no order → proceed"
+		recordDecision(ctx, d)
+		return nil
+	}
+
+	order := summary.Adopted[len(summary.Adopted)-1]
+	if err := idempotency.Commit(ctx, key, RecordRef{ReservedAt: existing.ReservedAt, RunID: summary.RunID, TransactionID: order.TransactionID}); err != nil {
+		m.Logger.WarnContext(ctx, "failed to commit the idempotency key of an adopted order", "key", key, "error", err)
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("failed to commit idempotency key %s: %v", key, err))
+	}
+	d.Outcome, d.Narration = DecisionSkip, fmt.Sprintf("key never committed and reconciliation adopted %s → skip", order.TransactionID)
+	recordDecision(ctx, d)
+	return &SkipError{Reason: SkipReasonOrderAdopted}
+}
+
+// commitIdempotencyKey commits key with the run's order, a failure is a warning since the order was placed.
+func (m *App) commitIdempotencyKey(ctx context.Context, idempotency IdempotencyStore, key string, res ExecuteOrderResponse, summary *RunSummary) {
+	err := m.recoverPanic(ctx, "IdempotencyStore.Commit", func() error {
+		return idempotency.Commit(ctx, key, RecordRef{RunID: summary.RunID, TransactionID: res.TransactionID})
+	})
+	if err != nil {
+		m.Logger.ErrorContext(ctx, "failed to commit idempotency key", "key", key, "error", err, "transactionId", res.TransactionID)
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("failed to commit idempotency key %s: %v", key, err))
+	}
+}
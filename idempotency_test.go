@@ -0,0 +1,212 @@
+package dca_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+func TestFileIdempotencyStore(t *testing.T) {
+	ctx := context.Background()
+	store := dca.NewFileIdempotencyStore(filepath.Join(t.TempDir(), "keys"))
+
+	used, _, err := store.Reserve(ctx, "kraken/event-1")
+	if err != nil {
+		t.Fatal(err)
+	} else if used {
+		t.Fatal("want the first reservation to succeed")
+	}
+
+	used, existing, err := store.Reserve(ctx, "kraken/event-1")
+	if err != nil {
+		t.Fatal(err)
+	} else if !used || existing.Committed() {
+		t.Fatalf("want an uncommitted reservation got used %v %+v", used, existing)
+	}
+	if existing.ReservedAt.IsZero() {
+		t.Errorf("want the reservation time")
+	}
+
+	if err = store.Commit(ctx, "kraken/event-1", dca.RecordRef{RunID: "run-1", TransactionID: "TXID-1"}); err != nil {
+		t.Fatal(err)
+	}
+	used, existing, err = store.Reserve(ctx, "kraken/event-1")
+	if err != nil {
+		t.Fatal(err)
+	} else if !used || !existing.Committed() {
+		t.Fatalf("want a committed key got used %v %+v", used, existing)
+	}
+	if want, got := "TXID-1", existing.TransactionID; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	// other keys are independent
+	if used, _, err = store.Reserve(ctx, "kraken/event-2"); err != nil || used {
+		t.Errorf("want a new key reserved got used %v: %v", used, err)
+	}
+}
+
+func TestFileIdempotencyStore_Reserve_Concurrent(t *testing.T) {
+	store := dca.NewFileIdempotencyStore(t.TempDir())
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		reserved int
+	)
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			used, _, err := store.Reserve(context.Background(), "kraken/event-1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !used {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if want, got := 1, reserved; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+// lostCommitStore drops commits, like a run that crashes between placing its order and committing its key.
+type lostCommitStore struct {
+	dca.IdempotencyStore
+}
+
+func (lostCommitStore) Commit(context.Context, string, dca.RecordRef) error { return nil }
+
+func TestApp_Run_Idempotency(t *testing.T) {
+	opened := formatFloat(float64(time.Now().Add(-time.Minute).Unix()))
+	noOrders := `{"error":[],"result":{"closed":{},"count":0}}`
+	crashedOrder := `{"error":[],"result":{"closed":{"TXID-1":{"userref":3530,"status":"closed","opentm":` + opened +
+		`,"descr":{"ordertype":"market","order":"buy 0.0001 XBTUSD @ market"},"vol":"0.0001","vol_exec":"0.0001","cost":"5.00","fee":"0.02","price":"50000.0"}},"count":1}}`
+
+	// run starts a run of the event with a fresh order store, orders recorded by a run that crashed are lost with it
+	run := func(idempotency dca.IdempotencyStore, addOrder, closedOrders string) (*krakenTestServer, dca.RunSummary) {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus":  {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":        {tickerResponse},
+			"/0/private/OpenOrders":   {`{"error":[],"result":{"open":{}}}`},
+			"/0/private/ClosedOrders": {closedOrders},
+			"/0/private/AddOrder":     {addOrder},
+			"/0/private/QueryOrders":  {queryOrdersResponse},
+		})
+		app, n := newTestApp(s, dca.AppConfig{OrderStorePath: filepath.Join(t.TempDir(), "orders.jsonl")})
+		app.CorrelationID = "event-1"
+		app.IdempotencyStore = idempotency
+		_ = app.Run(context.Background())
+		return s, n.summaries[0]
+	}
+
+	t.Run("crash_before_order", func(t *testing.T) {
+		store := dca.NewFileIdempotencyStore(t.TempDir())
+
+		// the first run reserves the key but stops before its order is placed
+		_, summary := run(store, `{"error":["EOrder:Insufficient funds"]}`, noOrders)
+		if want, got := dca.RunStatusFailed, summary.Status; got != want {
+			t.Fatalf("want %v got %v", want, got)
+		}
+
+		// the redelivered event finds no order for the reservation and orders
+		s, summary := run(store, addOrderResponse, noOrders)
+		if want, got := dca.RunStatusSuccess, summary.Status; got != want {
+			t.Fatalf("want %v got %v (%s)", want, got, summary.Error)
+		}
+		if want, got := 1, len(s.Requests("/0/private/ClosedOrders")); got != want {
+			t.Errorf("want reconciliation %v got %v", want, got)
+		}
+
+		// once committed the event is a duplicate
+		s, summary = run(store, addOrderResponse, noOrders)
+		if want, got := dca.SkipReasonDuplicate, summary.SkipReason; got != want {
+			t.Errorf("want %v got %v", want, got)
+		}
+		if want, got := 0, len(s.Requests("/0/private/AddOrder")); got != want {
+			t.Errorf("want %v got %v", want, got)
+		}
+	})
+
+	t.Run("crash_after_order", func(t *testing.T) {
+		store := dca.NewFileIdempotencyStore(t.TempDir())
+
+		// the first run places its order but never commits its key
+		s, summary := run(lostCommitStore{store}, addOrderResponse, noOrders)
+		if want, got := 1, len(s.Requests("/0/private/AddOrder")); got != want {
+			t.Fatalf("want %v got %v (%s)", want, got, summary.Error)
+		}
+
+		// the redelivered event adopts the order of the reservation instead of ordering again
+		s, summary = run(store, addOrderResponse, crashedOrder)
+		if want, got := dca.SkipReasonOrderAdopted, summary.SkipReason; got != want {
+			t.Fatalf("want %v got %v (%s)", want, got, summary.Error)
+		}
+		if want, got := 0, len(s.Requests("/0/private/AddOrder")); got != want {
+			t.Errorf("want %v got %v", want, got)
+		}
+		if want, got := 1, len(summary.Adopted); got != want {
+			t.Fatalf("want %v got %v", want, got)
+		}
+
+		// the adopted order committed the key
+		_, summary = run(store, addOrderResponse, crashedOrder)
+		if want, got := dca.SkipReasonDuplicate, summary.SkipReason; got != want {
+			t.Errorf("want %v got %v", want, got)
+		}
+	})
+
+	t.Run("paper", func(t *testing.T) {
+		store := dca.NewFileIdempotencyStore(t.TempDir())
+		if _, _, err := store.Reserve(context.Background(), "paper///XBTUSD/event-1"); err != nil {
+			t.Fatal(err)
+		}
+
+		// paper orders aren't real so an uncommitted reservation is ordered again, a committed one is a duplicate
+		for i, expected := range []dca.RunStatus{dca.RunStatusSuccess, dca.RunStatusSkipped} {
+			s := newKrakenTestServer(t, map[string][]string{
+				"/0/public/Ticker": {tickerResponse},
+			})
+			app, n := newTestApp(s, dca.AppConfig{Provider: dca.ProviderPaper})
+			app.CorrelationID = "event-1"
+			app.IdempotencyStore = store
+			if err := app.Run(context.Background()); err != nil {
+				t.Fatalf("%d: %v", i, err)
+			}
+			if want, got := expected, n.summaries[0].Status; got != want {
+				t.Errorf("%d: want %v got %v (%s)", i, want, got, n.summaries[0].Error)
+			}
+		}
+	})
+}
+
+func TestAppConfig_Validate_IdempotencyStorePath(t *testing.T) {
+	tt := []struct {
+		provider       string
+		orderStorePath string
+		valid          bool
+	}{
+		{"", "orders.jsonl", true},
+		// reconciling an uncommitted key needs the order store
+		{"", "", false},
+		{dca.ProviderPaper, "", true},
+	}
+	for i, tc := range tt {
+		cfg := dca.AppConfig{KrakenAPIKey: "key", KrakenPrivateKey: "secret", OrderAmountInCents: 500, Provider: tc.provider,
+			OrderStorePath: tc.orderStorePath, IdempotencyStorePath: "keys"}
+		if want, got := tc.valid, cfg.Validate() == nil; got != want {
+			t.Errorf("%d: want valid %v got %v", i, want, cfg.Validate())
+		}
+	}
+}
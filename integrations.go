@@ -0,0 +1,158 @@
+package dca
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultIntegrationCheckTimeout bounds the checks of every integration made before a run orders.
+const DefaultIntegrationCheckTimeout = 5 * time.Second
+
+// IntegrationChecker is implemented by order stores, notifiers and archives which can cheaply check they're
+// reachable and permitted, without side effects, before a run orders.
+type IntegrationChecker interface {
+	Check(ctx context.Context) error
+}
+
+// IntegrationCheck is the outcome of the check of an integration.
+type IntegrationCheck struct {
+	Name string
+	Err  error
+}
+
+// integration is a configured integration of the app.
+type integration struct {
+	name    string
+	checker IntegrationChecker
+}
+
+// integrations returns the configured integrations which can be checked.
+func (m *App) integrations(ctx context.Context) []integration {
+	var list []integration
+
+	paper := m.Config.Provider == ProviderPaper || m.Config.Provider == ProviderPaperRealistic
+	if m.Config.OrderStorePath != "" && !paper {
+		list = append(list, integration{"orderStore", m.fileOrderStore()})
+	}
+
+	// the location is validated by LoadConfig
+	if m.Config.FailureArchive != "" {
+		if archive, err := NewFailureArchive(m.Config.FailureArchive); err == nil {
+			if s3, ok := archive.(*S3FailureArchive); ok {
+				s3.HTTPClient = m.httpClient()
+			}
+			if checker, ok := archive.(IntegrationChecker); ok {
+				list = append(list, integration{"failureArchive", checker})
+			}
+		}
+	}
+
+	for _, n := range m.notifiers(ctx) {
+		checker, ok := n.(IntegrationChecker)
+		if !ok {
+			continue
+		}
+		switch n.(type) {
+		case *DiscordNotifier:
+			list = append(list, integration{"discord", checker})
+		case *MQTTNotifier:
+			list = append(list, integration{"mqtt", checker})
+		case *PushgatewayNotifier:
+			list = append(list, integration{"pushgateway", checker})
+		default:
+			list = append(list, integration{fmt.Sprintf("%T", n), checker})
+		}
+	}
+	return list
+}
+
+// checkIntegrations checks every configured integration concurrently under a single deadline before a run orders, so
+// a typo in a store path or broker address is found before the purchase rather than after it. Failures are warnings
+// unless strictIntegrations is set, then they fail the run with ErrIntegrationCheck.
+func (m *App) checkIntegrations(ctx context.Context, summary *RunSummary) error {
+	list := m.integrations(ctx)
+	if len(list) == 0 {
+		return nil
+	}
+
+	timeout := m.IntegrationCheckTimeout
+	if timeout <= 0 {
+		timeout = DefaultIntegrationCheckTimeout
+	}
+	timeout, err := stepTimeout(ctx, m.Logger, "integration checks", integrationCheckBudget, timeout)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	checks := make([]IntegrationCheck, len(list))
+	var wg sync.WaitGroup
+	for i, in := range list {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checks[i] = IntegrationCheck{Name: in.name, Err: in.checker.Check(ctx)}
+		}()
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, c := range checks {
+		if c.Err == nil {
+			m.Logger.InfoContext(ctx, "integration check passed", "integration", c.Name)
+			continue
+		}
+		m.Logger.WarnContext(ctx, "integration check failed", "integration", c.Name, "error", c.Err)
+		errs = append(errs, fmt.Errorf("%s: %w", c.Name, c.Err))
+		if !m.Config.StrictIntegrations {
+			summary.Warnings = append(summary.Warnings, fmt.Sprintf("integration check of %s failed: %v", c.Name, c.Err))
+		}
+	}
+
+	d := Decision{Name: DecisionIntegrations, Inputs: map[string]string{"checked": strconv.Itoa(len(checks)), "failed": strconv.Itoa(len(errs))}, Outcome: DecisionProceed}
+	switch {
+	case len(errs) == 0:
+		d.Narration = fmt.Sprintf("%d of %d integrations passed → proceed", len(checks), len(checks))
+	case m.Config.StrictIntegrations:
+		d.Outcome, d.Narration = DecisionFail, fmt.Sprintf("%d of %d integrations failed with strictIntegrations → fail", len(errs), len(checks))
+	default:
+		d.Narration = fmt.Sprintf("%d of %d integrations failed → proceed with warnings", len(errs), len(checks))
+	}
+	recordDecision(ctx, d)
+
+	if len(errs) > 0 && m.Config.StrictIntegrations {
+		return fmt.Errorf("%w: %w", ErrIntegrationCheck, errors.Join(errs...))
+	}
+	return nil
+}
+
+// checkWritableDir makes sure files can be created in dir, or in its closest existing parent when dir doesn't exist
+// yet, by creating and removing a temporary file.
+func checkWritableDir(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		if errors.Is(err, os.ErrNotExist) && filepath.Dir(dir) != dir {
+			dir = filepath.Dir(dir)
+			continue
+		} else if err != nil {
+			return err
+		} else if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		break
+	}
+
+	f, err := os.CreateTemp(dir, ".dca-check-*")
+	if err != nil {
+		return err
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
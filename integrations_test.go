@@ -0,0 +1,156 @@
+package dca_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+// checkingNotifier is a notifier whose check fails with err, or blocks until its context is done when block is set.
+type checkingNotifier struct {
+	err   error
+	block bool
+}
+
+func (n *checkingNotifier) Notify(context.Context, dca.RunSummary) error { return nil }
+
+func (n *checkingNotifier) Check(ctx context.Context) error {
+	if n.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return n.err
+}
+
+func TestApp_Run_IntegrationChecks(t *testing.T) {
+	denied := errors.New("AccessDeniedException: not authorized to perform DescribeTable")
+	pushgateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer pushgateway.Close()
+
+	// a file where the store's directory should be
+	blocked := filepath.Join(t.TempDir(), "blocked")
+	if err := os.WriteFile(blocked, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		cfg      dca.AppConfig
+		checker  *checkingNotifier
+		strict   bool
+		status   dca.RunStatus
+		warnings []string
+	}{
+		{dca.AppConfig{}, &checkingNotifier{}, false, dca.RunStatusSuccess, nil},
+		{dca.AppConfig{}, &checkingNotifier{err: denied}, false, dca.RunStatusSuccess, []string{"*dca_test.checkingNotifier failed: AccessDeniedException"}},
+		{dca.AppConfig{}, &checkingNotifier{err: denied}, true, dca.RunStatusFailed, nil},
+		{dca.AppConfig{Pushgateway: &dca.PushgatewayConfig{URL: pushgateway.URL}}, &checkingNotifier{}, false, dca.RunStatusSuccess, []string{"pushgateway failed: PushgatewayNotifier.Check: pushgateway returned 403 Forbidden"}},
+		{dca.AppConfig{OrderStorePath: filepath.Join(blocked, "orders.jsonl")}, &checkingNotifier{}, false, dca.RunStatusSuccess, []string{"orderStore failed", "not a directory"}},
+		{dca.AppConfig{OrderStorePath: filepath.Join(t.TempDir(), "orders.jsonl")}, &checkingNotifier{}, true, dca.RunStatusSuccess, nil},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		tc.cfg.StrictIntegrations = tc.strict
+		app, n := newTestApp(s, tc.cfg)
+		app.Notifiers = append(app.Notifiers, tc.checker)
+
+		err := app.Run(context.Background())
+		summary := n.summaries[0]
+		if want, got := tc.status, summary.Status; got != want {
+			t.Errorf("%d: want %v got %v (%v)", i, want, got, err)
+		}
+
+		// a strict failure happens before anything is ordered
+		if want, got := tc.status == dca.RunStatusSuccess, len(s.Requests("/0/private/AddOrder")) > 0; got != want {
+			t.Errorf("%d: want ordered %v got %v", i, want, got)
+		}
+		if tc.status == dca.RunStatusFailed && !errors.Is(err, dca.ErrIntegrationCheck) {
+			t.Errorf("%d: want %v got %v", i, dca.ErrIntegrationCheck, err)
+		}
+
+		if want, got := len(tc.warnings) > 0, len(summary.Warnings) > 0; got != want {
+			t.Errorf("%d: want warnings %v got %v", i, want, got)
+		}
+		for _, w := range tc.warnings {
+			if !strings.Contains(strings.Join(summary.Warnings, "\n"), w) {
+				t.Errorf("%d: want a warning containing %q got %v", i, w, summary.Warnings)
+			}
+		}
+	}
+}
+
+func TestApp_Run_IntegrationChecksTimeout(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":       {tickerResponse},
+		"/0/private/AddOrder":    {addOrderResponse},
+		"/0/private/QueryOrders": {queryOrdersResponse},
+	})
+	app, n := newTestApp(s, dca.AppConfig{})
+	app.Notifiers = append(app.Notifiers, &checkingNotifier{block: true}, &checkingNotifier{block: true})
+	const timeout = 200 * time.Millisecond
+	app.IntegrationCheckTimeout = timeout
+
+	start := time.Now()
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// checks run concurrently under a single deadline
+	if elapsed := time.Since(start); elapsed >= 2*timeout {
+		t.Errorf("want less than %v got %v", 2*timeout, elapsed)
+	}
+	if want, got := 2, len(n.summaries[0].Warnings); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestS3FailureArchive_Check(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+	tt := []struct {
+		status int
+		err    string
+	}{
+		{http.StatusOK, ""},
+		{http.StatusForbidden, "s3 returned 403 Forbidden"},
+		{http.StatusNotFound, "s3 returned 404 Not Found"},
+	}
+	for i, tc := range tt {
+		var method, path string
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method, path = r.Method, r.URL.Path
+			w.WriteHeader(tc.status)
+		}))
+
+		archive := &dca.S3FailureArchive{S3Location: dca.S3Location{Bucket: "bucket", Endpoint: s.URL}, Prefix: "dca"}
+		err := archive.Check(context.Background())
+		s.Close()
+
+		if tc.err == "" && err != nil {
+			t.Errorf("%d: unexpected error: %v", i, err)
+		} else if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%d: want %q got %v", i, tc.err, err)
+		}
+		if want, got := "HEAD /bucket/", method+" "+path; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
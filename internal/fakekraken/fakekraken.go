@@ -0,0 +1,548 @@
+// Package fakekraken is a deterministic fake of the subset of the Kraken REST API the provider uses, for
+// integration tests. It verifies the signature of private calls against a test secret and the nonces of each key, so
+// authentication bugs fail tests as they would fail against Kraken. Scenarios such as a partial fill or maintenance
+// are selected per server or per request with ScenarioHeader, which keeps concurrent tests independent. Faults
+// script the failure of single calls, such as the third AddOrder or an order placed while its response is lost.
+package fakekraken
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scenarios the server can play.
+const (
+	// ScenarioHappy fills every order in full at the top of the book.
+	ScenarioHappy = "happy"
+	// ScenarioPartialFill leaves every order open with half of its volume filled.
+	ScenarioPartialFill = "partial_fill"
+	// ScenarioRateLimit fails every private call with EAPI:Rate limit exceeded.
+	ScenarioRateLimit = "rate_limit"
+	// ScenarioMaintenance reports the maintenance status and fails every private call with EService:Unavailable.
+	ScenarioMaintenance = "maintenance"
+	// ScenarioInvalidNonce fails every private call with EAPI:Invalid nonce.
+	ScenarioInvalidNonce = "invalid_nonce"
+)
+
+// Fault classes, what a Fault fails its call with.
+const (
+	// FaultRateLimit fails the call with EAPI:Rate limit exceeded before it takes effect.
+	FaultRateLimit = "rate_limit"
+	// FaultUnavailable fails the call with EService:Unavailable before it takes effect.
+	FaultUnavailable = "unavailable"
+	// FaultInsufficientFunds fails the call with EOrder:Insufficient funds before it takes effect.
+	FaultInsufficientFunds = "insufficient_funds"
+	// FaultServerError fails the call with a 502 Bad Gateway before it takes effect.
+	FaultServerError = "server_error"
+	// FaultDisconnect closes the connection without a response after the call took effect, e.g. an order is placed
+	// but its client never learns its transaction ID.
+	FaultDisconnect = "disconnect"
+)
+
+// Fault is a scripted failure of a call to an endpoint. Faults fail calls whatever the scenario, the first fault
+// matching a call applies.
+type Fault struct {
+	// Path is the endpoint whose call fails, e.g. /0/private/AddOrder.
+	Path string
+	// Call is the number of the call to Path that fails, counted from 1, every call fails when it's zero.
+	Call int
+	// Class is what the call fails with, one of the Fault constants. The call doesn't fail when it's empty, only
+	// Delay, PartialFill and Unqueryable apply.
+	Class string
+	// Delay holds back the response of the call after it took effect, as Config.Delays does.
+	Delay time.Duration
+	// PartialFill leaves an order placed by the call open with half of its volume filled, as ScenarioPartialFill.
+	PartialFill bool
+	// Unqueryable hides an order placed by the call from that many calls to the QueryOrders, OpenOrders and
+	// ClosedOrders endpoints, as when an order is placed before Kraken reports it. With FaultDisconnect it plays the
+	// window in which a client has lost its order and can't find it yet.
+	Unqueryable int
+}
+
+// ScenarioHeader selects the scenario of a single request, overriding Config.Scenario.
+const ScenarioHeader = "X-Fake-Kraken-Scenario"
+
+// FeeRate is the fraction of the cost of a fill charged as a fee.
+const FeeRate = 0.0026
+
+// Pair is a market the server quotes and fills orders on.
+type Pair struct {
+	// ResultKey is the key of the pair in responses, e.g. XXBTZUSD.
+	ResultKey  string
+	BaseAsset  string
+	QuoteAsset string
+	Ask        float64
+	Bid        float64
+	OrderMin   string
+	CostMin    string
+	// LotDecimals is the number of decimals of order volumes.
+	LotDecimals int
+}
+
+// DefaultPairs are the markets of a server without configured pairs, keyed by the name orders use.
+var DefaultPairs = map[string]Pair{
+	"XBTUSD": {ResultKey: "XXBTZUSD", BaseAsset: "XXBT", QuoteAsset: "ZUSD", Ask: 50000, Bid: 49990, OrderMin: "0.00005", CostMin: "0.5", LotDecimals: 8},
+	"XBTEUR": {ResultKey: "XXBTZEUR", BaseAsset: "XXBT", QuoteAsset: "ZEUR", Ask: 46000, Bid: 45990, OrderMin: "0.00005", CostMin: "0.5", LotDecimals: 8},
+	"ETHUSD": {ResultKey: "XETHZUSD", BaseAsset: "XETH", QuoteAsset: "ZUSD", Ask: 3000, Bid: 2999, OrderMin: "0.002", CostMin: "0.5", LotDecimals: 8},
+	"ETHEUR": {ResultKey: "XETHZEUR", BaseAsset: "XETH", QuoteAsset: "ZEUR", Ask: 2760, Bid: 2759, OrderMin: "0.002", CostMin: "0.5", LotDecimals: 8},
+}
+
+// DefaultBalances are the balances of a server without configured balances.
+var DefaultBalances = map[string]float64{"ZUSD": 1000, "ZEUR": 1000, "XXBT": 0.5, "XETH": 2}
+
+// Config configures a Server.
+type Config struct {
+	// APIKey is the only key private calls are accepted with.
+	APIKey string
+	// Secret is the decoded private key private calls must be signed with.
+	Secret []byte
+	// Scenario is played by requests without ScenarioHeader, defaults to ScenarioHappy.
+	Scenario string
+	// Pairs defaults to DefaultPairs.
+	Pairs map[string]Pair
+	// Balances defaults to DefaultBalances, fills update them.
+	Balances map[string]float64
+	// Now defaults to time.Now, it stamps the open and close times of orders.
+	Now func() time.Time
+	// Delays holds back the responses of the endpoints at their paths after the calls took effect, e.g. so an order
+	// is placed while its client gives up waiting for the response.
+	Delays map[string]time.Duration
+	// Faults are scripted failures of calls, see Fault.
+	Faults []Fault
+}
+
+// order is an order placed on the server.
+type order struct {
+	pair    string
+	side    string
+	userref int
+	volume  float64
+	filled  float64
+	price   float64
+	status  string
+	opened  time.Time
+	// hidden is the number of calls to the order endpoints the order is left out of, see Fault.Unqueryable
+	hidden int
+}
+
+// Server is an http.Handler serving the fake API. It's safe for concurrent use.
+type Server struct {
+	cfg Config
+
+	mu       sync.Mutex
+	nonces   map[string]int64
+	balances map[string]float64
+	orders   map[string]*order
+	seq      int
+	calls    map[string]int
+}
+
+// New returns a server with cfg.
+func New(cfg Config) *Server {
+	if cfg.Scenario == "" {
+		cfg.Scenario = ScenarioHappy
+	}
+	if cfg.Pairs == nil {
+		cfg.Pairs = DefaultPairs
+	}
+	if cfg.Balances == nil {
+		cfg.Balances = DefaultBalances
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
+	balances := make(map[string]float64, len(cfg.Balances))
+	for asset, balance := range cfg.Balances {
+		balances[asset] = balance
+	}
+	return &Server{cfg: cfg, nonces: map[string]int64{}, balances: balances, orders: map[string]*order{}, calls: map[string]int{}}
+}
+
+// Sign returns the API-Sign header of a private call to path with the encoded form body and nonce, signed with
+// secret the way Kraken expects.
+func Sign(secret []byte, path string, nonce string, body string) string {
+	sha := sha256.New()
+	sha.Write([]byte(nonce + body))
+
+	mac := hmac.New(sha512.New, secret)
+	mac.Write(append([]byte(path), sha.Sum(nil)...))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// apiError is a failed call, its message is returned in the error field of the response.
+type apiError string
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err = r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	scenario := r.Header.Get(ScenarioHeader)
+	if scenario == "" {
+		scenario = s.cfg.Scenario
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/0/private/") && r.Method != http.MethodPost {
+		http.Error(w, "private calls must be POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fault := s.fault(r.URL.Path)
+	var (
+		result any
+		apiErr apiError
+	)
+	switch fault.Class {
+	case FaultRateLimit:
+		apiErr = "EAPI:Rate limit exceeded"
+	case FaultUnavailable:
+		apiErr = "EService:Unavailable"
+	case FaultInsufficientFunds:
+		apiErr = "EOrder:Insufficient funds"
+	case FaultServerError:
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+		return
+	default:
+		if result, apiErr = s.handle(r, string(body), scenario, fault); result == nil && apiErr == "" {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	// the call has taken effect, only its response is held back
+	if delay := max(s.cfg.Delays[r.URL.Path], fault.Delay); delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if fault.Class == FaultDisconnect {
+		panic(http.ErrAbortHandler)
+	}
+
+	response := struct {
+		Error  []string `json:"error"`
+		Result any      `json:"result,omitempty"`
+	}{Error: []string{}, Result: result}
+	if apiErr != "" {
+		response.Error, response.Result = []string{string(apiErr)}, nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// Calls returns the number of calls made to the endpoint at path, including failed ones.
+func (s *Server) Calls(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[path]
+}
+
+// fault counts a call to path and returns the first fault matching it, the zero Fault when none does.
+func (s *Server) fault(path string) Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls[path]++
+	for _, f := range s.cfg.Faults {
+		if f.Path == path && (f.Call == 0 || f.Call == s.calls[path]) {
+			return f
+		}
+	}
+	return Fault{}
+}
+
+// handle serves a call with fault applied, a nil result without an error is an unknown endpoint.
+func (s *Server) handle(r *http.Request, body string, scenario string, fault Fault) (any, apiError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/0/public/"):
+		return s.public(r.URL.Path, r.Form, scenario)
+	case strings.HasPrefix(r.URL.Path, "/0/private/"):
+		if apiErr := s.authenticate(r, body); apiErr != "" {
+			return nil, apiErr
+		}
+		if fault.PartialFill {
+			scenario = ScenarioPartialFill
+		}
+		return s.private(r.URL.Path, r.PostForm, scenario, fault.Unqueryable)
+	}
+	return nil, ""
+}
+
+// authenticate checks the key, signature and nonce of a private call with the encoded form body.
+func (s *Server) authenticate(r *http.Request, body string) apiError {
+	key := r.Header.Get("API-Key")
+	if key == "" || key != s.cfg.APIKey {
+		return "EAPI:Invalid key"
+	}
+
+	nonce := r.PostForm.Get("nonce")
+	n, err := strconv.ParseInt(nonce, 10, 64)
+	if err != nil {
+		return "EAPI:Invalid nonce"
+	}
+
+	want := Sign(s.cfg.Secret, r.URL.Path, nonce, body)
+	if !hmac.Equal([]byte(r.Header.Get("API-Sign")), []byte(want)) {
+		return "EAPI:Invalid signature"
+	}
+
+	// a replayed or reordered nonce fails whatever the scenario
+	if n <= s.nonces[key] {
+		return "EAPI:Invalid nonce"
+	}
+	s.nonces[key] = n
+	return ""
+}
+
+// public serves a public endpoint, a nil result without an error is an unknown endpoint.
+func (s *Server) public(path string, form url.Values, scenario string) (any, apiError) {
+	switch path {
+	case "/0/public/SystemStatus":
+		status := "online"
+		if scenario == ScenarioMaintenance {
+			status = "maintenance"
+		}
+		return map[string]string{"status": status, "timestamp": s.cfg.Now().UTC().Format(time.RFC3339)}, ""
+	case "/0/public/Time":
+		now := s.cfg.Now()
+		return map[string]any{"unixtime": now.Unix(), "rfc1123": now.UTC().Format(time.RFC1123)}, ""
+	case "/0/public/Ticker":
+		_, pair, ok := s.pair(form.Get("pair"))
+		if !ok {
+			return nil, "EQuery:Unknown asset pair"
+		}
+		return map[string]any{pair.ResultKey: map[string]any{
+			"a": []string{formatPrice(pair.Ask), "1", "1.000"},
+			"b": []string{formatPrice(pair.Bid), "1", "1.000"},
+			"c": []string{formatPrice(pair.Ask), "0.001"},
+		}}, ""
+	case "/0/public/AssetPairs":
+		name, pair, ok := s.pair(form.Get("pair"))
+		if !ok {
+			return nil, "EQuery:Unknown asset pair"
+		}
+		return map[string]any{pair.ResultKey: map[string]any{
+			"altname":       name,
+			"base":          pair.BaseAsset,
+			"quote":         pair.QuoteAsset,
+			"ordermin":      pair.OrderMin,
+			"costmin":       pair.CostMin,
+			"pair_decimals": 1,
+			"lot_decimals":  pair.LotDecimals,
+		}}, ""
+	}
+	return nil, ""
+}
+
+// private serves a private endpoint of an authenticated call, an order it places is hidden from the next unqueryable
+// calls to the order endpoints.
+func (s *Server) private(path string, form url.Values, scenario string, unqueryable int) (any, apiError) {
+	switch scenario {
+	case ScenarioRateLimit:
+		return nil, "EAPI:Rate limit exceeded"
+	case ScenarioMaintenance:
+		return nil, "EService:Unavailable"
+	case ScenarioInvalidNonce:
+		return nil, "EAPI:Invalid nonce"
+	}
+
+	switch path {
+	case "/0/private/Balance":
+		balances := make(map[string]string, len(s.balances))
+		for asset, balance := range s.balances {
+			balances[asset] = strconv.FormatFloat(balance, 'f', 10, 64)
+		}
+		return balances, ""
+	case "/0/private/AddOrder":
+		return s.addOrder(form, scenario, unqueryable)
+	case "/0/private/OpenOrders":
+		defer s.reveal()
+		return map[string]any{"open": s.findOrders(form, func(o *order) bool { return o.status == "open" })}, ""
+	case "/0/private/ClosedOrders":
+		defer s.reveal()
+		start, _ := strconv.ParseInt(form.Get("start"), 10, 64)
+		closed := s.findOrders(form, func(o *order) bool { return o.status == "closed" && o.opened.Unix() >= start })
+		return map[string]any{"closed": closed, "count": len(closed)}, ""
+	case "/0/private/QueryOrders":
+		defer s.reveal()
+		result := map[string]any{}
+		for _, txid := range strings.Split(form.Get("txid"), ",") {
+			if o, ok := s.orders[txid]; ok && o.hidden == 0 {
+				result[txid] = o.response()
+			}
+		}
+		if len(result) == 0 {
+			return nil, "EOrder:Unknown order"
+		}
+		return result, ""
+	}
+	return nil, ""
+}
+
+// reveal counts a call to the order endpoints down for the hidden orders.
+func (s *Server) reveal() {
+	for _, o := range s.orders {
+		if o.hidden > 0 {
+			o.hidden--
+		}
+	}
+}
+
+// findOrders returns the orders matching the userref of form, if any, for which match is true. Hidden orders are
+// left out.
+func (s *Server) findOrders(form url.Values, match func(*order) bool) map[string]any {
+	orders := map[string]any{}
+	for txid, o := range s.orders {
+		if o.hidden > 0 {
+			continue
+		}
+		if userref := form.Get("userref"); userref != "" && userref != strconv.Itoa(o.userref) {
+			continue
+		}
+		if match(o) {
+			orders[txid] = o.response()
+		}
+	}
+	return orders
+}
+
+// addOrder places a market order hidden from the next unqueryable calls to the order endpoints, or only validates it
+// when validate is set.
+func (s *Server) addOrder(form url.Values, scenario string, unqueryable int) (any, apiError) {
+	name, pair, ok := s.pair(form.Get("pair"))
+	if !ok {
+		return nil, "EQuery:Unknown asset pair"
+	}
+	side := form.Get("type")
+	if side != "buy" && side != "sell" {
+		return nil, "EGeneral:Invalid arguments:type"
+	}
+	if form.Get("ordertype") != "market" {
+		return nil, "EGeneral:Invalid arguments:ordertype"
+	}
+	volume, err := strconv.ParseFloat(form.Get("volume"), 64)
+	if err != nil || volume <= 0 {
+		return nil, "EGeneral:Invalid arguments:volume"
+	}
+	if minimum, _ := strconv.ParseFloat(pair.OrderMin, 64); volume < minimum {
+		return nil, "EGeneral:Invalid arguments:volume minimum not met"
+	}
+	userref, _ := strconv.Atoi(form.Get("userref"))
+
+	price := pair.Ask
+	if side == "sell" {
+		price = pair.Bid
+	}
+	description := map[string]string{"order": fmt.Sprintf("%s %s %s @ market", side, strconv.FormatFloat(volume, 'f', pair.LotDecimals, 64), name)}
+
+	cost := volume * price
+	if side == "buy" && s.balances[pair.QuoteAsset] < cost*(1+FeeRate) {
+		return nil, "EOrder:Insufficient funds"
+	} else if side == "sell" && s.balances[pair.BaseAsset] < volume {
+		return nil, "EOrder:Insufficient funds"
+	}
+
+	if form.Get("validate") == "true" {
+		return map[string]any{"descr": description}, ""
+	}
+
+	o := &order{pair: name, side: side, userref: userref, volume: volume, filled: volume, price: price, status: "closed", opened: s.cfg.Now(), hidden: unqueryable}
+	if scenario == ScenarioPartialFill {
+		o.filled, o.status = volume/2, "open"
+	}
+	s.fill(pair, o)
+
+	s.seq++
+	txid := fmt.Sprintf("OFAKE-%06d", s.seq)
+	s.orders[txid] = o
+	return map[string]any{"descr": description, "txid": []string{txid}}, ""
+}
+
+// fill moves the balances of the filled volume of o.
+func (s *Server) fill(pair Pair, o *order) {
+	cost := o.filled * o.price
+	fee := cost * FeeRate
+	if o.side == "buy" {
+		s.balances[pair.QuoteAsset] -= cost + fee
+		s.balances[pair.BaseAsset] += o.filled
+	} else {
+		s.balances[pair.QuoteAsset] += cost - fee
+		s.balances[pair.BaseAsset] -= o.filled
+	}
+}
+
+// response formats o as the QueryOrders endpoint does.
+func (o *order) response() map[string]any {
+	cost := o.filled * o.price
+	r := map[string]any{
+		"refid":   nil,
+		"userref": o.userref,
+		"status":  o.status,
+		"opentm":  float64(o.opened.UnixMilli()) / 1000,
+		"descr": map[string]string{
+			"pair":      o.pair,
+			"type":      o.side,
+			"ordertype": "market",
+			"price":     "0",
+			"order":     fmt.Sprintf("%s %s %s @ market", o.side, strconv.FormatFloat(o.volume, 'f', 8, 64), o.pair),
+		},
+		"vol":      strconv.FormatFloat(o.volume, 'f', 8, 64),
+		"vol_exec": strconv.FormatFloat(o.filled, 'f', 8, 64),
+		"cost":     strconv.FormatFloat(cost, 'f', 5, 64),
+		"fee":      strconv.FormatFloat(cost*FeeRate, 'f', 5, 64),
+		"price":    formatPrice(o.price),
+	}
+	if o.status == "closed" {
+		r["closetm"] = float64(o.opened.UnixMilli()) / 1000
+	}
+	return r
+}
+
+// pair looks up a pair by the name orders use or its result key.
+func (s *Server) pair(name string) (string, Pair, bool) {
+	if pair, ok := s.cfg.Pairs[name]; ok {
+		return name, pair, true
+	}
+	names := make([]string, 0, len(s.cfg.Pairs))
+	for n := range s.cfg.Pairs {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	for _, n := range names {
+		if s.cfg.Pairs[n].ResultKey == name {
+			return n, s.cfg.Pairs[n], true
+		}
+	}
+	return "", Pair{}, false
+}
+
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(price, 'f', 1, 64)
+}
@@ -0,0 +1,126 @@
+package dca
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Defaults of the shutdown of an interrupted run.
+const (
+	// DefaultShutdownGrace is how long the calls in flight when a run is interrupted are given to finish.
+	DefaultShutdownGrace = 5 * time.Second
+	// DefaultShutdownTimeout bounds the check for placed orders, the recording and the notification of an
+	// interrupted run.
+	DefaultShutdownTimeout = 15 * time.Second
+)
+
+// Interruption is what's known about a run whose context was cancelled before it finished.
+type Interruption struct {
+	At time.Time `json:"at" desc:"When the shutdown of the interrupted run started, in the reporting time zone" schema:"required"`
+	// OrderPlaced is set when the run's order reached the exchange, only meaningful when CheckError is empty.
+	OrderPlaced bool `json:"orderPlaced" desc:"Whether the run's order reached the exchange, unknown when checkError is set" schema:"required"`
+	// Orders are the orders placed by the run found by the check, they're recorded to the order store.
+	Orders []ExecuteOrderResponse `json:"orders,omitempty" desc:"The orders placed by the run found on the exchange"`
+	// CheckError is why the exchange couldn't be checked for orders placed by the run.
+	CheckError string `json:"checkError,omitempty" desc:"Why the exchange couldn't be checked for orders placed by the run"`
+}
+
+// interruptKey is the context key of the context whose cancellation interrupts a run.
+type interruptKey struct{}
+
+// withGrace returns a context which is only cancelled grace after ctx, so calls in flight when ctx is cancelled can
+// finish, while interrupted reports the cancellation straight away. The deadline of ctx is kept as is.
+func withGrace(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	graced, cancel := context.WithCancelCause(context.WithValue(context.WithoutCancel(ctx), interruptKey{}, ctx))
+	var stopDeadline context.CancelFunc = func() {}
+	if deadline, ok := ctx.Deadline(); ok {
+		graced, stopDeadline = context.WithDeadline(graced, deadline)
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-graced.Done():
+			return
+		}
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancel(context.Cause(ctx))
+		case <-graced.Done():
+		}
+	}()
+	return graced, func() { stopDeadline(); cancel(nil) }
+}
+
+// interrupted returns ErrInterrupted once the run of ctx was interrupted, so no new step is started. Contexts not made
+// by withGrace are interrupted once they're done.
+func interrupted(ctx context.Context) error {
+	if parent, ok := ctx.Value(interruptKey{}).(context.Context); ok {
+		ctx = parent
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: %w", ErrInterrupted, context.Cause(ctx))
+	}
+	return nil
+}
+
+// interruptedDone returns a channel that's closed once the run of ctx is interrupted, see interrupted.
+func interruptedDone(ctx context.Context) <-chan struct{} {
+	if parent, ok := ctx.Value(interruptKey{}).(context.Context); ok {
+		return parent.Done()
+	}
+	return ctx.Done()
+}
+
+// recordInterruption checks whether the interrupted run placed an order and records the orders it finds to the
+// order store, marked as interrupted, unless the run recorded them itself. ctx must outlive the interruption.
+func (m *App) recordInterruption(ctx context.Context, startedAt time.Time, summary *RunSummary) {
+	in := &Interruption{At: time.Now().In(m.Config.Location())}
+	summary.Interrupted = in
+
+	paper := m.Config.Provider == ProviderPaper || m.Config.Provider == ProviderPaperRealistic
+	switch {
+	case summary.Order != nil:
+		// the run got as far as recording its order
+		in.OrderPlaced, in.Orders = true, []ExecuteOrderResponse{*summary.Order}
+	case paper:
+		// paper orders never reach the exchange
+	default:
+		// allow for the exchange's clock being slightly behind
+		orders, err := m.newKrakenProvider().FindOrders(ctx, startedAt.Add(-time.Minute))
+		if err != nil {
+			in.CheckError = err.Error()
+			break
+		}
+		for _, o := range orders {
+			in.Orders = append(in.Orders, o.Order)
+		}
+		in.OrderPlaced = len(in.Orders) > 0
+
+		if m.Config.OrderStorePath != "" {
+			for _, o := range orders {
+				// the orders found are the run's own, so they're recorded with its tags
+				o.Order.Tags = summary.Tags
+				rec := OrderRecord{Time: o.Time, RunID: summary.RunID, CorrelationID: summary.CorrelationID, Profile: summary.Profile, Order: o.Order, Interrupted: true}
+				if err = m.fileOrderStore().Put(ctx, rec.In(m.Config.Location())); err != nil {
+					m.Logger.ErrorContext(ctx, "failed to record the order of the interrupted run", "error", err, "transactionId", o.Order.TransactionID)
+				}
+			}
+		}
+	}
+
+	var warning string
+	switch {
+	case in.CheckError != "":
+		warning = "run interrupted, whether an order was placed is unknown: " + in.CheckError
+	case in.OrderPlaced:
+		warning = fmt.Sprintf("run interrupted after placing order %s", in.Orders[0].TransactionID)
+	default:
+		warning = "run interrupted before an order was placed"
+	}
+	m.Logger.WarnContext(ctx, warning, "orderPlaced", in.OrderPlaced, "orders", len(in.Orders))
+	summary.Warnings = append(summary.Warnings, warning)
+}
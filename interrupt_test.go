@@ -0,0 +1,103 @@
+package dca_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+	"github.com/1gm/dca/internal/fakekraken"
+)
+
+func TestApp_Run_Interrupted(t *testing.T) {
+	tt := []struct {
+		// cancelAfter is when the run is interrupted, it's interrupted before it starts when zero
+		cancelAfter time.Duration
+		grace       time.Duration
+		status      dca.RunStatus
+		orderPlaced bool
+		recorded    int
+	}{
+		// the order is placed but the run gives up on its response
+		{150 * time.Millisecond, 20 * time.Millisecond, dca.RunStatusInterrupted, true, 1},
+		// the order's response arrives within the grace period so the run finishes
+		{150 * time.Millisecond, 5 * time.Second, dca.RunStatusSuccess, false, 1},
+		{0, time.Second, dca.RunStatusInterrupted, false, 0},
+	}
+	for i, tc := range tt {
+		s := httptest.NewServer(fakekraken.New(fakekraken.Config{
+			APIKey: "key",
+			Secret: []byte("secret"),
+			Delays: map[string]time.Duration{"/0/private/AddOrder": 400 * time.Millisecond},
+		}))
+		defer s.Close()
+
+		n := &recordingNotifier{}
+		app := dca.NewApp()
+		app.Config = dca.AppConfig{
+			KrakenAPIKey:       "key",
+			KrakenPrivateKey:   "secret",
+			KrakenBaseURL:      s.URL,
+			OrderAmountInCents: 500,
+			OrderStorePath:     filepath.Join(t.TempDir(), "orders.jsonl"),
+		}
+		app.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+		app.Notifiers = []dca.Notifier{n}
+		app.ShutdownGrace = tc.grace
+
+		ctx, cancel := context.WithCancel(context.Background())
+		if tc.cancelAfter == 0 {
+			cancel()
+		} else {
+			time.AfterFunc(tc.cancelAfter, cancel)
+		}
+
+		err := app.Run(ctx)
+		cancel()
+		if want, got := tc.status == dca.RunStatusInterrupted, errors.Is(err, dca.ErrInterrupted); got != want {
+			t.Errorf("%d: want interrupted %v got %v", i, want, err)
+		}
+
+		if want, got := 1, len(n.summaries); got != want {
+			t.Fatalf("%d: want %v got %v", i, want, got)
+		}
+		summary := n.summaries[0]
+		if want, got := tc.status, summary.Status; got != want {
+			t.Errorf("%d: want %v got %v (%s)", i, want, got, summary.Error)
+		}
+		if tc.status == dca.RunStatusInterrupted {
+			if summary.Interrupted == nil {
+				t.Fatalf("%d: want an interruption", i)
+			}
+			if want, got := tc.orderPlaced, summary.Interrupted.OrderPlaced; got != want {
+				t.Errorf("%d: want %v got %v (%s)", i, want, got, summary.Interrupted.CheckError)
+			}
+			if want, got := 1, len(summary.Warnings); got != want {
+				t.Errorf("%d: want %v got %v", i, want, summary.Warnings)
+			}
+		} else if summary.Interrupted != nil {
+			t.Errorf("%d: want no interruption got %+v", i, summary.Interrupted)
+		}
+
+		records, err := dca.NewFileOrderStore(app.Config.OrderStorePath).List(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := tc.recorded, len(records); got != want {
+			t.Fatalf("%d: want %v got %v", i, want, got)
+		}
+		for _, r := range records {
+			if want, got := tc.status == dca.RunStatusInterrupted, r.Interrupted; got != want {
+				t.Errorf("%d: want %v got %v", i, want, got)
+			}
+			if want, got := summary.RunID, r.RunID; got != want {
+				t.Errorf("%d: want %v got %v", i, want, got)
+			}
+		}
+	}
+}
@@ -2,6 +2,7 @@ package dca
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"crypto/hmac"
 	"crypto/sha256"
@@ -10,228 +11,1048 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log/slog"
-	"net"
+	"math"
 	"net/http"
 	"net/url"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+// KrakenDefaultBaseURL is the base URL of the Kraken REST API.
+const KrakenDefaultBaseURL = "https://api.kraken.com"
+
+// DefaultKrakenRequestTimeout bounds every request to the Kraken REST API, including reading the response.
+const DefaultKrakenRequestTimeout = 10 * time.Second
+
 type KrakenProviderConfig struct {
 	APIKey    string
 	APISecret string
 	Logger    *slog.Logger
+	// BaseURL overrides the Kraken REST API base URL, defaults to KrakenDefaultBaseURL.
+	BaseURL string
+	// PostOnlyFallback places a post-only limit order at the bid when the market is in post_only mode
+	// instead of failing with ErrPostOnlyMode.
+	PostOnlyFallback bool
+	// SkipOnPendingDeposit checks for pending fiat deposits when an order fails due to insufficient funds and
+	// skips the order with ErrDepositPending if a pending deposit covers the shortfall.
+	SkipOnPendingDeposit bool
+	// SweepThresholdPercent reduces a buy that fails due to insufficient funds to the available balance when the
+	// balance is within this percentage below the order amount, zero disables it.
+	SweepThresholdPercent float64
+	// UserRef tags every order placed by the provider, defaults to KrakenDefaultUserRef.
+	UserRef int
+	// Pair is the pair orders are placed for when a request doesn't specify one, defaults to KrakenDefaultPair.
+	Pair string
+	// MaxResponseBytes limits the size of response bodies, defaults to DefaultMaxResponseBytes.
+	MaxResponseBytes int64
+	// Tier is the account tier used to estimate the private API counter, defaults to KrakenTierStarter.
+	Tier KrakenTier
+	// RateLimitWait delays private calls that would push the estimated API counter over the tier limit.
+	RateLimitWait bool
+	// VolumeRounding rounds order volumes down to a multiple of this increment of the base asset, e.g. "0.00001".
+	VolumeRounding string
+	// ReadOnly fails calls to private endpoints that can change the account with ErrReadOnlyMode before any request
+	// is made.
+	ReadOnly bool
+	// ReferencePrice is the price of the previous purchase. Orders priced more than MaxPriceDeviationPercent away
+	// from it are skipped with ErrPriceDeviation, zero for either disables the check.
+	ReferencePrice           float64
+	MaxPriceDeviationPercent float64
+	// WebSocket waits for fills on the openOrders channel of the WebSocket API instead of polling QueryOrders,
+	// falling back to polling when the connection fails.
+	WebSocket bool
+	// WebSocketURL overrides the WebSocket API URL, defaults to KrakenDefaultWebSocketURL.
+	WebSocketURL string
+	// FillTimeout bounds how long an order waits for its fill on the WebSocket, defaults to DefaultKrakenFillTimeout.
+	FillTimeout time.Duration
+	// FillTolerance is how far the executed volume of a closed order may fall short of its volume for it to count as
+	// filled instead of partial, defaults to DefaultFillTolerance.
+	FillTolerance *FillTolerance
+	// StrictOrderInfo fails an order whose execution details don't all parse instead of leaving the fields that
+	// failed empty and reporting them as warnings.
+	StrictOrderInfo bool
+	// ExtraHeaders are added to every request, e.g. the auth token of an egress proxy. They can't replace the auth
+	// headers of private requests.
+	ExtraHeaders map[string]string
+	// Audit records every request when set.
+	Audit *AuditLog
+	// HTTPClient sends the requests, e.g. the app's shared client, which then adds the extra headers and audits the
+	// requests instead of ExtraHeaders and Audit. Defaults to a client made by NewHTTPClient from them.
+	HTTPClient *http.Client
+	// RequestTimeout bounds every request, defaults to DefaultKrakenRequestTimeout.
+	RequestTimeout time.Duration
+}
+
+// KrakenDefaultUserRef is the userref used to tag orders placed by this tool.
+const KrakenDefaultUserRef = 0xDCA
+
+// KrakenDefaultPair is the pair orders are placed for by default.
+const KrakenDefaultPair = "XBTUSD"
+
+// krakenPair describes a trading pair supported by the provider.
+type krakenPair struct {
+	// ResultKey is the key Kraken uses for the pair in responses
+	ResultKey string
+	// BaseAsset is the asset bought, as named by the Balance endpoint
+	BaseAsset string
+	// QuoteAsset is the asset used to pay for the base asset
+	QuoteAsset string
+	// OrderMin is the minimum order volume published by the AssetPairs endpoint, use KrakenProvider.orderMin which
+	// prefers fetched metadata
+	OrderMin string
+}
+
+// krakenPairs are the pairs supported by the provider.
+var krakenPairs = map[string]krakenPair{
+	"XBTUSD": {ResultKey: "XXBTZUSD", BaseAsset: "XXBT", QuoteAsset: "ZUSD", OrderMin: "0.00005"},
+	"XBTEUR": {ResultKey: "XXBTZEUR", BaseAsset: "XXBT", QuoteAsset: "ZEUR", OrderMin: "0.00005"},
+	"ETHUSD": {ResultKey: "XETHZUSD", BaseAsset: "XETH", QuoteAsset: "ZUSD", OrderMin: "0.002"},
+	"ETHEUR": {ResultKey: "XETHZEUR", BaseAsset: "XETH", QuoteAsset: "ZEUR", OrderMin: "0.002"},
+	// stablecoin pairs fund purchases of the pairs above, see FundingConversionConfig
+	"USDTUSD": {ResultKey: "USDTZUSD", BaseAsset: "USDT", QuoteAsset: "ZUSD", OrderMin: "5"},
+	"USDTEUR": {ResultKey: "USDTEUR", BaseAsset: "USDT", QuoteAsset: "ZEUR", OrderMin: "5"},
+	"USDCUSD": {ResultKey: "USDCUSD", BaseAsset: "USDC", QuoteAsset: "ZUSD", OrderMin: "5"},
+	"USDCEUR": {ResultKey: "USDCEUR", BaseAsset: "USDC", QuoteAsset: "ZEUR", OrderMin: "5"},
 }
 
 type KrakenProvider struct {
 	Logger *slog.Logger
 
-	APIKey        string
-	APISecretKey  string
-	GenerateNonce func() int64
+	APIKey                   string
+	APISecretKey             string
+	BaseURL                  string
+	PostOnlyFallback         bool
+	SkipOnPendingDeposit     bool
+	SweepThresholdPercent    float64
+	UserRef                  int
+	Pair                     string
+	MaxResponseBytes         int64
+	RateLimitWait            bool
+	VolumeRounding           string
+	ReadOnly                 bool
+	ReferencePrice           float64
+	ReferencePair            string
+	MaxPriceDeviationPercent float64
+	WebSocket                bool
+	WebSocketURL             string
+	FillTimeout              time.Duration
+	FillTolerance            FillTolerance
+	StrictOrderInfo          bool
+	Counter                  *KrakenCallCounter
+	GenerateNonce            func() int64
+	// PairMetadata replaces the built-in trading rules of its pair, see App.loadPairMetadata.
+	PairMetadata *KrakenPairMetadata
+	// AllowValidateOrders lets a ReadOnly provider call AddOrder with validate set, Kraken checks such orders
+	// without placing them. Orders without validate still fail with ErrReadOnlyMode.
+	AllowValidateOrders bool
+	RequestTimeout      time.Duration
+
+	http      *http.Client
+	nonceMu   sync.Mutex
+	lastNonce int64
+
+	warningsMu sync.Mutex
+	warnings   []string
+
+	// privateMu serializes private calls so their nonces reach Kraken in order.
+	privateMu sync.Mutex
+	timings   stepTimings
 
-	http *http.Client
+	priceMu   sync.Mutex
+	lastPrice PriceSample
 }
 
 func NewKrakenProvider(cfg *KrakenProviderConfig) *KrakenProvider {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = KrakenDefaultBaseURL
+	}
+
+	userRef := cfg.UserRef
+	if userRef == 0 {
+		userRef = KrakenDefaultUserRef
+	}
+
+	pair := cfg.Pair
+	if pair == "" {
+		pair = KrakenDefaultPair
+	}
+
+	client := cfg.HTTPClient
+	if client == nil {
+		client = NewHTTPClient(HTTPClientConfig{ExtraHeaders: cfg.ExtraHeaders, Audit: cfg.Audit})
+	}
+
 	return &KrakenProvider{
-		Logger:        cfg.Logger.With("name", "kraken.provider"),
-		APIKey:        cfg.APIKey,
-		APISecretKey:  cfg.APISecret,
-		GenerateNonce: time.Now().UnixNano,
-		http: &http.Client{
-			Timeout: time.Second * 10,
-			Transport: &http.Transport{
-				DialContext: (&net.Dialer{
-					Timeout: time.Second * 5,
-				}).DialContext,
-				TLSHandshakeTimeout: time.Second * 5,
-			},
-		},
+		Logger:                   cfg.Logger.With("name", "kraken.provider"),
+		APIKey:                   cfg.APIKey,
+		APISecretKey:             cfg.APISecret,
+		BaseURL:                  strings.TrimSuffix(baseURL, "/"),
+		PostOnlyFallback:         cfg.PostOnlyFallback,
+		SkipOnPendingDeposit:     cfg.SkipOnPendingDeposit,
+		SweepThresholdPercent:    cfg.SweepThresholdPercent,
+		UserRef:                  userRef,
+		Pair:                     pair,
+		MaxResponseBytes:         cfg.MaxResponseBytes,
+		RateLimitWait:            cfg.RateLimitWait,
+		VolumeRounding:           cfg.VolumeRounding,
+		ReadOnly:                 cfg.ReadOnly,
+		ReferencePrice:           cfg.ReferencePrice,
+		MaxPriceDeviationPercent: cfg.MaxPriceDeviationPercent,
+		WebSocket:                cfg.WebSocket,
+		WebSocketURL:             cmp.Or(cfg.WebSocketURL, KrakenDefaultWebSocketURL),
+		FillTimeout:              cmp.Or(cfg.FillTimeout, DefaultKrakenFillTimeout),
+		FillTolerance:            *cmp.Or(cfg.FillTolerance, &DefaultFillTolerance),
+		StrictOrderInfo:          cfg.StrictOrderInfo,
+		Counter:                  NewKrakenCallCounter(cfg.Tier),
+		GenerateNonce:            time.Now().UnixNano,
+		RequestTimeout:           cmp.Or(cfg.RequestTimeout, DefaultKrakenRequestTimeout),
+		http:                     client,
 	}
 }
 
+// Order sides.
+const (
+	SideBuy  = "buy"
+	SideSell = "sell"
+)
+
 type ExecuteOrderRequest struct {
 	AmountInCents int `json:"amountInCents"`
+	// Pair to trade, providers use their configured pair when empty
+	Pair string `json:"pair,omitempty"`
+	// Side is either SideBuy or SideSell, defaults to SideBuy
+	Side string `json:"side,omitempty"`
+	// ClientOrderID is attached to the order by providers which support client order ids
+	ClientOrderID string `json:"clientOrderId,omitempty"`
+	// UserRef is attached to the order by providers which support a numeric reference, e.g. the Kraken userref
+	UserRef int `json:"userRef,omitempty"`
+	// Label attributes the order to a goal, it's echoed into the response so recorded orders can be filtered by it
+	Label string `json:"label,omitempty"`
+	// Tags are free-form key/value metadata attributing the order to cost centers and the like, they're echoed into
+	// the response so recorded orders can be filtered and exported by them
+	Tags map[string]string `json:"tags,omitempty"`
+	// OrderType is one of the OrderType constants, defaults to OrderTypeMarket
+	OrderType string `json:"orderType,omitempty"`
+	// Price is the limit price of limit orders and the trigger price of stop-loss-limit orders
+	Price float64 `json:"price,omitempty"`
+	// Price2 is the limit price of stop-loss-limit orders
+	Price2 float64 `json:"price2,omitempty"`
+	// Offset is the trailing offset of trailing-stop orders, an amount in the quote currency or a percentage, e.g. "2.5%"
+	Offset string `json:"offset,omitempty"`
 }
 
 type ExecuteOrderResponse struct {
-	AmountInCents   int     `json:"amountInCents"`
-	TransactionID   string  `json:"transactionId"`
-	AdditionalInfo  string  `json:"additionalInfo"`
-	RequestedVolume float64 `json:"volumeRequested"`
-	VolumePurchased float64 `json:"volumePurchased"`
-	Cost            float64 `json:"cost"`
-	Fee             float64 `json:"fee"`
-	Price           float64 `json:"price"`
+	AmountInCents   int               `json:"amountInCents" desc:"The amount ordered in cents" schema:"required"`
+	Pair            string            `json:"pair" desc:"The traded pair" schema:"required"`
+	Side            string            `json:"side" desc:"The side of the order" enum:"buy,sell" schema:"required"`
+	ClientOrderID   string            `json:"clientOrderId,omitempty" desc:"The client order id attached to the order"`
+	UserRef         int               `json:"userRef,omitempty" desc:"The numeric reference attached to the order"`
+	Label           string            `json:"label,omitempty" desc:"The goal the order is attributed to"`
+	Tags            map[string]string `json:"tags,omitempty" desc:"Free-form key/value metadata of the order, e.g. cost centers, from the request or the tags of the run"`
+	SweptFromCents  int               `json:"sweptFromCents,omitempty" desc:"The configured amount in cents when the order was reduced to the available balance"`
+	TransactionID   string            `json:"transactionId" desc:"The exchange's identifier of the order" schema:"required"`
+	AdditionalInfo  string            `json:"additionalInfo" desc:"The exchange's description of the order"`
+	OrderType       string            `json:"orderType" desc:"The type of order placed" enum:"market,limit,stop-loss-limit,trailing-stop" schema:"required"`
+	Status          string            `json:"status" desc:"The exchange's status of the order, open orders haven't filled yet" schema:"required"`
+	RequestedVolume float64           `json:"volumeRequested" desc:"The volume ordered"`
+	VolumePurchased float64           `json:"volumePurchased" desc:"The volume filled"`
+	Cost            float64           `json:"cost" desc:"The cost of the filled volume in the quote currency"`
+	Fee             float64           `json:"fee" desc:"The fee charged in the quote currency"`
+	Price           float64           `json:"price" desc:"The average fill price"`
+	Slippage        *Slippage         `json:"slippage,omitempty" desc:"How far the fill price of a market order was from the quoted price"`
+	Warnings        []string          `json:"warnings,omitempty" desc:"Execution details that failed to parse and were left empty"`
+}
+
+// UnmarshalJSON decodes a response, the labels of responses recorded before they were merged into the tags are added
+// to its tags.
+func (r *ExecuteOrderResponse) UnmarshalJSON(b []byte) error {
+	type response ExecuteOrderResponse
+	var v struct {
+		response
+		Labels map[string]string `json:"labels"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*r = ExecuteOrderResponse(v.response)
+	for key, value := range v.Labels {
+		if _, ok := r.Tags[key]; !ok {
+			if r.Tags == nil {
+				r.Tags = map[string]string{}
+			}
+			r.Tags[key] = value
+		}
+	}
+	return nil
+}
+
+// resolveOrder applies the provider defaults to order and validates it.
+func (p *KrakenProvider) resolveOrder(order ExecuteOrderRequest) (ExecuteOrderRequest, error) {
+	if order.Pair == "" {
+		order.Pair = p.Pair
+	}
+	if order.Side == "" {
+		order.Side = SideBuy
+	}
+	if order.UserRef == 0 {
+		order.UserRef = p.UserRef
+	}
+	if order.OrderType == "" {
+		order.OrderType = OrderTypeMarket
+	}
+
+	if _, ok := krakenPairs[order.Pair]; !ok {
+		return order, fmt.Errorf("%w: %s", ErrUnsupportedPair, order.Pair)
+	} else if order.Side != SideBuy && order.Side != SideSell {
+		return order, fmt.Errorf("unsupported order side %q", order.Side)
+	}
+	return order, validateOrderParams(order)
+}
+
+// newResponse creates a response echoing the details of order.
+func newResponse(order ExecuteOrderRequest, orderType string) ExecuteOrderResponse {
+	return ExecuteOrderResponse{
+		AmountInCents: order.AmountInCents,
+		Pair:          order.Pair,
+		Side:          order.Side,
+		ClientOrderID: order.ClientOrderID,
+		UserRef:       order.UserRef,
+		Label:         order.Label,
+		Tags:          order.Tags,
+		OrderType:     orderType,
+	}
 }
 
 func (p *KrakenProvider) ExecuteOrder(ctx context.Context, order ExecuteOrderRequest) (res ExecuteOrderResponse, err error) {
 	defer WrapErr(&err, "KrakenProvider.ExecuteOrder")
 
-	var volume float64
-	if volume, err = p.fetchBuyVolume(ctx, order.AmountInCents); err != nil {
+	if order, err = p.resolveOrder(order); err != nil {
 		return res, err
 	}
 
-	p.Logger.InfoContext(ctx, fmt.Sprintf("fetched buy volume: %0.8f", volume))
+	p.Logger.InfoContext(ctx, "executing order", "pair", order.Pair, "side", order.Side, "amountInCents", order.AmountInCents, "clientOrderId", order.ClientOrderID, "tags", order.Tags)
 
-	res.AmountInCents = order.AmountInCents
+	// The lookups before the order are independent so they run concurrently, private calls are still serialized by
+	// privateRequest. A trading mode which rules out the order cancels the others.
+	var (
+		status string
+		stream *krakenOrderStream
+	)
+	preOrder := time.Now()
+	g := newStepGroup(ctx, &p.timings)
+	defer g.Close()
+	g.Go(StepSystemStatus, func(ctx context.Context) (err error) {
+		// A failure to read the system status shouldn't prevent an order, AddOrder reports the same trading modes.
+		if status, err = p.systemStatus(ctx); err != nil {
+			p.Logger.WarnContext(ctx, "failed to fetch system status", "err", err)
+		}
+		return p.checkTradingMode(ctx, status, order)
+	})
+	g.Go(StepOrderStream, func(ctx context.Context) error {
+		stream = p.openOrderStream(ctx)
+		return nil
+	})
+	err = g.Wait()
+	p.timings.record(StepPreOrder, preOrder)
+	defer stream.Close()
+	if err != nil {
+		return res, err
+	}
+
+	if status == krakenStatusPostOnly {
+		return p.executePostOnlyOrder(ctx, order, stream)
+	} else if isConditionalOrderType(order.OrderType) {
+		return p.executeConditionalOrder(ctx, order, stream)
+	}
+
+	// the ticker is fetched last so the order is sized at the freshest price
+	var volume, quoted float64
+	quote := time.Now()
+	volume, quoted, err = p.marketVolume(ctx, order)
+	p.timings.record(StepQuote, quote)
+	if err != nil {
+		return res, err
+	}
+
+	p.Logger.InfoContext(ctx, "fetched buy volume: "+FormatCrypto(volume, ""))
+
+	res = newResponse(order, "market")
 	res.RequestedVolume = volume
-	if res.TransactionID, res.AdditionalInfo, err = p.placeOrder(ctx, volume); err != nil {
+	addOrder := time.Now()
+	res.TransactionID, res.AdditionalInfo, err = p.placeOrder(ctx, order, volume)
+	p.timings.record(StepAddOrder, addOrder)
+	if err != nil {
+		// The market may have switched to post_only between the status check and the order placement.
+		if errors.Is(err, ErrPostOnlyMode) && p.PostOnlyFallback {
+			return p.executePostOnlyOrder(ctx, order, stream)
+		}
+		if errors.Is(err, ErrInsufficientFunds) && p.SweepThresholdPercent > 0 && order.Side == SideBuy {
+			if swept, ok, sweepErr := p.sweepBalance(ctx, order, stream); ok {
+				return swept, sweepErr
+			}
+		}
+		if errors.Is(err, ErrInsufficientFunds) && p.SkipOnPendingDeposit && order.Side == SideBuy {
+			return res, p.checkPendingDeposit(ctx, order, err)
+		}
+		return res, err
+	}
+
+	fill := time.Now()
+	res, err = p.awaitFill(ctx, stream, res)
+	p.timings.record(StepFill, fill)
+	if err != nil {
 		return res, err
 	}
+	p.recordSlippage(ctx, &res, quoted)
+
+	return res, nil
+}
+
+// executePostOnlyOrder places a post-only limit order at the top of the book without crossing the spread, used
+// when the market is in post_only mode.
+func (p *KrakenProvider) executePostOnlyOrder(ctx context.Context, order ExecuteOrderRequest, stream *krakenOrderStream) (res ExecuteOrderResponse, err error) {
+	defer WrapErr(&err, "executePostOnlyOrder")
+
+	p.Logger.WarnContext(ctx, "market is in post_only mode, falling back to a post-only limit order")
+
+	var t ticker
+	if t, err = p.fetchTicker(ctx, order.Pair); err != nil {
+		return res, err
+	}
+
+	price := t.Bid
+	if order.Side == SideSell {
+		price = t.Ask
+	}
+	if err = p.checkPriceDeviation(ctx, order.Pair, price); err != nil {
+		return res, err
+	}
+
+	res = newResponse(order, "limit")
+	if res.RequestedVolume, err = p.roundVolume(ctx, order.Pair, volumeForAmount(order.AmountInCents, price)); err != nil {
+		return res, err
+	}
+
+	p.Logger.InfoContext(ctx, "placing post-only limit order", "volume", res.RequestedVolume, "price", price)
+
+	if res.TransactionID, res.AdditionalInfo, err = p.addOrder(ctx, order, url.Values{
+		"ordertype": {"limit"},
+		"price":     {strconv.FormatFloat(price, 'f', -1, 64)},
+		"volume":    {strconv.FormatFloat(res.RequestedVolume, 'f', -1, 64)},
+		"oflags":    {"post"},
+	}); err != nil {
+		return res, err
+	}
+
+	return p.awaitFill(ctx, stream, res)
+}
+
+// executeConditionalOrder places an order which may stay open indefinitely, it returns as soon as the order is
+// placed with Status OrderStatusOpen instead of waiting for the order to fill. With an order stream the order is
+// given until FillTimeout to fill.
+func (p *KrakenProvider) executeConditionalOrder(ctx context.Context, order ExecuteOrderRequest, stream *krakenOrderStream) (res ExecuteOrderResponse, err error) {
+	defer WrapErr(&err, "executeConditionalOrder")
+
+	params := url.Values{"ordertype": {order.OrderType}}
+
+	// price is the expected fill price used to size the order
+	var price float64
+	switch order.OrderType {
+	case OrderTypeLimit:
+		price = order.Price
+		params.Set("price", strconv.FormatFloat(order.Price, 'f', -1, 64))
+	case OrderTypeStopLossLimit:
+		price = order.Price2
+		params.Set("price", strconv.FormatFloat(order.Price, 'f', -1, 64))
+		params.Set("price2", strconv.FormatFloat(order.Price2, 'f', -1, 64))
+	case OrderTypeTrailingStop:
+		// Kraken requires trailing offsets to be relative, the direction follows the side of the order.
+		params.Set("price", "+"+order.Offset)
+
+		var t ticker
+		if t, err = p.fetchTicker(ctx, order.Pair); err != nil {
+			return res, err
+		}
+		price = t.Ask
+		if order.Side == SideSell {
+			price = t.Bid
+		}
+	default:
+		return res, fmt.Errorf("unsupported order type %q", order.OrderType)
+	}
+
+	res = newResponse(order, order.OrderType)
+	if res.RequestedVolume, err = p.roundVolume(ctx, order.Pair, volumeForAmount(order.AmountInCents, price)); err != nil {
+		return res, err
+	}
+	params.Set("volume", strconv.FormatFloat(res.RequestedVolume, 'f', -1, 64))
+
+	p.Logger.InfoContext(ctx, "placing "+order.OrderType+" order", "volume", res.RequestedVolume, "price", params.Get("price"), "price2", params.Get("price2"))
+
+	if res.TransactionID, res.AdditionalInfo, err = p.addOrder(ctx, order, params); err != nil {
+		return res, err
+	}
+
+	res.Status = OrderStatusOpen
+	if stream == nil {
+		return res, nil
+	}
 
 	var oi orderInfo
-	if oi, err = p.queryOrderInfo(ctx, res.TransactionID); err != nil {
+	if oi, err = stream.waitForFill(ctx, res.TransactionID, p.fillTimeout(ctx)); err == nil {
+		return p.withFill(ctx, res, oi), nil
+	} else if ctx.Err() != nil {
+		return res, err
+	}
+	p.Logger.InfoContext(ctx, "order is still open", "transactionId", res.TransactionID, "reason", err)
+	return res, nil
+}
+
+// populateOrderInfo fills in the execution details of the order identified by res.TransactionID.
+func (p *KrakenProvider) populateOrderInfo(ctx context.Context, res ExecuteOrderResponse) (ExecuteOrderResponse, error) {
+	oi, err := p.queryOrderInfo(ctx, res.TransactionID)
+	if err != nil {
 		return res, err
 	}
+	return p.withFill(ctx, res, oi), nil
+}
+
+// withOrderInfo returns res with the execution details of oi.
+func (res ExecuteOrderResponse) withOrderInfo(oi orderInfo) ExecuteOrderResponse {
+	res.Status = oi.Status
 	res.Price = oi.Price
 	res.Cost = oi.Cost
 	res.Fee = oi.Fee
 	res.VolumePurchased = oi.VolumePurchased
+	res.Warnings = oi.Warnings
+	return res
+}
 
-	return res, nil
+// QueryOrder returns the status and fills of the order with the given transaction id.
+func (p *KrakenProvider) QueryOrder(ctx context.Context, transactionID string) (res ExecuteOrderResponse, err error) {
+	defer WrapErr(&err, "KrakenProvider.QueryOrder")
+
+	return p.populateOrderInfo(ctx, ExecuteOrderResponse{TransactionID: transactionID})
 }
 
-const btcUSDPair = "XBTUSD"
+// Trading modes reported by the SystemStatus endpoint which restrict order placement.
+const (
+	krakenStatusCancelOnly = "cancel_only"
+	krakenStatusPostOnly   = "post_only"
+)
 
-// FetchBuyVolume finds the amount of BTC to buy in USD
-func (p *KrakenProvider) fetchBuyVolume(ctx context.Context, amountInCents int) (volume float64, err error) {
-	defer WrapErr(&err, "fetchBuyVolume")
+// systemStatus returns the current trading mode of the exchange.
+func (p *KrakenProvider) systemStatus(ctx context.Context) (status string, err error) {
+	defer WrapErr(&err, "systemStatus")
 
-	p.Logger.InfoContext(ctx, "fetching buy volume")
+	var result struct {
+		Status    string `json:"status"`
+		Timestamp string `json:"timestamp"`
+	}
+	if err = p.publicRequest(ctx, "/0/public/SystemStatus", nil, &result); err != nil {
+		return "", err
+	}
+
+	p.Logger.InfoContext(ctx, "fetched system status", "status", result.Status)
+	return result.Status, nil
+}
+
+// ServerTime returns Kraken's time from the public Time endpoint, it has a resolution of a second.
+func (p *KrakenProvider) ServerTime(ctx context.Context) (t time.Time, err error) {
+	defer WrapErr(&err, "KrakenProvider.ServerTime")
+
+	var result struct {
+		UnixTime int64 `json:"unixtime"`
+	}
+	if err = p.publicRequest(ctx, "/0/public/Time", nil, &result); err != nil {
+		return t, err
+	} else if result.UnixTime <= 0 {
+		return t, errors.New("the response has no time")
+	}
+	return time.Unix(result.UnixTime, 0), nil
+}
+
+// ticker is the subset of the Kraken ticker used to price orders.
+type ticker struct {
+	// Ask is the lowest price that a seller will accept
+	Ask float64
+	// Bid is the highest price that a buyer will pay
+	Bid float64
+	// Last is the price of the last trade, zero when the ticker didn't include it
+	Last float64
+}
+
+// krakenNumber is a numeric field Kraken returns as a string, which some proxies and API versions return as a JSON
+// number instead. Either is kept as the text of the number, and null as empty.
+type krakenNumber string
+
+func (n *krakenNumber) UnmarshalJSON(b []byte) error {
+	switch {
+	case string(b) == "null":
+		*n = ""
+	case len(b) > 0 && b[0] == '"':
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		*n = krakenNumber(s)
+	default:
+		var num json.Number
+		if err := json.Unmarshal(b, &num); err != nil {
+			return err
+		}
+		*n = krakenNumber(num)
+	}
+	return nil
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.kraken.com/0/public/Ticker?pair="+btcUSDPair, nil)
+// Float parses the number, an empty number fails to parse like an empty string.
+func (n krakenNumber) Float() (float64, error) {
+	return strconv.ParseFloat(string(n), 64)
+}
+
+// tickerEntry is the ticker of a pair as returned by the Ticker endpoint.
+type tickerEntry struct {
+	A []krakenNumber `json:"a"`
+	B []krakenNumber `json:"b"`
+	C []krakenNumber `json:"c"`
+	V []krakenNumber `json:"v"`
+	P []krakenNumber `json:"p"`
+	T []int          `json:"t"`
+	L []krakenNumber `json:"l"`
+	H []krakenNumber `json:"h"`
+	O krakenNumber   `json:"o"`
+}
+
+// fetchTicker fetches the current ask and bid for pair.
+func (p *KrakenProvider) fetchTicker(ctx context.Context, pair string) (t ticker, err error) {
+	defer WrapErr(&err, "fetchTicker")
+
+	var result map[string]tickerEntry
+	if err = p.publicRequest(ctx, "/0/public/Ticker", url.Values{"pair": {pair}}, &result); err != nil {
+		return t, err
+	}
+
+	entry, err := pairResult(result, pair)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create request to fetch buy volume: %w", err)
+		return t, fmt.Errorf("invalid ticker response: %w", err)
+	}
+	if len(entry.A) == 0 || len(entry.B) == 0 {
+		return t, errors.New("ticker response is missing ask or bid")
+	}
+	if t.Ask, err = entry.A[0].Float(); err != nil {
+		return t, fmt.Errorf("failed to parse ask: %w", err)
+	}
+	if t.Bid, err = entry.B[0].Float(); err != nil {
+		return t, fmt.Errorf("failed to parse bid: %w", err)
+	}
+	if len(entry.C) > 0 && entry.C[0] != "" {
+		if t.Last, err = entry.C[0].Float(); err != nil {
+			return t, fmt.Errorf("failed to parse last trade price: %w", err)
+		}
 	}
-	req.Header.Add("Accept", "application/json")
 
-	res, err := p.http.Do(req)
+	p.priceMu.Lock()
+	p.lastPrice = newPriceSample(time.Now(), pair, t)
+	p.priceMu.Unlock()
+	return t, nil
+}
+
+// FetchPrice fetches the current ticker of pair as a price sample.
+func (p *KrakenProvider) FetchPrice(ctx context.Context, pair string) (PriceSample, error) {
+	t, err := p.fetchTicker(ctx, pair)
 	if err != nil {
-		return 0, fmt.Errorf("failed to fetch buy volume: %w", err)
+		return PriceSample{}, err
 	}
-	defer func() {
-		if cerr := res.Body.Close(); cerr != nil {
-			p.Logger.WarnContext(ctx, "failed to close response body", "err", cerr)
+	return newPriceSample(time.Now(), pair, t), nil
+}
+
+// LastPrice returns the last ticker the provider fetched, ok is false when it hasn't fetched one.
+func (p *KrakenProvider) LastPrice() (sample PriceSample, ok bool) {
+	p.priceMu.Lock()
+	defer p.priceMu.Unlock()
+	return p.lastPrice, !p.lastPrice.Time.IsZero()
+}
+
+// pairResult selects the entry for pair from a public endpoint result keyed by pair. Kraken keys the result by
+// either the requested or the canonical pair name depending on how the pair was requested, so a single entry is used
+// whatever its key and several entries must include one under a known key.
+func pairResult[T any](result map[string]T, pair string) (entry T, err error) {
+	if len(result) == 1 {
+		for _, entry = range result {
+			return entry, nil
 		}
-	}()
+	}
+
+	for _, key := range []string{pair, krakenPairs[pair].ResultKey} {
+		if entry, ok := result[key]; ok && key != "" {
+			return entry, nil
+		}
+	}
 
-	body, err := io.ReadAll(res.Body)
+	if len(result) == 0 {
+		return entry, fmt.Errorf("no result for %s", pair)
+	}
+	keys := make([]string, 0, len(result))
+	for key := range result {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return entry, fmt.Errorf("%d results for %s under unexpected keys %s", len(result), pair, strings.Join(keys, ", "))
+}
+
+// checkTradingMode fails an order the exchange won't accept in the trading mode status.
+func (p *KrakenProvider) checkTradingMode(ctx context.Context, status string, order ExecuteOrderRequest) (err error) {
+	d := Decision{Name: DecisionTradingMode, Inputs: map[string]string{"status": cmp.Or(status, "unknown")}, Outcome: DecisionProceed}
+	switch status {
+	case krakenStatusCancelOnly:
+		err = ErrCancelOnlyMode
+	case krakenStatusPostOnly:
+		if !p.PostOnlyFallback || isConditionalOrderType(order.OrderType) {
+			err = ErrPostOnlyMode
+		} else {
+			d.Outcome, d.Narration = DecisionAdjust, "market in post_only mode → post-only limit order at the bid"
+		}
+	case "":
+		d.Narration = "system status unknown → proceed"
+	}
 	if err != nil {
-		return 0, fmt.Errorf("failed to read response body: %w", err)
+		d.Outcome, d.Narration = DecisionFail, fmt.Sprintf("market in %s mode → fail", status)
+	} else if d.Narration == "" {
+		d.Narration = fmt.Sprintf("market %s → proceed", status)
 	}
+	recordDecision(ctx, d)
+	return err
+}
 
-	var response = struct {
-		Error  []any `json:"error"`
-		Result struct {
-			Xxbtzusd struct {
-				// ASK is the lowest price that a seller will accept
-				A []string `json:"a"`
-				B []string `json:"b"`
-				C []string `json:"c"`
-				V []string `json:"v"`
-				P []string `json:"p"`
-				T []int    `json:"t"`
-				L []string `json:"l"`
-				H []string `json:"h"`
-				O string   `json:"o"`
-			} `json:"XXBTZUSD"`
-		} `json:"result"`
-	}{}
+// marketVolume sizes a market order at the current price and applies the guards on it.
+func (p *KrakenProvider) marketVolume(ctx context.Context, order ExecuteOrderRequest) (volume float64, quoted float64, err error) {
+	if volume, quoted, err = p.fetchBuyVolume(ctx, order); err != nil {
+		return 0, 0, err
+	}
+	return p.guardVolume(ctx, order.Pair, volume, quoted)
+}
 
-	if err = json.Unmarshal(body, &response); err != nil {
-		return 0, fmt.Errorf("failed to unmarshal response body: %w", err)
-	} else if response.Error != nil && len(response.Error) > 0 {
-		return 0, fmt.Errorf("failed to fetch buy volume: %w", errors.New(response.Error[0].(string)))
+// guardVolume applies the guards on a market order for volume quoted at quoted, the price deviation check and the
+// volume rounding, and returns the rounded volume. The unrounded volume is returned with the error of a guard.
+func (p *KrakenProvider) guardVolume(ctx context.Context, pair string, volume, quoted float64) (float64, float64, error) {
+	if err := p.checkPriceDeviation(ctx, pair, quoted); err != nil {
+		return volume, quoted, err
 	}
+	rounded, err := p.roundVolume(ctx, pair, volume)
+	if err != nil {
+		return volume, quoted, err
+	}
+	return rounded, quoted, nil
+}
 
+// FetchBuyVolume finds the amount of the base asset the order amount buys, or sells, at the current price and the
+// price it was quoted at
+func (p *KrakenProvider) fetchBuyVolume(ctx context.Context, order ExecuteOrderRequest) (volume float64, quoted float64, err error) {
+	defer WrapErr(&err, "fetchBuyVolume")
+
+	p.Logger.InfoContext(ctx, "fetching buy volume")
+
+	var t ticker
+	if t, err = p.fetchTicker(ctx, order.Pair); err != nil {
+		return 0, 0, err
+	}
+
+	volume, quoted = buyVolume(order, t)
+	return volume, quoted, nil
+}
+
+// buyVolume returns the amount of the base asset the order amount buys, or sells, at t and the price it's quoted at.
+func buyVolume(order ExecuteOrderRequest, t ticker) (volume float64, quoted float64) {
 	// base/quote - quote is the amount of USD needed to buy the base
-	var quote float64
-	if quote, err = strconv.ParseFloat(response.Result.Xxbtzusd.A[0], 64); err != nil {
-		return 0, fmt.Errorf("failed to parse quote: %w", err)
+	if order.Side == SideSell {
+		return volumeForAmount(order.AmountInCents, t.Bid), t.Bid
+	}
+	return volumeForAmount(order.AmountInCents, t.Ask), t.Ask
+}
+
+// checkPriceDeviation returns ErrPriceDeviation when price differs from ReferencePrice by more than
+// MaxPriceDeviationPercent, a wrong pair or bad market data is more likely than a genuine move that large.
+func (p *KrakenProvider) checkPriceDeviation(ctx context.Context, pair string, price float64) error {
+	// the reference price is of ReferencePair, orders of other pairs such as a funding conversion aren't checked
+	if p.MaxPriceDeviationPercent <= 0 || (p.ReferencePair != "" && pair != p.ReferencePair) {
+		return nil
+	}
+	d := Decision{Name: DecisionPriceDeviation, Inputs: map[string]string{"price": FormatFiat(price, ""), "maxDeviation": fmt.Sprintf("%g%%", p.MaxPriceDeviationPercent)}, Outcome: DecisionProceed}
+	if p.ReferencePrice <= 0 {
+		d.Narration = "no previous purchase to compare the price to → proceed"
+		recordDecision(ctx, d)
+		return nil
+	}
+
+	deviation := math.Abs(price-p.ReferencePrice) / p.ReferencePrice * 100
+	skip := deviation > p.MaxPriceDeviationPercent
+	p.Logger.InfoContext(ctx, "checked price against the previous purchase", "price", price, "referencePrice", p.ReferencePrice,
+		"deviationPercent", deviation, "maxDeviationPercent", p.MaxPriceDeviationPercent, "skip", skip)
+
+	d.Inputs["referencePrice"], d.Inputs["deviation"] = FormatFiat(p.ReferencePrice, ""), fmt.Sprintf("%.2f%%", deviation)
+	d.Narration = fmt.Sprintf("price %s is %s from the previous purchase at %s, within %s → proceed", d.Inputs["price"], d.Inputs["deviation"], d.Inputs["referencePrice"], d.Inputs["maxDeviation"])
+	if skip {
+		d.Outcome, d.Narration = DecisionSkip, fmt.Sprintf("price %s is %s from the previous purchase at %s, over %s → skip", d.Inputs["price"], d.Inputs["deviation"], d.Inputs["referencePrice"], d.Inputs["maxDeviation"])
+	}
+	recordDecision(ctx, d)
+
+	if skip {
+		return fmt.Errorf("%w: price %v is %.2f%% away from the previous purchase price %v", ErrPriceDeviation, price, deviation, p.ReferencePrice)
+	}
+	return nil
+}
+
+// CheckPair verifies pair is supported by the provider and listed as tradeable by Kraken, only public endpoints are used.
+func (p *KrakenProvider) CheckPair(ctx context.Context, pair string) (err error) {
+	defer WrapErr(&err, "KrakenProvider.CheckPair")
+
+	info, ok := krakenPairs[pair]
+	if !ok {
+		return ErrUnsupportedPair
 	}
 
+	var result map[string]struct {
+		Status string `json:"status"`
+	}
+	if err = p.publicRequest(ctx, "/0/public/AssetPairs", url.Values{"pair": {pair}}, &result); err != nil {
+		return err
+	}
+
+	if listed, ok := result[info.ResultKey]; !ok {
+		return ErrUnsupportedPair
+	} else if listed.Status != "" && listed.Status != "online" {
+		return fmt.Errorf("pair %s is %s", pair, listed.Status)
+	}
+	return nil
+}
+
+// volumeForAmount converts an amount in cents to a volume of the base asset at the given quote.
+func volumeForAmount(amountInCents int, quote float64) float64 {
 	base := 1.0
 	// convert exchange rate to cents
 	dollarExchangeRate := base / quote
 	centsExchangeRate := dollarExchangeRate / 100
-	return centsExchangeRate * float64(amountInCents), nil
+	return centsExchangeRate * float64(amountInCents)
 }
 
-// placeOrder places a market order for volume BTC
-func (p *KrakenProvider) placeOrder(ctx context.Context, volume float64) (transactionID string, orderDescription string, err error) {
+// placeOrder places a market order for volume of the base asset
+func (p *KrakenProvider) placeOrder(ctx context.Context, order ExecuteOrderRequest, volume float64) (transactionID string, orderDescription string, err error) {
 	defer WrapErr(&err, "placeOrder")
 
-	p.Logger.InfoContext(ctx, "placing buy order", "volume", volume)
+	p.Logger.InfoContext(ctx, "placing "+order.Side+" order", "volume", volume)
 
-	nonce := p.GenerateNonce()
-	params := url.Values{}
-	params.Set("pair", btcUSDPair)
-	params.Set("type", "buy")
-	params.Set("volume", strconv.FormatFloat(volume, 'f', -1, 64))
-	params.Set("ordertype", "market")
-	params.Set("nonce", strconv.FormatInt(nonce, 10))
+	return p.addOrder(ctx, order, url.Values{
+		"volume":    {strconv.FormatFloat(volume, 'f', -1, 64)},
+		"ordertype": {"market"},
+	})
+}
 
-	p.Logger.InfoContext(ctx, "creating HTTP request", "body", params)
+// addOrder submits an order with the given parameters to the AddOrder endpoint, the pair, side and references
+// are taken from order.
+func (p *KrakenProvider) addOrder(ctx context.Context, order ExecuteOrderRequest, params url.Values) (transactionID string, orderDescription string, err error) {
+	params.Set("pair", order.Pair)
+	params.Set("type", order.Side)
+	params.Set("userref", strconv.Itoa(order.UserRef))
+	if order.ClientOrderID != "" {
+		params.Set("cl_ord_id", order.ClientOrderID)
+	}
 
-	var req *http.Request
-	if req, err = http.NewRequest("POST", "https://api.kraken.com/0/private/AddOrder", bytes.NewBufferString(params.Encode())); err != nil {
-		return "", "", fmt.Errorf("failed to make request: %w", err)
+	var result struct {
+		TransactionID []string `json:"txid"`
+		Description   struct {
+			Order string `json:"order"`
+		} `json:"descr"`
+	}
+	if err = p.privateRequest(ctx, "/0/private/AddOrder", params, &result); err != nil {
+		return "", "", fmt.Errorf("failed to place order: %w", err)
 	}
 
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("API-Key", p.APIKey)
-	req.Header.Add("API-Sign", p.generateSignature("/0/private/AddOrder", params, nonce))
+	p.Logger.InfoContext(ctx, "response from order placement", "response", result)
 
-	res, err := p.http.Do(req)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to do request: %w", err)
+	if len(result.TransactionID) == 0 {
+		return "", "", errors.New("response from order placement is missing a transaction id")
 	}
+	return result.TransactionID[0], result.Description.Order, nil
+}
 
-	defer func() {
-		if cerr := res.Body.Close(); cerr != nil {
-			p.Logger.WarnContext(ctx, "failed to close response body", "err", cerr)
-		}
-	}()
+// pendingDepositStatuses are DepositStatus statuses of deposits which haven't been credited yet. Settled and Success
+// deposits are already in the balance.
+var pendingDepositStatuses = map[string]bool{
+	"Initial": true,
+	"Pending": true,
+}
 
-	var body []byte
+// checkPendingDeposit returns ErrDepositPending when pending fiat deposits cover the difference between the
+// order amount and the available balance, otherwise it returns orderErr.
+func (p *KrakenProvider) checkPendingDeposit(ctx context.Context, order ExecuteOrderRequest, orderErr error) (err error) {
+	defer WrapErr(&err, "checkPendingDeposit")
+
+	p.Logger.InfoContext(ctx, "checking for pending deposits after insufficient funds")
+
+	quoteAsset := krakenPairs[order.Pair].QuoteAsset
 
-	if body, err = io.ReadAll(res.Body); err != nil {
-		return "", "", fmt.Errorf("failed to read response body: %w", err)
+	var balance float64
+	if balance, err = p.fetchBalance(ctx, quoteAsset); err != nil {
+		p.Logger.WarnContext(ctx, "failed to fetch balance", "err", err)
+		return orderErr
 	}
 
-	var response = struct {
-		Error  []string `json:"error"`
-		Result struct {
-			TransactionID []string `json:"txid"`
-			Description   struct {
-				Order string `json:"order"`
-			} `json:"descr"`
-		} `json:"result,omitempty"`
-	}{}
+	var pending float64
+	if pending, err = p.fetchPendingDeposits(ctx, quoteAsset); err != nil {
+		p.Logger.WarnContext(ctx, "failed to fetch pending deposits", "err", err)
+		return orderErr
+	}
 
-	if err = json.Unmarshal(body, &response); err != nil {
-		return "", "", fmt.Errorf("failed to unmarshal response body: %w", err)
+	shortfall := float64(order.AmountInCents)/100 - balance
+	p.Logger.InfoContext(ctx, "compared pending deposits to shortfall", "balance", balance, "shortfall", shortfall, "pending", pending)
+
+	d := Decision{Name: DecisionBalance, Inputs: map[string]string{
+		"balance": FormatFiat(balance, ""),
+		"amount":  FormatCents(order.AmountInCents, ""),
+		"pending": FormatFiat(pending, ""),
+	}}
+	if pending <= 0 || pending < shortfall {
+		d.Outcome, d.Narration = DecisionFail, fmt.Sprintf("balance %s short of %s, pending deposits of %s don't cover it → fail", d.Inputs["balance"], d.Inputs["amount"], d.Inputs["pending"])
+		recordDecision(ctx, d)
+		return orderErr
 	}
+	d.Outcome, d.Narration = DecisionSkip, fmt.Sprintf("balance %s short of %s, pending deposits of %s cover it → skip", d.Inputs["balance"], d.Inputs["amount"], d.Inputs["pending"])
+	recordDecision(ctx, d)
+	return ErrDepositPending
+}
 
-	if response.Error != nil && len(response.Error) > 0 {
-		return "", "", fmt.Errorf("failed to place order: %v", p.toError(response.Error[0]))
+// fetchBalance returns the available balance of asset.
+func (p *KrakenProvider) fetchBalance(ctx context.Context, asset string) (balance float64, err error) {
+	defer WrapErr(&err, "fetchBalance")
+
+	var result map[string]string
+	if err = p.privateRequest(ctx, "/0/private/Balance", url.Values{}, &result); err != nil {
+		return 0, fmt.Errorf("failed to fetch balance: %w", err)
 	}
 
-	p.Logger.InfoContext(ctx, "response from buy order placement", "response", response)
-	return response.Result.TransactionID[0], response.Result.Description.Order, nil
+	if v, ok := result[asset]; !ok {
+		return 0, nil
+	} else if balance, err = strconv.ParseFloat(v, 64); err != nil {
+		return 0, fmt.Errorf("failed to parse balance: %w", err)
+	}
+	return balance, nil
+}
+
+// fetchPendingDeposits returns the total amount of deposits of asset that haven't been credited yet.
+func (p *KrakenProvider) fetchPendingDeposits(ctx context.Context, asset string) (total float64, err error) {
+	defer WrapErr(&err, "fetchPendingDeposits")
+
+	var result []struct {
+		Method string `json:"method"`
+		Asset  string `json:"asset"`
+		RefID  string `json:"refid"`
+		Amount string `json:"amount"`
+		Fee    string `json:"fee"`
+		Time   int64  `json:"time"`
+		Status string `json:"status"`
+	}
+	if err = p.privateRequest(ctx, "/0/private/DepositStatus", url.Values{"asset": {asset}}, &result); err != nil {
+		return 0, fmt.Errorf("failed to fetch deposit status: %w", err)
+	}
+
+	for _, deposit := range result {
+		if !pendingDepositStatuses[deposit.Status] {
+			continue
+		}
+
+		var amount, fee float64
+		if amount, err = strconv.ParseFloat(deposit.Amount, 64); err != nil {
+			return 0, fmt.Errorf("failed to parse amount of deposit %s: %w", deposit.RefID, err)
+		}
+		if deposit.Fee != "" {
+			if fee, err = strconv.ParseFloat(deposit.Fee, 64); err != nil {
+				return 0, fmt.Errorf("failed to parse fee of deposit %s: %w", deposit.RefID, err)
+			}
+		}
+
+		p.Logger.InfoContext(ctx, "found pending deposit", "refid", deposit.RefID, "method", deposit.Method, "amount", amount, "status", deposit.Status)
+		total += amount - fee
+	}
+
+	return total, nil
 }
 
 type orderInfo struct {
+	Status          string  `json:"status"`
 	VolumePurchased float64 `json:"volumePurchased"`
-	Cost            float64 `json:"cost"`
-	Fee             float64 `json:"fee"`
-	Price           float64 `json:"price"`
+	// Volume is the volume of the order, zero when it's unknown. VolumeExecuted is how much of it was executed.
+	Volume         float64 `json:"volume,omitempty"`
+	VolumeExecuted float64 `json:"volumeExecuted"`
+	Cost           float64 `json:"cost"`
+	Fee            float64 `json:"fee"`
+	Price          float64 `json:"price"`
+	// Warnings are the fields which failed to parse when StrictOrderInfo isn't set.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// krakenOrder is an order as returned by the QueryOrders, OpenOrders and ClosedOrders endpoints.
+type krakenOrder struct {
+	Refid    string  `json:"refid"`
+	Userref  int     `json:"userref"`
+	Status   string  `json:"status"`
+	Reason   any     `json:"reason"`
+	Opentm   float64 `json:"opentm"`
+	Closetm  float64 `json:"closetm"`
+	Starttm  int     `json:"starttm"`
+	Expiretm int     `json:"expiretm"`
+	Descr    struct {
+		Pair      string `json:"pair"`
+		Type      string `json:"type"`
+		Ordertype string `json:"ordertype"`
+		Price     string `json:"price"`
+		Price2    string `json:"price2"`
+		Leverage  string `json:"leverage"`
+		Order     string `json:"order"`
+		Close     string `json:"close"`
+	} `json:"descr"`
+	Vol        krakenNumber `json:"vol"`
+	VolExec    krakenNumber `json:"vol_exec"`
+	Cost       krakenNumber `json:"cost"`
+	Fee        krakenNumber `json:"fee"`
+	Price      krakenNumber `json:"price"`
+	Stopprice  string       `json:"stopprice"`
+	Limitprice string       `json:"limitprice"`
+	Misc       string       `json:"misc"`
+	Oflags     string       `json:"oflags"`
+	Trades     []string     `json:"trades"`
+}
+
+// orderInfo parses the execution details of o. Every field that parses is populated, the fields that don't are
+// returned as joined *OrderInfoError.
+func (o krakenOrder) orderInfo() (oi orderInfo, err error) {
+	oi.Status = o.Status
+
+	var errs []error
+	parse := func(field string, raw krakenNumber, v *float64) {
+		f, err := raw.Float()
+		if err != nil {
+			errs = append(errs, &OrderInfoError{Field: field, Raw: string(raw), Err: err})
+			return
+		}
+		*v = f
+	}
+	parse("fee", o.Fee, &oi.Fee)
+	parse("cost", o.Cost, &oi.Cost)
+	parse("price", o.Price, &oi.Price)
+	parse("volume", o.Vol, &oi.VolumePurchased)
+	oi.Volume, oi.VolumeExecuted = oi.VolumePurchased, oi.VolumePurchased
+	// responses without vol_exec are taken to have executed the whole volume
+	if o.VolExec != "" {
+		parse("executed volume", o.VolExec, &oi.VolumeExecuted)
+	}
+	return oi, errors.Join(errs...)
 }
 
 func (p *KrakenProvider) queryOrderInfo(ctx context.Context, transactionID string) (oi orderInfo, err error) {
@@ -239,100 +1060,257 @@ func (p *KrakenProvider) queryOrderInfo(ctx context.Context, transactionID strin
 
 	p.Logger.InfoContext(ctx, "querying order info")
 
-	// add +1 to ensure the nonce generated is higher than the previous generated nonce.
-	nonce := p.GenerateNonce() + 1
-
 	params := url.Values{}
 	params.Set("txid", transactionID)
-	params.Set("nonce", strconv.FormatInt(nonce, 10))
 	params.Set("trades", "true")
 
-	p.Logger.InfoContext(ctx, "creating HTTP request", "body", params)
+	var result map[string]krakenOrder
+	if err = p.privateRequest(ctx, "/0/private/QueryOrders", params, &result); err != nil {
+		return oi, fmt.Errorf("failed to query order info: %w", err)
+	}
+
+	if oi, err = result[transactionID].orderInfo(); err != nil && p.StrictOrderInfo {
+		return oi, err
+	} else if err != nil {
+		// the order was placed, so the fields that parsed are kept and the others reported as warnings
+		p.Logger.WarnContext(ctx, "failed to parse order info", "transactionId", transactionID, "error", err)
+		errs := []error{err}
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			errs = joined.Unwrap()
+		}
+		for _, e := range errs {
+			oi.Warnings = append(oi.Warnings, fmt.Sprintf("order %s: %v", transactionID, e))
+		}
+	}
+
+	p.Logger.InfoContext(ctx, "response from query order info", "response", oi)
+	return oi, nil
+}
+
+// FindOrders returns the open orders and the orders closed since the given time which carry the provider's
+// userref tag, ordered by the time they were opened.
+func (p *KrakenProvider) FindOrders(ctx context.Context, since time.Time) (orders []OrderRecord, err error) {
+	defer WrapErr(&err, "KrakenProvider.FindOrders")
+
+	p.Logger.InfoContext(ctx, "finding orders", "since", since, "userref", p.UserRef)
+
+	var open struct {
+		Open map[string]krakenOrder `json:"open"`
+	}
+	if err = p.privateRequest(ctx, "/0/private/OpenOrders", url.Values{
+		"userref": {strconv.Itoa(p.UserRef)},
+	}, &open); err != nil {
+		return nil, fmt.Errorf("failed to fetch open orders: %w", err)
+	}
+
+	var closed struct {
+		Closed map[string]krakenOrder `json:"closed"`
+		Count  int                    `json:"count"`
+	}
+	if err = p.privateRequest(ctx, "/0/private/ClosedOrders", url.Values{
+		"userref": {strconv.Itoa(p.UserRef)},
+		"start":   {strconv.FormatInt(since.Unix(), 10)},
+	}, &closed); err != nil {
+		return nil, fmt.Errorf("failed to fetch closed orders: %w", err)
+	}
+
+	for _, set := range []map[string]krakenOrder{open.Open, closed.Closed} {
+		for txid, o := range set {
+			openedAt := time.Unix(0, int64(o.Opentm*float64(time.Second)))
+			// The userref filter is applied again in case the endpoint ignored it
+			if o.Userref != p.UserRef || openedAt.Before(since) {
+				continue
+			}
+
+			var oi orderInfo
+			if oi, err = o.orderInfo(); err != nil {
+				return nil, fmt.Errorf("failed to parse order %s: %w", txid, err)
+			}
+
+			orders = append(orders, OrderRecord{
+				Time:  openedAt.UTC(),
+				Order: p.withFill(ctx, ExecuteOrderResponse{TransactionID: txid, AdditionalInfo: o.Descr.Order, OrderType: o.Descr.Ordertype}, oi),
+			})
+		}
+	}
+
+	sort.Slice(orders, func(i, j int) bool { return orders[i].Time.Before(orders[j].Time) })
+	return orders, nil
+}
+
+// publicRequest performs a GET against a public endpoint and decodes the response result into result.
+func (p *KrakenProvider) publicRequest(ctx context.Context, path string, query url.Values, result any) (err error) {
+	u := p.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
 
 	var req *http.Request
-	if req, err = http.NewRequest("POST", "https://api.kraken.com/0/private/QueryOrders", bytes.NewBufferString(params.Encode())); err != nil {
-		return oi, fmt.Errorf("failed to make request: %w", err)
+	if req, err = http.NewRequestWithContext(ctx, "GET", u, nil); err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	req.Header.Add("Accept", "application/json")
+
+	return p.do(ctx, req, result)
+}
+
+// krakenReadOnlyPaths are the private endpoints a ReadOnly provider may call. It's an allowlist so endpoints added
+// later are blocked until they're known not to change the account.
+var krakenReadOnlyPaths = map[string]bool{
+	"/0/private/Balance":         true,
+	"/0/private/BalanceEx":       true,
+	"/0/private/TradeBalance":    true,
+	"/0/private/TradeVolume":     true,
+	"/0/private/OpenOrders":      true,
+	"/0/private/ClosedOrders":    true,
+	"/0/private/QueryOrders":     true,
+	"/0/private/TradesHistory":   true,
+	"/0/private/QueryTrades":     true,
+	"/0/private/Ledgers":         true,
+	"/0/private/QueryLedgers":    true,
+	"/0/private/DepositStatus":   true,
+	"/0/private/DepositMethods":  true,
+	"/0/private/WithdrawInfo":    true,
+	"/0/private/Earn/Strategies": true,
+	// the token only authenticates WebSocket subscriptions
+	"/0/private/GetWebSocketsToken": true,
+}
+
+// privateRequest signs params with a fresh nonce, POSTs them to a private endpoint and decodes the response
+// result into result.
+func (p *KrakenProvider) privateRequest(ctx context.Context, path string, params url.Values, result any) (err error) {
+	validateOrder := p.AllowValidateOrders && path == "/0/private/AddOrder" && params.Get("validate") == "true"
+	if p.ReadOnly && !krakenReadOnlyPaths[path] && !validateOrder {
+		return fmt.Errorf("%w: %s", ErrReadOnlyMode, path)
+	}
+
+	p.privateMu.Lock()
+	defer p.privateMu.Unlock()
+
+	if err = p.countCall(ctx, path); err != nil {
+		return err
+	}
+
+	nonce := p.nextNonce()
+	params.Set("nonce", strconv.FormatInt(nonce, 10))
+
+	p.Logger.InfoContext(ctx, "creating HTTP request", "path", path, "body", params)
+
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, "POST", p.BaseURL+path, bytes.NewBufferString(params.Encode())); err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
 	}
 
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Add("Accept", "application/json")
 	req.Header.Add("API-Key", p.APIKey)
-	req.Header.Add("API-Sign", p.generateSignature("/0/private/QueryOrders", params, nonce))
+	req.Header.Add("API-Sign", p.generateSignature(path, params, nonce))
 
-	res, err := p.http.Do(req)
-	if err != nil {
-		return oi, fmt.Errorf("failed to do request: %w", err)
+	return p.do(ctx, req, result)
+}
+
+// countCall records a private call to path against the API counter estimate, waiting first when RateLimitWait is
+// set and the call would exceed the tier limit.
+func (p *KrakenProvider) countCall(ctx context.Context, path string) error {
+	cost := krakenCallCost(path)
+	if cost == 0 {
+		return nil
 	}
 
-	defer func() {
-		if cerr := res.Body.Close(); cerr != nil {
-			p.Logger.WarnContext(ctx, "failed to close response body", "err", cerr)
+	if delay := p.Counter.Delay(cost); p.RateLimitWait && delay > 0 {
+		p.Logger.InfoContext(ctx, "delaying call to stay under the api rate limit", "path", path, "delay", delay)
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
 		}
-	}()
+	}
 
-	var body []byte
+	counter := p.Counter.Add(cost)
+	p.Logger.DebugContext(ctx, "api counter", "path", path, "cost", cost, "counter", counter, "max", p.Counter.Max)
+	return nil
+}
+
+// Stats returns an estimate of the private API usage of the provider.
+func (p *KrakenProvider) Stats() KrakenStats {
+	return p.Counter.Stats()
+}
 
-	if body, err = io.ReadAll(res.Body); err != nil {
-		return oi, fmt.Errorf("failed to read response body: %w", err)
+// Timings returns how long the steps of the orders placed by the provider took, in the order they finished.
+func (p *KrakenProvider) Timings() []StepTiming {
+	return p.timings.list()
+}
+
+// Warnings returns the warnings Kraken sent alongside responses, the entries of the error field prefixed with W,
+// each prefixed with the endpoint's path.
+func (p *KrakenProvider) Warnings() []string {
+	p.warningsMu.Lock()
+	defer p.warningsMu.Unlock()
+	return slices.Clone(p.warnings)
+}
+
+// do executes req and decodes the Kraken response envelope, mapping its errors to typed errors.
+func (p *KrakenProvider) do(ctx context.Context, req *http.Request, result any) (err error) {
+	// History responses can be large, readResponseBody decompresses them.
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	budget := krakenRequestBudget
+	if req.URL.Path == "/0/private/AddOrder" {
+		budget = krakenAddOrderBudget
+	}
+	timeout, err := stepTimeout(ctx, p.Logger, req.URL.Path, budget, p.RequestTimeout)
+	if err != nil {
+		return err
+	}
+
+	// the timeout covers reading the response
+	ctx, cancel := context.WithTimeout(withHTTPComponent(ctx, HTTPComponentKraken), timeout)
+	defer cancel()
+	res, err := p.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to do request: %w", err)
+	}
+
+	var body []byte
+	if body, err = readResponseBody(res, p.MaxResponseBytes); err != nil {
+		return err
+	} else if res.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%w: %s", ErrExchangeUnavailable, res.Status)
 	}
 
 	var response = struct {
-		Error  []string `json:"error"`
-		Result map[string]struct {
-			Refid    string  `json:"refid"`
-			Userref  int     `json:"userref"`
-			Status   string  `json:"status"`
-			Reason   any     `json:"reason"`
-			Opentm   float64 `json:"opentm"`
-			Closetm  float64 `json:"closetm"`
-			Starttm  int     `json:"starttm"`
-			Expiretm int     `json:"expiretm"`
-			Descr    struct {
-				Pair      string `json:"pair"`
-				Type      string `json:"type"`
-				Ordertype string `json:"ordertype"`
-				Price     string `json:"price"`
-				Price2    string `json:"price2"`
-				Leverage  string `json:"leverage"`
-				Order     string `json:"order"`
-				Close     string `json:"close"`
-			} `json:"descr"`
-			Vol        string   `json:"vol"`
-			VolExec    string   `json:"vol_exec"`
-			Cost       string   `json:"cost"`
-			Fee        string   `json:"fee"`
-			Price      string   `json:"price"`
-			Stopprice  string   `json:"stopprice"`
-			Limitprice string   `json:"limitprice"`
-			Misc       string   `json:"misc"`
-			Oflags     string   `json:"oflags"`
-			Trades     []string `json:"trades"`
-		} `json:"result"`
+		Error  []any           `json:"error"`
+		Result json.RawMessage `json:"result"`
 	}{}
 
 	if err = json.Unmarshal(body, &response); err != nil {
-		return oi, fmt.Errorf("failed to unmarshal response body: %w", err)
+		return fmt.Errorf("failed to unmarshal response body: %w", err)
 	}
 
-	if response.Error != nil && len(response.Error) > 0 {
-		return oi, fmt.Errorf("failed to query order info: %v", p.toError(response.Error[0]))
+	if err = p.checkMessages(ctx, req.URL.Path, krakenMessages(response.Error)); err != nil {
+		return err
 	}
 
-	if oi.Fee, err = strconv.ParseFloat(response.Result[transactionID].Fee, 64); err != nil {
-		return oi, fmt.Errorf("failed to parse fee: %w", err)
-	}
-	if oi.Cost, err = strconv.ParseFloat(response.Result[transactionID].Cost, 64); err != nil {
-		return oi, fmt.Errorf("failed to parse cost: %w", err)
-	}
-	if oi.Price, err = strconv.ParseFloat(response.Result[transactionID].Price, 64); err != nil {
-		return oi, fmt.Errorf("failed to parse price: %w", err)
-	}
-	if oi.VolumePurchased, err = strconv.ParseFloat(response.Result[transactionID].Vol, 64); err != nil {
-		return oi, fmt.Errorf("failed to parse volume: %w", err)
+	if err = json.Unmarshal(response.Result, result); err != nil {
+		return fmt.Errorf("failed to unmarshal response result: %w", err)
 	}
+	return nil
+}
 
-	p.Logger.InfoContext(ctx, "response from query order info", "response", oi)
-	return oi, nil
+// nextNonce returns a nonce that is strictly greater than any previously returned nonce.
+func (p *KrakenProvider) nextNonce() int64 {
+	p.nonceMu.Lock()
+	defer p.nonceMu.Unlock()
+
+	nonce := p.GenerateNonce()
+	if nonce <= p.lastNonce {
+		nonce = p.lastNonce + 1
+	}
+	p.lastNonce = nonce
+	return nonce
 }
 
 func (p *KrakenProvider) generateSignature(path string, data url.Values, nonce int64) string {
@@ -346,11 +1324,88 @@ func (p *KrakenProvider) generateSignature(path string, data url.Values, nonce i
 	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
 }
 
-func (p *KrakenProvider) toError(message string) error {
-	if message == "EGeneral:Invalid arguments:volume minimum not met" {
-		return ErrOrderToSmall
-	} else if message == "EAPI:Invalid key" {
-		return ErrInvalidAuth
+// krakenErrors maps Kraken error messages returned by any endpoint to typed errors.
+var krakenErrors = map[string]error{
+	"EGeneral:Invalid arguments:volume minimum not met": ErrOrderToSmall,
+	"EAPI:Invalid key":                    ErrInvalidAuth,
+	"EService:Market in cancel_only mode": ErrCancelOnlyMode,
+	"EAPI:Rate limit exceeded":            ErrRateLimited,
+	"EService:Market in post_only mode":   ErrPostOnlyMode,
+	"EOrder:Insufficient funds":           ErrInsufficientFunds,
+	"EService:Unavailable":                ErrExchangeUnavailable,
+	"EService:Busy":                       ErrExchangeUnavailable,
+	"EGeneral:Internal error":             ErrExchangeUnavailable,
+}
+
+// krakenEndpointErrors maps Kraken error messages to typed errors for specific endpoints, these take precedence
+// over krakenErrors.
+var krakenEndpointErrors = map[string]map[string]error{
+	"/0/public/AssetPairs": {
+		"EQuery:Unknown asset pair": ErrUnsupportedPair,
+	},
+	"/0/private/Earn/Strategies": krakenEarnErrors,
+	"/0/private/Earn/Allocate":   krakenEarnErrors,
+	"/0/private/DepositStatus": {
+		"EFunding:Unknown asset":     ErrUnknownAsset,
+		"EFunding:Invalid asset":     ErrUnknownAsset,
+		"EFunding:Unknown method":    ErrUnknownDepositMethod,
+		"EGeneral:Permission denied": ErrPermissionDenied,
+	},
+}
+
+// krakenEarnErrors maps errors returned by the Earn endpoints to typed errors.
+var krakenEarnErrors = map[string]error{
+	"EEarnings:Below min:(De)allocation operation amount less than minimum":                  ErrEarnBelowMinimum,
+	"EEarnings:Busy:Another (de)allocation for the same strategy is in progress":             ErrEarnBusy,
+	"EEarnings:Permission denied:The user's tier is not high enough":                         ErrPermissionDenied,
+	"EEarnings:Insufficient funds:Insufficient funds to complete the (de)allocation request": ErrInsufficientFunds,
+	"EGeneral:Invalid arguments:Invalid strategy ID":                                         ErrUnknownEarnStrategy,
+	"EGeneral:Permission denied":                                                             ErrPermissionDenied,
+}
+
+// krakenMessages normalizes the error field of a Kraken response to strings, entries that aren't strings are
+// formatted as JSON rather than dropped.
+func krakenMessages(entries []any) []string {
+	messages := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if s, ok := e.(string); ok {
+			messages = append(messages, s)
+		} else if b, err := json.Marshal(e); err == nil {
+			messages = append(messages, string(b))
+		} else {
+			messages = append(messages, fmt.Sprint(e))
+		}
+	}
+	return messages
+}
+
+// checkMessages separates the messages of a response from path into warnings, prefixed with W, and errors.
+// Warnings are logged and kept for Warnings, the errors are mapped to typed errors and joined so none are dropped.
+func (p *KrakenProvider) checkMessages(ctx context.Context, path string, messages []string) error {
+	var errs []error
+	for _, message := range messages {
+		if strings.HasPrefix(message, "W") {
+			p.Logger.WarnContext(ctx, "warning from kraken", "path", path, "warning", message)
+			p.warningsMu.Lock()
+			p.warnings = append(p.warnings, path+": "+message)
+			p.warningsMu.Unlock()
+			continue
+		}
+		errs = append(errs, p.toError(path, message))
+	}
+
+	// a single error is returned as is so it can still be compared directly
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errors.Join(errs...)
+}
+
+func (p *KrakenProvider) toError(path, message string) error {
+	if err, ok := krakenEndpointErrors[path][message]; ok {
+		return err
+	} else if err, ok = krakenErrors[message]; ok {
+		return err
 	}
 
 	return errors.New(message)
@@ -0,0 +1,827 @@
+package dca_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/1gm/dca"
+)
+
+const (
+	tickerResponse      = `{"error":[],"result":{"XXBTZUSD":{"a":["50000.0","1","1.000"],"b":["49990.0","1","1.000"],"c":["50000.0","0.1"]}}}`
+	queryOrdersResponse = `{"error":[],"result":{"TXID-1":{"status":"closed","vol":"0.00010000","vol_exec":"0.00010000","cost":"5.00","fee":"0.02","price":"50000.0"}}}`
+	addOrderResponse    = `{"error":[],"result":{"txid":["TXID-1"],"descr":{"order":"buy 0.0001 XBTUSD @ market"}}}`
+)
+
+// krakenTestServer is a scripted Kraken API which records the requests it receives.
+type krakenTestServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	responses map[string][]string
+	requests  map[string][]url.Values
+}
+
+// newKrakenTestServer creates a server returning responses per path in order, repeating the last response
+// once exhausted.
+func newKrakenTestServer(t *testing.T, responses map[string][]string) *krakenTestServer {
+	t.Helper()
+
+	s := &krakenTestServer{responses: responses, requests: map[string][]url.Values{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse form: %v", err)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.requests[r.URL.Path] = append(s.requests[r.URL.Path], r.Form)
+		bodies, ok := s.responses[r.URL.Path]
+		if !ok || len(bodies) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		body := bodies[0]
+		if len(bodies) > 1 {
+			s.responses[r.URL.Path] = bodies[1:]
+		}
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Requests returns the form values of every request made to path.
+func (s *krakenTestServer) Requests(path string) []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+func newTestKrakenProvider(s *krakenTestServer, cfg dca.KrakenProviderConfig) *dca.KrakenProvider {
+	cfg.BaseURL = s.URL
+	cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	return dca.NewKrakenProvider(&cfg)
+}
+
+func TestKrakenProvider_ExecuteOrder(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":       {tickerResponse},
+		"/0/private/AddOrder":    {addOrderResponse},
+		"/0/private/QueryOrders": {queryOrdersResponse},
+	})
+	p := newTestKrakenProvider(s, dca.KrakenProviderConfig{})
+
+	res, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want, got := "TXID-1", res.TransactionID; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := "market", res.OrderType; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := 0.02, res.Fee; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := "market", s.Requests("/0/private/AddOrder")[0].Get("ordertype"); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestKrakenProvider_ExecuteOrder_TradingModes(t *testing.T) {
+	tt := []struct {
+		status   string
+		addOrder string
+		fallback bool
+		expected error
+	}{
+		// detected from SystemStatus
+		{"cancel_only", addOrderResponse, false, dca.ErrCancelOnlyMode},
+		{"cancel_only", addOrderResponse, true, dca.ErrCancelOnlyMode},
+		{"post_only", addOrderResponse, false, dca.ErrPostOnlyMode},
+		// detected from the AddOrder error string
+		{"online", `{"error":["EService:Market in cancel_only mode"]}`, false, dca.ErrCancelOnlyMode},
+		{"online", `{"error":["EService:Market in post_only mode"]}`, false, dca.ErrPostOnlyMode},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"` + tc.status + `"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {tc.addOrder},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		p := newTestKrakenProvider(s, dca.KrakenProviderConfig{PostOnlyFallback: tc.fallback})
+
+		if _, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500}); !errors.Is(err, tc.expected) {
+			t.Errorf("%d: want %v got %v", i, tc.expected, err)
+		}
+	}
+}
+
+func TestKrakenProvider_ExecuteOrder_PostOnlyFallback(t *testing.T) {
+	tt := []struct {
+		status    string
+		addOrders []string
+	}{
+		{"post_only", []string{addOrderResponse}},
+		{"online", []string{`{"error":["EService:Market in post_only mode"]}`, addOrderResponse}},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"` + tc.status + `"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    tc.addOrders,
+			"/0/private/QueryOrders": {`{"error":[],"result":{"TXID-1":{"status":"open","vol":"0.00010002","vol_exec":"0","cost":"0","fee":"0","price":"0"}}}`},
+		})
+		p := newTestKrakenProvider(s, dca.KrakenProviderConfig{PostOnlyFallback: true})
+
+		res, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500})
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+
+		if want, got := "limit", res.OrderType; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := "open", res.Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+
+		requests := s.Requests("/0/private/AddOrder")
+		params := requests[len(requests)-1]
+		if want, got := "limit", params.Get("ordertype"); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := "post", params.Get("oflags"); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := "49990", params.Get("price"); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestKrakenProvider_ExecuteOrder_PendingDeposit(t *testing.T) {
+	tt := []struct {
+		enabled       bool
+		balance       string
+		depositStatus string
+		expected      error
+	}{
+		// pending deposit covers the $5.00 order
+		{true, `{"error":[],"result":{"ZUSD":"1.00"}}`, `{"error":[],"result":[{"refid":"R1","amount":"4.50","fee":"0.00","status":"Pending"}]}`, dca.ErrDepositPending},
+		// pending deposit doesn't cover the shortfall
+		{true, `{"error":[],"result":{"ZUSD":"1.00"}}`, `{"error":[],"result":[{"refid":"R1","amount":"3.00","fee":"0.00","status":"Pending"}]}`, dca.ErrInsufficientFunds},
+		// completed deposits are ignored
+		{true, `{"error":[],"result":{"ZUSD":"1.00"}}`, `{"error":[],"result":[{"refid":"R1","amount":"100.00","fee":"0.00","status":"Success"}]}`, dca.ErrInsufficientFunds},
+		// settled deposits are credited already
+		{true, `{"error":[],"result":{"ZUSD":"1.00"}}`, `{"error":[],"result":[{"refid":"R1","amount":"100.00","fee":"0.00","status":"Settled"}]}`, dca.ErrInsufficientFunds},
+		// the deposit status error doesn't mask the original error
+		{true, `{"error":[],"result":{"ZUSD":"1.00"}}`, `{"error":["EFunding:Unknown asset"]}`, dca.ErrInsufficientFunds},
+		// disabled
+		{false, `{"error":[],"result":{"ZUSD":"1.00"}}`, `{"error":[],"result":[{"refid":"R1","amount":"4.50","fee":"0.00","status":"Pending"}]}`, dca.ErrInsufficientFunds},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus":   {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":         {tickerResponse},
+			"/0/private/AddOrder":      {`{"error":["EOrder:Insufficient funds"]}`},
+			"/0/private/Balance":       {tc.balance},
+			"/0/private/DepositStatus": {tc.depositStatus},
+		})
+		p := newTestKrakenProvider(s, dca.KrakenProviderConfig{SkipOnPendingDeposit: tc.enabled})
+
+		_, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500})
+		if !errors.Is(err, tc.expected) {
+			t.Errorf("%d: want %v got %v", i, tc.expected, err)
+		}
+
+		if want, got := tc.enabled, len(s.Requests("/0/private/DepositStatus")) == 1; got != want {
+			t.Errorf("%d: want DepositStatus called %v got %v", i, want, got)
+		} else if got && s.Requests("/0/private/DepositStatus")[0].Get("nonce") == "" {
+			t.Errorf("%d: DepositStatus request is missing a nonce", i)
+		}
+	}
+}
+
+func TestKrakenProvider_ExecuteOrder_SweepBalance(t *testing.T) {
+	tt := []struct {
+		threshold     float64
+		amountInCents int
+		balance       string
+		swept         int
+		expected      error
+	}{
+		// $24.63 is within 5% of $25.00 so $24.50 is spent, keeping a buffer for fees
+		{5, 2500, "24.63", 2450, nil},
+		// $20.00 is more than 5% below $25.00
+		{5, 2500, "20.00", 0, dca.ErrInsufficientFunds},
+		// disabled
+		{0, 2500, "24.63", 0, dca.ErrInsufficientFunds},
+		// $2.48 buys less than the XBT minimum volume of 0.00005
+		{5, 255, "2.50", 0, dca.ErrOrderToSmall},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {`{"error":["EOrder:Insufficient funds"]}`, addOrderResponse},
+			"/0/private/Balance":     {`{"error":[],"result":{"ZUSD":"` + tc.balance + `"}}`},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		p := newTestKrakenProvider(s, dca.KrakenProviderConfig{SweepThresholdPercent: tc.threshold})
+
+		res, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: tc.amountInCents})
+		if !errors.Is(err, tc.expected) {
+			t.Fatalf("%d: want %v got %v", i, tc.expected, err)
+		}
+
+		if want, got := tc.threshold > 0, len(s.Requests("/0/private/Balance")) == 1; got != want {
+			t.Errorf("%d: want Balance called %v got %v", i, want, got)
+		}
+		if tc.expected != nil {
+			if want, got := 1, len(s.Requests("/0/private/AddOrder")); got != want {
+				t.Errorf("%d: want %v AddOrder requests got %v", i, want, got)
+			}
+			continue
+		}
+
+		if want, got := tc.swept, res.AmountInCents; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.amountInCents, res.SweptFromCents; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := formatFloat(res.RequestedVolume), s.Requests("/0/private/AddOrder")[1].Get("volume"); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestKrakenProvider_ReadOnly(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus":     {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":           {tickerResponse},
+		"/0/private/AddOrder":        {addOrderResponse},
+		"/0/private/QueryOrders":     {queryOrdersResponse},
+		"/0/private/Earn/Strategies": {`{"error":[],"result":{"items":[{"id":"S-1","asset":"XBT","can_allocate":true,"user_min_allocation":"0"}]}}`},
+		"/0/private/Earn/Allocate":   {`{"error":[],"result":true}`},
+	})
+	p := newTestKrakenProvider(s, dca.KrakenProviderConfig{ReadOnly: true})
+	// only orders sent with validate are let through
+	p.AllowValidateOrders = true
+
+	if _, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500}); !errors.Is(err, dca.ErrReadOnlyMode) {
+		t.Errorf("want %v got %v", dca.ErrReadOnlyMode, err)
+	}
+	if _, err := p.AllocateEarn(context.Background(), "S-1", 0.0001); !errors.Is(err, dca.ErrReadOnlyMode) {
+		t.Errorf("want %v got %v", dca.ErrReadOnlyMode, err)
+	}
+
+	// blocked calls never reach the exchange
+	for _, path := range []string{"/0/private/AddOrder", "/0/private/Earn/Allocate"} {
+		if want, got := 0, len(s.Requests(path)); got != want {
+			t.Errorf("want %v %s requests got %v", want, path, got)
+		}
+	}
+
+	res, err := p.QueryOrder(context.Background(), "TXID-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, got := "closed", res.Status; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := 1, len(s.Requests("/0/private/QueryOrders")); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestKrakenProvider_ErrorMessages(t *testing.T) {
+	withWarning := strings.Replace(addOrderResponse, `"error":[]`, `"error":["WGeneral:Notice"]`, 1)
+
+	tt := []struct {
+		addOrder string
+		errs     []error
+		message  string
+		warnings []string
+	}{
+		{withWarning, nil, "", []string{"/0/private/AddOrder: WGeneral:Notice"}},
+		// warnings alongside an error don't hide it
+		{`{"error":["WOrder:Partial fill expected","EOrder:Insufficient funds"]}`, []error{dca.ErrInsufficientFunds}, "", []string{"/0/private/AddOrder: WOrder:Partial fill expected"}},
+		// every error is kept
+		{`{"error":["EAPI:Invalid key","EService:Busy"]}`, []error{dca.ErrInvalidAuth, dca.ErrExchangeUnavailable}, "", nil},
+		{`{"error":["EGeneral:Unknown","WGeneral:Notice","EGeneral:Other"]}`, nil, "EGeneral:Unknown\nEGeneral:Other", []string{"/0/private/AddOrder: WGeneral:Notice"}},
+		// entries that aren't strings are formatted rather than dropped
+		{`{"error":[{"code":1}]}`, nil, `{"code":1}`, nil},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {tc.addOrder},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		p := newTestKrakenProvider(s, dca.KrakenProviderConfig{})
+
+		_, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500})
+		if want, got := len(tc.errs) > 0 || tc.message != "", err != nil; got != want {
+			t.Fatalf("%d: want error %v got %v", i, want, err)
+		}
+		for _, target := range tc.errs {
+			if !errors.Is(err, target) {
+				t.Errorf("%d: want %v in %v", i, target, err)
+			}
+		}
+		if tc.message != "" && !strings.Contains(err.Error(), tc.message) {
+			t.Errorf("%d: want %q in %q", i, tc.message, err)
+		}
+
+		warnings := p.Warnings()
+		if want, got := len(tc.warnings), len(warnings); got != want {
+			t.Fatalf("%d: want %v got %v", i, tc.warnings, warnings)
+		}
+		for j := range warnings {
+			if want, got := tc.warnings[j], warnings[j]; got != want {
+				t.Errorf("%d: want %v got %v", i, want, got)
+			}
+		}
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func TestKrakenProvider_ExecuteOrder_RequestMetadata(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":       {`{"error":[],"result":{"XETHZUSD":{"a":["2500.0","1","1.000"],"b":["2499.0","1","1.000"]}}}`},
+		"/0/private/AddOrder":    {addOrderResponse},
+		"/0/private/QueryOrders": {queryOrdersResponse},
+	})
+	p := newTestKrakenProvider(s, dca.KrakenProviderConfig{})
+
+	res, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{
+		AmountInCents: 500,
+		Pair:          "ETHUSD",
+		ClientOrderID: "weekly-1",
+		UserRef:       42,
+		Tags:          map[string]string{"goal": "retirement"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want, got := "ETHUSD", res.Pair; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := dca.SideBuy, res.Side; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := "retirement", res.Tags["goal"]; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := 0.002, res.RequestedVolume; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	params := s.Requests("/0/private/AddOrder")[0]
+	for key, want := range map[string]string{"pair": "ETHUSD", "type": "buy", "cl_ord_id": "weekly-1", "userref": "42"} {
+		if got := params.Get(key); got != want {
+			t.Errorf("%s: want %v got %v", key, want, got)
+		}
+	}
+}
+
+func TestKrakenProvider_ExecuteOrder_DefaultPair(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":       {tickerResponse},
+		"/0/private/AddOrder":    {addOrderResponse},
+		"/0/private/QueryOrders": {queryOrdersResponse},
+	})
+	p := newTestKrakenProvider(s, dca.KrakenProviderConfig{})
+
+	res, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, got := dca.KrakenDefaultPair, res.Pair; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := "3530", s.Requests("/0/private/AddOrder")[0].Get("userref"); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestKrakenProvider_ExecuteOrder_UnsupportedPair(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{})
+	p := newTestKrakenProvider(s, dca.KrakenProviderConfig{})
+
+	if _, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500, Pair: "DOGEUSD"}); !errors.Is(err, dca.ErrUnsupportedPair) {
+		t.Errorf("want %v got %v", dca.ErrUnsupportedPair, err)
+	}
+	if want, got := 0, len(s.Requests("/0/public/SystemStatus")); got != want {
+		t.Errorf("want no requests got %v", got)
+	}
+}
+
+func TestKrakenProvider_ExecuteOrder_ConditionalOrderTypes(t *testing.T) {
+	tt := []struct {
+		order    dca.ExecuteOrderRequest
+		expected url.Values
+	}{
+		{
+			dca.ExecuteOrderRequest{AmountInCents: 500, OrderType: dca.OrderTypeLimit, Price: 40000},
+			url.Values{"ordertype": {"limit"}, "price": {"40000"}, "volume": {"0.000125"}},
+		},
+		{
+			dca.ExecuteOrderRequest{AmountInCents: 500, OrderType: dca.OrderTypeStopLossLimit, Price: 45000, Price2: 40000.5},
+			url.Values{"ordertype": {"stop-loss-limit"}, "price": {"45000"}, "price2": {"40000.5"}},
+		},
+		{
+			dca.ExecuteOrderRequest{AmountInCents: 500, OrderType: dca.OrderTypeTrailingStop, Offset: "2.5%"},
+			url.Values{"ordertype": {"trailing-stop"}, "price": {"+2.5%"}, "volume": {"0.0001"}},
+		},
+		{
+			dca.ExecuteOrderRequest{AmountInCents: 500, OrderType: dca.OrderTypeTrailingStop, Offset: "150", Side: dca.SideSell},
+			url.Values{"ordertype": {"trailing-stop"}, "price": {"+150"}, "type": {"sell"}},
+		},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+		})
+		p := newTestKrakenProvider(s, dca.KrakenProviderConfig{})
+
+		res, err := p.ExecuteOrder(context.Background(), tc.order)
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+
+		// conditional orders may never fill so the order isn't polled
+		if want, got := dca.OrderStatusOpen, res.Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := "TXID-1", res.TransactionID; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.order.OrderType, res.OrderType; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := 0, len(s.Requests("/0/private/QueryOrders")); got != want {
+			t.Errorf("%d: want %v QueryOrders requests got %v", i, want, got)
+		}
+
+		params := s.Requests("/0/private/AddOrder")[0]
+		for key := range tc.expected {
+			if want, got := tc.expected.Get(key), params.Get(key); got != want {
+				t.Errorf("%d: want %s=%v got %v", i, key, want, got)
+			}
+		}
+	}
+}
+
+func TestKrakenProvider_ExecuteOrder_ConditionalOrderSignature(t *testing.T) {
+	const secret = "test-secret"
+
+	var body, signature string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/0/public/SystemStatus":
+			_, _ = io.WriteString(w, `{"error":[],"result":{"status":"online"}}`)
+		case "/0/private/AddOrder":
+			b, _ := io.ReadAll(r.Body)
+			body, signature = string(b), r.Header.Get("API-Sign")
+			_, _ = io.WriteString(w, addOrderResponse)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	p := dca.NewKrakenProvider(&dca.KrakenProviderConfig{
+		APIKey:    "key",
+		APISecret: secret,
+		BaseURL:   s.URL,
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	p.GenerateNonce = func() int64 { return 1700000000000000000 }
+
+	order := dca.ExecuteOrderRequest{AmountInCents: 500, OrderType: dca.OrderTypeStopLossLimit, Price: 45000, Price2: 40000}
+	if _, err := p.ExecuteOrder(context.Background(), order); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the extra prices are form encoded in key order alongside the common parameters
+	expected := "nonce=1700000000000000000&ordertype=stop-loss-limit&pair=XBTUSD&price=45000&price2=40000&type=buy&userref=3530&volume=0.000125"
+	if got := body; got != expected {
+		t.Errorf("want %v got %v", expected, got)
+	}
+
+	sha := sha256.Sum256([]byte("1700000000000000000" + expected))
+	mac := hmac.New(sha512.New, []byte(secret))
+	mac.Write(append([]byte("/0/private/AddOrder"), sha[:]...))
+	if want, got := base64.StdEncoding.EncodeToString(mac.Sum(nil)), signature; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestKrakenProvider_ExecuteOrder_VolumeRounding(t *testing.T) {
+	tt := []struct {
+		amountInCents int
+		rounding      string
+		expected      string
+		err           error
+	}{
+		// without rounding the float division leaks into the order
+		{1234, "", "0.00024680000000000004", nil},
+		{1234, "0.00001", "0.00024", nil},
+		{1234, "0.0001", "0.0002", nil},
+		{1234, "0.001", "", dca.ErrOrderToSmall},
+		// 0.0000498 rounds down to 0.00004 which is below the XBT minimum of 0.00005
+		{249, "0.00001", "", dca.ErrOrderToSmall},
+		{250, "0.00001", "0.00005", nil},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		p := newTestKrakenProvider(s, dca.KrakenProviderConfig{VolumeRounding: tc.rounding})
+
+		_, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: tc.amountInCents})
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("%d: want %v got %v", i, tc.err, err)
+		}
+
+		requests := s.Requests("/0/private/AddOrder")
+		if tc.err != nil {
+			if want, got := 0, len(requests); got != want {
+				t.Errorf("%d: want %v AddOrder requests got %v", i, want, got)
+			}
+			continue
+		}
+		if want, got := tc.expected, requests[0].Get("volume"); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestAppConfig_Validate_VolumeRounding(t *testing.T) {
+	tt := []struct {
+		rounding string
+		valid    bool
+	}{
+		{"", true},
+		{"0.00001", true},
+		{"1", true},
+		{"0", false},
+		{"-0.001", false},
+		{"1e-5", false},
+		{"1/3", false},
+		{"abc", false},
+	}
+	for i, tc := range tt {
+		cfg := dca.AppConfig{KrakenAPIKey: "key", KrakenPrivateKey: "secret", OrderAmountInCents: 500, VolumeRounding: tc.rounding}
+		if want, got := tc.valid, cfg.Validate() == nil; got != want {
+			t.Errorf("%d: want valid %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestAppConfig_Validate_OrderType(t *testing.T) {
+	tt := []struct {
+		orderType string
+		price     float64
+		price2    float64
+		offset    string
+		valid     bool
+	}{
+		{"", 0, 0, "", true},
+		{dca.OrderTypeMarket, 40000, 0, "", false},
+		{dca.OrderTypeLimit, 40000, 0, "", true},
+		{dca.OrderTypeLimit, 0, 0, "", false},
+		{dca.OrderTypeStopLossLimit, 45000, 40000, "", true},
+		{dca.OrderTypeStopLossLimit, 45000, 0, "", false},
+		{dca.OrderTypeStopLossLimit, 45000, 40000, "5%", false},
+		{dca.OrderTypeTrailingStop, 0, 0, "5%", true},
+		{dca.OrderTypeTrailingStop, 0, 0, "150", true},
+		{dca.OrderTypeTrailingStop, 0, 0, "", false},
+		{dca.OrderTypeTrailingStop, 0, 0, "-5%", false},
+		{dca.OrderTypeTrailingStop, 40000, 0, "5%", false},
+		{"iceberg", 0, 0, "", false},
+	}
+	for i, tc := range tt {
+		cfg := dca.AppConfig{
+			KrakenAPIKey:       "key",
+			KrakenPrivateKey:   "secret",
+			OrderAmountInCents: 500,
+			OrderType:          tc.orderType,
+			Price:              tc.price,
+			Price2:             tc.price2,
+			Offset:             tc.offset,
+		}
+		if err := cfg.Validate(); (err == nil) != tc.valid {
+			t.Errorf("%d: want valid %v got %v", i, tc.valid, err)
+		}
+	}
+}
+
+func TestKrakenProvider_ExecuteOrder_TickerKeys(t *testing.T) {
+	const entry = `{"a":["50000.0","1","1.000"],"b":["49990.0","1","1.000"]}`
+	tt := []struct {
+		result   string
+		expected bool
+	}{
+		{`{"XXBTZUSD":` + entry + `}`, true},
+		{`{"XBTUSD":` + entry + `}`, true},
+		// a single entry is used whatever its key
+		{`{"XBT/USD":` + entry + `}`, true},
+		// several entries must include the pair
+		{`{"XBTUSD":` + entry + `,"XETHZUSD":{"a":["1.0","1","1.000"],"b":["1.0","1","1.000"]}}`, true},
+		{`{"XBT/USD":` + entry + `,"XETHZUSD":` + entry + `}`, false},
+		{`{}`, false},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {`{"error":[],"result":` + tc.result + `}`},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		p := newTestKrakenProvider(s, dca.KrakenProviderConfig{})
+
+		res, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500})
+		if want, got := tc.expected, err == nil; got != want {
+			t.Errorf("%d: want success %v got %v", i, want, err)
+			continue
+		} else if err != nil {
+			// the order is never placed with a bogus volume
+			if want, got := 0, len(s.Requests("/0/private/AddOrder")); got != want {
+				t.Errorf("%d: want %v AddOrder requests got %v", i, want, got)
+			}
+			continue
+		}
+		if want, got := 0.0001, res.RequestedVolume; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestKrakenProvider_ExecuteOrder_OrderInfoParse(t *testing.T) {
+	tt := []struct {
+		fee, cost, price, vol string
+		failed                []string
+	}{
+		{"0.02", "5.00", "50000.0", "0.00010000", nil},
+		{"n/a", "5.00", "50000.0", "0.00010000", []string{"fee"}},
+		{"0.02", "", "50000.0", "0.00010000", []string{"cost"}},
+		{"0.02", "5.00", "5O000.0", "0.00010000", []string{"price"}},
+		{"0.02", "5.00", "50000.0", "-", []string{"volume"}},
+		{"n/a", "", "5O000.0", "-", []string{"fee", "cost", "price", "volume"}},
+	}
+	for i, tc := range tt {
+		for _, strict := range []bool{false, true} {
+			s := newKrakenTestServer(t, map[string][]string{
+				"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+				"/0/public/Ticker":       {tickerResponse},
+				"/0/private/AddOrder":    {addOrderResponse},
+				"/0/private/QueryOrders": {fmt.Sprintf(`{"error":[],"result":{"TXID-1":{"status":"closed","vol":%q,"vol_exec":"0.00010000","cost":%q,"fee":%q,"price":%q}}}`,
+					tc.vol, tc.cost, tc.fee, tc.price)},
+			})
+			p := newTestKrakenProvider(s, dca.KrakenProviderConfig{StrictOrderInfo: strict})
+
+			res, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500})
+			if strict {
+				var infoErr *dca.OrderInfoError
+				if want, got := len(tc.failed) > 0, errors.As(err, &infoErr); got != want {
+					t.Errorf("%d: want strict failure %v got %v", i, want, err)
+				}
+				continue
+			} else if err != nil {
+				t.Fatalf("%d: %v", i, err)
+			}
+
+			if want, got := len(tc.failed), len(res.Warnings); got != want {
+				t.Fatalf("%d: want %v warnings got %v", i, want, res.Warnings)
+			}
+			raw := map[string]string{"fee": tc.fee, "cost": tc.cost, "price": tc.price, "volume": tc.vol}
+			for j, field := range tc.failed {
+				// the warning names the order, the field and what the exchange returned
+				if want := fmt.Sprintf("order TXID-1: failed to parse %s %q", field, raw[field]); !strings.HasPrefix(res.Warnings[j], want) {
+					t.Errorf("%d: want %v got %v", i, want, res.Warnings[j])
+				}
+			}
+
+			// the fields that parsed are kept
+			got := map[string]float64{"fee": res.Fee, "cost": res.Cost, "price": res.Price, "volume": res.VolumePurchased}
+			want := map[string]float64{"fee": 0.02, "cost": 5, "price": 50000, "volume": 0.0001}
+			for _, field := range tc.failed {
+				want[field] = 0
+			}
+			for field := range want {
+				if got[field] != want[field] {
+					t.Errorf("%d: want %s %v got %v", i, field, want[field], got[field])
+				}
+			}
+		}
+	}
+}
+
+func TestKrakenProvider_ExecuteOrder_NumericFields(t *testing.T) {
+	fields := map[string]string{"fee": "fee", "cost": "cost", "price": "price", "volume": "vol"}
+	values := map[string]string{"fee": "0.02", "cost": "5.00", "price": "50000.0", "volume": "0.00010000"}
+	parsed := map[string]float64{"fee": 0.02, "cost": 5, "price": 50000, "volume": 0.0001}
+	tt := []struct {
+		// format renders the value of a field as JSON
+		format func(v string) string
+		failed bool
+	}{
+		{func(v string) string { return strconv.Quote(v) }, false},
+		{func(v string) string { return v }, false},
+		{func(string) string { return "null" }, true},
+		{func(string) string { return `""` }, true},
+	}
+	for i, tc := range tt {
+		for field, key := range fields {
+			order := map[string]string{}
+			for f, k := range fields {
+				order[k] = strconv.Quote(values[f])
+			}
+			order[key] = tc.format(values[field])
+			s := newKrakenTestServer(t, map[string][]string{
+				"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+				"/0/public/Ticker":       {tickerResponse},
+				"/0/private/AddOrder":    {addOrderResponse},
+				"/0/private/QueryOrders": {fmt.Sprintf(`{"error":[],"result":{"TXID-1":{"status":"closed","vol":%s,"vol_exec":"0.00010000","cost":%s,"fee":%s,"price":%s}}}`,
+					order["vol"], order["cost"], order["fee"], order["price"])},
+			})
+			p := newTestKrakenProvider(s, dca.KrakenProviderConfig{})
+
+			res, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500})
+			if err != nil {
+				t.Fatalf("%d %s: %v", i, field, err)
+			}
+			if want, got := tc.failed, len(res.Warnings) == 1; got != want {
+				t.Errorf("%d %s: want failed %v got %v", i, field, want, res.Warnings)
+			}
+			got := map[string]float64{"fee": res.Fee, "cost": res.Cost, "price": res.Price, "volume": res.VolumePurchased}
+			if want := parsed[field]; got[field] != want && !tc.failed {
+				t.Errorf("%d %s: want %v got %v", i, field, want, got[field])
+			}
+		}
+	}
+
+	// the ticker's prices are read either way too, a missing price rules out the order
+	for i, tc := range tt {
+		ticker := fmt.Sprintf(`{"error":[],"result":{"XXBTZUSD":{"a":[%s,"1","1.000"],"b":[%s,"1","1.000"],"c":[%s,"0.1"]}}}`,
+			tc.format("50000.0"), tc.format("49990.0"), tc.format("50000.0"))
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {ticker},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		p := newTestKrakenProvider(s, dca.KrakenProviderConfig{})
+
+		res, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500})
+		if want, got := tc.failed, err != nil; got != want {
+			t.Errorf("%d: want failed %v got %v", i, want, err)
+			continue
+		} else if err != nil {
+			continue
+		}
+		if want, got := 0.0001, res.RequestedVolume; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if sample, _ := p.LastPrice(); sample.Last != 50000 || sample.Bid != 49990 {
+			t.Errorf("%d: want the last and bid prices got %+v", i, sample)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package dca
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// KrakenDefaultWebSocketURL is the authenticated Kraken WebSocket API.
+const KrakenDefaultWebSocketURL = "wss://ws-auth.kraken.com"
+
+// DefaultKrakenFillTimeout bounds how long an order waits on the WebSocket API for its fill.
+const DefaultKrakenFillTimeout = time.Minute
+
+const (
+	krakenWSDialTimeout  = 10 * time.Second
+	krakenWSPingInterval = 10 * time.Second
+	// krakenWSReadTimeout is how long the connection may stay silent, Kraken sends a heartbeat every second while
+	// there is no other traffic.
+	krakenWSReadTimeout = 30 * time.Second
+)
+
+// errFillTimeout is returned when an order doesn't close within the fill timeout.
+var errFillTimeout = errors.New("timed out waiting for the order to close")
+
+// krakenOrderStream follows the account's orders on the openOrders channel of the WebSocket API.
+type krakenOrderStream struct {
+	p           *KrakenProvider
+	conn        *wsConn
+	stop        chan struct{}
+	reconnected bool
+	// updates merges the partial updates received for every order
+	updates map[string]krakenOrderUpdate
+}
+
+// krakenOrderUpdate is an openOrders update, updates only carry the fields that changed.
+type krakenOrderUpdate struct {
+	Status   string `json:"status"`
+	VolExec  string `json:"vol_exec"`
+	Cost     string `json:"cost"`
+	Fee      string `json:"fee"`
+	AvgPrice string `json:"avg_price"`
+}
+
+// openOrderStream subscribes to order updates when WebSocket is set. It must be opened before an order is placed so
+// none of its updates are missed. Failures are logged and nil is returned, orders are then polled over REST.
+func (p *KrakenProvider) openOrderStream(ctx context.Context) *krakenOrderStream {
+	if !p.WebSocket {
+		return nil
+	}
+
+	s := &krakenOrderStream{p: p, updates: map[string]krakenOrderUpdate{}}
+	if err := s.connect(ctx); err != nil {
+		p.Logger.WarnContext(ctx, "failed to subscribe to order updates, falling back to polling", "err", err)
+		return nil
+	}
+	return s
+}
+
+// webSocketToken returns a token authenticating private WebSocket subscriptions.
+func (p *KrakenProvider) webSocketToken(ctx context.Context) (token string, err error) {
+	defer WrapErr(&err, "webSocketToken")
+
+	var result struct {
+		Token   string `json:"token"`
+		Expires int    `json:"expires"`
+	}
+	if err = p.privateRequest(ctx, "/0/private/GetWebSocketsToken", url.Values{}, &result); err != nil {
+		return "", fmt.Errorf("failed to get websocket token: %w", err)
+	}
+	return result.Token, nil
+}
+
+func (s *krakenOrderStream) connect(ctx context.Context) (err error) {
+	defer WrapErr(&err, "krakenOrderStream.connect")
+
+	token, err := s.p.webSocketToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	conn, err := dialWebSocket(ctx, s.p.WebSocketURL, krakenWSDialTimeout)
+	if err != nil {
+		return err
+	}
+
+	sub, _ := json.Marshal(map[string]any{
+		"event":        "subscribe",
+		"subscription": map[string]string{"name": "openOrders", "token": token},
+	})
+	if err = conn.WriteText(sub); err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("failed to subscribe to openOrders: %w", err)
+	}
+
+	// Pings keep the connection alive while waiting and closing the connection unblocks a read on cancellation.
+	stop := make(chan struct{})
+	go func() {
+		t := time.NewTicker(krakenWSPingInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				_ = conn.Close()
+				return
+			case <-stop:
+				return
+			case <-t.C:
+				_ = conn.Ping()
+			}
+		}
+	}()
+
+	s.conn, s.stop = conn, stop
+	s.p.Logger.InfoContext(ctx, "subscribed to order updates", "url", s.p.WebSocketURL)
+	return nil
+}
+
+// Close unsubscribes by closing the connection, it's safe to call on a nil stream.
+func (s *krakenOrderStream) Close() {
+	if s == nil || s.conn == nil {
+		return
+	}
+	close(s.stop)
+	_ = s.conn.Close()
+	s.conn = nil
+}
+
+// waitForFill reads order updates until the order identified by transactionID closes or timeout passes. A dropped
+// connection is reconnected once, the order is then queried over REST in case it closed while disconnected.
+func (s *krakenOrderStream) waitForFill(ctx context.Context, transactionID string, timeout time.Duration) (oi orderInfo, err error) {
+	defer WrapErr(&err, "krakenOrderStream.waitForFill")
+
+	deadline := time.Now().Add(timeout)
+	for {
+		if oi, ok, err := s.closed(ctx, transactionID); err != nil || ok {
+			return oi, err
+		} else if !time.Now().Before(deadline) {
+			return oi, errFillTimeout
+		}
+
+		readDeadline := time.Now().Add(krakenWSReadTimeout)
+		if deadline.Before(readDeadline) {
+			readDeadline = deadline
+		}
+		_ = s.conn.SetReadDeadline(readDeadline)
+		msg, err := s.conn.ReadMessage()
+		if err == nil {
+			if err = s.handle(msg); err != nil {
+				return oi, err
+			}
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return oi, ctx.Err()
+		} else if !time.Now().Before(deadline) {
+			return oi, errFillTimeout
+		} else if s.reconnected {
+			return oi, fmt.Errorf("order updates dropped again: %w", err)
+		}
+
+		s.p.Logger.WarnContext(ctx, "order updates dropped, reconnecting", "err", err)
+		s.reconnected = true
+		s.Close()
+		if err = s.connect(ctx); err != nil {
+			return oi, err
+		}
+
+		if oi, err = s.p.queryOrderInfo(ctx, transactionID); err == nil && oi.Status != "pending" && oi.Status != OrderStatusOpen {
+			return oi, nil
+		}
+	}
+}
+
+// handle merges the order updates of msg, other channels and events are ignored.
+func (s *krakenOrderStream) handle(msg []byte) error {
+	if len(msg) > 0 && msg[0] == '{' {
+		var event struct {
+			Event        string `json:"event"`
+			Status       string `json:"status"`
+			ErrorMessage string `json:"errorMessage"`
+		}
+		if err := json.Unmarshal(msg, &event); err != nil {
+			return fmt.Errorf("failed to decode event: %w", err)
+		} else if event.Event == "subscriptionStatus" && event.Status == "error" {
+			return fmt.Errorf("failed to subscribe to openOrders: %s", event.ErrorMessage)
+		}
+		return nil
+	}
+
+	// channel messages are [data, channel name, metadata]
+	var frame []json.RawMessage
+	var channel string
+	if err := json.Unmarshal(msg, &frame); err != nil {
+		return fmt.Errorf("failed to decode message: %w", err)
+	} else if len(frame) < 2 || json.Unmarshal(frame[1], &channel) != nil || channel != "openOrders" {
+		return nil
+	}
+
+	var orders []map[string]krakenOrderUpdate
+	if err := json.Unmarshal(frame[0], &orders); err != nil {
+		return fmt.Errorf("failed to decode order updates: %w", err)
+	}
+	for _, set := range orders {
+		for txid, u := range set {
+			cur := s.updates[txid]
+			for _, f := range []struct{ dst, src *string }{
+				{&cur.Status, &u.Status},
+				{&cur.VolExec, &u.VolExec},
+				{&cur.Cost, &u.Cost},
+				{&cur.Fee, &u.Fee},
+				{&cur.AvgPrice, &u.AvgPrice},
+			} {
+				if *f.src != "" {
+					*f.dst = *f.src
+				}
+			}
+			s.updates[txid] = cur
+		}
+	}
+	return nil
+}
+
+// closed reports whether the order has closed, querying it over REST when the updates didn't carry its fills.
+func (s *krakenOrderStream) closed(ctx context.Context, transactionID string) (oi orderInfo, ok bool, err error) {
+	u := s.updates[transactionID]
+	switch u.Status {
+	case "closed", "canceled", "expired":
+	default:
+		return oi, false, nil
+	}
+
+	if u.VolExec == "" || u.Cost == "" || u.Fee == "" || u.AvgPrice == "" {
+		oi, err = s.p.queryOrderInfo(ctx, transactionID)
+		return oi, err == nil, err
+	}
+
+	oi.Status = u.Status
+	for _, f := range []struct {
+		name  string
+		value string
+		dst   *float64
+	}{
+		{"volume", u.VolExec, &oi.VolumePurchased},
+		{"cost", u.Cost, &oi.Cost},
+		{"fee", u.Fee, &oi.Fee},
+		{"price", u.AvgPrice, &oi.Price},
+	} {
+		if *f.dst, err = strconv.ParseFloat(f.value, 64); err != nil {
+			return oi, false, fmt.Errorf("failed to parse %s: %w", f.name, err)
+		}
+	}
+	oi.VolumeExecuted = oi.VolumePurchased
+	return oi, true, nil
+}
+
+// awaitFill fills in the execution details of res once the order closes on stream. Without a stream, or when the
+// stream fails, the order is queried over REST instead.
+func (p *KrakenProvider) awaitFill(ctx context.Context, stream *krakenOrderStream, res ExecuteOrderResponse) (ExecuteOrderResponse, error) {
+	if stream != nil {
+		oi, err := stream.waitForFill(ctx, res.TransactionID, p.fillTimeout(ctx))
+		if err == nil {
+			p.Logger.InfoContext(ctx, "order closed on the websocket", "response", oi)
+			return p.withFill(ctx, res, oi), nil
+		} else if ctx.Err() != nil {
+			return res, err
+		}
+		p.Logger.WarnContext(ctx, "falling back to polling the order", "err", err)
+	}
+	return p.populateOrderInfo(ctx, res)
+}
+
+// fillTimeout returns how long an order waits for its fill on the stream, FillTimeout bounded by the time left of the
+// run of ctx.
+func (p *KrakenProvider) fillTimeout(ctx context.Context) time.Duration {
+	// the fill budget has no floor
+	timeout, _ := stepTimeout(ctx, p.Logger, "fill", krakenFillBudget, p.FillTimeout)
+	return timeout
+}
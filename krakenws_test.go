@@ -0,0 +1,252 @@
+package dca_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+// webSocketTestServer is a WebSocket server which sends a scripted list of messages on every connection once the
+// client has subscribed. A nil script refuses the handshake and an empty one drops the connection.
+type webSocketTestServer struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	scripts       [][]string
+	subscriptions []string
+}
+
+func newWebSocketTestServer(t *testing.T, scripts ...[]string) *webSocketTestServer {
+	t.Helper()
+
+	s := &webSocketTestServer{scripts: scripts}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		var script []string
+		if len(s.scripts) > 0 {
+			script, s.scripts = s.scripts[0], s.scripts[1:]
+		}
+		s.mu.Unlock()
+
+		if script == nil {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("failed to hijack: %v", err)
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+		_ = rw.Flush()
+
+		sub, err := readClientFrame(rw.Reader)
+		if err != nil {
+			t.Errorf("failed to read subscription: %v", err)
+			return
+		}
+		s.mu.Lock()
+		s.subscriptions = append(s.subscriptions, string(sub))
+		s.mu.Unlock()
+
+		for _, msg := range script {
+			writeServerFrame(conn, msg)
+		}
+		if len(script) == 0 {
+			return
+		}
+
+		// keep the connection open until the client closes it
+		_, _ = io.Copy(io.Discard, rw)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// URL returns the ws:// address of the server.
+func (s *webSocketTestServer) URL() string {
+	return "ws" + strings.TrimPrefix(s.Server.URL, "http")
+}
+
+// Subscriptions returns the subscription messages received, one per connection.
+func (s *webSocketTestServer) Subscriptions() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscriptions
+}
+
+// readClientFrame reads a single masked client frame with a payload shorter than 64KiB.
+func readClientFrame(r *bufio.Reader) ([]byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	n := int(header[1] & 0x7F)
+	if n == 126 {
+		b := make([]byte, 2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		n = int(binary.BigEndian.Uint16(b))
+	}
+	mask := make([]byte, 4)
+	if _, err := io.ReadFull(r, mask); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return payload, nil
+}
+
+// writeServerFrame writes an unmasked text frame with a payload shorter than 64KiB.
+func writeServerFrame(w net.Conn, msg string) {
+	frame := []byte{0x81}
+	if len(msg) < 126 {
+		frame = append(frame, byte(len(msg)))
+	} else {
+		frame = binary.BigEndian.AppendUint16(append(frame, 126), uint16(len(msg)))
+	}
+	_, _ = w.Write(append(frame, msg...))
+}
+
+const (
+	wsSubscribed = `{"channelName":"openOrders","event":"subscriptionStatus","status":"subscribed","subscription":{"name":"openOrders"}}`
+	wsHeartbeat  = `{"event":"heartbeat"}`
+	wsPending    = `[[{"TXID-1":{"status":"pending","vol":"0.0001","descr":{"pair":"XBT/USD","type":"buy","ordertype":"market"}}}],"openOrders",{"sequence":1}]`
+	wsFilled     = `[[{"TXID-1":{"vol_exec":"0.0001","cost":"5.01","fee":"0.01","avg_price":"50100.0"}}],"openOrders",{"sequence":2}]`
+	wsClosed     = `[[{"TXID-1":{"status":"closed","lastupdated":"1714600000.1"}}],"openOrders",{"sequence":3}]`
+	// another order closing mustn't be mistaken for ours
+	wsOtherClosed = `[[{"TXID-9":{"status":"closed","vol_exec":"1","cost":"1","fee":"0","avg_price":"1"}}],"openOrders",{"sequence":1}]`
+)
+
+func TestKrakenProvider_ExecuteOrder_WebSocket(t *testing.T) {
+	tt := []struct {
+		scripts     [][]string
+		connections int
+		polled      bool
+		price       float64
+	}{
+		// the fill arrives on the socket so the order is never polled
+		{[][]string{{wsSubscribed, wsHeartbeat, wsOtherClosed, wsPending, wsFilled, wsClosed}}, 1, false, 50100},
+		// the socket drops, is reconnected and the order is checked over REST in case the close was missed
+		{[][]string{{}, {wsSubscribed, wsHeartbeat}}, 2, true, 50000},
+		// the reconnect fails so the order is polled
+		{[][]string{{}, nil}, 2, true, 50000},
+		// the subscription fails so the order is polled
+		{[][]string{{`{"event":"subscriptionStatus","status":"error","errorMessage":"EGeneral:Invalid arguments"}`}}, 1, true, 50000},
+		// the socket can't be opened so the order is polled
+		{[][]string{nil}, 1, true, 50000},
+	}
+	for i, tc := range tt {
+		ws := newWebSocketTestServer(t, tc.scripts...)
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus":        {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":              {tickerResponse},
+			"/0/private/GetWebSocketsToken": {`{"error":[],"result":{"token":"WS-TOKEN","expires":900}}`},
+			"/0/private/AddOrder":           {addOrderResponse},
+			"/0/private/QueryOrders":        {queryOrdersResponse},
+		})
+		p := newTestKrakenProvider(s, dca.KrakenProviderConfig{WebSocket: true, WebSocketURL: ws.URL(), FillTimeout: 5 * time.Second})
+
+		res, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500})
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+
+		if want, got := "closed", res.Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.price, res.Price; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.polled, len(s.Requests("/0/private/QueryOrders")) > 0; got != want {
+			t.Errorf("%d: want polled %v got %v", i, want, got)
+		}
+		if want, got := tc.connections, len(s.Requests("/0/private/GetWebSocketsToken")); got != want {
+			t.Errorf("%d: want %v connections got %v", i, want, got)
+		}
+		for _, sub := range ws.Subscriptions() {
+			if !strings.Contains(sub, `"name":"openOrders"`) || !strings.Contains(sub, `"token":"WS-TOKEN"`) {
+				t.Errorf("%d: unexpected subscription %s", i, sub)
+			}
+		}
+	}
+}
+
+func TestKrakenProvider_ExecuteOrder_WebSocketLimitOrder(t *testing.T) {
+	tt := []struct {
+		script   []string
+		expected string
+	}{
+		{[]string{wsSubscribed, wsPending, wsFilled, wsClosed}, "closed"},
+		// the order doesn't fill before the timeout so it's left open without polling
+		{[]string{wsSubscribed, wsPending}, dca.OrderStatusOpen},
+	}
+	for i, tc := range tt {
+		ws := newWebSocketTestServer(t, tc.script)
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus":        {`{"error":[],"result":{"status":"online"}}`},
+			"/0/private/GetWebSocketsToken": {`{"error":[],"result":{"token":"WS-TOKEN","expires":900}}`},
+			"/0/private/AddOrder":           {addOrderResponse},
+		})
+		p := newTestKrakenProvider(s, dca.KrakenProviderConfig{WebSocket: true, WebSocketURL: ws.URL(), FillTimeout: 200 * time.Millisecond})
+
+		res, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500, OrderType: dca.OrderTypeLimit, Price: 50000})
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		if want, got := tc.expected, res.Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := 0, len(s.Requests("/0/private/QueryOrders")); got != want {
+			t.Errorf("%d: want %v QueryOrders requests got %v", i, want, got)
+		}
+	}
+}
+
+func TestKrakenProvider_ExecuteOrder_WebSocketCancelled(t *testing.T) {
+	ws := newWebSocketTestServer(t, []string{wsSubscribed, wsPending})
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus":        {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":              {tickerResponse},
+		"/0/private/GetWebSocketsToken": {`{"error":[],"result":{"token":"WS-TOKEN","expires":900}}`},
+		"/0/private/AddOrder":           {addOrderResponse},
+		"/0/private/QueryOrders":        {queryOrdersResponse},
+	})
+	p := newTestKrakenProvider(s, dca.KrakenProviderConfig{WebSocket: true, WebSocketURL: ws.URL(), FillTimeout: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := p.ExecuteOrder(ctx, dca.ExecuteOrderRequest{AmountInCents: 500}); err == nil {
+		t.Fatalf("expected an error")
+	}
+	// the wait ends with the context rather than the fill timeout
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("want cancellation to end the wait, took %v", elapsed)
+	}
+}
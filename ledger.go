@@ -0,0 +1,169 @@
+package dca
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// krakenAssets translates Kraken's legacy asset codes, prefixed with X for crypto and Z for fiat, to their common
+// codes. Codes that aren't listed are already common.
+var krakenAssets = map[string]string{
+	"XXBT": "BTC",
+	"XBT":  "BTC",
+	"XETH": "ETH",
+	"XETC": "ETC",
+	"XLTC": "LTC",
+	"XXRP": "XRP",
+	"XXLM": "XLM",
+	"XXDG": "DOGE",
+	"XDG":  "DOGE",
+	"XXMR": "XMR",
+	"XZEC": "ZEC",
+	"XMLN": "MLN",
+	"XREP": "REP",
+	"ZUSD": "USD",
+	"ZEUR": "EUR",
+	"ZGBP": "GBP",
+	"ZCAD": "CAD",
+	"ZJPY": "JPY",
+	"ZAUD": "AUD",
+	"ZCHF": "CHF",
+}
+
+// NormalizeKrakenAsset returns the common code of a Kraken asset, e.g. BTC for XXBT. The suffix of staked and
+// opt-in rewards balances, e.g. XBT.M, is kept.
+func NormalizeKrakenAsset(asset string) string {
+	code, suffix, _ := strings.Cut(asset, ".")
+	if common, ok := krakenAssets[code]; ok {
+		code = common
+	}
+	if suffix != "" {
+		return code + "." + suffix
+	}
+	return code
+}
+
+// KrakenLedgerEntry is an entry of the account ledger, a change to the balance of an asset.
+type KrakenLedgerEntry struct {
+	ID string `json:"id"`
+	// RefID links the entries of the same trade, deposit or withdrawal.
+	RefID   string    `json:"refId"`
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Subtype string    `json:"subtype"`
+	// Asset is the normalized asset code, e.g. BTC rather than XXBT.
+	Asset   string  `json:"asset"`
+	Amount  float64 `json:"amount"`
+	Fee     float64 `json:"fee"`
+	Balance float64 `json:"balance"`
+}
+
+// krakenLedgerEntry is a ledger entry as returned by the Ledgers endpoint.
+type krakenLedgerEntry struct {
+	RefID   string  `json:"refid"`
+	Time    float64 `json:"time"`
+	Type    string  `json:"type"`
+	Subtype string  `json:"subtype"`
+	Asset   string  `json:"asset"`
+	Amount  string  `json:"amount"`
+	Fee     string  `json:"fee"`
+	Balance string  `json:"balance"`
+}
+
+// ListLedger returns the ledger entries from start up to end, oldest first, following every page of the Ledgers
+// endpoint. Entries are limited to types, e.g. trade, deposit, withdrawal or transfer, when any are given. Ledger
+// calls are among the most expensive private calls so long exports should be made with RateLimitWait set.
+func (p *KrakenProvider) ListLedger(ctx context.Context, start, end time.Time, types []string) (entries []KrakenLedgerEntry, err error) {
+	defer WrapErr(&err, "KrakenProvider.ListLedger")
+
+	// The endpoint filters a single type, several are filtered once fetched.
+	params := url.Values{"type": {"all"}}
+	if len(types) == 1 {
+		params.Set("type", types[0])
+	}
+	if !start.IsZero() {
+		params.Set("start", strconv.FormatInt(start.Unix(), 10))
+	}
+	if !end.IsZero() {
+		params.Set("end", strconv.FormatInt(end.Unix(), 10))
+	}
+
+	for offset, count := 0, 1; offset < count; {
+		params.Set("ofs", strconv.Itoa(offset))
+
+		var result struct {
+			Ledger map[string]krakenLedgerEntry `json:"ledger"`
+			Count  int                          `json:"count"`
+		}
+		if err = p.privateRequest(ctx, "/0/private/Ledgers", params, &result); err != nil {
+			return nil, fmt.Errorf("failed to fetch ledger at offset %d: %w", offset, err)
+		} else if len(result.Ledger) == 0 {
+			break
+		}
+		offset += len(result.Ledger)
+		count = result.Count
+
+		for id, e := range result.Ledger {
+			if len(types) > 1 && !slices.Contains(types, e.Type) {
+				continue
+			}
+
+			entry := KrakenLedgerEntry{
+				ID:      id,
+				RefID:   e.RefID,
+				Time:    time.Unix(0, int64(e.Time*float64(time.Second))).UTC(),
+				Type:    e.Type,
+				Subtype: e.Subtype,
+				Asset:   NormalizeKrakenAsset(e.Asset),
+			}
+			for _, f := range []struct {
+				name  string
+				value string
+				dst   *float64
+			}{
+				{"amount", e.Amount, &entry.Amount},
+				{"fee", e.Fee, &entry.Fee},
+				{"balance", e.Balance, &entry.Balance},
+			} {
+				if *f.dst, err = strconv.ParseFloat(f.value, 64); err != nil {
+					return nil, fmt.Errorf("failed to parse %s of ledger entry %s: %w", f.name, id, err)
+				}
+			}
+			entries = append(entries, entry)
+		}
+
+		p.Logger.InfoContext(ctx, "fetched ledger page", "offset", offset, "count", count)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, nil
+}
+
+// WriteLedgerCSV writes entries as CSV with a header row, times are written in loc and amounts formatted with money.
+func WriteLedgerCSV(w io.Writer, entries []KrakenLedgerEntry, loc *time.Location, money MoneyFormat) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"time", "id", "refid", "type", "subtype", "asset", "amount", "fee", "balance"})
+	for _, e := range entries {
+		_ = cw.Write([]string{
+			e.Time.In(loc).Format(time.RFC3339),
+			e.ID,
+			e.RefID,
+			e.Type,
+			e.Subtype,
+			e.Asset,
+			money.number(e.Amount, e.Asset),
+			money.number(e.Fee, e.Asset),
+			money.number(e.Balance, e.Asset),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,136 @@
+package dca_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+const (
+	ledgerPage1 = `{"error":[],"result":{"count":3,"ledger":{
+		"L-2":{"refid":"T-1","time":1714300100.5,"type":"trade","subtype":"","asset":"XXBT","amount":"0.0001000000","fee":"0.0000000000","balance":"0.0001000000"},
+		"L-1":{"refid":"T-1","time":1714300100.5,"type":"trade","subtype":"","asset":"ZUSD","amount":"-5.0000","fee":"0.0200","balance":"94.9800"}}}}`
+	ledgerPage2 = `{"error":[],"result":{"count":3,"ledger":{
+		"L-0":{"refid":"D-1","time":1714200000,"type":"deposit","subtype":"","asset":"ZUSD","amount":"100.0000","fee":"0.0000","balance":"100.0000"}}}}`
+)
+
+func TestKrakenProvider_ListLedger(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/private/Ledgers": {ledgerPage1, ledgerPage2},
+	})
+	p := newTestKrakenProvider(s, dca.KrakenProviderConfig{ReadOnly: true})
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries, err := p.ListLedger(context.Background(), start, end, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := s.Requests("/0/private/Ledgers")
+	if want, got := 2, len(requests); got != want {
+		t.Fatalf("want %v requests got %v", want, got)
+	}
+	for i, ofs := range []string{"0", "2"} {
+		for _, kv := range [][2]string{{"ofs", ofs}, {"start", "1704067200"}, {"end", "1735689600"}, {"type", "all"}} {
+			if want, got := kv[1], requests[i].Get(kv[0]); got != want {
+				t.Errorf("%d: want %s %v got %v", i, kv[0], want, got)
+			}
+		}
+	}
+
+	// oldest first with normalized assets
+	expected := []dca.KrakenLedgerEntry{
+		{ID: "L-0", RefID: "D-1", Time: time.Unix(1714200000, 0).UTC(), Type: "deposit", Asset: "USD", Amount: 100, Balance: 100},
+		{ID: "L-1", RefID: "T-1", Time: time.Unix(1714300100, 5e8).UTC(), Type: "trade", Asset: "USD", Amount: -5, Fee: 0.02, Balance: 94.98},
+		{ID: "L-2", RefID: "T-1", Time: time.Unix(1714300100, 5e8).UTC(), Type: "trade", Asset: "BTC", Amount: 0.0001, Balance: 0.0001},
+	}
+	if want, got := len(expected), len(entries); got != want {
+		t.Fatalf("want %v entries got %v", want, got)
+	}
+	// entries of the same time may come in any order
+	if entries[1].ID == "L-2" {
+		entries[1], entries[2] = entries[2], entries[1]
+	}
+	for i := range expected {
+		if want, got := expected[i], entries[i]; got != want {
+			t.Errorf("%d: want %+v got %+v", i, want, got)
+		}
+	}
+}
+
+func TestKrakenProvider_ListLedger_Types(t *testing.T) {
+	tt := []struct {
+		types     []string
+		queryType string
+		entries   int
+	}{
+		{nil, "all", 2},
+		// a single type is filtered by Kraken
+		{[]string{"trade"}, "trade", 2},
+		// several are filtered once fetched
+		{[]string{"deposit", "withdrawal"}, "all", 0},
+		{[]string{"trade", "transfer"}, "all", 2},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/private/Ledgers": {ledgerPage1, `{"error":[],"result":{"count":2,"ledger":{}}}`},
+		})
+		p := newTestKrakenProvider(s, dca.KrakenProviderConfig{})
+
+		entries, err := p.ListLedger(context.Background(), time.Time{}, time.Time{}, tc.types)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if want, got := tc.entries, len(entries); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.queryType, s.Requests("/0/private/Ledgers")[0].Get("type"); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestNormalizeKrakenAsset(t *testing.T) {
+	tt := []struct {
+		asset    string
+		expected string
+	}{
+		{"XXBT", "BTC"},
+		{"XBT.M", "BTC.M"},
+		{"ZUSD", "USD"},
+		{"XETH", "ETH"},
+		{"DOT", "DOT"},
+		{"USDC", "USDC"},
+	}
+	for i, tc := range tt {
+		if want, got := tc.expected, dca.NormalizeKrakenAsset(tc.asset); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestWriteLedgerCSV(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err = dca.WriteLedgerCSV(&b, []dca.KrakenLedgerEntry{
+		{ID: "L-1", RefID: "T-1", Time: time.Unix(1714300100, 0).UTC(), Type: "trade", Asset: "USD", Amount: -5, Fee: 0.02, Balance: 94.98},
+		{ID: "L-2", RefID: "T-1", Time: time.Unix(1714300100, 0).UTC(), Type: "trade", Asset: "BTC", Amount: 0.0001, Balance: 0.0005},
+	}, loc, dca.MoneyFormat{TrimTrailingZeros: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "time,id,refid,type,subtype,asset,amount,fee,balance\n" +
+		"2024-04-28T06:28:20-04:00,L-1,T-1,trade,,USD,-5.00,0.02,94.98\n" +
+		"2024-04-28T06:28:20-04:00,L-2,T-1,trade,,BTC,0.0001,0,0.0005\n"
+	if want, got := expected, b.String(); got != want {
+		t.Errorf("want %q got %q", want, got)
+	}
+}
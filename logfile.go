@@ -0,0 +1,240 @@
+package dca
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Defaults of LogFileConfig.
+const (
+	DefaultLogMaxSizeMB  = 10
+	DefaultLogMaxBackups = 3
+)
+
+// LogFileConfig routes logs to a file which is rotated by size.
+type LogFileConfig struct {
+	// Path is the file logs are appended to, rotated files get a .1, .2, ... suffix with .1 the newest
+	Path string `json:"path" desc:"The file logs are appended to" schema:"required"`
+	// MaxSizeMB is the size a file is rotated at, defaults to DefaultLogMaxSizeMB
+	MaxSizeMB int `json:"maxSizeMB" desc:"The size in megabytes the file is rotated at, defaults to 10"`
+	// MaxBackups is the number of rotated files kept, defaults to DefaultLogMaxBackups
+	MaxBackups int `json:"maxBackups" desc:"The number of rotated files kept, defaults to 3"`
+}
+
+// Validate checks the configuration is usable.
+func (c LogFileConfig) Validate() error {
+	if c.Path == "" {
+		return fieldErr("path", errors.New("logFile path is required"))
+	} else if c.MaxSizeMB < 0 {
+		return fieldErr("maxSizeMB", errors.New("logFile maxSizeMB cannot be negative"))
+	} else if c.MaxBackups < 0 {
+		return fieldErr("maxBackups", errors.New("logFile maxBackups cannot be negative"))
+	}
+	return nil
+}
+
+// RotatingFile is a writer appending to a file which is rotated once it would grow past MaxBytes, keeping MaxBackups
+// rotated files. It's safe for concurrent use.
+type RotatingFile struct {
+	Path       string
+	MaxBytes   int64
+	MaxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// OpenRotatingFile opens, or creates, the file at path for appending. The file is only readable by its owner since
+// logs include order details.
+func OpenRotatingFile(path string, maxBytes int64, maxBackups int) (*RotatingFile, error) {
+	r := &RotatingFile{Path: path, MaxBytes: maxBytes, MaxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := openAppend(r.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	// a single write larger than the limit still goes to a file of its own
+	if r.MaxBytes > 0 && r.size > 0 && r.size+int64(len(p)) > r.MaxBytes {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the rotated files up by one, dropping the oldest, and starts a new file.
+func (r *RotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	r.f = nil
+
+	backup := func(i int) string { return fmt.Sprintf("%s.%d", r.Path, i) }
+	if r.MaxBackups == 0 {
+		if err := os.Remove(r.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove log file: %w", err)
+		}
+	} else {
+		_ = os.Remove(backup(r.MaxBackups))
+		for i := r.MaxBackups - 1; i >= 1; i-- {
+			if err := os.Rename(backup(i), backup(i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to rotate log file: %w", err)
+			}
+		}
+		if err := os.Rename(r.Path, backup(1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to rotate log file: %w", err)
+		}
+	}
+	return r.open()
+}
+
+// Reopen closes and reopens the file at Path, so logs go to a new file once an external tool such as logrotate has
+// moved the old one.
+func (r *RotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f != nil {
+		if err := r.f.Close(); err != nil {
+			return fmt.Errorf("failed to close log file: %w", err)
+		}
+		r.f = nil
+	}
+	return r.open()
+}
+
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+// teeHandler sends records to every handler enabled for their level.
+type teeHandler []slog.Handler
+
+func (h teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h teeHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, handler := range h {
+		if handler.Enabled(ctx, record.Level) {
+			errs = append(errs, handler.Handle(ctx, record.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	tee := make(teeHandler, len(h))
+	for i, handler := range h {
+		tee[i] = handler.WithAttrs(attrs)
+	}
+	return tee
+}
+
+func (h teeHandler) WithGroup(name string) slog.Handler {
+	tee := make(teeHandler, len(h))
+	for i, handler := range h {
+		tee[i] = handler.WithGroup(name)
+	}
+	return tee
+}
+
+// useLogFile routes the app's logs to the file in cfg, warnings and errors are still written to stderr. SIGHUP
+// reopens the file until the app is closed.
+func (m *App) useLogFile(cfg LogFileConfig) error {
+	maxSizeMB, maxBackups := cfg.MaxSizeMB, cfg.MaxBackups
+	if maxSizeMB == 0 {
+		maxSizeMB = DefaultLogMaxSizeMB
+	}
+	if maxBackups == 0 {
+		maxBackups = DefaultLogMaxBackups
+	}
+
+	f, err := OpenRotatingFile(cfg.Path, int64(maxSizeMB)<<20, maxBackups)
+	if err != nil {
+		return err
+	}
+	_ = m.Close()
+	m.logFile = f
+	m.Logger = slog.New(teeHandler{
+		slog.NewJSONHandler(f, &slog.HandlerOptions{Level: &m.level}),
+		slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}),
+	})
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	m.stopLogFile = func() { signal.Stop(hangup); close(hangup) }
+	logger := m.Logger
+	go func() {
+		for range hangup {
+			if err := f.Reopen(); err != nil {
+				logger.Error("failed to reopen log file", "error", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Close releases the log file and audit log of the app, if any. Queued audit records are written first.
+func (m *App) Close() error {
+	var errs []error
+	if m.audit != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		errs = append(errs, m.audit.Close(ctx))
+		m.audit = nil
+	}
+	if m.logFile != nil {
+		m.stopLogFile()
+		errs = append(errs, m.logFile.Close())
+		m.logFile, m.stopLogFile = nil, nil
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,273 @@
+package dca_test
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/1gm/dca"
+)
+
+func TestRotatingFile_Write(t *testing.T) {
+	tt := []struct {
+		maxBackups int
+		writes     int
+		// files that exist after the writes, from the current file to the oldest backup
+		files []string
+		gone  []string
+	}{
+		{2, 1, []string{""}, []string{".1"}},
+		{2, 2, []string{"", ".1"}, []string{".2"}},
+		{2, 3, []string{"", ".1", ".2"}, []string{".3"}},
+		// the oldest backup is dropped
+		{2, 6, []string{"", ".1", ".2"}, []string{".3"}},
+		{0, 4, []string{""}, []string{".1"}},
+	}
+	for i, tc := range tt {
+		path := filepath.Join(t.TempDir(), "dca.log")
+		// each line fills a file so every write past the first rotates
+		line := strings.Repeat("x", 15) + "\n"
+		f, err := dca.OpenRotatingFile(path, 20, tc.maxBackups)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		for j := range tc.writes {
+			if _, err = f.Write([]byte(line)); err != nil {
+				t.Fatalf("%d: write %d: %v", i, j, err)
+			}
+		}
+		if err = f.Close(); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		for _, suffix := range tc.files {
+			info, err := os.Stat(path + suffix)
+			if err != nil {
+				t.Errorf("%d: %v", i, err)
+				continue
+			}
+			if want, got := int64(len(line)), info.Size(); got != want {
+				t.Errorf("%d: %s: want size %v got %v", i, suffix, want, got)
+			}
+			if want, got := os.FileMode(0600), info.Mode().Perm(); got != want {
+				t.Errorf("%d: %s: want mode %v got %v", i, suffix, want, got)
+			}
+		}
+		for _, suffix := range tc.gone {
+			if _, err := os.Stat(path + suffix); !os.IsNotExist(err) {
+				t.Errorf("%d: want %s removed got %v", i, suffix, err)
+			}
+		}
+	}
+}
+
+func TestRotatingFile_Write_Runs(t *testing.T) {
+	// every CLI run opens the file anew, the size written by the runs before counts towards the limit
+	path := filepath.Join(t.TempDir(), "dca.log")
+	line := strings.Repeat("x", 15) + "\n"
+	for i := range 3 {
+		f, err := dca.OpenRotatingFile(path, 20, 1)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if _, err = f.Write([]byte(line)); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if err = f.Close(); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+	}
+
+	for _, name := range []string{path, path + ".1"} {
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := line; string(got) != want {
+			t.Errorf("%s: want %q got %q", name, want, got)
+		}
+	}
+	if _, err := os.Stat(path + ".2"); !os.IsNotExist(err) {
+		t.Errorf("want the oldest run's file dropped got %v", err)
+	}
+}
+
+func TestRotatingFile_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dca.log")
+	f, err := dca.OpenRotatingFile(path, 1<<20, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err = f.Write([]byte("before\n")); err != nil {
+		t.Fatal(err)
+	}
+	// as logrotate would
+	moved := filepath.Join(dir, "dca.log.old")
+	if err = os.Rename(path, moved); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Write([]byte("after\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{moved: "before\n", path: "after\n"} {
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: want %q got %q", name, want, got)
+		}
+	}
+}
+
+func TestApp_LoadConfig_LogFile(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "dca.log")
+	configPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configPath, []byte(`{
+		"krakenApiKey": "key",
+		"krakenPrivateKey": "secret",
+		"orderAmountInCents": 500,
+		"logFile": {"path": "`+logPath+`", "maxSizeMB": 1}
+	}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	app := dca.NewApp()
+	if err := app.LoadConfig(context.Background(), configPath); err != nil {
+		t.Fatal(err)
+	}
+	app.Logger.Info("to the file")
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), `"msg":"to the file"`) {
+		t.Errorf("want the log line in the file got %q", got)
+	}
+
+	// logs written after closing are dropped rather than reopening the file
+	app.Logger.Info("after close")
+	if got, _ = os.ReadFile(logPath); strings.Contains(string(got), "after close") {
+		t.Errorf("want nothing written after close got %q", got)
+	}
+}
+
+func TestLogFileConfig_Validate(t *testing.T) {
+	tt := []struct {
+		cfg dca.LogFileConfig
+		err string
+	}{
+		{dca.LogFileConfig{Path: "dca.log"}, ""},
+		{dca.LogFileConfig{}, "logFile path is required"},
+		{dca.LogFileConfig{Path: "dca.log", MaxSizeMB: -1}, "logFile maxSizeMB cannot be negative"},
+		{dca.LogFileConfig{Path: "dca.log", MaxBackups: -1}, "logFile maxBackups cannot be negative"},
+	}
+	for i, tc := range tt {
+		err := tc.cfg.Validate()
+		if tc.err == "" && err != nil {
+			t.Errorf("%d: want no error got %v", i, err)
+		} else if tc.err != "" && (err == nil || err.Error() != tc.err) {
+			t.Errorf("%d: want %q got %v", i, tc.err, err)
+		}
+	}
+}
+
+// runWithLogFile runs an app logging to a file at level and returns the file's contents, cfg is appended to its
+// config.
+func runWithLogFile(t *testing.T, s *krakenTestServer, cfg string, level slog.Level) (string, error) {
+	t.Helper()
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "dca.log")
+	configPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configPath, []byte(`{
+		"krakenApiKey": "key",
+		"krakenPrivateKey": "secret",
+		"krakenBaseUrl": "`+s.URL+`",
+		"orderAmountInCents": 500,
+		"logFile": {"path": "`+logPath+`"}`+cfg+`
+	}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	app := dca.NewApp()
+	app.SetLogLevel(level)
+	if err := app.LoadConfig(context.Background(), configPath); err != nil {
+		t.Fatal(err)
+	}
+	runErr := app.Run(context.Background())
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(got), runErr
+}
+
+func TestApp_Run_LogLevel_ErrStack(t *testing.T) {
+	tt := []struct {
+		level slog.Level
+		stack bool
+	}{
+		{slog.LevelInfo, false},
+		{slog.LevelDebug, true},
+	}
+	for _, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		})
+		// as the programs do, stacks are only captured when they're logged
+		previous := dca.SetErrStackCapture(tc.level <= slog.LevelDebug)
+		// the run fails fetching the price
+		logs, err := runWithLogFile(t, s, "", tc.level)
+		dca.SetErrStackCapture(previous)
+		if err == nil {
+			t.Fatalf("%v: want the run to fail", tc.level)
+		}
+		if want, got := tc.stack, strings.Contains(logs, `"msg":"run error stack"`); got != want {
+			t.Errorf("%v: want %v got %v: %s", tc.level, want, got, logs)
+		}
+		if want, got := tc.stack, strings.Contains(logs, "dca.(*App).Run"); got != want {
+			t.Errorf("%v: want the stack %v got %v: %s", tc.level, want, got, logs)
+		}
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tt := []struct {
+		s     string
+		level slog.Level
+		err   bool
+	}{
+		{"", slog.LevelInfo, false},
+		{"debug", slog.LevelDebug, false},
+		{"WARN", slog.LevelWarn, false},
+		{"error", slog.LevelError, false},
+		{"verbose", 0, true},
+	}
+	for _, tc := range tt {
+		level, err := dca.ParseLogLevel(tc.s)
+		if want, got := tc.err, err != nil; got != want {
+			t.Errorf("%q: want error %v got %v", tc.s, want, err)
+		}
+		if err == nil && level != tc.level {
+			t.Errorf("%q: want %v got %v", tc.s, tc.level, level)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package dca
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decimals amounts are formatted with.
+const (
+	FiatDecimals   = 2
+	CryptoDecimals = 8
+)
+
+// MoneyFormat formats amounts the same way FormatCrypto and FormatAmount do, with the formatting options of a config,
+// see AppConfig.MoneyFormat. The zero value formats as they do.
+type MoneyFormat struct {
+	// TrimTrailingZeros trims the trailing zeros of crypto volumes, e.g. 0.0001 instead of 0.00010000. Fiat amounts
+	// always keep two decimals.
+	TrimTrailingZeros bool
+}
+
+// Crypto formats a volume of asset as FormatCrypto does, with its trailing zeros trimmed when TrimTrailingZeros is set.
+func (f MoneyFormat) Crypto(volume float64, asset string) string {
+	s := roundHalfEven(volume, CryptoDecimals)
+	if f.TrimTrailingZeros {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return withAsset(s, asset)
+}
+
+// Amount formats an amount of asset with FormatFiat or Crypto depending on the asset.
+func (f MoneyFormat) Amount(amount float64, asset string) string {
+	return withAsset(f.number(amount, asset), asset)
+}
+
+// number formats amount as Amount does without the asset.
+func (f MoneyFormat) number(amount float64, asset string) string {
+	if IsFiat(asset) {
+		return FormatFiat(amount, "")
+	}
+	return f.Crypto(amount, "")
+}
+
+// fiatAssets are the common codes of the fiat currencies Kraken trades, see NormalizeKrakenAsset.
+var fiatAssets = map[string]bool{"USD": true, "EUR": true, "GBP": true, "CAD": true, "JPY": true, "AUD": true, "CHF": true}
+
+// IsFiat reports whether asset, a common or Kraken code, is a fiat currency.
+func IsFiat(asset string) bool {
+	return fiatAssets[NormalizeKrakenAsset(asset)]
+}
+
+// FormatFiat formats an amount of currency with two decimals followed by the currency's common code, e.g. 25.00 USD.
+// Only the number is returned without a currency.
+func FormatFiat(amount float64, currency string) string {
+	return withAsset(roundHalfEven(amount, FiatDecimals), currency)
+}
+
+// FormatCents formats an amount in cents of currency as FormatFiat does, exactly.
+func FormatCents(cents int, currency string) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	s := sign + strconv.Itoa(cents/100) + "." + strconv.Itoa(cents%100/10) + strconv.Itoa(cents%10)
+	return withAsset(s, currency)
+}
+
+// FormatCrypto formats a volume of asset with eight decimals followed by the asset's common code, e.g.
+// 0.00010000 BTC. Only the number is returned without an asset. See MoneyFormat to trim the trailing zeros.
+func FormatCrypto(volume float64, asset string) string {
+	return MoneyFormat{}.Crypto(volume, asset)
+}
+
+// FormatAmount formats an amount of asset with FormatFiat or FormatCrypto depending on the asset.
+func FormatAmount(amount float64, asset string) string {
+	return MoneyFormat{}.Amount(amount, asset)
+}
+
+func withAsset(s, asset string) string {
+	if asset == "" {
+		return s
+	}
+	return s + " " + NormalizeKrakenAsset(asset)
+}
+
+// roundHalfEven formats v with decimals digits after the point, rounding half to even. v is taken as the shortest
+// decimal that parses to it, so 2.675 is a tie rounding to 2.68 even though the float is slightly below it.
+func roundHalfEven(v float64, decimals int) string {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(v, 'f', -1, 64))
+	if !ok {
+		// NaN and infinities
+		return strconv.FormatFloat(v, 'f', decimals, 64)
+	}
+
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	r.Mul(r, new(big.Rat).SetInt(scale))
+
+	neg := r.Sign() < 0
+	r.Abs(r)
+	q, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	// compare the remainder to half of the denominator
+	switch rem.Mul(rem, big.NewInt(2)).Cmp(r.Denom()) {
+	case 1:
+		q.Add(q, big.NewInt(1))
+	case 0:
+		if q.Bit(0) == 1 {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+
+	digits := q.String()
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	s := digits
+	if decimals > 0 {
+		s = digits[:len(digits)-decimals] + "." + digits[len(digits)-decimals:]
+	}
+	if neg && q.Sign() != 0 {
+		s = "-" + s
+	}
+	return s
+}
@@ -0,0 +1,121 @@
+package dca_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/1gm/dca"
+)
+
+func TestFormatFiat(t *testing.T) {
+	tt := []struct {
+		amount   float64
+		currency string
+		want     string
+	}{
+		{25, "", "25.00"},
+		{25, "USD", "25.00 USD"},
+		{25, "ZUSD", "25.00 USD"},
+		{0, "", "0.00"},
+		// ties round to the even digit
+		{0.125, "", "0.12"},
+		{0.135, "", "0.14"},
+		{0.375, "", "0.38"},
+		{2.665, "", "2.66"},
+		{2.675, "", "2.68"},
+		{2.5, "", "2.50"},
+		// just off a tie rounds to the nearest
+		{0.1251, "", "0.13"},
+		{0.1249, "", "0.12"},
+		{-0.125, "", "-0.12"},
+		{-0.135, "", "-0.14"},
+		// no negative zero
+		{-0.001, "", "0.00"},
+		{0.005, "", "0.00"},
+		{0.015, "", "0.02"},
+		{99.995, "EUR", "100.00 EUR"},
+		{123456789.125, "", "123456789.12"},
+		{math.Inf(1), "", "+Inf"},
+	}
+	for i, tc := range tt {
+		if want, got := tc.want, dca.FormatFiat(tc.amount, tc.currency); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestFormatCents(t *testing.T) {
+	tt := []struct {
+		cents    int
+		currency string
+		want     string
+	}{
+		{500, "", "5.00"},
+		{5, "", "0.05"},
+		{1050, "USD", "10.50 USD"},
+		{-5, "", "-0.05"},
+		{0, "", "0.00"},
+	}
+	for i, tc := range tt {
+		if want, got := tc.want, dca.FormatCents(tc.cents, tc.currency); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestFormatCrypto(t *testing.T) {
+	tt := []struct {
+		volume float64
+		asset  string
+		trim   bool
+		want   string
+	}{
+		{0.0001, "", false, "0.00010000"},
+		{0.0001, "XXBT", false, "0.00010000 BTC"},
+		{0.0001, "BTC", true, "0.0001 BTC"},
+		{1, "", true, "1"},
+		{0, "", true, "0"},
+		// ties at the eighth decimal round to the even digit
+		{0.000000125, "", false, "0.00000012"},
+		{0.000000135, "", false, "0.00000014"},
+		{0.000000005, "", false, "0.00000000"},
+		{0.000000015, "", false, "0.00000002"},
+		{-0.000000125, "", false, "-0.00000012"},
+		{0.123456785, "", true, "0.12345678"},
+	}
+	for i, tc := range tt {
+		if want, got := tc.want, (dca.MoneyFormat{TrimTrailingZeros: tc.trim}).Crypto(tc.volume, tc.asset); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if tc.trim {
+			continue
+		}
+		if want, got := tc.want, dca.FormatCrypto(tc.volume, tc.asset); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tt := []struct {
+		amount float64
+		asset  string
+		want   string
+	}{
+		{94.985, "ZUSD", "94.98 USD"},
+		{0.5, "EUR", "0.50 EUR"},
+		{0.5, "XXBT", "0.50000000 BTC"},
+		{0.5, "ETH", "0.50000000 ETH"},
+	}
+	for i, tc := range tt {
+		if want, got := tc.want, dca.FormatAmount(tc.amount, tc.asset); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+
+	// the trailing zeros of fiat amounts are kept
+	trimmed := dca.MoneyFormat{TrimTrailingZeros: true}
+	if want, got := "0.50 EUR 0.5 BTC", trimmed.Amount(0.5, "EUR")+" "+trimmed.Amount(0.5, "XXBT"); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
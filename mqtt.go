@@ -0,0 +1,331 @@
+package dca
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MQTTDefaultTopicPrefix is the default prefix of the topics published to by MQTTNotifier.
+const MQTTDefaultTopicPrefix = "dca"
+
+// mqttDefaultTimeout bounds connecting to the broker and publishing the results.
+const mqttDefaultTimeout = 5 * time.Second
+
+// MQTTConfig configures an MQTTNotifier.
+type MQTTConfig struct {
+	// BrokerURL is the address of the broker, e.g. tcp://localhost:1883 or, for TLS, mqtts://broker:8883
+	BrokerURL string `json:"brokerUrl" desc:"The address of the broker, e.g. tcp://localhost:1883 or mqtts://broker:8883" schema:"required"`
+	// TopicPrefix defaults to MQTTDefaultTopicPrefix
+	TopicPrefix string `json:"topicPrefix" desc:"The prefix of published topics, defaults to dca"`
+	Username    string `json:"username" desc:"The username to connect with"`
+	// Password may reference a secret, e.g. awsssme:///path/to/password
+	Password string `json:"password" desc:"The password to connect with, may reference a secret"`
+	// QoS is the quality of service of published messages, either 0 or 1
+	QoS byte `json:"qos" desc:"The quality of service of published messages" enum:"0,1"`
+	// ClientID defaults to dca-<pid>
+	ClientID string `json:"clientId" desc:"The client identifier, defaults to dca-<pid>"`
+	// Pair is used in topics when a run has no order to take the pair from
+	Pair string `json:"-"`
+	// Timeout bounds the whole exchange with the broker, defaults to 5 seconds
+	Timeout time.Duration `json:"-"`
+}
+
+// Validate checks the configuration is usable.
+func (c MQTTConfig) Validate() error {
+	u, err := url.Parse(c.BrokerURL)
+	if err != nil {
+		return fieldErr("brokerUrl", fmt.Errorf("invalid mqtt brokerUrl: %w", err))
+	}
+
+	switch u.Scheme {
+	case "tcp", "mqtt", "ssl", "tls", "mqtts":
+	default:
+		return fieldErr("brokerUrl", fmt.Errorf("mqtt brokerUrl scheme must be one of tcp, mqtt, ssl, tls or mqtts"))
+	}
+
+	if u.Host == "" {
+		return fieldErr("brokerUrl", errors.New("mqtt brokerUrl is missing a host"))
+	} else if c.QoS > 1 {
+		return fieldErr("qos", errors.New("mqtt qos must be 0 or 1"))
+	}
+	return nil
+}
+
+// MQTTNotifier publishes the run summary to <prefix>/<pair>/result, the one-line receipt to <prefix>/<pair>/receipt
+// and the purchase price to <prefix>/<pair>/price as retained messages.
+type MQTTNotifier struct {
+	Config MQTTConfig
+	// Receipts renders the receipt, defaults to the embedded templates.
+	Receipts *ReceiptRenderer
+}
+
+// NewMQTTNotifier creates a notifier publishing to the broker in cfg.
+func NewMQTTNotifier(cfg MQTTConfig) *MQTTNotifier {
+	if cfg.TopicPrefix == "" {
+		cfg.TopicPrefix = MQTTDefaultTopicPrefix
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = mqttDefaultTimeout
+	}
+	return &MQTTNotifier{Config: cfg, Receipts: defaultReceiptRenderer}
+}
+
+func (n *MQTTNotifier) Notify(ctx context.Context, summary RunSummary) (err error) {
+	defer WrapErr(&err, "MQTTNotifier.Notify")
+
+	pair := n.Config.Pair
+	if summary.Order != nil && summary.Order.Pair != "" {
+		pair = summary.Order.Pair
+	}
+	topic := strings.TrimSuffix(n.Config.TopicPrefix, "/") + "/" + pair
+
+	b, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("failed to marshal summary: %w", err)
+	}
+
+	receipt, err := n.Receipts.Render(summary)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, n.Config.Timeout)
+	defer cancel()
+
+	c, err := dialMQTT(ctx, n.Config)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	if err = c.publish(topic+"/result", b, n.Config.QoS, true); err != nil {
+		return err
+	}
+
+	if err = c.publish(topic+"/receipt", []byte(receipt.Line), n.Config.QoS, true); err != nil {
+		return err
+	}
+
+	if summary.Order != nil && summary.Order.Price > 0 {
+		price := strconv.FormatFloat(summary.Order.Price, 'f', -1, 64)
+		if err = c.publish(topic+"/price", []byte(price), n.Config.QoS, true); err != nil {
+			return err
+		}
+	}
+
+	return c.disconnect()
+}
+
+// Check connects to the broker and disconnects without publishing, so a wrong address or credentials are found before
+// a run orders.
+func (n *MQTTNotifier) Check(ctx context.Context) (err error) {
+	defer WrapErr(&err, "MQTTNotifier.Check")
+
+	ctx, cancel := context.WithTimeout(ctx, n.Config.Timeout)
+	defer cancel()
+
+	c, err := dialMQTT(ctx, n.Config)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	return c.disconnect()
+}
+
+// MQTT 3.1.1 control packet types.
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttPuback     = 4
+	mqttDisconnect = 14
+)
+
+// mqttClient is a minimal MQTT 3.1.1 client which can only publish.
+type mqttClient struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	packetID uint16
+}
+
+func dialMQTT(ctx context.Context, cfg MQTTConfig) (*mqttClient, error) {
+	u, err := url.Parse(cfg.BrokerURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker url: %w", err)
+	}
+
+	host := u.Host
+	secure := u.Scheme == "ssl" || u.Scheme == "tls" || u.Scheme == "mqtts"
+	if u.Port() == "" {
+		if secure {
+			host = net.JoinHostPort(u.Hostname(), "8883")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "1883")
+		}
+	}
+
+	var conn net.Conn
+	if secure {
+		d := &tls.Dialer{Config: &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}}
+		conn, err = d.DialContext(ctx, "tcp", host)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to broker: %w", err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	c := &mqttClient{conn: conn, r: bufio.NewReader(conn)}
+	if err = c.connect(cfg); err != nil {
+		c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *mqttClient) connect(cfg MQTTConfig) error {
+	clientID := cfg.ClientID
+	if clientID == "" {
+		clientID = "dca-" + strconv.Itoa(os.Getpid())
+	}
+
+	// clean session
+	flags := byte(0x02)
+	var payload []byte
+	payload = appendMQTTString(payload, clientID)
+	if cfg.Username != "" {
+		flags |= 0x80
+		payload = appendMQTTString(payload, cfg.Username)
+		if cfg.Password != "" {
+			flags |= 0x40
+			payload = appendMQTTString(payload, cfg.Password)
+		}
+	}
+
+	var body []byte
+	body = appendMQTTString(body, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, 60)
+	body = append(body, payload...)
+
+	if err := c.write(mqttConnect<<4, body); err != nil {
+		return fmt.Errorf("failed to send connect: %w", err)
+	}
+
+	typ, ack, err := c.read()
+	if err != nil {
+		return fmt.Errorf("failed to read connack: %w", err)
+	} else if typ != mqttConnack || len(ack) != 2 {
+		return fmt.Errorf("unexpected packet type %d waiting for connack", typ)
+	} else if ack[1] != 0 {
+		return fmt.Errorf("broker refused connection with return code %d", ack[1])
+	}
+	return nil
+}
+
+func (c *mqttClient) publish(topic string, payload []byte, qos byte, retain bool) error {
+	header := byte(mqttPublish<<4) | qos<<1
+	if retain {
+		header |= 0x01
+	}
+
+	body := appendMQTTString(nil, topic)
+	if qos > 0 {
+		c.packetID++
+		body = binary.BigEndian.AppendUint16(body, c.packetID)
+	}
+	body = append(body, payload...)
+
+	if err := c.write(header, body); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", topic, err)
+	} else if qos == 0 {
+		return nil
+	}
+
+	typ, ack, err := c.read()
+	if err != nil {
+		return fmt.Errorf("failed to read puback for %s: %w", topic, err)
+	} else if typ != mqttPuback || len(ack) != 2 || binary.BigEndian.Uint16(ack) != c.packetID {
+		return fmt.Errorf("unexpected packet type %d waiting for puback", typ)
+	}
+	return nil
+}
+
+func (c *mqttClient) disconnect() error {
+	return c.write(mqttDisconnect<<4, nil)
+}
+
+func (c *mqttClient) close() {
+	_ = c.conn.Close()
+}
+
+func (c *mqttClient) write(header byte, body []byte) error {
+	packet := []byte{header}
+	packet = appendMQTTLength(packet, len(body))
+	_, err := c.conn.Write(append(packet, body...))
+	return err
+}
+
+func (c *mqttClient) read() (typ byte, body []byte, err error) {
+	header, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+
+	body = make([]byte, length)
+	if _, err = io.ReadFull(c.r, body); err != nil {
+		return 0, nil, err
+	}
+	return header >> 4, body, nil
+}
+
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func appendMQTTLength(b []byte, n int) []byte {
+	for {
+		d := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			d |= 0x80
+		}
+		b = append(b, d)
+		if n == 0 {
+			return b
+		}
+	}
+}
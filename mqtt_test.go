@@ -0,0 +1,184 @@
+package dca_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+type mqttPacket struct {
+	typ   byte
+	flags byte
+	body  []byte
+}
+
+// mqttTestBroker accepts a single connection and records the packets it receives.
+func mqttTestBroker(t *testing.T, connackCode byte) (addr string, packets <-chan mqttPacket) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	ch := make(chan mqttPacket, 16)
+	go func() {
+		defer close(ch)
+
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		r := bufio.NewReader(conn)
+		for {
+			header, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+			length, multiplier := 0, 1
+			for {
+				b, _ := r.ReadByte()
+				length += int(b&0x7f) * multiplier
+				if b&0x80 == 0 {
+					break
+				}
+				multiplier *= 128
+			}
+			body := make([]byte, length)
+			if _, err = io.ReadFull(r, body); err != nil {
+				return
+			}
+
+			p := mqttPacket{typ: header >> 4, flags: header & 0x0f, body: body}
+			ch <- p
+
+			switch p.typ {
+			case 1:
+				_, _ = conn.Write([]byte{0x20, 0x02, 0x00, connackCode})
+			case 3:
+				if qos := (p.flags >> 1) & 0x03; qos == 1 {
+					topicLen := int(binary.BigEndian.Uint16(body))
+					_, _ = conn.Write(append([]byte{0x40, 0x02}, body[2+topicLen:4+topicLen]...))
+				}
+			}
+		}
+	}()
+
+	return l.Addr().String(), ch
+}
+
+func splitPublish(p mqttPacket) (topic string, payload []byte) {
+	n := int(binary.BigEndian.Uint16(p.body))
+	topic = string(p.body[2 : 2+n])
+	payload = p.body[2+n:]
+	if (p.flags>>1)&0x03 > 0 {
+		payload = payload[2:]
+	}
+	return topic, payload
+}
+
+func TestMQTTNotifier_Notify(t *testing.T) {
+	for _, qos := range []byte{0, 1} {
+		addr, packets := mqttTestBroker(t, 0)
+		n := dca.NewMQTTNotifier(dca.MQTTConfig{BrokerURL: "tcp://" + addr, Username: "user", Password: "pass", QoS: qos, Pair: "XBTUSD"})
+
+		summary := dca.RunSummary{Status: dca.RunStatusSuccess, Order: &dca.ExecuteOrderResponse{Pair: "XBTUSD", Price: 50000.5}}
+		if err := n.Notify(context.Background(), summary); err != nil {
+			t.Fatalf("qos %d: unexpected error: %v", qos, err)
+		}
+
+		var received []mqttPacket
+		for p := range packets {
+			received = append(received, p)
+		}
+		if want, got := 5, len(received); got != want {
+			t.Fatalf("qos %d: want %v packets got %v", qos, want, got)
+		}
+
+		// connect flags: username, password, clean session
+		if want, got := byte(0xc2), received[0].body[7]; got != want {
+			t.Errorf("qos %d: want connect flags %x got %x", qos, want, got)
+		}
+
+		topic, payload := splitPublish(received[1])
+		if want, got := "dca/XBTUSD/result", topic; got != want {
+			t.Errorf("qos %d: want %v got %v", qos, want, got)
+		}
+		var decoded dca.RunSummary
+		if err := json.Unmarshal(payload, &decoded); err != nil || decoded.Status != dca.RunStatusSuccess {
+			t.Errorf("qos %d: unexpected payload %s: %v", qos, payload, err)
+		}
+		if received[1].flags&0x01 == 0 {
+			t.Errorf("qos %d: expected a retained message", qos)
+		}
+
+		topic, payload = splitPublish(received[2])
+		if want, got := "dca/XBTUSD/receipt", topic; got != want {
+			t.Errorf("qos %d: want %v got %v", qos, want, got)
+		}
+		if want, got := "Bought 0.00000000 BTC for 0.00 at 50000.50", string(payload); got != want {
+			t.Errorf("qos %d: want %v got %v", qos, want, got)
+		}
+
+		topic, payload = splitPublish(received[3])
+		if want, got := "dca/XBTUSD/price", topic; got != want {
+			t.Errorf("qos %d: want %v got %v", qos, want, got)
+		}
+		if want, got := "50000.5", string(payload); got != want {
+			t.Errorf("qos %d: want %v got %v", qos, want, got)
+		}
+
+		if want, got := byte(14), received[4].typ; got != want {
+			t.Errorf("qos %d: want disconnect got %v", qos, got)
+		}
+	}
+}
+
+func TestMQTTNotifier_Notify_Failures(t *testing.T) {
+	addr, _ := mqttTestBroker(t, 5)
+	n := dca.NewMQTTNotifier(dca.MQTTConfig{BrokerURL: "tcp://" + addr, Pair: "XBTUSD"})
+	if err := n.Notify(context.Background(), dca.RunSummary{}); err == nil {
+		t.Error("expected an error for a refused connection")
+	}
+
+	// nothing listening, the notifier gives up within its timeout
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := l.Addr().String()
+	_ = l.Close()
+
+	n = dca.NewMQTTNotifier(dca.MQTTConfig{BrokerURL: "tcp://" + closed, Pair: "XBTUSD", Timeout: time.Second})
+	if err = n.Notify(context.Background(), dca.RunSummary{}); err == nil {
+		t.Error("expected an error when the broker is down")
+	}
+}
+
+func TestMQTTConfig_Validate(t *testing.T) {
+	tt := []struct {
+		cfg   dca.MQTTConfig
+		valid bool
+	}{
+		{dca.MQTTConfig{BrokerURL: "tcp://localhost:1883"}, true},
+		{dca.MQTTConfig{BrokerURL: "mqtts://broker.example.com", QoS: 1}, true},
+		{dca.MQTTConfig{BrokerURL: "http://localhost"}, false},
+		{dca.MQTTConfig{BrokerURL: "tcp://localhost", QoS: 2}, false},
+		{dca.MQTTConfig{BrokerURL: ""}, false},
+	}
+	for i, tc := range tt {
+		if want, got := tc.valid, tc.cfg.Validate() == nil; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
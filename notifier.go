@@ -0,0 +1,8 @@
+package dca
+
+import "context"
+
+// Notifier publishes the outcome of a run.
+type Notifier interface {
+	Notify(ctx context.Context, summary RunSummary) error
+}
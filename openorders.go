@@ -0,0 +1,93 @@
+package dca
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// OpenOrder is an order which hasn't closed yet, as returned by ListOpenOrders.
+type OpenOrder struct {
+	TransactionID string `json:"transactionId"`
+	UserRef       int    `json:"userRef"`
+	// Tagged is set when the order carries the provider's userref, i.e. it was placed by this tool.
+	Tagged    bool   `json:"tagged"`
+	Pair      string `json:"pair"`
+	Side      string `json:"side"`
+	OrderType string `json:"orderType"`
+	// Description is Kraken's description of the order, e.g. "buy 0.00010000 XBTUSD @ limit 45000.0".
+	Description    string    `json:"description"`
+	Status         string    `json:"status"`
+	Volume         float64   `json:"volume"`
+	VolumeExecuted float64   `json:"volumeExecuted"`
+	OpenedAt       time.Time `json:"openedAt"`
+}
+
+// ListOpenOrders returns every open order of the account, tagged or not, oldest first.
+func (p *KrakenProvider) ListOpenOrders(ctx context.Context) (orders []OpenOrder, err error) {
+	defer WrapErr(&err, "KrakenProvider.ListOpenOrders")
+
+	var result struct {
+		Open map[string]krakenOrder `json:"open"`
+	}
+	if err = p.privateRequest(ctx, "/0/private/OpenOrders", url.Values{}, &result); err != nil {
+		return nil, fmt.Errorf("failed to fetch open orders: %w", err)
+	}
+
+	for txid, o := range result.Open {
+		order := OpenOrder{
+			TransactionID: txid,
+			UserRef:       o.Userref,
+			Tagged:        o.Userref == p.UserRef,
+			Pair:          o.Descr.Pair,
+			Side:          o.Descr.Type,
+			OrderType:     o.Descr.Ordertype,
+			Description:   o.Descr.Order,
+			Status:        o.Status,
+			OpenedAt:      time.Unix(0, int64(o.Opentm*float64(time.Second))).UTC(),
+		}
+		if order.Volume, err = o.Vol.Float(); err != nil {
+			return nil, fmt.Errorf("failed to parse volume of order %s: %w", txid, err)
+		}
+		if o.VolExec != "" {
+			if order.VolumeExecuted, err = o.VolExec.Float(); err != nil {
+				return nil, fmt.Errorf("failed to parse executed volume of order %s: %w", txid, err)
+			}
+		}
+		orders = append(orders, order)
+	}
+
+	sort.Slice(orders, func(i, j int) bool { return orders[i].OpenedAt.Before(orders[j].OpenedAt) })
+	return orders, nil
+}
+
+// CancelOrder cancels the open order identified by transactionID.
+func (p *KrakenProvider) CancelOrder(ctx context.Context, transactionID string) (err error) {
+	defer WrapErr(&err, "KrakenProvider.CancelOrder")
+
+	p.Logger.InfoContext(ctx, "cancelling order", "transactionId", transactionID)
+
+	var result struct {
+		Count int `json:"count"`
+	}
+	if err = p.privateRequest(ctx, "/0/private/CancelOrder", url.Values{"txid": {transactionID}}, &result); err != nil {
+		return fmt.Errorf("failed to cancel order %s: %w", transactionID, err)
+	} else if result.Count == 0 {
+		return fmt.Errorf("order %s wasn't cancelled", transactionID)
+	}
+	return nil
+}
+
+// StaleOrders returns the tagged orders opened more than age before now. Untagged orders were placed by someone else
+// and are never stale.
+func StaleOrders(orders []OpenOrder, age time.Duration, now time.Time) []OpenOrder {
+	var stale []OpenOrder
+	for _, o := range orders {
+		if o.Tagged && now.Sub(o.OpenedAt) > age {
+			stale = append(stale, o)
+		}
+	}
+	return stale
+}
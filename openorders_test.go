@@ -0,0 +1,92 @@
+package dca_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+func TestKrakenProvider_ListOpenOrders(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/private/OpenOrders": {`{"error":[],"result":{"open":{` +
+			`"TXID-2":{"userref":0,"status":"open","opentm":1714600000.5,"vol":"1.0","vol_exec":"0.25","descr":{"pair":"ETHUSD","type":"sell","ordertype":"limit","order":"sell 1.00000000 ETHUSD @ limit 4000.0"}},` +
+			`"TXID-1":{"userref":3530,"status":"open","opentm":1714500000,"vol":"0.0001","vol_exec":"0.00000000","descr":{"pair":"XBTUSD","type":"buy","ordertype":"limit","order":"buy 0.00010000 XBTUSD @ limit 45000.0"}}}}}`},
+	})
+	p := newTestKrakenProvider(s, dca.KrakenProviderConfig{ReadOnly: true})
+
+	orders, err := p.ListOpenOrders(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	} else if want, got := 2, len(orders); got != want {
+		t.Fatalf("want %v orders got %v", want, got)
+	}
+
+	tt := []dca.OpenOrder{
+		{TransactionID: "TXID-1", UserRef: 3530, Tagged: true, Pair: "XBTUSD", Side: dca.SideBuy, OrderType: dca.OrderTypeLimit,
+			Description: "buy 0.00010000 XBTUSD @ limit 45000.0", Status: "open", Volume: 0.0001, OpenedAt: time.Unix(1714500000, 0).UTC()},
+		{TransactionID: "TXID-2", Pair: "ETHUSD", Side: dca.SideSell, OrderType: dca.OrderTypeLimit,
+			Description: "sell 1.00000000 ETHUSD @ limit 4000.0", Status: "open", Volume: 1, VolumeExecuted: 0.25, OpenedAt: time.Unix(1714600000, 5e8).UTC()},
+	}
+	for i, want := range tt {
+		if got := orders[i]; got != want {
+			t.Errorf("%d: want %+v got %+v", i, want, got)
+		}
+	}
+
+	// every order is listed, not only the bot's
+	if got := s.Requests("/0/private/OpenOrders")[0].Get("userref"); got != "" {
+		t.Errorf("want no userref filter got %v", got)
+	}
+}
+
+func TestKrakenProvider_CancelOrder(t *testing.T) {
+	tt := []struct {
+		response string
+		readOnly bool
+		expected bool
+	}{
+		{`{"error":[],"result":{"count":1}}`, false, true},
+		{`{"error":[],"result":{"count":0}}`, false, false},
+		{`{"error":["EOrder:Unknown order"]}`, false, false},
+		{`{"error":[],"result":{"count":1}}`, true, false},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{"/0/private/CancelOrder": {tc.response}})
+		p := newTestKrakenProvider(s, dca.KrakenProviderConfig{ReadOnly: tc.readOnly})
+
+		err := p.CancelOrder(context.Background(), "TXID-1")
+		if want, got := tc.expected, err == nil; got != want {
+			t.Errorf("%d: want success %v got %v", i, want, err)
+		}
+		if tc.readOnly {
+			if !errors.Is(err, dca.ErrReadOnlyMode) {
+				t.Errorf("%d: want %v got %v", i, dca.ErrReadOnlyMode, err)
+			}
+			continue
+		}
+		if want, got := "TXID-1", s.Requests("/0/private/CancelOrder")[0].Get("txid"); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestStaleOrders(t *testing.T) {
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	orders := []dca.OpenOrder{
+		{TransactionID: "TXID-1", Tagged: true, OpenedAt: now.Add(-48 * time.Hour)},
+		{TransactionID: "TXID-2", Tagged: true, OpenedAt: now.Add(-time.Hour)},
+		// orders placed by someone else are never cancelled
+		{TransactionID: "TXID-3", OpenedAt: now.Add(-48 * time.Hour)},
+	}
+
+	stale := dca.StaleOrders(orders, 24*time.Hour, now)
+	if want, got := 1, len(stale); got != want {
+		t.Fatalf("want %v stale orders got %v", want, got)
+	}
+	if want, got := "TXID-1", stale[0].TransactionID; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
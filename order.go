@@ -0,0 +1,97 @@
+package dca
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Order types.
+const (
+	// OrderTypeMarket buys at the best available price, it's the default order type.
+	OrderTypeMarket = "market"
+	// OrderTypeLimit buys at Price or better.
+	OrderTypeLimit = "limit"
+	// OrderTypeStopLossLimit places a limit order at Price2 once the market reaches the trigger Price.
+	OrderTypeStopLossLimit = "stop-loss-limit"
+	// OrderTypeTrailingStop places a market order once the market moves Offset against its best price, for buys
+	// that's a rise of Offset from the lowest price since the order was placed.
+	OrderTypeTrailingStop = "trailing-stop"
+)
+
+// OrderStatusOpen is the status of an order that was placed but hasn't been filled.
+const OrderStatusOpen = "open"
+
+// isConditionalOrderType reports whether orders of type t may stay open instead of filling immediately.
+func isConditionalOrderType(t string) bool {
+	return t != "" && t != OrderTypeMarket
+}
+
+// validateOrderParams checks order has exactly the parameters required by its order type.
+func validateOrderParams(order ExecuteOrderRequest) error {
+	var required, unexpected []string
+	check := func(name string, set, want bool) {
+		if want && !set {
+			required = append(required, name)
+		} else if !want && set {
+			unexpected = append(unexpected, name)
+		}
+	}
+
+	price, price2, offset := order.Price != 0, order.Price2 != 0, order.Offset != ""
+	switch order.OrderType {
+	case "", OrderTypeMarket:
+		check("price", price, false)
+		check("price2", price2, false)
+		check("offset", offset, false)
+	case OrderTypeLimit:
+		check("price", price, true)
+		check("price2", price2, false)
+		check("offset", offset, false)
+	case OrderTypeStopLossLimit:
+		check("price", price, true)
+		check("price2", price2, true)
+		check("offset", offset, false)
+	case OrderTypeTrailingStop:
+		check("price", price, false)
+		check("price2", price2, false)
+		check("offset", offset, true)
+	default:
+		return fmt.Errorf("unsupported order type %q", order.OrderType)
+	}
+
+	var errs []error
+	if len(required) > 0 {
+		errs = append(errs, fmt.Errorf("%s orders require %s", orderTypeName(order.OrderType), strings.Join(required, " and ")))
+	}
+	if len(unexpected) > 0 {
+		errs = append(errs, fmt.Errorf("%s orders don't take %s", orderTypeName(order.OrderType), strings.Join(unexpected, " or ")))
+	}
+	if order.Price < 0 || order.Price2 < 0 {
+		errs = append(errs, errors.New("order prices must be positive"))
+	}
+	if offset {
+		if _, _, err := parseOffset(order.Offset); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// orderTypeName returns the name of an order type, the empty order type is a market order.
+func orderTypeName(t string) string {
+	if t == "" {
+		return OrderTypeMarket
+	}
+	return t
+}
+
+// parseOffset parses a trailing offset, either an amount in the quote currency or a percentage such as "2.5%".
+func parseOffset(offset string) (value float64, percent bool, err error) {
+	trimmed, percent := strings.CutSuffix(offset, "%")
+	if value, err = strconv.ParseFloat(trimmed, 64); err != nil || value <= 0 {
+		return 0, false, fmt.Errorf("offset %q must be a positive amount or percentage", offset)
+	}
+	return value, percent, nil
+}
@@ -0,0 +1,73 @@
+package dca
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// amountParameterGuard is the Guard of orderAmountParameter, evaluated after the pause. It reads the parameter on
+// every run so the amount can be changed without redeploying, and adjusts the amount to its value. A parameter that
+// can't be read or holds an invalid amount is only a warning added to summary, the run orders orderAmountInCents.
+type amountParameterGuard struct {
+	m       *App
+	summary *RunSummary
+}
+
+func (g amountParameterGuard) Name() string {
+	return DecisionAmountParameter
+}
+
+func (g amountParameterGuard) Evaluate(ctx context.Context, in GuardInput) (GuardDecision, error) {
+	m, ref := g.m, g.m.Config.OrderAmountParameter
+	d := GuardDecision{Inputs: map[string]string{"parameter": ref, "configAmount": FormatCents(in.AmountInCents, "")}}
+
+	amount, err := g.read(ctx)
+	if err != nil {
+		m.Logger.WarnContext(ctx, "failed to read the order amount parameter, using the config", "parameter", ref, "error", err,
+			"amountInCents", in.AmountInCents, "source", "config")
+		g.summary.Warnings = append(g.summary.Warnings, fmt.Sprintf("order amount parameter %s ignored: %v", ref, err))
+		d.Inputs["error"] = err.Error()
+		d.Action, d.Reason = GuardAllow, fmt.Sprintf("parameter unusable → config amount %s", d.Inputs["configAmount"])
+		return d, nil
+	}
+
+	m.Logger.InfoContext(ctx, "read the order amount parameter", "parameter", ref, "amountInCents", amount, "source", "parameter")
+	d.Inputs["amount"] = FormatCents(amount, "")
+	d.Action, d.AmountInCents = GuardAdjust, amount
+	d.Reason = fmt.Sprintf("parameter %s overrides config amount %s → amount %s", ref, d.Inputs["configAmount"], d.Inputs["amount"])
+	return d, nil
+}
+
+// read returns the amount in cents held by the parameter, it must pass the validation of orderAmountInCents.
+func (g amountParameterGuard) read(ctx context.Context) (int, error) {
+	value, err := g.m.secretResolver()(ctx, g.m.Config.OrderAmountParameter)
+	if err != nil {
+		return 0, err
+	}
+	amount, err := strconv.Atoi(strings.TrimSpace(string(value)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q, want a whole number of cents", value)
+	}
+	return amount, g.m.Config.validateOrderAmount(amount)
+}
+
+// validateOrderAmount checks amount is positive and, with a budget, doesn't exceed the monthly budget.
+func (c AppConfig) validateOrderAmount(amount int) error {
+	if amount <= 0 {
+		return fmt.Errorf("amount %d must be positive", amount)
+	} else if c.Budget != nil && amount > c.Budget.MonthlyAmountInCents {
+		return fmt.Errorf("amount %s exceeds the monthly budget of %s", FormatCents(amount, ""), FormatCents(c.Budget.MonthlyAmountInCents, ""))
+	}
+	return nil
+}
+
+// validateOrderAmountParameter checks orderAmountParameter references a parameter.
+func (c AppConfig) validateOrderAmountParameter() error {
+	if c.OrderAmountParameter != "" && !HasAWSParamStorePrefix(c.OrderAmountParameter) {
+		return fieldErr("orderAmountParameter", errors.New("orderAmountParameter must reference a parameter, e.g. awsssm://dca/amount"))
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package dca_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/1gm/dca"
+)
+
+func TestApp_Run_OrderAmountParameter(t *testing.T) {
+	tt := []struct {
+		value   string
+		err     error
+		budget  bool
+		amount  int
+		outcome dca.DecisionOutcome
+		warning string
+	}{
+		// the parameter overrides the config
+		{"2500", nil, false, 2500, dca.DecisionAdjust, ""},
+		{" 2500\n", nil, false, 2500, dca.DecisionAdjust, ""},
+		// a missing or malformed parameter falls back to the config
+		{"", fmt.Errorf("%w: /dca/amount", dca.ErrParameterNotFound), false, 500, dca.DecisionProceed, "parameter not found"},
+		{"25.00", nil, false, 500, dca.DecisionProceed, "want a whole number of cents"},
+		{"-100", nil, false, 500, dca.DecisionProceed, "must be positive"},
+		{"0", nil, false, 500, dca.DecisionProceed, "must be positive"},
+		// the override can't exceed the monthly budget
+		{"200000", nil, true, 500, dca.DecisionProceed, "exceeds the monthly budget"},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		cfg := dca.AppConfig{OrderAmountParameter: "awsssm://dca/amount"}
+		if tc.budget {
+			// the budget's amount is paced from the order store, it falls back to the amount when the store is unreadable
+			cfg.Budget = &dca.BudgetConfig{MonthlyAmountInCents: 100000, RunsPerMonth: 1}
+			cfg.OrderStorePath = t.TempDir()
+		}
+		app, n := newTestApp(s, cfg)
+		var resolved string
+		app.SecretResolver = func(_ context.Context, ref string) ([]byte, error) {
+			resolved = ref
+			return []byte(tc.value), tc.err
+		}
+
+		if err := app.Run(context.Background()); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if want, got := "awsssm://dca/amount", resolved; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		summary := n.summaries[0]
+		if want, got := tc.amount, summary.Order.AmountInCents; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+
+		var d *dca.Decision
+		for j := range summary.Decisions {
+			if summary.Decisions[j].Name == dca.DecisionAmountParameter {
+				d = &summary.Decisions[j]
+			}
+		}
+		if d == nil {
+			t.Fatalf("%d: want the amount parameter decision got %v", i, summary.Decisions)
+		}
+		if want, got := tc.outcome, d.Outcome; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if tc.warning == "" {
+			if len(summary.Warnings) != 0 {
+				t.Errorf("%d: want no warnings got %v", i, summary.Warnings)
+			}
+			continue
+		}
+		if len(summary.Warnings) == 0 || !strings.Contains(summary.Warnings[0], tc.warning) {
+			t.Errorf("%d: want warning %q got %v", i, tc.warning, summary.Warnings)
+		}
+		if !strings.Contains(d.Narration, "config amount") {
+			t.Errorf("%d: want the config named as the source got %v", i, d)
+		}
+	}
+}
+
+func TestAppConfig_Validate_OrderAmountParameter(t *testing.T) {
+	for i, tc := range []struct {
+		parameter string
+		err       string
+	}{
+		{"", ""},
+		{"awsssm://dca/amount", ""},
+		{"2500", "orderAmountParameter must reference a parameter"},
+	} {
+		cfg := dca.AppConfig{KrakenAPIKey: "key", KrakenPrivateKey: "secret", OrderAmountInCents: 500, OrderAmountParameter: tc.parameter}
+		err := cfg.Validate()
+		if tc.err == "" && err != nil {
+			t.Errorf("%d: want no error got %v", i, err)
+		} else if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%d: want %q got %v", i, tc.err, err)
+		}
+	}
+}
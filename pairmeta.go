@@ -0,0 +1,370 @@
+package dca
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPairMetadataTTL is how long fetched pair metadata is used before it's fetched again.
+const DefaultPairMetadataTTL = 24 * time.Hour
+
+// PairMetadataConfig fetches the trading rules of the pair, such as the minimum order volume, from the AssetPairs
+// endpoint instead of using the minimums built into the provider.
+type PairMetadataConfig struct {
+	// Cache persists the metadata between cold starts: an awsssm:// parameter, an s3://bucket/key object or a local
+	// file. Without it the metadata is only kept in memory, which a warm Lambda container reuses.
+	Cache string `json:"cache" desc:"Where the metadata is persisted between cold starts, an awsssm:// parameter, an s3://bucket/key object or a local file"`
+	// TTL is how long the metadata is used before it's fetched again, defaults to DefaultPairMetadataTTL.
+	TTL string `json:"ttl" desc:"How long the metadata is used before it's fetched again, defaults to 24h"`
+}
+
+// Validate checks the configuration is usable.
+func (c PairMetadataConfig) Validate() error {
+	if c.TTL != "" {
+		if d, err := time.ParseDuration(c.TTL); err != nil {
+			return fieldErr("ttl", fmt.Errorf("invalid pairMetadata ttl: %w", err))
+		} else if d <= 0 {
+			return fieldErr("ttl", errors.New("pairMetadata ttl must be positive"))
+		}
+	}
+	if strings.HasPrefix(c.Cache, S3Prefix) {
+		if _, err := newS3PairMetadataStore(c.Cache); err != nil {
+			return fieldErr("cache", err)
+		}
+	}
+	return nil
+}
+
+func (c PairMetadataConfig) ttl() time.Duration {
+	// validated by LoadConfig
+	if d, err := time.ParseDuration(c.TTL); err == nil {
+		return d
+	}
+	return DefaultPairMetadataTTL
+}
+
+// KrakenPairMetadata is the trading rules of a pair published by the AssetPairs endpoint.
+type KrakenPairMetadata struct {
+	Pair         string    `json:"pair"`
+	OrderMin     string    `json:"orderMin"`
+	CostMin      string    `json:"costMin,omitempty"`
+	PairDecimals int       `json:"pairDecimals"`
+	LotDecimals  int       `json:"lotDecimals"`
+	FetchedAt    time.Time `json:"fetchedAt"`
+}
+
+// fresh reports whether the metadata was fetched less than ttl before now.
+func (md KrakenPairMetadata) fresh(now time.Time, ttl time.Duration) bool {
+	return md.OrderMin != "" && now.Sub(md.FetchedAt) < ttl
+}
+
+// GetPairMetadata fetches the trading rules of pair from the public AssetPairs endpoint.
+func (p *KrakenProvider) GetPairMetadata(ctx context.Context, pair string) (md KrakenPairMetadata, err error) {
+	defer WrapErr(&err, "KrakenProvider.GetPairMetadata")
+
+	var result map[string]struct {
+		OrderMin     string `json:"ordermin"`
+		CostMin      string `json:"costmin"`
+		PairDecimals int    `json:"pair_decimals"`
+		LotDecimals  int    `json:"lot_decimals"`
+	}
+	if err = p.publicRequest(ctx, "/0/public/AssetPairs", url.Values{"pair": {pair}}, &result); err != nil {
+		return md, err
+	}
+
+	entry, err := pairResult(result, pair)
+	if err != nil {
+		return md, fmt.Errorf("invalid asset pairs response: %w", err)
+	} else if entry.OrderMin == "" {
+		return md, errors.New("asset pairs response is missing ordermin")
+	}
+	return KrakenPairMetadata{
+		Pair:         pair,
+		OrderMin:     entry.OrderMin,
+		CostMin:      entry.CostMin,
+		PairDecimals: entry.PairDecimals,
+		LotDecimals:  entry.LotDecimals,
+		FetchedAt:    time.Now().UTC(),
+	}, nil
+}
+
+// orderMin returns the minimum order volume of pair, from the fetched metadata when it's for pair.
+func (p *KrakenProvider) orderMin(pair string) string {
+	if md := p.PairMetadata; md != nil && md.Pair == pair {
+		return md.OrderMin
+	}
+	return krakenPairs[pair].OrderMin
+}
+
+// PairMetadataCache keeps fetched pair metadata in memory. It's safe for concurrent use, share one between the apps
+// of a process, such as the invocations of a warm Lambda container, to skip fetching the metadata on every run.
+type PairMetadataCache struct {
+	mu    sync.Mutex
+	pairs map[string]KrakenPairMetadata
+}
+
+// NewPairMetadataCache returns an empty cache.
+func NewPairMetadataCache() *PairMetadataCache {
+	return &PairMetadataCache{pairs: map[string]KrakenPairMetadata{}}
+}
+
+func (c *PairMetadataCache) get(pair string) (KrakenPairMetadata, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	md, ok := c.pairs[pair]
+	return md, ok
+}
+
+func (c *PairMetadataCache) put(md KrakenPairMetadata) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pairs[md.Pair] = md
+}
+
+func (c *PairMetadataCache) remove(pair string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pairs, pair)
+}
+
+// PairMetadataStore persists a document of pair metadata keyed by pair between cold starts.
+type PairMetadataStore interface {
+	// Load returns the stored document, nil when nothing was stored yet.
+	Load(ctx context.Context) ([]byte, error)
+	Save(ctx context.Context, b []byte) error
+}
+
+// NewPairMetadataStore returns the store at location, an awsssm:// parameter, an s3://bucket/key object or a local
+// file.
+func NewPairMetadataStore(location string) (PairMetadataStore, error) {
+	switch {
+	case HasAWSParamStorePrefix(location):
+		region, name, err := ParseAWSParamStoreKey(location)
+		if err != nil {
+			return nil, err
+		}
+		return &SSMPairMetadataStore{Name: name, Region: region, Encrypted: HasAWSParamStoreEncryptedPrefix(location)}, nil
+	case strings.HasPrefix(location, S3Prefix):
+		return newS3PairMetadataStore(location)
+	default:
+		return &FilePairMetadataStore{Path: location}, nil
+	}
+}
+
+// FilePairMetadataStore is a PairMetadataStore keeping the document in a local file.
+type FilePairMetadataStore struct {
+	Path string
+}
+
+// Load returns nil when the file doesn't exist, a corrupt file is quarantined so the metadata is fetched afresh.
+func (s *FilePairMetadataStore) Load(_ context.Context) ([]byte, error) {
+	b, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err == nil && !json.Valid(b) {
+		if _, err = quarantine(s.Path); err != nil {
+			return nil, fmt.Errorf("failed to quarantine corrupt pair metadata: %w", err)
+		}
+		return nil, nil
+	}
+	return b, err
+}
+
+func (s *FilePairMetadataStore) Save(_ context.Context, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0700); err != nil {
+		return err
+	}
+	// replaced atomically so a concurrent run never reads a partial document
+	return writeFileAtomic(s.Path, b)
+}
+
+// S3PairMetadataStore is a PairMetadataStore keeping the document in an S3 object. Requests are signed with the
+// default AWS credentials.
+type S3PairMetadataStore struct {
+	S3Location
+	Key string
+}
+
+func newS3PairMetadataStore(location string) (*S3PairMetadataStore, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pairMetadata cache: %w", err)
+	} else if u.Host == "" {
+		return nil, errors.New("pairMetadata cache is missing an S3 bucket")
+	} else if strings.Trim(u.Path, "/") == "" {
+		return nil, errors.New("pairMetadata cache is missing an S3 key")
+	}
+	return &S3PairMetadataStore{S3Location: S3Location{Bucket: u.Host}, Key: strings.Trim(u.Path, "/")}, nil
+}
+
+func (s *S3PairMetadataStore) Load(ctx context.Context) ([]byte, error) {
+	b, err := s3Request(ctx, s.object(s.Key), "GET", nil)
+	if errors.Is(err, errS3NotFound) {
+		return nil, nil
+	}
+	return b, err
+}
+
+func (s *S3PairMetadataStore) Save(ctx context.Context, b []byte) error {
+	_, err := s3Request(ctx, s.object(s.Key), "PUT", b)
+	return err
+}
+
+// SSMPairMetadataStore is a PairMetadataStore keeping the document in a parameter of the AWS param store.
+type SSMPairMetadataStore struct {
+	Name string
+	// Region of the parameter, the default AWS configuration's region when empty.
+	Region    string
+	Encrypted bool
+}
+
+func (s *SSMPairMetadataStore) Load(ctx context.Context) ([]byte, error) {
+	ref := ParamStorePlaintextPrefix + s.Name
+	if s.Encrypted {
+		ref = ParamStoreEncryptedPrefix + s.Name
+	}
+	if s.Region != "" {
+		ref += "?region=" + s.Region
+	}
+	b, err := GetAWSParamStoreValue(ctx, ref)
+	if errors.Is(err, ErrParameterNotFound) {
+		return nil, nil
+	}
+	return b, err
+}
+
+func (s *SSMPairMetadataStore) Save(ctx context.Context, b []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	backend, err := registeredAWSBackend(ParamStorePlaintextPrefix + s.Name)
+	if err != nil {
+		return err
+	}
+	return backend.PutParameter(ctx, s.Region, s.Name, b, s.Encrypted)
+}
+
+// pairMetadataStore returns the configured store, nil when the metadata is only kept in memory.
+func (m *App) pairMetadataStore() PairMetadataStore {
+	cfg := m.Config.PairMetadata
+	if cfg == nil || cfg.Cache == "" {
+		return nil
+	}
+	// validated by LoadConfig
+	store, _ := NewPairMetadataStore(cfg.Cache)
+	if s3, ok := store.(*S3PairMetadataStore); ok {
+		s3.HTTPClient = m.httpClient()
+	}
+	return store
+}
+
+func (m *App) pairMetadataCache() *PairMetadataCache {
+	if m.PairMetadata == nil {
+		m.PairMetadata = NewPairMetadataCache()
+	}
+	return m.PairMetadata
+}
+
+// loadPairMetadata sets the metadata of pair on provider when pairMetadata is configured. Fresh metadata is taken from
+// memory, then from the persisted cache, and only fetched when neither has it. Metadata is an optimization, so
+// failures are logged and the stale metadata, or the provider's built-in minimums, are used instead.
+func (m *App) loadPairMetadata(ctx context.Context, provider *KrakenProvider, pair string) {
+	if m.Config.PairMetadata == nil {
+		return
+	}
+	now, ttl := time.Now(), m.Config.PairMetadata.ttl()
+	cache := m.pairMetadataCache()
+
+	md, ok := cache.get(pair)
+	if ok && md.fresh(now, ttl) {
+		provider.PairMetadata = &md
+		return
+	}
+
+	store := m.pairMetadataStore()
+	stored := m.readPairMetadata(ctx, store)
+	if md, ok := stored[pair]; ok && md.fresh(now, ttl) {
+		m.Logger.InfoContext(ctx, "using cached pair metadata", "pair", pair, "fetchedAt", md.FetchedAt)
+		cache.put(md)
+		provider.PairMetadata = &md
+		return
+	}
+
+	fetched, err := provider.GetPairMetadata(ctx, pair)
+	if err != nil {
+		m.Logger.WarnContext(ctx, "failed to fetch pair metadata", "pair", pair, "error", err)
+		if md, ok := stored[pair]; ok {
+			provider.PairMetadata = &md
+		}
+		return
+	}
+	m.Logger.InfoContext(ctx, "fetched pair metadata", "pair", pair, "orderMin", fetched.OrderMin)
+	cache.put(fetched)
+	provider.PairMetadata = &fetched
+
+	if store != nil {
+		if stored == nil {
+			stored = map[string]KrakenPairMetadata{}
+		}
+		stored[pair] = fetched
+		m.writePairMetadata(ctx, store, stored)
+	}
+}
+
+// invalidatePairMetadata drops the metadata of pair after Kraken rejected an order as too small, so the next run
+// fetches it again in case the minimum changed.
+func (m *App) invalidatePairMetadata(ctx context.Context, pair string) {
+	if m.Config.PairMetadata == nil {
+		return
+	}
+	m.Logger.InfoContext(ctx, "invalidating pair metadata after the order was too small", "pair", pair)
+	m.pairMetadataCache().remove(pair)
+
+	store := m.pairMetadataStore()
+	if stored := m.readPairMetadata(ctx, store); stored != nil {
+		if _, ok := stored[pair]; ok {
+			delete(stored, pair)
+			m.writePairMetadata(ctx, store, stored)
+		}
+	}
+}
+
+// readPairMetadata reads the persisted metadata, nil when there's none. A corrupt document is treated as empty and
+// replaced by the next fetch.
+func (m *App) readPairMetadata(ctx context.Context, store PairMetadataStore) map[string]KrakenPairMetadata {
+	if store == nil {
+		return nil
+	}
+	b, err := store.Load(ctx)
+	if err != nil {
+		m.Logger.WarnContext(ctx, "failed to load cached pair metadata", "error", err)
+		return nil
+	} else if b == nil {
+		return nil
+	}
+
+	var stored map[string]KrakenPairMetadata
+	if err = json.Unmarshal(b, &stored); err != nil {
+		m.Logger.WarnContext(ctx, "ignoring corrupt cached pair metadata", "error", err)
+		return nil
+	}
+	return stored
+}
+
+func (m *App) writePairMetadata(ctx context.Context, store PairMetadataStore, stored map[string]KrakenPairMetadata) {
+	b, err := json.Marshal(stored)
+	if err == nil {
+		err = store.Save(ctx, b)
+	}
+	if err != nil {
+		m.Logger.WarnContext(ctx, "failed to save cached pair metadata", "error", err)
+	}
+}
@@ -0,0 +1,177 @@
+package dca_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+const assetPairsResponse = `{"error":[],"result":{"XXBTZUSD":{"altname":"XBTUSD","ordermin":"0.00005","costmin":"0.5","pair_decimals":1,"lot_decimals":8,"status":"online"}}}`
+
+// writePairMetadata persists a cached document with the given minimum fetched at fetchedAt.
+func writePairMetadata(t *testing.T, path, orderMin string, fetchedAt time.Time) {
+	t.Helper()
+	b, err := json.Marshal(map[string]dca.KrakenPairMetadata{
+		"XBTUSD": {Pair: "XBTUSD", OrderMin: orderMin, PairDecimals: 1, LotDecimals: 8, FetchedAt: fetchedAt},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readPairMetadata(t *testing.T, path string) map[string]dca.KrakenPairMetadata {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored map[string]dca.KrakenPairMetadata
+	if err = json.Unmarshal(b, &stored); err != nil {
+		t.Fatal(err)
+	}
+	return stored
+}
+
+func TestApp_Run_PairMetadata(t *testing.T) {
+	tt := []struct {
+		// the cached document, a minimum fetched at the age, or corrupt contents
+		orderMin string
+		age      time.Duration
+		corrupt  bool
+		fetched  bool
+		expected dca.RunStatus
+	}{
+		// nothing cached
+		{"", 0, false, true, dca.RunStatusSuccess},
+		// a fresh minimum is used without fetching, 0.001 is above the 0.0001 ordered
+		{"0.001", time.Hour, false, false, dca.RunStatusFailed},
+		{"0.00005", time.Hour, false, false, dca.RunStatusSuccess},
+		// a stale minimum is fetched again
+		{"0.001", 25 * time.Hour, false, true, dca.RunStatusSuccess},
+		{"", 0, true, true, dca.RunStatusSuccess},
+	}
+	for i, tc := range tt {
+		path := filepath.Join(t.TempDir(), "pairs.json")
+		if tc.corrupt {
+			if err := os.WriteFile(path, []byte(`{"XBTUSD":`), 0600); err != nil {
+				t.Fatal(err)
+			}
+		} else if tc.orderMin != "" {
+			writePairMetadata(t, path, tc.orderMin, time.Now().Add(-tc.age))
+		}
+
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/AssetPairs":   {assetPairsResponse},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		app, n := newTestApp(s, dca.AppConfig{VolumeRounding: "0.00001", PairMetadata: &dca.PairMetadataConfig{Cache: path}})
+
+		err := app.Run(context.Background())
+		if want, got := tc.expected, n.summaries[0].Status; got != want {
+			t.Errorf("%d: want %v got %v: %v", i, want, got, err)
+		}
+		if want, got := tc.fetched, len(s.Requests("/0/public/AssetPairs")) > 0; got != want {
+			t.Errorf("%d: want fetched %v got %v", i, want, got)
+		}
+		if tc.expected == dca.RunStatusFailed && !errors.Is(err, dca.ErrOrderToSmall) {
+			t.Errorf("%d: want %v got %v", i, dca.ErrOrderToSmall, err)
+		}
+
+		stored := readPairMetadata(t, path)
+		if tc.fetched {
+			if md := stored["XBTUSD"]; md.OrderMin != "0.00005" || md.LotDecimals != 8 || time.Since(md.FetchedAt) > time.Minute {
+				t.Errorf("%d: want the fetched metadata cached got %+v", i, md)
+			}
+		}
+		// a rejected order drops the minimum so the next run fetches it
+		if _, ok := stored["XBTUSD"]; ok == (tc.expected == dca.RunStatusFailed) {
+			t.Errorf("%d: want cached %v got %v", i, tc.expected != dca.RunStatusFailed, ok)
+		}
+	}
+}
+
+func TestApp_Run_PairMetadataMemory(t *testing.T) {
+	// a warm container reuses the metadata across apps without a persisted cache
+	cache := dca.NewPairMetadataCache()
+	var fetches int
+	for i := range 2 {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/AssetPairs":   {assetPairsResponse},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		app, n := newTestApp(s, dca.AppConfig{PairMetadata: &dca.PairMetadataConfig{}})
+		app.PairMetadata = cache
+
+		if err := app.Run(context.Background()); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if want, got := dca.RunStatusSuccess, n.summaries[0].Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		fetches += len(s.Requests("/0/public/AssetPairs"))
+	}
+	if want, got := 1, fetches; got != want {
+		t.Errorf("want %v fetches got %v", want, got)
+	}
+}
+
+func TestApp_Run_PairMetadataRejected(t *testing.T) {
+	// Kraken raised the minimum since it was cached, the rejection still maps to ErrOrderToSmall
+	path := filepath.Join(t.TempDir(), "pairs.json")
+	writePairMetadata(t, path, "0.00005", time.Now())
+
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":       {tickerResponse},
+		"/0/private/AddOrder":    {`{"error":["EGeneral:Invalid arguments:volume minimum not met"]}`},
+	})
+	app, n := newTestApp(s, dca.AppConfig{PairMetadata: &dca.PairMetadataConfig{Cache: path}})
+
+	if err := app.Run(context.Background()); !errors.Is(err, dca.ErrOrderToSmall) {
+		t.Errorf("want %v got %v", dca.ErrOrderToSmall, err)
+	}
+	if want, got := dca.RunStatusFailed, n.summaries[0].Status; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if stored := readPairMetadata(t, path); len(stored) != 0 {
+		t.Errorf("want the metadata invalidated got %v", stored)
+	}
+}
+
+func TestPairMetadataConfig_Validate(t *testing.T) {
+	tt := []struct {
+		cfg dca.PairMetadataConfig
+		err string
+	}{
+		{dca.PairMetadataConfig{}, ""},
+		{dca.PairMetadataConfig{Cache: "s3://bucket/dca/pairs.json", TTL: "6h"}, ""},
+		{dca.PairMetadataConfig{Cache: "awsssm://dca/pairs"}, ""},
+		{dca.PairMetadataConfig{TTL: "soon"}, `invalid pairMetadata ttl: time: invalid duration "soon"`},
+		{dca.PairMetadataConfig{TTL: "-1h"}, "pairMetadata ttl must be positive"},
+		{dca.PairMetadataConfig{Cache: "s3:///pairs.json"}, "pairMetadata cache is missing an S3 bucket"},
+		{dca.PairMetadataConfig{Cache: "s3://bucket"}, "pairMetadata cache is missing an S3 key"},
+	}
+	for i, tc := range tt {
+		err := tc.cfg.Validate()
+		if tc.err == "" && err != nil {
+			t.Errorf("%d: want no error got %v", i, err)
+		} else if tc.err != "" && (err == nil || err.Error() != tc.err) {
+			t.Errorf("%d: want %q got %v", i, tc.err, err)
+		}
+	}
+}
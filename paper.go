@@ -0,0 +1,274 @@
+package dca
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Providers orders can be placed with.
+const (
+	// ProviderKraken places real orders on Kraken, it's the default provider.
+	ProviderKraken = "kraken"
+	// ProviderPaper simulates orders filled at the ticker price.
+	ProviderPaper = "paper"
+	// ProviderPaperRealistic simulates orders filled against Kraken's order book.
+	ProviderPaperRealistic = "paper-realistic"
+)
+
+// DefaultPaperFeeRate is the Kraken spot taker fee of the lowest volume tier.
+const DefaultPaperFeeRate = DefaultBacktestFeeRate
+
+// DefaultPaperDepthLevels is the number of order book levels walked by default, MaxPaperDepthLevels is the most
+// Kraken returns.
+const (
+	DefaultPaperDepthLevels = 100
+	MaxPaperDepthLevels     = 500
+)
+
+// OrderStatusPartial is the status of a simulated order the order book couldn't completely fill.
+const OrderStatusPartial = "partial"
+
+// PaperProviderConfig configures a PaperProvider.
+type PaperProviderConfig struct {
+	Logger *slog.Logger
+	// BaseURL overrides the Kraken REST API base URL, defaults to KrakenDefaultBaseURL.
+	BaseURL string
+	// Pair is the pair orders are simulated for when a request doesn't specify one, defaults to KrakenDefaultPair.
+	Pair string
+	// MaxResponseBytes limits the size of response bodies, defaults to DefaultMaxResponseBytes.
+	MaxResponseBytes int64
+	// FeeRate is the fraction of the cost charged as a fee, defaults to DefaultPaperFeeRate.
+	FeeRate float64
+	// Realistic fills orders by walking the order book instead of at the ticker price.
+	Realistic bool
+	// DepthLevels is the number of order book levels fetched when Realistic is set, defaults to
+	// DefaultPaperDepthLevels.
+	DepthLevels int
+	// ExtraHeaders are added to every market data request.
+	ExtraHeaders map[string]string
+	// Audit records every market data request when set.
+	Audit *AuditLog
+	// HTTPClient sends the market data requests instead of a client with ExtraHeaders and Audit.
+	HTTPClient *http.Client
+	// Faults are scripted failures of simulated orders for testing how runs handle them, see PaperFault.
+	Faults []PaperFault
+}
+
+// PaperFault is a scripted failure of a simulated order. The first fault matching a call to ExecuteOrder applies.
+// Simulated orders aren't placed anywhere, so an order lost between being placed and being queryable is played by
+// the fakekraken test server instead.
+type PaperFault struct {
+	// Call is the number of the ExecuteOrder call that fails, counted from 1, every call fails when it's zero.
+	Call int
+	// Err is returned by the call before anything is simulated, e.g. ErrRateLimited or ErrExchangeUnavailable. The
+	// call doesn't fail when it's nil, only Delay and FillRatio apply.
+	Err error
+	// Delay holds back the result of the call, or its error. A cancelled context ends the wait with its error.
+	Delay time.Duration
+	// FillRatio fills only this fraction of the order, between 0 and 1, leaving it with OrderStatusPartial.
+	FillRatio float64
+}
+
+// PaperProvider simulates market orders using Kraken's public market data, no orders are placed and no
+// credentials are needed.
+type PaperProvider struct {
+	Logger      *slog.Logger
+	FeeRate     float64
+	Realistic   bool
+	DepthLevels int
+	Faults      []PaperFault
+
+	market *KrakenProvider
+	mu     sync.Mutex
+	calls  int
+}
+
+// NewPaperProvider creates a PaperProvider from cfg.
+func NewPaperProvider(cfg *PaperProviderConfig) *PaperProvider {
+	feeRate := cfg.FeeRate
+	if feeRate == 0 {
+		feeRate = DefaultPaperFeeRate
+	}
+
+	depthLevels := cfg.DepthLevels
+	if depthLevels <= 0 {
+		depthLevels = DefaultPaperDepthLevels
+	}
+
+	return &PaperProvider{
+		Logger:      cfg.Logger.With("name", "paper.provider"),
+		FeeRate:     feeRate,
+		Realistic:   cfg.Realistic,
+		DepthLevels: depthLevels,
+		Faults:      cfg.Faults,
+		// orders are only simulated so the market data provider can never change the account
+		market: NewKrakenProvider(&KrakenProviderConfig{
+			Logger:           cfg.Logger,
+			BaseURL:          cfg.BaseURL,
+			Pair:             cfg.Pair,
+			MaxResponseBytes: cfg.MaxResponseBytes,
+			ReadOnly:         true,
+			ExtraHeaders:     cfg.ExtraHeaders,
+			Audit:            cfg.Audit,
+			HTTPClient:       cfg.HTTPClient,
+		}),
+	}
+}
+
+// ExecuteOrder simulates a market order. Orders are filled at the ask, or bid for sells, unless Realistic is set in
+// which case the order book is walked to find the volume weighted price of the available liquidity.
+func (p *PaperProvider) ExecuteOrder(ctx context.Context, order ExecuteOrderRequest) (res ExecuteOrderResponse, err error) {
+	defer WrapErr(&err, "PaperProvider.ExecuteOrder")
+
+	fault := p.fault()
+	if fault.Delay > 0 {
+		defer func() {
+			timer := time.NewTimer(fault.Delay)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				res, err = ExecuteOrderResponse{}, ctx.Err()
+			}
+		}()
+	}
+	if fault.Err != nil {
+		return res, fault.Err
+	}
+
+	if order, err = p.market.resolveOrder(order); err != nil {
+		return res, err
+	} else if order.OrderType != OrderTypeMarket {
+		return res, fmt.Errorf("paper orders must be market orders, got %q", order.OrderType)
+	}
+
+	var t ticker
+	if t, err = p.market.fetchTicker(ctx, order.Pair); err != nil {
+		return res, err
+	}
+	quote := t.Ask
+	if order.Side == SideSell {
+		quote = t.Bid
+	}
+
+	res = newResponse(order, OrderTypeMarket)
+	res.TransactionID = fmt.Sprintf("PAPER-%d", time.Now().UnixNano())
+	res.RequestedVolume = volumeForAmount(order.AmountInCents, quote)
+	res.Status = "closed"
+
+	if !p.Realistic {
+		res.VolumePurchased = res.RequestedVolume
+		res.Price = quote
+		res.Cost = res.VolumePurchased * quote
+	} else {
+		var levels []depthLevel
+		if levels, err = p.fetchDepth(ctx, order.Pair, order.Side); err != nil {
+			return res, err
+		}
+
+		var filled bool
+		res.VolumePurchased, res.Cost, filled = fillFromBook(levels, float64(order.AmountInCents)/100)
+		if res.VolumePurchased == 0 {
+			return res, errors.New("order book is empty")
+		}
+		res.Price = res.Cost / res.VolumePurchased
+		if !filled {
+			res.Status = OrderStatusPartial
+		}
+	}
+	if fault.FillRatio > 0 && fault.FillRatio < 1 {
+		res.VolumePurchased *= fault.FillRatio
+		res.Cost *= fault.FillRatio
+		res.Status = OrderStatusPartial
+	}
+	res.Fee = res.Cost * p.FeeRate
+	res.Slippage = newSlippage(res, quote)
+	res.AdditionalInfo = fmt.Sprintf("simulated %s %s %s @ %s", order.Side, FormatCrypto(res.VolumePurchased, ""), order.Pair, strconv.FormatFloat(res.Price, 'f', -1, 64))
+
+	p.Logger.InfoContext(ctx, "simulated order", "result", res, "realistic", p.Realistic)
+	return res, nil
+}
+
+// fault counts a call to ExecuteOrder and returns the first fault matching it, the zero PaperFault when none does.
+func (p *PaperProvider) fault() PaperFault {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls++
+	for _, f := range p.Faults {
+		if f.Call == 0 || f.Call == p.calls {
+			return f
+		}
+	}
+	return PaperFault{}
+}
+
+// depthLevel is a price level of an order book.
+type depthLevel struct {
+	Price  float64
+	Volume float64
+}
+
+// fetchDepth fetches the side of the order book an order on side fills against, the asks for buys and the bids
+// for sells, best price first.
+func (p *PaperProvider) fetchDepth(ctx context.Context, pair, side string) (levels []depthLevel, err error) {
+	defer WrapErr(&err, "fetchDepth")
+
+	var result map[string]struct {
+		Asks [][]any `json:"asks"`
+		Bids [][]any `json:"bids"`
+	}
+	query := url.Values{"pair": {pair}, "count": {strconv.Itoa(p.DepthLevels)}}
+	if err = p.market.publicRequest(ctx, "/0/public/Depth", query, &result); err != nil {
+		return nil, err
+	}
+
+	book, ok := result[krakenPairs[pair].ResultKey]
+	if !ok {
+		return nil, errors.New("depth response is missing the pair")
+	}
+
+	raw := book.Asks
+	if side == SideSell {
+		raw = book.Bids
+	}
+	for i, level := range raw {
+		if len(level) < 2 {
+			return nil, fmt.Errorf("depth level %d is malformed", i)
+		}
+		var l depthLevel
+		if l.Price, err = strconv.ParseFloat(fmt.Sprint(level[0]), 64); err != nil {
+			return nil, fmt.Errorf("failed to parse price of depth level %d: %w", i, err)
+		}
+		if l.Volume, err = strconv.ParseFloat(fmt.Sprint(level[1]), 64); err != nil {
+			return nil, fmt.Errorf("failed to parse volume of depth level %d: %w", i, err)
+		}
+		levels = append(levels, l)
+	}
+	return levels, nil
+}
+
+// fillFromBook walks levels spending amount of the quote currency, it returns the volume and cost filled and whether
+// the book had enough liquidity to fill the whole amount.
+func fillFromBook(levels []depthLevel, amount float64) (volume, cost float64, filled bool) {
+	remaining := amount
+	for _, level := range levels {
+		if levelCost := level.Price * level.Volume; levelCost < remaining {
+			volume += level.Volume
+			cost += levelCost
+			remaining -= levelCost
+			continue
+		}
+		volume += remaining / level.Price
+		cost += remaining
+		return volume, cost, true
+	}
+	return volume, cost, false
+}
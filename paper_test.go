@@ -0,0 +1,107 @@
+package dca_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math"
+	"testing"
+
+	"github.com/1gm/dca"
+)
+
+const depthResponse = `{"error":[],"result":{"XXBTZUSD":{
+	"asks":[["50000.0","0.001",1700000000],["50100.0","0.002",1700000000],["50500.0","0.010",1700000000]],
+	"bids":[["49990.0","0.001",1700000000],["49900.0","0.002",1700000000]]}}}`
+
+func newTestPaperProvider(s *krakenTestServer, cfg dca.PaperProviderConfig) *dca.PaperProvider {
+	cfg.BaseURL = s.URL
+	cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	return dca.NewPaperProvider(&cfg)
+}
+
+func TestPaperProvider_ExecuteOrder(t *testing.T) {
+	tt := []struct {
+		realistic bool
+		side      string
+		amount    int
+		status    string
+		volume    float64
+		price     float64
+		cost      float64
+	}{
+		// fills at the ask regardless of size
+		{false, dca.SideBuy, 20000, "closed", 0.004, 50000, 200},
+		// 50 fills at the first level, 100.2 at the second and the remaining 349.8 at the third
+		{true, dca.SideBuy, 50000, "closed", 0.003 + 349.8/50500, 500 / (0.003 + 349.8/50500), 500},
+		// small orders fill within the first level
+		{true, dca.SideBuy, 500, "closed", 0.0001, 50000, 5},
+		// the book runs out before the order is filled
+		{true, dca.SideSell, 100000, dca.OrderStatusPartial, 0.003, (49.99 + 99.8) / 0.003, 49.99 + 99.8},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/Ticker": {tickerResponse},
+			"/0/public/Depth":  {depthResponse},
+		})
+		p := newTestPaperProvider(s, dca.PaperProviderConfig{Realistic: tc.realistic, DepthLevels: 25})
+
+		res, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: tc.amount, Side: tc.side})
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+
+		if want, got := tc.status, res.Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if !approx(tc.volume, res.VolumePurchased) {
+			t.Errorf("%d: want volume %v got %v", i, tc.volume, res.VolumePurchased)
+		}
+		if !approx(tc.price, res.Price) {
+			t.Errorf("%d: want price %v got %v", i, tc.price, res.Price)
+		}
+		if !approx(tc.cost, res.Cost) {
+			t.Errorf("%d: want cost %v got %v", i, tc.cost, res.Cost)
+		}
+		if !approx(tc.cost*dca.DefaultPaperFeeRate, res.Fee) {
+			t.Errorf("%d: want fee %v got %v", i, tc.cost*dca.DefaultPaperFeeRate, res.Fee)
+		}
+
+		depth := s.Requests("/0/public/Depth")
+		if !tc.realistic {
+			if want, got := 0, len(depth); got != want {
+				t.Errorf("%d: want %v Depth requests got %v", i, want, got)
+			}
+		} else if want, got := "25", depth[0].Get("count"); got != want {
+			t.Errorf("%d: want count %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestApp_Run_Paper(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":       {tickerResponse},
+		"/0/public/Depth":        {depthResponse},
+	})
+
+	app, n := newTestApp(s, dca.AppConfig{Provider: dca.ProviderPaperRealistic, EarnAllocate: true, EarnStrategyID: "S-1"})
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want, got := dca.RunStatusSuccess, n.summaries[0].Status; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := 0.0001, n.summaries[0].Order.VolumePurchased; !approx(want, got) {
+		t.Errorf("want %v got %v", want, got)
+	}
+	// no private endpoints are called for paper orders
+	if want, got := 0, n.summaries[0].Kraken.Calls; got != want {
+		t.Errorf("want %v private calls got %v", want, got)
+	}
+}
+
+func approx(want, got float64) bool {
+	return math.Abs(want-got) < 1e-9*math.Max(1, math.Abs(want))
+}
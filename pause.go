@@ -0,0 +1,139 @@
+package dca
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PauseState is whether runs were paused when the run started, it's added to the run summary whenever a pause is
+// configured so resumed runs show it too.
+type PauseState struct {
+	Paused bool `json:"paused" desc:"Whether the run was skipped because runs are paused" schema:"required"`
+	// Until is when runs resume, nil when they're paused until unpaused.
+	Until *time.Time `json:"until,omitempty" desc:"When runs resume, absent when runs are paused until unpaused"`
+	// Parameter is the pauseParameter the state was read from, if any.
+	Parameter string `json:"parameter,omitempty" desc:"The parameter the pause was read from"`
+}
+
+// parsePausedUntil parses a time runs resume at, either an RFC 3339 time or a date resuming at the start of that day
+// in loc.
+func parsePausedUntil(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, s, loc); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, fmt.Errorf("%q is neither a date such as 2024-05-01 nor an RFC 3339 time", s)
+	}
+	return t, nil
+}
+
+// parsePause parses the value of a pause parameter: true or false, or the date or time runs are paused until. An
+// empty value isn't a pause.
+func parsePause(s string, loc *time.Location) (paused bool, until time.Time, err error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return false, until, nil
+	} else if paused, err = strconv.ParseBool(s); err == nil {
+		return paused, until, nil
+	}
+	until, err = parsePausedUntil(s, loc)
+	return err == nil, until, err
+}
+
+// configPause returns the pause set by paused and pausedUntil, pausedUntil only applies to a pause.
+func (c AppConfig) configPause(loc *time.Location) (paused bool, until time.Time) {
+	if c.Paused && c.PausedUntil != "" {
+		// validated by LoadConfig
+		until, _ = parsePausedUntil(c.PausedUntil, loc)
+	}
+	return c.Paused, until
+}
+
+// pauseGuard is the Guard of the pause, the first guard of every run. It skips the run with SkipReasonPaused when
+// runs are paused. The pause parameter, when set, is read on every run so a pause can be flipped without redeploying,
+// and overrides paused and pausedUntil. A parameter that can't be read is only a warning so a broken parameter doesn't
+// stop contributions. The pause state and the warning are added to summary.
+type pauseGuard struct {
+	m       *App
+	summary *RunSummary
+}
+
+func (g pauseGuard) Name() string {
+	return DecisionPause
+}
+
+func (g pauseGuard) Evaluate(ctx context.Context, in GuardInput) (GuardDecision, error) {
+	m, now := g.m, in.Now
+	paused, until := m.Config.configPause(now.Location())
+
+	state := &PauseState{}
+	if ref := m.Config.PauseParameter; ref != "" {
+		value, err := m.secretResolver()(ctx, ref)
+		if err == nil {
+			var parsed time.Time
+			if paused, parsed, err = parsePause(string(value), now.Location()); err == nil {
+				until, state.Parameter = parsed, ref
+			}
+		}
+		if err != nil {
+			m.Logger.WarnContext(ctx, "failed to read the pause parameter, using the config", "parameter", ref, "error", err)
+			g.summary.Warnings = append(g.summary.Warnings, fmt.Sprintf("pause parameter %s ignored: %v", ref, err))
+			paused, until = m.Config.configPause(now.Location())
+		}
+	}
+
+	if !paused && state.Parameter == "" {
+		return GuardDecision{}, nil
+	}
+	if !until.IsZero() {
+		until = until.In(now.Location())
+		state.Until = &until
+	}
+	// runs resume automatically once the pause has passed
+	state.Paused = paused && (until.IsZero() || now.Before(until))
+	g.summary.Pause = state
+
+	d := GuardDecision{Inputs: map[string]string{"paused": strconv.FormatBool(paused)}, Action: GuardAllow}
+	if state.Parameter != "" {
+		d.Inputs["parameter"] = state.Parameter
+	}
+	if state.Until != nil {
+		d.Inputs["until"] = state.Until.Format(time.RFC3339)
+	}
+	switch {
+	case state.Paused && state.Until != nil:
+		d.Action, d.Reason = GuardSkip, fmt.Sprintf("paused until %s → skip", d.Inputs["until"])
+	case state.Paused:
+		d.Action, d.Reason = GuardSkip, "paused → skip"
+	case paused:
+		d.Reason = fmt.Sprintf("pause until %s has passed → proceed", d.Inputs["until"])
+	default:
+		d.Reason = fmt.Sprintf("not paused by %s → proceed", state.Parameter)
+	}
+
+	if !state.Paused {
+		m.Logger.InfoContext(ctx, "the pause has passed, resuming", "until", until)
+		return d, nil
+	}
+	m.Logger.InfoContext(ctx, "runs are paused", "until", state.Until)
+	d.SkipReason = SkipReasonPaused
+	return d, nil
+}
+
+// validatePause checks the pause settings.
+func (c AppConfig) validatePause() error {
+	if c.PausedUntil != "" {
+		if _, err := parsePausedUntil(c.PausedUntil, c.Location()); err != nil {
+			return fieldErr("pausedUntil", fmt.Errorf("invalid pausedUntil: %w", err))
+		}
+	}
+	if c.PauseParameter != "" && !HasAWSParamStorePrefix(c.PauseParameter) {
+		return fieldErr("pauseParameter", errors.New("pauseParameter must reference a parameter, e.g. awsssm://dca/pause"))
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package dca_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/1gm/dca"
+)
+
+func TestApp_Run_Pause(t *testing.T) {
+	tt := []struct {
+		paused      bool
+		pausedUntil string
+		// the value of the pause parameter, an error when it can't be read
+		parameter    string
+		parameterErr error
+		expected     dca.RunStatus
+		// whether the summary holds a pause, and whether it's still paused
+		pause      bool
+		stillPause bool
+		until      string
+		warned     bool
+	}{
+		{false, "", "", nil, dca.RunStatusSuccess, false, false, "", false},
+		{true, "", "", nil, dca.RunStatusSkipped, true, true, "", false},
+		{true, "2999-01-01", "", nil, dca.RunStatusSkipped, true, true, "2999-01-01", false},
+		// runs resume once the pause has passed
+		{true, "2000-01-01", "", nil, dca.RunStatusSuccess, true, false, "2000-01-01", false},
+		// pausedUntil alone isn't a pause
+		{false, "2999-01-01", "", nil, dca.RunStatusSuccess, false, false, "", false},
+		// the parameter overrides the config
+		{false, "", "true", nil, dca.RunStatusSkipped, true, true, "", false},
+		{false, "", "2999-01-01", nil, dca.RunStatusSkipped, true, true, "2999-01-01", false},
+		{true, "", "false", nil, dca.RunStatusSuccess, true, false, "", false},
+		{false, "", "2000-01-01", nil, dca.RunStatusSuccess, true, false, "2000-01-01", false},
+		// a parameter that can't be read falls back to the config
+		{false, "", "", errors.New("throttled"), dca.RunStatusSuccess, false, false, "", true},
+		{true, "", "", errors.New("throttled"), dca.RunStatusSkipped, true, true, "", true},
+		{false, "", "soon", nil, dca.RunStatusSuccess, false, false, "", true},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		cfg := dca.AppConfig{Paused: tc.paused, PausedUntil: tc.pausedUntil}
+		if tc.parameter != "" || tc.parameterErr != nil {
+			cfg.PauseParameter = "awsssm://dca/pause"
+		}
+		app, n := newTestApp(s, cfg)
+		app.SecretResolver = func(_ context.Context, ref string) ([]byte, error) {
+			return []byte(tc.parameter), tc.parameterErr
+		}
+
+		if err := app.Run(context.Background()); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		summary := n.summaries[0]
+		if want, got := tc.expected, summary.Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.expected == dca.RunStatusSuccess, len(s.Requests("/0/private/AddOrder")) > 0; got != want {
+			t.Errorf("%d: want ordered %v got %v", i, want, got)
+		}
+		if tc.expected == dca.RunStatusSkipped {
+			if want, got := dca.SkipReasonPaused, summary.SkipReason; got != want {
+				t.Errorf("%d: want %v got %v", i, want, got)
+			}
+		}
+		if want, got := tc.warned, len(summary.Warnings) > 0 && strings.Contains(summary.Warnings[0], "pause parameter"); got != want {
+			t.Errorf("%d: want warned %v got %v", i, want, summary.Warnings)
+		}
+
+		if want, got := tc.pause, summary.Pause != nil; got != want {
+			t.Errorf("%d: want pause %v got %v", i, want, got)
+		}
+		if summary.Pause == nil {
+			continue
+		}
+		if want, got := tc.stillPause, summary.Pause.Paused; got != want {
+			t.Errorf("%d: want paused %v got %v", i, want, got)
+		}
+		var until string
+		if summary.Pause.Until != nil {
+			until = summary.Pause.Until.Format("2006-01-02")
+		}
+		if want, got := tc.until, until; got != want {
+			t.Errorf("%d: want until %q got %q", i, want, got)
+		}
+	}
+}
+
+func TestAppConfig_Validate_Pause(t *testing.T) {
+	tt := []struct {
+		cfg dca.AppConfig
+		err string
+	}{
+		{dca.AppConfig{Paused: true, PausedUntil: "2024-05-01"}, ""},
+		{dca.AppConfig{Paused: true, PausedUntil: "2024-05-01T09:00:00Z"}, ""},
+		{dca.AppConfig{Paused: true, PausedUntil: "May 1st"}, "invalid pausedUntil"},
+		{dca.AppConfig{PauseParameter: "awsssm://dca/pause"}, ""},
+		{dca.AppConfig{PauseParameter: "true"}, "pauseParameter must reference a parameter"},
+	}
+	for i, tc := range tt {
+		tc.cfg.KrakenAPIKey, tc.cfg.KrakenPrivateKey, tc.cfg.OrderAmountInCents = "key", "secret", 500
+		err := tc.cfg.Validate()
+		if tc.err == "" && err != nil {
+			t.Errorf("%d: want no error got %v", i, err)
+		} else if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%d: want %q got %v", i, tc.err, err)
+		}
+	}
+}
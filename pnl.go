@@ -0,0 +1,110 @@
+package dca
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// UnrealizedPnL is the unrealized profit or loss of the base asset held from recorded orders of a pair, valued at the
+// current price. Sells reduce the holding at its average cost.
+type UnrealizedPnL struct {
+	Pair string `json:"pair" desc:"The pair of the orders the holding was bought with" schema:"required"`
+	// Asset is the common code of the base asset of Pair, see PairAssets.
+	Asset string `json:"asset,omitempty" desc:"The common code of the base asset held, e.g. BTC"`
+	// Volume is the base asset bought by the recorded orders less what the recorded sells sold.
+	Volume float64 `json:"volume" desc:"The base asset held from the recorded orders" schema:"required"`
+	// CostBasis is what the held volume cost, fees included, at the average cost of the buys.
+	CostBasis float64 `json:"costBasis" desc:"What the held volume cost in the quote currency, fees included" schema:"required"`
+	Price     float64 `json:"price" desc:"The current bid the holding is valued at" schema:"required"`
+	Value     float64 `json:"value" desc:"The held volume valued at the current bid" schema:"required"`
+	Amount    float64 `json:"amount" desc:"The unrealized gain in the quote currency, negative for a loss" schema:"required"`
+	Percent   float64 `json:"percent" desc:"The unrealized gain as a percentage of the cost basis" schema:"required"`
+}
+
+// NewUnrealizedPnL values the holding of the records of pair at price, see holding for how it's counted. It returns
+// nil when price is unknown or nothing is held.
+func NewUnrealizedPnL(records []OrderRecord, pair string, price float64) *UnrealizedPnL {
+	if price <= 0 {
+		return nil
+	}
+
+	var matching []OrderRecord
+	for _, rec := range records {
+		if rec.Order.Pair == pair {
+			matching = append(matching, rec)
+		}
+	}
+	base, _ := PairAssets(pair)
+	pnl := UnrealizedPnL{Pair: pair, Asset: base, Price: price}
+	pnl.Volume, pnl.CostBasis = holding(matching)
+
+	if pnl.Volume <= 0 || pnl.CostBasis <= 0 {
+		return nil
+	}
+	pnl.Value = pnl.Volume * price
+	pnl.Amount = pnl.Value - pnl.CostBasis
+	pnl.Percent = pnl.Amount / pnl.CostBasis * 100
+	return &pnl
+}
+
+// holding returns the volume held from records and what it cost, fees included, records are ordered by time first. Buys
+// add their volume and their cost plus fee to the holding, sells remove their volume at the average cost of the
+// holding.
+func holding(records []OrderRecord) (volume, costBasis float64) {
+	records = append([]OrderRecord(nil), records...)
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+
+	for _, rec := range records {
+		o := rec.Order
+		if o.VolumePurchased <= 0 {
+			continue
+		}
+		if o.Side != SideSell {
+			volume += o.VolumePurchased
+			costBasis += o.Cost + o.Fee
+			continue
+		}
+		// selling more than the records hold, e.g. coins bought elsewhere, empties the holding
+		if o.VolumePurchased >= volume {
+			volume, costBasis = 0, 0
+			continue
+		}
+		costBasis -= costBasis / volume * o.VolumePurchased
+		volume -= o.VolumePurchased
+	}
+	return volume, costBasis
+}
+
+// reportUnrealizedPnL attaches the unrealized profit or loss of the recorded orders of pair to summary, valued at the
+// bid of the public ticker. The order was already placed so failures are only warnings.
+func (m *App) reportUnrealizedPnL(ctx context.Context, provider *KrakenProvider, pair string, records []OrderRecord, summary *RunSummary) {
+	t, err := provider.fetchTicker(ctx, pair)
+	if err != nil {
+		m.Logger.WarnContext(ctx, "failed to fetch the ticker for the unrealized P&L", "error", err)
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("unrealized P&L failed: %v", err))
+		return
+	}
+
+	if summary.UnrealizedPnL = NewUnrealizedPnL(records, pair, t.Bid); summary.UnrealizedPnL != nil {
+		m.Logger.InfoContext(ctx, "unrealized P&L", "volume", summary.UnrealizedPnL.Volume, "costBasis", summary.UnrealizedPnL.CostBasis,
+			"price", t.Bid, "amount", summary.UnrealizedPnL.Amount, "percent", summary.UnrealizedPnL.Percent)
+	}
+}
+
+// UnrealizedPnL values the holding of the recorded orders of the configured pair and label at the bid of the public
+// ticker, it makes no private call. It returns nil when nothing is held.
+func (m *App) UnrealizedPnL(ctx context.Context, records []OrderRecord) (_ *UnrealizedPnL, err error) {
+	defer WrapErr(&err, "App.UnrealizedPnL")
+
+	provider := m.newKrakenProvider()
+	order, err := provider.resolveOrder(m.Config.OrderRequest())
+	if err != nil {
+		return nil, err
+	}
+	t, err := provider.fetchTicker(ctx, order.Pair)
+	if err != nil {
+		return nil, err
+	}
+	return NewUnrealizedPnL(FilterOrderRecords(records, m.Config.Label), order.Pair, t.Bid), nil
+}
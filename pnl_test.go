@@ -0,0 +1,132 @@
+package dca_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+func TestNewUnrealizedPnL(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+	buy := func(d int, volume, cost, fee float64) dca.OrderRecord {
+		return dca.OrderRecord{Time: day(d), Order: dca.ExecuteOrderResponse{Pair: "XBTUSD", Side: dca.SideBuy, VolumePurchased: volume, Cost: cost, Fee: fee}}
+	}
+	sell := func(d int, volume float64) dca.OrderRecord {
+		return dca.OrderRecord{Time: day(d), Order: dca.ExecuteOrderResponse{Pair: "XBTUSD", Side: dca.SideSell, VolumePurchased: volume, Cost: volume * 80000}}
+	}
+
+	tt := []struct {
+		records  []dca.OrderRecord
+		price    float64
+		expected *dca.UnrealizedPnL
+	}{
+		// fees are part of the cost basis
+		{[]dca.OrderRecord{buy(1, 0.001, 40, 0.1), buy(2, 0.001, 60, 0.1)}, 50000,
+			&dca.UnrealizedPnL{Volume: 0.002, CostBasis: 100.2, Value: 100, Amount: -0.2, Percent: -0.2 / 100.2 * 100}},
+		// a sell keeps the average cost of what's left whatever it sold at
+		{[]dca.OrderRecord{buy(1, 0.001, 40, 0), buy(2, 0.001, 60, 0), sell(3, 0.001)}, 60000,
+			&dca.UnrealizedPnL{Volume: 0.001, CostBasis: 50, Value: 60, Amount: 10, Percent: 20}},
+		// records are ordered by time, the sell came after both buys
+		{[]dca.OrderRecord{sell(3, 0.001), buy(2, 0.001, 60, 0), buy(1, 0.001, 40, 0)}, 60000,
+			&dca.UnrealizedPnL{Volume: 0.001, CostBasis: 50, Value: 60, Amount: 10, Percent: 20}},
+		// a sell before a buy empties the holding instead of making it negative
+		{[]dca.OrderRecord{sell(1, 0.001), buy(2, 0.001, 40, 0)}, 50000,
+			&dca.UnrealizedPnL{Volume: 0.001, CostBasis: 40, Value: 50, Amount: 10, Percent: 25}},
+		// other pairs and unfilled orders aren't held
+		{[]dca.OrderRecord{
+			buy(1, 0.001, 40, 0),
+			{Time: day(2), Order: dca.ExecuteOrderResponse{Pair: "ETHUSD", Side: dca.SideBuy, VolumePurchased: 1, Cost: 3000}},
+			{Time: day(3), Order: dca.ExecuteOrderResponse{Pair: "XBTUSD", Side: dca.SideBuy, AmountInCents: 5000}},
+		}, 50000, &dca.UnrealizedPnL{Volume: 0.001, CostBasis: 40, Value: 50, Amount: 10, Percent: 25}},
+		// everything was sold
+		{[]dca.OrderRecord{buy(1, 0.001, 40, 0), sell(2, 0.001)}, 50000, nil},
+		{nil, 50000, nil},
+		// the price is unknown
+		{[]dca.OrderRecord{buy(1, 0.001, 40, 0)}, 0, nil},
+	}
+	for i, tc := range tt {
+		pnl := dca.NewUnrealizedPnL(tc.records, "XBTUSD", tc.price)
+		if tc.expected == nil {
+			if pnl != nil {
+				t.Errorf("%d: want no P&L got %+v", i, *pnl)
+			}
+			continue
+		} else if pnl == nil {
+			t.Fatalf("%d: want %+v got none", i, *tc.expected)
+		}
+
+		if want, got := tc.price, pnl.Price; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		for _, f := range []struct {
+			name      string
+			want, got float64
+		}{
+			{"volume", tc.expected.Volume, pnl.Volume},
+			{"cost basis", tc.expected.CostBasis, pnl.CostBasis},
+			{"value", tc.expected.Value, pnl.Value},
+			{"amount", tc.expected.Amount, pnl.Amount},
+			{"percent", tc.expected.Percent, pnl.Percent},
+		} {
+			if !approx(f.got, f.want) {
+				t.Errorf("%d: want %s %v got %v", i, f.name, f.want, f.got)
+			}
+		}
+	}
+}
+
+func TestApp_Run_UnrealizedPnL(t *testing.T) {
+	tt := []struct {
+		enabled bool
+	}{
+		{true},
+		{false},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+
+		storePath := filepath.Join(t.TempDir(), "orders.jsonl")
+		previous := dca.OrderRecord{
+			Time:  time.Now().Add(-24 * time.Hour),
+			Order: dca.ExecuteOrderResponse{Pair: "XBTUSD", Side: dca.SideBuy, VolumePurchased: 0.0001, Cost: 4, Fee: 0.01, Price: 40000},
+		}
+		if err := dca.NewFileOrderStore(storePath).Put(context.Background(), previous); err != nil {
+			t.Fatal(err)
+		}
+
+		app, n := newTestApp(s, dca.AppConfig{OrderStorePath: storePath, ReportUnrealizedPnL: tc.enabled})
+		if err := app.Run(context.Background()); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		summary := n.summaries[0]
+		if !tc.enabled {
+			if summary.UnrealizedPnL != nil {
+				t.Errorf("%d: want no P&L got %+v", i, *summary.UnrealizedPnL)
+			}
+			continue
+		} else if summary.UnrealizedPnL == nil {
+			t.Fatalf("%d: want a P&L got none (%v)", i, summary.Warnings)
+		}
+
+		// both purchases are valued at the bid of 49990
+		pnl := *summary.UnrealizedPnL
+		if want, got := 0.0002, pnl.Volume; !approx(got, want) {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := 9.03, pnl.CostBasis; !approx(got, want) {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := 0.0002*49990-9.03, pnl.Amount; !approx(got, want) {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package dca
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+)
+
+// PriceLadderTier is a band of prices and the amount a run orders when the price is in it. A tier starts above the
+// maxPrice of the tier before it and ends at its own maxPrice, inclusive.
+type PriceLadderTier struct {
+	// MaxPrice is the highest price of the tier, zero on the last tier to cover every higher price.
+	MaxPrice float64 `json:"maxPrice" desc:"The highest price of the tier, inclusive, omitted on the last tier to cover every higher price"`
+	// AmountInCents is the amount ordered when the price is in the tier.
+	AmountInCents int `json:"amountInCents" desc:"The amount to buy in cents when the price is in the tier" schema:"required"`
+}
+
+// PriceLadder selects the amount of a run by the current price from tiers ordered by maxPrice. The tiers start where
+// the previous one ends so a ladder has no gaps, and a price above the highest bounded tier is above the ladder.
+type PriceLadder []PriceLadderTier
+
+// Validate checks the tiers are ordered by strictly increasing maxPrice, so none overlap, and only the last tier is
+// unbounded.
+func (l PriceLadder) Validate() error {
+	for i, tier := range l {
+		switch {
+		case tier.AmountInCents <= 0:
+			return fmt.Errorf("priceLadder tier %d amountInCents must be positive", i+1)
+		case tier.MaxPrice < 0:
+			return fmt.Errorf("priceLadder tier %d maxPrice cannot be negative", i+1)
+		case tier.MaxPrice == 0 && i < len(l)-1:
+			return fmt.Errorf("priceLadder tier %d has no maxPrice and overlaps every tier after it, only the last tier can omit it", i+1)
+		case i > 0 && tier.MaxPrice != 0 && tier.MaxPrice <= l[i-1].MaxPrice:
+			return fmt.Errorf("priceLadder tier %d maxPrice %g overlaps tier %d up to %g, tiers must be ordered by increasing maxPrice", i+1, tier.MaxPrice, i, l[i-1].MaxPrice)
+		}
+	}
+	return nil
+}
+
+// Select returns the index of the tier price is in, a price equal to a tier's maxPrice is in that tier. ok is false
+// when price is above the highest tier and the last tier has a maxPrice.
+func (l PriceLadder) Select(price float64) (i int, ok bool) {
+	for i, tier := range l {
+		if tier.MaxPrice == 0 || price <= tier.MaxPrice {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// describe returns the band of prices of tier i for people, e.g. "50000.00 to 80000.00".
+func (l PriceLadder) describe(i int) string {
+	switch {
+	case l[i].MaxPrice == 0 && i == 0:
+		return "every price"
+	case l[i].MaxPrice == 0:
+		return "above " + FormatFiat(l[i-1].MaxPrice, "")
+	case i == 0:
+		return "up to " + FormatFiat(l[i].MaxPrice, "")
+	}
+	return FormatFiat(l[i-1].MaxPrice, "") + " to " + FormatFiat(l[i].MaxPrice, "")
+}
+
+// priceLadderGuard is the Guard of the price ladder, the first guard evaluated with the ticker. It adjusts the amount
+// to the tier of the ask, capped at maxInCents when it's positive, e.g. at the amount paced from the budget. It skips
+// the run with SkipReasonPriceAboveLadder when the ask is above the ladder.
+type priceLadderGuard struct {
+	ladder     PriceLadder
+	maxInCents int
+	logger     *slog.Logger
+}
+
+func (g priceLadderGuard) Name() string {
+	return DecisionPriceLadder
+}
+
+func (g priceLadderGuard) Evaluate(ctx context.Context, in GuardInput) (GuardDecision, error) {
+	ladder, price := g.ladder, in.Ticker.Ask
+	d := GuardDecision{Inputs: map[string]string{"price": FormatFiat(price, "")}}
+
+	i, ok := ladder.Select(price)
+	if !ok {
+		top := ladder[len(ladder)-1].MaxPrice
+		g.logger.WarnContext(ctx, "the price is above the price ladder", "price", price, "maxPrice", top)
+		d.Inputs["maxPrice"] = FormatFiat(top, "")
+		d.Action, d.SkipReason = GuardSkip, SkipReasonPriceAboveLadder
+		d.Reason = fmt.Sprintf("price %s above the highest tier up to %s → skip", d.Inputs["price"], d.Inputs["maxPrice"])
+		return d, nil
+	}
+
+	amount := ladder[i].AmountInCents
+	d.Inputs["tier"], d.Inputs["tierAmount"] = strconv.Itoa(i+1), FormatCents(amount, "")
+	d.Reason = fmt.Sprintf("price %s in tier %d (%s) → amount %s", d.Inputs["price"], i+1, ladder.describe(i), d.Inputs["tierAmount"])
+	if g.maxInCents > 0 && amount > g.maxInCents {
+		amount = g.maxInCents
+		d.Inputs["max"] = FormatCents(g.maxInCents, "")
+		d.Reason = fmt.Sprintf("price %s in tier %d (%s) → amount %s capped at %s", d.Inputs["price"], i+1, ladder.describe(i), d.Inputs["tierAmount"], d.Inputs["max"])
+	}
+	d.Action, d.AmountInCents = GuardAdjust, amount
+	g.logger.InfoContext(ctx, "selected the price ladder tier", "price", price, "tier", i+1, "maxPrice", ladder[i].MaxPrice,
+		"amountInCents", amount)
+	return d, nil
+}
@@ -0,0 +1,123 @@
+package dca_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/1gm/dca"
+)
+
+func TestPriceLadder_Select(t *testing.T) {
+	ladder := dca.PriceLadder{{MaxPrice: 80000, AmountInCents: 6000}, {MaxPrice: 100000, AmountInCents: 4000}, {AmountInCents: 2500}}
+	tt := []struct {
+		ladder dca.PriceLadder
+		price  float64
+		tier   int
+		ok     bool
+	}{
+		{ladder, 50000, 0, true},
+		// a price equal to a tier's maxPrice is in that tier
+		{ladder, 80000, 0, true},
+		{ladder, 80000.01, 1, true},
+		{ladder, 100000, 1, true},
+		// the unbounded last tier covers every higher price
+		{ladder, 250000, 2, true},
+		{ladder[:2], 100000.01, -1, false},
+		{dca.PriceLadder{{AmountInCents: 2500}}, 1, 0, true},
+	}
+	for i, tc := range tt {
+		tier, ok := tc.ladder.Select(tc.price)
+		if want, got := tc.ok, ok; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.tier, tier; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestPriceLadder_Validate(t *testing.T) {
+	tt := []struct {
+		ladder dca.PriceLadder
+		valid  bool
+	}{
+		{nil, true},
+		{dca.PriceLadder{{MaxPrice: 80000, AmountInCents: 6000}, {MaxPrice: 100000, AmountInCents: 4000}, {AmountInCents: 2500}}, true},
+		{dca.PriceLadder{{MaxPrice: 80000, AmountInCents: 6000}}, true},
+		// out of order and repeated maxPrices overlap
+		{dca.PriceLadder{{MaxPrice: 100000, AmountInCents: 4000}, {MaxPrice: 80000, AmountInCents: 6000}}, false},
+		{dca.PriceLadder{{MaxPrice: 80000, AmountInCents: 6000}, {MaxPrice: 80000, AmountInCents: 4000}}, false},
+		// only the last tier can be unbounded
+		{dca.PriceLadder{{AmountInCents: 2500}, {MaxPrice: 80000, AmountInCents: 6000}}, false},
+		{dca.PriceLadder{{MaxPrice: 80000}}, false},
+		{dca.PriceLadder{{MaxPrice: -1, AmountInCents: 6000}}, false},
+	}
+	for i, tc := range tt {
+		cfg := dca.AppConfig{KrakenAPIKey: "key", KrakenPrivateKey: "secret", OrderAmountInCents: 500, PriceLadder: tc.ladder}
+		if want, got := tc.valid, cfg.Validate() == nil; got != want {
+			t.Errorf("%d: want valid %v got %v", i, want, cfg.Validate())
+		}
+	}
+}
+
+func TestApp_Run_PriceLadder(t *testing.T) {
+	tt := []struct {
+		ladder    dca.PriceLadder
+		budget    *dca.BudgetConfig
+		status    dca.RunStatus
+		amount    int
+		narration string
+	}{
+		// the ask is 50000
+		{dca.PriceLadder{{MaxPrice: 40000, AmountInCents: 6000}, {MaxPrice: 60000, AmountInCents: 4000}, {AmountInCents: 2500}},
+			nil, dca.RunStatusSuccess, 4000, "price 50000.00 in tier 2 (40000.00 to 60000.00) → amount 40.00"},
+		{dca.PriceLadder{{MaxPrice: 40000, AmountInCents: 6000}, {AmountInCents: 2500}},
+			nil, dca.RunStatusSuccess, 2500, "price 50000.00 in tier 2 (above 40000.00) → amount 25.00"},
+		{dca.PriceLadder{{MaxPrice: 40000, AmountInCents: 6000}},
+			nil, dca.RunStatusSkipped, 0, "price 50000.00 above the highest tier up to 40000.00 → skip"},
+		// the budget's paced amount caps the tier's amount
+		{dca.PriceLadder{{AmountInCents: 100000}}, &dca.BudgetConfig{MonthlyAmountInCents: 1000, RunsPerMonth: 1},
+			dca.RunStatusSuccess, 1000, "price 50000.00 in tier 1 (every price) → amount 1000.00 capped at 10.00"},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		cfg := dca.AppConfig{PriceLadder: tc.ladder, Budget: tc.budget}
+		if tc.budget != nil {
+			cfg.OrderStorePath = filepath.Join(t.TempDir(), "orders.jsonl")
+		}
+		app, n := newTestApp(s, cfg)
+		_ = app.Run(context.Background())
+
+		summary := n.summaries[0]
+		if want, got := tc.status, summary.Status; got != want {
+			t.Fatalf("%d: want %v got %v (%s)", i, want, got, summary.Error)
+		}
+		if tc.status == dca.RunStatusSkipped {
+			if want, got := dca.SkipReasonPriceAboveLadder, summary.SkipReason; got != want {
+				t.Errorf("%d: want %v got %v", i, want, got)
+			}
+		} else if want, got := tc.amount, summary.Order.AmountInCents; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+
+		var narration string
+		for _, d := range summary.Decisions {
+			if d.Name == dca.DecisionPriceLadder {
+				narration = d.Narration
+			}
+		}
+		if want, got := tc.narration, narration; got != want {
+			t.Errorf("%d: want %q got %q", i, want, got)
+		}
+		// the laddered amount only applies to the run
+		if want, got := 500, app.Config.OrderAmountInCents; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package dca
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PriceLogConfig logs the ticker seen by every run to a JSON Lines file so the prices a schedule saw can be compared
+// with what it bought at.
+type PriceLogConfig struct {
+	// Path of the JSON Lines file samples are appended to.
+	Path string `json:"path" desc:"Path of the JSON Lines file price samples are appended to" schema:"required"`
+}
+
+// Validate checks the configuration is usable.
+func (c PriceLogConfig) Validate() error {
+	if c.Path == "" {
+		return fieldErr("path", errors.New("priceLog path is required"))
+	}
+	return nil
+}
+
+// PriceSample is a ticker snapshot written to the price log.
+type PriceSample struct {
+	Time time.Time `json:"time" desc:"When the ticker was fetched" schema:"required"`
+	Pair string    `json:"pair" desc:"The pair of the ticker" schema:"required"`
+	Ask  float64   `json:"ask" desc:"The lowest price a seller would accept" schema:"required"`
+	Bid  float64   `json:"bid" desc:"The highest price a buyer would pay" schema:"required"`
+	// Last is zero when the ticker didn't include the last trade.
+	Last   float64 `json:"last,omitempty" desc:"The price of the last trade"`
+	Spread float64 `json:"spread" desc:"The ask less the bid" schema:"required"`
+	// RunID is the run whose order was sized with the ticker.
+	RunID string `json:"runId,omitempty" desc:"The run which fetched the ticker"`
+}
+
+// newPriceSample returns the sample of the ticker t of pair fetched at now.
+func newPriceSample(now time.Time, pair string, t ticker) PriceSample {
+	return PriceSample{Time: now, Pair: pair, Ask: t.Ask, Bid: t.Bid, Last: t.Last, Spread: t.Ask - t.Bid}
+}
+
+// PriceLog appends price samples to a JSON Lines file.
+type PriceLog struct {
+	Path string
+}
+
+// NewPriceLog creates a PriceLog writing to the file at path, the file is created on the first Append.
+func NewPriceLog(path string) *PriceLog {
+	return &PriceLog{Path: path}
+}
+
+// Append writes sample as a single line, so a run stopped mid-write never leaves a partial record behind a complete
+// one.
+func (l *PriceLog) Append(sample PriceSample) (err error) {
+	defer WrapErr(&err, "PriceLog.Append")
+
+	b, err := json.Marshal(sample)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sample: %w", err)
+	}
+
+	return appendLine(l.Path, b)
+}
+
+// logRunPrice appends sample, the ticker the run's order was sized with, to the price log. It's written once the run
+// is over so it never delays the order, and failures are only warnings.
+func (m *App) logRunPrice(ctx context.Context, sample PriceSample, summary *RunSummary) {
+	sample.RunID = summary.RunID
+	if err := NewPriceLog(m.Config.PriceLog.Path).Append(sample); err != nil {
+		m.Logger.WarnContext(ctx, "failed to log the run's price", "error", err)
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("price log failed: %v", err))
+	}
+}
@@ -0,0 +1,76 @@
+package dca_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/1gm/dca"
+)
+
+// readPriceLog returns the samples of the price log at path.
+func readPriceLog(t *testing.T, path string) []dca.PriceSample {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var samples []dca.PriceSample
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var sample dca.PriceSample
+		if err = json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			t.Fatal(err)
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+func TestApp_Run_PriceLog(t *testing.T) {
+	for _, provider := range []string{"", dca.ProviderPaper} {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		path := filepath.Join(t.TempDir(), "prices.jsonl")
+		app, n := newTestApp(s, dca.AppConfig{Provider: provider, PriceLog: &dca.PriceLogConfig{Path: path}})
+		if err := app.Run(context.Background()); err != nil {
+			t.Fatalf("%s: %v", provider, err)
+		}
+
+		// the run logs the ticker its order was sized with
+		samples := readPriceLog(t, path)
+		if want, got := 1, len(samples); got != want {
+			t.Fatalf("%s: want %v got %v", provider, want, got)
+		}
+		expected := dca.PriceSample{Time: samples[0].Time, Pair: "XBTUSD", Ask: 50000, Bid: 49990, Last: 50000, Spread: 10, RunID: n.summaries[0].RunID}
+		if want, got := expected, samples[0]; got != want {
+			t.Errorf("%s: want %+v got %+v", provider, want, got)
+		}
+	}
+}
+
+func TestPriceLogConfig_Validate(t *testing.T) {
+	tt := []struct {
+		config dca.PriceLogConfig
+		valid  bool
+	}{
+		{dca.PriceLogConfig{Path: "prices.jsonl"}, true},
+		{dca.PriceLogConfig{}, false},
+	}
+	for i, tc := range tt {
+		if want, got := tc.valid, tc.config.Validate() == nil; got != want {
+			t.Errorf("%d: want valid %v got %v", i, want, tc.config.Validate())
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package dca
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PushgatewayDefaultJob is the default job label of the metrics pushed by PushgatewayNotifier.
+const PushgatewayDefaultJob = "dca"
+
+// pushgatewayDefaultTimeout bounds pushing the metrics.
+const pushgatewayDefaultTimeout = 5 * time.Second
+
+// pushgatewayLabelName matches valid Prometheus label names.
+var pushgatewayLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// PushgatewayConfig configures a PushgatewayNotifier.
+type PushgatewayConfig struct {
+	// URL is the address of the pushgateway, e.g. http://localhost:9091
+	URL string `json:"url" desc:"The address of the pushgateway, e.g. http://localhost:9091" schema:"required"`
+	// Job defaults to PushgatewayDefaultJob
+	Job string `json:"job" desc:"The job the metrics are grouped under, defaults to dca"`
+	// Labels are added to the grouping key, e.g. {"instance": "nas"}
+	Labels map[string]string `json:"labels" desc:"Grouping labels added after the job, e.g. instance"`
+	// Timeout bounds the push, defaults to 5 seconds
+	Timeout time.Duration `json:"-"`
+	// ExtraHeaders are added to every push, set from the app's extraHeaders
+	ExtraHeaders map[string]string `json:"-"`
+	// HTTPClient sends the pushes instead of a client with ExtraHeaders, set to the app's shared client
+	HTTPClient *http.Client `json:"-"`
+}
+
+// Validate checks the configuration is usable.
+func (c PushgatewayConfig) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fieldErr("url", fmt.Errorf("invalid pushgateway url: %w", err))
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return fieldErr("url", errors.New("pushgateway url scheme must be http or https"))
+	} else if u.Host == "" {
+		return fieldErr("url", errors.New("pushgateway url is missing a host"))
+	}
+
+	for name := range c.Labels {
+		if !pushgatewayLabelName.MatchString(name) || name == "job" {
+			return fieldErr("labels", fmt.Errorf("invalid pushgateway label name %q", name))
+		}
+	}
+	return nil
+}
+
+// PushgatewayNotifier pushes metrics of every run to a Prometheus pushgateway, for runs that can't be scraped. Metrics
+// are pushed with POST so only the metrics of the run replace earlier ones, the purchase metrics of the last order are
+// kept by runs that didn't order.
+type PushgatewayNotifier struct {
+	Config PushgatewayConfig
+
+	http *http.Client
+}
+
+// NewPushgatewayNotifier creates a notifier pushing to the pushgateway in cfg.
+func NewPushgatewayNotifier(cfg PushgatewayConfig) *PushgatewayNotifier {
+	if cfg.Job == "" {
+		cfg.Job = PushgatewayDefaultJob
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = pushgatewayDefaultTimeout
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = NewHTTPClient(HTTPClientConfig{ExtraHeaders: cfg.ExtraHeaders})
+	}
+	return &PushgatewayNotifier{Config: cfg, http: client}
+}
+
+func (n *PushgatewayNotifier) Notify(ctx context.Context, summary RunSummary) (err error) {
+	defer WrapErr(&err, "PushgatewayNotifier.Notify")
+
+	ctx, cancel := context.WithTimeout(withHTTPComponent(ctx, HTTPComponentPushgateway), n.Config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", n.groupingURL(), bytes.NewReader(pushgatewayMetrics(summary)))
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	res, err := n.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push metrics: %w", err)
+	}
+	body, err := readResponseBody(res, maxDrainBytes)
+	if err != nil {
+		return err
+	} else if res.StatusCode/100 != 2 {
+		return fmt.Errorf("pushgateway returned %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Check asks the pushgateway whether it's ready without pushing any metrics.
+func (n *PushgatewayNotifier) Check(ctx context.Context) (err error) {
+	defer WrapErr(&err, "PushgatewayNotifier.Check")
+
+	ctx, cancel := context.WithTimeout(withHTTPComponent(ctx, HTTPComponentPushgateway), n.Config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(n.Config.URL, "/")+"/-/ready", nil)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	res, err := n.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach pushgateway: %w", err)
+	}
+	body, err := readResponseBody(res, maxDrainBytes)
+	if err != nil {
+		return err
+	} else if res.StatusCode/100 != 2 {
+		return fmt.Errorf("pushgateway returned %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// groupingURL returns the URL of the metric group of the job and labels. Values that can't be a path segment are
+// base64 encoded as the pushgateway allows.
+func (n *PushgatewayNotifier) groupingURL() string {
+	segment := func(name, value string) string {
+		if value == "" {
+			return "/" + name + "@base64/="
+		} else if strings.Contains(value, "/") {
+			return "/" + name + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+		}
+		return "/" + name + "/" + url.PathEscape(value)
+	}
+
+	names := make([]string, 0, len(n.Config.Labels))
+	for name := range n.Config.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	u := strings.TrimSuffix(n.Config.URL, "/") + "/metrics" + segment("job", n.Config.Job)
+	for _, name := range names {
+		u += segment(name, n.Config.Labels[name])
+	}
+	return u
+}
+
+// pushgatewayMetrics formats the metrics of summary in the Prometheus text format. The purchase metrics are only
+// included when the run filled an order, the unrealized P&L ones when it was reported.
+func pushgatewayMetrics(summary RunSummary) []byte {
+	var b bytes.Buffer
+	gauge := func(name, help, labels string, value float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s%s %s\n", name, help, name, name, labels, strconv.FormatFloat(value, 'g', -1, 64))
+	}
+
+	success := 1.0
+	if summary.Status == RunStatusFailed || summary.Status == RunStatusInterrupted {
+		success = 0
+	}
+	gauge("dca_last_run_success", "Whether the last run succeeded or was skipped (1) or failed or was interrupted (0).", "", success)
+	gauge("dca_last_run_timestamp_seconds", "When the last run started.", "", float64(summary.StartedAt.UnixNano())/1e9)
+
+	if o := summary.Order; o != nil && o.VolumePurchased > 0 {
+		base, _ := PairAssets(o.Pair)
+		labels := fmt.Sprintf("{pair=%q,asset=%q}", o.Pair, base)
+		gauge("dca_last_purchase_timestamp_seconds", "When the last purchase was made.", labels, float64(summary.StartedAt.UnixNano())/1e9)
+		gauge("dca_purchase_cost", "The cost of the last purchase in the quote currency.", labels, o.Cost)
+		gauge("dca_purchase_fee", "The fee of the last purchase in the quote currency.", labels, o.Fee)
+		gauge("dca_purchase_price", "The average price of the last purchase.", labels, o.Price)
+	}
+	if pnl := summary.UnrealizedPnL; pnl != nil {
+		base, _ := PairAssets(pnl.Pair)
+		labels := fmt.Sprintf("{pair=%q,asset=%q}", pnl.Pair, base)
+		gauge("dca_unrealized_pnl", "The unrealized profit or loss of the recorded orders in the quote currency.", labels, pnl.Amount)
+		gauge("dca_unrealized_pnl_percent", "The unrealized profit or loss as a percentage of the cost basis.", labels, pnl.Percent)
+	}
+	return b.Bytes()
+}
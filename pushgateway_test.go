@@ -0,0 +1,108 @@
+package dca_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+func TestPushgatewayNotifier_Notify(t *testing.T) {
+	startedAt := time.Unix(1714600000, 0)
+	tt := []struct {
+		summary  dca.RunSummary
+		status   int
+		labels   map[string]string
+		path     string
+		expected []string
+		missing  []string
+		valid    bool
+	}{
+		{
+			dca.RunSummary{StartedAt: startedAt, Status: dca.RunStatusSuccess, Order: &dca.ExecuteOrderResponse{
+				Pair: "XBTUSD", VolumePurchased: 0.0001, Cost: 5, Fee: 0.02, Price: 50000,
+			}},
+			http.StatusOK, map[string]string{"instance": "nas", "env": "home/lab"},
+			"/metrics/job/dca/env@base64/aG9tZS9sYWI/instance/nas",
+			[]string{
+				"dca_last_run_success 1\n",
+				"dca_last_run_timestamp_seconds 1.7146e+09\n",
+				`dca_last_purchase_timestamp_seconds{pair="XBTUSD",asset="BTC"} 1.7146e+09` + "\n",
+				`dca_purchase_cost{pair="XBTUSD",asset="BTC"} 5` + "\n",
+				`dca_purchase_fee{pair="XBTUSD",asset="BTC"} 0.02` + "\n",
+				`dca_purchase_price{pair="XBTUSD",asset="BTC"} 50000` + "\n",
+				"# TYPE dca_purchase_price gauge\n",
+			},
+			nil, true,
+		},
+		// a failed run keeps the purchase metrics of the previous order
+		{
+			dca.RunSummary{StartedAt: startedAt, Status: dca.RunStatusFailed},
+			http.StatusAccepted, nil, "/metrics/job/dca",
+			[]string{"dca_last_run_success 0\n"},
+			[]string{"dca_purchase_price", "dca_last_purchase_timestamp_seconds"}, true,
+		},
+		{
+			dca.RunSummary{StartedAt: startedAt, Status: dca.RunStatusSkipped},
+			http.StatusBadRequest, nil, "/metrics/job/dca",
+			[]string{"dca_last_run_success 1\n"}, nil, false,
+		},
+	}
+	for i, tc := range tt {
+		var method, path, body string
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			method, path, body = r.Method, r.URL.EscapedPath(), string(b)
+			w.WriteHeader(tc.status)
+		}))
+
+		n := dca.NewPushgatewayNotifier(dca.PushgatewayConfig{URL: s.URL + "/", Labels: tc.labels})
+		err := n.Notify(context.Background(), tc.summary)
+		s.Close()
+
+		if want, got := tc.valid, err == nil; got != want {
+			t.Errorf("%d: want success %v got %v", i, want, err)
+		}
+		// POST only replaces the pushed metrics of the group
+		if want, got := "POST", method; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.path, path; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		for _, want := range tc.expected {
+			if !strings.Contains(body, want) {
+				t.Errorf("%d: want %q in %q", i, want, body)
+			}
+		}
+		for _, unwanted := range tc.missing {
+			if strings.Contains(body, unwanted) {
+				t.Errorf("%d: want no %q in %q", i, unwanted, body)
+			}
+		}
+	}
+}
+
+func TestPushgatewayConfig_Validate(t *testing.T) {
+	tt := []struct {
+		cfg   dca.PushgatewayConfig
+		valid bool
+	}{
+		{dca.PushgatewayConfig{URL: "http://localhost:9091"}, true},
+		{dca.PushgatewayConfig{URL: "https://push.example.com", Job: "dca", Labels: map[string]string{"instance": "nas"}}, true},
+		{dca.PushgatewayConfig{URL: "tcp://localhost:9091"}, false},
+		{dca.PushgatewayConfig{URL: ""}, false},
+		{dca.PushgatewayConfig{URL: "http://localhost:9091", Labels: map[string]string{"job": "other"}}, false},
+		{dca.PushgatewayConfig{URL: "http://localhost:9091", Labels: map[string]string{"1instance": "nas"}}, false},
+	}
+	for i, tc := range tt {
+		if want, got := tc.valid, tc.cfg.Validate() == nil; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
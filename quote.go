@@ -0,0 +1,218 @@
+package dca
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Names of the built-in guards evaluated by App.Quote, the custom guards of App.Guards are quoted by their own names.
+const (
+	QuoteGuardTradingMode    = "trading_mode"
+	QuoteGuardPriceLadder    = "price_ladder"
+	QuoteGuardPriceDeviation = "price_deviation"
+	QuoteGuardVolume         = "volume"
+	QuoteGuardConfirmation   = "confirmation"
+	QuoteGuardBalance        = "balance"
+)
+
+// QuoteGuard is the outcome of a check a run makes before ordering.
+type QuoteGuard struct {
+	Name    string `json:"name"`
+	Blocked bool   `json:"blocked"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Quote previews the market order a run would place at the current price.
+type Quote struct {
+	Pair          string  `json:"pair"`
+	Side          string  `json:"side"`
+	AmountInCents int     `json:"amountInCents"`
+	Ask           float64 `json:"ask"`
+	Bid           float64 `json:"bid"`
+	Spread        float64 `json:"spread"`
+	// SpreadPercent is the spread as a percentage of the ask.
+	SpreadPercent float64 `json:"spreadPercent"`
+	// Price is the side of the book the order is sized at, the ask for buys and the bid for sells.
+	Price float64 `json:"price"`
+	// Volume is the volume that would be ordered, rounded when volumeRounding is set.
+	Volume float64 `json:"volume"`
+	// FeeRate is the account's taker fee when private calls are made, DefaultBacktestFeeRate otherwise.
+	FeeRate        float64 `json:"feeRate"`
+	AccountFeeRate bool    `json:"accountFeeRate"`
+	EstimatedFee   float64 `json:"estimatedFee"`
+	// Balance is the available balance of the quote asset, only fetched with private calls.
+	Balance *float64     `json:"balance,omitempty"`
+	Guards  []QuoteGuard `json:"guards"`
+	// Blocked is set when any guard would prevent the order.
+	Blocked bool `json:"blocked"`
+	// Decisions narrate the guards evaluated by the code of a run, as a run records them.
+	Decisions []Decision `json:"decisions,omitempty"`
+}
+
+// Quote previews the order a run would place now: it fetches the ticker and evaluates the guards of a run with the
+// same code, without ordering. Only public endpoints are called unless private is set, then the account's fee rate
+// and balance are fetched with read-only calls. Only market orders can be quoted.
+func (m *App) Quote(ctx context.Context, private bool) (q Quote, err error) {
+	defer WrapErr(&err, "App.Quote")
+
+	decisions := &decisionRecorder{}
+	ctx = withDecisions(ctx, decisions)
+	defer func() { q.Decisions = decisions.Decisions() }()
+
+	// A read-only provider fails any call which could order.
+	provider := m.newKrakenProvider()
+	provider.ReadOnly = true
+
+	order, err := provider.resolveOrder(m.Config.OrderRequest())
+	if err != nil {
+		return q, err
+	} else if order.OrderType != OrderTypeMarket {
+		return q, fmt.Errorf("only market orders can be quoted, not %s orders", order.OrderType)
+	}
+	q = Quote{Pair: order.Pair, Side: order.Side, AmountInCents: order.AmountInCents, FeeRate: DefaultBacktestFeeRate}
+
+	paper := m.Config.Provider == ProviderPaper || m.Config.Provider == ProviderPaperRealistic
+	if m.Config.OrderStorePath != "" && !paper {
+		m.configurePriceCheck(ctx, provider, m.fileOrderStore())
+	}
+
+	m.loadPairMetadata(ctx, provider, order.Pair)
+
+	guard := func(name string, blocked bool, reason string) {
+		q.Guards = append(q.Guards, QuoteGuard{Name: name, Blocked: blocked, Reason: reason})
+		q.Blocked = q.Blocked || blocked
+	}
+
+	// as for runs, an unknown status doesn't block the order
+	status, err := provider.systemStatus(ctx)
+	if err != nil {
+		guard(QuoteGuardTradingMode, false, fmt.Sprintf("failed to fetch the system status: %v", err))
+	} else if err = provider.checkTradingMode(ctx, status, order); err != nil {
+		guard(QuoteGuardTradingMode, true, err.Error())
+	} else if status == krakenStatusPostOnly {
+		guard(QuoteGuardTradingMode, false, "market is in post_only mode, a post-only limit order would be placed instead")
+	} else {
+		guard(QuoteGuardTradingMode, false, "")
+	}
+
+	t, err := provider.fetchTicker(ctx, order.Pair)
+	if err != nil {
+		return q, err
+	}
+	q.Ask, q.Bid = t.Ask, t.Bid
+	q.Spread = t.Ask - t.Bid
+	if t.Ask > 0 {
+		q.SpreadPercent = q.Spread / t.Ask * 100
+	}
+
+	// the ladder and the custom guards size the order at the ask as a run does, a budget isn't paced by quotes so the
+	// amount isn't capped
+	var guards []Guard
+	if len(m.Config.PriceLadder) > 0 {
+		guards = append(guards, priceLadderGuard{ladder: m.Config.PriceLadder, logger: m.Logger})
+	}
+	now := time.Now().In(m.Config.Location())
+	in := GuardInput{Now: now, Pair: order.Pair, AmountInCents: order.AmountInCents, Ticker: newPriceSample(now, order.Pair, t), Config: m.Config}
+	if len(m.Guards) > 0 && m.Config.OrderStorePath != "" && !paper {
+		if in.History, err = m.fileOrderStore().List(ctx); err != nil {
+			m.Logger.WarnContext(ctx, "failed to list orders for the guards", "error", err)
+		}
+	}
+	for _, g := range append(guards, m.Guards...) {
+		// every guard is quoted, a blocking guard doesn't hide the ones after it
+		var evaluated RunSummary
+		amount, err := evaluateGuards(ctx, m.Logger, []Guard{g}, in, m.Config.GuardFailurePolicy, &evaluated)
+		switch {
+		case err != nil:
+			guard(g.Name(), true, err.Error())
+		case len(evaluated.Warnings) > 0:
+			guard(g.Name(), false, evaluated.Warnings[0])
+		default:
+			in.AmountInCents = amount
+			guard(g.Name(), false, "")
+		}
+	}
+	order.AmountInCents, q.AmountInCents = in.AmountInCents, in.AmountInCents
+
+	volume, quoted := buyVolume(order, t)
+	q.Volume, q.Price, err = provider.guardVolume(ctx, order.Pair, volume, quoted)
+	switch {
+	case errors.Is(err, ErrPriceDeviation):
+		guard(QuoteGuardPriceDeviation, true, err.Error())
+	case err != nil:
+		guard(QuoteGuardPriceDeviation, false, "")
+		guard(QuoteGuardVolume, true, err.Error())
+	default:
+		guard(QuoteGuardPriceDeviation, false, "")
+		// Kraken rejects orders below the pair's minimum even when they aren't rounded
+		if minimum, perr := strconv.ParseFloat(provider.orderMin(order.Pair), 64); perr == nil && q.Volume < minimum {
+			guard(QuoteGuardVolume, true, fmt.Sprintf("%v: volume %v is below the %s minimum of %v", ErrOrderToSmall, q.Volume, order.Pair, minimum))
+		} else {
+			guard(QuoteGuardVolume, false, "")
+		}
+	}
+
+	amount := float64(order.AmountInCents) / 100
+	if private {
+		if rate, err := provider.fetchFeeRate(ctx, order.Pair); err != nil {
+			m.Logger.WarnContext(ctx, "failed to fetch the account fee rate, using the default", "error", err)
+		} else {
+			q.FeeRate, q.AccountFeeRate = rate, true
+		}
+	}
+	q.EstimatedFee = amount * q.FeeRate
+
+	// A terminal can confirm the order, otherwise a run fails.
+	if m.Config.ConfirmAboveCents > 0 && order.AmountInCents > m.Config.ConfirmAboveCents {
+		guard(QuoteGuardConfirmation, false, fmt.Sprintf("the amount exceeds confirmAboveCents of %s, it must be confirmed on a terminal", FormatCents(m.Config.ConfirmAboveCents, "")))
+	}
+
+	if private && order.Side == SideBuy {
+		balance, err := provider.fetchBalance(ctx, krakenPairs[order.Pair].QuoteAsset)
+		if err != nil {
+			return q, err
+		}
+		q.Balance = &balance
+
+		switch {
+		case balance >= amount+q.EstimatedFee:
+			guard(QuoteGuardBalance, false, "")
+		case provider.SweepThresholdPercent > 0 && balance >= amount*(1-provider.SweepThresholdPercent/100):
+			guard(QuoteGuardBalance, false, fmt.Sprintf("the balance of %s is short, the order would be reduced to the balance", FormatFiat(balance, "")))
+		case provider.SkipOnPendingDeposit:
+			guard(QuoteGuardBalance, true, fmt.Sprintf("%v: the balance is %s, the run is skipped if a pending deposit covers the shortfall", ErrInsufficientFunds, FormatFiat(balance, "")))
+		default:
+			guard(QuoteGuardBalance, true, fmt.Sprintf("%v: the balance is %s", ErrInsufficientFunds, FormatFiat(balance, "")))
+		}
+	}
+
+	return q, nil
+}
+
+// fetchFeeRate returns the account's taker fee for pair as a fraction.
+func (p *KrakenProvider) fetchFeeRate(ctx context.Context, pair string) (rate float64, err error) {
+	defer WrapErr(&err, "fetchFeeRate")
+
+	var result struct {
+		Fees map[string]struct {
+			Fee string `json:"fee"`
+		} `json:"fees"`
+	}
+	if err = p.privateRequest(ctx, "/0/private/TradeVolume", url.Values{"pair": {pair}}, &result); err != nil {
+		return 0, fmt.Errorf("failed to fetch trade volume: %w", err)
+	}
+
+	fee, err := pairResult(result.Fees, pair)
+	if err != nil {
+		return 0, err
+	}
+	if rate, err = strconv.ParseFloat(fee.Fee, 64); err != nil {
+		return 0, fmt.Errorf("failed to parse fee: %w", err)
+	}
+	// Kraken reports fees as percentages
+	return rate / 100, nil
+}
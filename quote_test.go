@@ -0,0 +1,103 @@
+package dca_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+func TestApp_Quote(t *testing.T) {
+	const online = `{"error":[],"result":{"status":"online"}}`
+	tradeVolume := `{"error":[],"result":{"currency":"ZUSD","volume":"1000.0000","fees":{"XXBTZUSD":{"fee":"0.2600"}}}}`
+
+	tt := []struct {
+		cfg        dca.AppConfig
+		status     string
+		private    bool
+		balance    string
+		volume     float64
+		feeRate    float64
+		blocked    []string
+		priceCheck bool
+	}{
+		{dca.AppConfig{}, online, false, "", 0.0001, 0.004, nil, false},
+		{dca.AppConfig{}, `{"error":[],"result":{"status":"cancel_only"}}`, false, "", 0.0001, 0.004, []string{dca.QuoteGuardTradingMode}, false},
+		// post_only only blocks market orders without the fallback
+		{dca.AppConfig{PostOnlyFallback: true}, `{"error":[],"result":{"status":"post_only"}}`, false, "", 0.0001, 0.004, nil, false},
+		{dca.AppConfig{OrderAmountInCents: 100}, online, false, "", 0.00002, 0.004, []string{dca.QuoteGuardVolume}, false},
+		{dca.AppConfig{VolumeRounding: "0.001"}, online, false, "", 0.0001, 0.004, []string{dca.QuoteGuardVolume}, false},
+		{dca.AppConfig{}, online, true, "100.0000", 0.0001, 0.0026, nil, false},
+		{dca.AppConfig{}, online, true, "4.0000", 0.0001, 0.0026, []string{dca.QuoteGuardBalance}, false},
+		// the sweep reduces orders within its threshold
+		{dca.AppConfig{SweepThresholdPercent: 25}, online, true, "4.0000", 0.0001, 0.0026, nil, false},
+		{dca.AppConfig{MaxPriceDeviationPercent: 10}, online, false, "", 0.0001, 0.004, []string{dca.QuoteGuardPriceDeviation}, true},
+		// the ask of 50000 is in the second tier, inclusive
+		{dca.AppConfig{PriceLadder: dca.PriceLadder{{MaxPrice: 40000, AmountInCents: 1000}, {MaxPrice: 50000, AmountInCents: 2000}}}, online, false, "", 0.0004, 0.004, nil, false},
+		{dca.AppConfig{PriceLadder: dca.PriceLadder{{MaxPrice: 40000, AmountInCents: 1000}}}, online, false, "", 0.0001, 0.004, []string{dca.QuoteGuardPriceLadder}, false},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus":  {tc.status},
+			"/0/public/Ticker":        {tickerResponse},
+			"/0/private/TradeVolume":  {tradeVolume},
+			"/0/private/Balance":      {`{"error":[],"result":{"ZUSD":"` + tc.balance + `"}}`},
+			"/0/private/AddOrder":     {addOrderResponse},
+			"/0/private/QueryOrders":  {queryOrdersResponse},
+			"/0/private/OpenOrders":   {`{"error":[],"result":{"open":{}}}`},
+			"/0/private/ClosedOrders": {`{"error":[],"result":{"closed":{},"count":0}}`},
+		})
+		if tc.priceCheck {
+			// the last purchase was at 40000, 25% below the ask
+			tc.cfg.OrderStorePath = filepath.Join(t.TempDir(), "orders.jsonl")
+			if err := dca.NewFileOrderStore(tc.cfg.OrderStorePath).Put(context.Background(), dca.OrderRecord{
+				Time:  time.Now().Add(-24 * time.Hour),
+				Order: dca.ExecuteOrderResponse{Pair: "XBTUSD", Side: "buy", TransactionID: "OLD", VolumePurchased: 0.0001, Cost: 4, Price: 40000},
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		app, _ := newTestApp(s, tc.cfg)
+
+		q, err := app.Quote(context.Background(), tc.private)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		if want, got := 50000.0, q.Price; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := 10.0, q.Spread; !approx(want, got) {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.volume, q.Volume; !approx(want, got) {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.feeRate, q.FeeRate; !approx(want, got) {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+
+		var blocked []string
+		for _, g := range q.Guards {
+			if g.Blocked {
+				blocked = append(blocked, g.Name)
+			}
+		}
+		if want, got := tc.blocked, blocked; len(got) != len(want) || (len(want) > 0 && got[0] != want[0]) {
+			t.Errorf("%d: want blocked %v got %v", i, want, got)
+		}
+		if want, got := len(tc.blocked) > 0, q.Blocked; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+
+		// nothing is ordered and private endpoints are only called when asked
+		if want, got := 0, len(s.Requests("/0/private/AddOrder")); got != want {
+			t.Errorf("%d: want %v AddOrder requests got %v", i, want, got)
+		}
+		if want, got := tc.private, len(s.Requests("/0/private/Balance")) > 0; got != want {
+			t.Errorf("%d: want private calls %v got %v", i, want, got)
+		}
+	}
+}
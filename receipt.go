@@ -0,0 +1,118 @@
+package dca
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"math"
+	"os"
+	"strconv"
+	texttemplate "text/template"
+)
+
+//go:embed templates/receipt.tmpl
+var receiptTemplates embed.FS
+
+// funcs are the functions available to receipt templates, amounts are formatted with r.Money.
+func (r *ReceiptRenderer) funcs() map[string]any {
+	return map[string]any{
+		// money formats an amount of the quote currency
+		"money": func(v float64) string { return FormatFiat(v, "") },
+		// volume formats a volume of the base asset
+		"volume": func(v float64) string { return r.Money.Crypto(v, "") },
+		// volumeOf formats a volume of the base asset of a pair followed by the asset, e.g. 0.00010000 BTC
+		"volumeOf": func(v float64, pair string) string {
+			base, _ := PairAssets(pair)
+			return r.Money.Crypto(v, base)
+		},
+		// cents converts an amount in cents to the quote currency
+		"cents": func(v int) float64 { return float64(v) / 100 },
+		// abs returns the magnitude of a signed amount
+		"abs": math.Abs,
+		// percent formats the magnitude of a percentage
+		"percent": func(v float64) string { return strconv.FormatFloat(math.Abs(v), 'f', 3, 64) + "%" },
+	}
+}
+
+// Receipt is a run summary rendered for people.
+type Receipt struct {
+	// Line is a one-line summary.
+	Line string
+	// Text is a multi-line plain-text block.
+	Text string
+	// HTML is a minimal HTML fragment.
+	HTML string
+}
+
+// ReceiptRenderer renders run summaries as receipts, notifiers use it so formatting is defined in one place.
+type ReceiptRenderer struct {
+	// Money formats the amounts of the receipts, e.g. with the config's AppConfig.MoneyFormat.
+	Money MoneyFormat
+
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// NewReceiptRenderer parses the embedded receipt templates followed by the optional template file at path, which
+// overrides the "line", "text" and "html" templates it defines.
+func NewReceiptRenderer(path string) (_ *ReceiptRenderer, err error) {
+	defer WrapErr(&err, "NewReceiptRenderer")
+
+	r := &ReceiptRenderer{}
+	if r.text, err = texttemplate.New("receipt").Funcs(r.funcs()).ParseFS(receiptTemplates, "templates/receipt.tmpl"); err != nil {
+		return nil, err
+	}
+	if r.html, err = htmltemplate.New("receipt").Funcs(r.funcs()).ParseFS(receiptTemplates, "templates/receipt.tmpl"); err != nil {
+		return nil, err
+	}
+
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read receipt template: %w", err)
+		}
+		if _, err = r.text.New("override").Parse(string(b)); err != nil {
+			return nil, fmt.Errorf("failed to parse receipt template: %w", err)
+		}
+		if _, err = r.html.New("override").Parse(string(b)); err != nil {
+			return nil, fmt.Errorf("failed to parse receipt template: %w", err)
+		}
+	}
+
+	return r, nil
+}
+
+// defaultReceiptRenderer renders receipts with the embedded templates.
+var defaultReceiptRenderer = func() *ReceiptRenderer {
+	r, err := NewReceiptRenderer("")
+	if err != nil {
+		panic(err)
+	}
+	return r
+}()
+
+// Render renders summary with every template.
+func (r *ReceiptRenderer) Render(summary RunSummary) (receipt Receipt, err error) {
+	defer WrapErr(&err, "ReceiptRenderer.Render")
+
+	var b bytes.Buffer
+	if err = r.text.ExecuteTemplate(&b, "line", summary); err != nil {
+		return receipt, err
+	}
+	receipt.Line = b.String()
+
+	b.Reset()
+	if err = r.text.ExecuteTemplate(&b, "text", summary); err != nil {
+		return receipt, err
+	}
+	receipt.Text = b.String()
+
+	b.Reset()
+	if err = r.html.ExecuteTemplate(&b, "html", summary); err != nil {
+		return receipt, err
+	}
+	receipt.HTML = b.String()
+
+	return receipt, nil
+}
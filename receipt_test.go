@@ -0,0 +1,203 @@
+package dca_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// receiptSummaries are the summaries the default receipt templates are pinned with.
+var receiptSummaries = map[string]dca.RunSummary{
+	"success": {
+		SchemaVersion: dca.SchemaVersion,
+		StartedAt:     time.Date(2024, 3, 1, 2, 0, 0, 0, time.UTC),
+		LocalDate:     "2024-03-01",
+		Status:        dca.RunStatusSuccess,
+		Order: &dca.ExecuteOrderResponse{
+			AmountInCents:   500,
+			Pair:            "XBTUSD",
+			Side:            dca.SideBuy,
+			TransactionID:   "TXID-1",
+			OrderType:       dca.OrderTypeMarket,
+			Status:          "closed",
+			VolumePurchased: 0.0001,
+			Cost:            5,
+			Fee:             0.02,
+			Price:           50000,
+		},
+		VWAP:          &dca.VWAPComparison{Window: dca.VWAPWindowToday, VWAP: 50100, FillPrice: 50000, Delta: -100, DeltaPercent: -0.1996},
+		UnrealizedPnL: &dca.UnrealizedPnL{Pair: "XBTUSD", Volume: 0.0003, CostBasis: 14.06, Price: 49990, Value: 14.997, Amount: 0.937, Percent: 6.6643},
+		Warnings:      []string{"earn allocation skipped: <below minimum>"},
+	},
+	// a run buying another asset than BTC
+	"ether": {
+		LocalDate: "2024-03-01",
+		Status:    dca.RunStatusSuccess,
+		Asset:     "ETH",
+		Order: &dca.ExecuteOrderResponse{
+			AmountInCents:   1000,
+			Pair:            "ETHEUR",
+			Side:            dca.SideBuy,
+			TransactionID:   "TXID-2",
+			OrderType:       dca.OrderTypeMarket,
+			Status:          "closed",
+			VolumePurchased: 0.004,
+			Cost:            10,
+			Fee:             0.04,
+			Price:           2500,
+		},
+		UnrealizedPnL: &dca.UnrealizedPnL{Pair: "ETHEUR", Asset: "ETH", Volume: 0.012, CostBasis: 30.12, Price: 2400, Value: 28.8, Amount: -1.32, Percent: -4.3825},
+	},
+	"skipped": {
+		LocalDate:  "2024-03-01",
+		Status:     dca.RunStatusSkipped,
+		SkipReason: dca.SkipReasonDepositPending,
+	},
+	"labeled": {
+		LocalDate:  "2024-03-01",
+		Label:      "retirement",
+		Status:     dca.RunStatusSkipped,
+		SkipReason: dca.SkipReasonDepositPending,
+	},
+	"funding": {
+		LocalDate: "2024-03-01",
+		Status:    dca.RunStatusSuccess,
+		Order: &dca.ExecuteOrderResponse{
+			AmountInCents:   500,
+			Pair:            "XBTUSD",
+			Side:            dca.SideBuy,
+			TransactionID:   "TXID-1",
+			OrderType:       dca.OrderTypeMarket,
+			Status:          "closed",
+			VolumePurchased: 0.0001,
+			Cost:            5,
+			Fee:             0.02,
+			Price:           50000,
+		},
+		Funding: &dca.FundingReminder{
+			Asset:          "USD",
+			Balance:        12.5,
+			RunsRemaining:  2,
+			ThresholdRuns:  4,
+			Instructions:   "Wire to Kraken with reference <ABC123>",
+			DepositMethods: []dca.KrakenDepositMethod{{Method: "Bank Frick (SWIFT)", Minimum: "10.00", Fee: "0.0000"}},
+		},
+	},
+	"failed": {
+		LocalDate: "2024-03-01",
+		Status:    dca.RunStatusFailed,
+		Error:     "KrakenProvider.ExecuteOrder: insufficient funds",
+	},
+}
+
+func TestReceiptRenderer_Render(t *testing.T) {
+	r, err := dca.NewReceiptRenderer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, summary := range receiptSummaries {
+		receipt, err := r.Render(summary)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+
+		for ext, got := range map[string]string{"line": receipt.Line, "txt": receipt.Text, "html": receipt.HTML} {
+			golden := filepath.Join("testdata", "receipt", name+"."+ext)
+			if *update {
+				if err = os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(want) != got {
+				t.Errorf("%s: want %q got %q", golden, want, got)
+			}
+		}
+	}
+}
+
+func TestReceiptRenderer_Render_Money(t *testing.T) {
+	trimmed, err := dca.NewReceiptRenderer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trimmed.Money = dca.MoneyFormat{TrimTrailingZeros: true}
+	r, err := dca.NewReceiptRenderer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the format of one renderer doesn't change the other's
+	for _, tc := range []struct {
+		r        *dca.ReceiptRenderer
+		expected string
+	}{{trimmed, "Bought 0.0001 BTC"}, {r, "Bought 0.00010000 BTC"}} {
+		receipt, err := tc.r.Render(receiptSummaries["success"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(receipt.Line, tc.expected) {
+			t.Errorf("want %q got %q", tc.expected, receipt.Line)
+		}
+	}
+}
+
+func TestNewReceiptRenderer_Override(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, tmpl string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(tmpl), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	valid := write("valid.tmpl", `{{define "line"}}{{.Status}} {{with .Order}}{{volume .VolumePurchased}}{{end}}{{end}}`)
+	invalid := write("invalid.tmpl", `{{define "line"}}{{.Status}{{end}}`)
+
+	r, err := dca.NewReceiptRenderer(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt, err := r.Render(receiptSummaries["success"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "success 0.00010000", receipt.Line; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	// templates which aren't overridden keep the defaults
+	if !strings.HasPrefix(receipt.Text, "DCA run success on 2024-03-01") {
+		t.Errorf("unexpected text %q", receipt.Text)
+	}
+
+	// parse errors are caught when the config is validated
+	tt := []struct {
+		template string
+		valid    bool
+	}{
+		{"", true},
+		{valid, true},
+		{invalid, false},
+		{filepath.Join(dir, "missing.tmpl"), false},
+	}
+	for i, tc := range tt {
+		cfg := dca.AppConfig{KrakenAPIKey: "key", KrakenPrivateKey: "secret", OrderAmountInCents: 500, ReceiptTemplate: tc.template}
+		if err := cfg.Validate(); (err == nil) != tc.valid {
+			t.Errorf("%d: want valid %v got %v", i, tc.valid, err)
+		}
+	}
+}
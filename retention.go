@@ -0,0 +1,294 @@
+package dca
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RetentionConfig prunes the details of old records from the order store. The summary of every order, its pair,
+// volume, cost, fee and price, is kept forever so the history, budget and P&L stay complete.
+type RetentionConfig struct {
+	// PruneAfterDays is the age in days of records whose details are pruned.
+	PruneAfterDays int `json:"pruneAfterDays" desc:"The age in days of order records whose details are pruned" schema:"required"`
+	// Archive is where the pruned records are written in full before they're pruned, a local directory or an S3
+	// URL such as s3://bucket/prefix. Pruned details are lost when it's empty.
+	Archive string `json:"archive" desc:"Where pruned records are written in full as gzipped JSON Lines before they're pruned, a local directory or an S3 URL such as s3://bucket/prefix"`
+}
+
+// Validate checks the configuration is usable.
+func (c RetentionConfig) Validate() error {
+	var errs []error
+	if c.PruneAfterDays <= 0 {
+		errs = append(errs, errors.New("retention pruneAfterDays must be positive"))
+	}
+	if c.Archive != "" {
+		if _, err := NewOrderArchive(c.Archive); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Cutoff returns the time records recorded before are pruned when pruning at now.
+func (c RetentionConfig) Cutoff(now time.Time) time.Time {
+	return now.AddDate(0, 0, -c.PruneAfterDays)
+}
+
+// PruneOptions controls what OrderStore pruning removes.
+type PruneOptions struct {
+	// Before is the cutoff, only records recorded strictly before it are pruned.
+	Before time.Time
+	// Archive receives the pruned records in full before the store is rewritten, nothing is archived when it's nil.
+	Archive OrderArchive
+	// DryRun reports what would be pruned without archiving or rewriting anything.
+	DryRun bool
+}
+
+// PruneResult is what pruning an order store removed, or would remove on a dry run.
+type PruneResult struct {
+	Before time.Time `json:"before"`
+	DryRun bool      `json:"dryRun,omitempty"`
+	// TransactionIDs are the orders whose records were pruned.
+	TransactionIDs []string `json:"transactionIds"`
+	// Kept is the number of records left as they were.
+	Kept int `json:"kept"`
+	// Archive is where the pruned records were archived.
+	Archive string `json:"archive,omitempty"`
+}
+
+// prune returns the record without the details which only matter shortly after the order, and whether there were
+// any to prune. The slippage is kept with the summary since the rolling slippage stats average it.
+func (r OrderRecord) prune() (OrderRecord, bool) {
+	if r.Pruned {
+		return r, false
+	}
+	r.Pruned = true
+	r.Order.AdditionalInfo = ""
+	r.Order.Warnings = nil
+	return r, true
+}
+
+// Prune strips the details of the records recorded before opts.Before. The pruned records are archived in full
+// first, then the store is rewritten to a temporary file which replaces it, so an interrupted prune leaves the store
+// as it was. The rewrite is abandoned when a record was appended meanwhile, the next prune picks it up.
+func (s *FileOrderStore) Prune(ctx context.Context, opts PruneOptions) (res PruneResult, err error) {
+	defer WrapErr(&err, "FileOrderStore.Prune")
+
+	res = PruneResult{Before: opts.Before, DryRun: opts.DryRun, TransactionIDs: []string{}}
+	b, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return res, nil
+	} else if err != nil {
+		return res, err
+	}
+
+	// records which are kept are copied as they were read, a final record torn by a crash is dropped
+	complete := b
+	if i := bytes.LastIndexByte(b, '\n'); i < len(b)-1 {
+		complete = b[:i+1]
+	}
+	var store, archived bytes.Buffer
+	for i, line := range bytes.Split(complete, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+
+		var rec OrderRecord
+		if err = json.Unmarshal(line, &rec); err != nil {
+			return res, fmt.Errorf("failed to unmarshal record on line %d: %w", i+1, err)
+		}
+		pruned, ok := rec.prune()
+		if !ok || !rec.Time.Before(opts.Before) {
+			store.Write(line)
+			store.WriteByte('\n')
+			res.Kept++
+			continue
+		}
+
+		archived.Write(line)
+		archived.WriteByte('\n')
+		if line, err = json.Marshal(pruned); err != nil {
+			return res, fmt.Errorf("failed to marshal record: %w", err)
+		}
+		store.Write(line)
+		store.WriteByte('\n')
+		res.TransactionIDs = append(res.TransactionIDs, rec.Order.TransactionID)
+	}
+	if opts.DryRun || len(res.TransactionIDs) == 0 {
+		return res, nil
+	}
+
+	// the store is only rewritten once the archive holds what's pruned
+	if opts.Archive != nil {
+		if res.Archive, err = opts.Archive.Put(ctx, prunedRecordsName(time.Now()), archived.Bytes()); err != nil {
+			return res, fmt.Errorf("failed to archive pruned records: %w", err)
+		}
+	}
+	if err = ctx.Err(); err != nil {
+		return res, err
+	}
+
+	tmp, err := writeTemp(s.Path, store.Bytes())
+	if err != nil {
+		return res, err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	// Put appends without a lock, so a record appended since the store was read would be lost by the rename
+	fi, err := os.Stat(s.Path)
+	if err != nil {
+		return res, err
+	} else if fi.Size() != int64(len(b)) {
+		return res, errors.New("the order store changed while it was pruned")
+	}
+	return res, replaceFile(tmp, s.Path)
+}
+
+// prunedRecordsName names an archive of records pruned at t so archives sort by time.
+func prunedRecordsName(t time.Time) string {
+	return "orders-pruned-" + t.UTC().Format("20060102T150405Z") + ".jsonl.gz"
+}
+
+// OrderArchive keeps the records pruned from an order store.
+type OrderArchive interface {
+	// Put gzips the JSON Lines records b to the document name and returns where it was written.
+	Put(ctx context.Context, name string, b []byte) (string, error)
+}
+
+// NewOrderArchive returns the archive at location, an S3 URL such as s3://bucket/prefix or a local directory.
+func NewOrderArchive(location string) (OrderArchive, error) {
+	if !strings.HasPrefix(location, S3Prefix) {
+		return &DirOrderArchive{Dir: location}, nil
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retention archive: %w", err)
+	} else if u.Host == "" {
+		return nil, errors.New("retention archive is missing an S3 bucket")
+	}
+	return &S3OrderArchive{S3Location: S3Location{Bucket: u.Host}, Prefix: strings.Trim(u.Path, "/")}, nil
+}
+
+// gzipRecords compresses the JSON Lines records b.
+func gzipRecords(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DirOrderArchive is an OrderArchive writing a gzip file per prune to a local directory.
+type DirOrderArchive struct {
+	Dir string
+}
+
+func (a *DirOrderArchive) Put(_ context.Context, name string, b []byte) (location string, err error) {
+	defer WrapErr(&err, "DirOrderArchive.Put")
+
+	gz, err := gzipRecords(b)
+	if err != nil {
+		return "", fmt.Errorf("failed to compress records: %w", err)
+	}
+	if err = os.MkdirAll(a.Dir, 0700); err != nil {
+		return "", err
+	}
+
+	// replaced atomically so a partial archive is never mistaken for a complete one
+	location = filepath.Join(a.Dir, name)
+	return location, writeFileAtomic(location, gz)
+}
+
+// S3OrderArchive is an OrderArchive writing a gzip object per prune under a prefix of an S3 bucket. Requests are
+// signed with the default AWS credentials.
+type S3OrderArchive struct {
+	S3Location
+	Prefix string
+}
+
+func (a *S3OrderArchive) Put(ctx context.Context, name string, b []byte) (location string, err error) {
+	defer WrapErr(&err, "S3OrderArchive.Put")
+
+	gz, err := gzipRecords(b)
+	if err != nil {
+		return "", fmt.Errorf("failed to compress records: %w", err)
+	}
+	key := path.Join(a.Prefix, name)
+	if _, err = s3Request(ctx, a.object(key), "PUT", gz); err != nil {
+		return "", fmt.Errorf("failed to put pruned records: %w", err)
+	}
+	return S3Prefix + a.Bucket + "/" + key, nil
+}
+
+// PruneOrders prunes the order store according to the retention config, dryRun reports what would be pruned
+// without changing anything.
+func (m *App) PruneOrders(ctx context.Context, dryRun bool) (res PruneResult, err error) {
+	defer WrapErr(&err, "App.PruneOrders")
+
+	if m.Config.Retention == nil {
+		return res, errors.New("retention isn't configured")
+	} else if m.Config.OrderStorePath == "" {
+		return res, errors.New("orderStorePath is required to prune orders")
+	}
+	return m.pruneOrders(ctx, m.fileOrderStore(), dryRun)
+}
+
+// pruneOrders prunes store according to the retention config.
+func (m *App) pruneOrders(ctx context.Context, store interface {
+	Prune(ctx context.Context, opts PruneOptions) (PruneResult, error)
+}, dryRun bool) (PruneResult, error) {
+	opts := PruneOptions{Before: m.Config.Retention.Cutoff(time.Now()), DryRun: dryRun}
+	if m.Config.Retention.Archive != "" {
+		// the location is validated by LoadConfig
+		archive, err := NewOrderArchive(m.Config.Retention.Archive)
+		if err != nil {
+			return PruneResult{}, err
+		}
+		if s3, ok := archive.(*S3OrderArchive); ok {
+			s3.HTTPClient = m.httpClient()
+		}
+		opts.Archive = archive
+	}
+	return store.Prune(ctx, opts)
+}
+
+// pruneAfterRun prunes store at the end of a run. The order was placed and recorded so failures are only recorded as
+// warnings, the next run tries again.
+func (m *App) pruneAfterRun(ctx context.Context, store OrderStore, summary *RunSummary) {
+	pruner, ok := store.(interface {
+		Prune(ctx context.Context, opts PruneOptions) (PruneResult, error)
+	})
+	if !ok {
+		return
+	}
+
+	var res PruneResult
+	err := m.recoverPanic(ctx, "OrderStore.Prune", func() (err error) { res, err = m.pruneOrders(ctx, pruner, false); return err })
+	if err != nil {
+		m.Logger.WarnContext(ctx, "failed to prune the order store", "error", err)
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("order store pruning failed: %v", err))
+		return
+	}
+	if len(res.TransactionIDs) > 0 {
+		m.Logger.InfoContext(ctx, "pruned the order store", "pruned", len(res.TransactionIDs), "before", res.Before, "archive", res.Archive)
+	}
+}
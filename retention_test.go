@@ -0,0 +1,231 @@
+package dca_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+// newPruneStore returns a store holding an order recorded at each of times.
+func newPruneStore(t *testing.T, times ...time.Time) *dca.FileOrderStore {
+	store := dca.NewFileOrderStore(filepath.Join(t.TempDir(), "orders.jsonl"))
+	for i, tm := range times {
+		rec := dca.OrderRecord{Time: tm, Order: dca.ExecuteOrderResponse{TransactionID: "TXID-" + string(rune('A'+i)), Pair: "XBTUSD",
+			Cost: 5, Price: 50000, VolumePurchased: 0.0001, AdditionalInfo: "buy 0.0001 XBTUSD @ market", Warnings: []string{"fee missing"}}}
+		if err := store.Put(context.Background(), rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+// archiveFunc is an OrderArchive calling a function.
+type archiveFunc func(name string, b []byte) (string, error)
+
+func (f archiveFunc) Put(_ context.Context, name string, b []byte) (string, error) { return f(name, b) }
+
+func TestFileOrderStore_Prune(t *testing.T) {
+	cutoff := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	// records at the cutoff or newer are inside the retention window and never touched
+	store := newPruneStore(t, cutoff.Add(-time.Nanosecond), cutoff, cutoff.Add(time.Second), cutoff.Add(-48*time.Hour))
+	before, err := store.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := store.Prune(context.Background(), dca.PruneOptions{Before: cutoff})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := []string{"TXID-A", "TXID-D"}, res.TransactionIDs; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := 2, res.Kept; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	records, err := store.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	} else if want, got := len(before), len(records); got != want {
+		t.Fatalf("want %v got %v", want, got)
+	}
+	for i, rec := range records {
+		pruned := i == 0 || i == 3
+		if want, got := pruned, rec.Pruned; got != want {
+			t.Errorf("%d: want pruned %v got %v", i, want, got)
+		}
+		if want, got := pruned, rec.Order.AdditionalInfo == "" && rec.Order.Warnings == nil; got != want {
+			t.Errorf("%d: want details pruned %v got %+v", i, want, rec.Order)
+		}
+		// the summary is kept forever
+		if want, got := before[i].Order.Cost, rec.Order.Cost; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if !rec.Time.Equal(before[i].Time) || rec.Order.TransactionID != before[i].Order.TransactionID {
+			t.Errorf("%d: want %v got %v", i, before[i], rec)
+		}
+	}
+
+	// pruned records aren't pruned again
+	if res, err = store.Prune(context.Background(), dca.PruneOptions{Before: cutoff}); err != nil {
+		t.Fatal(err)
+	} else if want, got := 0, len(res.TransactionIDs); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestFileOrderStore_Prune_ArchiveFirst(t *testing.T) {
+	cutoff := time.Now()
+	store := newPruneStore(t, cutoff.Add(-time.Hour), cutoff.Add(time.Hour))
+	original, err := os.ReadFile(store.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the store isn't rewritten when the pruned records couldn't be archived
+	failing := archiveFunc(func(string, []byte) (string, error) { return "", errors.New("archive unavailable") })
+	if _, err = store.Prune(context.Background(), dca.PruneOptions{Before: cutoff, Archive: failing}); err == nil {
+		t.Fatal("want an error")
+	}
+	if b, _ := os.ReadFile(store.Path); !bytes.Equal(b, original) {
+		t.Errorf("want the store untouched got %s", b)
+	}
+
+	// the archive holds the records as they were before pruning
+	dir := filepath.Join(t.TempDir(), "archive")
+	res, err := store.Prune(context.Background(), dca.PruneOptions{Before: cutoff, Archive: &dca.DirOrderArchive{Dir: dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(res.Archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := string(bytes.SplitAfter(original, []byte("\n"))[0]), string(archived); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(matches) != 0 {
+		t.Errorf("want no temporary files got %v", matches)
+	}
+}
+
+func TestFileOrderStore_Prune_DryRun(t *testing.T) {
+	cutoff := time.Now()
+	store := newPruneStore(t, cutoff.Add(-time.Hour), cutoff.Add(time.Hour))
+	original, err := os.ReadFile(store.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archived := false
+	archive := archiveFunc(func(string, []byte) (string, error) { archived = true; return "", nil })
+	res, err := store.Prune(context.Background(), dca.PruneOptions{Before: cutoff, Archive: archive, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := []string{"TXID-A"}, res.TransactionIDs; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if b, _ := os.ReadFile(store.Path); !bytes.Equal(b, original) || archived {
+		t.Errorf("want nothing changed got archived %v: %s", archived, b)
+	}
+}
+
+func TestFileOrderStore_Prune_Interrupted(t *testing.T) {
+	cutoff := time.Now()
+	store := newPruneStore(t, cutoff.Add(-time.Hour))
+
+	// a run appends its order while the prune is archiving, the prune gives up instead of losing it
+	appending := archiveFunc(func(string, []byte) (string, error) {
+		return "", store.Put(context.Background(), dca.OrderRecord{Time: cutoff, Order: dca.ExecuteOrderResponse{TransactionID: "TXID-B"}})
+	})
+	if _, err := store.Prune(context.Background(), dca.PruneOptions{Before: cutoff, Archive: appending}); err == nil {
+		t.Fatal("want an error")
+	}
+	records, err := store.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 2, len(records); got != want || records[0].Pruned {
+		t.Errorf("want %v unpruned records got %+v", want, records)
+	}
+
+	// a cancelled prune stops before rewriting the store
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelling := archiveFunc(func(string, []byte) (string, error) { cancel(); return "", nil })
+	if _, err = store.Prune(ctx, dca.PruneOptions{Before: cutoff, Archive: cancelling}); !errors.Is(err, context.Canceled) {
+		t.Errorf("want %v got %v", context.Canceled, err)
+	}
+	if records, _ = store.List(context.Background()); records[0].Pruned {
+		t.Errorf("want the store untouched got %+v", records)
+	}
+	if matches, _ := filepath.Glob(store.Path + ".*"); len(matches) != 0 {
+		t.Errorf("want no temporary files got %v", matches)
+	}
+}
+
+func TestApp_Run_Retention(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":       {tickerResponse},
+		"/0/private/AddOrder":    {addOrderResponse},
+		"/0/private/QueryOrders": {queryOrdersResponse},
+	})
+	store := newPruneStore(t, time.Now().AddDate(0, 0, -31))
+	app, n := newTestApp(s, dca.AppConfig{OrderStorePath: store.Path, Retention: &dca.RetentionConfig{PruneAfterDays: 30}})
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 0, len(n.summaries[0].Warnings); got != want {
+		t.Errorf("want %v got %v", want, n.summaries[0].Warnings)
+	}
+
+	// the old record is pruned at the end of the run, the run's own order is kept
+	records, err := store.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	} else if want, got := 2, len(records); got != want {
+		t.Fatalf("want %v got %v", want, got)
+	}
+	if !records[0].Pruned || records[1].Pruned {
+		t.Errorf("want only the old record pruned got %+v", records)
+	}
+}
+
+func TestRetentionConfig_Validate(t *testing.T) {
+	tt := []struct {
+		retention      dca.RetentionConfig
+		orderStorePath string
+		valid          bool
+	}{
+		{dca.RetentionConfig{PruneAfterDays: 90}, "orders.jsonl", true},
+		{dca.RetentionConfig{PruneAfterDays: 90, Archive: "s3://bucket/dca/orders"}, "orders.jsonl", true},
+		{dca.RetentionConfig{PruneAfterDays: 90, Archive: "s3:///dca/orders"}, "orders.jsonl", false},
+		{dca.RetentionConfig{}, "orders.jsonl", false},
+		{dca.RetentionConfig{PruneAfterDays: 90}, "", false},
+	}
+	for i, tc := range tt {
+		cfg := dca.AppConfig{KrakenAPIKey: "key", KrakenPrivateKey: "secret", OrderAmountInCents: 500, OrderStorePath: tc.orderStorePath, Retention: &tc.retention}
+		if want, got := tc.valid, cfg.Validate() == nil; got != want {
+			t.Errorf("%d: want valid %v got %v", i, want, cfg.Validate())
+		}
+	}
+}
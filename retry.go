@@ -0,0 +1,82 @@
+package dca
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// DefaultRetryBackoff is the wait before the first retry of a run, it doubles with every further retry.
+const DefaultRetryBackoff = 10 * time.Second
+
+// RunAttempt is an attempt of a run that was retried.
+type RunAttempt struct {
+	Attempt int    `json:"attempt" desc:"The number of the attempt, starting at 1" schema:"required"`
+	Error   string `json:"error,omitempty" desc:"Why the attempt failed, empty for the attempt that ended the run"`
+}
+
+// IsTransient reports whether err is a failure that may not happen again, such as a network error, a 5xx response,
+// the exchange being unavailable or a rate limit. Skips, business errors such as insufficient funds and errors that
+// aren't recognised aren't transient.
+func IsTransient(err error) bool {
+	var skip *SkipError
+	var netErr net.Error
+	switch {
+	case err == nil, errors.As(err, &skip):
+		return false
+	case errors.Is(err, ErrExchangeUnavailable), errors.Is(err, ErrRateLimited):
+		return true
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.As(err, &netErr):
+		return true
+	}
+	return false
+}
+
+// runAttempts runs the order flow up to retryMaxAttempts times while it fails transiently, waiting retryBackoff,
+// doubled every time, between attempts. Every attempt starts from summary and the summary of the last attempt is
+// kept with the attempts recorded in it. Retries reconcile before ordering so an order placed by a failed attempt is
+// adopted instead of placed again.
+func (m *App) runAttempts(ctx context.Context, summary *RunSummary) (err error) {
+	maxAttempts := max(m.Config.RetryMaxAttempts, 1)
+	// validated by LoadConfig, an empty backoff uses the default
+	backoff, _ := time.ParseDuration(m.Config.RetryBackoff)
+	if m.Config.RetryBackoff == "" {
+		backoff = DefaultRetryBackoff
+	}
+
+	base := *summary
+	var attempts []RunAttempt
+	for attempt := 1; ; attempt++ {
+		*summary = base
+		err = m.run(ctx, summary, attempt > 1)
+		if err == nil || attempt >= maxAttempts || !IsTransient(err) || interrupted(ctx) != nil {
+			if maxAttempts > 1 {
+				summary.Attempts = append(attempts, RunAttempt{Attempt: attempt, Error: errorString(err)})
+			}
+			return err
+		}
+
+		attempts = append(attempts, RunAttempt{Attempt: attempt, Error: err.Error()})
+		m.Logger.WarnContext(ctx, "retrying transient failure", "attempt", attempt, "maxAttempts", maxAttempts, "backoff", backoff, "error", err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-interruptedDone(ctx):
+			timer.Stop()
+			summary.Attempts = attempts
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// errorString returns the message of err, empty for a nil error.
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,117 @@
+package dca_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+func TestIsTransient(t *testing.T) {
+	tt := []struct {
+		err      error
+		expected bool
+	}{
+		{fmt.Errorf("KrakenProvider.ExecuteOrder: %w", dca.ErrExchangeUnavailable), true},
+		{dca.ErrRateLimited, true},
+		{fmt.Errorf("failed to do request: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}), true},
+		{fmt.Errorf("failed to read response body: %w", io.ErrUnexpectedEOF), true},
+		{dca.ErrInsufficientFunds, false},
+		{dca.ErrOrderToSmall, false},
+		{dca.ErrInvalidAuth, false},
+		{dca.ErrDepositPending, false},
+		{errors.New("EGeneral:Invalid arguments"), false},
+		{nil, false},
+	}
+	for i, tc := range tt {
+		if want, got := tc.expected, dca.IsTransient(tc.err); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestKrakenProvider_ExecuteOrder_ServerError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<html>bad gateway</html>", http.StatusBadGateway)
+	}))
+	t.Cleanup(s.Close)
+
+	p := dca.NewKrakenProvider(&dca.KrakenProviderConfig{BaseURL: s.URL, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if _, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500}); !errors.Is(err, dca.ErrExchangeUnavailable) {
+		t.Errorf("want %v got %v", dca.ErrExchangeUnavailable, err)
+	}
+}
+
+func TestApp_Run_Retry(t *testing.T) {
+	const (
+		unavailable  = `{"error":["EService:Unavailable"]}`
+		noOpen       = `{"error":[],"result":{"open":{}}}`
+		noClosed     = `{"error":[],"result":{"closed":{},"count":0}}`
+		insufficient = `{"error":["EOrder:Insufficient funds"]}`
+	)
+	placed := `{"error":[],"result":{"closed":{"TXID-1":{"userref":3530,"status":"closed","opentm":` + formatFloat(float64(time.Now().Unix())) +
+		`,"descr":{"ordertype":"market","order":"buy 0.0001 XBTUSD @ market"},"vol":"0.0001","vol_exec":"0.0001","cost":"5.00","fee":"0.02","price":"50000.0"}},"count":1}}`
+
+	tt := []struct {
+		maxAttempts int
+		addOrder    []string
+		queryOrders []string
+		closed      string
+		expected    dca.RunStatus
+		attempts    int
+		orders      int
+		adopted     int
+	}{
+		{3, []string{unavailable, addOrderResponse}, []string{queryOrdersResponse}, noClosed, dca.RunStatusSuccess, 2, 2, 0},
+		{2, []string{unavailable}, []string{queryOrdersResponse}, noClosed, dca.RunStatusFailed, 2, 2, 0},
+		// business errors are never retried
+		{3, []string{insufficient}, []string{queryOrdersResponse}, noClosed, dca.RunStatusFailed, 1, 1, 0},
+		// the default is a single attempt
+		{0, []string{unavailable}, []string{queryOrdersResponse}, noClosed, dca.RunStatusFailed, 0, 1, 0},
+		// the order was placed before the failure so the retry adopts it instead of ordering again
+		{3, []string{addOrderResponse}, []string{unavailable}, placed, dca.RunStatusSuccess, 2, 1, 1},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus":  {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":        {tickerResponse},
+			"/0/private/AddOrder":     tc.addOrder,
+			"/0/private/QueryOrders":  tc.queryOrders,
+			"/0/private/OpenOrders":   {noOpen},
+			"/0/private/ClosedOrders": {tc.closed},
+		})
+		storePath := filepath.Join(t.TempDir(), "orders.jsonl")
+		app, n := newTestApp(s, dca.AppConfig{OrderStorePath: storePath, RetryMaxAttempts: tc.maxAttempts, RetryBackoff: "1ms"})
+
+		_ = app.Run(context.Background())
+
+		summary := n.summaries[0]
+		if want, got := tc.expected, summary.Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.attempts, len(summary.Attempts); got != want {
+			t.Errorf("%d: want %v attempts got %v", i, want, got)
+		} else if got > 1 && summary.Attempts[0].Error == "" {
+			t.Errorf("%d: want the error of the first attempt", i)
+		}
+		if want, got := tc.orders, len(s.Requests("/0/private/AddOrder")); got != want {
+			t.Errorf("%d: want %v AddOrder requests got %v", i, want, got)
+		}
+		if want, got := tc.adopted, len(summary.Adopted); got != want {
+			t.Errorf("%d: want %v adopted got %v", i, want, got)
+		}
+		// only retries reconcile
+		if want, got := max(tc.attempts-1, 0), len(s.Requests("/0/private/ClosedOrders")); got != want {
+			t.Errorf("%d: want %v reconciliations got %v", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package dca
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Local files are written so a crash at any point leaves them readable. Whole documents are written to a synced
+// temporary file in the same directory which is renamed over the document, so a reader sees either the old or the new
+// document. Records are appended as lines with a single synced write, a crash during the write leaves at most a final
+// line without its newline which readers drop and the next append trims.
+
+// writeTemp writes b to a synced temporary file in the directory of path and returns its name, the file is moved
+// into place with replaceFile.
+func writeTemp(path string, b []byte) (tmp string, err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	if _, err = f.Write(b); err != nil {
+		return "", err
+	}
+	return f.Name(), f.Sync()
+}
+
+// replaceFile renames the temporary file tmp over path and syncs the directory so the rename survives a crash.
+func replaceFile(tmp, path string) error {
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with b, see writeTemp. The file is only readable by its owner.
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := writeTemp(path, b)
+	if err != nil {
+		return err
+	}
+	return replaceFile(tmp, path)
+}
+
+// syncDir syncs the directory dir, on a best effort basis since not every platform can.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+}
+
+// openAppend opens the file at path for appending, creating it readable only by its owner. A final line left without
+// its newline by a crash is trimmed first, so the next record doesn't run into it.
+func openAppend(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err = trimTornLine(f); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to trim the torn last line of %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// trimTornLine truncates f after its last newline when it doesn't end with one.
+func trimTornLine(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+
+	// the last line is read back in blocks until its start is found
+	const block = 4096
+	end := info.Size()
+	buf := make([]byte, block)
+	for off := end; off > 0; {
+		n := min(off, block)
+		off -= n
+		if _, err = f.ReadAt(buf[:n], off); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		i := bytes.LastIndexByte(buf[:n], '\n')
+		if off+n == end && i == int(n)-1 {
+			return nil
+		} else if i >= 0 {
+			return f.Truncate(off + int64(i) + 1)
+		}
+	}
+	return f.Truncate(0)
+}
+
+// appendLine appends line, which mustn't hold a newline, to the file at path with a single write and syncs it.
+func appendLine(path string, line []byte) (err error) {
+	f, err := openAppend(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// corruptFile describes a file quarantined by readLines.
+type corruptFile struct {
+	// Quarantine is where the corrupt file was moved to.
+	Quarantine string
+	// Line is the first line which failed to validate, and Err why.
+	Line int
+	Err  error
+}
+
+func (c *corruptFile) Error() string {
+	return fmt.Sprintf("line %d is corrupt, the file was moved to %s: %v", c.Line, c.Quarantine, c.Err)
+}
+
+// readLines returns the non-empty lines of the file at path, nil when it doesn't exist. A final line without its
+// newline was torn by a crash while it was appended and is dropped. When a complete line fails validate, the file is
+// corrupt: it's moved aside to path.<time>.corrupt and a fresh file holding the valid lines takes its place, the
+// lines are returned with a *corruptFile describing the quarantine.
+func readLines(path string, validate func(line []byte) error) (lines [][]byte, corrupt *corruptFile, err error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	if i := bytes.LastIndexByte(b, '\n'); i < len(b)-1 {
+		b = b[:i+1]
+	}
+	var valid bytes.Buffer
+	for i, line := range bytes.Split(b, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if verr := validate(line); verr != nil {
+			if corrupt == nil {
+				corrupt = &corruptFile{Line: i + 1, Err: verr}
+			}
+			continue
+		}
+		lines = append(lines, line)
+		valid.Write(line)
+		valid.WriteByte('\n')
+	}
+	if corrupt == nil {
+		return lines, nil, nil
+	}
+
+	if corrupt.Quarantine, err = quarantine(path); err != nil {
+		return nil, nil, fmt.Errorf("failed to quarantine corrupt line %d: %w", corrupt.Line, err)
+	}
+	return lines, corrupt, writeFileAtomic(path, valid.Bytes())
+}
+
+// quarantine moves the corrupt file at path aside to path.<time>.corrupt, where it's kept for inspection, and returns
+// its new name.
+func quarantine(path string) (string, error) {
+	name := path + "." + time.Now().UTC().Format("20060102T150405.000000000Z") + ".corrupt"
+	if err := os.Rename(path, name); err != nil {
+		return "", err
+	}
+	syncDir(filepath.Dir(path))
+	return name, nil
+}
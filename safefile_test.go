@@ -0,0 +1,123 @@
+package dca_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+func TestFileOrderStore_TornWrite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "orders.jsonl")
+	store := dca.NewFileOrderStore(path)
+	at := time.Date(2024, 4, 28, 10, 28, 20, 0, time.UTC)
+	for _, txid := range []string{"TXID-1", "TXID-2"} {
+		if err := store.Put(ctx, dca.OrderRecord{Time: at, RunID: txid, Order: dca.ExecuteOrderResponse{TransactionID: txid}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := len(b) / 2
+	for first < len(b) && b[first-1] != '\n' {
+		first--
+	}
+
+	// a crash at any point of the second append leaves the first record, and the store takes further records
+	for size := first; size < len(b); size++ {
+		if err = os.WriteFile(path, b[:size], 0600); err != nil {
+			t.Fatal(err)
+		}
+		records, err := store.List(ctx)
+		if err != nil {
+			t.Fatalf("%d: %v", size, err)
+		}
+		if want, got := 1, len(records); got != want {
+			t.Fatalf("%d: want %v got %v", size, want, got)
+		}
+		if err = store.Put(ctx, dca.OrderRecord{Time: at, Order: dca.ExecuteOrderResponse{TransactionID: "TXID-3"}}); err != nil {
+			t.Fatalf("%d: %v", size, err)
+		}
+		if records, err = store.List(ctx); err != nil {
+			t.Fatalf("%d: %v", size, err)
+		}
+		if want, got := "TXID-1TXID-3", records[0].Order.TransactionID+records[len(records)-1].Order.TransactionID; len(records) != 2 || got != want {
+			t.Fatalf("%d: want %v got %+v", size, want, records)
+		}
+	}
+	if corrupt, _ := filepath.Glob(path + ".*.corrupt"); len(corrupt) != 0 {
+		t.Errorf("want no quarantined files got %v", corrupt)
+	}
+}
+
+func TestFileOrderStore_Corrupt(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "orders.jsonl")
+	content := `{"time":"2024-04-28T10:28:20Z","order":{"transactionId":"TXID-1"}}` + "\n" +
+		"garbage\n" +
+		`{"time":"2024-04-28T11:28:20Z","order":{"transactionId":"TXID-2"}}` + "\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the corrupt file is kept aside and the valid records remain readable and appendable
+	store := dca.NewFileOrderStore(path)
+	records, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 2, len(records); got != want {
+		t.Fatalf("want %v got %v", want, got)
+	}
+	corrupt, _ := filepath.Glob(path + ".*.corrupt")
+	if want, got := 1, len(corrupt); got != want {
+		t.Fatalf("want %v got %v", want, got)
+	}
+	if b, err := os.ReadFile(corrupt[0]); err != nil || string(b) != content {
+		t.Errorf("want the corrupt file kept got %q %v", b, err)
+	}
+
+	if err = store.Put(ctx, dca.OrderRecord{Order: dca.ExecuteOrderResponse{TransactionID: "TXID-3"}}); err != nil {
+		t.Fatal(err)
+	}
+	if records, err = store.List(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 3, len(records); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestFilePairMetadataStore_Corrupt(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "pairs.json")
+	store := &dca.FilePairMetadataStore{Path: path}
+	if err := store.Save(ctx, []byte(`{"XBTUSD":{"pair":"XBTUSD"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a torn document is quarantined so the metadata is fetched afresh
+	if err = os.WriteFile(path, b[:len(b)/2], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = store.Load(ctx); err != nil || b != nil {
+		t.Fatalf("want nothing loaded got %q %v", b, err)
+	}
+	if corrupt, _ := filepath.Glob(path + ".*.corrupt"); len(corrupt) != 1 {
+		t.Errorf("want the corrupt file kept got %v", corrupt)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("want the corrupt file moved got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package dca
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DefaultScheduleDriftWarning is how late a run may start before a warning is added to its summary.
+const DefaultScheduleDriftWarning = 5 * time.Minute
+
+// maxScheduleDrift bounds the drift considered plausible, scheduled times further away are treated as malformed.
+const maxScheduleDrift = 24 * time.Hour
+
+// ScheduleDrift describes how late a run started compared to when it was scheduled.
+type ScheduleDrift struct {
+	ScheduledAt time.Time `json:"scheduledAt" desc:"When the run was scheduled to start" schema:"required"`
+	// Seconds is negative when the run started before its scheduled time, e.g. due to clock skew.
+	Seconds float64 `json:"seconds" desc:"How many seconds after the scheduled time the run started" schema:"required"`
+}
+
+// ScheduledTime returns the time field of an EventBridge event, the time a scheduled event was due. The zero time is
+// returned when the event has no valid time.
+func ScheduledTime(event []byte) time.Time {
+	var e struct {
+		Time string `json:"time"`
+	}
+	if err := json.Unmarshal(event, &e); err != nil {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339, e.Time)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// EventProfile returns the profile field of the detail of an EventBridge event, the config profile the run should
+// use. An empty string is returned when the event has none.
+func EventProfile(event []byte) string {
+	var e struct {
+		Detail struct {
+			Profile string `json:"profile"`
+		} `json:"detail"`
+	}
+	if err := json.Unmarshal(event, &e); err != nil {
+		return ""
+	}
+	return e.Detail.Profile
+}
+
+// scheduleDrift compares startedAt to ScheduledAt, adding a warning to summary when the run is later than the
+// configured threshold. Missing or implausible scheduled times are ignored.
+func (m *App) scheduleDrift(ctx context.Context, startedAt time.Time, summary *RunSummary) {
+	if m.ScheduledAt.IsZero() {
+		return
+	}
+
+	drift := startedAt.Sub(m.ScheduledAt)
+	if drift > maxScheduleDrift || drift < -maxScheduleDrift {
+		m.Logger.WarnContext(ctx, "ignoring implausible scheduled time", "scheduledAt", m.ScheduledAt, "startedAt", startedAt)
+		return
+	}
+
+	summary.Schedule = &ScheduleDrift{ScheduledAt: m.ScheduledAt.In(startedAt.Location()), Seconds: drift.Seconds()}
+	m.Logger.InfoContext(ctx, "schedule drift", "scheduledAt", m.ScheduledAt, "drift", drift.String())
+
+	// validated by LoadConfig
+	threshold := DefaultScheduleDriftWarning
+	if m.Config.ScheduleDriftWarning != "" {
+		threshold, _ = time.ParseDuration(m.Config.ScheduleDriftWarning)
+	}
+
+	if drift > threshold {
+		m.Logger.WarnContext(ctx, "run started late", "drift", drift.String(), "threshold", threshold.String())
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("run started %s after its scheduled time", drift.Round(time.Second)))
+	}
+}
@@ -0,0 +1,97 @@
+package dca_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+func TestScheduledTime(t *testing.T) {
+	tt := []struct {
+		event    string
+		expected time.Time
+	}{
+		{`{"version":"0","id":"1","detail-type":"Scheduled Event","source":"aws.events","time":"2024-05-01T14:00:00Z","detail":{}}`, time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)},
+		{`{"detail-type":"Scheduled Event","time":"2024-05-01T14:00:00+02:00"}`, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+		{`{"detail-type":"Scheduled Event"}`, time.Time{}},
+		{`{"detail-type":"Scheduled Event","time":"yesterday"}`, time.Time{}},
+		{`{"time":1714572000}`, time.Time{}},
+		{`not json`, time.Time{}},
+	}
+	for i, tc := range tt {
+		if want, got := tc.expected, dca.ScheduledTime([]byte(tc.event)); !got.Equal(want) {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestApp_Run_ScheduleDrift(t *testing.T) {
+	tt := []struct {
+		scheduledAt time.Time
+		threshold   string
+		drift       bool
+		warning     bool
+	}{
+		{time.Time{}, "", false, false},
+		{time.Now().Add(-time.Minute), "", true, false},
+		{time.Now().Add(-10 * time.Minute), "", true, true},
+		{time.Now().Add(-10 * time.Minute), "15m", true, false},
+		// a scheduled time days away can't be a late start
+		{time.Now().Add(-72 * time.Hour), "", false, false},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		app, n := newTestApp(s, dca.AppConfig{ScheduleDriftWarning: tc.threshold})
+		app.ScheduledAt = tc.scheduledAt
+
+		if err := app.Run(context.Background()); err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+
+		summary := n.summaries[0]
+		if want, got := tc.drift, summary.Schedule != nil; got != want {
+			t.Fatalf("%d: want drift %v got %v", i, want, got)
+		}
+		if tc.drift {
+			if want, got := tc.scheduledAt, summary.Schedule.ScheduledAt; !got.Equal(want) {
+				t.Errorf("%d: want %v got %v", i, want, got)
+			}
+			if want, got := summary.StartedAt.Sub(tc.scheduledAt).Seconds(), summary.Schedule.Seconds; got != want {
+				t.Errorf("%d: want %v got %v", i, want, got)
+			}
+		}
+
+		var warned bool
+		for _, w := range summary.Warnings {
+			warned = warned || strings.Contains(w, "after its scheduled time")
+		}
+		if want, got := tc.warning, warned; got != want {
+			t.Errorf("%d: want warning %v got %v: %v", i, want, got, summary.Warnings)
+		}
+	}
+}
+
+func TestEventProfile(t *testing.T) {
+	tt := []struct {
+		event    string
+		expected string
+	}{
+		{`{"time":"2024-03-01T02:00:00Z","detail":{"profile":"monthly-big"}}`, "monthly-big"},
+		{`{"time":"2024-03-01T02:00:00Z","detail":{}}`, ""},
+		{`{"detail":{"profile":5}}`, ""},
+		{`not json`, ""},
+	}
+	for i, tc := range tt {
+		if want, got := tc.expected, dca.EventProfile([]byte(tc.event)); got != want {
+			t.Errorf("%d: want %q got %q", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Package schema generates JSON Schema documents describing the events, records and config of the dca package.
+//
+// Descriptions are taken from the desc struct tag, properties tagged schema:"required" are required and
+// enumerations are taken from the enum struct tag as a comma separated list.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+// Draft is the JSON Schema dialect of the generated documents.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Document is a named schema of a dca type.
+type Document struct {
+	// Name identifies the document, e.g. run-summary
+	Name        string
+	Description string
+	value       any
+}
+
+// Documents are the schemas of the types other systems depend on.
+var Documents = []Document{
+	{Name: "run-summary", Description: "The summary of a run sent to notifiers.", value: dca.RunSummary{}},
+	{Name: "order-record", Description: "An order recorded in the order store.", value: dca.OrderRecord{}},
+	{Name: "config", Description: "The application config file.", value: dca.AppConfig{}},
+	{Name: "failure-record", Description: "The post-mortem of a failed run written to the failure archive.", value: dca.FailureRecord{}},
+	{Name: "price-sample", Description: "A ticker snapshot written to the price log.", value: dca.PriceSample{}},
+}
+
+// Lookup returns the document called name.
+func Lookup(name string) (Document, bool) {
+	for _, doc := range Documents {
+		if doc.Name == name {
+			return doc, true
+		}
+	}
+	return Document{}, false
+}
+
+// Names returns the names of every document.
+func Names() []string {
+	names := make([]string, 0, len(Documents))
+	for _, doc := range Documents {
+		names = append(names, doc.Name)
+	}
+	return names
+}
+
+// Generate returns the indented JSON Schema of the document.
+func (d Document) Generate() ([]byte, error) {
+	s := schemaOf(reflect.TypeOf(d.value))
+	s["$schema"] = Draft
+	s["$id"] = fmt.Sprintf("https://github.com/1gm/dca/schema/%s/v%d.json", d.Name, dca.SchemaVersion)
+	s["title"] = d.Name
+	s["description"] = d.Description
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s schema: %w", d.Name, err)
+	}
+	return append(b, '\n'), nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf returns the schema of t, nested structs are inlined.
+func schemaOf(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	default:
+		return map[string]any{}
+	}
+}
+
+// structSchema returns the schema of the JSON encoded fields of the struct t.
+func structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		} else if name == "" {
+			name = field.Name
+		}
+
+		property := schemaOf(field.Type)
+		if desc := field.Tag.Get("desc"); desc != "" {
+			property["description"] = desc
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			property["enum"] = enumValues(property["type"], strings.Split(enum, ","))
+		}
+		properties[name] = property
+
+		if field.Tag.Get("schema") == "required" {
+			required = append(required, name)
+		}
+	}
+
+	s := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
+
+// enumValues converts the values of an enum tag to numbers when the property is numeric.
+func enumValues(typ any, values []string) []any {
+	enum := make([]any, 0, len(values))
+	for _, v := range values {
+		if typ == "integer" || typ == "number" {
+			if n, err := strconv.ParseFloat(v, 64); err == nil {
+				enum = append(enum, n)
+				continue
+			}
+		}
+		enum = append(enum, v)
+	}
+	return enum
+}
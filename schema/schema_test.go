@@ -0,0 +1,107 @@
+package schema_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/1gm/dca/schema"
+)
+
+var update = flag.Bool("update", false, "rewrite the committed schema files")
+
+// TestDocuments fails when a struct changes without the committed schema being updated, run
+// go test ./schema -update to accept the change and bump dca.SchemaVersion if it isn't backwards compatible.
+func TestDocuments(t *testing.T) {
+	for _, doc := range schema.Documents {
+		got, err := doc.Generate()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", doc.Name, err)
+		}
+
+		filename := doc.Name + ".schema.json"
+		if *update {
+			if err = os.WriteFile(filename, got, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		want, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatalf("%s: %v", doc.Name, err)
+		}
+		if !bytes.Equal(want, got) {
+			t.Errorf("%s: generated schema differs from %s, run go test ./schema -update if the change is intended", doc.Name, filename)
+		}
+	}
+}
+
+func TestDocument_Generate(t *testing.T) {
+	doc, ok := schema.Lookup("run-summary")
+	if !ok {
+		t.Fatal("run-summary document not found")
+	}
+
+	b, err := doc.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var s struct {
+		Schema     string   `json:"$schema"`
+		Required   []string `json:"required"`
+		Properties map[string]struct {
+			Type        string   `json:"type"`
+			Format      string   `json:"format"`
+			Description string   `json:"description"`
+			Enum        []string `json:"enum"`
+		} `json:"properties"`
+	}
+	if err = json.Unmarshal(b, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := schema.Draft, s.Schema; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := "localDate,schemaVersion,startedAt,status", strings.Join(s.Required, ","); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	tt := []struct {
+		property string
+		typ      string
+		format   string
+		enum     string
+	}{
+		{"startedAt", "string", "date-time", ""},
+		{"status", "string", "", "success,skipped,failed,interrupted"},
+		{"order", "object", "", ""},
+		{"adopted", "array", "", ""},
+		{"warnings", "array", "", ""},
+		{"schemaVersion", "integer", "", ""},
+	}
+	for i, tc := range tt {
+		p, ok := s.Properties[tc.property]
+		if !ok {
+			t.Errorf("%d: missing property %s", i, tc.property)
+			continue
+		}
+		if want, got := tc.typ, p.Type; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.format, p.Format; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.enum, strings.Join(p.Enum, ","); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if p.Description == "" {
+			t.Errorf("%d: missing description for %s", i, tc.property)
+		}
+	}
+}
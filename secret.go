@@ -0,0 +1,84 @@
+package dca
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// secretsResolveTimeout bounds the time spent resolving every secret referenced by a config.
+	secretsResolveTimeout = 10 * time.Second
+	// secretsMaxWorkers bounds the number of secrets resolved concurrently.
+	secretsMaxWorkers = 4
+)
+
+// SecretResolver returns the value referenced by a secret reference such as "awsssme://kraken/api-key".
+type SecretResolver func(ctx context.Context, ref string) ([]byte, error)
+
+// secretField is a config value that may hold a secret reference, Name is used in error messages.
+type secretField struct {
+	Name  string
+	Value *string
+	// Set, when not nil, also receives stored values, for values that aren't addressable such as map entries.
+	Set func(string)
+}
+
+// store sets the value of the field.
+func (f secretField) store(v string) {
+	*f.Value = v
+	if f.Set != nil {
+		f.Set(v)
+	}
+}
+
+// resolveSecrets resolves every field holding a secret reference concurrently under a single deadline.
+// Resolved values are only applied once every field has resolved so a failure leaves all fields untouched.
+func resolveSecrets(ctx context.Context, resolve SecretResolver, fields []secretField) error {
+	ctx, cancel := context.WithTimeout(ctx, secretsResolveTimeout)
+	defer cancel()
+
+	values := make([][]byte, len(fields))
+	errs := make([]error, len(fields))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, secretsMaxWorkers)
+	for i, field := range fields {
+		if !HasAWSParamStorePrefix(*field.Value) {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			values[i], errs[i] = resolve(ctx, *field.Value)
+		}()
+	}
+	wg.Wait()
+
+	var err error
+	for i, field := range fields {
+		if errs[i] != nil {
+			err = errors.Join(err, fmt.Errorf("%s: %w", field.Name, errs[i]))
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to resolve secrets: %w", err)
+	}
+
+	for i, field := range fields {
+		if values[i] != nil {
+			field.store(string(values[i]))
+		}
+	}
+	return nil
+}
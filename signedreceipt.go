@@ -0,0 +1,288 @@
+package dca
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SignedReceiptVersion is the version of the signed receipt format, it's incremented whenever the payload or its
+// canonical form changes in a way that isn't backwards compatible.
+const SignedReceiptVersion = 1
+
+// SignedReceiptAlgorithm is the signature algorithm of signed receipts.
+const SignedReceiptAlgorithm = "ed25519"
+
+// SignedReceiptConfig signs a receipt of every purchase so it can be shared as a tamper-evident proof.
+type SignedReceiptConfig struct {
+	// PrivateKey is the Ed25519 key receipts are signed with, base64 of the 32 byte seed or 64 byte key, or a PKCS #8
+	// PEM block as written by openssl genpkey -algorithm ed25519. It may be a secret reference.
+	PrivateKey string `json:"privateKey" desc:"The Ed25519 key receipts are signed with, base64 of the seed or a PKCS #8 PEM block, or a reference such as awsssme://dca/receipt-key" schema:"required"`
+	// Destination is where receipts are written besides the run summary, a local directory or an S3 URL such as
+	// s3://bucket/prefix. Receipts are only added to the run summary without one.
+	Destination string `json:"destination" desc:"A local directory or S3 URL such as s3://bucket/prefix receipts are written to besides the run summary"`
+}
+
+// Validate checks the configuration is usable, a private key that's a secret reference is checked once resolved.
+func (c SignedReceiptConfig) Validate() error {
+	if c.PrivateKey == "" {
+		return fieldErr("privateKey", errors.New("signedReceipts privateKey is required"))
+	} else if !HasAWSParamStorePrefix(c.PrivateKey) {
+		if _, err := ParseSigningKey(c.PrivateKey); err != nil {
+			return fieldErr("privateKey", fmt.Errorf("invalid signedReceipts privateKey: %w", err))
+		}
+	}
+	if strings.HasPrefix(c.Destination, S3Prefix) {
+		if u, err := url.Parse(c.Destination); err != nil {
+			return fieldErr("destination", fmt.Errorf("invalid signedReceipts destination: %w", err))
+		} else if u.Host == "" {
+			return fieldErr("destination", errors.New("signedReceipts destination is missing an S3 bucket"))
+		}
+	}
+	return nil
+}
+
+// ReceiptPayload is what a signed receipt attests to, a purchase and the run which placed it.
+type ReceiptPayload struct {
+	Version       int    `json:"version" desc:"The version of the signed receipt format" schema:"required"`
+	RunID         string `json:"runId" desc:"The identifier of the run which placed the order" schema:"required"`
+	CorrelationID string `json:"correlationId,omitempty" desc:"Traces the run which placed the order across systems"`
+	Label         string `json:"label,omitempty" desc:"The goal the order is attributed to"`
+	Profile       string `json:"profile,omitempty" desc:"The config profile of the run which placed the order"`
+	// LocalDate is the date of the run in the reporting time zone.
+	LocalDate string               `json:"localDate" desc:"The calendar date of the run in the reporting time zone" schema:"required"`
+	SignedAt  time.Time            `json:"signedAt" desc:"When the receipt was signed" schema:"required"`
+	Order     ExecuteOrderResponse `json:"order" desc:"The purchase" schema:"required"`
+}
+
+// SignedReceipt is a ReceiptPayload with an Ed25519 signature of its canonical JSON, see CanonicalJSON.
+type SignedReceipt struct {
+	Payload   ReceiptPayload `json:"payload" desc:"What the receipt attests to" schema:"required"`
+	Algorithm string         `json:"algorithm" desc:"The signature algorithm" enum:"ed25519" schema:"required"`
+	// PublicKey is the base64 key the receipt was signed with, recipients must compare it to the key they trust.
+	PublicKey string `json:"publicKey" desc:"The base64 public key the receipt was signed with" schema:"required"`
+	Signature string `json:"signature" desc:"The base64 signature of the canonical JSON of the payload" schema:"required"`
+}
+
+// CanonicalJSON returns the canonical form of the JSON encoding of v: object keys sorted, no insignificant
+// whitespace, numbers as they were written and no escaping of HTML characters. Documents that differ only in key order
+// or formatting share a canonical form, so a receipt still verifies after being pretty printed.
+func CanonicalJSON(v any) ([]byte, error) {
+	b, ok := v.(json.RawMessage)
+	if !ok {
+		var err error
+		if b, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+
+	// numbers are decoded as json.Number so they're written back unchanged, maps are encoded with sorted keys
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var doc any
+	if err := d.Decode(&doc); err != nil {
+		return nil, err
+	} else if d.More() {
+		return nil, errors.New("unexpected data after the JSON document")
+	}
+
+	var buf bytes.Buffer
+	e := json.NewEncoder(&buf)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(doc); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// ParseSigningKey parses an Ed25519 private key, base64 of the 32 byte seed or 64 byte key, or a PKCS #8 PEM block.
+func ParseSigningKey(s string) (ed25519.PrivateKey, error) {
+	s = strings.TrimSpace(s)
+	if block, _ := pem.Decode([]byte(s)); block != nil {
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if k, ok := key.(ed25519.PrivateKey); ok {
+			return k, nil
+		}
+		return nil, fmt.Errorf("%T isn't an Ed25519 key", key)
+	}
+
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("the key is neither base64 nor PEM: %w", err)
+	}
+	switch len(b) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(b), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(b), nil
+	}
+	return nil, fmt.Errorf("the key is %d bytes, not a %d byte seed or %d byte key", len(b), ed25519.SeedSize, ed25519.PrivateKeySize)
+}
+
+// ParsePublicKey parses an Ed25519 public key, base64 of the 32 byte key or a PKIX PEM block.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	s = strings.TrimSpace(s)
+	if block, _ := pem.Decode([]byte(s)); block != nil {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if k, ok := key.(ed25519.PublicKey); ok {
+			return k, nil
+		}
+		return nil, fmt.Errorf("%T isn't an Ed25519 key", key)
+	}
+
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("the key is neither base64 nor PEM: %w", err)
+	} else if len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("the key is %d bytes, not %d", len(b), ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// SignReceipt signs payload with key.
+func SignReceipt(payload ReceiptPayload, key ed25519.PrivateKey) (receipt SignedReceipt, err error) {
+	defer WrapErr(&err, "SignReceipt")
+
+	b, err := CanonicalJSON(payload)
+	if err != nil {
+		return receipt, fmt.Errorf("failed to canonicalize payload: %w", err)
+	}
+	return SignedReceipt{
+		Payload:   payload,
+		Algorithm: SignedReceiptAlgorithm,
+		PublicKey: base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, b)),
+	}, nil
+}
+
+// VerifyReceipt checks the signed receipt document b was signed by key and returns its payload. The payload is
+// canonicalized as it's found in the document, so fields added by later versions are covered by the signature too.
+func VerifyReceipt(b []byte, key ed25519.PublicKey) (payload ReceiptPayload, err error) {
+	defer WrapErr(&err, "VerifyReceipt")
+
+	var doc struct {
+		Payload   json.RawMessage `json:"payload"`
+		Algorithm string          `json:"algorithm"`
+		PublicKey string          `json:"publicKey"`
+		Signature string          `json:"signature"`
+	}
+	if err = json.Unmarshal(b, &doc); err != nil {
+		return payload, fmt.Errorf("failed to unmarshal receipt: %w", err)
+	} else if doc.Algorithm != SignedReceiptAlgorithm {
+		return payload, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidReceipt, doc.Algorithm)
+	} else if doc.PublicKey != base64.StdEncoding.EncodeToString(key) {
+		return payload, fmt.Errorf("%w: signed by a different key %s", ErrInvalidReceipt, doc.PublicKey)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(doc.Signature)
+	if err != nil {
+		return payload, fmt.Errorf("%w: failed to decode signature: %v", ErrInvalidReceipt, err)
+	}
+	canonical, err := CanonicalJSON(doc.Payload)
+	if err != nil {
+		return payload, fmt.Errorf("failed to canonicalize payload: %w", err)
+	}
+	if !ed25519.Verify(key, canonical, signature) {
+		return payload, fmt.Errorf("%w: the signature doesn't match the payload", ErrInvalidReceipt)
+	}
+
+	if err = json.Unmarshal(doc.Payload, &payload); err != nil {
+		return payload, fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+	return payload, nil
+}
+
+// signedReceiptName names the document of receipt so documents sort by time.
+func signedReceiptName(receipt SignedReceipt) string {
+	return receipt.Payload.SignedAt.UTC().Format("20060102T150405Z") + "-" + receipt.Payload.RunID + ".receipt.json"
+}
+
+// writeSignedReceipt writes receipt to destination, a local directory or an S3 URL.
+func writeSignedReceipt(ctx context.Context, destination string, receipt SignedReceipt, client *http.Client) error {
+	b, err := json.MarshalIndent(receipt, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal receipt: %w", err)
+	}
+
+	if !strings.HasPrefix(destination, S3Prefix) {
+		if err = os.MkdirAll(destination, 0700); err != nil {
+			return err
+		}
+		return writeFileAtomic(filepath.Join(destination, signedReceiptName(receipt)), append(b, '\n'))
+	}
+
+	// validated by LoadConfig
+	u, err := url.Parse(destination)
+	if err != nil {
+		return err
+	}
+	obj := S3Location{Bucket: u.Host, HTTPClient: client}.object(path.Join(strings.Trim(u.Path, "/"), signedReceiptName(receipt)))
+	if _, err = s3Request(ctx, obj, "PUT", b); err != nil {
+		return fmt.Errorf("failed to put receipt: %w", err)
+	}
+	return nil
+}
+
+// signReceipt adds a signed receipt of the run's purchase to summary and writes it to the configured destination.
+// Signing never changes the outcome of the run so failures are only warnings.
+func (m *App) signReceipt(ctx context.Context, summary *RunSummary) {
+	if m.Config.SignedReceipts == nil || summary.Order == nil {
+		return
+	}
+	cfg := *m.Config.SignedReceipts
+
+	warn := func(msg string, err error) {
+		m.Logger.WarnContext(ctx, msg, "error", err)
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("%s: %v", msg, err))
+	}
+
+	// resolved by LoadConfig
+	key, err := ParseSigningKey(cfg.PrivateKey)
+	if err != nil {
+		warn("failed to parse the receipt signing key", err)
+		return
+	}
+	receipt, err := SignReceipt(ReceiptPayload{
+		Version:       SignedReceiptVersion,
+		RunID:         summary.RunID,
+		CorrelationID: summary.CorrelationID,
+		Label:         summary.Label,
+		Profile:       summary.Profile,
+		LocalDate:     summary.LocalDate,
+		SignedAt:      time.Now().In(m.Config.Location()),
+		Order:         *summary.Order,
+	}, key)
+	if err != nil {
+		warn("failed to sign the receipt", err)
+		return
+	}
+	summary.SignedReceipt = &receipt
+
+	if cfg.Destination == "" {
+		return
+	}
+	if err = writeSignedReceipt(ctx, cfg.Destination, receipt, m.httpClient()); err != nil {
+		warn("failed to write the signed receipt", err)
+		return
+	}
+	m.Logger.InfoContext(ctx, "wrote the signed receipt", "destination", cfg.Destination)
+}
@@ -0,0 +1,197 @@
+package dca_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	tt := []struct {
+		in   string
+		want string
+	}{
+		{`{"b":1,"a":2}`, `{"a":2,"b":1}`},
+		// nested objects are sorted too, arrays keep their order
+		{`{"b":{"d":[3,1,2],"c":null},"a":[{"z":true,"y":false}]}`, `{"a":[{"y":false,"z":true}],"b":{"c":null,"d":[3,1,2]}}`},
+		{"{\n  \"a\" : 1 ,\n\t\"b\": \"x y\"\n}\n", `{"a":1,"b":"x y"}`},
+		// numbers are kept as written
+		{`{"a":1.50,"b":1e3,"c":-0.00010000,"d":12345678901234567890}`, `{"a":1.50,"b":1e3,"c":-0.00010000,"d":12345678901234567890}`},
+		{`{"a":"<&>","b":"é"}`, `{"a":"<&>","b":"é"}`},
+		// keys are sorted by their bytes
+		{`{"b":1,"B":2,"é":3,"a":4}`, `{"B":2,"a":4,"b":1,"é":3}`},
+		{`[]`, `[]`},
+	}
+	for i, tc := range tt {
+		got, err := dca.CanonicalJSON(json.RawMessage(tc.in))
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if want := tc.want; string(got) != want {
+			t.Errorf("%d: want %s got %s", i, want, got)
+		}
+	}
+
+	for i, in := range []string{`{"a":1} {"b":2}`, `{"a":`, ``} {
+		if _, err := dca.CanonicalJSON(json.RawMessage(in)); err == nil {
+			t.Errorf("%d: want an error for %q", i, in)
+		}
+	}
+
+	// structs are canonicalized by their JSON names rather than field order
+	got, err := dca.CanonicalJSON(struct {
+		Z string  `json:"z"`
+		A float64 `json:"a"`
+	}{"<x>", 0.1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"a":0.1,"z":"<x>"}`; string(got) != want {
+		t.Errorf("want %s got %s", want, got)
+	}
+}
+
+func TestParseSigningKey(t *testing.T) {
+	seed := bytes.Repeat([]byte{7}, ed25519.SeedSize)
+	key := ed25519.NewKeyFromSeed(seed)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		in string
+		ok bool
+	}{
+		{base64.StdEncoding.EncodeToString(seed), true},
+		{base64.StdEncoding.EncodeToString(key), true},
+		{string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), true},
+		{base64.StdEncoding.EncodeToString([]byte("short")), false},
+		{"not a key", false},
+	}
+	for i, tc := range tt {
+		got, err := dca.ParseSigningKey(tc.in)
+		if want, got := tc.ok, err == nil; got != want {
+			t.Fatalf("%d: want ok %v got %v", i, want, err)
+		}
+		if tc.ok && !key.Equal(got) {
+			t.Errorf("%d: want the same key", i)
+		}
+	}
+}
+
+func TestVerifyReceipt(t *testing.T) {
+	key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize))
+	other := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{2}, ed25519.SeedSize))
+	public := key.Public().(ed25519.PublicKey)
+
+	receipt, err := dca.SignReceipt(dca.ReceiptPayload{
+		Version:   dca.SignedReceiptVersion,
+		RunID:     "run-1",
+		LocalDate: "2024-05-01",
+		SignedAt:  time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC),
+		Order:     dca.ExecuteOrderResponse{Pair: "XBTUSD", Side: "buy", TransactionID: "TXID-1", AmountInCents: 500, VolumePurchased: 0.0001, Cost: 5, Fee: 0.02, Price: 50000},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := json.MarshalIndent(receipt, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a receipt with its keys reordered and compacted, as another tool may write it
+	var doc map[string]any
+	if err = json.Unmarshal(signed, &doc); err != nil {
+		t.Fatal(err)
+	}
+	reordered, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		doc []byte
+		key ed25519.PublicKey
+		err error
+	}{
+		{signed, public, nil},
+		{reordered, public, nil},
+		{bytes.Replace(signed, []byte(`"cost": 5`), []byte(`"cost": 50`), 1), public, dca.ErrInvalidReceipt},
+		{bytes.Replace(signed, []byte(`"runId": "run-1"`), []byte(`"runId": "run-1", "extra": true`), 1), public, dca.ErrInvalidReceipt},
+		{signed, other.Public().(ed25519.PublicKey), dca.ErrInvalidReceipt},
+	}
+	for i, tc := range tt {
+		payload, err := dca.VerifyReceipt(tc.doc, tc.key)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%d: want %v got %v", i, tc.err, err)
+			continue
+		}
+		if tc.err == nil {
+			if want, got := "TXID-1", payload.Order.TransactionID; got != want {
+				t.Errorf("%d: want %v got %v", i, want, got)
+			}
+		}
+	}
+}
+
+func TestApp_Run_SignedReceipts(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":       {tickerResponse},
+		"/0/private/AddOrder":    {addOrderResponse},
+		"/0/private/QueryOrders": {queryOrdersResponse},
+	})
+	seed := bytes.Repeat([]byte{3}, ed25519.SeedSize)
+	dir := t.TempDir()
+	app, n := newTestApp(s, dca.AppConfig{SignedReceipts: &dca.SignedReceiptConfig{
+		PrivateKey:  base64.StdEncoding.EncodeToString(seed),
+		Destination: dir,
+	}})
+
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	summary := n.summaries[0]
+	if summary.SignedReceipt == nil {
+		t.Fatalf("want a signed receipt got warnings %v", summary.Warnings)
+	}
+	if want, got := summary.RunID, summary.SignedReceipt.Payload.RunID; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.receipt.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, len(files); got != want {
+		t.Fatalf("want %v got %v", want, got)
+	}
+	if !strings.Contains(files[0], summary.RunID) {
+		t.Errorf("want the run ID in %s", files[0])
+	}
+	b, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := dca.VerifyReceipt(b, ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "TXID-1", payload.Order.TransactionID; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
@@ -0,0 +1,65 @@
+package dca
+
+import (
+	"context"
+	"sort"
+)
+
+// SlippageAverageWindow is the number of most recent recorded orders averaged in SlippageStats.
+const SlippageAverageWindow = 30
+
+// Slippage compares the average fill price of a market order to the price quoted when it was sized. Positive values
+// are worse than the quote: a higher price for buys and a lower price for sells.
+type Slippage struct {
+	QuotedPrice float64 `json:"quotedPrice" desc:"The ask for buys or the bid for sells used to size the order" schema:"required"`
+	Amount      float64 `json:"amount" desc:"The difference between the fill price and the quoted price in the quote currency" schema:"required"`
+	Percent     float64 `json:"percent" desc:"The difference as a percentage of the quoted price" schema:"required"`
+}
+
+// newSlippage returns the slippage of res against quoted, nil when either price is unknown or nothing filled.
+func newSlippage(res ExecuteOrderResponse, quoted float64) *Slippage {
+	if quoted <= 0 || res.Price <= 0 || res.VolumePurchased <= 0 {
+		return nil
+	}
+
+	amount := res.Price - quoted
+	if res.Side == SideSell {
+		amount = quoted - res.Price
+	}
+	return &Slippage{QuotedPrice: quoted, Amount: amount, Percent: amount / quoted * 100}
+}
+
+// recordSlippage attaches the slippage of a filled market order to res and logs it.
+func (p *KrakenProvider) recordSlippage(ctx context.Context, res *ExecuteOrderResponse, quoted float64) {
+	if res.Slippage = newSlippage(*res, quoted); res.Slippage != nil {
+		p.Logger.InfoContext(ctx, "order slippage", "quotedPrice", quoted, "price", res.Price, "slippage", res.Slippage.Amount, "slippagePercent", res.Slippage.Percent)
+	}
+}
+
+// SlippageStats is the rolling average slippage of recorded market orders.
+type SlippageStats struct {
+	Orders         int     `json:"orders" desc:"The number of recent orders with a known slippage that were averaged" schema:"required"`
+	AveragePercent float64 `json:"averagePercent" desc:"The average slippage as a percentage of the quoted price" schema:"required"`
+}
+
+// NewSlippageStats averages the slippage of the most recent window records which have one, records are ordered
+// by time first. It returns nil when no record has a slippage.
+func NewSlippageStats(records []OrderRecord, window int) *SlippageStats {
+	records = append([]OrderRecord(nil), records...)
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+
+	var stats SlippageStats
+	var total float64
+	for i := len(records) - 1; i >= 0 && stats.Orders < window; i-- {
+		if s := records[i].Order.Slippage; s != nil {
+			stats.Orders++
+			total += s.Percent
+		}
+	}
+
+	if stats.Orders == 0 {
+		return nil
+	}
+	stats.AveragePercent = total / float64(stats.Orders)
+	return &stats
+}
@@ -0,0 +1,146 @@
+package dca_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+func TestKrakenProvider_ExecuteOrder_Slippage(t *testing.T) {
+	tt := []struct {
+		side     string
+		fill     string
+		expected *dca.Slippage
+	}{
+		// buys are quoted at the ask of 50000
+		{dca.SideBuy, `"status":"closed","vol_exec":"0.0001","cost":"5.01","price":"50100.0"`, &dca.Slippage{QuotedPrice: 50000, Amount: 100, Percent: 0.2}},
+		{dca.SideBuy, `"status":"closed","vol_exec":"0.0001","cost":"4.99","price":"49900.0"`, &dca.Slippage{QuotedPrice: 50000, Amount: -100, Percent: -0.2}},
+		// sells are quoted at the bid of 49990 and a lower fill is worse
+		{dca.SideSell, `"status":"closed","vol_exec":"0.0001","cost":"4.98","price":"49890.0"`, &dca.Slippage{QuotedPrice: 49990, Amount: 100, Percent: 100.0 / 49990 * 100}},
+		// nothing filled so there's no price to compare
+		{dca.SideBuy, `"status":"open","vol_exec":"0","cost":"0","price":"0"`, nil},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {`{"error":[],"result":{"TXID-1":{"vol":"0.0001","fee":"0.02",` + tc.fill + `}}}`},
+		})
+		p := newTestKrakenProvider(s, dca.KrakenProviderConfig{})
+
+		res, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500, Side: tc.side})
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+
+		if tc.expected == nil {
+			if res.Slippage != nil {
+				t.Errorf("%d: want no slippage got %+v", i, *res.Slippage)
+			}
+			continue
+		} else if res.Slippage == nil {
+			t.Fatalf("%d: want slippage %+v got none", i, *tc.expected)
+		}
+		if want, got := tc.expected.QuotedPrice, res.Slippage.QuotedPrice; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.expected.Amount, res.Slippage.Amount; !approx(got, want) {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.expected.Percent, res.Slippage.Percent; !approx(got, want) {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestNewSlippageStats(t *testing.T) {
+	now := time.Now()
+	record := func(minutes int, percent float64) dca.OrderRecord {
+		return dca.OrderRecord{
+			Time:  now.Add(time.Duration(minutes) * time.Minute),
+			Order: dca.ExecuteOrderResponse{Slippage: &dca.Slippage{QuotedPrice: 50000, Amount: percent * 500, Percent: percent}},
+		}
+	}
+
+	tt := []struct {
+		records  []dca.OrderRecord
+		window   int
+		expected *dca.SlippageStats
+	}{
+		{nil, 3, nil},
+		{[]dca.OrderRecord{{Time: now}}, 3, nil},
+		{[]dca.OrderRecord{record(0, 0.1), record(1, 0.3)}, 3, &dca.SlippageStats{Orders: 2, AveragePercent: 0.2}},
+		// only the most recent records are averaged regardless of the order they're stored in
+		{[]dca.OrderRecord{record(3, 0.4), record(0, 1), record(1, 0.2), {Time: now.Add(2 * time.Minute)}}, 2, &dca.SlippageStats{Orders: 2, AveragePercent: 0.3}},
+	}
+	for i, tc := range tt {
+		got := dca.NewSlippageStats(tc.records, tc.window)
+		if tc.expected == nil {
+			if got != nil {
+				t.Errorf("%d: want nil got %+v", i, *got)
+			}
+			continue
+		} else if got == nil {
+			t.Fatalf("%d: want %+v got nil", i, *tc.expected)
+		}
+		if want, got := tc.expected.Orders, got.Orders; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.expected.AveragePercent, got.AveragePercent; !approx(got, want) {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestApp_Run_SlippageAlert(t *testing.T) {
+	fill := `{"error":[],"result":{"TXID-1":{"status":"closed","vol":"0.0001","vol_exec":"0.0001","cost":"5.01","fee":"0.02","price":"50100.0"}}}`
+
+	tt := []struct {
+		threshold float64
+		warning   bool
+	}{
+		{0, false},
+		{0.1, true},
+		{0.5, false},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {fill},
+		})
+		app, n := newTestApp(s, dca.AppConfig{
+			OrderStorePath:       filepath.Join(t.TempDir(), "orders.jsonl"),
+			SlippageAlertPercent: tc.threshold,
+		})
+
+		if err := app.Run(context.Background()); err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+
+		summary := n.summaries[0]
+		var warned bool
+		for _, w := range summary.Warnings {
+			warned = warned || strings.Contains(w, "slippage")
+		}
+		if want, got := tc.warning, warned; got != want {
+			t.Errorf("%d: want warning %v got %v: %v", i, want, got, summary.Warnings)
+		}
+
+		if summary.Slippage == nil {
+			t.Fatalf("%d: want slippage stats got none", i)
+		}
+		if want, got := 1, summary.Slippage.Orders; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := 0.2, summary.Slippage.AveragePercent; !approx(got, want) {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package dca
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Names of the steps of App.Smoke, in the order they run.
+const (
+	SmokeStepSystemStatus  = "system_status"
+	SmokeStepTicker        = "ticker"
+	SmokeStepBalance       = "balance"
+	SmokeStepTradeVolume   = "trade_volume"
+	SmokeStepValidateOrder = "validate_order"
+)
+
+// SmokeStep is the outcome of a single call of a smoke test.
+type SmokeStep struct {
+	Name      string `json:"name"`
+	Passed    bool   `json:"passed"`
+	LatencyMS int64  `json:"latencyMs"`
+	// Detail is what the call returned, e.g. the system status or the balance.
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// SmokeReport is the outcome of App.Smoke, Passed is only set when every step passed.
+type SmokeReport struct {
+	Pair      string      `json:"pair"`
+	StartedAt time.Time   `json:"startedAt"`
+	Steps     []SmokeStep `json:"steps"`
+	Passed    bool        `json:"passed"`
+}
+
+// Smoke proves the credentials, network path and request signing of the config work without moving money. It calls
+// SystemStatus, Ticker, Balance and TradeVolume, then validates an order of the pair's minimum volume with AddOrder,
+// which Kraken checks without placing. The provider is read-only apart from validated orders so the smoke test
+// can't place an order. A failing step doesn't stop the later ones, an error is only returned when the config can't
+// be tested.
+func (m *App) Smoke(ctx context.Context) (report SmokeReport, err error) {
+	defer WrapErr(&err, "App.Smoke")
+
+	provider := m.newKrakenProvider()
+	provider.ReadOnly = true
+	provider.AllowValidateOrders = true
+
+	order, err := provider.resolveOrder(m.Config.OrderRequest())
+	if err != nil {
+		return report, err
+	}
+	report = SmokeReport{Pair: order.Pair, StartedAt: time.Now().In(m.Config.Location()), Passed: true}
+	m.loadPairMetadata(ctx, provider, order.Pair)
+
+	step := func(name string, call func() (string, error)) {
+		start := time.Now()
+		detail, err := call()
+		s := SmokeStep{Name: name, Passed: err == nil, LatencyMS: time.Since(start).Milliseconds(), Detail: detail}
+		if err != nil {
+			s.Error = err.Error()
+			report.Passed = false
+		}
+		report.Steps = append(report.Steps, s)
+		m.Logger.InfoContext(ctx, "smoke test step", "step", s.Name, "passed", s.Passed, "latencyMs", s.LatencyMS, "error", s.Error)
+	}
+
+	step(SmokeStepSystemStatus, func() (string, error) {
+		return provider.systemStatus(ctx)
+	})
+	step(SmokeStepTicker, func() (string, error) {
+		t, err := provider.fetchTicker(ctx, order.Pair)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("ask %s bid %s", FormatFiat(t.Ask, ""), FormatFiat(t.Bid, "")), nil
+	})
+	step(SmokeStepBalance, func() (string, error) {
+		asset := krakenPairs[order.Pair].QuoteAsset
+		balance, err := provider.fetchBalance(ctx, asset)
+		if err != nil {
+			return "", err
+		}
+		return FormatAmount(balance, asset), nil
+	})
+	step(SmokeStepTradeVolume, func() (string, error) {
+		rate, err := provider.fetchFeeRate(ctx, order.Pair)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("taker fee %g%%", rate*100), nil
+	})
+	step(SmokeStepValidateOrder, func() (string, error) {
+		return provider.validateOrder(ctx, order, provider.orderMin(order.Pair))
+	})
+
+	m.Logger.InfoContext(ctx, "smoke test finished", "passed", report.Passed)
+	return report, nil
+}
+
+// validateOrder asks Kraken to validate a market order of volume without placing it and returns the order's
+// description.
+func (p *KrakenProvider) validateOrder(ctx context.Context, order ExecuteOrderRequest, volume string) (description string, err error) {
+	defer WrapErr(&err, "validateOrder")
+
+	var result struct {
+		Description struct {
+			Order string `json:"order"`
+		} `json:"descr"`
+	}
+	if err = p.privateRequest(ctx, "/0/private/AddOrder", url.Values{
+		"pair":      {order.Pair},
+		"type":      {order.Side},
+		"ordertype": {"market"},
+		"volume":    {volume},
+		"validate":  {"true"},
+	}, &result); err != nil {
+		return "", fmt.Errorf("failed to validate order: %w", err)
+	}
+	return result.Description.Order, nil
+}
+
+// EventAction returns the action field of a Lambda event, e.g. smoke for {"action":"smoke"}. An empty string is
+// returned for scheduled events, which have none.
+func EventAction(event []byte) string {
+	var e struct {
+		Action string `json:"action"`
+	}
+	if err := json.Unmarshal(event, &e); err != nil {
+		return ""
+	}
+	return e.Action
+}
@@ -0,0 +1,88 @@
+package dca_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/1gm/dca"
+)
+
+func TestApp_Smoke(t *testing.T) {
+	const invalidKey = `{"error":["EAPI:Invalid key"]}`
+
+	tt := []struct {
+		balance  string
+		addOrder string
+		failed   []string
+	}{
+		{`{"error":[],"result":{"ZUSD":"100.0000"}}`, `{"error":[],"result":{"descr":{"order":"buy 0.00005000 XBTUSD @ market"}}}`, nil},
+		{invalidKey, invalidKey, []string{dca.SmokeStepBalance, dca.SmokeStepValidateOrder}},
+		{`{"error":[],"result":{"ZUSD":"100.0000"}}`, `{"error":["EOrder:Insufficient funds"]}`, []string{dca.SmokeStepValidateOrder}},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tickerResponse},
+			"/0/private/Balance":     {tc.balance},
+			"/0/private/TradeVolume": {`{"error":[],"result":{"currency":"ZUSD","volume":"0","fees":{"XXBTZUSD":{"fee":"0.4000"}}}}`},
+			"/0/private/AddOrder":    {tc.addOrder},
+		})
+		app, _ := newTestApp(s, dca.AppConfig{})
+
+		report, err := app.Smoke(context.Background())
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		if want, got := 5, len(report.Steps); got != want {
+			t.Fatalf("%d: want %v got %v", i, want, got)
+		}
+		var failed []string
+		for _, step := range report.Steps {
+			if !step.Passed {
+				failed = append(failed, step.Name)
+			} else if step.Error != "" {
+				t.Errorf("%d: want no error for %s got %q", i, step.Name, step.Error)
+			}
+		}
+		if want, got := len(tc.failed), len(failed); got != want {
+			t.Fatalf("%d: want %v got %v", i, tc.failed, failed)
+		}
+		for j := range failed {
+			if want, got := tc.failed[j], failed[j]; got != want {
+				t.Errorf("%d: want %v got %v", i, want, got)
+			}
+		}
+		if want, got := len(tc.failed) == 0, report.Passed; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+
+		// the order is only validated, at the pair's minimum volume
+		orders := s.Requests("/0/private/AddOrder")
+		if want, got := 1, len(orders); got != want {
+			t.Fatalf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := "true", orders[0].Get("validate"); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := "0.00005", orders[0].Get("volume"); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestEventAction(t *testing.T) {
+	tt := []struct {
+		event string
+		want  string
+	}{
+		{`{"action":"smoke"}`, "smoke"},
+		{`{"time":"2024-05-01T12:00:00Z","detail":{}}`, ""},
+		{`not json`, ""},
+	}
+	for i, tc := range tt {
+		if want, got := tc.want, dca.EventAction([]byte(tc.event)); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
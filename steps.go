@@ -0,0 +1,92 @@
+package dca
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Steps of placing an order which are timed, see KrakenProvider.Timings.
+const (
+	StepSystemStatus = "system_status"
+	StepOrderStream  = "order_stream"
+	// StepPreOrder is the whole of the concurrent lookups before an order, it's as long as the slowest of them.
+	StepPreOrder = "pre_order"
+	// StepQuote fetches the ticker the order is sized with, the last step before the order is placed.
+	StepQuote    = "quote"
+	StepAddOrder = "add_order"
+	StepFill     = "fill"
+)
+
+// StepTiming is how long a step of placing an order took.
+type StepTiming struct {
+	Step    string  `json:"step" desc:"The step of placing the order" schema:"required"`
+	Seconds float64 `json:"seconds" desc:"How many seconds the step took" schema:"required"`
+}
+
+// stepTimings collects the timings of steps, it's safe for concurrent use.
+type stepTimings struct {
+	mu      sync.Mutex
+	timings []StepTiming
+}
+
+// record adds the timing of step which started at start.
+func (t *stepTimings) record(step string, start time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timings = append(t.timings, StepTiming{Step: step, Seconds: time.Since(start).Seconds()})
+}
+
+// list returns the timings in the order the steps finished.
+func (t *stepTimings) list() []StepTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Clone(t.timings)
+}
+
+// stepGroup runs independent lookups concurrently, like an errgroup. The first step to fail cancels the context of
+// the others, steps whose failure isn't fatal handle it themselves and return nil.
+type stepGroup struct {
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	timings *stepTimings
+
+	wg   sync.WaitGroup
+	once sync.Once
+	err  error
+}
+
+// newStepGroup returns a group whose steps run with a context derived from ctx and are timed to timings.
+func newStepGroup(ctx context.Context, timings *stepTimings) *stepGroup {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &stepGroup{ctx: ctx, cancel: cancel, timings: timings}
+}
+
+// Go runs f as step in a new goroutine.
+func (g *stepGroup) Go(step string, f func(ctx context.Context) error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer g.timings.record(step, time.Now())
+
+		if err := f(g.ctx); err != nil {
+			g.once.Do(func() {
+				g.err = err
+				g.cancel(err)
+			})
+		}
+	}()
+}
+
+// Wait waits for every step and returns the first error.
+func (g *stepGroup) Wait() error {
+	g.wg.Wait()
+	return g.err
+}
+
+// Close cancels the context of the steps. Unlike an errgroup, Wait leaves it running so what steps opened with it,
+// such as an order stream, outlives them.
+func (g *stepGroup) Close() {
+	g.cancel(nil)
+}
@@ -0,0 +1,144 @@
+package dca_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+// delayRequests makes the requests to the paths of s wait for their delay before they're answered, cancelled records
+// the paths whose requests were cancelled while waiting.
+func delayRequests(s *krakenTestServer, delays map[string]time.Duration) (cancelled func() []string) {
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+	next := s.Config.Handler
+	s.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d, ok := delays[r.URL.Path]; ok {
+			// the server only notices a cancelled request once its body was read
+			_ = r.ParseForm()
+			select {
+			case <-time.After(d):
+			case <-r.Context().Done():
+				mu.Lock()
+				paths = append(paths, r.URL.Path)
+				mu.Unlock()
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return paths
+	}
+}
+
+func TestKrakenProvider_ExecuteOrder_ConcurrentLookups(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus":        {`{"error":[],"result":{"status":"online"}}`},
+		"/0/private/GetWebSocketsToken": {`{"error":["EGeneral:Temporary lockout"]}`},
+		"/0/public/Ticker":              {tickerResponse},
+		"/0/private/AddOrder":           {addOrderResponse},
+		"/0/private/QueryOrders":        {queryOrdersResponse},
+	})
+	delay := 200 * time.Millisecond
+	delayRequests(s, map[string]time.Duration{"/0/public/SystemStatus": delay, "/0/private/GetWebSocketsToken": delay})
+	p := newTestKrakenProvider(s, dca.KrakenProviderConfig{WebSocket: true})
+
+	if _, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500}); err != nil {
+		t.Fatal(err)
+	}
+
+	timings := map[string]float64{}
+	var steps []string
+	for _, st := range p.Timings() {
+		timings[st.Step] = st.Seconds
+		steps = append(steps, st.Step)
+	}
+	for _, step := range []string{dca.StepSystemStatus, dca.StepOrderStream, dca.StepPreOrder, dca.StepQuote, dca.StepAddOrder, dca.StepFill} {
+		if _, ok := timings[step]; !ok {
+			t.Errorf("want a timing of %s got %v", step, steps)
+		}
+	}
+
+	// the lookups overlap, so together they take about as long as the slowest of them
+	if sum, got := timings[dca.StepSystemStatus]+timings[dca.StepOrderStream], timings[dca.StepPreOrder]; got >= sum*0.75 {
+		t.Errorf("want the pre-order phase well under the %vs of its steps got %vs", sum, got)
+	}
+	// the order is sized with the ticker fetched after the lookups
+	if want, got := steps[len(steps)-3], dca.StepQuote; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestKrakenProvider_ExecuteOrder_CancelLookups(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus":        {`{"error":[],"result":{"status":"cancel_only"}}`},
+		"/0/private/GetWebSocketsToken": {`{"error":[],"result":{"token":"TOKEN","expires":900}}`},
+		"/0/private/AddOrder":           {addOrderResponse},
+	})
+	cancelled := delayRequests(s, map[string]time.Duration{"/0/private/GetWebSocketsToken": 10 * time.Second})
+	p := newTestKrakenProvider(s, dca.KrakenProviderConfig{WebSocket: true})
+
+	start := time.Now()
+	_, err := p.ExecuteOrder(context.Background(), dca.ExecuteOrderRequest{AmountInCents: 500})
+	if !errors.Is(err, dca.ErrCancelOnlyMode) {
+		t.Fatalf("want %v got %v", dca.ErrCancelOnlyMode, err)
+	}
+
+	// the trading mode ruled out the order, so the websocket token request was cancelled instead of awaited
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("want the lookups cancelled got %v", elapsed)
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(cancelled()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if want, got := []string{"/0/private/GetWebSocketsToken"}, cancelled(); len(got) != 1 || got[0] != want[0] {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := 0, len(s.Requests("/0/private/AddOrder")); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestKrakenProvider_PrivateRequests_Serialized(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/private/QueryOrders": {queryOrdersResponse},
+	})
+	p := newTestKrakenProvider(s, dca.KrakenProviderConfig{})
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.QueryOrder(context.Background(), "TXID-1"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Kraken rejects a nonce lower than one it has seen, so concurrent calls must arrive in nonce order
+	var last int64
+	for i, r := range s.Requests("/0/private/QueryOrders") {
+		nonce, err := strconv.ParseInt(r.Get("nonce"), 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nonce <= last {
+			t.Errorf("%d: want a nonce above %v got %v", i, last, nonce)
+		}
+		last = nonce
+	}
+}
@@ -0,0 +1,187 @@
+package dca
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// OrderRecord is an order persisted to an OrderStore.
+type OrderRecord struct {
+	// SchemaVersion is set to the current SchemaVersion by FileOrderStore.Put when it's zero.
+	SchemaVersion int       `json:"schemaVersion,omitempty" desc:"The version of the order record schema, absent from records written before versioning"`
+	Time          time.Time `json:"time" desc:"When the order was recorded, in the reporting time zone" schema:"required"`
+	// LocalDate is the calendar date of Time in the reporting time zone, formatted as time.DateOnly.
+	LocalDate string `json:"localDate,omitempty" desc:"The calendar date of time in the reporting time zone"`
+	// RunID and CorrelationID identify the run which placed the order, they're empty for adopted and imported records.
+	RunID         string `json:"runId,omitempty" desc:"The identifier of the run which placed the order"`
+	CorrelationID string `json:"correlationId,omitempty" desc:"Traces the run which placed the order across systems"`
+	// Profile is the config profile of the run which placed the order.
+	Profile string               `json:"profile,omitempty" desc:"The config profile of the run which placed the order"`
+	Order   ExecuteOrderResponse `json:"order" desc:"The recorded order" schema:"required"`
+	// Asset is the common code of the base asset of the order's pair, set by FileOrderStore.Put, see BaseAsset.
+	Asset string `json:"asset,omitempty" desc:"The common code of the base asset of the order, e.g. BTC, absent from records written before it was recorded"`
+	// Adopted is set when the order was discovered by reconciliation instead of recorded by the run that placed it.
+	Adopted bool `json:"adopted,omitempty" desc:"Set when the order was discovered by reconciliation instead of recorded by the run that placed it"`
+	// Imported is set when the record was imported from the trade history by a backfill, one record per trade.
+	Imported bool `json:"imported,omitempty" desc:"Set when the record was imported from the trade history by a backfill"`
+	// Interrupted is set when the order was found after its run was interrupted, before the run recorded it.
+	Interrupted bool `json:"interrupted,omitempty" desc:"Set when the order was found after its run was interrupted, before the run recorded it"`
+	// TradeID identifies the trade of an imported record.
+	TradeID string `json:"tradeId,omitempty" desc:"The exchange's identifier of the trade an imported record was made from"`
+	// Pruned is set once the retention policy stripped the record down to its summary, see FileOrderStore.Prune.
+	Pruned bool `json:"pruned,omitempty" desc:"Set when the retention policy pruned the details of the order, its summary is kept"`
+}
+
+// In returns a copy of the record with Time and LocalDate in loc.
+func (r OrderRecord) In(loc *time.Location) OrderRecord {
+	r.Time = r.Time.In(loc)
+	r.LocalDate = r.Time.Format(time.DateOnly)
+	return r
+}
+
+// FilterOrderRecords returns the records of orders labeled label, every record when label is empty. Records written
+// before orders were labeled have no label.
+func FilterOrderRecords(records []OrderRecord, label string) []OrderRecord {
+	if label == "" {
+		return records
+	}
+
+	var filtered []OrderRecord
+	for _, rec := range records {
+		if rec.Order.Label == label {
+			filtered = append(filtered, rec)
+		}
+	}
+	return filtered
+}
+
+// WriteOrdersCSV writes records as CSV with a header row, times are written in loc and amounts formatted with money. Every tag key found on the records
+// gets a column named tag:<key> after the fixed columns, empty for orders without the tag. The asset column is the
+// base asset of the order, so the orders of several assets can be told apart without parsing pair names.
+func WriteOrdersCSV(w io.Writer, records []OrderRecord, loc *time.Location, money MoneyFormat) error {
+	keys := map[string]bool{}
+	for _, rec := range records {
+		for key := range rec.Order.Tags {
+			keys[key] = true
+		}
+	}
+	tagKeys := slices.Sorted(maps.Keys(keys))
+
+	cw := csv.NewWriter(w)
+	header := []string{"time", "runId", "transactionId", "pair", "asset", "side", "status", "label", "profile", "volume", "price", "cost", "fee"}
+	for _, key := range tagKeys {
+		header = append(header, "tag:"+key)
+	}
+	_ = cw.Write(header)
+	for _, rec := range records {
+		o := rec.Order
+		row := []string{
+			rec.Time.In(loc).Format(time.RFC3339),
+			rec.RunID,
+			o.TransactionID,
+			o.Pair,
+			rec.BaseAsset(),
+			o.Side,
+			o.Status,
+			o.Label,
+			rec.Profile,
+			money.Crypto(o.VolumePurchased, ""),
+			FormatFiat(o.Price, ""),
+			FormatFiat(o.Cost, ""),
+			FormatFiat(o.Fee, ""),
+		}
+		for _, key := range tagKeys {
+			row = append(row, o.Tags[key])
+		}
+		_ = cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// OrderStore persists the orders placed by the application.
+type OrderStore interface {
+	// Put records an order.
+	Put(ctx context.Context, rec OrderRecord) error
+	// List returns every recorded order in the order they were recorded.
+	List(ctx context.Context) ([]OrderRecord, error)
+}
+
+// FileOrderStore is an OrderStore which appends records to a JSON Lines file. A record torn by a crash while it was
+// appended is dropped, a file with a corrupt record is quarantined and restarted with the records which can be read.
+type FileOrderStore struct {
+	Path string
+	// Logger is warned of quarantined files, defaults to discarding.
+	Logger *slog.Logger
+}
+
+// NewFileOrderStore creates an OrderStore backed by the file at path, the file is created on the first Put.
+func NewFileOrderStore(path string) *FileOrderStore {
+	return &FileOrderStore{Path: path}
+}
+
+// fileOrderStore returns the store at orderStorePath, warning the app's logger of quarantined files.
+func (m *App) fileOrderStore() *FileOrderStore {
+	return &FileOrderStore{Path: m.Config.OrderStorePath, Logger: m.Logger}
+}
+
+func (s *FileOrderStore) Put(_ context.Context, rec OrderRecord) (err error) {
+	defer WrapErr(&err, "FileOrderStore.Put")
+
+	if rec.SchemaVersion == 0 {
+		rec.SchemaVersion = SchemaVersion
+	}
+	if rec.Asset == "" {
+		rec.Asset, _ = PairAssets(rec.Order.Pair)
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal record: %w", err)
+	}
+
+	return appendLine(s.Path, b)
+}
+
+// Check makes sure records can be appended to the file, without writing one.
+func (s *FileOrderStore) Check(_ context.Context) (err error) {
+	defer WrapErr(&err, "FileOrderStore.Check")
+
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_WRONLY, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkWritableDir(filepath.Dir(s.Path))
+	} else if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (s *FileOrderStore) List(_ context.Context) (records []OrderRecord, err error) {
+	defer WrapErr(&err, "FileOrderStore.List")
+
+	_, corrupt, err := readLines(s.Path, func(line []byte) error {
+		var rec OrderRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return err
+		}
+		records = append(records, rec)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	} else if corrupt != nil && s.Logger != nil {
+		s.Logger.Warn("quarantined the corrupt order store, restarted it with the records which could be read", "path", s.Path,
+			"quarantine", corrupt.Quarantine, "line", corrupt.Line, "error", corrupt.Err, "records", len(records))
+	}
+	return records, nil
+}
@@ -0,0 +1,90 @@
+package dca_test
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+func TestOrderRecord_In(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		time     time.Time
+		loc      *time.Location
+		expected string
+	}{
+		// 02:00 UTC on the 1st of March is still the 29th of February in New York
+		{time.Date(2024, 3, 1, 2, 0, 0, 0, time.UTC), newYork, "2024-02-29"},
+		{time.Date(2024, 3, 1, 2, 0, 0, 0, time.UTC), time.UTC, "2024-03-01"},
+		{time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), newYork, "2024-03-01"},
+	}
+	for i, tc := range tt {
+		rec := dca.OrderRecord{Time: tc.time}.In(tc.loc)
+		if want, got := tc.expected, rec.LocalDate; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if !rec.Time.Equal(tc.time) || rec.Time.Location() != tc.loc {
+			t.Errorf("%d: want %v in %v got %v", i, tc.time, tc.loc, rec.Time)
+		}
+	}
+}
+
+func TestFileOrderStore_LocalDate(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := dca.NewFileOrderStore(filepath.Join(t.TempDir(), "orders.jsonl"))
+	rec := dca.OrderRecord{Time: time.Date(2024, 3, 1, 2, 0, 0, 0, time.UTC)}.In(newYork)
+	if err = store.Put(context.Background(), rec); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := store.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	} else if want, got := 1, len(records); got != want {
+		t.Fatalf("want %v records got %v", want, got)
+	}
+
+	// the stored time keeps the zone offset and the local date is stored alongside it
+	if want, got := "2024-02-29T21:00:00-05:00", records[0].Time.Format(time.RFC3339); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := "2024-02-29", records[0].LocalDate; got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if want, got := dca.SchemaVersion, records[0].SchemaVersion; got != want {
+		t.Errorf("want schema version %v got %v", want, got)
+	}
+}
+
+func TestFileOrderStore_Asset(t *testing.T) {
+	store := dca.NewFileOrderStore(filepath.Join(t.TempDir(), "orders.jsonl"))
+	for _, pair := range []string{"XBTUSD", "XETHZEUR", ""} {
+		if err := store.Put(context.Background(), dca.OrderRecord{Order: dca.ExecuteOrderResponse{Pair: pair}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := store.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, rec := range records {
+		got = append(got, rec.Asset)
+	}
+	if want := []string{"BTC", "ETH", ""}; !slices.Equal(got, want) {
+		t.Errorf("want %q got %q", want, got)
+	}
+}
@@ -0,0 +1,70 @@
+package dca
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// SweepFeeBuffer is the fraction of the balance kept back for fees when an order is reduced to the available balance.
+const SweepFeeBuffer = 0.005
+
+// sweepBalance retries a market buy that failed due to insufficient funds with the available balance, less
+// SweepFeeBuffer, when the balance is within SweepThresholdPercent below the order amount. ok is false when the
+// order wasn't retried and the original error should be reported.
+func (p *KrakenProvider) sweepBalance(ctx context.Context, order ExecuteOrderRequest, stream *krakenOrderStream) (res ExecuteOrderResponse, ok bool, err error) {
+	defer WrapErr(&err, "sweepBalance")
+
+	var balance float64
+	if balance, err = p.fetchBalance(ctx, krakenPairs[order.Pair].QuoteAsset); err != nil {
+		p.Logger.WarnContext(ctx, "failed to fetch balance", "err", err)
+		return res, false, nil
+	}
+
+	amount := float64(order.AmountInCents) / 100
+	cents := int(math.Floor(balance * (1 - SweepFeeBuffer) * 100))
+	d := Decision{Name: DecisionBalance, Inputs: map[string]string{
+		"balance":        FormatFiat(balance, ""),
+		"amount":         FormatCents(order.AmountInCents, ""),
+		"sweepThreshold": fmt.Sprintf("%g%%", p.SweepThresholdPercent),
+	}}
+	if balance < amount*(1-p.SweepThresholdPercent/100) || cents <= 0 || cents >= order.AmountInCents {
+		p.Logger.InfoContext(ctx, "balance isn't within the sweep threshold", "balance", balance, "amount", amount, "sweepThresholdPercent", p.SweepThresholdPercent)
+		d.Outcome, d.Narration = DecisionFail, fmt.Sprintf("balance %s short of %s by more than %s → fail", d.Inputs["balance"], d.Inputs["amount"], d.Inputs["sweepThreshold"])
+		recordDecision(ctx, d)
+		return res, false, nil
+	}
+	d.Outcome, d.Narration = DecisionAdjust, fmt.Sprintf("balance %s short of %s within %s → amount %s", d.Inputs["balance"], d.Inputs["amount"], d.Inputs["sweepThreshold"], FormatCents(cents, ""))
+	recordDecision(ctx, d)
+
+	p.Logger.WarnContext(ctx, "reducing order to the available balance", "amountInCents", order.AmountInCents, "sweptAmountInCents", cents, "balance", balance)
+
+	swept := order
+	swept.AmountInCents = cents
+
+	var volume, quoted float64
+	if volume, quoted, err = p.fetchBuyVolume(ctx, swept); err != nil {
+		return res, true, err
+	} else if volume, err = p.roundVolume(ctx, swept.Pair, volume); err != nil {
+		return res, true, err
+	}
+
+	if min, perr := strconv.ParseFloat(p.orderMin(swept.Pair), 64); perr == nil && volume < min {
+		return res, true, fmt.Errorf("%w: swept volume %v is below the %s minimum of %v", ErrOrderToSmall, volume, swept.Pair, min)
+	}
+
+	res = newResponse(swept, "market")
+	res.SweptFromCents = order.AmountInCents
+	res.RequestedVolume = volume
+	if res.TransactionID, res.AdditionalInfo, err = p.placeOrder(ctx, swept, volume); err != nil {
+		return res, true, err
+	}
+
+	if res, err = p.awaitFill(ctx, stream, res); err != nil {
+		return res, true, err
+	}
+	p.recordSlippage(ctx, &res, quoted)
+
+	return res, true, nil
+}
@@ -0,0 +1,129 @@
+package dca
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Limits of the tags of a run, they're repeated on every order record and in every notification.
+const (
+	maxTags           = 16
+	maxTagValueLength = 128
+)
+
+// tagKeyPattern is the format of tag keys: lower case letters, digits, '_', '-' and '.', starting with a letter.
+var tagKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_.-]{0,62}$`)
+
+// Tags is a flag.Value collecting repeated key=value flags, a key given twice keeps its last value.
+type Tags map[string]string
+
+func (t *Tags) String() string {
+	return FormatTags(*t)
+}
+
+func (t *Tags) Set(value string) error {
+	key, v, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("invalid tag %q, want key=value", value)
+	}
+	if *t == nil {
+		*t = Tags{}
+	}
+	(*t)[strings.TrimSpace(key)] = strings.TrimSpace(v)
+	return nil
+}
+
+// ValidateTags checks the keys of tags are lower case identifiers, e.g. cost-center or goal, the values are
+// non-empty printable text and there are at most 16 of them.
+func ValidateTags(tags map[string]string) error {
+	if len(tags) > maxTags {
+		return fmt.Errorf("at most %d tags are allowed, got %d", maxTags, len(tags))
+	}
+
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(tags)) {
+		value := tags[key]
+		switch {
+		case !tagKeyPattern.MatchString(key):
+			errs = append(errs, fmt.Errorf("tag key %q must start with a lower case letter followed by at most 62 lower case letters, digits, '_', '-' or '.'", key))
+		case value == "":
+			errs = append(errs, fmt.Errorf("tag %s has no value", key))
+		case len(value) > maxTagValueLength:
+			errs = append(errs, fmt.Errorf("tag %s is longer than %d bytes", key, maxTagValueLength))
+		case strings.ContainsFunc(value, func(r rune) bool { return !unicode.IsPrint(r) }):
+			errs = append(errs, fmt.Errorf("tag %s contains unprintable characters", key))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MergeTags merges layers of tags key by key, a tag of a later layer overrides the same tag of earlier ones. The
+// layers of a run are the config, the selected profile, then the triggering event or the --tag flags. nil is returned
+// when no layer has tags.
+func MergeTags(layers ...map[string]string) map[string]string {
+	var merged map[string]string
+	for _, tags := range layers {
+		if len(tags) == 0 {
+			continue
+		} else if merged == nil {
+			merged = map[string]string{}
+		}
+		maps.Copy(merged, tags)
+	}
+	return merged
+}
+
+// FormatTags returns tags as key=value pairs ordered by key, e.g. "goal=retirement,household=A".
+func FormatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for _, key := range slices.Sorted(maps.Keys(tags)) {
+		pairs = append(pairs, key+"="+tags[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// EventTags returns the tags field of the detail of an EventBridge event, tags overriding the config's for the run it
+// triggers. nil is returned when the event has none.
+func EventTags(event []byte) map[string]string {
+	var e struct {
+		Detail struct {
+			Tags map[string]string `json:"tags"`
+		} `json:"detail"`
+	}
+	if err := json.Unmarshal(event, &e); err != nil {
+		return nil
+	}
+	return e.Detail.Tags
+}
+
+// HasTags reports whether the order of the record has every tag of filter.
+func (r OrderRecord) HasTags(filter map[string]string) bool {
+	for key, value := range filter {
+		if v, ok := r.Order.Tags[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterOrderRecordsByTags returns the records of orders with every tag of filter, every record when filter is empty.
+// Records written before orders were tagged have no tags.
+func FilterOrderRecordsByTags(records []OrderRecord, filter map[string]string) []OrderRecord {
+	if len(filter) == 0 {
+		return records
+	}
+
+	var filtered []OrderRecord
+	for _, rec := range records {
+		if rec.HasTags(filter) {
+			filtered = append(filtered, rec)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,210 @@
+package dca_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+func TestValidateTags(t *testing.T) {
+	many := map[string]string{}
+	for i := range 17 {
+		many[string(rune('a'+i))] = "x"
+	}
+	tt := []struct {
+		tags map[string]string
+		err  string
+	}{
+		{nil, ""},
+		{map[string]string{"household": "A", "goal": "retirement", "source": "lambda-weekly", "cost.center": "42"}, ""},
+		{map[string]string{"Household": "A"}, "tag key \"Household\""},
+		{map[string]string{"1st": "A"}, "tag key \"1st\""},
+		{map[string]string{"cost center": "A"}, "tag key \"cost center\""},
+		{map[string]string{"goal": ""}, "tag goal has no value"},
+		{map[string]string{"goal": "a\nb"}, "unprintable"},
+		{map[string]string{"goal": strings.Repeat("x", 129)}, "longer than 128 bytes"},
+		{many, "at most 16 tags"},
+	}
+	for i, tc := range tt {
+		err := dca.ValidateTags(tc.tags)
+		if tc.err == "" && err != nil {
+			t.Errorf("%d: want no error got %v", i, err)
+		} else if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%d: want %q got %v", i, tc.err, err)
+		}
+	}
+}
+
+func TestEventTags(t *testing.T) {
+	tt := []struct {
+		event    string
+		expected string
+	}{
+		{`{"detail":{"profile":"weekly","tags":{"source":"lambda-weekly","goal":"retirement"}}}`, "goal=retirement,source=lambda-weekly"},
+		{`{"detail":{}}`, ""},
+		{`{"detail":{"tags":{"goal":5}}}`, ""},
+		{`not json`, ""},
+	}
+	for i, tc := range tt {
+		if want, got := tc.expected, dca.FormatTags(dca.EventTags([]byte(tc.event))); got != want {
+			t.Errorf("%d: want %q got %q", i, want, got)
+		}
+	}
+}
+
+func TestApp_LoadConfig_Tags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{
+		"krakenApiKey": "key",
+		"krakenPrivateKey": "secret",
+		"orderAmountInCents": 500,
+		"tags": {"household": "A", "goal": "retirement", "source": "config"},
+		"profiles": {"weekly": {"tags": {"goal": "college", "source": "profile"}}}
+	}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the profile's tags override the config's and the event's override both, key by key
+	tt := []struct {
+		profile  string
+		event    map[string]string
+		expected string
+		err      string
+	}{
+		{"", nil, "goal=retirement,household=A,source=config", ""},
+		{"weekly", nil, "goal=college,household=A,source=profile", ""},
+		{"", map[string]string{"source": "lambda-weekly"}, "goal=retirement,household=A,source=lambda-weekly", ""},
+		{"weekly", map[string]string{"source": "lambda-weekly", "run": "catch-up"}, "goal=college,household=A,run=catch-up,source=lambda-weekly", ""},
+		{"", map[string]string{"Source": "lambda"}, "", "invalid tags"},
+	}
+	for i, tc := range tt {
+		app := dca.NewApp()
+		app.Profile, app.Tags = tc.profile, tc.event
+		err := app.LoadConfig(context.Background(), path)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%d: want %q got %v", i, tc.err, err)
+			}
+			continue
+		} else if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if want, got := tc.expected, dca.FormatTags(app.Config.Tags); got != want {
+			t.Errorf("%d: want %q got %q", i, want, got)
+		}
+	}
+}
+
+func TestApp_Run_Tags(t *testing.T) {
+	s := newKrakenTestServer(t, map[string][]string{
+		"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+		"/0/public/Ticker":       {tickerResponse},
+		"/0/private/AddOrder":    {addOrderResponse},
+		"/0/private/QueryOrders": {queryOrdersResponse},
+	})
+
+	store := filepath.Join(t.TempDir(), "orders.jsonl")
+	tags := map[string]string{"household": "A", "goal": "retirement"}
+	app, n := newTestApp(s, dca.AppConfig{OrderStorePath: store, Tags: tags})
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "goal=retirement,household=A", dca.FormatTags(n.summaries[0].Tags); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	records, err := dca.NewFileOrderStore(store).List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, len(records); got != want {
+		t.Fatalf("want %v got %v", want, got)
+	}
+	if want, got := "goal=retirement,household=A", dca.FormatTags(records[0].Order.Tags); got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestFilterOrderRecordsByTags(t *testing.T) {
+	records := []dca.OrderRecord{
+		{Order: dca.ExecuteOrderResponse{TransactionID: "A", Tags: map[string]string{"household": "A", "goal": "retirement"}}},
+		{Order: dca.ExecuteOrderResponse{TransactionID: "B", Tags: map[string]string{"household": "B", "goal": "retirement"}}},
+		// recorded before orders were tagged
+		{Order: dca.ExecuteOrderResponse{TransactionID: "C"}},
+	}
+	tt := []struct {
+		filter   map[string]string
+		expected string
+	}{
+		{nil, "ABC"},
+		{map[string]string{"goal": "retirement"}, "AB"},
+		{map[string]string{"goal": "retirement", "household": "B"}, "B"},
+		{map[string]string{"household": "C"}, ""},
+	}
+	for i, tc := range tt {
+		var got string
+		for _, rec := range dca.FilterOrderRecordsByTags(records, tc.filter) {
+			got += rec.Order.TransactionID
+		}
+		if want := tc.expected; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestWriteOrdersCSV(t *testing.T) {
+	at := time.Date(2024, 4, 28, 10, 28, 20, 0, time.UTC)
+	records := []dca.OrderRecord{
+		{Time: at, RunID: "run-1", Order: dca.ExecuteOrderResponse{TransactionID: "TXID-1", Pair: "XBTUSD", Side: "buy", Status: "closed", Label: "retirement",
+			VolumePurchased: 0.0001, Price: 50000, Cost: 5, Fee: 0.02, Tags: map[string]string{"household": "A", "source": "lambda-weekly"}}},
+		{Time: at.Add(time.Hour), RunID: "run-2", Order: dca.ExecuteOrderResponse{TransactionID: "TXID-2", Pair: "XBTUSD", Side: "buy", Status: "closed",
+			VolumePurchased: 0.0001, Price: 50000, Cost: 5, Fee: 0.02, Tags: map[string]string{"goal": "college"}}, Asset: "BTC"},
+		// recorded before the asset was, it's derived from the pair
+		{Time: at.Add(2 * time.Hour), RunID: "run-3", Order: dca.ExecuteOrderResponse{TransactionID: "TXID-3", Pair: "ETHEUR", Side: "buy", Status: "closed",
+			VolumePurchased: 0.002, Price: 2500, Cost: 5, Fee: 0.02}},
+	}
+
+	var b bytes.Buffer
+	if err := dca.WriteOrdersCSV(&b, records, time.UTC, dca.MoneyFormat{}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "time,runId,transactionId,pair,asset,side,status,label,profile,volume,price,cost,fee,tag:goal,tag:household,tag:source\n" +
+		"2024-04-28T10:28:20Z,run-1,TXID-1,XBTUSD,BTC,buy,closed,retirement,,0.00010000,50000.00,5.00,0.02,,A,lambda-weekly\n" +
+		"2024-04-28T11:28:20Z,run-2,TXID-2,XBTUSD,BTC,buy,closed,,,0.00010000,50000.00,5.00,0.02,college,,\n" +
+		"2024-04-28T12:28:20Z,run-3,TXID-3,ETHEUR,ETH,buy,closed,,,0.00200000,2500.00,5.00,0.02,,,\n"
+	if want, got := expected, b.String(); got != want {
+		t.Errorf("want %q got %q", want, got)
+	}
+}
+
+func TestExecuteOrderResponse_UnmarshalJSON_Labels(t *testing.T) {
+	tt := []struct {
+		json     string
+		expected string
+	}{
+		{`{"transactionId":"A","tags":{"household":"A"}}`, "household=A"},
+		// recorded before labels were merged into the tags
+		{`{"transactionId":"A","labels":{"goal":"retirement"}}`, "goal=retirement"},
+		{`{"transactionId":"A","labels":{"goal":"college","household":"B"},"tags":{"goal":"retirement"}}`, "goal=retirement,household=B"},
+		{`{"transactionId":"A"}`, ""},
+	}
+	for i, tc := range tt {
+		var res dca.ExecuteOrderResponse
+		if err := json.Unmarshal([]byte(tc.json), &res); err != nil {
+			t.Fatal(err)
+		}
+		if want, got := "A", res.TransactionID; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.expected, dca.FormatTags(res.Tags); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,466 @@
+package dca
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// maskedSecret replaces secret values in a ValidationReport.
+const maskedSecret = "******"
+
+// ValidateOptions controls the checks made by App.Validate.
+type ValidateOptions struct {
+	// Offline skips resolving secret references and checks the pair against the bundled list only.
+	Offline bool
+}
+
+// ValidationReport describes the problems found in a config and its effective values.
+type ValidationReport struct {
+	// Config is the config with defaults applied and secrets masked, secret references are kept as is.
+	Config   AppConfig `json:"config"`
+	Problems []string  `json:"problems"`
+	// Issues are the static issues of the config, including warnings which aren't problems.
+	Issues []ValidationIssue `json:"issues"`
+}
+
+// OK reports whether no problems were found.
+func (r ValidationReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Validate checks the config merged from filenames without side effects, no private API calls are made and no orders are
+// placed. Unlike LoadConfig every problem found is reported and the app config is left untouched.
+func (m *App) Validate(ctx context.Context, filenames []string, opts ValidateOptions) (report ValidationReport) {
+	report.Problems, report.Issues = []string{}, []ValidationIssue{}
+	problem := func(err error) {
+		if errs, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, err = range errs.Unwrap() {
+				report.Problems = append(report.Problems, err.Error())
+			}
+		} else {
+			report.Problems = append(report.Problems, err.Error())
+		}
+	}
+
+	config, _, issues, err := m.readConfig(ctx, filenames...)
+	if err != nil {
+		problem(fmt.Errorf("failed to read config: %w", err))
+		return report
+	}
+	report.Config = config.withDefaults().masked()
+
+	// warnings such as unknown keys are only reported as issues
+	report.Issues = append(report.Issues, issues...)
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			problem(issue)
+		}
+	}
+
+	// secrets are resolved into a copy so the report keeps the references
+	resolved := config
+	if !opts.Offline {
+		if config.MQTT != nil {
+			mqtt := *config.MQTT
+			resolved.MQTT = &mqtt
+		}
+		resolved.ExtraHeaders = maps.Clone(config.ExtraHeaders)
+		if err = resolveSecrets(ctx, m.secretResolver(), resolved.secretFields()); err != nil {
+			problem(err)
+		}
+	}
+
+	// the pair was checked against the bundled list with the other static checks, online it must also be listed
+	pair := report.Config.Pair
+	if _, bundled := krakenPairs[pair]; bundled && !opts.Offline {
+		provider := NewKrakenProvider(&KrakenProviderConfig{
+			Logger:           m.Logger,
+			BaseURL:          config.KrakenBaseURL,
+			MaxResponseBytes: config.KrakenMaxResponseBytes,
+			ReadOnly:         true,
+			ExtraHeaders:     resolved.ExtraHeaders,
+		})
+		if err = provider.CheckPair(ctx, pair); err != nil {
+			problem(fmt.Errorf("pair %s: %w", pair, err))
+		}
+	}
+
+	if config.OrderStorePath != "" {
+		dir := filepath.Dir(config.OrderStorePath)
+		if info, err := os.Stat(dir); err != nil {
+			problem(fmt.Errorf("orderStorePath: %w", err))
+		} else if !info.IsDir() {
+			problem(fmt.Errorf("orderStorePath: %s is not a directory", dir))
+		}
+	}
+
+	return report
+}
+
+// withDefaults returns a copy of the config with the defaults used by a run applied.
+func (c AppConfig) withDefaults() AppConfig {
+	if c.KrakenBaseURL == "" {
+		c.KrakenBaseURL = KrakenDefaultBaseURL
+	}
+	if c.KrakenMaxResponseBytes <= 0 {
+		c.KrakenMaxResponseBytes = DefaultMaxResponseBytes
+	}
+	if c.KrakenUserRef == 0 {
+		c.KrakenUserRef = KrakenDefaultUserRef
+	}
+	if c.KrakenTier == "" {
+		c.KrakenTier = KrakenTierStarter
+	}
+	if c.Pair == "" {
+		c.Pair = KrakenDefaultPair
+	}
+	if c.DedupePolicy == "" {
+		c.DedupePolicy = DedupePolicyProceed
+	}
+	if c.MQTT != nil {
+		mqtt := *c.MQTT
+		if mqtt.TopicPrefix == "" {
+			mqtt.TopicPrefix = MQTTDefaultTopicPrefix
+		}
+		c.MQTT = &mqtt
+	}
+	return c
+}
+
+// masked returns a copy of the config with secret values masked, secret references are kept.
+func (c AppConfig) masked() AppConfig {
+	if c.MQTT != nil {
+		mqtt := *c.MQTT
+		c.MQTT = &mqtt
+	}
+	if c.Discord != nil {
+		discord := *c.Discord
+		c.Discord = &discord
+	}
+	if c.SignedReceipts != nil {
+		receipts := *c.SignedReceipts
+		c.SignedReceipts = &receipts
+	}
+	c.ExtraHeaders = maps.Clone(c.ExtraHeaders)
+	for _, field := range c.secretFields() {
+		if *field.Value != "" && !HasAWSParamStorePrefix(*field.Value) {
+			field.store(maskedSecret)
+		}
+	}
+	return c
+}
+
+// Severities of a ValidationIssue, configs with errors fail to load while warnings are only logged.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Codes of a ValidationIssue.
+const (
+	// IssueUnknownKey is a key which isn't a config setting, such as a misspelled one. It's ignored when the config is
+	// loaded.
+	IssueUnknownKey = "unknown_key"
+	// IssueInvalidType is a value of the wrong JSON type, e.g. a string where a number is expected.
+	IssueInvalidType = "invalid_type"
+	// IssueInvalidValue is a value which is missing, out of range or conflicts with another value.
+	IssueInvalidValue = "invalid_value"
+	// IssueInvalidProfile is a profile which can't be applied.
+	IssueInvalidProfile = "invalid_profile"
+)
+
+// ValidationIssue is a problem found by ValidateConfigBytes.
+type ValidationIssue struct {
+	// Field is the dotted path of the value, e.g. mqtt.brokerUrl, empty when the issue isn't about a single value.
+	Field    string `json:"field"`
+	Code     string `json:"code"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+
+	// err is the error the issue was made from so LoadConfig keeps returning errors which can be matched.
+	err error
+}
+
+func (i ValidationIssue) Error() string {
+	return i.Message
+}
+
+func (i ValidationIssue) Unwrap() error {
+	return i.err
+}
+
+// ValidateConfigBytes performs every static check of the config document b: the types of its values, unknown keys,
+// required values, ranges, conflicting values and the pair. The profile the document selects is applied first. No
+// secret is resolved and no network call is made, so it's safe to run without credentials, e.g. in a deployment
+// pipeline. The issues are in a stable order. An error is only returned when b isn't a JSON object.
+func ValidateConfigBytes(b []byte) ([]ValidationIssue, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	} else if doc == nil {
+		return nil, errors.New("invalid config: not a JSON object")
+	}
+
+	_, issues, err := checkConfig(b, "", ConfigSources{})
+	if err != nil {
+		issues = append(issues, newValidationIssue(configKeyProfile, IssueInvalidProfile, err))
+	}
+	return issues, nil
+}
+
+// checkConfig applies profile, or the profile selected by the document when it's empty, to the config document b and
+// returns the config it decodes to with its issues. Keys are checked before the profile is applied so the profiles
+// which aren't selected are checked too, values are checked once it's applied. An error is returned when the profile
+// can't be applied.
+func checkConfig(b []byte, profile string, sources ConfigSources) (config AppConfig, issues []ValidationIssue, err error) {
+	issues = checkConfigKeys(b)
+	if b, err = applyProfile(b, profile, sources); err != nil {
+		return config, issues, err
+	}
+
+	// a value of the wrong type leaves the config partially decoded, its values aren't validated
+	if slices.ContainsFunc(issues, func(i ValidationIssue) bool { return i.Code == IssueInvalidType }) {
+		_ = json.Unmarshal(b, &config)
+		config.Profiles = nil
+		return config, issues, nil
+	}
+
+	config, valueIssues := checkConfigValues(b)
+	return config, append(issues, valueIssues...), nil
+}
+
+// issueErrors returns the issues of issues with SeverityError joined into an error, nil when there are none.
+func issueErrors(issues []ValidationIssue) error {
+	var errs []error
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			errs = append(errs, issue)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkConfigKeys returns the unknown keys and values of the wrong type of the config document b, including those of
+// its profiles.
+func checkConfigKeys(b []byte) []ValidationIssue {
+	var doc map[string]any
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil
+	}
+
+	var issues []ValidationIssue
+	checkConfigValue("", doc, reflect.TypeFor[AppConfig](), &issues)
+	if profiles, ok := doc["profiles"].(map[string]any); ok {
+		for _, name := range slices.Sorted(maps.Keys(profiles)) {
+			checkConfigValue("profiles."+name, profiles[name], reflect.TypeFor[AppConfig](), &issues)
+		}
+	}
+	return issues
+}
+
+// checkConfigValues decodes the config document b, its profile applied, and returns the issues of its values.
+// Values aren't validated when a value has the wrong type since the config is then only partially decoded.
+func checkConfigValues(b []byte) (config AppConfig, issues []ValidationIssue) {
+	if err := json.Unmarshal(b, &config); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return config, []ValidationIssue{{Field: typeErr.Field, Code: IssueInvalidType, Severity: SeverityError,
+				Message: fmt.Sprintf("%s is a JSON %s, want %s", typeErr.Field, typeErr.Value, jsonTypeName(typeErr.Type)), err: err}}
+		}
+		return config, []ValidationIssue{newValidationIssue("", IssueInvalidType, err)}
+	}
+	config.Profiles = nil
+
+	var errs []error
+	if err := config.Validate(); err != nil {
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			errs = joined.Unwrap()
+		} else {
+			errs = []error{err}
+		}
+	}
+	if _, ok := krakenPairs[cmp.Or(config.Pair, KrakenDefaultPair)]; !ok {
+		errs = append(errs, fieldErr("pair", fmt.Errorf("pair %s: %w", config.Pair, ErrUnsupportedPair)))
+	}
+
+	for _, err := range errs {
+		var field string
+		if fe, ok := err.(*fieldError); ok {
+			field = fe.Path
+		}
+		issues = append(issues, newValidationIssue(field, IssueInvalidValue, err))
+	}
+	return config, issues
+}
+
+// newValidationIssue returns an error issue of field made from err.
+func newValidationIssue(field, code string, err error) ValidationIssue {
+	return ValidationIssue{Field: field, Code: code, Severity: SeverityError, Message: err.Error(), err: err}
+}
+
+// checkConfigValue appends the issues of the decoded JSON value v at path, which is decoded into a value of type t.
+// Null is accepted for every type, it leaves the default.
+func checkConfigValue(path string, v any, t reflect.Type, issues *[]ValidationIssue) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if v == nil || t.Kind() == reflect.Interface || reflect.PointerTo(t).Implements(reflect.TypeFor[json.Unmarshaler]()) ||
+		reflect.PointerTo(t).Implements(reflect.TypeFor[encoding.TextUnmarshaler]()) {
+		return
+	}
+
+	invalid := func() {
+		*issues = append(*issues, ValidationIssue{Field: path, Code: IssueInvalidType, Severity: SeverityError,
+			Message: fmt.Sprintf("%s is %s, want %s", path, jsonKind(v), jsonTypeName(t))})
+	}
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			invalid()
+			return
+		}
+		fields := jsonFields(t)
+		for _, key := range slices.Sorted(maps.Keys(obj)) {
+			field, ok := fields[key]
+			if !ok {
+				// encoding/json matches keys case-insensitively
+				for name, f := range fields {
+					if strings.EqualFold(name, key) {
+						field, ok = f, true
+						break
+					}
+				}
+			}
+			if !ok {
+				*issues = append(*issues, ValidationIssue{Field: join(key), Code: IssueUnknownKey, Severity: SeverityWarning,
+					Message: fmt.Sprintf("%s isn't a config setting, it's ignored", join(key))})
+			} else if path != "" || key != "profiles" {
+				// the profiles are checked as configs of their own
+				checkConfigValue(join(key), obj[key], field.Type, issues)
+			}
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			invalid()
+			return
+		}
+		for _, key := range slices.Sorted(maps.Keys(obj)) {
+			checkConfigValue(join(key), obj[key], t.Elem(), issues)
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := v.([]any)
+		if !ok {
+			invalid()
+			return
+		}
+		for i, e := range arr {
+			checkConfigValue(fmt.Sprintf("%s[%d]", path, i), e, t.Elem(), issues)
+		}
+	case reflect.String:
+		if _, ok := v.(string); !ok {
+			invalid()
+		}
+	case reflect.Bool:
+		if _, ok := v.(bool); !ok {
+			invalid()
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, ok := v.(json.Number); !ok {
+			invalid()
+		} else if _, err := n.Int64(); err != nil {
+			invalid()
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := v.(json.Number); !ok {
+			invalid()
+		}
+	}
+}
+
+// jsonTypeName describes the JSON value a value of type t is decoded from.
+func jsonTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	default:
+		return "any value"
+	}
+}
+
+// jsonFields maps the JSON keys of the struct type t to its fields.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		fields[cmp.Or(name, f.Name)] = f
+	}
+	return fields
+}
+
+// fieldError is an error of AppConfig.Validate about the setting at Path, e.g. "mqtt.brokerUrl". Errors of the config
+// as a whole have no Path.
+type fieldError struct {
+	Path string
+	Err  error
+}
+
+func (e *fieldError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *fieldError) Unwrap() error {
+	return e.Err
+}
+
+// fieldErr returns err as an error about the setting at path, nil when err is nil. An error about a setting nested in
+// path, e.g. "brokerUrl" in "mqtt", gets the nested setting's path under path.
+func fieldErr(path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if fe, ok := err.(*fieldError); ok {
+		return &fieldError{Path: path + "." + fe.Path, Err: fe.Err}
+	}
+	return &fieldError{Path: path, Err: err}
+}
@@ -0,0 +1,188 @@
+package dca_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/1gm/dca"
+)
+
+func TestValidateConfigBytes(t *testing.T) {
+	const required = `"krakenApiKey": "key", "krakenPrivateKey": "secret", "orderAmountInCents": 500`
+	type issue struct{ field, code, severity string }
+	tt := []struct {
+		config   string
+		expected []issue
+	}{
+		{`{` + required + `}`, nil},
+		{`{` + required + `, "orderAmountInCent": 500}`, []issue{{"orderAmountInCent", dca.IssueUnknownKey, dca.SeverityWarning}}},
+		// keys match case-insensitively like they're decoded
+		{`{` + required + `, "PAIR": "XBTEUR"}`, nil},
+		{`{"krakenApiKey": "key", "krakenPrivateKey": "secret", "orderAmountInCents": "500", "mqtt": {"brokerUrl": "tcp://broker:1883", "qos": 0.5}}`, []issue{
+			{"mqtt.qos", dca.IssueInvalidType, dca.SeverityError},
+			{"orderAmountInCents", dca.IssueInvalidType, dca.SeverityError},
+		}},
+		{`{` + required + `, "reconcileOrders": true, "mqtt": {"brokerUrl": "http://broker"}, "budget": {"monthlyAmountInCents": 1000, "runsPerMonth": 4, "interval": "24h"}}`, []issue{
+			{"orderStorePath", dca.IssueInvalidValue, dca.SeverityError},
+			{"mqtt.brokerUrl", dca.IssueInvalidValue, dca.SeverityError},
+			{"budget", dca.IssueInvalidValue, dca.SeverityError},
+			// a budget also needs the order store
+			{"orderStorePath", dca.IssueInvalidValue, dca.SeverityError},
+		}},
+		{`{` + required + `, "pair": "DOGEUSD"}`, []issue{{"pair", dca.IssueInvalidValue, dca.SeverityError}}},
+		// profiles which aren't selected are checked for unknown keys and types
+		{`{` + required + `, "profiles": {"weekly": {"orderAmountInCent": 500, "label": 1}}}`, []issue{
+			{"profiles.weekly.label", dca.IssueInvalidType, dca.SeverityError},
+			{"profiles.weekly.orderAmountInCent", dca.IssueUnknownKey, dca.SeverityWarning},
+		}},
+		{`{` + required + `, "profile": "weekly", "profiles": {"weekly": {"orderAmountInCents": 0}}}`, []issue{{"orderAmountInCents", dca.IssueInvalidValue, dca.SeverityError}}},
+		{`{` + required + `, "profile": "daily"}`, []issue{{"profile", dca.IssueInvalidProfile, dca.SeverityError}}},
+	}
+	for i, tc := range tt {
+		issues, err := dca.ValidateConfigBytes([]byte(tc.config))
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		var got []issue
+		for _, is := range issues {
+			got = append(got, issue{is.Field, is.Code, is.Severity})
+			if is.Message == "" {
+				t.Errorf("%d: want a message for %s", i, is.Field)
+			}
+		}
+		if want := tc.expected; !reflect.DeepEqual(got, want) {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+
+		// the issues are stable for CI to compare
+		again, _ := dca.ValidateConfigBytes([]byte(tc.config))
+		if !reflect.DeepEqual(issues, again) {
+			t.Errorf("%d: want %v got %v", i, issues, again)
+		}
+	}
+
+	for _, config := range []string{`[]`, `{`, `null`} {
+		if _, err := dca.ValidateConfigBytes([]byte(config)); err == nil {
+			t.Errorf("%s: want an error", config)
+		}
+	}
+}
+
+func TestApp_LoadConfig_Issues(t *testing.T) {
+	tt := []struct {
+		config string
+		valid  bool
+	}{
+		// an unknown key is only a warning
+		{`{"krakenApiKey": "key", "krakenPrivateKey": "secret", "orderAmountInCents": 500, "orderAmountInCent": 500}`, true},
+		{`{"krakenApiKey": "key", "krakenPrivateKey": "secret", "orderAmountInCents": "500"}`, false},
+		{`{"krakenApiKey": "key", "krakenPrivateKey": "secret", "orderAmountInCents": 500, "pair": "DOGEUSD"}`, false},
+	}
+	for i, tc := range tt {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(tc.config), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		app := dca.NewApp()
+		app.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+		err := app.LoadConfig(context.Background(), path)
+		if want, got := tc.valid, err == nil; got != want {
+			t.Errorf("%d: want valid %v got %v", i, want, err)
+		}
+
+		// LoadConfig fails on exactly the errors ValidateConfigBytes reports
+		issues, _ := dca.ValidateConfigBytes([]byte(tc.config))
+		var failed bool
+		for _, issue := range issues {
+			failed = failed || issue.Severity == dca.SeverityError
+		}
+		if want, got := failed, err != nil; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestValidateConfigBytes_Fields(t *testing.T) {
+	// every setting is invalid, each error of AppConfig.Validate is an issue of the setting it's about, the credentials
+	// are missing
+	config := `{
+		"orderAmountInCents": 0,
+		"orderType": "limit",
+		"volumeRounding": "x",
+		"maxPriceDeviationPercent": -1,
+		"failureArchive": "s3://",
+		"confirmAboveCents": -1,
+		"slippageAlertPercent": -1,
+		"sweepThresholdPercent": 100,
+		"pausedUntil": "soon",
+		"orderAmountParameter": "amount",
+		"extraHeaders": {"API-Key": "x"},
+		"lowBalanceThresholdRuns": -1,
+		"reconcileOrders": true,
+		"earnAllocate": true,
+		"krakenTier": "gold",
+		"dedupePolicy": "maybe",
+		"reportingTimeZone": "Nowhere/Nothing",
+		"krakenFillTimeout": "0s",
+		"tags": {"": "x"},
+		"runTimeout": "x",
+		"fillTolerance": "x",
+		"scheduleDriftWarning": "-1s",
+		"maxClockSkew": "x",
+		"receiptTemplate": "{{",
+		"mqtt": {"brokerUrl": "tcp://broker:1883", "qos": 2},
+		"discord": {"webhookUrl": "ftp://discord"},
+		"pushgateway": {"url": "http://"},
+		"auditLog": "s3://",
+		"pairMetadata": {"ttl": "0s"},
+		"logFile": {"path": ""},
+		"circuitBreaker": {"failureThreshold": -1},
+		"signedReceipts": {"privateKey": ""},
+		"priceLadder": [{"amountInCents": 0}],
+		"guardFailurePolicy": "ajar",
+		"budget": {"monthlyAmountInCents": 0},
+		"dustSweep": {"maxValueInCents": 0},
+		"priceLog": {"path": ""},
+		"retention": {"pruneAfterDays": 0},
+		"convertFunding": {"pair": "USDTUSD", "bufferPercent": 100},
+		"provider": "binance",
+		"retryMaxAttempts": -1,
+		"retryBackoff": "-1s",
+		"paperFeeRate": 1,
+		"paperDepthLevels": -1,
+		"pair": "DOGEUSD"
+	}`
+	issues, err := dca.ValidateConfigBytes([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields []string
+	for _, is := range issues {
+		if is.Field == "" {
+			t.Errorf("want the setting of %q", is.Message)
+		}
+		fields = append(fields, is.Field)
+	}
+	expected := []string{
+		"orderAmountInCents", "orderType", "volumeRounding", "maxPriceDeviationPercent", "failureArchive",
+		"confirmAboveCents", "slippageAlertPercent", "sweepThresholdPercent", "pausedUntil", "orderAmountParameter",
+		"extraHeaders", "lowBalanceThresholdRuns", "orderStorePath", "earnStrategyId", "krakenTier", "dedupePolicy",
+		"reportingTimeZone", "krakenFillTimeout", "tags", "runTimeout", "fillTolerance", "scheduleDriftWarning",
+		"maxClockSkew", "receiptTemplate", "mqtt.qos", "discord.webhookUrl", "pushgateway.url", "auditLog",
+		"pairMetadata.ttl", "logFile.path", "circuitBreaker.failureThreshold", "signedReceipts.privateKey",
+		"priceLadder", "guardFailurePolicy", "budget.monthlyAmountInCents", "orderStorePath",
+		"dustSweep.maxValueInCents", "priceLog.path", "retention", "orderStorePath", "convertFunding.bufferPercent",
+		"provider", "retryMaxAttempts", "retryBackoff", "paperFeeRate", "paperDepthLevels", "krakenApiKey",
+		"krakenPrivateKey", "pair",
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("want %v got %v", expected, fields)
+	}
+}
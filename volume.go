@@ -0,0 +1,98 @@
+package dca
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// parseDecimal parses a positive decimal such as "0.00001" exactly.
+func parseDecimal(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || strings.ContainsAny(s, "/eE") {
+		return nil, fmt.Errorf("%q isn't a decimal number", s)
+	} else if r.Sign() <= 0 {
+		return nil, fmt.Errorf("%q must be positive", s)
+	}
+	return r, nil
+}
+
+// decimalPlaces returns the number of digits after the decimal point of s.
+func decimalPlaces(s string) int {
+	if _, frac, ok := strings.Cut(s, "."); ok {
+		return len(frac)
+	}
+	return 0
+}
+
+// roundVolumeDown rounds volume down to a multiple of increment. The volume is taken as the shortest decimal that
+// represents it and the rounding is done with exact decimal arithmetic.
+func roundVolumeDown(volume float64, increment string) (string, error) {
+	inc, err := parseDecimal(increment)
+	if err != nil {
+		return "", err
+	}
+
+	v, ok := new(big.Rat).SetString(strconv.FormatFloat(volume, 'f', -1, 64))
+	if !ok {
+		return "", fmt.Errorf("invalid volume %v", volume)
+	}
+
+	// floor(v / inc) * inc, v and inc are positive so truncating division floors
+	q := new(big.Rat).Quo(v, inc)
+	n := new(big.Int).Quo(q.Num(), q.Denom())
+	rounded := new(big.Rat).Mul(new(big.Rat).SetInt(n), inc)
+
+	return rounded.FloatString(decimalPlaces(increment)), nil
+}
+
+// roundVolume rounds volume down to a multiple of VolumeRounding, failing with ErrOrderToSmall when the rounded
+// volume is zero or below the pair's minimum order volume. Volumes are returned as is when VolumeRounding isn't set.
+func (p *KrakenProvider) roundVolume(ctx context.Context, pair string, volume float64) (float64, error) {
+	d := Decision{Name: DecisionVolume, Inputs: map[string]string{"volume": FormatCrypto(volume, ""), "min": p.orderMin(pair)}, Outcome: DecisionProceed}
+	if p.VolumeRounding == "" {
+		// Kraken rejects orders below the minimum, the run doesn't
+		d.Narration = fmt.Sprintf("volume %s ≥ min %s → proceed", d.Inputs["volume"], d.Inputs["min"])
+		if minimum, err := strconv.ParseFloat(d.Inputs["min"], 64); err == nil && volume < minimum {
+			d.Narration = fmt.Sprintf("volume %s below min %s → proceed, the exchange rejects it", d.Inputs["volume"], d.Inputs["min"])
+		}
+		recordDecision(ctx, d)
+		return volume, nil
+	}
+
+	rounded, err := roundVolumeDown(volume, p.VolumeRounding)
+	if err != nil {
+		return 0, fmt.Errorf("failed to round volume: %w", err)
+	}
+
+	p.Logger.InfoContext(ctx, "rounded volume", "volume", strconv.FormatFloat(volume, 'f', -1, 64), "rounded", rounded, "increment", p.VolumeRounding)
+	d.Inputs["increment"], d.Inputs["rounded"] = p.VolumeRounding, rounded
+
+	r, _ := new(big.Rat).SetString(rounded)
+	if r.Sign() == 0 {
+		d.Outcome, d.Narration = DecisionFail, fmt.Sprintf("volume %s rounds down to zero with increment %s → fail", d.Inputs["volume"], p.VolumeRounding)
+		recordDecision(ctx, d)
+		return 0, fmt.Errorf("%w: volume %v rounds down to zero with increment %s", ErrOrderToSmall, volume, p.VolumeRounding)
+	}
+	if min, ok := new(big.Rat).SetString(p.orderMin(pair)); ok && r.Cmp(min) < 0 {
+		d.Outcome, d.Narration = DecisionFail, fmt.Sprintf("volume %s rounded to %s below min %s → fail", d.Inputs["volume"], rounded, d.Inputs["min"])
+		recordDecision(ctx, d)
+		return 0, fmt.Errorf("%w: rounded volume %s is below the %s minimum of %s", ErrOrderToSmall, rounded, pair, p.orderMin(pair))
+	}
+	d.Narration = fmt.Sprintf("volume %s rounded to %s ≥ min %s → proceed", d.Inputs["volume"], rounded, d.Inputs["min"])
+	recordDecision(ctx, d)
+
+	// the rounded decimal has few enough digits to survive the conversion to a float and back unchanged
+	return strconv.ParseFloat(rounded, 64)
+}
+
+// validateVolumeRounding checks increment is a positive decimal.
+func validateVolumeRounding(increment string) error {
+	if _, err := parseDecimal(increment); err != nil {
+		return errors.New("volumeRounding must be a positive decimal, e.g. 0.00001")
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package dca
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Windows a VWAPComparison can be made against.
+const (
+	// VWAPWindowToday is the volume-weighted average price since midnight UTC, Kraken's trading day.
+	VWAPWindowToday = "today"
+	// VWAPWindowRolling is the volume-weighted average price of the last 24 hours.
+	VWAPWindowRolling = "24h"
+)
+
+// MinVWAPDayElapsed is how much of the UTC day must have passed for today's VWAP to be compared against, earlier
+// fills are compared against the last 24 hours since today's VWAP is made of the few trades since midnight.
+const MinVWAPDayElapsed = time.Hour
+
+// DailyVWAP is the volume-weighted average price of a pair as reported by the ticker.
+type DailyVWAP struct {
+	Today         float64
+	TodayVolume   float64
+	Rolling       float64
+	RollingVolume float64
+}
+
+// VWAPComparison compares the average fill price of an order to the volume-weighted average price of the day.
+// Positive deltas are worse than the VWAP: a higher price for buys and a lower price for sells.
+type VWAPComparison struct {
+	Window       string  `json:"window" desc:"The window of the VWAP, today since midnight UTC or the last 24h early in the day" schema:"required" enum:"today,24h"`
+	VWAP         float64 `json:"vwap" desc:"The volume-weighted average price of the window" schema:"required"`
+	FillPrice    float64 `json:"fillPrice" desc:"The average fill price of the order" schema:"required"`
+	Delta        float64 `json:"delta" desc:"The difference between the fill price and the VWAP in the quote currency, positive when worse" schema:"required"`
+	DeltaPercent float64 `json:"deltaPercent" desc:"The difference as a percentage of the VWAP" schema:"required"`
+}
+
+// CompareVWAP compares the fill price of an order on side filled at filledAt to vwap. Today's VWAP is used once
+// MinVWAPDayElapsed of the UTC day has passed and it has traded, the last 24 hours are used otherwise. It returns nil
+// when no VWAP or fill price is known.
+func CompareVWAP(side string, fillPrice float64, filledAt time.Time, vwap DailyVWAP) *VWAPComparison {
+	if fillPrice <= 0 {
+		return nil
+	}
+
+	utc := filledAt.UTC()
+	midnight := time.Date(utc.Year(), utc.Month(), utc.Day(), 0, 0, 0, 0, time.UTC)
+	c := VWAPComparison{Window: VWAPWindowToday, VWAP: vwap.Today, FillPrice: fillPrice}
+	if utc.Sub(midnight) < MinVWAPDayElapsed || vwap.Today <= 0 || vwap.TodayVolume <= 0 {
+		c.Window, c.VWAP = VWAPWindowRolling, vwap.Rolling
+		if vwap.RollingVolume <= 0 {
+			c.VWAP = 0
+		}
+	}
+	if c.VWAP <= 0 {
+		return nil
+	}
+
+	c.Delta = fillPrice - c.VWAP
+	if side == SideSell {
+		c.Delta = c.VWAP - fillPrice
+	}
+	c.DeltaPercent = c.Delta / c.VWAP * 100
+	return &c
+}
+
+// fetchDailyVWAP fetches today's and the last 24 hours' volume-weighted average price of pair from the ticker.
+func (p *KrakenProvider) fetchDailyVWAP(ctx context.Context, pair string) (vwap DailyVWAP, err error) {
+	defer WrapErr(&err, "fetchDailyVWAP")
+
+	var result map[string]tickerEntry
+	if err = p.publicRequest(ctx, "/0/public/Ticker", url.Values{"pair": {pair}}, &result); err != nil {
+		return vwap, err
+	}
+
+	entry, err := pairResult(result, pair)
+	if err != nil {
+		return vwap, fmt.Errorf("invalid ticker response: %w", err)
+	}
+	if len(entry.P) < 2 || len(entry.V) < 2 {
+		return vwap, errors.New("ticker response is missing the VWAP")
+	}
+	for _, f := range []struct {
+		name  string
+		value krakenNumber
+		dst   *float64
+	}{
+		{"today's vwap", entry.P[0], &vwap.Today},
+		{"24h vwap", entry.P[1], &vwap.Rolling},
+		{"today's volume", entry.V[0], &vwap.TodayVolume},
+		{"24h volume", entry.V[1], &vwap.RollingVolume},
+	} {
+		if *f.dst, err = f.value.Float(); err != nil {
+			return vwap, fmt.Errorf("failed to parse %s: %w", f.name, err)
+		}
+	}
+	return vwap, nil
+}
+
+// compareVWAP attaches the comparison of the filled order res to the day's VWAP to summary. The order was already
+// placed so failures are only warnings.
+func (m *App) compareVWAP(ctx context.Context, provider *KrakenProvider, res ExecuteOrderResponse, filledAt time.Time, summary *RunSummary) {
+	if res.Price <= 0 || res.VolumePurchased <= 0 {
+		return
+	}
+
+	vwap, err := provider.fetchDailyVWAP(ctx, res.Pair)
+	if err != nil {
+		m.Logger.WarnContext(ctx, "failed to fetch the VWAP", "error", err)
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("VWAP comparison failed: %v", err))
+		return
+	}
+
+	if summary.VWAP = CompareVWAP(res.Side, res.Price, filledAt, vwap); summary.VWAP != nil {
+		m.Logger.InfoContext(ctx, "compared to the VWAP", "window", summary.VWAP.Window, "vwap", summary.VWAP.VWAP,
+			"price", res.Price, "delta", summary.VWAP.Delta, "deltaPercent", summary.VWAP.DeltaPercent)
+	}
+}
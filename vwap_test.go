@@ -0,0 +1,107 @@
+package dca_test
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1gm/dca"
+)
+
+func TestCompareVWAP(t *testing.T) {
+	noon := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	vwap := dca.DailyVWAP{Today: 50000, TodayVolume: 100, Rolling: 40000, RollingVolume: 1000}
+
+	tt := []struct {
+		side      string
+		price     float64
+		filledAt  time.Time
+		vwap      dca.DailyVWAP
+		window    string
+		delta     float64
+		percent   float64
+		noCompare bool
+	}{
+		{dca.SideBuy, 50500, noon, vwap, dca.VWAPWindowToday, 500, 1, false},
+		{dca.SideBuy, 49500, noon, vwap, dca.VWAPWindowToday, -500, -1, false},
+		// sells are better above the VWAP
+		{dca.SideSell, 50500, noon, vwap, dca.VWAPWindowToday, -500, -1, false},
+		// right at midnight today's VWAP is made of a few trades
+		{dca.SideBuy, 40400, time.Date(2024, 3, 1, 0, 0, 5, 0, time.UTC), vwap, dca.VWAPWindowRolling, 400, 1, false},
+		{dca.SideBuy, 40400, time.Date(2024, 3, 1, 0, 59, 0, 0, time.UTC), vwap, dca.VWAPWindowRolling, 400, 1, false},
+		{dca.SideBuy, 50500, time.Date(2024, 3, 1, 1, 0, 0, 0, time.UTC), vwap, dca.VWAPWindowToday, 500, 1, false},
+		// the UTC day is used whatever the time zone of the fill
+		{dca.SideBuy, 40400, time.Date(2024, 2, 29, 19, 30, 0, 0, time.FixedZone("EST", -5*3600)), vwap, dca.VWAPWindowRolling, 400, 1, false},
+		// nothing traded today
+		{dca.SideBuy, 40400, noon, dca.DailyVWAP{Rolling: 40000, RollingVolume: 1000}, dca.VWAPWindowRolling, 400, 1, false},
+		{dca.SideBuy, 40400, noon, dca.DailyVWAP{}, "", 0, 0, true},
+		{dca.SideBuy, 0, noon, vwap, "", 0, 0, true},
+	}
+	for i, tc := range tt {
+		c := dca.CompareVWAP(tc.side, tc.price, tc.filledAt, tc.vwap)
+		if want, got := tc.noCompare, c == nil; got != want {
+			t.Errorf("%d: want nil %v got %v", i, want, c)
+		}
+		if c == nil {
+			continue
+		}
+		if want, got := tc.window, c.Window; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.delta, c.Delta; math.Abs(got-want) > 1e-9 {
+			t.Errorf("%d: want delta %v got %v", i, want, got)
+		}
+		if want, got := tc.percent, c.DeltaPercent; math.Abs(got-want) > 1e-9 {
+			t.Errorf("%d: want percent %v got %v", i, want, got)
+		}
+	}
+}
+
+func TestApp_Run_CompareVWAP(t *testing.T) {
+	vwapTicker := `{"error":[],"result":{"XXBTZUSD":{"a":["50000.0","1","1.000"],"b":["49990.0","1","1.000"],"c":["50000.0","0.1"],` +
+		`"v":["100.0","1000.0"],"p":["49000.0","48000.0"]}}}`
+
+	tt := []struct {
+		compare bool
+		ticker  string
+		vwap    bool
+		warned  bool
+	}{
+		{false, vwapTicker, false, false},
+		{true, vwapTicker, true, false},
+		// failing to fetch the VWAP doesn't fail the purchase
+		{true, tickerResponse, false, true},
+	}
+	for i, tc := range tt {
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/public/SystemStatus": {`{"error":[],"result":{"status":"online"}}`},
+			"/0/public/Ticker":       {tc.ticker},
+			"/0/private/AddOrder":    {addOrderResponse},
+			"/0/private/QueryOrders": {queryOrdersResponse},
+		})
+		app, n := newTestApp(s, dca.AppConfig{CompareVWAP: tc.compare})
+
+		if err := app.Run(context.Background()); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		summary := n.summaries[0]
+		if want, got := dca.RunStatusSuccess, summary.Status; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.vwap, summary.VWAP != nil; got != want {
+			t.Fatalf("%d: want vwap %v got %v", i, want, summary.VWAP)
+		}
+		if want, got := tc.warned, len(summary.Warnings) > 0 && strings.Contains(summary.Warnings[0], "VWAP comparison failed"); got != want {
+			t.Errorf("%d: want warned %v got %v", i, want, summary.Warnings)
+		}
+		if summary.VWAP == nil {
+			continue
+		}
+		// the fill at 50000 is compared to either window's VWAP depending on the time the test runs
+		if want, got := 50000-summary.VWAP.VWAP, summary.VWAP.Delta; got != want {
+			t.Errorf("%d: want delta %v got %v", i, want, got)
+		}
+	}
+}
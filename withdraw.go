@@ -0,0 +1,143 @@
+package dca
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+)
+
+// KrakenWithdrawInfo is the cost of a withdrawal as quoted by the WithdrawInfo endpoint.
+type KrakenWithdrawInfo struct {
+	Method string `json:"method"`
+	// Limit is the most that can be withdrawn now.
+	Limit float64 `json:"limit"`
+	// Amount is what arrives once the fee is taken.
+	Amount float64 `json:"amount"`
+	Fee    float64 `json:"fee"`
+}
+
+// GetWithdrawInfo quotes withdrawing amount of asset to the withdrawal key, the name of an address set up on Kraken.
+// Nothing is withdrawn.
+func (p *KrakenProvider) GetWithdrawInfo(ctx context.Context, asset, key string, amount float64) (info KrakenWithdrawInfo, err error) {
+	defer WrapErr(&err, "KrakenProvider.GetWithdrawInfo")
+
+	var result struct {
+		Method string `json:"method"`
+		Limit  string `json:"limit"`
+		Amount string `json:"amount"`
+		Fee    string `json:"fee"`
+	}
+	if err = p.privateRequest(ctx, "/0/private/WithdrawInfo", url.Values{
+		"asset":  {asset},
+		"key":    {key},
+		"amount": {strconv.FormatFloat(amount, 'f', -1, 64)},
+	}, &result); err != nil {
+		return info, fmt.Errorf("failed to fetch withdraw info: %w", err)
+	}
+
+	info.Method = result.Method
+	for _, f := range []struct {
+		name  string
+		value string
+		dst   *float64
+	}{
+		{"limit", result.Limit, &info.Limit},
+		{"amount", result.Amount, &info.Amount},
+		{"fee", result.Fee, &info.Fee},
+	} {
+		if *f.dst, err = strconv.ParseFloat(f.value, 64); err != nil {
+			return info, fmt.Errorf("failed to parse %s: %w", f.name, err)
+		}
+	}
+	return info, nil
+}
+
+// WithdrawEstimate describes what withdrawing the accumulated balance of the configured pair's asset would cost.
+type WithdrawEstimate struct {
+	Asset   string  `json:"asset"`
+	Key     string  `json:"key"`
+	Method  string  `json:"method"`
+	Balance float64 `json:"balance"`
+	Fee     float64 `json:"fee"`
+	// FeePercent is the fee as a percentage of the balance.
+	FeePercent       float64 `json:"feePercent"`
+	TargetFeePercent float64 `json:"targetFeePercent,omitempty"`
+	// PurchaseVolume is the volume a purchase of orderAmountInCents buys at the current ask.
+	PurchaseVolume float64 `json:"purchaseVolume"`
+	// PurchasesUntilTarget is how many more purchases bring the fee down to TargetFeePercent of the balance.
+	PurchasesUntilTarget int `json:"purchasesUntilTarget"`
+}
+
+// EstimateWithdrawal quotes withdrawing the balance of the configured pair's base asset to the withdrawal key and,
+// when targetFeePercent is set, estimates how many purchases at the current ask it takes for the fee to fall to that
+// percentage of the balance. Nothing is withdrawn.
+func (m *App) EstimateWithdrawal(ctx context.Context, key string, targetFeePercent float64) (est WithdrawEstimate, err error) {
+	defer WrapErr(&err, "App.EstimateWithdrawal")
+
+	if key == "" {
+		return est, errors.New("a withdrawal key is required")
+	} else if targetFeePercent < 0 {
+		return est, errors.New("the target fee percentage can't be negative")
+	}
+
+	pair := cmp.Or(m.Config.Pair, KrakenDefaultPair)
+	info, ok := krakenPairs[pair]
+	if !ok {
+		return est, fmt.Errorf("%w: %s", ErrUnsupportedPair, pair)
+	}
+
+	// Nothing is withdrawn so the provider is read-only.
+	provider := NewKrakenProvider(&KrakenProviderConfig{
+		APIKey:           m.Config.KrakenAPIKey,
+		APISecret:        m.Config.KrakenPrivateKey,
+		Logger:           m.Logger,
+		BaseURL:          m.Config.KrakenBaseURL,
+		MaxResponseBytes: m.Config.KrakenMaxResponseBytes,
+		Tier:             m.Config.KrakenTier,
+		RateLimitWait:    m.Config.KrakenRateLimitWait,
+		ReadOnly:         true,
+		HTTPClient:       m.httpClient(),
+	})
+
+	est = WithdrawEstimate{Asset: NormalizeKrakenAsset(info.BaseAsset), Key: key, TargetFeePercent: targetFeePercent}
+	if est.Balance, err = provider.fetchBalance(ctx, info.BaseAsset); err != nil {
+		return est, err
+	}
+
+	t, err := provider.fetchTicker(ctx, pair)
+	if err != nil {
+		return est, err
+	}
+	est.PurchaseVolume = volumeForAmount(m.Config.OrderAmountInCents, t.Ask)
+
+	// an empty balance is quoted for a single purchase, Kraken rejects zero amounts
+	amount := est.Balance
+	if amount <= 0 {
+		amount = est.PurchaseVolume
+	}
+	quote, err := provider.GetWithdrawInfo(ctx, info.BaseAsset, key, amount)
+	if err != nil {
+		return est, err
+	}
+	est.Method, est.Fee = quote.Method, quote.Fee
+	if est.Balance > 0 {
+		est.FeePercent = est.Fee / est.Balance * 100
+	}
+
+	if targetFeePercent > 0 && est.PurchaseVolume > 0 {
+		// the fee is assumed to stay flat as the balance grows
+		needed := est.Fee / (targetFeePercent / 100)
+		if shortfall := needed - est.Balance; shortfall > 0 {
+			// the epsilon keeps float error from adding a purchase when the shortfall is an exact multiple
+			est.PurchasesUntilTarget = int(math.Ceil(shortfall/est.PurchaseVolume - 1e-9))
+		}
+	}
+
+	m.Logger.InfoContext(ctx, "estimated withdrawal", "asset", est.Asset, "balance", est.Balance, "fee", est.Fee,
+		"feePercent", est.FeePercent, "purchasesUntilTarget", est.PurchasesUntilTarget)
+	return est, nil
+}
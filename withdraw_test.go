@@ -0,0 +1,72 @@
+package dca_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/1gm/dca"
+)
+
+func TestApp_EstimateWithdrawal(t *testing.T) {
+	const withdrawInfo = `{"error":[],"result":{"method":"Bitcoin","limit":"1.00000000","amount":"0.00038000","fee":"0.00002000"}}`
+	tt := []struct {
+		balance      string
+		target       float64
+		amount       string
+		feePercent   float64
+		purchases    int
+		expectsError bool
+	}{
+		{"0.0004000000", 0, "0.0004", 5, 0, false},
+		// 0.0016 more at 0.0001 a purchase brings the fee to 1% of 0.002
+		{"0.0004000000", 1, "0.0004", 5, 16, false},
+		{"0.0040000000", 1, "0.004", 0.5, 0, false},
+		// an empty balance is quoted for a single purchase
+		{"", 1, "0.0001", 0, 20, false},
+		{"0.0004000000", -1, "", 0, 0, true},
+	}
+	for i, tc := range tt {
+		balance := `{"error":[],"result":{}}`
+		if tc.balance != "" {
+			balance = `{"error":[],"result":{"XXBT":"` + tc.balance + `","ZUSD":"100.0000"}}`
+		}
+		s := newKrakenTestServer(t, map[string][]string{
+			"/0/private/Balance":      {balance},
+			"/0/public/Ticker":        {tickerResponse},
+			"/0/private/WithdrawInfo": {withdrawInfo},
+		})
+		app, _ := newTestApp(s, dca.AppConfig{})
+
+		est, err := app.EstimateWithdrawal(context.Background(), "cold storage", tc.target)
+		if want, got := tc.expectsError, err != nil; got != want {
+			t.Errorf("%d: want error %v got %v", i, want, err)
+			continue
+		} else if err != nil {
+			continue
+		}
+
+		req := s.Requests("/0/private/WithdrawInfo")[0]
+		for _, kv := range [][2]string{{"asset", "XXBT"}, {"key", "cold storage"}, {"amount", tc.amount}} {
+			if want, got := kv[1], req.Get(kv[0]); got != want {
+				t.Errorf("%d: want %s %v got %v", i, kv[0], want, got)
+			}
+		}
+
+		if want, got := "BTC", est.Asset; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := 0.00002, est.Fee; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.feePercent, est.FeePercent; !approx(got, want) {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		if want, got := tc.purchases, est.PurchasesUntilTarget; got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+		// nothing is withdrawn
+		if want, got := 0, len(s.Requests("/0/private/Withdraw")); got != want {
+			t.Errorf("%d: want %v got %v", i, want, got)
+		}
+	}
+}